@@ -4,6 +4,7 @@
 package main
 
 import (
+	"flag"
 	"os"
 
 	// Imports required to run agent
@@ -14,8 +15,17 @@ import (
 // EdgeServices array contains function pointers to services start functions
 var EdgeServices = []service.StartFunction{eaa.Run}
 
+// check runs the startup self-test of EAA instead of serving it
+var check = flag.Bool("check", false,
+	"run the self-test of the certificates and the Message Broker and exit")
+
 func main() {
 
+	flag.Parse()
+	if *check {
+		EdgeServices = []service.StartFunction{eaa.Check}
+	}
+
 	if !service.RunServices(EdgeServices) {
 		os.Exit(1)
 	}
@@ -18,6 +18,8 @@ require (
 	github.com/docker/docker v1.13.1
 	github.com/docker/go-connections v0.4.0
 	github.com/docker/go-units v0.3.3 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.2.0
+	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/golang/mock v1.4.4
 	github.com/golang/protobuf v1.4.2
 	github.com/google/uuid v1.1.1
@@ -32,9 +34,15 @@ require (
 	github.com/onsi/gomega v1.10.2
 	github.com/open-ness/common/log v0.0.0-20200930152236-ef647c7379b5
 	github.com/pkg/errors v0.9.1
-	github.com/stretchr/testify v1.5.1 // indirect
+	github.com/prometheus/client_golang v1.7.1
+	github.com/stretchr/testify v1.6.1 // indirect
 	github.com/undefinedlabs/go-mpatch v1.0.6
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	github.com/xeipuuv/gojsonschema v1.2.0
 	go.etcd.io/bbolt v1.3.5
+	go.opentelemetry.io/otel v0.13.0
+	go.opentelemetry.io/otel/sdk v0.13.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/sync v0.0.0-20200317015054-43a5402ce75a // indirect
 	google.golang.org/genproto v0.0.0-20200831141814-d751682dd103
 	google.golang.org/grpc v1.31.0
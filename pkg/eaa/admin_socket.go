@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// adminSocketRequester is logged as the requester of admin socket requests,
+// which carry no client certificate
+const adminSocketRequester = "admin socket"
+
+// adminSocketConnectedClients serves GetConnectedClients on the admin
+// socket, where access is controlled by the socket file permissions instead
+// of the admin allowlist
+func adminSocketConnectedClients(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+
+	if err := writeConnectedClients(w, eaaCtx); err != nil {
+		log.Errf("Get Connected Clients: %s", err.Error())
+	}
+}
+
+// newAdminSocketHandler creates the handler of the admin socket. Only the
+// read-only endpoints not relying on the identity of the requester are
+// served, other methods are rejected before routing.
+func newAdminSocketHandler(eaaCtx *Context) http.Handler {
+	router := mux.NewRouter().StrictSlash(true)
+	router.Methods(http.MethodGet).Path("/services").HandlerFunc(GetServices)
+	router.Methods(http.MethodGet).Path("/admin/clients").
+		HandlerFunc(adminSocketConnectedClients)
+	router.Methods(http.MethodGet).Path("/metrics").
+		Handler(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			log.Errf("Admin socket: rejected %s %s", r.Method, r.URL.Path)
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Handlers must not derive an identity from the request
+		r = r.WithContext(context.WithValue(r.Context(),
+			contextKey("appliance-ctx"), eaaCtx))
+		r.TLS = nil
+		router.ServeHTTP(w, r)
+	})
+}
+
+// listenAdminSocket creates the admin socket accessible to the owner of EAA
+// only. A socket left behind by a previous EAA instance is replaced.
+func listenAdminSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "Failed to remove stale admin socket")
+		}
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to listen on admin socket")
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		if closeErr := lis.Close(); closeErr != nil {
+			log.Errf("Could not close admin socket: %#v", closeErr)
+		}
+		return nil, errors.Wrap(err, "Failed to restrict admin socket permissions")
+	}
+
+	return lis, nil
+}
+
+// runAdminSocketServer serves the read-only endpoints on a Unix domain socket
+// without mutual TLS until the parent context is done. The socket file is
+// removed once the server is closed.
+func runAdminSocketServer(parentCtx context.Context, path string, eaaCtx *Context) {
+	lis, err := listenAdminSocket(path)
+	if err != nil {
+		log.Errf("Admin socket disabled: %s", err.Error())
+		return
+	}
+	server := &http.Server{Handler: newAdminSocketHandler(eaaCtx)}
+
+	go func() {
+		<-parentCtx.Done()
+		if err := server.Close(); err != nil {
+			log.Errf("Could not close admin socket server: %#v", err)
+		}
+	}()
+
+	log.Infof("Serving EAA admin socket on: %s", path)
+	if err = server.Serve(lis); err != http.ErrServerClosed {
+		log.Errf("Admin socket server error: %#v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Admin socket", func() {
+	var (
+		eaaCtx     *Context
+		dir        string
+		socketPath string
+		client     *http.Client
+		cancel     context.CancelFunc
+		stopped    chan struct{}
+	)
+
+	g.BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "eaa-admin")
+		Expect(err).ToNot(HaveOccurred())
+		socketPath = filepath.Join(dir, "eaa.sock")
+
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = map[string]Service{
+			"ns:producer": {URN: &URN{Namespace: "ns", ID: "producer"}},
+		}
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+
+		client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		}}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped = make(chan struct{})
+		go func() {
+			runAdminSocketServer(ctx, socketPath, eaaCtx)
+			close(stopped)
+		}()
+		Eventually(func() error {
+			_, err := os.Stat(socketPath)
+			return err
+		}).Should(Succeed())
+	})
+
+	g.AfterEach(func() {
+		cancel()
+		Eventually(stopped).Should(BeClosed())
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	request := func(method, path string) *http.Response {
+		req, err := http.NewRequest(method, "http://eaa"+path, strings.NewReader(""))
+		Expect(err).ToNot(HaveOccurred())
+		resp, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		return resp
+	}
+
+	g.It("serves the read-only endpoints", func() {
+		resp := request("GET", "/services")
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var services ServiceList
+		Expect(json.NewDecoder(resp.Body).Decode(&services)).To(Succeed())
+		Expect(services.Services).To(HaveLen(1))
+
+		for _, path := range []string{"/admin/clients", "/metrics"} {
+			resp := request("GET", path)
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK), path)
+		}
+	})
+
+	g.It("rejects state-changing requests", func() {
+		for _, method := range []string{"POST", "DELETE"} {
+			resp := request(method, "/services")
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed), method)
+		}
+
+		resp := request("GET", "/subscriptions")
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	g.It("is accessible to the owner only and removed on shutdown", func() {
+		info, err := os.Stat(socketPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		cancel()
+		Eventually(stopped).Should(BeClosed())
+		_, err = os.Stat(socketPath)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
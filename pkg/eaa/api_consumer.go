@@ -4,8 +4,12 @@
 package eaa
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -17,9 +21,40 @@ var socket = websocket.Upgrader{
 	WriteBufferSize: 512,
 }
 
+// defaultMaxConnectionsPerConsumer is the connection limit applied if
+// MaxConnectionsPerConsumer isn't configured
+const defaultMaxConnectionsPerConsumer = 16
+
+// errConnectionLimit is returned if a consumer opening a connection has
+// MaxConnectionsPerConsumer connections open already
+var errConnectionLimit = errors.New("connection limit exceeded")
+
+// checkConnectionLimit checks if the consumer may open another notification
+// connection, consumer connections have to be locked by the caller. The
+// connections are counted as long as they're registered, so a connection
+// removed after it's closed, normally or not, frees its place.
+func checkConnectionLimit(commonName string, eaaCtx *Context) error {
+	limit := eaaCtx.config().MaxConnectionsPerConsumer
+	if limit <= 0 {
+		limit = defaultMaxConnectionsPerConsumer
+	}
+	if len(eaaCtx.consumerConnections.m[commonName]) >= limit {
+		return fmt.Errorf("%w: %s has %d connections open", errConnectionLimit,
+			commonName, limit)
+	}
+	return nil
+}
+
 // createWsConn creates a websocket connection for a consumer
-// to receive data from subscribed producers
-func createWsConn(w http.ResponseWriter, r *http.Request) (int, error) {
+// to receive data from subscribed producers, only the ones of
+// the connection filter requested if any, and returns the connection
+// registered. A consumer may open several connections with filters, e.g.
+// to fan its subscriptions across them, but a single one without a filter:
+// a new unfiltered connection replaces the previous one, which is closed
+// with connectionReplacedCloseReason, so reconnecting doesn't accumulate
+// connections. A connection over MaxConnectionsPerConsumer is rejected
+// with 429 before the upgrade.
+func createWsConn(w http.ResponseWriter, r *http.Request) (notificationConn, int, error) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
 
 	// Get the consumer app ID from the Common Name in the certificate
@@ -27,48 +62,325 @@ func createWsConn(w http.ResponseWriter, r *http.Request) (int, error) {
 
 	// Check if urn ID matches the Host included in the request header
 	if commonName != r.Host {
-		return http.StatusUnauthorized,
+		return nil, http.StatusUnauthorized,
 			errors.New("401: Incorrect app ID")
 	}
 
+	protocol, err := negotiateNotificationsProtocol(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	snapshot, err := parseBool(r.URL.Query(), "snapshot")
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("%w: %v", errInvalidConnectionFilter, err)
+	}
+
+	// The service snapshot is taken once the connection is registered and
+	// the lock released, as sending notifications takes the subscription
+	// lock before the consumer connections lock. The notifications
+	// delivered meanwhile are held back until it's written.
+	var (
+		snapshotWriter *snapshotConn
+		registered     notificationConn
+	)
+	defer func() {
+		if snapshotWriter != nil {
+			sendServiceSnapshot(commonName, snapshotWriter, registered, eaaCtx)
+		}
+	}()
+
 	eaaCtx.consumerConnections.Lock()
 	defer eaaCtx.consumerConnections.Unlock()
 
-	// Check if connection was created for urn ID, if so send close
-	// message, close the connection and delete the entry in the
-	// connections structure
-	foundConn, connFound := eaaCtx.consumerConnections.m[commonName]
-	if connFound {
-		prevConn := foundConn.connection
-		msgType := websocket.CloseMessage
-		closeMessage := websocket.FormatCloseMessage(
-			websocket.CloseServiceRestart,
-			"New connection request, closing this connection")
-		err := prevConn.WriteMessage(msgType, closeMessage)
-		if err != nil {
-			log.Info("Failed to send close message to old connection")
-		}
-		err = prevConn.Close()
-		if err != nil {
-			log.Info("Failed to close previous websocket connection")
-		}
-		delete(eaaCtx.consumerConnections.m, commonName)
+	if filter.unfiltered() {
+		closePreviousConsumerConnection(commonName, eaaCtx)
+	}
+	if err = checkConnectionLimit(commonName, eaaCtx); err != nil {
+		return nil, http.StatusTooManyRequests, err
 	}
 
 	// Create nil connection obj in consumerConnections map. That means the
 	// procedure of web socket connection has started.
-	eaaCtx.consumerConnections.m[commonName] = ConsumerConnection{
-		connection: nil}
-	conn, err := socket.Upgrade(w, r, nil)
+	eaaCtx.consumerConnections.add(commonName, ConsumerConnection{
+		connection: nil, filter: filter})
+	upgrader := socket
+	upgrader.EnableCompression = eaaCtx.config().WebSocketCompression.Enabled
+	if protocol != "" {
+		upgrader.Subprotocols = []string{protocol}
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		delete(eaaCtx.consumerConnections.m, commonName)
-		return 0, err
+		eaaCtx.consumerConnections.remove(commonName, nil)
+		return nil, 0, err
+	}
+	// The level applies only if the consumer negotiated the compression
+	if level := eaaCtx.config().WebSocketCompression.Level; level != 0 {
+		if err = conn.SetCompressionLevel(level); err != nil {
+			log.Errf("Failed to set the compression level of %s websocket: %v",
+				commonName, err)
+		}
+	}
+
+	// The activity of the connection is tracked only if idle ones are closed
+	var (
+		connection  notificationConn = conn
+		activity    *connActivity
+		idleTimeout = eaaCtx.config().WebSocketIdleTimeout.Duration
+	)
+	if idleTimeout > 0 {
+		activity = &connActivity{}
+		activity.touch(time.Now())
+		connection = idleTrackingConn{conn, activity}
+	}
+	if protocol == NotificationsProtocolV2 {
+		connection = notificationV2Conn{connection}
+	}
+	// The notification envelopes are encoded by the Accept header of
+	// the upgrade request
+	if responseCodec(r).isMsgpack() {
+		connection = notificationMsgpackConn{connection}
+	}
+	if snapshot {
+		snapshotWriter = &snapshotConn{notificationConn: connection}
+		connection = snapshotWriter
+	}
+	connection = queueConsumerConn(commonName, connection, eaaCtx)
+
+	registered = connection
+	certificateExpiry := r.TLS.PeerCertificates[0].NotAfter
+	eaaCtx.consumerConnections.remove(commonName, nil)
+	eaaCtx.consumerConnections.add(commonName, ConsumerConnection{
+		connection: connection, connectedAt: time.Now(), filter: filter,
+		certificateExpiry: certificateExpiry, acks: true})
+
+	if eaaCtx.config().WebSocketPingInterval.Duration > 0 {
+		keepConsumerConnAlive(commonName, conn, connection, activity, eaaCtx)
+	} else {
+		go readConsumerMessages(commonName, conn, connection, activity, eaaCtx)
+	}
+	if idleTimeout > 0 {
+		closeWhenIdle(commonName, connection, activity, idleTimeout, eaaCtx)
+	}
+	closeAtCertificateExpiry(commonName, certificateExpiry, eaaCtx)
+
+	return connection, 0, nil
+}
+
+// queueConsumerConn adds a send queue of WebSocketSendQueueSize to
+// a connection of the consumer, unless the size is 0. A connection closed
+// by its queue is removed from the consumer connections.
+func queueConsumerConn(commonName string, conn notificationConn,
+	eaaCtx *Context) notificationConn {
+
+	size := eaaCtx.config().WebSocketSendQueueSize
+	if size <= 0 {
+		return conn
+	}
+	writeTimeout := eaaCtx.config().WebSocketWriteTimeout.Duration
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWebSocketWriteTimeout
+	}
+
+	queued := newQueuedConn(conn, size, eaaCtx.config().WebSocketSendQueueOverflow,
+		writeTimeout)
+	queued.closed = func(cause error) {
+		removeConsumerConnection(commonName, queued, cause, backpressureCloseReason, eaaCtx)
+	}
+	return queued
+}
+
+// closePreviousConsumerConnection closes the connection without a filter
+// the consumer made before a new one, consumer connections have to be locked
+// by the caller
+func closePreviousConsumerConnection(commonName string, eaaCtx *Context) {
+	for _, consumerConn := range eaaCtx.consumerConnections.m[commonName] {
+		if consumerConn.connection == nil || !consumerConn.filter.unfiltered() {
+			continue
+		}
+		closeWithReason(commonName, consumerConn.connection,
+			connectionReplacedCloseReason)
+		eaaCtx.consumerConnections.remove(commonName, consumerConn.connection)
+	}
+}
+
+// add registers a connection of the consumer, consumer connections have
+// to be locked by the caller
+func (c *consumerConns) add(commonName string, consumerConn ConsumerConnection) {
+	c.m[commonName] = append(c.m[commonName], consumerConn)
+	websocketConnections.Set(float64(c.count()))
+}
+
+// remove forgets the connection of the consumer, a nil one is the connection
+// still being established. False is returned if the consumer had no such
+// connection. Consumer connections have to be locked by the caller.
+func (c *consumerConns) remove(commonName string, conn notificationConn) bool {
+	conns := c.m[commonName]
+	for i, consumerConn := range conns {
+		if consumerConn.connection != conn {
+			continue
+		}
+		if len(conns) == 1 {
+			delete(c.m, commonName)
+		} else {
+			// The slice is copied as the readers may still hold it
+			c.m[commonName] = append(conns[:i:i], conns[i+1:]...)
+		}
+		websocketConnections.Set(float64(c.count()))
+		return true
+	}
+	return false
+}
+
+// count returns the number of the established connections of all
+// the consumers, consumer connections have to be locked by the caller
+func (c *consumerConns) count() int {
+	count := 0
+	for _, conns := range c.m {
+		for _, consumerConn := range conns {
+			if consumerConn.connection != nil {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// keepConsumerConnAlive pings the consumer websocket every
+// WebSocketPingInterval and closes it if no pong arrives within
+// WebSocketPongTimeout after a ping. Both goroutines exit when
+// the connection is closed. The registered connection is the one stored
+// in the consumer connections, the websocket itself or its send queue.
+// The pongs are recorded as the activity of the connection if it's tracked.
+func keepConsumerConnAlive(commonName string, conn *websocket.Conn,
+	registered notificationConn, activity *connActivity, eaaCtx *Context) {
+	interval := eaaCtx.config().WebSocketPingInterval.Duration
+	pongTimeout := eaaCtx.config().WebSocketPongTimeout.Duration
+	if pongTimeout <= 0 {
+		pongTimeout = interval
 	}
+	readDeadline := func() time.Time {
+		return time.Now().Add(interval + pongTimeout)
+	}
+
+	if err := conn.SetReadDeadline(readDeadline()); err != nil {
+		log.Errf("Failed to set the read deadline of %s websocket: %v", commonName, err)
+	}
+	conn.SetPongHandler(func(string) error {
+		activity.touch(time.Now())
+		return conn.SetReadDeadline(readDeadline())
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := conn.WriteControl(websocket.PingMessage, nil,
+					time.Now().Add(pongTimeout))
+				if err != nil {
+					log.Debugf("Failed to ping %s websocket: %v", commonName, err)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
 
-	eaaCtx.consumerConnections.m[commonName] = ConsumerConnection{
-		connection: conn}
+	// Control frames are handled only while reading
+	go func() {
+		defer close(done)
+		readConsumerMessages(commonName, conn, registered, activity, eaaCtx)
+	}()
+}
 
-	return 0, nil
+// readConsumerMessages reads the messages of the consumer, which are acks
+// of notifications, until the websocket is closed. The dead
+// connection is removed then. The messages are recorded as the activity of
+// the connection if it's tracked.
+func readConsumerMessages(commonName string, conn *websocket.Conn,
+	registered notificationConn, activity *connActivity, eaaCtx *Context) {
+	for {
+		messageType, r, err := conn.NextReader()
+		if err != nil {
+			removeConsumerConnection(commonName, registered, err,
+				readCloseReason(err), eaaCtx)
+			return
+		}
+		activity.touch(time.Now())
+		handleConsumerMessage(commonName, messageType, r, eaaCtx)
+	}
+}
+
+// closeAtCertificateExpiry schedules closing the consumer websockets opened
+// with a client certificate of the expiry with authExpiredCloseReason once
+// it expires and ClientCertificateExpiryGrace passes. The timer holds only
+// the Common Name and the expiry, so a connection closed before isn't kept
+// around until then.
+func closeAtCertificateExpiry(commonName string, expiry time.Time, eaaCtx *Context) {
+	grace := eaaCtx.config().ClientCertificateExpiryGrace.Duration
+	if expiry.IsZero() || grace < 0 {
+		return
+	}
+
+	time.AfterFunc(time.Until(expiry.Add(grace)), func() {
+		closeExpiredConsumerConnections(commonName, expiry, eaaCtx)
+	})
+}
+
+// closeExpiredConsumerConnections closes the consumer websockets opened with
+// a client certificate of the expiry if it expired for longer than
+// ClientCertificateExpiryGrace. The connections opened with another
+// certificate are left to the timer of their own certificate and the closing
+// is rescheduled if the grace period was extended by a config reload.
+func closeExpiredConsumerConnections(commonName string, expiry time.Time, eaaCtx *Context) {
+	eaaCtx.consumerConnections.Lock()
+	defer eaaCtx.consumerConnections.Unlock()
+
+	var expired []notificationConn
+	for _, consumerConn := range eaaCtx.consumerConnections.m[commonName] {
+		if consumerConn.connection != nil && consumerConn.certificateExpiry.Equal(expiry) {
+			expired = append(expired, consumerConn.connection)
+		}
+	}
+	grace := eaaCtx.config().ClientCertificateExpiryGrace.Duration
+	if len(expired) == 0 || grace < 0 {
+		return
+	}
+	if time.Now().Before(expiry.Add(grace)) {
+		closeAtCertificateExpiry(commonName, expiry, eaaCtx)
+		return
+	}
+
+	for _, conn := range expired {
+		log.Infof("Closing websocket of %s: client certificate expired at %v", commonName,
+			expiry)
+		closeWithReason(commonName, conn, authExpiredCloseReason)
+		eaaCtx.consumerConnections.remove(commonName, conn)
+	}
+}
+
+// removeConsumerConnection closes a dead consumer websocket with the reason
+// and removes it from the consumer connections, unless it was already
+// removed
+func removeConsumerConnection(commonName string, conn notificationConn, cause error,
+	reason wsCloseReason, eaaCtx *Context) {
+
+	eaaCtx.consumerConnections.Lock()
+	defer eaaCtx.consumerConnections.Unlock()
+
+	if !eaaCtx.consumerConnections.remove(commonName, conn) {
+		return
+	}
+
+	log.Infof("Closing websocket of %s: %v", commonName, cause)
+	closeWithReason(commonName, conn, reason)
 }
 
 // getConsumerSubscriptions returns a list of subscriptions belonging
@@ -88,16 +400,300 @@ func getConsumerSubscriptions(commonName string,
 		// if consumer is in namespace subscription, add it to the list
 		if index := getNamespaceSubscriptionIndex(nameNotif,
 			commonName, eaaCtx); index != -1 {
-			subs.addNamespaceSubscriptionToList(nameNotif, eaaCtx)
+			subs.addNamespaceSubscriptionToList(nameNotif, commonName, eaaCtx)
 		}
 		for srvID := range conSub.serviceSubscriptions {
 			// if consumer is in service subscription, add it to the list
 			if index := getServiceSubscriptionIndex(nameNotif, srvID,
 				commonName, eaaCtx); index != -1 {
-				subs.addServiceSubscriptionToList(nameNotif, srvID, eaaCtx)
+				subs.addServiceSubscriptionToList(nameNotif, srvID, commonName,
+					eaaCtx)
 			}
 		}
 
 	}
 	return &subs, nil
 }
+
+// filterSubscriptions keeps the subscriptions of the namespace and service ID,
+// an empty namespace or ID matches any. The namespace of a subscription with
+// a namespace pattern is matched as it is, not expanded.
+func filterSubscriptions(subs *SubscriptionList, namespace string, id string) {
+	if namespace == "" && id == "" {
+		return
+	}
+
+	var filtered []Subscription
+	for _, sub := range subs.Subscriptions {
+		if sub.URN == nil ||
+			(namespace != "" && sub.URN.Namespace != namespace) ||
+			(id != "" && sub.URN.ID != id) {
+			continue
+		}
+		filtered = append(filtered, sub)
+	}
+	subs.Subscriptions = filtered
+}
+
+// addSubscriptionStatus sets the status of the notifications of
+// the consumer subscriptions
+func addSubscriptionStatus(subs *SubscriptionList, commonName string, eaaCtx *Context) {
+	eaaCtx.serviceInfo.RLock()
+	defer eaaCtx.serviceInfo.RUnlock()
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	for i, sub := range subs.Subscriptions {
+		var expiresAt *time.Time
+		if expiry, ok := eaaCtx.subscriptionLeases.expiry(leaseKey{commonName,
+			sub.URN.Namespace, sub.URN.ID}); ok {
+			expiresAt = &expiry
+		}
+
+		status := make([]SubscriptionStatus, 0, len(sub.Notifications))
+		for _, notif := range sub.Notifications {
+			key := UniqueNotif{
+				namespace:    sub.URN.Namespace,
+				notifName:    subscriptionNotifName(notif),
+				notifVersion: notif.Version,
+			}
+			var created time.Time
+			if conSub, ok := eaaCtx.subscriptionInfo.m[key]; ok {
+				created = conSub.getCreated(sub.URN.ID, commonName)
+			}
+
+			notifSub := Subscription{URN: sub.URN,
+				Notifications: []NotificationDescriptor{notif}}
+			matching := false
+			for _, serv := range eaaCtx.serviceInfo.m {
+				if serviceMatchesSubscription(serv, notifSub) {
+					matching = true
+					break
+				}
+			}
+
+			status = append(status, SubscriptionStatus{
+				CreatedAt: created,
+				ExpiresAt: expiresAt,
+				Matching:  matching,
+				Delivered: eaaCtx.subscriptionStats.delivered(commonName,
+					sub.URN.Namespace, notif),
+			})
+		}
+		subs.Subscriptions[i].Status = status
+	}
+}
+
+// serviceMatchesSubscription checks if a service is a producer of any of
+// the notifications of a subscription
+func serviceMatchesSubscription(serv Service, sub Subscription) bool {
+	if serv.URN == nil || sub.URN == nil {
+		return false
+	}
+	if !serv.URN.Matches(*sub.URN) {
+		return false
+	}
+
+	for _, subNotif := range sub.Notifications {
+		for _, servNotif := range serv.Notifications {
+			if descriptorNameMatches(subNotif, servNotif.Name) &&
+				subNotif.Version == servNotif.Version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getSubscriptionMatches returns subscriptions of the consumer annotated
+// with the registered producers matching them
+func getSubscriptionMatches(commonName string,
+	eaaCtx *Context) (*SubscriptionMatchList, error) {
+
+	subs, err := getConsumerSubscriptions(commonName, eaaCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	eaaCtx.serviceInfo.RLock()
+	defer eaaCtx.serviceInfo.RUnlock()
+
+	matches := SubscriptionMatchList{Subscriptions: []SubscriptionMatch{}}
+	for _, sub := range subs.Subscriptions {
+		match := SubscriptionMatch{Subscription: sub, Producers: []URN{}}
+		for _, serv := range eaaCtx.serviceInfo.m {
+			if serviceMatchesSubscription(serv, sub) {
+				match.Producers = append(match.Producers, *serv.URN)
+			}
+		}
+		sort.Slice(match.Producers, func(i, j int) bool {
+			return match.Producers[i].String() < match.Producers[j].String()
+		})
+		matches.Subscriptions = append(matches.Subscriptions, match)
+	}
+
+	return &matches, nil
+}
+
+// countConsumerSubscriptions returns the number of notifications
+// the consumer is subscribed to
+func countConsumerSubscriptions(commonName string, eaaCtx *Context) int {
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	count := 0
+	for key, conSub := range eaaCtx.subscriptionInfo.m {
+		if getNamespaceSubscriptionIndex(key, commonName, eaaCtx) != -1 {
+			count++
+		}
+		for srvID := range conSub.serviceSubscriptions {
+			if getServiceSubscriptionIndex(key, srvID, commonName,
+				eaaCtx) != -1 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// getConnectedClients returns consumers with an established websocket
+// connection sorted by CommonName, the age is the one of the oldest
+// connection of a consumer
+func getConnectedClients(eaaCtx *Context) []ConnectedClient {
+	clients := []ConnectedClient{}
+	now := time.Now()
+
+	eaaCtx.consumerConnections.RLock()
+	for commonName, conns := range eaaCtx.consumerConnections.m {
+		client := ConnectedClient{CommonName: commonName}
+		for _, conn := range conns {
+			// Skip connections which are still being established
+			if conn.connection == nil {
+				continue
+			}
+			client.Connections++
+			if age := int64(now.Sub(conn.connectedAt).Seconds()); age > client.ConnectionAge {
+				client.ConnectionAge = age
+			}
+		}
+		if client.Connections > 0 {
+			clients = append(clients, client)
+		}
+	}
+	eaaCtx.consumerConnections.RUnlock()
+
+	// Subscriptions are counted after releasing consumerConnections lock,
+	// notification sending takes the locks in the opposite order
+	for i := range clients {
+		clients[i].Subscriptions = countConsumerSubscriptions(
+			clients[i].CommonName, eaaCtx)
+		clients[i].AckBacklog = eaaCtx.unackedNotifs.backlog(clients[i].CommonName)
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CommonName < clients[j].CommonName
+	})
+	return clients
+}
+
+// writeConnectedClients encodes the consumers with an established websocket
+// connection to the response
+func writeConnectedClients(w http.ResponseWriter, eaaCtx *Context) error {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(getConnectedClients(eaaCtx))
+}
+
+// isSubscribedToService checks if a consumer is subscribed to any
+// notification of the service. Subscription info has to be locked by the caller.
+func isSubscribedToService(subID string, urn URN, eaaCtx *Context) bool {
+	for key := range eaaCtx.subscriptionInfo.m {
+		if namespaceMatches(key.namespace, urn.Namespace) &&
+			getNamespaceSubscriptionIndex(key, subID, eaaCtx) != -1 {
+			return true
+		}
+		if key.namespace == urn.Namespace &&
+			getServiceSubscriptionIndex(key, urn.ID, subID, eaaCtx) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// getOrphanedConsumers returns consumers subscribed to the removed service
+// whose subscriptions do not match any of the registered services
+func getOrphanedConsumers(removed URN, eaaCtx *Context) []string {
+	var live []URN
+	eaaCtx.serviceInfo.RLock()
+	for _, serv := range eaaCtx.serviceInfo.m {
+		if serv.URN != nil {
+			live = append(live, *serv.URN)
+		}
+	}
+	eaaCtx.serviceInfo.RUnlock()
+
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	candidates := make(map[string]bool)
+	for _, conSub := range eaaCtx.subscriptionInfo.m {
+		for _, subID := range conSub.namespaceSubscriptions {
+			candidates[subID] = true
+		}
+		for _, srvSubs := range conSub.serviceSubscriptions {
+			for _, subID := range srvSubs {
+				candidates[subID] = true
+			}
+		}
+	}
+
+	var orphaned []string
+	for subID := range candidates {
+		if !isSubscribedToService(subID, removed, eaaCtx) {
+			continue
+		}
+		orphan := true
+		for _, urn := range live {
+			if isSubscribedToService(subID, urn, eaaCtx) {
+				orphan = false
+				break
+			}
+		}
+		if orphan {
+			orphaned = append(orphaned, subID)
+		}
+	}
+	sort.Strings(orphaned)
+	return orphaned
+}
+
+// closeConsumerConnection sends a close frame with the reason to every
+// websocket of the consumer, closes them and removes them from the consumer
+// connections. The connections are handled under the consumerConnections
+// lock so it can't race with createWsConn adding one. The number of
+// the established connections closed is returned.
+func closeConsumerConnection(subID string, reason wsCloseReason, eaaCtx *Context) int {
+	eaaCtx.consumerConnections.Lock()
+	defer eaaCtx.consumerConnections.Unlock()
+
+	closed := 0
+	for _, consumerConn := range eaaCtx.consumerConnections.m[subID] {
+		if consumerConn.connection == nil {
+			continue
+		}
+		closeWithReason(subID, consumerConn.connection, reason)
+		eaaCtx.consumerConnections.remove(subID, consumerConn.connection)
+		closed++
+	}
+	return closed
+}
+
+// closeOrphanedConsumerConnections closes websockets of the consumers which
+// were left without any registered service after the service removal
+func closeOrphanedConsumerConnections(removed URN, eaaCtx *Context) {
+	for _, subID := range getOrphanedConsumers(removed, eaaCtx) {
+		log.Infof("Closing websocket of %s: no subscribed service is registered",
+			subID)
+		closeConsumerConnection(subID, serviceDeregisteredCloseReason, eaaCtx)
+	}
+}
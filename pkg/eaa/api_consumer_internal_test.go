@@ -0,0 +1,756 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newTLSRequest creates a request carrying the EAA context and a client
+// certificate with the given CommonName
+func newTLSRequest(method, target, body, commonName string, eaaCtx *Context) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: commonName}},
+		},
+	}
+	return r.WithContext(context.WithValue(r.Context(),
+		contextKey("appliance-ctx"), eaaCtx))
+}
+
+var _ = g.Describe("api_consumer connected clients", func() {
+	var eaaContext *Context
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.cfg.AdminCommonNames = []string{"admin"}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		eaaContext.subscriptionInfo = NotificationSubscriptions{m: make(map[UniqueNotif]*ConsumerSubscription)}
+
+		eaaContext.consumerConnections.m["ns:bb"] = []ConsumerConnection{{
+			connection: &websocket.Conn{}, connectedAt: time.Now().Add(-time.Minute)}}
+		eaaContext.consumerConnections.m["ns:aa"] = []ConsumerConnection{{
+			connection: &websocket.Conn{}, connectedAt: time.Now()}}
+		// connection which is still being established
+		eaaContext.consumerConnections.m["ns:cc"] = []ConsumerConnection{{}}
+
+		eaaContext.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}] = &ConsumerSubscription{
+			namespaceSubscriptions: SubscriberIds{"ns:bb"},
+			serviceSubscriptions: map[string]SubscriberIds{
+				"ns:producer": {"ns:aa", "ns:bb"},
+			},
+		}
+	})
+
+	g.Describe("getConnectedClients", func() {
+		g.It("returns established connections sorted by CommonName", func() {
+			clients := getConnectedClients(eaaContext)
+
+			Expect(clients).To(HaveLen(2))
+			Expect(clients[0].CommonName).To(Equal("ns:aa"))
+			Expect(clients[0].Subscriptions).To(Equal(1))
+			Expect(clients[1].CommonName).To(Equal("ns:bb"))
+			Expect(clients[1].Subscriptions).To(Equal(2))
+			Expect(clients[1].ConnectionAge).To(BeNumerically(">=", 60))
+		})
+	})
+
+	g.Describe("GetConnectedClients", func() {
+		g.It("rejects clients not on the admin allowlist", func() {
+			rec := httptest.NewRecorder()
+
+			GetConnectedClients(rec, newTLSRequest("GET", "/admin/clients", "", "ns:aa", eaaContext))
+
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+		})
+
+		g.It("returns the connected clients to an admin", func() {
+			rec := httptest.NewRecorder()
+
+			GetConnectedClients(rec, newTLSRequest("GET", "/admin/clients", "", "admin", eaaContext))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var clients []ConnectedClient
+			Expect(json.NewDecoder(rec.Body).Decode(&clients)).To(Succeed())
+			Expect(clients).To(HaveLen(2))
+		})
+	})
+
+	g.Describe("DisconnectClient", func() {
+		var conn *closingNotificationConn
+
+		disconnect := func(target, query, commonName string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("DELETE", "/admin/clients/"+target+query, "", commonName,
+				eaaContext)
+			DisconnectClient(rec, mux.SetURLVars(r, map[string]string{"commonName": target}))
+			return rec
+		}
+
+		g.BeforeEach(func() {
+			conn = &closingNotificationConn{closeFrame: make(chan []byte, 1)}
+			eaaContext.consumerConnections.m["ns:bb"] = []ConsumerConnection{{
+				connection: conn, connectedAt: time.Now()}}
+		})
+
+		g.It("rejects clients not on the admin allowlist", func() {
+			rec := disconnect("ns:bb", "", "ns:aa")
+
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(eaaContext.consumerConnections.m).To(HaveKey("ns:bb"))
+		})
+
+		g.It("closes the connection of the consumer", func() {
+			rec := disconnect("ns:bb", "", "admin")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var result DisconnectionResult
+			Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+			Expect(result).To(Equal(DisconnectionResult{CommonName: "ns:bb", Closed: 1}))
+			Expect(<-conn.closeFrame).To(Equal(disconnectedCloseReason.message()))
+			Expect(atomic.LoadInt32(&conn.closed)).To(Equal(int32(1)))
+			Expect(eaaContext.consumerConnections.m).ToNot(HaveKey("ns:bb"))
+			Expect(countConsumerSubscriptions("ns:bb", eaaContext)).To(Equal(2))
+
+			rec = disconnect("ns:bb", "", "admin")
+			Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+			Expect(result.Closed).To(BeZero())
+		})
+
+		g.It("removes the subscriptions of the consumer if requested", func() {
+			eaaContext.MsgBrokerCtx = NewGoChannelMsgBroker(eaaContext)
+			defer func() {
+				Expect(eaaContext.MsgBrokerCtx.removeAll()).To(Succeed())
+			}()
+
+			rec := disconnect("ns:bb", "?removeSubscriptions=true", "admin")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var result DisconnectionResult
+			Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+			Expect(result.SubscriptionsRemoved).To(BeTrue())
+			Eventually(func() int {
+				return countConsumerSubscriptions("ns:bb", eaaContext)
+			}).Should(BeZero())
+		})
+	})
+})
+
+var _ = g.Describe("api_consumer service deregistration", func() {
+	var eaaContext *Context
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.serviceInfo.m = map[string]Service{
+			"ns:live": {URN: &URN{Namespace: "ns", ID: "live"}},
+		}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		eaaContext.subscriptionInfo = NotificationSubscriptions{m: make(map[UniqueNotif]*ConsumerSubscription)}
+
+		notif := []NotificationDescriptor{{Name: "name", Version: "1.0"}}
+		Expect(addSubscriptionToService("service-sub", "ns", "removed", notif, eaaContext)).To(Succeed())
+		Expect(addSubscriptionToNamespace("namespace-sub", "ns", notif, eaaContext)).To(Succeed())
+		Expect(addSubscriptionToNamespace("pattern-sub", "n*", notif, eaaContext)).To(Succeed())
+		Expect(addSubscriptionToService("other-sub", "ns", "other", notif, eaaContext)).To(Succeed())
+	})
+
+	g.Describe("getOrphanedConsumers", func() {
+		g.It("returns consumers left without a live service", func() {
+			orphaned := getOrphanedConsumers(URN{Namespace: "ns", ID: "removed"}, eaaContext)
+
+			Expect(orphaned).To(Equal([]string{"service-sub"}))
+		})
+
+		g.It("returns namespace subscribers once the namespace is empty", func() {
+			delete(eaaContext.serviceInfo.m, "ns:live")
+
+			orphaned := getOrphanedConsumers(URN{Namespace: "ns", ID: "removed"}, eaaContext)
+
+			Expect(orphaned).To(Equal([]string{"namespace-sub", "pattern-sub", "service-sub"}))
+		})
+	})
+
+	g.Describe("closeOrphanedConsumerConnections", func() {
+		g.It("sends a close frame with the reason to the orphaned consumer", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := socket.Upgrade(w, r, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				eaaContext.consumerConnections.Lock()
+				eaaContext.consumerConnections.m["service-sub"] = []ConsumerConnection{{connection: conn}}
+				eaaContext.consumerConnections.Unlock()
+			}))
+			defer server.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial(
+				"ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			defer conn.Close()
+			Eventually(func() int {
+				eaaContext.consumerConnections.RLock()
+				defer eaaContext.consumerConnections.RUnlock()
+				return len(eaaContext.consumerConnections.m)
+			}).Should(Equal(1))
+
+			closeOrphanedConsumerConnections(URN{Namespace: "ns", ID: "removed"}, eaaContext)
+
+			_, _, err = conn.ReadMessage()
+			closeErr, ok := err.(*websocket.CloseError)
+			Expect(ok).To(BeTrue())
+			Expect(closeErr.Code).To(Equal(serviceDeregisteredCloseReason.code))
+			Expect(closeErr.Text).To(Equal(serviceDeregisteredCloseReason.text))
+			Expect(eaaContext.consumerConnections.m).NotTo(HaveKey("service-sub"))
+		})
+	})
+})
+
+var _ = g.Describe("api_consumer subscription matches", func() {
+	var eaaContext *Context
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.subscriptionInfo = NotificationSubscriptions{m: make(map[UniqueNotif]*ConsumerSubscription)}
+		eaaContext.serviceInfo.m = map[string]Service{
+			"ns:p2": {URN: &URN{Namespace: "ns", ID: "p2"},
+				Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}}},
+			"ns:p1": {URN: &URN{Namespace: "ns", ID: "p1"},
+				Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}}},
+			"ns:old": {URN: &URN{Namespace: "ns", ID: "old"},
+				Notifications: []NotificationDescriptor{{Name: "n1", Version: "0.9"}}},
+			"nx:p3": {URN: &URN{Namespace: "nx", ID: "p3"},
+				Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}}},
+		}
+
+		notif := []NotificationDescriptor{{Name: "n1", Version: "1.0"}}
+		Expect(addSubscriptionToNamespace("consumer", "ns", notif, eaaContext)).To(Succeed())
+		Expect(addSubscriptionToNamespace("consumer", "n*", notif, eaaContext)).To(Succeed())
+		Expect(addSubscriptionToService("consumer", "ns", "p1", notif, eaaContext)).To(Succeed())
+		Expect(addSubscriptionToService("consumer", "ns", "missing", notif, eaaContext)).To(Succeed())
+	})
+
+	g.It("annotates each subscription with the matching producers", func() {
+		matches, err := getSubscriptionMatches("consumer", eaaContext)
+		Expect(err).ToNot(HaveOccurred())
+
+		producers := make(map[string][]URN)
+		for _, m := range matches.Subscriptions {
+			producers[m.URN.String()] = m.Producers
+		}
+		Expect(producers).To(Equal(map[string][]URN{
+			"ns:": {{Namespace: "ns", ID: "p1"}, {Namespace: "ns", ID: "p2"}},
+			"n*:": {{Namespace: "ns", ID: "p1"}, {Namespace: "ns", ID: "p2"},
+				{Namespace: "nx", ID: "p3"}},
+			"ns:p1":      {{Namespace: "ns", ID: "p1"}},
+			"ns:missing": {},
+		}))
+	})
+
+	g.It("returns an empty list to a consumer without subscriptions", func() {
+		rec := httptest.NewRecorder()
+		GetSubscriptionMatches(rec, newTLSRequest("GET", "/subscriptions/matches", "",
+			"other", eaaContext))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{"subscriptions":[]}`))
+	})
+})
+
+var _ = g.Describe("api_consumer websocket keepalive", func() {
+	var (
+		eaaContext *Context
+		server     *httptest.Server
+	)
+
+	isConnected := func() bool {
+		eaaContext.consumerConnections.RLock()
+		defer eaaContext.consumerConnections.RUnlock()
+		_, found := eaaContext.consumerConnections.m["consumer"]
+		return found
+	}
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		eaaContext.cfg.WebSocketPingInterval.Duration = 20 * time.Millisecond
+		eaaContext.cfg.WebSocketPongTimeout.Duration = 20 * time.Millisecond
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := socket.Upgrade(w, r, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			eaaContext.consumerConnections.Lock()
+			eaaContext.consumerConnections.m["consumer"] = []ConsumerConnection{{connection: conn}}
+			eaaContext.consumerConnections.Unlock()
+			keepConsumerConnAlive("consumer", conn, conn, nil, eaaContext)
+		}))
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Eventually(isConnected).Should(BeTrue())
+		return conn
+	}
+
+	g.It("keeps connections answering pings", func() {
+		conn := dial()
+		defer conn.Close()
+		// Reading answers the pings with pongs
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		Consistently(isConnected, 200*time.Millisecond).Should(BeTrue())
+	})
+
+	g.It("closes and removes connections missing the pong deadline", func() {
+		conn := dial()
+		defer conn.Close()
+
+		Eventually(isConnected).Should(BeFalse())
+	})
+
+	g.It("keeps the other connections of the consumer", func() {
+		conn := dial()
+		other := &fakeNotificationConn{}
+		eaaContext.consumerConnections.Lock()
+		eaaContext.consumerConnections.add("consumer", ConsumerConnection{connection: other})
+		eaaContext.consumerConnections.Unlock()
+		Expect(conn.Close()).To(Succeed())
+
+		Eventually(func() []notificationConn {
+			eaaContext.consumerConnections.RLock()
+			defer eaaContext.consumerConnections.RUnlock()
+			var conns []notificationConn
+			for _, consumerConn := range eaaContext.consumerConnections.m["consumer"] {
+				conns = append(conns, consumerConn.connection)
+			}
+			return conns
+		}).Should(ConsistOf(BeIdenticalTo(other)))
+	})
+})
+
+var _ = g.Describe("api_consumer websocket compression", func() {
+	var (
+		eaaContext *Context
+		server     *httptest.Server
+	)
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The consumer websocket is identified by the Host header
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}}}}
+			_, _, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaContext)))
+			Expect(err).ShouldNot(HaveOccurred())
+		}))
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	dial := func() (*websocket.Conn, string) {
+		dialer := websocket.Dialer{EnableCompression: true}
+		conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		return conn, resp.Header.Get("Sec-WebSocket-Extensions")
+	}
+
+	g.It("negotiates the compression if enabled", func() {
+		eaaContext.cfg.WebSocketCompression = WebSocketCompressionInfo{Enabled: true, Level: 9}
+		conn, extensions := dial()
+		defer conn.Close()
+		Expect(extensions).To(ContainSubstring("permessage-deflate"))
+
+		payload := []byte(`{"name":"n1","payload":"` + strings.Repeat("a", 1024) + `"}`)
+		Expect(sendNotificationToSubscriber(strings.TrimPrefix(server.URL, "http://"), nil,
+			payload, "", time.Time{}, eaaContext)).To(Succeed())
+		_, received, err := conn.ReadMessage()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(received).To(Equal(payload))
+	})
+
+	g.It("doesn't compress if disabled", func() {
+		conn, extensions := dial()
+		defer conn.Close()
+		Expect(extensions).To(BeEmpty())
+	})
+})
+
+// countingConn counts the bytes read from the connection
+type countingConn struct {
+	net.Conn
+	read *int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(c.read, int64(n))
+	return n, err
+}
+
+// BenchmarkWebSocketCompression measures writing a notification to
+// a consumer websocket uncompressed and at the compression levels, and
+// the bytes sent for it
+func BenchmarkWebSocketCompression(b *testing.B) {
+	var readings []string
+	for i := 0; i < 16; i++ {
+		readings = append(readings, fmt.Sprintf(`{"sensor":"temperature-%d",`+
+			`"value":%d.%d,"unit":"celsius","time":"2020-11-05T10:%02d:00Z"}`,
+			i, 20+i%5, i, i))
+	}
+	notif, err := json.Marshal(NotificationToConsumer{Name: "readings", Version: "1.0",
+		URN:     URN{ID: "producer", Namespace: "ns"},
+		Payload: json.RawMessage(`{"readings":[` + strings.Join(readings, ",") + `]}`)})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, level := range []int{0, 1, 6, 9} {
+		name := "uncompressed"
+		if level != 0 {
+			name = fmt.Sprintf("level %d", level)
+		}
+		b.Run(name, func(b *testing.B) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				r *http.Request) {
+				upgrader := websocket.Upgrader{EnableCompression: level != 0}
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				if level != 0 {
+					if err = conn.SetCompressionLevel(level); err != nil {
+						return
+					}
+				}
+				for i := 0; i < b.N; i++ {
+					if err = conn.WriteMessage(websocket.TextMessage, notif); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			var read int64
+			dialer := websocket.Dialer{EnableCompression: true,
+				NetDial: func(network, addr string) (net.Conn, error) {
+					conn, err := net.Dial(network, addr)
+					return countingConn{Conn: conn, read: &read}, err
+				}}
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err = conn.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&read))/float64(b.N), "wire-B/op")
+			b.ReportMetric(float64(len(notif)), "notif-B")
+		})
+	}
+}
+
+var _ = g.Describe("api_consumer client certificate expiry", func() {
+	var (
+		eaaContext *Context
+		server     *httptest.Server
+		notAfter   time.Time
+	)
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}, NotAfter: notAfter}}}
+			_, _, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaContext)))
+			Expect(err).ShouldNot(HaveOccurred())
+		}))
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"),
+			nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		return conn
+	}
+
+	connected := func() bool {
+		eaaContext.consumerConnections.RLock()
+		defer eaaContext.consumerConnections.RUnlock()
+		return len(eaaContext.consumerConnections.m) == 1
+	}
+
+	expectClosedByExpiry := func(conn *websocket.Conn) {
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		Expect(errors.As(err, &closeErr)).To(BeTrue())
+		Expect(closeErr.Code).To(Equal(authExpiredCloseReason.code))
+		Expect(closeErr.Text).To(Equal(authExpiredCloseReason.text))
+		Expect(connected()).To(BeFalse())
+	}
+
+	g.It("closes the websocket when the certificate expires", func() {
+		notAfter = time.Now().Add(200 * time.Millisecond)
+		conn := dial()
+		defer conn.Close()
+		Expect(connected()).To(BeTrue())
+
+		expectClosedByExpiry(conn)
+		Expect(time.Now()).To(BeTemporally(">=", notAfter))
+	})
+
+	g.It("keeps the websocket open for the grace period", func() {
+		eaaContext.cfg.ClientCertificateExpiryGrace.Duration = 500 * time.Millisecond
+		notAfter = time.Now().Add(100 * time.Millisecond)
+		conn := dial()
+		defer conn.Close()
+
+		Consistently(connected, 400*time.Millisecond).Should(BeTrue())
+		expectClosedByExpiry(conn)
+	})
+
+	g.It("keeps the websocket open if disabled", func() {
+		eaaContext.cfg.ClientCertificateExpiryGrace.Duration = -1
+		notAfter = time.Now().Add(100 * time.Millisecond)
+		conn := dial()
+		defer conn.Close()
+
+		Consistently(connected, 400*time.Millisecond).Should(BeTrue())
+	})
+
+	g.It("leaves a replacing connection to its own certificate", func() {
+		notAfter = time.Now().Add(200 * time.Millisecond)
+		conn := dial()
+		defer conn.Close()
+		notAfter = time.Now().Add(time.Hour)
+		replacing := dial()
+		defer replacing.Close()
+
+		Consistently(connected, 400*time.Millisecond).Should(BeTrue())
+	})
+})
+
+var _ = g.Describe("api_consumer websocket subprotocols", func() {
+	var (
+		eaaContext *Context
+		server     *httptest.Server
+	)
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}}}}
+			if _, code, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaContext))); err != nil {
+				w.WriteHeader(code)
+			}
+		}))
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	dial := func(protocols ...string) (*websocket.Conn, *http.Response, error) {
+		dialer := websocket.Dialer{Subprotocols: protocols}
+		return dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	}
+
+	receive := func(conn *websocket.Conn) []byte {
+		payload, err := json.Marshal(NotificationToConsumer{Name: "n1", Version: "1.0",
+			Payload: json.RawMessage(`{"a":1}`), URN: URN{Namespace: "ns", ID: "p"},
+			Sequence: 3})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sendNotificationToSubscriber(strings.TrimPrefix(server.URL, "http://"), nil,
+			payload, "", time.Time{}, eaaContext)).To(Succeed())
+
+		_, received, err := conn.ReadMessage()
+		Expect(err).ShouldNot(HaveOccurred())
+		return received
+	}
+
+	g.It("delivers the v1 envelope without a subprotocol", func() {
+		conn, resp, err := dial()
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+		Expect(resp.Header.Get("Sec-WebSocket-Protocol")).To(BeEmpty())
+
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(receive(conn), &notif)).To(Succeed())
+		Expect(notif.Name).To(Equal("n1"))
+	})
+
+	g.It("delivers the v2 envelope if negotiated", func() {
+		eaaContext.cfg.WebSocketSendQueueSize = 4
+		conn, resp, err := dial("eaa.v3", NotificationsProtocolV1, NotificationsProtocolV2)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+		Expect(resp.Header.Get("Sec-WebSocket-Protocol")).To(Equal(NotificationsProtocolV2))
+
+		var notif NotificationToConsumerV2
+		Expect(json.Unmarshal(receive(conn), &notif)).To(Succeed())
+		Expect(notif).To(Equal(NotificationToConsumerV2{
+			Metadata: NotificationMetadata{Name: "n1", Version: "1.0",
+				Producer: URN{Namespace: "ns", ID: "p"}, Sequence: 3},
+			Payload: json.RawMessage(`{"a":1}`),
+		}))
+	})
+
+	g.It("fails the handshake of unsupported subprotocols", func() {
+		_, resp, err := dial("eaa.v3")
+		Expect(err).Should(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(eaaContext.consumerConnections.m).To(BeEmpty())
+	})
+})
+
+var _ = g.Describe("api_consumer connections per consumer", func() {
+	var (
+		eaaContext *Context
+		server     *httptest.Server
+		rejected   chan error
+	)
+
+	dial := func(query string) (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query,
+			nil)
+	}
+
+	g.BeforeEach(func() {
+		eaaContext = &Context{}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		rejected = make(chan error, 1)
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}}}}
+			if _, code, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaContext))); err != nil {
+				select {
+				case rejected <- err:
+				default:
+				}
+				w.WriteHeader(code)
+			}
+		}))
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	g.It("keeps every filtered connection of a consumer", func() {
+		for i := 0; i < 3; i++ {
+			conn, _, err := dial(fmt.Sprintf("?name=n%d", i))
+			Expect(err).ShouldNot(HaveOccurred())
+			defer conn.Close()
+		}
+
+		eaaContext.consumerConnections.RLock()
+		defer eaaContext.consumerConnections.RUnlock()
+		Expect(eaaContext.consumerConnections.m).To(HaveLen(1))
+		Expect(eaaContext.consumerConnections.m[strings.TrimPrefix(server.URL, "http://")]).
+			To(HaveLen(3))
+		Expect(eaaContext.consumerConnections.count()).To(Equal(3))
+	})
+
+	g.It("replaces the previous unfiltered connection of a consumer", func() {
+		filtered, _, err := dial("?name=n1")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer filtered.Close()
+		var conns []*websocket.Conn
+		for i := 0; i < 3; i++ {
+			conn, _, err := dial("")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer conn.Close()
+			conns = append(conns, conn)
+		}
+
+		for _, conn := range conns[:2] {
+			_, _, err := conn.ReadMessage()
+			var closeErr *websocket.CloseError
+			Expect(errors.As(err, &closeErr)).To(BeTrue())
+			Expect(closeErr.Code).To(Equal(connectionReplacedCloseReason.code))
+		}
+		eaaContext.consumerConnections.RLock()
+		defer eaaContext.consumerConnections.RUnlock()
+		Expect(eaaContext.consumerConnections.count()).To(Equal(2))
+	})
+
+	g.It("rejects the connections over MaxConnectionsPerConsumer", func() {
+		eaaContext.cfg.MaxConnectionsPerConsumer = 2
+		var conns []*websocket.Conn
+		for i := 0; i < 2; i++ {
+			conn, _, err := dial(fmt.Sprintf("?name=n%d", i))
+			Expect(err).ShouldNot(HaveOccurred())
+			defer conn.Close()
+			conns = append(conns, conn)
+		}
+
+		_, resp, err := dial("?name=n2")
+		Expect(err).To(Equal(websocket.ErrBadHandshake))
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(errors.Is(<-rejected, errConnectionLimit)).To(BeTrue())
+
+		g.By("freeing the place of a connection terminated abnormally")
+		Expect(conns[0].UnderlyingConn().Close()).To(Succeed())
+		Eventually(func() error {
+			conn, _, err := dial("?name=n2")
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}).Should(Succeed())
+	})
+})
@@ -4,77 +4,379 @@
 package eaa
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 )
 
-// DeregisterApplication implements https API
+// BroadcastNotification implements https API. It sends a system broadcast
+// of an admin to every consumer connected to this EAA instance, or to
+// the ones of a namespace, regardless of their subscriptions.
+func BroadcastNotification(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+	correlationID := getCorrelationID(r)
+	w.Header().Set(correlationIDHeader, correlationID)
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Broadcast Notification: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	var notif NotificationFromProducer
+	if err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&notif); err != nil {
+		log.Errf("Broadcast Notification: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+	if err := validateSubscriptionNotifications([]NotificationDescriptor{
+		{Name: notif.Name, Version: notif.Version}}); err != nil {
+		log.Errf("Broadcast Notification: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidNotification,
+			err.Error())
+		return
+	}
+
+	// The broadcast is limited to the consumers of the namespace if given
+	namespace := r.URL.Query().Get("namespace")
+	if namespace != "" {
+		if err := validateURNComponent("namespace", namespace); err != nil {
+			log.Errf("Broadcast Notification: %s", err.Error())
+			writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+			return
+		}
+	}
+
+	allowed, retryAfter := eaaCtx.broadcastLimiter.allow(commonName,
+		broadcastRateLimit(eaaCtx), 1, time.Now())
+	if !allowed {
+		log.Errf("Admin %s exceeded the broadcast rate limit", commonName)
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, reasonRateLimitExceeded)
+		return
+	}
+
+	summary, err := broadcastNotification(commonName, namespace, &notif, correlationID,
+		eaaCtx)
+	if err != nil {
+		log.Errf("Broadcast Notification %s: %s", correlationID, err.Error())
+		writeError(w, http.StatusInternalServerError, reasonMarshalingFailed)
+		return
+	}
+	log.Infof("Broadcast %s of %s sent to %d consumers", correlationID, commonName,
+		summary.Delivered)
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(summary); err != nil {
+		log.Errf("Broadcast Notification: failed to encode the result: %s", err.Error())
+	}
+}
+
+// DeregisterApplication implements https API.
+//
+// With the removeSubscriptions query parameter set, the subscriptions of
+// the producer acting also as a consumer are removed after its service is
+// deregistered, even if no service was registered. The subscriptions are
+// kept if the deregistration fails. If the deregistration succeeds but
+// the removal fails, the service stays deregistered and the partial
+// failure is reported with reasonPartialDeregistration.
 func DeregisterApplication(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
+	removeSubscriptions, err := parseBool(r.URL.Query(), "removeSubscriptions")
+	if err != nil {
+		log.Errf("Deregister Application: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+
 	clientCert := r.TLS.PeerCertificates[0]
 	commonName := clientCert.Subject.CommonName
 	URN, err := CommonNameStringToURN(commonName)
 	if err != nil {
 		log.Errf("Error during converting Common Name to URN: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, reasonInvalidURN)
 		return
 	}
 
 	// Check preemptively if a Service exists to return the HTTP code that is more likely to be
 	// correct
 	statusCode := http.StatusNoContent
-	if !isServicePresent(commonName, eaaCtx) {
+	if !isServicePresent(URN.String(), eaaCtx) {
 		statusCode = http.StatusNotFound
 	}
 
+	// Only the owner deregisters a live service with exclusive registration
+	owner := certificateFingerprint(clientCert)
+	eaaCtx.serviceInfo.RLock()
+	err = checkRegistrationOwner(URN.String(), owner, eaaCtx)
+	eaaCtx.serviceInfo.RUnlock()
+	if err != nil {
+		log.Errf("Deregister Application: %s", err.Error())
+		writeError(w, http.StatusConflict, reasonDuplicateURN)
+		return
+	}
+
 	// Prepare Service structure
 	var serv Service
 	serv.URN = &URN
-	svcMsg := ServiceMessage{Svc: &serv, Action: serviceActionDeregister}
+	svcMsg := ServiceMessage{Svc: &serv, Action: serviceActionDeregister, Owner: owner}
 
 	// Create Watermill Message and publish it
 	data, err := json.Marshal(svcMsg)
 	if err != nil {
 		log.Errf("Error during Service structure marshaling: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, reasonMarshalingFailed)
 		return
 	}
 	msg := message.NewMessage(commonName, data)
 
-	err = eaaCtx.MsgBrokerCtx.publish(servicesTopic, msg)
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err = publishWithRetry(ctx, servicesTopic, msg, eaaCtx)
 	if err != nil {
 		log.Errf("Error during Message publishing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writePublishError(w, reasonBrokerPublishFailed, err)
 		return
 	}
 
-	w.WriteHeader(statusCode)
+	if removeSubscriptions {
+		err = processSubscriptionRequest(ctx, subscriptionActionUnsubscribe,
+			subscriptionScopeAll, commonName, nil, nil, 0, r, eaaCtx)
+		if err != nil {
+			log.Errf("Deregister Application: service of %s deregistered, "+
+				"but its subscriptions were not removed: %s", commonName, err.Error())
+			if statusCode != http.StatusNotFound {
+				deregistrationsTotal.Inc()
+			}
+			code := http.StatusInternalServerError
+			if isPublishTimeout(err) || isBrokerCircuitOpen(err) {
+				code = http.StatusServiceUnavailable
+			}
+			writeErrorDetail(w, code, reasonPartialDeregistration,
+				"service deregistered, subscriptions not removed: "+err.Error())
+			return
+		}
+	}
+
+	if statusCode == http.StatusNotFound {
+		writeError(w, statusCode, reasonServiceNotFound)
+	} else {
+		deregistrationsTotal.Inc()
+		w.WriteHeader(statusCode)
+	}
 
 	log.Debugf("Successfully processed DeregisterApplication from %s",
 		commonName)
 }
 
-// GetNotifications implements https API
-func GetNotifications(w http.ResponseWriter, r *http.Request) {
+// DeregisterNotificationSchema implements https API
+func DeregisterNotificationSchema(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Deregister Notification Schema: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	var schema NotificationSchema
+	if err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&schema); err != nil {
+		log.Errf("Deregister Notification Schema: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+	if err := validateNotificationSchemaKey(schema); err != nil {
+		log.Errf("Deregister Notification Schema: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidSchema, err.Error())
+		return
+	}
+
+	if !eaaCtx.notifSchemas.remove(notificationSchemaKey(schema)) {
+		writeError(w, http.StatusNotFound, reasonSchemaNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Debugf("Successfully processed DeregisterNotificationSchema from %s",
+		commonName)
+}
+
+// DisconnectClient implements https API
+func DisconnectClient(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Disconnect Client: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	removeSubscriptions, err := parseBool(r.URL.Query(), "removeSubscriptions")
+	if err != nil {
+		log.Errf("Disconnect Client: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+
+	client := mux.Vars(r)["commonName"]
+	result := DisconnectionResult{CommonName: client}
+	result.Closed = closeConsumerConnection(client, disconnectedCloseReason, eaaCtx)
+	if result.Closed > 0 {
+		log.Infof("Consumer %s disconnected by %s", client, commonName)
+	}
+
+	if removeSubscriptions {
+		ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+		defer cancel()
+		err = processSubscriptionRequest(ctx, subscriptionActionUnsubscribe,
+			subscriptionScopeAll, client, nil, nil, 0, r, eaaCtx)
+		if err != nil {
+			log.Errf("Disconnect Client: %s", err.Error())
+			writePublishError(w, reasonSubscriptionFailed, err)
+			return
+		}
+		result.SubscriptionsRemoved = true
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Errf("Disconnect Client: failed to encode the result: %s", err.Error())
+	}
+	log.Debugf("Successfully processed DisconnectClient of %s from %s", client,
+		commonName)
+}
+
+// ExportSubscriptions implements https API. It returns the subscriptions of
+// all consumers to be imported by another EAA.
+func ExportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Export Subscriptions: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	export, err := exportSubscriptions(eaaCtx)
+	if err != nil {
+		log.Errf("Export Subscriptions: %s", err.Error())
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(export); err != nil {
+		log.Errf("Export Subscriptions: failed to encode the subscriptions: %s", err.Error())
+		return
+	}
+	log.Infof("%s exported the subscriptions of %d consumers", commonName,
+		len(export.Consumers))
+}
+
+// GetConnectedClients implements https API
+func GetConnectedClients(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Get Connected Clients: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	if err := writeConnectedClients(w, eaaCtx); err != nil {
+		log.Errf("Get Connected Clients: %s", err.Error())
+		return
+	}
+
+	log.Debugf("Successfully processed GetConnectedClients from %s",
+		commonName)
+}
+
+// GetNamespaces implements https API
+func GetNamespaces(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	c := responseCodec(r)
+	w.Header().Set("Content-Type", c.contentType)
 
 	eaaCtx.serviceInfo.RLock()
 	if eaaCtx.serviceInfo.m == nil {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(http.StatusInternalServerError)
+		eaaCtx.serviceInfo.RUnlock()
+		log.Err("Get Namespaces: EAA context is not initialized")
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+	namespaces := countNamespaceServices(eaaCtx.serviceInfo.m)
+	eaaCtx.serviceInfo.RUnlock()
+
+	w.WriteHeader(http.StatusOK)
+	if err := c.encode(w, NamespaceList{Namespaces: namespaces}); err != nil {
+		log.Errf("Get Namespaces: %s", err.Error())
+		return
 	}
+
+	log.Debugf("Successfully processed GetNamespaces from %s", requesterName(r))
+}
+
+// GetNotifications implements https API
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+
+	eaaCtx.serviceInfo.RLock()
+	initialized := eaaCtx.serviceInfo.m != nil
 	eaaCtx.serviceInfo.RUnlock()
+	if !initialized {
+		log.Err("Get Notifications: EAA context is not initialized")
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+
+	var since uint64
+	replay := r.URL.Query().Get("since") != ""
+	if replay {
+		var err error
+		if since, err = strconv.ParseUint(r.URL.Query().Get("since"), 10, 64); err != nil {
+			log.Errf("Get Notifications: invalid sequence: %s", err.Error())
+			writeError(w, http.StatusBadRequest, reasonInvalidSequence)
+			return
+		}
+	}
 
-	statCode, err := createWsConn(w, r)
+	registered, statCode, err := createWsConn(w, r)
 	if err != nil {
 		log.Errf("Error in WebSocket Connection Creation: %#v", err)
+		if errors.Is(err, errUnsupportedSubprotocol) {
+			writeErrorDetail(w, statCode, reasonUnsupportedSubprotocol, err.Error())
+			return
+		}
+		if errors.Is(err, errInvalidConnectionFilter) {
+			writeErrorDetail(w, statCode, reasonInvalidQuery, err.Error())
+			return
+		}
+		if errors.Is(err, errConnectionLimit) {
+			writeErrorDetail(w, statCode, reasonConnectionLimit, err.Error())
+			return
+		}
 		if statCode != 0 {
 			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 			w.WriteHeader(statCode)
@@ -82,7 +384,9 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Subscribe to the Client topic to receive all of its subscriptions
+	// Subscribe to the Client topic to receive all of its subscriptions.
+	// The connection is upgraded already, so a failure closes the websocket
+	// instead of writing a status code.
 	topic := getClientTopicName(r.TLS.PeerCertificates[0].Subject.CommonName)
 	err = eaaCtx.MsgBrokerCtx.addSubscriber(clientSubscriber, topic, r)
 	if err != nil {
@@ -90,159 +394,732 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
 		if _, ok := err.(objectAlreadyExistsError); !ok {
 			log.Errf("Error when adding a Subscriber of type: '%v', topic: '%v'", clientSubscriber,
 				topic)
-			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-			w.WriteHeader(http.StatusInternalServerError)
+			removeConsumerConnection(r.TLS.PeerCertificates[0].Subject.CommonName,
+				registered, err, subscriberFailedCloseReason, eaaCtx)
 			return
 		}
 	}
 
+	// Replay notifications sent after the sequence number the consumer
+	// has seen last over the new connection, only the ones of the connection
+	// filter. Notifications sent meanwhile may be delivered twice.
+	if replay {
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		// The filter is validated by createWsConn already
+		filter, _ := parseConnectionFilter(r)
+		for _, payload := range eaaCtx.replayBuffers.since(commonName, since, filter) {
+			if err = writeNotification(registered, payload,
+				NotificationPriorityNormal, time.Time{}, eaaCtx); err != nil {
+				log.Warningf("Couldn't replay notification to %s: %v",
+					commonName, err)
+				break
+			}
+		}
+	}
+
 	log.Debugf("Successfully processed GetNotifications from %s",
 		r.TLS.PeerCertificates[0].Subject.CommonName)
 }
 
-// GetServices implements https API
-func GetServices(w http.ResponseWriter, r *http.Request) {
-	var servList ServiceList
+// GetNotificationsSSE implements https API. The notifications are streamed
+// as Server-Sent Events instead of by a websocket, a consumer resumes
+// the stream by the Last-Event-ID header.
+func GetNotificationsSSE(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
 	eaaCtx.serviceInfo.RLock()
-	defer eaaCtx.serviceInfo.RUnlock()
+	initialized := eaaCtx.serviceInfo.m != nil
+	eaaCtx.serviceInfo.RUnlock()
+	if !initialized {
+		log.Err("Get Notifications SSE: EAA context is not initialized")
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
 
-	if eaaCtx.serviceInfo.m == nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	since, replay, err := parseLastEventID(r)
+	if err != nil {
+		log.Errf("Get Notifications SSE: %s", err.Error())
+		writeError(w, http.StatusBadRequest, reasonInvalidSequence)
 		return
 	}
 
-	for _, serv := range eaaCtx.serviceInfo.m {
-		servList.Services = append(servList.Services, serv)
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		log.Errf("Get Notifications SSE: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Err("Get Notifications SSE: the response can't be streamed")
+		writeError(w, http.StatusInternalServerError, reasonStreamingUnsupported)
+		return
 	}
 
-	encoder := json.NewEncoder(w)
-	err := encoder.Encode(servList)
+	// The stream is started under the lock of the connection, so that
+	// no notification is written to it before
+	conn := newSSEConn(w, flusher)
+	conn.Lock()
+	registered, err := registerSSEConn(commonName, conn, filter, eaaCtx)
+	if err == nil {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+	}
+	conn.Unlock()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Errf("Get Notifications SSE: %s", err.Error())
+		writeErrorDetail(w, http.StatusTooManyRequests, reasonConnectionLimit, err.Error())
 		return
 	}
 
-	log.Debugf("Successfully processed GetServices from %s",
-		r.TLS.PeerCertificates[0].Subject.CommonName)
+	// Subscribe to the Client topic to receive all of its subscriptions.
+	// The stream is started already, so a failure ends it.
+	topic := getClientTopicName(commonName)
+	err = eaaCtx.MsgBrokerCtx.addSubscriber(clientSubscriber, topic, r)
+	if err != nil {
+		// Ignore objectAlreadyExistsError error
+		if _, ok := err.(objectAlreadyExistsError); !ok {
+			log.Errf("Error when adding a Subscriber of type: '%v', topic: '%v'", clientSubscriber,
+				topic)
+			removeConsumerConnection(commonName, registered, err,
+				subscriberFailedCloseReason, eaaCtx)
+			conn.Close()
+			return
+		}
+	}
+
+	// Replay notifications sent after the last event the consumer received
+	// over the new stream, only the ones of the connection filter.
+	// Notifications sent meanwhile may be delivered twice.
+	if replay {
+		for _, payload := range eaaCtx.replayBuffers.since(commonName, since, filter) {
+			if err = writeNotification(registered, payload,
+				NotificationPriorityNormal, time.Time{}, eaaCtx); err != nil {
+				log.Warningf("Couldn't replay notification to %s: %v",
+					commonName, err)
+				break
+			}
+		}
+	}
+
+	log.Debugf("Successfully processed GetNotificationsSSE from %s", commonName)
+	streamEvents(commonName, r, conn, registered, eaaCtx)
 }
 
-// GetSubscriptions implements https API
-func GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+// GetService implements https API
+func GetService(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
 
-	var (
-		subs       *SubscriptionList
-		commonName string
-		err        error
-	)
+	urn := urnFromVars(mux.Vars(r))
 
-	commonName = r.TLS.PeerCertificates[0].Subject.CommonName
+	eaaCtx.serviceInfo.RLock()
+	if eaaCtx.serviceInfo.m == nil {
+		eaaCtx.serviceInfo.RUnlock()
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+	serv, serviceFound := eaaCtx.serviceInfo.m[urn.String()]
+	eaaCtx.serviceInfo.RUnlock()
 
-	if subs, err = getConsumerSubscriptions(commonName, eaaCtx); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Errf("Consumer Subscription List Getter: %s",
-			err.Error())
+	if !serviceFound {
+		writeError(w, http.StatusNotFound, reasonServiceNotFound)
 		return
 	}
 
-	if err = json.NewEncoder(w).Encode(*subs); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Errf("Consumer Subscription List Getter: %s",
-			err.Error())
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(serv); err != nil {
+		log.Errf("Get Service: %s", err.Error())
 		return
 	}
 
-	log.Debugf("Successfully processed GetSubscriptions from %s", commonName)
+	log.Debugf("Successfully processed GetService from %s",
+		r.TLS.PeerCertificates[0].Subject.CommonName)
 }
 
-// PushNotificationToSubscribers implements https API
-func PushNotificationToSubscribers(w http.ResponseWriter, r *http.Request) {
+// GetServices implements https API
+func GetServices(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	var notif NotificationFromProducer
 
-	err := json.NewDecoder(r.Body).Decode(&notif)
+	query := r.URL.Query()
+	namespace := normalizeNamespace(query.Get("namespace"))
+	offset, limit, err := parsePagination(query)
 	if err != nil {
-		log.Errf("Error in Publish Notification: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Errf("Get Services: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
 		return
 	}
-
-	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
-	URN, err := CommonNameStringToURN(commonName)
+	selector, err := parseLabelSelector(query)
 	if err != nil {
-		log.Errf("Error during URN generation: %s", err.Error())
-		w.WriteHeader(http.StatusUnauthorized)
+		log.Errf("Get Services: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
 		return
 	}
+	healthyOnly, err := parseBool(query, "healthyOnly")
+	if err != nil {
+		log.Errf("Get Services: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+
+	c := responseCodec(r)
+	w.Header().Set("Content-Type", c.contentType)
 
-	// Check if a Service exists
 	eaaCtx.serviceInfo.RLock()
 	defer eaaCtx.serviceInfo.RUnlock()
 
-	_, serviceFound := eaaCtx.serviceInfo.m[commonName]
-	if !serviceFound {
-		log.Err("Producer is not registered")
-		w.WriteHeader(http.StatusInternalServerError)
+	if eaaCtx.serviceInfo.m == nil {
+		log.Err("Get Services: EAA context is not initialized")
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
 		return
 	}
 
-	notifTopic := getNotificationTopicName(URN.Namespace)
+	matches := func(serv Service) bool {
+		if namespace != "" && (serv.URN == nil || serv.URN.Namespace != namespace) {
+			return false
+		}
+		return labelsMatch(serv, selector)
+	}
 
-	// Add a Publisher to the Notification Namespace topic (if not subscribed already)
-	err = eaaCtx.MsgBrokerCtx.addPublisher(notificationPublisher, notifTopic, r)
-	if err != nil {
-		// Ignore objectAlreadyExistsError error
-		if _, ok := err.(objectAlreadyExistsError); !ok {
-			log.Errf("Error when adding a Publisher of type: '%v', id: '%v'. Error: %s",
-				notificationPublisher, notifTopic, err.Error())
+	// Without pagination the services are streamed from serviceInfo, so
+	// that large catalogs aren't copied to a ServiceList first. Pages are
+	// taken from the services ordered by URN, so that they don't overlap.
+	var page []Service
+	total := 0
+	paginated := query.Get("offset") != "" || query.Get("limit") != ""
+	for _, serv := range eaaCtx.serviceInfo.m {
+		if !matches(serv) {
+			continue
+		}
+		total++
+		if paginated {
+			page = append(page, serv)
 		}
 	}
+	if paginated {
+		sortServices(page)
+		start, end := pageBounds(total, offset, limit)
+		page = page[start:end]
+	}
 
-	// Prepare NotificationMessage that will be published using a Message Broker
-	notifMsg := NotificationMessage{Notification: &notif, URN: &URN}
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	w.WriteHeader(http.StatusOK)
 
-	// Create Watermill Message and publish it
-	data, err := json.Marshal(notifMsg)
-	if err != nil {
-		log.Errf("Error during Service structure marshaling: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	sw := newServiceWriter(w, c)
+	write := func(serv Service) error {
+		if healthyOnly {
+			serv = healthyEndpoints(serv)
+		}
+		return sw.write(serv)
+	}
+	if paginated {
+		for _, serv := range page {
+			if err = write(serv); err != nil {
+				break
+			}
+		}
+	} else {
+		for _, serv := range eaaCtx.serviceInfo.m {
+			if !matches(serv) {
+				continue
+			}
+			if err = write(serv); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = sw.close()
+	}
+	if err != nil {
+		log.Errf("Get Services: %s", err.Error())
+		return
 	}
-	msg := message.NewMessage(commonName, data)
 
-	err = eaaCtx.MsgBrokerCtx.publish(notifTopic, msg)
+	log.Debugf("Successfully processed GetServices from %s", requesterName(r))
+}
+
+// GetSubscribers implements https API
+func GetSubscribers(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	// Producers can only see the subscribers of their own service
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+	urn, err := CommonNameStringToURN(commonName)
 	if err != nil {
-		log.Errf("Error during Message publishing: %s", err.Error())
+		log.Errf("Subscribers Getter: %s", err.Error())
+		writeError(w, http.StatusUnauthorized, reasonInvalidURN)
+		return
+	}
+
+	subscribers, ok := getServiceSubscribers(commonName, eaaCtx)
+	if !ok {
+		log.Errf("Subscribers Getter: %s is not registered", commonName)
+		writeError(w, http.StatusNotFound, reasonServiceNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(ServiceSubscribers{URN: &urn,
+		Subscribers: subscribers}); err != nil {
+		log.Errf("Subscribers Getter: %s", err.Error())
+		return
+	}
+
+	log.Debugf("Successfully processed GetSubscribers from %s", commonName)
+}
+
+// GetSubscriptionMatches implements https API
+func GetSubscriptionMatches(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	matches, err := getSubscriptionMatches(commonName, eaaCtx)
+	if err != nil {
+		log.Errf("Subscription Matches Getter: %s", err.Error())
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(matches); err != nil {
+		log.Errf("Subscription Matches Getter: %s", err.Error())
+		return
+	}
+
+	log.Debugf("Successfully processed GetSubscriptionMatches from %s", commonName)
+}
+
+// GetSubscriptionStats implements https API. Admins get the statistics
+// of all consumers.
+func GetSubscriptionStats(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+	consumer := commonName
+	if isAdmin(commonName, eaaCtx) {
+		consumer = ""
+	}
+
+	w.WriteHeader(http.StatusOK)
+	stats := SubscriptionStatsList{Stats: eaaCtx.subscriptionStats.list(consumer)}
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Errf("Subscription Stats Getter: %s", err.Error())
+		return
+	}
+
+	log.Debugf("Successfully processed GetSubscriptionStats from %s", commonName)
+}
+
+// GetSubscriptions implements https API
+func GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	c := responseCodec(r)
+	w.Header().Set("Content-Type", c.contentType)
+
+	// A verbose list includes the status of every subscribed notification
+	query := r.URL.Query()
+	verbose, err := parseBool(query, "verbose")
+	if err != nil {
+		log.Errf("Consumer Subscription List Getter: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+
+	var (
+		subs       *SubscriptionList
+		commonName string
+	)
+
+	commonName = r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if subs, err = getConsumerSubscriptions(commonName, eaaCtx); err != nil {
+		log.Errf("Consumer Subscription List Getter: %s",
+			err.Error())
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// The list may be scoped to the subscriptions of a namespace or
+	// a service, filters matching nothing return an empty list
+	filterSubscriptions(subs, normalizeNamespace(query.Get("namespace")), query.Get("id"))
+	if verbose {
+		addSubscriptionStatus(subs, commonName, eaaCtx)
+	}
+
+	if err = c.encode(w, *subs); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Errf("Consumer Subscription List Getter: %s",
+			err.Error())
+		return
+	}
+
+	log.Debugf("Successfully processed GetSubscriptions from %s", commonName)
+}
+
+// ImportSubscriptions implements https API. It subscribes the consumers to
+// the subscriptions exported by another EAA, skipping the existing ones.
+func ImportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Import Subscriptions: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	var export SubscriptionExport
+	if err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&export); err != nil {
+		log.Errf("Import Subscriptions: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+
+	result := importSubscriptions(export, r, eaaCtx)
+	if len(result.Failed) == 0 {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errf("Import Subscriptions: failed to encode the result: %s", err.Error())
+		return
+	}
+	log.Infof("%s imported subscriptions: %d added, %d skipped, %d failed", commonName,
+		result.Added, result.Skipped, len(result.Failed))
+}
+
+// MatchNotification implements https API. It lists the consumers
+// a hypothetical notification would be delivered to, nothing is delivered.
+func MatchNotification(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Match Notification: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	var query NotificationMatchQuery
+	if err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&query); err != nil {
+		log.Errf("Match Notification: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+
+	if err := validateServiceURNVars(query.URN); err != nil {
+		log.Errf("Match Notification: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidURN, err.Error())
+		return
+	}
+	if err := validateSubscriptionNotifications([]NotificationDescriptor{
+		{Name: query.Name, Version: query.Version}}); err != nil {
+		log.Errf("Match Notification: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidNotification,
+			err.Error())
+		return
+	}
+
+	// Notifications of unregistered producers aren't delivered
+	eaaCtx.serviceInfo.RLock()
+	serviceFound := isServicePresent(query.URN.String(), eaaCtx)
+	eaaCtx.serviceInfo.RUnlock()
+	if !serviceFound {
+		log.Errf("Match Notification: producer '%s' is not registered",
+			query.URN.String())
+		writeError(w, http.StatusNotFound, reasonServiceNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(matchNotification(query, eaaCtx)); err != nil {
+		log.Errf("Match Notification: failed to encode the result: %s", err.Error())
+	}
+	log.Debugf("Successfully processed MatchNotification from %s", commonName)
+}
+
+// PreviewSubscriptions implements https API. It returns the subscriptions
+// of the consumer after a change of them, which isn't applied. A change
+// the subscribe handlers would reject gets their status code.
+func PreviewSubscriptions(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	var change SubscriptionChange
+	if err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&change); err != nil {
+		log.Errf("Preview Subscriptions: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+
+	subs, rejected, err := previewSubscriptions(commonName, change, eaaCtx)
+	if err != nil {
+		log.Errf("Preview Subscriptions: %s", err.Error())
+		writeError(w, http.StatusInternalServerError, reasonNotInitialized)
+		return
+	}
+	if rejected != nil {
+		log.Errf("Preview Subscriptions: change of %s rejected: %s %s", commonName,
+			rejected.Error, rejected.Detail)
+		writeErrorDetail(w, rejected.Code, rejected.Error, rejected.Detail)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(*subs); err != nil {
+		log.Errf("Preview Subscriptions: failed to encode the result: %s", err.Error())
+		return
+	}
+	log.Debugf("Successfully processed PreviewSubscriptions from %s", commonName)
+}
+
+// PushNotificationToSubscribers implements https API
+func PushNotificationToSubscribers(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	respCodec := responseCodec(r)
+	w.Header().Set("Content-Type", respCodec.contentType)
+	correlationID := getCorrelationID(r)
+	w.Header().Set(correlationIDHeader, correlationID)
+	var notif NotificationFromProducer
+
+	if isShuttingDown(eaaCtx) {
+		log.Errf("Error in Publish Notification: EAA is shutting down")
+		writeError(w, http.StatusServiceUnavailable, reasonShuttingDown)
 		return
 	}
 
+	reqCodec, err := requestCodec(r)
+	if err != nil {
+		log.Errf("Error in Publish Notification: %s", err.Error())
+		writeRequestCodecError(w, err)
+		return
+	}
+	if err = reqCodec.decode(w, r, eaaCtx, &notif); err != nil {
+		log.Errf("Error in Publish Notification: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+	URN, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		log.Errf("Error during URN generation: %s", err.Error())
+		writeError(w, http.StatusUnauthorized, reasonInvalidURN)
+		return
+	}
+
+	if code, reason, err := checkPushedNotification(URN, &notif, eaaCtx); err != nil {
+		log.Errf("Error in Publish Notification: %s", err.Error())
+		writeErrorDetail(w, code, reason, err.Error())
+		return
+	}
+	if code, reason, err := checkProducerPush(commonName, URN,
+		w.Header().Get(requestIDHeader), eaaCtx); err != nil {
+		log.Errf("Error in Publish Notification: %s", err.Error())
+		writeErrorDetail(w, code, reason, err.Error())
+		return
+	}
+	if err = eaaCtx.notifSchemas.validate(notificationKey(URN, &notif),
+		notif.Payload); err != nil {
+		log.Errf("Error in Publish Notification: invalid payload of %v: %s",
+			notificationKey(URN, &notif), err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidPayload, err.Error())
+		return
+	}
+
+	allowed, retryAfter := eaaCtx.notifLimiter.allow(commonName,
+		eaaCtx.config().NotificationRateLimit, eaaCtx.config().NotificationBurst,
+		time.Now())
+	if !allowed {
+		log.Errf("Producer %s exceeded the notification rate limit", commonName)
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, reasonRateLimitExceeded)
+		return
+	}
+	if allowed, retryAfter = allowNodeNotification(eaaCtx, time.Now()); !allowed {
+		log.Errf("Notification of %s rejected by the node notification limit", commonName)
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(w, http.StatusServiceUnavailable, reasonNodeRateLimitExceeded)
+		return
+	}
+
+	// Wait for the delivery summary only if there is anyone to deliver to
+	var deliveryID string
+	var reportCh <-chan DeliverySummary
+	if hasNotificationSubscribers(URN, &notif, eaaCtx) {
+		deliveryID, reportCh = eaaCtx.deliveryReports.expect()
+	}
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err = publishNotification(ctx, URN, &notif, deliveryID, correlationID, eaaCtx)
+	if err != nil {
+		eaaCtx.deliveryReports.cancel(deliveryID)
+		log.Errf("Error in Publish Notification %s: %s", correlationID, err.Error())
+		writePublishError(w, reasonBrokerPublishFailed, err)
+		return
+	}
+
+	var summary DeliverySummary
+	if deliveryID != "" {
+		summary = eaaCtx.deliveryReports.wait(deliveryID, reportCh,
+			deliveryReportTimeout(eaaCtx))
+	}
+
 	w.WriteHeader(http.StatusAccepted)
-	log.Debugf("Successfully processed PushNotificationToSubscribers from %s",
-		commonName)
+	if err = respCodec.encode(w, summary); err != nil {
+		log.Errf("Push Notification: failed to encode the delivery summary: %s",
+			err.Error())
+	}
+	log.Debugf("Successfully processed PushNotificationToSubscribers %s from %s",
+		correlationID, commonName)
+}
+
+// PushNotificationsBulk implements https API.
+//
+// The notifications are published in the order of the request, so that
+// every consumer receives them in this order. Each of them is checked,
+// rate limited and published on its own, a failure of one of them doesn't
+// affect the others. The request body limit applies to the whole batch.
+func PushNotificationsBulk(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	correlationID := getCorrelationID(r)
+	w.Header().Set(correlationIDHeader, correlationID)
+	var notifs []NotificationFromProducer
+
+	if isShuttingDown(eaaCtx) {
+		log.Errf("Bulk Publish Notification: EAA is shutting down")
+		writeError(w, http.StatusServiceUnavailable, reasonShuttingDown)
+		return
+	}
+
+	err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&notifs)
+	if err != nil {
+		log.Errf("Bulk Publish Notification: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+	if len(notifs) > maxBulkNotifications {
+		log.Errf("Bulk Publish Notification: %d notifications", len(notifs))
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidNotification,
+			fmt.Sprintf("more than %d notifications in a request", maxBulkNotifications))
+		return
+	}
+
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+	URN, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		log.Errf("Error during URN generation: %s", err.Error())
+		writeError(w, http.StatusUnauthorized, reasonInvalidURN)
+		return
+	}
+	if code, reason, err := checkProducerPush(commonName, URN,
+		w.Header().Get(requestIDHeader), eaaCtx); err != nil {
+		log.Errf("Bulk Publish Notification: %s", err.Error())
+		writeErrorDetail(w, code, reason, err.Error())
+		return
+	}
+
+	results := NotificationResultList{Results: make([]NotificationResult, len(notifs))}
+	deliveryIDs := make([]string, len(notifs))
+	reportChs := make([]<-chan DeliverySummary, len(notifs))
+	var retryAfter time.Duration
+	for i := range notifs {
+		result := &results.Results[i]
+		result.CorrelationID = fmt.Sprintf("%s-%d", correlationID, i)
+		var wait time.Duration
+		deliveryIDs[i], reportChs[i], wait = processBulkNotification(commonName, URN,
+			&notifs[i], result, r, eaaCtx)
+		if wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	// The summaries are awaited once all the notifications are published,
+	// all of them within a single timeout
+	deadline := time.Now().Add(deliveryReportTimeout(eaaCtx))
+	allSucceeded := true
+	for i := range results.Results {
+		result := &results.Results[i]
+		if result.Code != http.StatusAccepted {
+			allSucceeded = false
+			continue
+		}
+		summary := DeliverySummary{}
+		if deliveryIDs[i] != "" {
+			summary = eaaCtx.deliveryReports.wait(deliveryIDs[i], reportChs[i],
+				time.Until(deadline))
+		}
+		result.Summary = &summary
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	if allSucceeded {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	if err = json.NewEncoder(w).Encode(results); err != nil {
+		log.Errf("Bulk Publish Notification: failed to encode the results: %s",
+			err.Error())
+	}
+	log.Debugf("Successfully processed PushNotificationsBulk %s of %d notifications from %s",
+		correlationID, len(notifs), commonName)
 }
 
 // RegisterApplication implements https API
 func RegisterApplication(w http.ResponseWriter, r *http.Request) {
 	var serv Service
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	respCodec := responseCodec(r)
+	w.Header().Set("Content-Type", respCodec.contentType)
 
 	clientCert := r.TLS.PeerCertificates[0]
 	commonName := clientCert.Subject.CommonName
 
-	err := json.NewDecoder(r.Body).Decode(&serv)
+	if isShuttingDown(eaaCtx) {
+		log.Errf("Register Application: EAA is shutting down, %s rejected", commonName)
+		writeError(w, http.StatusServiceUnavailable, reasonShuttingDown)
+		return
+	}
+
+	// A dry run validates the registration without applying it
+	dryRun, err := parseBool(r.URL.Query(), "dryRun")
 	if err != nil {
 		log.Errf("Register Application: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+
+	reqCodec, err := requestCodec(r)
+	if err != nil {
+		log.Errf("Register Application: %s", err.Error())
+		writeRequestCodecError(w, err)
+		return
+	}
+	if err = reqCodec.decode(w, r, eaaCtx, &serv); err != nil {
+		log.Errf("Register Application: %s", err.Error())
+		writeRequestBodyError(w, err)
 		return
 	}
 
@@ -250,33 +1127,234 @@ func RegisterApplication(w http.ResponseWriter, r *http.Request) {
 	var URN URN
 	if URN, err = CommonNameStringToURN(commonName); err != nil {
 		log.Errf("Error during URN generation: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, reasonInvalidURN)
+		return
+	}
+	if !urnMatches(serv.URN, URN) {
+		log.Errf("Register Application: URN %v does not match the URN"+
+			" of %s", *serv.URN, commonName)
+		writeError(w, http.StatusBadRequest, reasonURNMismatch)
 		return
 	}
 	serv.URN = &URN
 
+	if err = validateService(&serv); err != nil {
+		log.Errf("Register Application: %s", err.Error())
+		writeError(w, http.StatusBadRequest, reasonInvalidService)
+		return
+	}
+	defaultEndpointHealth(serv.Endpoints)
+
+	// The producer which registered a live service first keeps it with
+	// exclusive registration
+	owner := certificateFingerprint(clientCert)
+	eaaCtx.serviceInfo.RLock()
+	err = checkRegistrationOwner(URN.String(), owner, eaaCtx)
+	eaaCtx.serviceInfo.RUnlock()
+	if err != nil {
+		log.Errf("Register Application: %s", err.Error())
+		writeError(w, http.StatusConflict, reasonDuplicateURN)
+		return
+	}
+
+	action, err := registrationAction(URN.String(), serv, eaaCtx)
+	if err != nil {
+		log.Errf("Register Application: %s", err.Error())
+		writeError(w, http.StatusInternalServerError, reasonMarshalingFailed)
+		return
+	}
+	if dryRun {
+		w.WriteHeader(http.StatusOK)
+		if err = respCodec.encode(w, RegistrationDryRun{DryRun: true, URN: &URN,
+			Action: action}); err != nil {
+			log.Errf("Register Application: failed to encode the dry run result: %s",
+				err.Error())
+		}
+		log.Debugf("Successfully validated the registration of %s", commonName)
+		return
+	}
+	if action == "" {
+		// Already registered with identical content, the producer renews
+		// the service to refresh its TTL
+		w.WriteHeader(http.StatusOK)
+		log.Debugf("Service %s is already registered, nothing to update",
+			commonName)
+		return
+	}
+
 	// Prepare ServiceMessage that will be published using a Message Broker
-	svcMsg := ServiceMessage{Svc: &serv, Action: serviceActionRegister}
+	svcMsg := ServiceMessage{Svc: &serv, Action: action, Owner: owner}
+
+	// Create Watermill Message and publish it
+	data, err := json.Marshal(svcMsg)
+	if err != nil {
+		log.Errf("Error during Service structure marshaling: %s", err.Error())
+		writeError(w, http.StatusInternalServerError, reasonMarshalingFailed)
+		return
+	}
+	msg := message.NewMessage(commonName, data)
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err = publishWithRetry(ctx, servicesTopic, msg, eaaCtx)
+	if err != nil {
+		log.Errf("Error during Message publishing: %s", err.Error())
+		writePublishError(w, reasonBrokerPublishFailed, err)
+		return
+	}
+
+	if action == serviceActionRegister {
+		registrationsTotal.Inc()
+	}
+	w.WriteHeader(http.StatusOK)
+	log.Debugf("Successfully processed RegisterApplication from %s",
+		commonName)
+}
+
+// RegisterNotificationSchema implements https API
+func RegisterNotificationSchema(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Register Notification Schema: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	var schema NotificationSchema
+	if err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&schema); err != nil {
+		log.Errf("Register Notification Schema: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+
+	// Schemas are kept by this EAA instance only, like the config ones
+	if err := eaaCtx.notifSchemas.set(schema); err != nil {
+		log.Errf("Register Notification Schema: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidSchema, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Debugf("Successfully processed RegisterNotificationSchema from %s",
+		commonName)
+}
+
+// ReloadConfig implements https API
+func ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	if !isAdmin(commonName, eaaCtx) {
+		log.Errf("Reload Config: %s is not an admin", commonName)
+		writeError(w, http.StatusForbidden, reasonAdminAccessDenied)
+		return
+	}
+
+	restartRequired, err := reloadConfig(eaaCtx)
+	if err != nil {
+		log.Errf("Reload Config: %s", err.Error())
+		writeErrorDetail(w, http.StatusInternalServerError, reasonConfigReloadFailed,
+			err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(ConfigReload{
+		RestartRequired: restartRequired}); err != nil {
+		log.Errf("Reload Config: failed to encode the result: %s", err.Error())
+	}
+	log.Debugf("Successfully processed ReloadConfig from %s", commonName)
+}
+
+// RenewApplication implements https API
+func RenewApplication(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	clientCert := r.TLS.PeerCertificates[0]
+	commonName := clientCert.Subject.CommonName
+	owner := certificateFingerprint(clientCert)
+
+	eaaCtx.serviceInfo.RLock()
+	serv, serviceFound := eaaCtx.serviceInfo.m[serviceKey(commonName)]
+	err := checkRegistrationOwner(serviceKey(commonName), owner, eaaCtx)
+	eaaCtx.serviceInfo.RUnlock()
+
+	if !serviceFound {
+		log.Errf("Renew Application: service '%s' is not registered", commonName)
+		writeError(w, http.StatusNotFound, reasonServiceNotFound)
+		return
+	}
+	if err != nil {
+		log.Errf("Renew Application: %s", err.Error())
+		writeError(w, http.StatusConflict, reasonDuplicateURN)
+		return
+	}
+
+	// The renewal may update the health status of the endpoints
+	var update EndpointHealthUpdate
+	err = json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&update)
+	if err != nil && err != io.EOF {
+		log.Errf("Renew Application: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+	if len(update.Endpoints) > 0 {
+		if serv.Endpoints, err = updateEndpointHealth(serv.Endpoints,
+			update.Endpoints); err != nil {
+			log.Errf("Renew Application: %s", err.Error())
+			writeErrorDetail(w, http.StatusBadRequest, reasonInvalidService, err.Error())
+			return
+		}
+	}
+
+	// The registered Service is published again so that every EAA instance
+	// refreshes its TTL
+	svcMsg := ServiceMessage{Svc: &serv, Action: serviceActionRegister, Owner: owner}
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err = publishServiceMessage(ctx, commonName, svcMsg, eaaCtx)
+	if err != nil {
+		log.Errf("Renew Application: %s", err.Error())
+		writePublishError(w, reasonBrokerPublishFailed, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Debugf("Successfully processed RenewApplication from %s",
+		commonName)
+}
+
+// RenewSubscriptions implements https API
+func RenewSubscriptions(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
-	// Create Watermill Message and publish it
-	data, err := json.Marshal(svcMsg)
-	if err != nil {
-		log.Errf("Error during Service structure marshaling: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+	if !eaaCtx.subscriptionLeases.renew(commonName, time.Now()) {
+		log.Errf("Renew Subscriptions: subscriptions of '%s' have no lease", commonName)
+		writeError(w, http.StatusNotFound, reasonLeaseNotFound)
 		return
 	}
-	msg := message.NewMessage(commonName, data)
 
-	err = eaaCtx.MsgBrokerCtx.publish(servicesTopic, msg)
+	// The renewal is published so that every EAA instance extends the lease
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err := publishSubscriptionLease(ctx, leaseKey{commonName: commonName},
+		subscriptionActionRenew, eaaCtx)
 	if err != nil {
-		log.Errf("Error during Message publishing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Errf("Renew Subscriptions: %s", err.Error())
+		writePublishError(w, reasonBrokerPublishFailed, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	log.Debugf("Successfully processed RegisterApplication from %s",
-		commonName)
+	w.WriteHeader(http.StatusNoContent)
+	log.Debugf("Successfully processed RenewSubscriptions from %s", commonName)
 }
 
 // SubscribeNamespaceNotifications implements https API
@@ -286,25 +1364,67 @@ func SubscribeNamespaceNotifications(w http.ResponseWriter, r *http.Request) {
 
 	var sub []NotificationDescriptor
 
-	err := json.NewDecoder(r.Body).Decode(&sub)
+	c, err := requestCodec(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Errf("Namespace Notification Registration: %s",
-			err.Error())
+		writeRequestCodecError(w, err)
+		log.Errf("Namespace Notification Registration: %s", err.Error())
+		return
+	}
+	if err = c.decode(w, r, eaaCtx, &sub); err != nil {
+		writeRequestBodyError(w, err)
+		log.Errf("Namespace Notification Registration: %s", err.Error())
 		return
 	}
 
 	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
-	// Get the Notification Namespace
-	namespace := mux.Vars(r)["urn.namespace"]
-	urn := URN{Namespace: namespace}
+	// The lease of the subscriptions in seconds, 0 applies the default
+	lease, err := parseNonNegativeInt(r.URL.Query(), "lease")
+	if err != nil {
+		log.Errf("Namespace Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+	mode, webhookURL, err := parseDelivery(r.URL.Query(), eaaCtx)
+	if err != nil {
+		log.Errf("Namespace Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidDelivery, err.Error())
+		return
+	}
 
-	err = processSubscriptionRequest(subscriptionActionSubscribe, subscriptionScopeNamespace,
-		commonName, &urn, sub, r, eaaCtx)
+	// Get the Notification Namespace, it may be a glob pattern
+	urn := urnFromVars(mux.Vars(r))
+	namespace := urn.Namespace
+
+	rejected := validateSubscription(commonName, subscriptionScopeNamespace, urn, sub,
+		eaaCtx)
+	if rejected != nil {
+		log.Errf("Namespace Notification Registration: %s: %s", rejected.Error,
+			rejected.Detail)
+		writeErrorDetail(w, rejected.Code, rejected.Error, rejected.Detail)
+		return
+	}
+
+	if err = checkSubscriptionLimit(commonName, namespace, "", sub, eaaCtx); err != nil {
+		log.Errf("Namespace Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusForbidden, reasonSubscriptionLimit, err.Error())
+		return
+	}
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err = processSubscriptionRequest(ctx, subscriptionActionSubscribe, subscriptionScopeNamespace,
+		commonName, &urn, sub, lease, r, eaaCtx)
 	if err != nil {
 		log.Errf("Error during Namespace Subscription Request processing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writePublishError(w, reasonSubscriptionFailed, err)
+		return
+	}
+
+	if err = setDelivery(commonName, mode, webhookURL, eaaCtx); err != nil {
+		log.Errf("Namespace Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusInternalServerError, reasonDeliveryFailed,
+			err.Error())
 		return
 	}
 
@@ -320,26 +1440,66 @@ func SubscribeServiceNotifications(w http.ResponseWriter, r *http.Request) {
 
 	var sub []NotificationDescriptor
 
-	err := json.NewDecoder(r.Body).Decode(&sub)
+	c, err := requestCodec(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestCodecError(w, err)
+		log.Errf("Service Notification Registration: %s", err.Error())
+		return
+	}
+	if err = c.decode(w, r, eaaCtx, &sub); err != nil {
+		writeRequestBodyError(w, err)
 		log.Errf("Service Notification Registration: %s", err.Error())
 		return
 	}
 
 	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
+	// The lease of the subscriptions in seconds, 0 applies the default
+	lease, err := parseNonNegativeInt(r.URL.Query(), "lease")
+	if err != nil {
+		log.Errf("Service Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+	mode, webhookURL, err := parseDelivery(r.URL.Query(), eaaCtx)
+	if err != nil {
+		log.Errf("Service Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidDelivery, err.Error())
+		return
+	}
+
 	// Get the Notification Namespace and Service ID
-	vars := mux.Vars(r)
-	namespace := vars["urn.namespace"]
-	serviceID := vars["urn.id"]
-	urn := URN{Namespace: namespace, ID: serviceID}
+	urn := urnFromVars(mux.Vars(r))
+
+	rejected := validateSubscription(commonName, subscriptionScopeService, urn, sub,
+		eaaCtx)
+	if rejected != nil {
+		log.Errf("Service Notification Registration: %s: %s", rejected.Error,
+			rejected.Detail)
+		writeErrorDetail(w, rejected.Code, rejected.Error, rejected.Detail)
+		return
+	}
+
+	if err = checkSubscriptionLimit(commonName, urn.Namespace, urn.ID, sub, eaaCtx); err != nil {
+		log.Errf("Service Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusForbidden, reasonSubscriptionLimit, err.Error())
+		return
+	}
 
-	err = processSubscriptionRequest(subscriptionActionSubscribe, subscriptionScopeService,
-		commonName, &urn, sub, r, eaaCtx)
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err = processSubscriptionRequest(ctx, subscriptionActionSubscribe, subscriptionScopeService,
+		commonName, &urn, sub, lease, r, eaaCtx)
 	if err != nil {
 		log.Errf("Error during Service Subscription Request processing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writePublishError(w, reasonSubscriptionFailed, err)
+		return
+	}
+
+	if err = setDelivery(commonName, mode, webhookURL, eaaCtx); err != nil {
+		log.Errf("Service Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusInternalServerError, reasonDeliveryFailed,
+			err.Error())
 		return
 	}
 
@@ -348,6 +1508,74 @@ func SubscribeServiceNotifications(w http.ResponseWriter, r *http.Request) {
 		commonName)
 }
 
+// SubscribeServiceNotificationsBulk implements https API
+func SubscribeServiceNotificationsBulk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+
+	var subList SubscriptionList
+
+	err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&subList)
+	if err != nil {
+		writeRequestBodyError(w, err)
+		log.Errf("Bulk Service Notification Registration: %s", err.Error())
+		return
+	}
+
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+
+	// The lease of the subscriptions in seconds, 0 applies the default
+	lease, err := parseNonNegativeInt(r.URL.Query(), "lease")
+	if err != nil {
+		log.Errf("Bulk Service Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidQuery, err.Error())
+		return
+	}
+	mode, webhookURL, err := parseDelivery(r.URL.Query(), eaaCtx)
+	if err != nil {
+		log.Errf("Bulk Service Notification Registration: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidDelivery, err.Error())
+		return
+	}
+
+	// Every subscription is processed on its own, a failure of one of them
+	// doesn't affect the others
+	results := SubscriptionResultList{Results: []SubscriptionResult{}}
+	allSucceeded := true
+	succeeded := 0
+	for _, sub := range subList.Subscriptions {
+		result := processBulkSubscription(commonName, sub, lease, r, eaaCtx)
+		if result.Code != http.StatusCreated {
+			allSucceeded = false
+		} else {
+			succeeded++
+		}
+		results.Results = append(results.Results, result)
+	}
+
+	if succeeded > 0 {
+		if err = setDelivery(commonName, mode, webhookURL, eaaCtx); err != nil {
+			log.Errf("Bulk Service Notification Registration: %s", err.Error())
+			writeErrorDetail(w, http.StatusInternalServerError, reasonDeliveryFailed,
+				err.Error())
+			return
+		}
+	}
+
+	if allSucceeded {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	if err = json.NewEncoder(w).Encode(results); err != nil {
+		log.Errf("Bulk Service Notification Registration: %s", err.Error())
+		return
+	}
+
+	log.Debugf("Successfully processed SubscribeServiceNotificationsBulk from %s",
+		commonName)
+}
+
 // UnsubscribeAllNotifications implements https API
 func UnsubscribeAllNotifications(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -355,11 +1583,13 @@ func UnsubscribeAllNotifications(w http.ResponseWriter, r *http.Request) {
 
 	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
-	err := processSubscriptionRequest(subscriptionActionUnsubscribe, subscriptionScopeAll,
-		commonName, nil, nil, r, eaaCtx)
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err := processSubscriptionRequest(ctx, subscriptionActionUnsubscribe, subscriptionScopeAll,
+		commonName, nil, nil, 0, r, eaaCtx)
 	if err != nil {
 		log.Errf("Error during All Unsubscription Request processing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writePublishError(w, reasonSubscriptionFailed, err)
 		return
 	}
 
@@ -374,9 +1604,9 @@ func UnsubscribeNamespaceNotifications(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
 	var sub []NotificationDescriptor
 
-	err := json.NewDecoder(r.Body).Decode(&sub)
+	err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&sub)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestBodyError(w, err)
 		log.Errf("Namespace Notification Unregistration: %s",
 			err.Error())
 		return
@@ -385,18 +1615,26 @@ func UnsubscribeNamespaceNotifications(w http.ResponseWriter, r *http.Request) {
 	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
 	// Get the Notification Namespace
-	namespace := mux.Vars(r)["urn.namespace"]
-	urn := URN{Namespace: namespace}
+	urn := urnFromVars(mux.Vars(r))
 
-	err = processSubscriptionRequest(subscriptionActionUnsubscribe, subscriptionScopeNamespace,
-		commonName, &urn, sub, r, eaaCtx)
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	// The subscriptions are removed asynchronously, the result is based
+	// on the subscriptions known before publishing the request
+	result := getUnsubscriptionResult(commonName, urn, sub, eaaCtx)
+
+	err = processSubscriptionRequest(ctx, subscriptionActionUnsubscribe, subscriptionScopeNamespace,
+		commonName, &urn, sub, 0, r, eaaCtx)
 	if err != nil {
 		log.Errf("Error during Namespace Unsubscription Request processing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writePublishError(w, reasonSubscriptionFailed, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Errf("Namespace Unsubscription: failed to encode the result: %s", err.Error())
+	}
 	log.Debugf("Successfully processed UnsubscribeNamespaceNotifications from"+
 		"%s", commonName)
 }
@@ -407,9 +1645,9 @@ func UnsubscribeServiceNotifications(w http.ResponseWriter, r *http.Request) {
 	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
 	var sub []NotificationDescriptor
 
-	err := json.NewDecoder(r.Body).Decode(&sub)
+	err := json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&sub)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestBodyError(w, err)
 		log.Errf("Service Notification Unregistration: %s", err.Error())
 		return
 	}
@@ -417,31 +1655,108 @@ func UnsubscribeServiceNotifications(w http.ResponseWriter, r *http.Request) {
 	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
 
 	// Get the Notification Namespace and Service ID
-	vars := mux.Vars(r)
-	namespace := vars["urn.namespace"]
-	serviceID := vars["urn.id"]
-	urn := URN{Namespace: namespace, ID: serviceID}
+	urn := urnFromVars(mux.Vars(r))
 
-	err = processSubscriptionRequest(subscriptionActionUnsubscribe, subscriptionScopeService,
-		commonName, &urn, sub, r, eaaCtx)
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	// The subscriptions are removed asynchronously, the result is based
+	// on the subscriptions known before publishing the request
+	result := getUnsubscriptionResult(commonName, urn, sub, eaaCtx)
+
+	err = processSubscriptionRequest(ctx, subscriptionActionUnsubscribe, subscriptionScopeService,
+		commonName, &urn, sub, 0, r, eaaCtx)
 	if err != nil {
 		log.Errf("Error during Service Unsubscription Request processing: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writePublishError(w, reasonSubscriptionFailed, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Errf("Service Unsubscription: failed to encode the result: %s", err.Error())
+	}
 	log.Debugf("Successfully processed UnsubscribeServiceNotifications from %s",
 		commonName)
 }
 
+// UpdateApplication implements https API
+func UpdateApplication(w http.ResponseWriter, r *http.Request) {
+	eaaCtx := r.Context().Value(contextKey("appliance-ctx")).(*Context)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	clientCert := r.TLS.PeerCertificates[0]
+	commonName := clientCert.Subject.CommonName
+	URN, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		log.Errf("Update Application: %s", err.Error())
+		writeError(w, http.StatusBadRequest, reasonInvalidURN)
+		return
+	}
+
+	var update ServiceUpdate
+	if err = json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(&update); err != nil {
+		log.Errf("Update Application: %s", err.Error())
+		writeRequestBodyError(w, err)
+		return
+	}
+	if update.Endpoints != nil {
+		defaultEndpointHealth(*update.Endpoints)
+	}
+
+	// Updates of the service are validated and published one at a time
+	unlock := eaaCtx.serviceUpdates.lock(URN.String())
+	defer unlock()
+
+	owner := certificateFingerprint(clientCert)
+	eaaCtx.serviceInfo.RLock()
+	serv, serviceFound := eaaCtx.serviceInfo.m[URN.String()]
+	err = checkRegistrationOwner(URN.String(), owner, eaaCtx)
+	eaaCtx.serviceInfo.RUnlock()
+	if !serviceFound {
+		log.Errf("Update Application: service '%s' is not registered", commonName)
+		writeError(w, http.StatusNotFound, reasonServiceNotFound)
+		return
+	}
+	if err != nil {
+		log.Errf("Update Application: %s", err.Error())
+		writeError(w, http.StatusConflict, reasonDuplicateURN)
+		return
+	}
+
+	updated := applyServiceUpdate(serv, update)
+	if err = validateService(&updated); err != nil {
+		log.Errf("Update Application: %s", err.Error())
+		writeErrorDetail(w, http.StatusBadRequest, reasonInvalidService, err.Error())
+		return
+	}
+
+	// Only the update is published, the services subscriber merges it into
+	// the service it has registered
+	svcMsg := ServiceMessage{Svc: &Service{URN: &URN}, Action: serviceActionUpdate,
+		Update: &update, Owner: owner}
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	if err = publishServiceMessage(ctx, commonName, svcMsg, eaaCtx); err != nil {
+		log.Errf("Update Application: %s", err.Error())
+		writePublishError(w, reasonBrokerPublishFailed, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(updated); err != nil {
+		log.Errf("Update Application: failed to encode the service: %s", err.Error())
+	}
+	log.Debugf("Successfully processed UpdateApplication from %s", commonName)
+}
+
 // processSubscriptionRequest adds Publisher and Subscriber to the Client topic and publishes the
 // SubscriptionMessage to it.
 // If subscriptionAction == subscriptionActionRegister it also subscribes to the
 // Namespace Notification topic.
-func processSubscriptionRequest(subscriptionAction string, subscriptionScope string,
-	clientCommonName string, URN *URN, subs []NotificationDescriptor, r *http.Request,
-	eaaCtx *Context) error {
+func processSubscriptionRequest(ctx context.Context, subscriptionAction string,
+	subscriptionScope string, clientCommonName string, URN *URN,
+	subs []NotificationDescriptor, lease int, r *http.Request, eaaCtx *Context) error {
 
 	// Subscribe to the Client topic (if not subscribed already) to receive all of its subscriptions
 	clientTopic := getClientTopicName(clientCommonName)
@@ -459,14 +1774,18 @@ func processSubscriptionRequest(subscriptionAction string, subscriptionScope str
 		if URN == nil {
 			return errors.New("URN can't be nil when trying to Subscribe")
 		}
-		notifTopic := getNotificationTopicName(URN.Namespace)
 
-		err = eaaCtx.MsgBrokerCtx.addSubscriber(notificationSubscriber, notifTopic, r)
-		if err != nil {
-			// Ignore objectAlreadyExistsError error
-			if _, ok := err.(objectAlreadyExistsError); !ok {
-				return errors.Wrapf(err, "Error when subscribing to Notification topic '%v'",
-					notifTopic)
+		// A namespace pattern has no topic of its own - subscribe to the topics of all
+		// matching namespaces instead. Namespaces of producers registered later are
+		// subscribed in handleServiceUpdates().
+		namespaces := []string{URN.Namespace}
+		if isNamespacePattern(URN.Namespace) {
+			namespaces = getMatchingNamespaces(URN.Namespace, eaaCtx)
+		}
+
+		for _, namespace := range namespaces {
+			if err = addNotificationSubscriber(namespace, r, eaaCtx); err != nil {
+				return err
 			}
 		}
 	}
@@ -482,9 +1801,9 @@ func processSubscriptionRequest(subscriptionAction string, subscriptionScope str
 	}
 
 	// Prepare the message that will be published to the Client topic
-	subscription := Subscription{URN, subs}
+	subscription := Subscription{URN: URN, Notifications: subs}
 	subscriptionMsg := SubscriptionMessage{clientCommonName, &subscription, subscriptionAction,
-		subscriptionScope}
+		subscriptionScope, lease}
 
 	// Create and publish the Watermill Message
 	data, err := json.Marshal(subscriptionMsg)
@@ -493,10 +1812,304 @@ func processSubscriptionRequest(subscriptionAction string, subscriptionScope str
 	}
 	msg := message.NewMessage(clientCommonName, data)
 
-	err = eaaCtx.MsgBrokerCtx.publish(clientTopic, msg)
+	err = publishMessage(ctx, clientTopic, msg, eaaCtx)
+	if err != nil {
+		return errors.Wrap(err, "Error during Message publishing")
+	}
+
+	return nil
+}
+
+// processBulkSubscription validates and processes a single service
+// subscription of a bulk subscription request
+func processBulkSubscription(commonName string, sub Subscription, lease int,
+	r *http.Request, eaaCtx *Context) SubscriptionResult {
+
+	result := SubscriptionResult{URN: sub.URN, Code: http.StatusCreated}
+
+	if sub.URN == nil {
+		result.Code = http.StatusBadRequest
+		result.Error = reasonInvalidURN
+		result.Detail = "service subscription requires a namespace and an ID"
+		return result
+	}
+	sub.URN = &URN{Namespace: normalizeNamespace(sub.URN.Namespace), ID: sub.URN.ID}
+	result.URN = sub.URN
+	if err := validateServiceURNVars(*sub.URN); err != nil {
+		result.Code = http.StatusBadRequest
+		result.Error = reasonInvalidURN
+		result.Detail = err.Error()
+		return result
+	}
+
+	if err := validateSubscriptionNotifications(sub.Notifications); err != nil {
+		result.Code = http.StatusBadRequest
+		result.Error = reasonInvalidNotification
+		result.Detail = err.Error()
+		return result
+	}
+
+	if err := checkNamespaceAccess(commonName, sub.URN.Namespace, eaaCtx); err != nil {
+		result.Code = http.StatusForbidden
+		result.Error = reasonNamespaceAccessDenied
+		result.Detail = err.Error()
+		return result
+	}
+
+	if err := checkSubscriptionLimit(commonName, sub.URN.Namespace, sub.URN.ID,
+		sub.Notifications, eaaCtx); err != nil {
+		result.Code = http.StatusForbidden
+		result.Error = reasonSubscriptionLimit
+		result.Detail = err.Error()
+		return result
+	}
+
+	eaaCtx.serviceInfo.RLock()
+	serviceFound := isServicePresent(sub.URN.String(), eaaCtx)
+	eaaCtx.serviceInfo.RUnlock()
+	if !serviceFound {
+		result.Code = http.StatusNotFound
+		result.Error = reasonServiceNotFound
+		return result
+	}
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	err := processSubscriptionRequest(ctx, subscriptionActionSubscribe,
+		subscriptionScopeService, commonName, sub.URN, sub.Notifications, lease, r, eaaCtx)
+	if err != nil {
+		log.Errf("Error during Bulk Service Subscription Request processing: %s",
+			err.Error())
+		result.Code = http.StatusInternalServerError
+		result.Error = reasonSubscriptionFailed
+		if isPublishTimeout(err) {
+			result.Code = http.StatusServiceUnavailable
+			result.Error = reasonBrokerPublishTimeout
+		}
+		if isBrokerCircuitOpen(err) {
+			result.Code = http.StatusServiceUnavailable
+			result.Error = reasonBrokerUnavailable
+		}
+	}
+
+	return result
+}
+
+// validateServiceURNVars checks the URN of a service subscription, whose
+// namespace can't be a pattern
+func validateServiceURNVars(urn URN) error {
+	if err := validateURNComponent("namespace", urn.Namespace); err != nil {
+		return err
+	}
+	if err := validateURNComponent("ID", urn.ID); err != nil {
+		return err
+	}
+	if isNamespacePattern(urn.Namespace) {
+		return errors.New("service subscription namespace cannot contain wildcards")
+	}
+	return nil
+}
+
+// addNotificationSubscriber subscribes to the Notification topic of a namespace
+// (if not subscribed already)
+func addNotificationSubscriber(namespace string, r *http.Request, eaaCtx *Context) error {
+	notifTopic := getNotificationTopicName(namespace)
+
+	err := eaaCtx.MsgBrokerCtx.addSubscriber(notificationSubscriber, notifTopic, r)
+	if err != nil {
+		// Ignore objectAlreadyExistsError error
+		if _, ok := err.(objectAlreadyExistsError); !ok {
+			return errors.Wrapf(err, "Error when subscribing to Notification topic '%v'",
+				notifTopic)
+		}
+	}
+
+	return nil
+}
+
+// publishServiceMessage publishes the ServiceMessage to the Services topic
+func publishServiceMessage(ctx context.Context, commonName string, svcMsg ServiceMessage,
+	eaaCtx *Context) error {
+	data, err := json.Marshal(svcMsg)
+	if err != nil {
+		return errors.Wrap(err, "Error during ServiceMessage structure marshaling")
+	}
+	msg := message.NewMessage(commonName, data)
+
+	err = publishMessage(ctx, servicesTopic, msg, eaaCtx)
+	if err != nil {
+		return errors.Wrap(err, "Error during Message publishing")
+	}
+
+	return nil
+}
+
+// notificationKey returns the key of a notification of the producer
+func notificationKey(URN URN, notif *NotificationFromProducer) UniqueNotif {
+	return UniqueNotif{
+		namespace:    URN.Namespace,
+		notifName:    notif.Name,
+		notifVersion: notif.Version,
+	}
+}
+
+// checkPushedNotification validates a notification pushed by the producer
+// and applies its maximum age. A failure is returned with the status code
+// and the reason of the response.
+func checkPushedNotification(URN URN, notif *NotificationFromProducer,
+	eaaCtx *Context) (int, string, error) {
+
+	if err := validateNotificationPriority(notif.Priority); err != nil {
+		return http.StatusBadRequest, reasonInvalidNotification, err
+	}
+	if err := applyNotificationMaxAge(notif, time.Now()); err != nil {
+		return http.StatusBadRequest, reasonInvalidNotification, err
+	}
+	if err := validateNotificationSignature(notif.Signature, URN.Namespace,
+		eaaCtx); err != nil {
+		return http.StatusBadRequest, reasonInvalidSignature, err
+	}
+	return 0, "", nil
+}
+
+// checkProducerPush checks if the producer may push notifications to its
+// namespace. A denial by the publish policies is audited. A failure is
+// returned with the status code and the reason of the response.
+func checkProducerPush(commonName string, URN URN, reqID string,
+	eaaCtx *Context) (int, string, error) {
+
+	if err := checkNamespaceAccess(commonName, URN.Namespace, eaaCtx); err != nil {
+		return http.StatusForbidden, reasonNamespaceAccessDenied, err
+	}
+	if err := eaaCtx.currentPublishPolicies().check(commonName, URN.Namespace); err != nil {
+		eaaCtx.audit.record(auditRecord{
+			Timestamp:  time.Now().UTC(),
+			RequestID:  requestID(reqID),
+			CommonName: commonName,
+			Action:     auditActionPublish,
+			Target:     URN.Namespace,
+			Status:     strconv.Itoa(http.StatusForbidden),
+		})
+		return http.StatusForbidden, reasonNamespaceAccessDenied, err
+	}
+
+	eaaCtx.serviceInfo.RLock()
+	_, serviceFound := eaaCtx.serviceInfo.m[URN.String()]
+	eaaCtx.serviceInfo.RUnlock()
+	if !serviceFound {
+		return http.StatusInternalServerError, reasonProducerNotRegistered,
+			errors.New("Producer is not registered")
+	}
+	return 0, "", nil
+}
+
+// maxBulkNotifications is the maximum number of notifications of a bulk
+// push request
+const maxBulkNotifications = 256
+
+// processBulkNotification checks, rate limits and publishes a notification
+// of a bulk push request and fills in its result. It returns the ID and
+// the channel of the awaited delivery summary, if any, and how long to wait
+// before retrying a rate limited notification.
+func processBulkNotification(commonName string, URN URN, notif *NotificationFromProducer,
+	result *NotificationResult, r *http.Request,
+	eaaCtx *Context) (string, <-chan DeliverySummary, time.Duration) {
+
+	fail := func(code int, reason string, err error) {
+		log.Errf("Bulk Publish Notification %s: %s", result.CorrelationID, err.Error())
+		result.Code = code
+		result.Error = reason
+		result.Detail = err.Error()
+	}
+
+	if code, reason, err := checkPushedNotification(URN, notif, eaaCtx); err != nil {
+		fail(code, reason, err)
+		return "", nil, 0
+	}
+	if err := eaaCtx.notifSchemas.validate(notificationKey(URN, notif),
+		notif.Payload); err != nil {
+		fail(http.StatusBadRequest, reasonInvalidPayload, err)
+		return "", nil, 0
+	}
+
+	allowed, retryAfter := eaaCtx.notifLimiter.allow(commonName,
+		eaaCtx.config().NotificationRateLimit, eaaCtx.config().NotificationBurst,
+		time.Now())
+	if !allowed {
+		fail(http.StatusTooManyRequests, reasonRateLimitExceeded,
+			errors.New("notification rate limit exceeded"))
+		return "", nil, retryAfter
+	}
+	if allowed, retryAfter = allowNodeNotification(eaaCtx, time.Now()); !allowed {
+		fail(http.StatusServiceUnavailable, reasonNodeRateLimitExceeded,
+			errors.New("node notification rate limit exceeded"))
+		return "", nil, retryAfter
+	}
+
+	var deliveryID string
+	var reportCh <-chan DeliverySummary
+	if hasNotificationSubscribers(URN, notif, eaaCtx) {
+		deliveryID, reportCh = eaaCtx.deliveryReports.expect()
+	}
+
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	if err := publishNotification(ctx, URN, notif, deliveryID, result.CorrelationID,
+		eaaCtx); err != nil {
+		eaaCtx.deliveryReports.cancel(deliveryID)
+		result.Code = http.StatusInternalServerError
+		result.Error = reasonBrokerPublishFailed
+		if isPublishTimeout(err) {
+			result.Code = http.StatusServiceUnavailable
+			result.Error = reasonBrokerPublishTimeout
+		}
+		if isBrokerCircuitOpen(err) {
+			result.Code = http.StatusServiceUnavailable
+			result.Error = reasonBrokerUnavailable
+		}
+		result.Detail = err.Error()
+		log.Errf("Bulk Publish Notification %s: %s", result.CorrelationID, err.Error())
+		return "", nil, 0
+	}
+
+	result.Code = http.StatusAccepted
+	return deliveryID, reportCh, 0
+}
+
+// publishNotification publishes a notification of a producer to the topic
+// of the producer's namespace
+func publishNotification(ctx context.Context, URN URN, notif *NotificationFromProducer,
+	deliveryID string, correlationID string, eaaCtx *Context) error {
+	notifTopic := getNotificationTopicName(URN.Namespace)
+
+	// Add a Publisher to the Notification Namespace topic (if not subscribed already)
+	err := eaaCtx.MsgBrokerCtx.addPublisher(notificationPublisher, notifTopic, nil)
+	if err != nil {
+		// Ignore objectAlreadyExistsError error
+		if _, ok := err.(objectAlreadyExistsError); !ok {
+			log.Errf("Error when adding a Publisher of type: '%v', id: '%v'. Error: %s",
+				notificationPublisher, notifTopic, err.Error())
+		}
+	}
+
+	// Prepare NotificationMessage that will be published using a Message Broker
+	notifMsg := NotificationMessage{Notification: notif, URN: &URN,
+		DeliveryID: deliveryID, ReceivedAt: eaaCtx.receiveClock.stamp(time.Now())}
+
+	// Create Watermill Message and publish it
+	data, err := json.Marshal(notifMsg)
 	if err != nil {
+		return errors.Wrap(err, "Error during NotificationMessage structure marshaling")
+	}
+	msg := message.NewMessage(URN.String(), data)
+	msg.Metadata.Set(correlationIDMetadataKey, correlationID)
+
+	if err = publishMessage(ctx, notifTopic, msg, eaaCtx); err != nil {
 		return errors.Wrap(err, "Error during Message publishing")
 	}
+	log.Debugf("Notification %s of %s published to %s", correlationID, URN.String(),
+		notifTopic)
 
+	notificationsPublishedTotal.WithLabelValues(URN.Namespace).Inc()
 	return nil
 }
@@ -0,0 +1,921 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("api_eaa handlers", func() {
+	var eaaCtx *Context
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = map[string]Service{
+			"ns:producer": {
+				URN:         &URN{Namespace: "ns", ID: "producer"},
+				EndpointURI: "https://1.2.3.4",
+			},
+		}
+	})
+
+	g.Describe("GetNamespaces", func() {
+		g.It("counts the services of every namespace", func() {
+			for _, cn := range []string{"ns:a", "other:b", "ns:c", "edge:d", "other:e"} {
+				urn, err := CommonNameStringToURN(cn)
+				Expect(err).ToNot(HaveOccurred())
+				eaaCtx.serviceInfo.m[cn] = Service{URN: &urn}
+			}
+
+			rec := httptest.NewRecorder()
+			GetNamespaces(rec, newTLSRequest("GET", "/namespaces", "", "ns:consumer",
+				eaaCtx))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var list NamespaceList
+			Expect(json.NewDecoder(rec.Body).Decode(&list)).To(Succeed())
+			Expect(list.Namespaces).To(Equal([]NamespaceSummary{
+				{Namespace: "edge", Services: 1},
+				{Namespace: "ns", Services: 3},
+				{Namespace: "other", Services: 2},
+			}))
+		})
+
+		g.It("returns an empty list without services", func() {
+			eaaCtx.serviceInfo.m = map[string]Service{}
+
+			rec := httptest.NewRecorder()
+			GetNamespaces(rec, newTLSRequest("GET", "/namespaces", "", "ns:consumer",
+				eaaCtx))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"namespaces":[]}`))
+		})
+	})
+
+	g.Describe("GetService", func() {
+		getService := func(namespace, id string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("GET", "/services/"+namespace+"/"+id, "",
+				"ns:consumer", eaaCtx)
+			GetService(rec, mux.SetURLVars(r, map[string]string{
+				"urn.namespace": namespace, "urn.id": id}))
+			return rec
+		}
+
+		g.It("returns the registered service", func() {
+			rec := getService("ns", "producer")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var serv Service
+			Expect(json.NewDecoder(rec.Body).Decode(&serv)).To(Succeed())
+			Expect(serv).To(Equal(eaaCtx.serviceInfo.m["ns:producer"]))
+		})
+
+		g.It("returns 404 for an unknown service", func() {
+			rec := getService("ns", "unknown")
+
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+	g.Describe("GetServices", func() {
+		getServices := func(query string) (*httptest.ResponseRecorder, []string) {
+			rec := httptest.NewRecorder()
+			GetServices(rec, newTLSRequest("GET", "/services"+query, "", "ns:consumer",
+				eaaCtx))
+
+			var servList ServiceList
+			Expect(json.NewDecoder(rec.Body).Decode(&servList)).To(Succeed())
+			var ids []string
+			for _, serv := range servList.Services {
+				ids = append(ids, serv.URN.Namespace+":"+serv.URN.ID)
+			}
+			return rec, ids
+		}
+
+		g.BeforeEach(func() {
+			for _, cn := range []string{"ns:a", "ns:b", "other:c"} {
+				urn, err := CommonNameStringToURN(cn)
+				Expect(err).ToNot(HaveOccurred())
+				eaaCtx.serviceInfo.m[cn] = Service{URN: &urn}
+			}
+		})
+
+		g.It("returns all services without parameters", func() {
+			rec, ids := getServices("")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get(totalCountHeader)).To(Equal("4"))
+			Expect(ids).To(ConsistOf("ns:a", "ns:b", "ns:producer", "other:c"))
+		})
+
+		g.It("filters and paginates the services", func() {
+			rec, ids := getServices("?namespace=ns&offset=1&limit=2")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get(totalCountHeader)).To(Equal("3"))
+			Expect(ids).To(Equal([]string{"ns:b", "ns:producer"}))
+
+			_, ids = getServices("?offset=4")
+			Expect(ids).To(BeEmpty())
+		})
+
+		g.It("selects the services by labels and namespace", func() {
+			eaaCtx.serviceInfo.m["ns:a"] = Service{URN: &URN{Namespace: "ns", ID: "a"},
+				Labels: map[string]string{"region": "us-east", "gpu": "yes"}}
+			eaaCtx.serviceInfo.m["ns:b"] = Service{URN: &URN{Namespace: "ns", ID: "b"},
+				Labels: map[string]string{"region": "us-east"}}
+			eaaCtx.serviceInfo.m["other:c"] = Service{URN: &URN{Namespace: "other", ID: "c"},
+				Labels: map[string]string{"region": "us-east", "gpu": "yes"}}
+
+			_, ids := getServices("?label=region%3Dus-east")
+			Expect(ids).To(ConsistOf("ns:a", "ns:b", "other:c"))
+
+			_, ids = getServices("?label=region%3Dus-east&label=gpu%3Dyes&namespace=ns")
+			Expect(ids).To(ConsistOf("ns:a"))
+
+			rec := httptest.NewRecorder()
+			GetServices(rec, newTLSRequest("GET", "/services?label=region", "",
+				"ns:consumer", eaaCtx))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		g.It("rejects invalid pagination", func() {
+			rec := httptest.NewRecorder()
+			GetServices(rec, newTLSRequest("GET", "/services?limit=-1", "", "ns:consumer",
+				eaaCtx))
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		g.It("filters out unhealthy endpoints if requested", func() {
+			eaaCtx.serviceInfo.m = map[string]Service{"ns:a": {
+				URN: &URN{Namespace: "ns", ID: "a"},
+				Endpoints: []ServiceEndpoint{
+					{URI: "https://1.1.1.1", Health: EndpointHealthy},
+					{URI: "https://2.2.2.2", Health: EndpointUnhealthy},
+					{URI: "https://3.3.3.3"},
+				},
+			}}
+			endpoints := func(query string) []ServiceEndpoint {
+				rec := httptest.NewRecorder()
+				GetServices(rec, newTLSRequest("GET", "/services"+query, "",
+					"ns:consumer", eaaCtx))
+				Expect(rec.Code).To(Equal(http.StatusOK))
+
+				var servList ServiceList
+				Expect(json.NewDecoder(rec.Body).Decode(&servList)).To(Succeed())
+				Expect(servList.Services).To(HaveLen(1))
+				return servList.Services[0].Endpoints
+			}
+
+			Expect(endpoints("")).To(HaveLen(3))
+			Expect(endpoints("?healthyOnly=true")).To(Equal([]ServiceEndpoint{
+				{URI: "https://1.1.1.1", Health: EndpointHealthy},
+				{URI: "https://3.3.3.3"},
+			}))
+			Expect(eaaCtx.serviceInfo.m["ns:a"].Endpoints).To(HaveLen(3))
+
+			rec := httptest.NewRecorder()
+			GetServices(rec, newTLSRequest("GET", "/services?healthyOnly=maybe", "",
+				"ns:consumer", eaaCtx))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	g.Describe("GetSubscriptions", func() {
+		getSubscriptions := func(query string) SubscriptionList {
+			rec := httptest.NewRecorder()
+			GetSubscriptions(rec, newTLSRequest("GET", "/subscriptions"+query, "",
+				"ns:consumer", eaaCtx))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var subs SubscriptionList
+			Expect(json.NewDecoder(rec.Body).Decode(&subs)).To(Succeed())
+			return subs
+		}
+
+		g.BeforeEach(func() {
+			eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+			eaaCtx.serviceInfo.m["ns:producer"] = Service{
+				URN:           &URN{Namespace: "ns", ID: "producer"},
+				Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}},
+			}
+			Expect(addSubscriptionToNamespace("ns:consumer", "ns",
+				[]NotificationDescriptor{{Name: "n1", Version: "1.0"}}, eaaCtx)).To(Succeed())
+			Expect(addSubscriptionToService("ns:consumer", "ns", "gone",
+				[]NotificationDescriptor{{Name: "n2", Version: "1.0"}}, eaaCtx)).To(Succeed())
+		})
+
+		g.It("returns the subscriptions without status by default", func() {
+			subs := getSubscriptions("")
+
+			Expect(subs.Subscriptions).To(HaveLen(2))
+			for _, sub := range subs.Subscriptions {
+				Expect(sub.Status).To(BeNil())
+			}
+		})
+
+		g.It("returns the status of the subscriptions if verbose", func() {
+			now := time.Now()
+			eaaCtx.subscriptionLeases.set(leaseKey{"ns:consumer", "ns", ""}, time.Minute, now)
+			atomic.AddUint64(&eaaCtx.subscriptionStats.counters("ns:consumer",
+				UniqueNotif{"ns", "n1", "1.0"}).delivered, 3)
+
+			subs := getSubscriptions("?verbose=true")
+
+			Expect(subs.Subscriptions).To(HaveLen(2))
+			for _, sub := range subs.Subscriptions {
+				Expect(sub.Status).To(HaveLen(1))
+				status := sub.Status[0]
+				Expect(status.CreatedAt).To(BeTemporally("~", now, time.Second))
+				if sub.URN.ID == "" {
+					Expect(status.ExpiresAt).ToNot(BeNil())
+					Expect(*status.ExpiresAt).To(BeTemporally("~", now.Add(time.Minute),
+						time.Second))
+					Expect(status.Matching).To(BeTrue())
+					Expect(status.Delivered).To(Equal(uint64(3)))
+				} else {
+					Expect(status.ExpiresAt).To(BeNil())
+					Expect(status.Matching).To(BeFalse())
+					Expect(status.Delivered).To(BeZero())
+				}
+			}
+		})
+
+		g.It("scopes the subscriptions to a namespace or service", func() {
+			Expect(addSubscriptionToNamespace("ns:consumer", "other",
+				[]NotificationDescriptor{{Name: "n1", Version: "1.0"}}, eaaCtx)).To(Succeed())
+
+			Expect(getSubscriptions("").Subscriptions).To(HaveLen(3))
+
+			subs := getSubscriptions("?namespace=NS")
+			Expect(subs.Subscriptions).To(HaveLen(2))
+			for _, sub := range subs.Subscriptions {
+				Expect(sub.URN.Namespace).To(Equal("ns"))
+			}
+
+			subs = getSubscriptions("?namespace=ns&id=gone")
+			Expect(subs.Subscriptions).To(HaveLen(1))
+			Expect(*subs.Subscriptions[0].URN).To(Equal(URN{Namespace: "ns", ID: "gone"}))
+
+			Expect(getSubscriptions("?namespace=unknown").Subscriptions).To(BeEmpty())
+			Expect(getSubscriptions("?namespace=other&id=gone").Subscriptions).To(BeEmpty())
+		})
+
+		g.It("rejects an invalid verbose flag", func() {
+			rec := httptest.NewRecorder()
+			GetSubscriptions(rec, newTLSRequest("GET", "/subscriptions?verbose=yes!", "",
+				"ns:consumer", eaaCtx))
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	g.Describe("RenewApplication", func() {
+		g.BeforeEach(func() {
+			eaaCtx.serviceInfo.m["ns:producer"] = Service{
+				URN: &URN{Namespace: "ns", ID: "producer"},
+				Endpoints: []ServiceEndpoint{
+					{URI: "https://1.1.1.1", Health: EndpointHealthy},
+					{URI: "https://2.2.2.2", Health: EndpointHealthy},
+				},
+			}
+			eaaCtx.serviceInfo.renewed = make(map[string]time.Time)
+			eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+			Expect(eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic,
+				nil)).To(Succeed())
+			Expect(eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic,
+				nil)).To(Succeed())
+		})
+
+		g.AfterEach(func() {
+			Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+		})
+
+		renew := func(body string) int {
+			rec := httptest.NewRecorder()
+			RenewApplication(rec, newTLSRequest("POST", "/services/renew", body,
+				"ns:producer", eaaCtx))
+			return rec.Code
+		}
+
+		endpoints := func() []ServiceEndpoint {
+			eaaCtx.serviceInfo.RLock()
+			defer eaaCtx.serviceInfo.RUnlock()
+			return eaaCtx.serviceInfo.m["ns:producer"].Endpoints
+		}
+
+		g.It("updates the health of the endpoints", func() {
+			Expect(renew(`{"endpoints":[{"uri":"https://2.2.2.2","health":"unhealthy"}]}`)).
+				To(Equal(http.StatusNoContent))
+
+			Eventually(endpoints).Should(Equal([]ServiceEndpoint{
+				{URI: "https://1.1.1.1", Health: EndpointHealthy},
+				{URI: "https://2.2.2.2", Health: EndpointUnhealthy},
+			}))
+		})
+
+		g.It("renews without a body", func() {
+			Expect(renew("")).To(Equal(http.StatusNoContent))
+		})
+
+		g.It("rejects updates of unknown endpoints", func() {
+			Expect(renew(`{"endpoints":[{"uri":"https://9.9.9.9","health":"unhealthy"}]}`)).
+				To(Equal(http.StatusBadRequest))
+			Expect(renew(`{"endpoints":[{"uri":"https://1.1.1.1","health":"dead"}]}`)).
+				To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	g.Describe("UpdateApplication", func() {
+		g.BeforeEach(func() {
+			eaaCtx.serviceInfo.m["ns:producer"] = Service{
+				URN:         &URN{Namespace: "ns", ID: "producer"},
+				Description: "producer",
+				EndpointURI: "https://1.1.1.1",
+				Labels:      map[string]string{"zone": "1", "tier": "gold"},
+				Info:        json.RawMessage(`{"a":1}`),
+			}
+			eaaCtx.serviceInfo.renewed = make(map[string]time.Time)
+			eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+			Expect(eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic,
+				nil)).To(Succeed())
+			Expect(eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic,
+				nil)).To(Succeed())
+		})
+
+		g.AfterEach(func() {
+			Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+		})
+
+		update := func(commonName string, body string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			UpdateApplication(rec, newTLSRequest(http.MethodPatch, "/services", body,
+				commonName, eaaCtx))
+			return rec
+		}
+
+		service := func() Service {
+			eaaCtx.serviceInfo.RLock()
+			defer eaaCtx.serviceInfo.RUnlock()
+			return eaaCtx.serviceInfo.m["ns:producer"]
+		}
+
+		g.It("merges the fields of the update into the service", func() {
+			rec := update("ns:producer",
+				`{"endpoints":[{"uri":"https://2.2.2.2"}],"labels":{"zone":"2","tier":null}}`)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			expected := Service{
+				URN:         &URN{Namespace: "ns", ID: "producer"},
+				Description: "producer",
+				EndpointURI: "https://1.1.1.1",
+				Endpoints:   []ServiceEndpoint{{URI: "https://2.2.2.2", Health: EndpointHealthy}},
+				Labels:      map[string]string{"zone": "2"},
+				Info:        json.RawMessage(`{"a":1}`),
+			}
+			var updated Service
+			Expect(json.NewDecoder(rec.Body).Decode(&updated)).To(Succeed())
+			Expect(updated).To(Equal(expected))
+			Eventually(service).Should(Equal(expected))
+		})
+
+		g.It("applies concurrent updates of different fields", func() {
+			done := make(chan int, 2)
+			go func() { done <- update("ns:producer", `{"description":"updated"}`).Code }()
+			go func() { done <- update("ns:producer", `{"labels":{"zone":"3"}}`).Code }()
+			Expect(<-done).To(Equal(http.StatusOK))
+			Expect(<-done).To(Equal(http.StatusOK))
+
+			Eventually(func() string { return service().Description }).Should(
+				Equal("updated"))
+			Eventually(func() string { return service().Labels["zone"] }).Should(Equal("3"))
+			Expect(service().Labels["tier"]).To(Equal("gold"))
+		})
+
+		g.It("rejects an update leaving the service invalid", func() {
+			rec := update("ns:producer", `{"endpoint_uri":""}`)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(rec.Body.String()).To(ContainSubstring(reasonInvalidService))
+		})
+
+		g.It("drops an update leaving the merged service over the label limit", func() {
+			labels := func(prefix string) map[string]*string {
+				value := "v"
+				labels := make(map[string]*string, maxServiceLabels/2)
+				for i := 0; i < maxServiceLabels/2; i++ {
+					labels[fmt.Sprintf("%s%d", prefix, i)] = &value
+				}
+				return labels
+			}
+
+			// Each of the updates is valid against the service it was
+			// requested for, only the one merged first is
+			Expect(updateService("ns:producer", ServiceUpdate{Labels: labels("a")},
+				eaaCtx)).To(Succeed())
+			Expect(updateService("ns:producer", ServiceUpdate{Labels: labels("b")},
+				eaaCtx)).ToNot(Succeed())
+			Expect(service().Labels).To(HaveLen(2 + maxServiceLabels/2))
+			Expect(service().Labels).To(HaveKey("a0"))
+		})
+
+		g.It("returns 404 for a service which isn't registered", func() {
+			rec := update("ns:other", `{"description":"updated"}`)
+
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+			Expect(rec.Body.String()).To(ContainSubstring(reasonServiceNotFound))
+		})
+	})
+
+	g.Describe("GetSubscribers", func() {
+		getSubscribers := func(commonName string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			GetSubscribers(rec, newTLSRequest("GET", "/services/subscribers", "",
+				commonName, eaaCtx))
+			return rec
+		}
+
+		g.It("returns the subscribers of the producer's own service only", func() {
+			serv := eaaCtx.serviceInfo.m["ns:producer"]
+			serv.Notifications = []NotificationDescriptor{
+				{Name: "n1", Version: "1.0"}, {Name: "n2", Version: "1.0"}}
+			eaaCtx.serviceInfo.m["ns:producer"] = serv
+			eaaCtx.subscriptionInfo.m = map[UniqueNotif]*ConsumerSubscription{
+				{"ns", "n1", "1.0"}: {
+					namespaceSubscriptions: SubscriberIds{"ns:b"},
+					serviceSubscriptions: map[string]SubscriberIds{
+						"other": {"ns:c"}},
+				},
+				{"ns", "n2", "1.0"}: {
+					serviceSubscriptions: map[string]SubscriberIds{
+						"producer": {"ns:a", "ns:b"}},
+				},
+				{"ns", "n3", "1.0"}: {
+					namespaceSubscriptions: SubscriberIds{"ns:d"},
+				},
+			}
+
+			rec := getSubscribers("ns:producer")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var resp ServiceSubscribers
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp).To(Equal(ServiceSubscribers{
+				URN:         &URN{Namespace: "ns", ID: "producer"},
+				Subscribers: []string{"ns:a", "ns:b"},
+			}))
+		})
+
+		g.It("returns 404 for a producer which isn't registered", func() {
+			Expect(getSubscribers("ns:other").Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	g.Describe("RegisterApplication dry run", func() {
+		// The broker is left nil, a dry run must not publish
+		register := func(query, body, commonName string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			RegisterApplication(rec, newTLSRequest("POST", "/services"+query, body,
+				commonName, eaaCtx))
+			return rec
+		}
+
+		g.It("returns the URN without registering the service", func() {
+			rec := register("?dryRun=true", `{"endpoint_uri":"https://5.6.7.8"}`,
+				"ns:new")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var resp RegistrationDryRun
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp).To(Equal(RegistrationDryRun{DryRun: true,
+				URN: &URN{Namespace: "ns", ID: "new"}, Action: serviceActionRegister}))
+			Expect(eaaCtx.serviceInfo.m).ToNot(HaveKey("ns:new"))
+		})
+
+		g.It("reports an update of a registered service", func() {
+			rec := register("?dryRun=1", `{"endpoint_uri":"https://5.6.7.8"}`,
+				"ns:producer")
+
+			var resp RegistrationDryRun
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp.Action).To(Equal(serviceActionUpdate))
+			Expect(eaaCtx.serviceInfo.m["ns:producer"].EndpointURI).To(
+				Equal("https://1.2.3.4"))
+		})
+
+		g.It("validates the service", func() {
+			rec := register("?dryRun=true", `{}`, "ns:new")
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+			rec = register("?dryRun=maybe", `{"endpoint_uri":"https://5.6.7.8"}`, "ns:new")
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	g.Describe("SubscribeNamespaceNotifications", func() {
+		g.It("rejects the whole batch if a notification is invalid", func() {
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("POST", "/subscriptions/ns",
+				`[{"name":"valid","version":"1.0"},{"name":"invalid"}]`,
+				"ns:consumer", eaaCtx)
+			SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": "ns"}))
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			var resp ErrorResponse
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp.Error).To(Equal(reasonInvalidNotification))
+			Expect(resp.Detail).To(Equal("notification 1 (\"invalid\"): missing version"))
+		})
+	})
+
+	g.Describe("SubscribeServiceNotifications", func() {
+		subscribe := func(namespace, id string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("POST", "/subscriptions", `[{"name":"n1","version":"1.0"}]`,
+				"ns:consumer", eaaCtx)
+			SubscribeServiceNotifications(rec, mux.SetURLVars(r, map[string]string{
+				"urn.namespace": namespace, "urn.id": id}))
+			return rec
+		}
+
+		g.It("rejects malformed path variables", func() {
+			for _, urn := range [][2]string{{"", "producer"}, {"ns", ""},
+				{"ns", "a:b"}, {"ns", "a b"}, {"n*", "producer"}} {
+				rec := subscribe(urn[0], urn[1])
+
+				Expect(rec.Code).To(Equal(http.StatusBadRequest), urn[0]+"/"+urn[1])
+				var resp ErrorResponse
+				Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+				Expect(resp.Error).To(Equal(reasonInvalidURN))
+			}
+		})
+
+		g.It("returns 404 for a service which isn't registered", func() {
+			rec := subscribe("ns", "unknown")
+
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+			var resp ErrorResponse
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp.Error).To(Equal(reasonServiceNotFound))
+		})
+	})
+
+	g.Describe("UnsubscribeNamespaceNotifications", func() {
+		g.BeforeEach(func() {
+			eaaCtx.subscriptionInfo = NotificationSubscriptions{
+				m: make(map[UniqueNotif]*ConsumerSubscription)}
+			eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		})
+
+		g.AfterEach(func() {
+			Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+		})
+
+		g.It("reports removed and not found notifications", func() {
+			Expect(addSubscriptionToNamespace("ns:consumer", "ns",
+				[]NotificationDescriptor{{Name: "n1", Version: "1.0"}}, eaaCtx)).To(Succeed())
+
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("DELETE", "/subscriptions/ns", `[{"name":"n1","version":"1.0"},
+				{"name":"n2","version":"1.0"},{"name":"n1","version":"1.0"}]`,
+				"ns:consumer", eaaCtx)
+			UnsubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": "ns"}))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var result UnsubscriptionResult
+			Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+			Expect(result.URN).To(Equal(&URN{Namespace: "ns"}))
+			Expect(result.Removed).To(Equal([]NotificationDescriptor{
+				{Name: "n1", Version: "1.0"}}))
+			Expect(result.NotFound).To(Equal([]NotificationDescriptor{
+				{Name: "n2", Version: "1.0"}}))
+			Eventually(func() int {
+				return countConsumerSubscriptions("ns:consumer", eaaCtx)
+			}).Should(BeZero())
+		})
+	})
+
+	g.Describe("SubscribeServiceNotificationsBulk", func() {
+		g.BeforeEach(func() {
+			eaaCtx.subscriptionInfo = NotificationSubscriptions{
+				m: make(map[UniqueNotif]*ConsumerSubscription)}
+			eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		})
+
+		g.AfterEach(func() {
+			Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+		})
+
+		subscribeBulk := func(body string) (int, SubscriptionResultList) {
+			rec := httptest.NewRecorder()
+			SubscribeServiceNotificationsBulk(rec, newTLSRequest("POST", "/subscriptions",
+				body, "ns:consumer", eaaCtx))
+
+			var results SubscriptionResultList
+			Expect(json.NewDecoder(rec.Body).Decode(&results)).To(Succeed())
+			return rec.Code, results
+		}
+
+		isSubscribed := func() bool {
+			eaaCtx.subscriptionInfo.RLock()
+			defer eaaCtx.subscriptionInfo.RUnlock()
+
+			sub, ok := eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}]
+			return ok && len(sub.serviceSubscriptions["producer"]) == 1
+		}
+
+		g.It("subscribes to all services", func() {
+			code, results := subscribeBulk(`{"subscriptions":[
+				{"urn":{"namespace":"ns","id":"producer"},
+				 "notifications":[{"name":"n1","version":"1.0"}]}]}`)
+
+			Expect(code).To(Equal(http.StatusCreated))
+			Expect(results.Results).To(HaveLen(1))
+			Expect(results.Results[0].Code).To(Equal(http.StatusCreated))
+			Eventually(isSubscribed).Should(BeTrue())
+		})
+
+		g.It("reports a partial success per subscription", func() {
+			code, results := subscribeBulk(`{"subscriptions":[
+				{"urn":{"namespace":"ns","id":"producer"},
+				 "notifications":[{"name":"n1","version":"1.0"}]},
+				{"urn":{"namespace":"ns"},
+				 "notifications":[{"name":"n1","version":"1.0"}]},
+				{"urn":{"namespace":"ns","id":"other"},
+				 "notifications":[{"name":"n1"}]},
+				{"urn":{"namespace":"ns","id":"unknown"},
+				 "notifications":[{"name":"n1","version":"1.0"}]}]}`)
+
+			Expect(code).To(Equal(http.StatusMultiStatus))
+			Expect(results.Results).To(HaveLen(4))
+			Expect(results.Results[0].Code).To(Equal(http.StatusCreated))
+			Expect(results.Results[1].Code).To(Equal(http.StatusBadRequest))
+			Expect(results.Results[1].Error).To(Equal(reasonInvalidURN))
+			Expect(results.Results[2].Code).To(Equal(http.StatusBadRequest))
+			Expect(results.Results[2].Error).To(Equal(reasonInvalidNotification))
+			Expect(results.Results[3].Code).To(Equal(http.StatusNotFound))
+			Expect(results.Results[3].Error).To(Equal(reasonServiceNotFound))
+			Eventually(isSubscribed).Should(BeTrue())
+		})
+	})
+
+	g.Describe("request body size limit", func() {
+		oversized := `[{"name":"n1","version":"1.0","description":"` +
+			strings.Repeat("x", 64) + `"}]`
+
+		g.BeforeEach(func() {
+			eaaCtx.cfg.MaxRequestBodySize = 32
+		})
+
+		expectTooLarge := func(rec *httptest.ResponseRecorder) {
+			Expect(rec.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			var resp ErrorResponse
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp.Error).To(Equal(reasonRequestBodyTooLarge))
+		}
+
+		g.It("rejects an oversized notification", func() {
+			rec := httptest.NewRecorder()
+			PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+				`{"name":"n1","version":"1.0","payload":"`+strings.Repeat("x", 64)+`"}`,
+				"ns:producer", eaaCtx))
+			expectTooLarge(rec)
+		})
+
+		g.It("rejects an oversized service", func() {
+			rec := httptest.NewRecorder()
+			RegisterApplication(rec, newTLSRequest("POST", "/services",
+				`{"endpoint_uri":"https://`+strings.Repeat("x", 64)+`"}`,
+				"ns:producer", eaaCtx))
+			expectTooLarge(rec)
+		})
+
+		g.It("rejects oversized subscriptions", func() {
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("POST", "/subscriptions/ns", oversized, "ns:consumer", eaaCtx)
+			SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": "ns"}))
+			expectTooLarge(rec)
+
+			rec = httptest.NewRecorder()
+			r = newTLSRequest("POST", "/subscriptions/ns/producer", oversized,
+				"ns:consumer", eaaCtx)
+			SubscribeServiceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": "ns", "urn.id": "producer"}))
+			expectTooLarge(rec)
+		})
+
+		g.It("applies the default limit if not configured", func() {
+			eaaCtx.cfg.MaxRequestBodySize = 0
+
+			// The body is decoded and rejected only because of the missing version
+			rec := httptest.NewRecorder()
+			r := newTLSRequest("POST", "/subscriptions/ns",
+				`[{"name":"`+strings.Repeat("x", 64)+`"}]`, "ns:consumer", eaaCtx)
+			SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": "ns"}))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	g.Describe("malformed request bodies", func() {
+		vars := map[string]string{"urn.namespace": "ns", "urn.id": "producer"}
+		handlers := map[string]http.HandlerFunc{
+			"PushNotificationToSubscribers":     PushNotificationToSubscribers,
+			"RegisterApplication":               RegisterApplication,
+			"SubscribeNamespaceNotifications":   SubscribeNamespaceNotifications,
+			"SubscribeServiceNotifications":     SubscribeServiceNotifications,
+			"SubscribeServiceNotificationsBulk": SubscribeServiceNotificationsBulk,
+			"UnsubscribeNamespaceNotifications": UnsubscribeNamespaceNotifications,
+			"UnsubscribeServiceNotifications":   UnsubscribeServiceNotifications,
+		}
+
+		for name, handler := range handlers {
+			name, handler := name, handler
+			g.It("rejects garbage sent to "+name+" with 400", func() {
+				for _, body := range []string{"---", "{", `{"name":`, "\x00\xff"} {
+					rec := httptest.NewRecorder()
+					handler(rec, mux.SetURLVars(newTLSRequest("POST", "/", body,
+						"ns:producer", eaaCtx), vars))
+
+					Expect(rec.Code).To(Equal(http.StatusBadRequest), body)
+					var resp ErrorResponse
+					Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+					Expect(resp.Error).To(Equal(reasonInvalidRequestBody))
+				}
+			})
+		}
+	})
+})
+
+var _ = g.Describe("Mixed-case namespaces", func() {
+	var (
+		eaaCtx *Context
+		conn   *fakeNotificationConn
+	)
+
+	g.BeforeEach(func() {
+		conn = &fakeNotificationConn{sent: make(chan []byte, 1)}
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.serviceInfo.renewed = make(map[string]time.Time)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: conn}}}
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+
+		urn, err := CommonNameStringToURN("Sensors:p1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addService(urn.String(), Service{URN: &urn}, eaaCtx)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	subscribe := func(vars map[string]string) {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest("POST", "/subscriptions", `[{"name":"n1","version":"1.0"}]`,
+			"ns:consumer", eaaCtx)
+		if vars["urn.id"] == "" {
+			SubscribeNamespaceNotifications(rec, mux.SetURLVars(r, vars))
+		} else {
+			SubscribeServiceNotifications(rec, mux.SetURLVars(r, vars))
+		}
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+		Eventually(func() int {
+			return countConsumerSubscriptions("ns:consumer", eaaCtx)
+		}).Should(Equal(1))
+	}
+
+	push := func() DeliverySummary {
+		summary, err := sendNotificationToAllSubscribers("Sensors:p1",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(`{}`)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		return summary
+	}
+
+	g.It("delivers notifications to a namespace subscribed in another case", func() {
+		subscribe(map[string]string{"urn.namespace": "SENSORS"})
+
+		Expect(push().Delivered).To(Equal(1))
+		Expect(<-conn.sent).To(ContainSubstring(`"namespace":"sensors"`))
+	})
+
+	g.It("delivers notifications to a service subscribed in another case", func() {
+		subscribe(map[string]string{"urn.namespace": " sensors", "urn.id": "p1"})
+
+		Expect(push().Delivered).To(Equal(1))
+	})
+
+	g.It("delivers notifications to a pattern subscribed in another case", func() {
+		subscribe(map[string]string{"urn.namespace": "SENS*"})
+
+		Expect(push().Delivered).To(Equal(1))
+	})
+
+	g.It("finds the service by a namespace in another case", func() {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest("GET", "/services/SENSORS/p1", "", "ns:consumer", eaaCtx)
+		GetService(rec, mux.SetURLVars(r, map[string]string{
+			"urn.namespace": "SENSORS", "urn.id": "p1"}))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+})
+
+// statusCountingRecorder records every status code written to a response,
+// including the implicit one of a body written first
+type statusCountingRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (r *statusCountingRecorder) WriteHeader(code int) {
+	r.codes = append(r.codes, code)
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+func (r *statusCountingRecorder) Write(data []byte) (int, error) {
+	if len(r.codes) == 0 {
+		r.codes = append(r.codes, http.StatusOK)
+	}
+	return r.ResponseRecorder.Write(data)
+}
+
+var _ = g.Describe("Status codes of the GET handlers", func() {
+	var eaaCtx *Context
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = map[string]Service{
+			"ns:producer": {URN: &URN{Namespace: "ns", ID: "producer"}}}
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+	})
+
+	codes := func(handler http.HandlerFunc, r *http.Request) []int {
+		rec := &statusCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		handler(rec, r)
+		return rec.codes
+	}
+
+	g.Describe("GetServices", func() {
+		get := func(target string) []int {
+			return codes(GetServices, newTLSRequest(http.MethodGet, target, "",
+				"ns:consumer", eaaCtx))
+		}
+
+		g.It("sends one status code in every branch", func() {
+			Expect(get("/services")).To(Equal([]int{http.StatusOK}))
+			Expect(get("/services?limit=-1")).To(Equal([]int{http.StatusBadRequest}))
+
+			eaaCtx.serviceInfo.m = nil
+			Expect(get("/services")).To(Equal([]int{http.StatusInternalServerError}))
+		})
+	})
+
+	g.Describe("GetNotifications", func() {
+		get := func(target string, host string, header http.Header) []int {
+			r := newTLSRequest(http.MethodGet, target, "", "ns:consumer", eaaCtx)
+			r.Host = host
+			for key, values := range header {
+				r.Header[key] = values
+			}
+			return codes(GetNotifications, r)
+		}
+
+		g.It("sends one status code in every branch", func() {
+			Expect(get("/notifications?since=x", "ns:consumer", nil)).To(
+				Equal([]int{http.StatusBadRequest}))
+			Expect(get("/notifications", "ns:other", nil)).To(
+				Equal([]int{http.StatusUnauthorized}))
+			Expect(get("/notifications", "ns:consumer", http.Header{
+				"Sec-Websocket-Protocol": {"eaa.v9"}})).To(
+				Equal([]int{http.StatusBadRequest}))
+			// The recorder isn't a websocket handshake, so the upgrade fails
+			Expect(get("/notifications", "ns:consumer", nil)).To(
+				Equal([]int{http.StatusBadRequest}))
+
+			eaaCtx.serviceInfo.m = nil
+			Expect(get("/notifications", "ns:consumer", nil)).To(
+				Equal([]int{http.StatusInternalServerError}))
+		})
+	})
+})
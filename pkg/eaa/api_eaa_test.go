@@ -135,7 +135,43 @@ func registerProducer(c *http.Client, service eaa.Service,
 	Expect(respPost.Status).To(Equal("200 OK"))
 }
 
-// registerProducerErr sends a registration POST request to the EAA and expects Internal Server Error
+// subscribedProducers are the producers the consumers of the service
+// subscription tests subscribe to
+var subscribedProducers = []string{
+	Name1Prod1,
+	Name1Prod2,
+	"namespace-1:the-producer",
+	"namespace-2:producer-1",
+	"namespace-2:producer-2",
+	"namespace-2:producer-3",
+	"namespace-2:the-producer",
+	"the-namespace:the-producer",
+}
+
+// registerProducers registers a service of every producer, consumers can
+// subscribe only to registered services
+func registerProducers(commonNames []string) {
+	for _, commonName := range commonNames {
+		prodCertTempl := GetCertTempl()
+		prodCertTempl.Subject.CommonName = commonName
+		prodCert, prodCertPool := generateSignedClientCert(&prodCertTempl)
+		prodClient := createHTTPClient(prodCert, prodCertPool)
+
+		registerProducer(prodClient, eaa.Service{EndpointURI: "https://1.2.3.4"},
+			commonName+" ")
+
+		By("Waiting for the " + commonName + " service to be registered")
+		Eventually(func() int {
+			resp, err := prodClient.Get("https://" + cfg.TLSEndpoint + "/services/" +
+				strings.Replace(commonName, ":", "/", 1))
+			Expect(err).ShouldNot(HaveOccurred())
+			resp.Body.Close()
+			return resp.StatusCode
+		}).Should(Equal(http.StatusOK))
+	}
+}
+
+// registerProducerErr sends a registration POST request to the EAA and expects Bad Request
 func registerProducerErr(c *http.Client, service eaa.Service) {
 	By("Service struct list encoding")
 	payload, err := json.Marshal(service)
@@ -149,7 +185,7 @@ func registerProducerErr(c *http.Client, service eaa.Service) {
 
 	By("Comparing POST response code")
 	defer respPost.Body.Close()
-	Expect(respPost.Status).To(Equal("500 Internal Server Error"))
+	Expect(respPost.Status).To(Equal("400 Bad Request"))
 }
 
 // registerProducerWithBadRequest sends a registration POST request to the EAA
@@ -162,7 +198,7 @@ func registerProducerWithBadRequest(c *http.Client) {
 
 	By("Comparing POST response code")
 	defer respPost.Body.Close()
-	Expect(respPost.Status).To(Equal("500 Internal Server Error"))
+	Expect(respPost.Status).To(Equal("400 Bad Request"))
 }
 
 // deregisterProducer sends a deregistration DELETE request to the EAA
@@ -221,7 +257,7 @@ func subscribeConsumerBadRequest(c *http.Client, path string) {
 
 	By("Comparing POST response code")
 	defer respPost.Body.Close()
-	Expect(respPost.Status).To(Equal("500 Internal Server Error"))
+	Expect(respPost.Status).To(Equal("400 Bad Request"))
 }
 
 // unsubscribeConsumer sends a consumer subscription DELETE request
@@ -240,7 +276,7 @@ func unsubscribeConsumer(c *http.Client, notifs []eaa.NotificationDescriptor,
 
 	By("Comparing DELETE " + subject + "response code")
 	defer respPost.Body.Close()
-	Expect(respPost.Status).To(Equal("204 No Content"))
+	Expect(respPost.Status).To(Equal("200 OK"))
 }
 
 // unsubscribeConsumerWithBadRequest sends a consumer subscription DELETE request
@@ -256,7 +292,7 @@ func unsubscribeConsumerWithBadRequest(c *http.Client, path string) {
 
 	By("Comparing DELETE response code")
 	defer respPost.Body.Close()
-	Expect(respPost.Status).To(Equal("500 Internal Server Error"))
+	Expect(respPost.Status).To(Equal("400 Bad Request"))
 }
 
 // unsubscribeAll sends a all consumer subscription DELETE request
@@ -346,7 +382,7 @@ func produceEventWithBadRequest(c *http.Client) {
 
 	By("Comparing POST response code")
 	defer respPost.Body.Close()
-	Expect(respPost.Status).To(Equal("500 Internal Server Error"))
+	Expect(respPost.Status).To(Equal("400 Bad Request"))
 }
 
 // produceEventWithBadCommonName sends a notification POST request to the EAA
@@ -444,6 +480,16 @@ func getMsgFromConn(conn *websocket.Conn, response *eaa.NotificationToConsumer,
 	err = json.NewDecoder(output).
 		Decode(response)
 	Expect(err).ShouldNot(HaveOccurred())
+
+	// Sequence numbers depend on the order of the tests, correlation IDs
+	// are random and receive times vary, only check they are assigned and
+	// compare the rest of the notification
+	Expect(response.Sequence).To(BeNumerically(">", 0))
+	Expect(response.CorrelationID).ToNot(BeEmpty())
+	Expect(response.ReceivedAt).ToNot(BeNil())
+	response.Sequence = 0
+	response.CorrelationID = ""
+	response.ReceivedAt = nil
 }
 
 // getMsgFromClosedConn tries to use closed connection
@@ -3454,6 +3500,10 @@ var _ = Describe("ApiEaa", func() {
 			expectedSubList2 eaa.SubscriptionList
 		)
 
+		BeforeEach(func() {
+			registerProducers(subscribedProducers)
+		})
+
 		BeforeEach(func() {
 			consCertTempl := GetCertTempl()
 			consCertTempl.Subject.CommonName = Name1Cons1
@@ -4189,6 +4239,10 @@ var _ = Describe("ApiEaa", func() {
 			expectedSubList3 eaa.SubscriptionList
 		)
 
+		BeforeEach(func() {
+			registerProducers(subscribedProducers)
+		})
+
 		BeforeEach(func() {
 			consCertTempl := GetCertTempl()
 			consCertTempl.Subject.CommonName = Name1Cons1
@@ -4415,6 +4469,10 @@ var _ = Describe("ApiEaa", func() {
 			expectedSubList2 eaa.SubscriptionList
 		)
 
+		BeforeEach(func() {
+			registerProducers(subscribedProducers)
+		})
+
 		BeforeEach(func() {
 			consCertTempl := GetCertTempl()
 			consCertTempl.Subject.CommonName = Name1Cons1
@@ -5503,7 +5561,7 @@ var _ = Describe("Eaa Data Validation", func() {
 
 				producer := eaa.Service{
 					URN: &eaa.URN{
-						ID: "namespace-1",
+						ID: "producer-1",
 					},
 					Description: "The Sanity Producer",
 					EndpointURI: "https://1.2.3.4",
@@ -5536,6 +5594,35 @@ var _ = Describe("Eaa Data Validation", func() {
 				getAndCompareServiceList(accessClient, &receivedServList, &expectedServList)
 
 			})
+			Specify("With another producer's URN provided", func() {
+
+				var (
+					receivedServList eaa.ServiceList
+					expectedServList eaa.ServiceList
+				)
+
+				producer := eaa.Service{
+					URN: &eaa.URN{
+						ID:        "producer-2",
+						Namespace: "namespace-2",
+					},
+					Description: "The Spoofing Producer",
+					EndpointURI: "https://1.2.3.4",
+				}
+				expectedOutput := strings.NewReader(
+					`{"services": null}`)
+
+				registerProducerErr(prodClient, producer)
+
+				By("Expected service list decoding")
+				err := json.NewDecoder(expectedOutput).
+					Decode(&expectedServList)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Comparing GET response data")
+				getAndCompareServiceList(accessClient, &receivedServList, &expectedServList)
+			})
+
 			Specify("With no Description provided", func() {
 
 				var (
@@ -5635,15 +5722,9 @@ var _ = Describe("Eaa Data Validation", func() {
 				}
 
 				expectedOutput := strings.NewReader(
-					`{"services":[{"urn":{"id"` +
-						`:"producer-1","namespace":"namespace-1"},` +
-						`"description":"example description",` +
-						`"endpoint_uri":"",` +
-						`"notifications":[{"name":"Event #1",` +
-						`"version":"1.0.0","description"` +
-						`:"Description for Event #1 by Producer #1"}]}]}`)
+					`{"services": null}`)
 
-				registerProducer(prodClient, producer, "")
+				registerProducerErr(prodClient, producer)
 
 				By("Expected service list decoding")
 				err := json.NewDecoder(expectedOutput).
@@ -4,10 +4,17 @@
 package eaa
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -31,12 +38,236 @@ func validServiceNotifications(
 	return validNotificationList
 }
 
+// validateService checks if a Service has all the fields required to be
+// registered. The URN is expected to be already derived from the CommonName.
+func validateService(serv *Service) error {
+	if serv.URN == nil {
+		return errors.New("Service URN is missing")
+	}
+	if serv.URN.Namespace == "" || serv.URN.ID == "" {
+		return errors.New("Service URN is malformed - empty Namespace or ID")
+	}
+	if isNamespacePattern(serv.URN.Namespace) {
+		return errors.New("Service URN Namespace cannot contain wildcards")
+	}
+	if serv.URN.Namespace == discoveryNamespace {
+		return errors.New("Service URN Namespace " + discoveryNamespace + " is reserved")
+	}
+	if serv.EndpointURI == "" && len(serv.Endpoints) == 0 {
+		return errors.New("Service endpoint is missing")
+	}
+	if err := validateServiceEndpoints(serv.Endpoints); err != nil {
+		return err
+	}
+	return validateServiceLabels(serv.Labels)
+}
+
+// validateServiceEndpoints checks if the endpoints have unique URIs and
+// a known or empty health status
+func validateServiceEndpoints(endpoints []ServiceEndpoint) error {
+	uris := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.URI == "" {
+			return errors.New("Service endpoint URI is missing")
+		}
+		if uris[endpoint.URI] {
+			return errors.Errorf("Service endpoint %q is duplicated", endpoint.URI)
+		}
+		uris[endpoint.URI] = true
+		if err := validateEndpointHealth(endpoint.Health); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateEndpointHealth checks if the health status of an endpoint is
+// one of the known statuses or empty
+func validateEndpointHealth(health EndpointHealth) error {
+	switch health {
+	case "", EndpointHealthy, EndpointUnhealthy:
+		return nil
+	}
+	return errors.Errorf("unknown endpoint health %q", health)
+}
+
+// defaultEndpointHealth marks the endpoints without a health status as
+// healthy, so that registrations predating the health status stay valid
+func defaultEndpointHealth(endpoints []ServiceEndpoint) {
+	for i := range endpoints {
+		if endpoints[i].Health == "" {
+			endpoints[i].Health = EndpointHealthy
+		}
+	}
+}
+
+// updateEndpointHealth returns the endpoints with the health status of
+// the update applied, the endpoints passed are left unchanged
+func updateEndpointHealth(endpoints []ServiceEndpoint,
+	update []ServiceEndpoint) ([]ServiceEndpoint, error) {
+
+	updated := append([]ServiceEndpoint(nil), endpoints...)
+	for _, u := range update {
+		if err := validateEndpointHealth(u.Health); err != nil {
+			return nil, err
+		}
+		found := false
+		for i := range updated {
+			if updated[i].URI == u.URI {
+				updated[i].Health = u.Health
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("Service endpoint %q is not registered", u.URI)
+		}
+	}
+	defaultEndpointHealth(updated)
+	return updated, nil
+}
+
+// healthyEndpoints returns the service with only its healthy endpoints
+func healthyEndpoints(serv Service) Service {
+	var endpoints []ServiceEndpoint
+	for _, endpoint := range serv.Endpoints {
+		if endpoint.Health != EndpointUnhealthy {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	serv.Endpoints = endpoints
+	return serv
+}
+
+// Limits of service labels
+const (
+	maxServiceLabels         = 32
+	maxServiceLabelKeyLength = 63
+	maxServiceLabelValueSize = 255
+)
+
+// validateServiceLabels checks if the labels are within the limits and
+// their keys consist of letters, digits, '-', '_', '.' and '/'
+func validateServiceLabels(labels map[string]string) error {
+	if len(labels) > maxServiceLabels {
+		return errors.Errorf("Service has more than %d labels", maxServiceLabels)
+	}
+	for key, value := range labels {
+		if key == "" || len(key) > maxServiceLabelKeyLength {
+			return errors.Errorf("Service label key %q must have 1 to %d characters",
+				key, maxServiceLabelKeyLength)
+		}
+		for _, r := range key {
+			if !isServiceLabelKeyRune(r) {
+				return errors.Errorf("Service label key %q contains invalid character %s",
+					key, strconv.QuoteRune(r))
+			}
+		}
+		if len(value) > maxServiceLabelValueSize {
+			return errors.Errorf("Service label %q value exceeds %d bytes", key,
+				maxServiceLabelValueSize)
+		}
+		for _, r := range value {
+			if !unicode.IsPrint(r) {
+				return errors.Errorf("Service label %q value contains invalid character %s",
+					key, strconv.QuoteRune(r))
+			}
+		}
+	}
+	return nil
+}
+
+// isServiceLabelKeyRune checks if a rune is allowed in a service label key
+func isServiceLabelKeyRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '-' || r == '_' || r == '.' || r == '/'
+}
+
+// labelsMatch checks if the service has all the labels of the selector
+func labelsMatch(serv Service, selector map[string]string) bool {
+	for key, value := range selector {
+		if labelValue, ok := serv.Labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// validateNotificationPriority checks if the priority of a notification is
+// one of the known priorities or empty
+func validateNotificationPriority(priority NotificationPriority) error {
+	switch priority {
+	case "", NotificationPriorityLow, NotificationPriorityNormal,
+		NotificationPriorityHigh:
+		return nil
+	}
+	return errors.Errorf("unknown notification priority %q", priority)
+}
+
+// applyNotificationMaxAge moves the deadline of a notification pushed at now
+// to the end of its maximum age, unless the deadline is earlier already
+func applyNotificationMaxAge(notif *NotificationFromProducer, now time.Time) error {
+	if notif.MaxAge < 0 {
+		return errors.Errorf("notification maxAge %d is negative", notif.MaxAge)
+	}
+	if notif.MaxAge == 0 {
+		return nil
+	}
+	deadline := now.Add(time.Duration(notif.MaxAge) * time.Millisecond)
+	if notif.Deadline == nil || deadline.Before(*notif.Deadline) {
+		notif.Deadline = &deadline
+	}
+	return nil
+}
+
+// urnMatches checks if a URN supplied by a client is consistent with the URN
+// derived from its CommonName. Fields left empty by the client are ignored,
+// a namespace pattern is inconsistent.
+func urnMatches(supplied *URN, derived URN) bool {
+	return supplied == nil ||
+		(!isNamespacePattern(supplied.Namespace) && derived.Matches(*supplied))
+}
+
+// registrationAction returns the ServiceMessage action needed to register
+// serv. An empty action is returned if the service is already registered
+// with identical content, so that re-registration does not cause broker churn.
+func registrationAction(commonName string, serv Service, eaaCtx *Context) (string, error) {
+	eaaCtx.serviceInfo.RLock()
+	registered, found := eaaCtx.serviceInfo.m[commonName]
+	eaaCtx.serviceInfo.RUnlock()
+
+	if !found {
+		return serviceActionRegister, nil
+	}
+
+	// Stored services have their invalid notifications dropped
+	if serv.Notifications != nil {
+		serv.Notifications = validServiceNotifications(serv.Notifications)
+	}
+
+	// Marshaling compacts Info, so the comparison doesn't depend on its formatting
+	registeredData, err := json.Marshal(registered)
+	if err != nil {
+		return "", errors.Wrap(err, "Error during Service structure marshaling")
+	}
+	data, err := json.Marshal(serv)
+	if err != nil {
+		return "", errors.Wrap(err, "Error during Service structure marshaling")
+	}
+
+	if bytes.Equal(registeredData, data) {
+		return "", nil
+	}
+	return serviceActionUpdate, nil
+}
+
 func isServicePresent(commonName string, eaaCtx *Context) bool {
-	_, serviceFound := eaaCtx.serviceInfo.m[commonName]
+	_, serviceFound := eaaCtx.serviceInfo.m[serviceKey(commonName)]
 	return serviceFound
 }
 
 func addService(commonName string, serv Service, eaaCtx *Context) error {
+	// The store is flushed once the service map is unlocked
+	defer flushServices(eaaCtx)
 	eaaCtx.serviceInfo.Lock()
 	defer eaaCtx.serviceInfo.Unlock()
 
@@ -50,12 +281,126 @@ func addService(commonName string, serv Service, eaaCtx *Context) error {
 	}
 
 	eaaCtx.serviceInfo.m[commonName] = serv
+	eaaCtx.serviceInfo.renewed[commonName] = time.Now()
+	storeService(commonName, eaaCtx)
 	log.Infof("Successfully added '%v' service", commonName)
 
 	return nil
 }
 
+// applyServiceUpdate returns the service with the fields of the update
+// applied, the service itself is left unchanged
+func applyServiceUpdate(serv Service, update ServiceUpdate) Service {
+	if update.Description != nil {
+		serv.Description = *update.Description
+	}
+	if update.EndpointURI != nil {
+		serv.EndpointURI = *update.EndpointURI
+	}
+	if update.Endpoints != nil {
+		serv.Endpoints = append([]ServiceEndpoint(nil), *update.Endpoints...)
+	}
+	if update.Info != nil {
+		serv.Info = update.Info
+	}
+	if update.Labels != nil {
+		labels := make(map[string]string, len(serv.Labels)+len(update.Labels))
+		for key, value := range serv.Labels {
+			labels[key] = value
+		}
+		for key, value := range update.Labels {
+			if value == nil {
+				delete(labels, key)
+			} else {
+				labels[key] = *value
+			}
+		}
+		if len(labels) == 0 {
+			labels = nil
+		}
+		serv.Labels = labels
+	}
+	return serv
+}
+
+// updateService merges an update into the registered service. The service
+// is read and written under the lock, so that no concurrent change is lost.
+// The update is dropped if the merged service is invalid, e.g. over
+// maxServiceLabels, as it may be merged into a service other than the one
+// it was validated against by the requesting EAA instance.
+func updateService(commonName string, update ServiceUpdate, eaaCtx *Context) error {
+	defer flushServices(eaaCtx)
+	eaaCtx.serviceInfo.Lock()
+	defer eaaCtx.serviceInfo.Unlock()
+
+	if eaaCtx.serviceInfo.m == nil {
+		return errors.New(
+			"EAA context is not initialized. Call Init() function first")
+	}
+
+	serv, found := eaaCtx.serviceInfo.m[commonName]
+	if !found {
+		return errors.Errorf("Service '%v' is not registered", commonName)
+	}
+
+	updated := applyServiceUpdate(serv, update)
+	if err := validateService(&updated); err != nil {
+		return errors.Wrapf(err, "Update of service '%v' dropped", commonName)
+	}
+
+	eaaCtx.serviceInfo.m[commonName] = updated
+	eaaCtx.serviceInfo.renewed[commonName] = time.Now()
+	storeService(commonName, eaaCtx)
+	log.Infof("Successfully updated '%v' service", commonName)
+
+	return nil
+}
+
+// serviceUpdateLocks serializes the updates of a service requested on this
+// EAA instance, so that every update is validated against the service
+// the previous one left
+type serviceUpdateLocks struct {
+	sync.Mutex
+	m map[string]*serviceUpdateLock
+}
+
+// serviceUpdateLock is the lock of a service and the number of updates
+// holding or waiting for it
+type serviceUpdateLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the updates of a service and returns the function unlocking
+// them
+func (l *serviceUpdateLocks) lock(commonName string) func() {
+	l.Lock()
+	if l.m == nil {
+		l.m = make(map[string]*serviceUpdateLock)
+	}
+	serviceLock, ok := l.m[commonName]
+	if !ok {
+		serviceLock = &serviceUpdateLock{}
+		l.m[commonName] = serviceLock
+	}
+	serviceLock.refs++
+	l.Unlock()
+
+	serviceLock.Lock()
+	return func() {
+		serviceLock.Unlock()
+
+		l.Lock()
+		serviceLock.refs--
+		if serviceLock.refs == 0 {
+			delete(l.m, commonName)
+		}
+		l.Unlock()
+	}
+}
+
 func removeService(commonName string, eaaCtx *Context) error {
+	defer flushServices(eaaCtx)
 	eaaCtx.serviceInfo.Lock()
 	defer eaaCtx.serviceInfo.Unlock()
 
@@ -66,6 +411,13 @@ func removeService(commonName string, eaaCtx *Context) error {
 	servicefound := isServicePresent(commonName, eaaCtx)
 	if servicefound {
 		delete(eaaCtx.serviceInfo.m, commonName)
+		delete(eaaCtx.serviceInfo.renewed, commonName)
+		delete(eaaCtx.serviceInfo.owners, commonName)
+		eaaCtx.notifLimiter.remove(commonName)
+		if err := eaaCtx.servicesStore().removeService(commonName); err != nil {
+			log.Errf("Failed to remove the service '%v' from the store: %s",
+				commonName, err.Error())
+		}
 		log.Infof("Successfully removed '%v' service", commonName)
 		return nil
 	}
@@ -73,8 +425,69 @@ func removeService(commonName string, eaaCtx *Context) error {
 	return errors.New(http.StatusText(http.StatusNotFound))
 }
 
+// serviceTTL returns the time to live of the service, 0 if it doesn't expire
+func serviceTTL(serv Service, eaaCtx *Context) time.Duration {
+	if serv.TTL != 0 {
+		return time.Duration(serv.TTL) * time.Second
+	}
+	return eaaCtx.config().DefaultServiceTTL.Duration
+}
+
+// expiredServices returns Common Names of the services that were not
+// renewed within their TTL
+func expiredServices(eaaCtx *Context) []string {
+	eaaCtx.serviceInfo.RLock()
+	defer eaaCtx.serviceInfo.RUnlock()
+
+	var expired []string
+	now := time.Now()
+
+	for commonName, serv := range eaaCtx.serviceInfo.m {
+		ttl := serviceTTL(serv, eaaCtx)
+		if ttl <= 0 {
+			continue
+		}
+		if now.Sub(eaaCtx.serviceInfo.renewed[commonName]) > ttl {
+			expired = append(expired, commonName)
+		}
+	}
+
+	return expired
+}
+
+// reapExpiredServices publishes a deregistration message for every service
+// that has not been renewed within its TTL
+func reapExpiredServices(eaaCtx *Context) {
+	for _, commonName := range expiredServices(eaaCtx) {
+		URN, err := CommonNameStringToURN(commonName)
+		if err != nil {
+			log.Errf("Error during URN generation for expired service '%v': %s",
+				commonName, err.Error())
+			continue
+		}
+
+		// The expired service is deregistered on behalf of its owner
+		eaaCtx.serviceInfo.RLock()
+		owner := eaaCtx.serviceInfo.owners[commonName]
+		eaaCtx.serviceInfo.RUnlock()
+
+		svcMsg := ServiceMessage{Svc: &Service{URN: &URN}, Action: serviceActionDeregister,
+			Owner: owner}
+		ctx, cancel := withPublishTimeout(context.Background(), eaaCtx)
+		err = publishServiceMessage(ctx, commonName, svcMsg, eaaCtx)
+		cancel()
+		if err != nil {
+			log.Errf("Failed to deregister expired service '%v': %s", commonName,
+				err.Error())
+			continue
+		}
+
+		log.Infof("Service '%v' expired, deregistration requested", commonName)
+	}
+}
+
 func getUniqueSubsList(nsList []string, servList []string) []string {
-	fullList := nsList
+	fullList := append([]string(nil), nsList...)
 
 	for _, subID := range servList {
 		isNamespaceSubscribed := false
@@ -92,36 +505,291 @@ func getUniqueSubsList(nsList []string, servList []string) []string {
 	return fullList
 }
 
-func sendNotificationToAllSubscribers(commonName string, notif *NotificationFromProducer,
-	eaaCtx *Context) error {
+// getWildcardNamespaceSubscribers returns consumers subscribed to the
+// notification with a namespace pattern matching the namespace of the key
+func getWildcardNamespaceSubscribers(key UniqueNotif, eaaCtx *Context) []string {
+	var subscriberList []string
+
+	for subKey, conSub := range eaaCtx.subscriptionInfo.m {
+		if subKey.notifName != key.notifName ||
+			!notificationVersionsCompatible(subKey.notifVersion, key.notifVersion) ||
+			!isNamespacePattern(subKey.namespace) ||
+			!namespaceMatches(subKey.namespace, key.namespace) {
+			continue
+		}
+		subscriberList = getUniqueSubsList(subscriberList,
+			getAllowedSubscribers(conSub.namespaceSubscriptions, key.namespace, eaaCtx))
+	}
+
+	return subscriberList
+}
+
+// getNotificationSubscribers returns a list of consumers that should receive
+// the notification sent by a producer with the given service ID. Exact
+// namespace and service subscriptions take precedence over wildcard namespace
+// subscriptions, which take precedence over name pattern subscriptions, and
+// every consumer is present on the list only once.
+// Subscription info has to be locked by the caller.
+func getNotificationSubscribers(key UniqueNotif, serviceID string,
+	eaaCtx *Context) []string {
 
 	var subscriberList []string
 
+	if namespaceSubsInfo, ok := eaaCtx.subscriptionInfo.m[key]; ok {
+		subscriberList = getUniqueSubsList(
+			namespaceSubsInfo.namespaceSubscriptions,
+			namespaceSubsInfo.serviceSubscriptions[serviceID])
+	}
+
+	subscriberList = getUniqueSubsList(subscriberList,
+		getWildcardNamespaceSubscribers(key, eaaCtx))
+	return getUniqueSubsList(subscriberList,
+		getNamePatternSubscribers(key, serviceID, eaaCtx))
+}
+
+// getServiceSubscribers returns the consumers subscribed to any of
+// the notifications of the registered service, false is returned if
+// the service isn't registered
+func getServiceSubscribers(commonName string, eaaCtx *Context) ([]string, bool) {
+	eaaCtx.serviceInfo.RLock()
+	serv, ok := eaaCtx.serviceInfo.m[serviceKey(commonName)]
+	eaaCtx.serviceInfo.RUnlock()
+	if !ok || serv.URN == nil {
+		return nil, false
+	}
+
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	subscribers := []string{}
+	for _, notif := range serv.Notifications {
+		key := UniqueNotif{
+			namespace:    serv.URN.Namespace,
+			notifName:    notif.Name,
+			notifVersion: notif.Version,
+		}
+		subscribers = getUniqueSubsList(subscribers,
+			getNotificationSubscribers(key, serv.URN.ID, eaaCtx))
+	}
+	sort.Strings(subscribers)
+
+	return subscribers, true
+}
+
+// hasNotificationSubscribers checks if any consumer is subscribed to
+// the notification of the producer
+func hasNotificationSubscribers(prodURN URN, notif *NotificationFromProducer,
+	eaaCtx *Context) bool {
+
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	key := UniqueNotif{
+		namespace:    prodURN.Namespace,
+		notifName:    notif.Name,
+		notifVersion: notif.Version,
+	}
+	return len(getNotificationSubscribers(key, prodURN.ID, eaaCtx)) > 0
+}
+
+// subscriberAcceptsNotification checks if the consumer has at least one
+// subscription to the notification without an attribute filter or with
+// a filter matching the notification attributes.
+// Subscription info has to be locked by the caller.
+func subscriberAcceptsNotification(key UniqueNotif, serviceID string,
+	subID string, attrs map[string]interface{}, eaaCtx *Context) bool {
+
+	_, _, accepted := acceptingSubscription(key, serviceID, subID, attrs, eaaCtx)
+	return accepted
+}
+
+// acceptingSubscription returns the most specific subscription of
+// the consumer accepting the notification, which is its service
+// subscription, its namespace subscription, a subscription to a matching
+// namespace pattern or a subscription to a matching name pattern, in this
+// order. The transform and the delivery guarantee of that subscription
+// apply to the notification. Subscription info has to be locked by
+// the caller.
+func acceptingSubscription(key UniqueNotif, serviceID string, subID string,
+	attrs map[string]interface{}, eaaCtx *Context) (*ConsumerSubscription, subscriberKey, bool) {
+
+	if conSub, ok := eaaCtx.subscriptionInfo.m[key]; ok {
+		if getServiceSubscriptionIndex(key, serviceID, subID, eaaCtx) != -1 &&
+			filterMatches(attrs, conSub.getFilter(serviceID, subID)) {
+			return conSub, subscriberKey{serviceID: serviceID, subID: subID}, true
+		}
+		if getNamespaceSubscriptionIndex(key, subID, eaaCtx) != -1 &&
+			filterMatches(attrs, conSub.getFilter("", subID)) {
+			return conSub, subscriberKey{subID: subID}, true
+		}
+	}
+
+	for subKey, conSub := range eaaCtx.subscriptionInfo.m {
+		if subKey.notifName != key.notifName ||
+			!notificationVersionsCompatible(subKey.notifVersion, key.notifVersion) ||
+			!isNamespacePattern(subKey.namespace) ||
+			!namespaceMatches(subKey.namespace, key.namespace) {
+			continue
+		}
+		if getNamespaceSubscriptionIndex(subKey, subID, eaaCtx) != -1 &&
+			filterMatches(attrs, conSub.getFilter("", subID)) {
+			return conSub, subscriberKey{subID: subID}, true
+		}
+	}
+
+	return acceptingNamePatternSubscription(key, serviceID, subID, attrs, eaaCtx)
+}
+
+// acceptingNamePatternSubscription returns the subscription of the consumer
+// to a name pattern accepting the notification. Service subscriptions take
+// precedence over namespace ones, which take precedence over subscriptions
+// to a namespace pattern. Subscription info has to be locked by the caller.
+func acceptingNamePatternSubscription(key UniqueNotif, serviceID string, subID string,
+	attrs map[string]interface{}, eaaCtx *Context) (*ConsumerSubscription, subscriberKey, bool) {
+
+	var (
+		accepting *ConsumerSubscription
+		acceptKey subscriberKey
+		rank      int
+	)
+	for subKey, conSub := range eaaCtx.subscriptionInfo.m {
+		if !isNotificationNamePattern(subKey.notifName) ||
+			!notificationNameMatches(subKey.notifName, key.notifName) ||
+			!notificationVersionsCompatible(subKey.notifVersion, key.notifVersion) {
+			continue
+		}
+		switch {
+		case rank < 3 && subKey.namespace == key.namespace &&
+			getServiceSubscriptionIndex(subKey, serviceID, subID, eaaCtx) != -1 &&
+			filterMatches(attrs, conSub.getFilter(serviceID, subID)):
+			accepting, rank = conSub, 3
+			acceptKey = subscriberKey{serviceID: serviceID, subID: subID}
+		case rank < 2 && subKey.namespace == key.namespace &&
+			getNamespaceSubscriptionIndex(subKey, subID, eaaCtx) != -1 &&
+			filterMatches(attrs, conSub.getFilter("", subID)):
+			accepting, rank = conSub, 2
+			acceptKey = subscriberKey{subID: subID}
+		case rank < 1 && isNamespacePattern(subKey.namespace) &&
+			namespaceMatches(subKey.namespace, key.namespace) &&
+			getNamespaceSubscriptionIndex(subKey, subID, eaaCtx) != -1 &&
+			filterMatches(attrs, conSub.getFilter("", subID)):
+			accepting, rank = conSub, 1
+			acceptKey = subscriberKey{subID: subID}
+		}
+	}
+
+	return accepting, acceptKey, rank > 0
+}
+
+// matchSubscribers returns the consumers subscribed to the notification of
+// the service whose subscriptions accept the notification attributes, and
+// the ones whose attribute filters reject them. The delivery and the dry run
+// of MatchNotification share it so that they can't drift.
+// Subscription info has to be locked by the caller.
+func matchSubscribers(key UniqueNotif, serviceID string, attrs map[string]interface{},
+	eaaCtx *Context) (recipients []string, filteredOut []string) {
+
+	for _, subID := range getNotificationSubscribers(key, serviceID, eaaCtx) {
+		if subscriberAcceptsNotification(key, serviceID, subID, attrs, eaaCtx) {
+			recipients = append(recipients, subID)
+		} else {
+			filteredOut = append(filteredOut, subID)
+		}
+	}
+	return recipients, filteredOut
+}
+
+// matchNotification matches a hypothetical notification of a registered
+// producer against the subscriptions like deliverNotification does, without
+// delivering it. Duplicate and stale notifications aren't considered.
+func matchNotification(query NotificationMatchQuery, eaaCtx *Context) NotificationMatch {
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	key := UniqueNotif{
+		namespace:    query.URN.Namespace,
+		notifName:    query.Name,
+		notifVersion: query.Version,
+	}
+	match := NotificationMatch{Matched: []string{}, FilteredOut: []string{}}
+	recipients, filteredOut := matchSubscribers(key, query.URN.ID, query.Attributes, eaaCtx)
+	match.Matched = append(match.Matched, recipients...)
+	match.FilteredOut = append(match.FilteredOut, filteredOut...)
+	sort.Strings(match.Matched)
+	sort.Strings(match.FilteredOut)
+	return match
+}
+
+// sendNotificationToAllSubscribers sends a notification received from
+// the Message Broker to the subscribers connected to this EAA instance
+func sendNotificationToAllSubscribers(commonName string, notif *NotificationFromProducer,
+	correlationID string, eaaCtx *Context) (DeliverySummary, error) {
+
 	eaaCtx.serviceInfo.RLock()
 	defer eaaCtx.serviceInfo.RUnlock()
 
 	if eaaCtx.serviceInfo.m == nil {
-		return errors.New("EAA context is not initialized")
+		return DeliverySummary{}, errors.New("EAA context is not initialized")
 	}
 
 	prodURN, err := CommonNameStringToURN(commonName)
 	if err != nil {
-		return err
+		return DeliverySummary{}, err
 	}
 
-	msgPayload, err := json.Marshal(NotificationToConsumer{
-		Name:    notif.Name,
-		Version: notif.Version,
-		Payload: notif.Payload,
-		URN:     prodURN,
-	})
-	if err != nil {
-		return errors.Wrap(err, "Failed to marshal norification JSON")
+	if !isServicePresent(prodURN.String(), eaaCtx) {
+		return DeliverySummary{}, errors.New("Producer is not registered")
+	}
+
+	if eaaCtx.notifDedup.isDuplicate(hashNotification(prodURN, notif),
+		eaaCtx.config().NotificationDedupWindow.Duration, time.Now()) {
+		log.Infof("Duplicate notification %s:%s from %s suppressed, correlation ID %s",
+			notif.Name, notif.Version, commonName, correlationID)
+		return DeliverySummary{}, nil
 	}
 
-	_, serviceFound := eaaCtx.serviceInfo.m[commonName]
-	if !serviceFound {
-		return errors.New("Producer is not registered")
+	summary, err := deliverNotification(prodURN, notif, correlationID, eaaCtx)
+	if err == nil && eaaCtx.deadLetters.undeliveredReason(summary) != "" {
+		// Captured without holding the service info, the sink may have to
+		// wait for the Message Broker
+		go eaaCtx.deadLetters.capture(prodURN, notif, correlationID, summary, eaaCtx)
+	}
+	return summary, err
+}
+
+// deliverNotification sends a notification of the producer to all its
+// subscribers connected to this EAA instance
+func deliverNotification(prodURN URN, notif *NotificationFromProducer,
+	correlationID string, eaaCtx *Context) (DeliverySummary, error) {
+
+	attrs := getNotificationAttributes(notif.Payload)
+	var deadline time.Time
+	if notif.Deadline != nil {
+		deadline = *notif.Deadline
+	}
+	// Notifications not received from a producer by the Message Broker,
+	// e.g. the discovery events, are stamped on their delivery
+	receivedAt := notif.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = eaaCtx.receiveClock.stamp(time.Now())
+	}
+	seq := eaaCtx.replayBuffers.nextSequence()
+	toConsumer := NotificationToConsumer{
+		Name:          notif.Name,
+		Version:       notif.Version,
+		Payload:       notif.Payload,
+		URN:           prodURN,
+		Sequence:      seq,
+		Priority:      notif.Priority,
+		CorrelationID: correlationID,
+		Signature:     notif.Signature,
+		ReceivedAt:    &receivedAt,
+		ProducerTimestamp: producerTimestamp(attrs,
+			eaaCtx.config().NotificationTimestampField),
+	}
+	msgPayload, err := json.Marshal(toConsumer)
+	if err != nil {
+		return DeliverySummary{}, errors.Wrap(err, "Failed to marshal norification JSON")
 	}
 
 	namespaceKey := UniqueNotif{
@@ -133,59 +801,248 @@ func sendNotificationToAllSubscribers(commonName string, notif *NotificationFrom
 	eaaCtx.subscriptionInfo.RLock()
 	defer eaaCtx.subscriptionInfo.RUnlock()
 
-	namespaceSubsInfo, ok := eaaCtx.subscriptionInfo.m[namespaceKey]
-	if !ok {
+	recipients, filteredOut := matchSubscribers(namespaceKey, prodURN.ID, attrs, eaaCtx)
+	if eaaCtx.config().VersionMismatchNotices {
+		mismatched := versionMismatchedSubscribers(namespaceKey, prodURN.ID,
+			append(recipients, filteredOut...), eaaCtx)
+		sendVersionMismatchNotices(prodURN, notif, mismatched, correlationID, eaaCtx)
+	}
+	if len(recipients) == 0 && len(filteredOut) == 0 {
 		log.Infof("No subscription to notification %v", namespaceKey)
-		return nil
+		return DeliverySummary{}, nil
+	}
+
+	for _, subID := range filteredOut {
+		counters := eaaCtx.subscriptionStats.counters(subID, namespaceKey)
+		atomic.AddUint64(&counters.matched, 1)
+		atomic.AddUint64(&counters.filtered, 1)
+		log.Debugf("Notification %v filtered out for Subscriber ID: %s",
+			namespaceKey, subID)
+	}
+	// The notification is retained for a replay even if the filter of
+	// the consumer connection leaves it out, a later connection may want it.
+	// Subscribers whose subscription has a transform receive and retain
+	// their own payload, the ones of at-least-once subscriptions, or of any
+	// subscription with NotificationAckRequired, are kept until acknowledged
+	// and the ones of subscriptions with an aggregation window are buffered
+	// for a batch.
+	var (
+		accepted        []string
+		untransformable int
+		aggregated      int
+		payloads        = make(map[string][]byte)
+	)
+	for _, subID := range recipients {
+		counters := eaaCtx.subscriptionStats.counters(subID, namespaceKey)
+		atomic.AddUint64(&counters.matched, 1)
+		payload := msgPayload
+		conSub, subKey, _ := acceptingSubscription(namespaceKey, prodURN.ID, subID, attrs,
+			eaaCtx)
+		if transform := conSub.getTransform(subKey.serviceID, subKey.subID); transform != nil {
+			if payload, err = transformNotification(toConsumer, transform); err != nil {
+				atomic.AddUint64(&counters.dropped, 1)
+				untransformable++
+				log.Warningf("Couldn't transform notification %s for Subscriber ID: %s : %v",
+					correlationID, subID, err)
+				continue
+			}
+			payloads[subID] = payload
+		}
+		entry := replayEntry{seq: seq, key: namespaceKey, payload: payload, deadline: deadline}
+		eaaCtx.replayBuffers.record(subID,
+			eaaCtx.config().NotificationReplayBufferSize, entry)
+		if !connectionAccepts(subID, namespaceKey, eaaCtx) {
+			atomic.AddUint64(&counters.filtered, 1)
+			log.Debugf("Notification %v filtered out by the connection of Subscriber ID: %s",
+				namespaceKey, subID)
+			continue
+		}
+		atLeastOnce := conSub.getQoS(subKey.serviceID, subKey.subID) ==
+			NotificationQoSAtLeastOnce
+		if atLeastOnce || eaaCtx.config().NotificationAckRequired {
+			expectNotificationAck(subID, entry, notif.Priority, !atLeastOnce, eaaCtx)
+		}
+		if window := conSub.getAggregationWindow(subKey.serviceID, subKey.subID); window > 0 {
+			aggregateNotification(aggregationKey{subscription: conSub, subscriberKey: subKey},
+				aggregatedNotification{key: namespaceKey, payload: payload, deadline: deadline},
+				window, eaaCtx)
+			aggregated++
+			continue
+		}
+		accepted = append(accepted, subID)
 	}
 
-	srvSubsList, ok := namespaceSubsInfo.serviceSubscriptions[prodURN.ID]
+	failed := sendNotificationToSubscribers(accepted, &namespaceKey, msgPayload, payloads,
+		notif.Priority, deadline, correlationID, eaaCtx)
+	for _, subID := range accepted {
+		counters := eaaCtx.subscriptionStats.counters(subID, namespaceKey)
+		if failed[subID] {
+			atomic.AddUint64(&counters.dropped, 1)
+		} else {
+			atomic.AddUint64(&counters.delivered, 1)
+		}
+	}
 
-	if !ok {
-		subscriberList = namespaceSubsInfo.namespaceSubscriptions
-	} else {
-		subscriberList = getUniqueSubsList(
-			namespaceSubsInfo.namespaceSubscriptions, srvSubsList)
+	summary := DeliverySummary{Subscribers: len(accepted) + untransformable + aggregated,
+		Failed: len(failed) + untransformable, Aggregated: aggregated}
+	summary.Delivered = summary.Subscribers - summary.Failed - summary.Aggregated
+	if summary.Delivered > 0 {
+		notificationsDeliveredTotal.WithLabelValues(prodURN.Namespace).Add(
+			float64(summary.Delivered))
 	}
+	return summary, nil
+}
 
-	for _, subID := range subscriberList {
-		if err = sendNotificationToSubscriber(subID, msgPayload,
-			eaaCtx); err != nil {
-			log.Warningf("Couldn't send notification to Subscriber ID: %s : %v",
-				subID, err)
+// sendNotificationToSubscribers writes the notification to the websockets of
+// the subscribers, the ones whose filter accepts the key unless it's nil,
+// by up to NotificationWorkers goroutines and returns the subscribers whose
+// write failed. Subscribers with a payload of their own in payloads receive
+// it instead of msgPayload. It returns once all the writes are done, so that
+// notifications to the same consumer stay in order.
+func sendNotificationToSubscribers(subscriberList []string, key *UniqueNotif,
+	msgPayload []byte, payloads map[string][]byte, priority NotificationPriority,
+	deadline time.Time, correlationID string, eaaCtx *Context) map[string]bool {
+
+	var failedLock sync.Mutex
+	failed := make(map[string]bool)
+	send := func(subID string) {
+		payload, ok := payloads[subID]
+		if !ok {
+			payload = msgPayload
 		}
+		err := sendNotificationToSubscriber(subID, key, payload, priority, deadline,
+			eaaCtx)
+		if err != nil {
+			log.Warningf("Couldn't send notification %s to Subscriber ID: %s : %v",
+				correlationID, subID, err)
+			failedLock.Lock()
+			failed[subID] = true
+			failedLock.Unlock()
+			return
+		}
+		log.Debugf("Notification %s sent to Subscriber ID: %s", correlationID, subID)
 	}
-	return nil
+
+	workers := eaaCtx.config().NotificationWorkers
+	if workers > len(subscriberList) {
+		workers = len(subscriberList)
+	}
+	if workers <= 1 {
+		for _, subID := range subscriberList {
+			send(subID)
+		}
+		return failed
+	}
+
+	var wg sync.WaitGroup
+	subscribers := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for subID := range subscribers {
+				send(subID)
+			}
+		}()
+	}
+	for _, subID := range subscriberList {
+		subscribers <- subID
+	}
+	close(subscribers)
+	wg.Wait()
+
+	return failed
 }
 
-func sendNotificationToSubscriber(subID string, msgPayload []byte,
-	eaaCtx *Context) error {
+// sendNotificationToSubscriber writes the notification to the webhook or
+// the websockets of the subscriber whose filter accepts the key, to every
+// websocket if the key is nil. A queued one delivers it by its priority.
+// A notification whose deadline passes before it's written is dropped, as is
+// one not fitting a full send queue, which fails the write with
+// errNotificationDropped. The write fails only if it failed for every
+// websocket.
+func sendNotificationToSubscriber(subID string, key *UniqueNotif, msgPayload []byte,
+	priority NotificationPriority, deadline time.Time, eaaCtx *Context) error {
+
+	// Consumers with a webhook don't receive notifications by websockets
+	if conn, ok := eaaCtx.webhooks.get(subID); ok {
+		return conn.writePriorityMessage(msgPayload, priority, deadline)
+	}
 
 	eaaCtx.consumerConnections.RLock()
 
-	possibleConnection, connectionFound := eaaCtx.consumerConnections.m[subID]
+	consumerConns := eaaCtx.consumerConnections.m[subID]
 	log.Infof("Looking for websocket: %s from %v", subID,
 		eaaCtx.consumerConnections.m)
-	if connectionFound {
-		if possibleConnection.connection == nil {
-			// Unlock consumer connections to allow the other thread to update it
-			eaaCtx.consumerConnections.RUnlock()
+	if isConnectionPending(consumerConns) {
+		// Unlock consumer connections to allow the other thread to update it
+		eaaCtx.consumerConnections.RUnlock()
 
-			if err := waitForConnectionAssigned(subID, eaaCtx); err != nil {
-				return errors.Wrap(err, "websocket isn't properly created")
-			}
-			eaaCtx.consumerConnections.RLock()
+		if err := waitForConnectionAssigned(subID, eaaCtx); err != nil {
+			return errors.Wrap(err, "websocket isn't properly created")
 		}
-		messageType := websocket.TextMessage
-		conn := eaaCtx.consumerConnections.m[subID].connection
-		err := conn.WriteMessage(messageType, msgPayload)
-		eaaCtx.consumerConnections.RUnlock()
-		return err
+		eaaCtx.consumerConnections.RLock()
+		consumerConns = eaaCtx.consumerConnections.m[subID]
 	}
+	defer eaaCtx.consumerConnections.RUnlock()
 
-	eaaCtx.consumerConnections.RUnlock()
-	return errors.New("no websocket connection created " +
+	written := false
+	err := errors.New("no websocket connection created " +
 		"by GET /notifications API")
+	for _, consumerConn := range consumerConns {
+		if consumerConn.connection == nil ||
+			(key != nil && !consumerConn.filter.accepts(*key)) {
+			continue
+		}
+		if writeErr := writeNotification(consumerConn.connection, msgPayload, priority,
+			deadline, eaaCtx); writeErr != nil {
+			err = writeErr
+		} else {
+			written = true
+		}
+	}
+	if written {
+		return nil
+	}
+	return err
+}
+
+// writeNotification writes the notification to the consumer connection,
+// a queued one delivers it by its priority
+func writeNotification(conn notificationConn, msgPayload []byte,
+	priority NotificationPriority, deadline time.Time, eaaCtx *Context) error {
+
+	// A slow consumer fails the write instead of blocking the delivery
+	if wsConn, ok := conn.(interface {
+		SetWriteDeadline(t time.Time) error
+	}); ok {
+		timeout := eaaCtx.config().WebSocketWriteTimeout.Duration
+		if timeout <= 0 {
+			timeout = defaultWebSocketWriteTimeout
+		}
+		if err := wsConn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+	if prioConn, ok := conn.(priorityConn); ok {
+		return prioConn.writePriorityMessage(msgPayload, priority, deadline)
+	}
+	if isStale(deadline, time.Now()) {
+		notificationsDroppedStaleTotal.Inc()
+		return errors.Wrap(errNotificationDropped, "deadline passed")
+	}
+	return conn.WriteMessage(websocket.TextMessage, msgPayload)
+}
+
+// isConnectionPending checks if a connection of the consumer is still being
+// established
+func isConnectionPending(consumerConns []ConsumerConnection) bool {
+	for _, consumerConn := range consumerConns {
+		if consumerConn.connection == nil {
+			return true
+		}
+	}
+	return false
 }
 
 // waitForConnectionAssigned waits a second until a proper websocket connection
@@ -196,7 +1053,7 @@ func waitForConnectionAssigned(subID string, eaaCtx *Context) error {
 	deadline := time.Now().Add(1 * time.Second)
 	for {
 		eaaCtx.consumerConnections.RLock()
-		if eaaCtx.consumerConnections.m[subID].connection != nil {
+		if !isConnectionPending(eaaCtx.consumerConnections.m[subID]) {
 			eaaCtx.consumerConnections.RUnlock()
 			return nil
 		}
@@ -4,11 +4,20 @@
 package eaa
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
 	"time"
 
+	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gorilla/websocket"
 
 	g "github.com/onsi/ginkgo"
@@ -31,9 +40,9 @@ var _ = g.Describe("api_procuder internal errors", func() {
 		eaaContext.serviceInfo.m = make(map[string]Service)
 		eaaContext.serviceInfo.m[serviceName] = Service{}
 
-		eaaContext.consumerConnections = consumerConns{m: make(map[string]ConsumerConnection)}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
 
-		cc := ConsumerConnection{&websocket.Conn{}}
+		cc := []ConsumerConnection{{connection: &websocket.Conn{}}}
 		eaaContext.consumerConnections.m["aa"] = cc
 		eaaContext.consumerConnections.m["bb"] = cc
 		eaaContext.consumerConnections.m["cc"] = cc
@@ -97,7 +106,7 @@ var _ = g.Describe("api_procuder internal errors", func() {
 				cs := &ConsumerSubscription{
 					namespaceSubscriptions: SubscriberIds{"aa", "bb"},
 					serviceSubscriptions:   make(map[string]SubscriberIds),
-					notification:           NotificationDescriptor{"name", "1.0", "description"},
+					notification:           NotificationDescriptor{Name: "name", Version: "1.0", Description: "description"},
 				}
 
 				cs.serviceSubscriptions[urn.ID] = SubscriberIds{"bb", "cc"}
@@ -123,10 +132,12 @@ var _ = g.Describe("api_procuder internal errors", func() {
 
 					Expect(e).NotTo(HaveOccurred())
 
-					e = sendNotificationToAllSubscribers(prod, n, eaaContext)
+					var summary DeliverySummary
+					summary, e = sendNotificationToAllSubscribers(prod, n, "", eaaContext)
 
 					Expect(e).NotTo(HaveOccurred())
 					Expect(calls).To(Equal(3))
+					Expect(summary).To(Equal(DeliverySummary{Subscribers: 3, Delivered: 3}))
 				})
 			})
 
@@ -134,7 +145,7 @@ var _ = g.Describe("api_procuder internal errors", func() {
 				g.It("should fail", func() {
 					eaaContext.serviceInfo.m = nil
 
-					e := sendNotificationToAllSubscribers(prod, n, eaaContext)
+					_, e := sendNotificationToAllSubscribers(prod, n, "", eaaContext)
 
 					Expect(e).To(HaveOccurred())
 				})
@@ -142,7 +153,7 @@ var _ = g.Describe("api_procuder internal errors", func() {
 
 			g.When("common name is broken", func() {
 				g.It("should fail", func() {
-					e := sendNotificationToAllSubscribers("bad common name", n, eaaContext)
+					_, e := sendNotificationToAllSubscribers("bad common name", n, "", eaaContext)
 
 					Expect(e).To(HaveOccurred())
 				})
@@ -158,7 +169,7 @@ var _ = g.Describe("api_procuder internal errors", func() {
 
 					Expect(e).NotTo(HaveOccurred())
 
-					e = sendNotificationToAllSubscribers(prod, n, eaaContext)
+					_, e = sendNotificationToAllSubscribers(prod, n, "", eaaContext)
 
 					Expect(e).To(HaveOccurred())
 				})
@@ -169,7 +180,7 @@ var _ = g.Describe("api_procuder internal errors", func() {
 					// remove the service/producer
 					eaaContext.serviceInfo.m = make(map[string]Service)
 
-					e := sendNotificationToAllSubscribers(prod, n, eaaContext)
+					_, e := sendNotificationToAllSubscribers(prod, n, "", eaaContext)
 
 					Expect(e).To(HaveOccurred())
 				})
@@ -180,7 +191,7 @@ var _ = g.Describe("api_procuder internal errors", func() {
 					// clear subscriptions
 					eaaContext.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
 
-					e := sendNotificationToAllSubscribers(prod, n, eaaContext)
+					_, e := sendNotificationToAllSubscribers(prod, n, "", eaaContext)
 
 					Expect(e).NotTo(HaveOccurred())
 				})
@@ -188,12 +199,186 @@ var _ = g.Describe("api_procuder internal errors", func() {
 		})
 	})
 
+	g.Describe("getNotificationSubscribers", func() {
+		notif := NotificationDescriptor{Name: "name", Version: "1.0"}
+		key := UniqueNotif{"sensors-floor-1", "name", "1.0"}
+
+		addSubscription := func(namespace string, nsSubs SubscriberIds,
+			srvSubs SubscriberIds) {
+			cs := &ConsumerSubscription{
+				namespaceSubscriptions: nsSubs,
+				serviceSubscriptions:   map[string]SubscriberIds{"prodID": srvSubs},
+				notification:           notif,
+			}
+			eaaContext.subscriptionInfo.m[UniqueNotif{namespace, "name", "1.0"}] = cs
+		}
+
+		g.When("there are only wildcard subscriptions", func() {
+			g.It("should return subscribers of all matching patterns once", func() {
+				addSubscription("sensors-floor-*", SubscriberIds{"aa", "bb"}, nil)
+				addSubscription("sensors-*", SubscriberIds{"bb", "cc"}, nil)
+				addSubscription("sensors-roof-*", SubscriberIds{"dd"}, nil)
+
+				subs := getNotificationSubscribers(key, "prodID", eaaContext)
+
+				Expect(subs).To(ConsistOf("aa", "bb", "cc"))
+			})
+		})
+
+		g.When("wildcard and exact subscriptions overlap", func() {
+			g.It("should notify every consumer only once", func() {
+				addSubscription("sensors-floor-1", SubscriberIds{"aa"}, SubscriberIds{"bb"})
+				addSubscription("sensors-floor-?", SubscriberIds{"aa", "bb", "cc"}, nil)
+
+				subs := getNotificationSubscribers(key, "prodID", eaaContext)
+
+				Expect(subs).To(ConsistOf("aa", "bb", "cc"))
+			})
+
+			g.It("should put exact subscribers first", func() {
+				addSubscription("sensors-floor-1", SubscriberIds{"bb"}, nil)
+				addSubscription("sensors-floor-*", SubscriberIds{"aa", "bb"}, nil)
+
+				subs := getNotificationSubscribers(key, "prodID", eaaContext)
+
+				Expect(subs).To(Equal([]string{"bb", "aa"}))
+			})
+		})
+
+		g.When("the notification differs", func() {
+			g.It("should not match wildcard subscriptions", func() {
+				addSubscription("sensors-floor-*", SubscriberIds{"aa"}, nil)
+
+				subs := getNotificationSubscribers(
+					UniqueNotif{"sensors-floor-1", "name", "2.0"}, "prodID", eaaContext)
+
+				Expect(subs).To(BeEmpty())
+			})
+		})
+	})
+
+	g.Describe("subscriberAcceptsNotification", func() {
+		key := UniqueNotif{"sensors", "temperature", "1.0"}
+		coldStorage := map[string]interface{}{"zone": "cold-storage", "value": -18.5}
+		office := map[string]interface{}{"zone": "office", "value": 21.0}
+
+		g.BeforeEach(func() {
+			Expect(addSubscriptionToNamespace("aa", "sensors", []NotificationDescriptor{{
+				Name: "temperature", Version: "1.0",
+				Filter: map[string]string{"zone": "cold-storage"},
+			}}, eaaContext)).To(Succeed())
+			Expect(addSubscriptionToNamespace("bb", "sensors", []NotificationDescriptor{{
+				Name: "temperature", Version: "1.0",
+			}}, eaaContext)).To(Succeed())
+		})
+
+		g.It("should deliver to subscriptions without a filter", func() {
+			Expect(subscriberAcceptsNotification(key, "prodID", "bb", office,
+				eaaContext)).To(BeTrue())
+			Expect(subscriberAcceptsNotification(key, "prodID", "bb", nil,
+				eaaContext)).To(BeTrue())
+		})
+
+		g.It("should deliver only matching notifications to filtered subscriptions", func() {
+			Expect(subscriberAcceptsNotification(key, "prodID", "aa", coldStorage,
+				eaaContext)).To(BeTrue())
+			Expect(subscriberAcceptsNotification(key, "prodID", "aa", office,
+				eaaContext)).To(BeFalse())
+			Expect(subscriberAcceptsNotification(key, "prodID", "aa", nil,
+				eaaContext)).To(BeFalse())
+		})
+
+		g.It("should deliver if any subscription of the consumer matches", func() {
+			Expect(addSubscriptionToService("aa", "sensors", "prodID",
+				[]NotificationDescriptor{{Name: "temperature", Version: "1.0"}},
+				eaaContext)).To(Succeed())
+
+			Expect(subscriberAcceptsNotification(key, "prodID", "aa", office,
+				eaaContext)).To(BeTrue())
+		})
+
+		g.It("should forget the filter on unsubscription", func() {
+			Expect(removeAllSubscriptions("aa", eaaContext)).To(Succeed())
+
+			Expect(eaaContext.subscriptionInfo.m[key].filters).To(BeEmpty())
+		})
+
+		g.It("should not share the filter with other subscribers", func() {
+			subs, err := getConsumerSubscriptions("bb", eaaContext)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(subs.Subscriptions[0].Notifications[0].Filter).To(BeNil())
+
+			subs, err = getConsumerSubscriptions("aa", eaaContext)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(subs.Subscriptions[0].Notifications[0].Filter).To(
+				Equal(map[string]string{"zone": "cold-storage"}))
+		})
+	})
+
+	g.Describe("reapExpiredServices", func() {
+		const (
+			expiredProd = "ns:expired"
+			aliveProd   = "ns:alive"
+			noTTLProd   = "ns:nottl"
+		)
+
+		g.BeforeEach(func() {
+			eaaContext.serviceInfo.renewed = map[string]time.Time{serviceName: time.Now()}
+
+			eaaContext.serviceInfo.m[expiredProd] = Service{TTL: 1}
+			eaaContext.serviceInfo.renewed[expiredProd] = time.Now().Add(-2 * time.Second)
+
+			eaaContext.serviceInfo.m[aliveProd] = Service{TTL: 60}
+			eaaContext.serviceInfo.renewed[aliveProd] = time.Now().Add(-2 * time.Second)
+
+			eaaContext.serviceInfo.m[noTTLProd] = Service{}
+			eaaContext.serviceInfo.renewed[noTTLProd] = time.Now().Add(-time.Hour)
+
+			eaaContext.MsgBrokerCtx = NewGoChannelMsgBroker(eaaContext)
+			Expect(eaaContext.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic,
+				nil)).To(Succeed())
+			Expect(eaaContext.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic,
+				nil)).To(Succeed())
+		})
+
+		g.AfterEach(func() {
+			Expect(eaaContext.MsgBrokerCtx.removeAll()).To(Succeed())
+		})
+
+		g.When("default TTL is not set", func() {
+			g.It("should deregister only services with elapsed TTL", func() {
+				reapExpiredServices(eaaContext)
+
+				Eventually(func() bool {
+					eaaContext.serviceInfo.RLock()
+					defer eaaContext.serviceInfo.RUnlock()
+					return isServicePresent(expiredProd, eaaContext)
+				}).Should(BeFalse())
+
+				Consistently(func() bool {
+					eaaContext.serviceInfo.RLock()
+					defer eaaContext.serviceInfo.RUnlock()
+					return isServicePresent(aliveProd, eaaContext) &&
+						isServicePresent(noTTLProd, eaaContext)
+				}, 200*time.Millisecond).Should(BeTrue())
+			})
+		})
+
+		g.When("default TTL is set", func() {
+			g.It("should apply it to services registered without TTL", func() {
+				eaaContext.cfg.DefaultServiceTTL.Duration = time.Minute
+
+				Expect(expiredServices(eaaContext)).To(ConsistOf(expiredProd, noTTLProd))
+			})
+		})
+	})
+
 	g.Describe("sendNotificationToSubscriber", func() {
 		g.When("there is a consumer connection but no websocket connection established", func() {
 			subscriptionID := "xxx"
 
 			g.BeforeEach(func() {
-				eaaContext.consumerConnections.m[subscriptionID] = ConsumerConnection{}
+				eaaContext.consumerConnections.m[subscriptionID] = []ConsumerConnection{{}}
 			})
 
 			g.When("and websocket is created in time", func() {
@@ -217,11 +402,12 @@ var _ = g.Describe("api_procuder internal errors", func() {
 							time.Sleep(500 * time.Millisecond)
 
 							eaaContext.consumerConnections.RLock()
-							eaaContext.consumerConnections.m[subscriptionID] = ConsumerConnection{&websocket.Conn{}}
+							eaaContext.consumerConnections.m[subscriptionID] = []ConsumerConnection{{connection: &websocket.Conn{}}}
 							eaaContext.consumerConnections.RUnlock()
 						}()
 
-						e = sendNotificationToSubscriber(subscriptionID, []byte{1, 2, 3}, eaaContext)
+						e = sendNotificationToSubscriber(subscriptionID, nil, []byte{1, 2, 3}, "",
+							time.Time{}, eaaContext)
 
 						Expect(e).NotTo(HaveOccurred())
 						Expect(calls).To(Equal(1))
@@ -230,7 +416,8 @@ var _ = g.Describe("api_procuder internal errors", func() {
 
 			g.When("and websocket is not created in time", func() {
 				g.It("should fail with an error", func() {
-					e := sendNotificationToSubscriber(subscriptionID, []byte{1, 2, 3}, eaaContext)
+					e := sendNotificationToSubscriber(subscriptionID, nil, []byte{1, 2, 3}, "",
+						time.Time{}, eaaContext)
 
 					Expect(e).To(HaveOccurred())
 				})
@@ -238,3 +425,471 @@ var _ = g.Describe("api_procuder internal errors", func() {
 		})
 	})
 })
+
+var _ = g.Describe("validateService", func() {
+	var serv Service
+
+	g.BeforeEach(func() {
+		serv = Service{
+			URN:         &URN{ID: "producer", Namespace: "ns"},
+			EndpointURI: "https://1.2.3.4",
+		}
+	})
+
+	g.It("Accepts a complete Service", func() {
+		Expect(validateService(&serv)).Should(Succeed())
+	})
+
+	g.It("Rejects a Service without URN", func() {
+		serv.URN = nil
+		Expect(validateService(&serv)).ShouldNot(Succeed())
+	})
+
+	g.It("Rejects a Service with an empty Namespace", func() {
+		serv.URN.Namespace = ""
+		Expect(validateService(&serv)).ShouldNot(Succeed())
+	})
+
+	g.It("Rejects a Service with a Namespace pattern", func() {
+		serv.URN.Namespace = "ns-*"
+		Expect(validateService(&serv)).ShouldNot(Succeed())
+	})
+
+	g.It("Rejects a Service without endpoint", func() {
+		serv.EndpointURI = ""
+		Expect(validateService(&serv)).ShouldNot(Succeed())
+	})
+
+	g.It("Accepts endpoints instead of the endpoint URI", func() {
+		serv.EndpointURI = ""
+		serv.Endpoints = []ServiceEndpoint{
+			{URI: "https://1.2.3.4"}, {URI: "https://5.6.7.8", Health: EndpointUnhealthy}}
+		Expect(validateService(&serv)).Should(Succeed())
+	})
+
+	g.It("Rejects invalid endpoints", func() {
+		for _, endpoints := range [][]ServiceEndpoint{
+			{{URI: ""}},
+			{{URI: "https://1.2.3.4"}, {URI: "https://1.2.3.4"}},
+			{{URI: "https://1.2.3.4", Health: "dead"}},
+		} {
+			serv.Endpoints = endpoints
+			Expect(validateService(&serv)).ShouldNot(Succeed(), fmt.Sprint(endpoints))
+		}
+	})
+
+	g.It("Accepts valid labels", func() {
+		serv.Labels = map[string]string{"region": "us-east", "example.com/gpu": ""}
+		Expect(validateService(&serv)).Should(Succeed())
+	})
+
+	g.It("Rejects invalid labels", func() {
+		for _, labels := range []map[string]string{
+			{"": "x"},
+			{"re gion": "x"},
+			{strings.Repeat("k", maxServiceLabelKeyLength+1): "x"},
+			{"region": strings.Repeat("v", maxServiceLabelValueSize+1)},
+			{"region": "us\neast"},
+		} {
+			serv.Labels = labels
+			Expect(validateService(&serv)).ShouldNot(Succeed(), fmt.Sprint(labels))
+		}
+
+		serv.Labels = make(map[string]string)
+		for i := 0; i <= maxServiceLabels; i++ {
+			serv.Labels[strconv.Itoa(i)] = ""
+		}
+		Expect(validateService(&serv)).ShouldNot(Succeed())
+	})
+})
+
+var _ = g.Describe("urnMatches", func() {
+	derived := URN{ID: "producer", Namespace: "ns"}
+
+	g.It("Accepts a missing or partial URN", func() {
+		Expect(urnMatches(nil, derived)).Should(BeTrue())
+		Expect(urnMatches(&URN{Namespace: "ns"}, derived)).Should(BeTrue())
+		Expect(urnMatches(&URN{ID: "producer"}, derived)).Should(BeTrue())
+	})
+
+	g.It("Rejects a URN of another producer", func() {
+		Expect(urnMatches(&URN{ID: "other", Namespace: "ns"}, derived)).Should(BeFalse())
+		Expect(urnMatches(&URN{ID: "producer", Namespace: "other"}, derived)).Should(BeFalse())
+	})
+})
+
+var _ = g.Describe("registrationAction", func() {
+	var eaaCtx *Context
+	registered := Service{
+		URN:           &URN{ID: "producer", Namespace: "ns"},
+		EndpointURI:   "https://1.2.3.4",
+		Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}},
+		Info:          json.RawMessage(`{"zone":"a"}`),
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = map[string]Service{"ns:producer": registered}
+	})
+
+	g.It("Registers an unknown service", func() {
+		Expect(registrationAction("ns:other", registered, eaaCtx)).
+			To(Equal(serviceActionRegister))
+	})
+
+	g.It("Skips an identical re-registration", func() {
+		serv := registered
+		serv.Info = json.RawMessage(`{ "zone": "a" }`)
+		serv.Notifications = append(serv.Notifications, NotificationDescriptor{Name: "invalid"})
+
+		Expect(registrationAction("ns:producer", serv, eaaCtx)).To(BeEmpty())
+	})
+
+	g.It("Updates a changed service", func() {
+		serv := registered
+		serv.Info = json.RawMessage(`{"zone":"b"}`)
+
+		Expect(registrationAction("ns:producer", serv, eaaCtx)).
+			To(Equal(serviceActionUpdate))
+	})
+})
+
+var _ = g.Describe("Identical re-registration", func() {
+	var eaaCtx *Context
+
+	register := func() int {
+		rec := httptest.NewRecorder()
+		RegisterApplication(rec, newTLSRequest("POST", "/services",
+			`{"endpoint_uri":"https://1.1.1.1","ttl":1}`, "ns:producer", eaaCtx))
+		return rec.Code
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo = services{m: make(map[string]Service),
+			renewed: make(map[string]time.Time)}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addServicesPubSub(eaaCtx)).To(Succeed())
+
+		Expect(register()).To(Equal(http.StatusOK))
+		Eventually(func() bool {
+			eaaCtx.serviceInfo.RLock()
+			defer eaaCtx.serviceInfo.RUnlock()
+			return isServicePresent("ns:producer", eaaCtx)
+		}).Should(BeTrue())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("succeeds without publishing", func() {
+		published := make(chan *message.Message, 1)
+		eaaCtx.MsgBrokerCtx = recordingMsgBroker{
+			eaaCtx.MsgBrokerCtx.(*GoChannelMsgBroker), published}
+
+		Expect(register()).To(Equal(http.StatusOK))
+		Consistently(published, 100*time.Millisecond).ShouldNot(Receive())
+	})
+})
+
+// newFanOutContext returns a context with the consumers subscribed to
+// notification n1 of namespace ns
+func newFanOutContext(conns []notificationConn) *Context {
+	eaaCtx := &Context{}
+	eaaCtx.serviceInfo.m = map[string]Service{"ns:producer": {}}
+	eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+	eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+
+	var subscribers SubscriberIds
+	for i, conn := range conns {
+		id := fmt.Sprintf("ns:consumer%d", i)
+		eaaCtx.consumerConnections.m[id] = []ConsumerConnection{{connection: conn, acks: true}}
+		subscribers = append(subscribers, id)
+	}
+	eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}] = &ConsumerSubscription{
+		namespaceSubscriptions: subscribers,
+		serviceSubscriptions:   make(map[string]SubscriberIds),
+	}
+	return eaaCtx
+}
+
+var _ = g.Describe("Notification worker pool", func() {
+	g.It("delivers notifications to every consumer in order", func() {
+		var conns []notificationConn
+		var sent []chan []byte
+		for i := 0; i < 10; i++ {
+			ch := make(chan []byte, 2)
+			conns = append(conns, &fakeNotificationConn{sent: ch})
+			sent = append(sent, ch)
+		}
+		eaaCtx := newFanOutContext(conns)
+		eaaCtx.cfg.NotificationWorkers = 4
+
+		for _, payload := range []string{`{"n":1}`, `{"n":2}`} {
+			summary, err := sendNotificationToAllSubscribers("ns:producer",
+				&NotificationFromProducer{Name: "n1", Version: "1.0",
+					Payload: json.RawMessage(payload)}, "", eaaCtx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(summary).To(Equal(DeliverySummary{Subscribers: 10, Delivered: 10}))
+		}
+
+		for _, ch := range sent {
+			var first, second NotificationToConsumer
+			Expect(json.Unmarshal(<-ch, &first)).To(Succeed())
+			Expect(json.Unmarshal(<-ch, &second)).To(Succeed())
+			Expect(string(first.Payload)).To(Equal(`{"n":1}`))
+			Expect(string(second.Payload)).To(Equal(`{"n":2}`))
+		}
+	})
+})
+
+var _ = g.Describe("Notification deadlines", func() {
+	now := time.Now()
+
+	g.It("ends the deadline with the maximum age", func() {
+		notif := &NotificationFromProducer{}
+		Expect(applyNotificationMaxAge(notif, now)).To(Succeed())
+		Expect(notif.Deadline).To(BeNil())
+
+		notif.MaxAge = 500
+		Expect(applyNotificationMaxAge(notif, now)).To(Succeed())
+		Expect(*notif.Deadline).To(Equal(now.Add(500 * time.Millisecond)))
+
+		earlier := now.Add(100 * time.Millisecond)
+		notif.Deadline = &earlier
+		Expect(applyNotificationMaxAge(notif, now)).To(Succeed())
+		Expect(*notif.Deadline).To(Equal(earlier))
+
+		Expect(applyNotificationMaxAge(&NotificationFromProducer{MaxAge: -1},
+			now)).ToNot(Succeed())
+	})
+
+	g.It("drops a notification of a passed deadline", func() {
+		conn := &fakeNotificationConn{sent: make(chan []byte, 2)}
+		eaaCtx := newFanOutContext([]notificationConn{conn})
+		eaaCtx.cfg.NotificationReplayBufferSize = 10
+
+		passed := now.Add(-time.Second)
+		summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0", Deadline: &passed},
+			"", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(DeliverySummary{Subscribers: 1, Failed: 1}))
+		Expect(conn.sent).To(BeEmpty())
+		counters := eaaCtx.subscriptionStats.counters("ns:consumer0",
+			UniqueNotif{"ns", "n1", "1.0"})
+		Expect(atomic.LoadUint64(&counters.dropped)).To(BeEquivalentTo(1))
+		Expect(atomic.LoadUint64(&counters.delivered)).To(BeZero())
+		Expect(eaaCtx.replayBuffers.since("ns:consumer0", 0, connectionFilter{})).To(BeEmpty())
+
+		_, err = deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0"}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.sent).To(HaveLen(1))
+	})
+})
+
+var _ = g.Describe("Notification matching", func() {
+	var (
+		eaaCtx *Context
+		conns  []*fakeNotificationConn
+	)
+
+	g.BeforeEach(func() {
+		conns = nil
+		var notifConns []notificationConn
+		for i := 0; i < 3; i++ {
+			conn := &fakeNotificationConn{sent: make(chan []byte, 1)}
+			conns = append(conns, conn)
+			notifConns = append(notifConns, conn)
+		}
+		eaaCtx = newFanOutContext(notifConns)
+		eaaCtx.cfg.AdminCommonNames = []string{"ns:admin"}
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setFilter("",
+			"ns:consumer1", map[string]string{"zone": "a"})
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"n*", "n1", "1.0"}] = &ConsumerSubscription{
+			namespaceSubscriptions: SubscriberIds{"ns:consumer3"},
+			serviceSubscriptions:   make(map[string]SubscriberIds),
+		}
+	})
+
+	match := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		MatchNotification(rec, newTLSRequest(http.MethodPost, "/admin/notifications/match",
+			body, "ns:admin", eaaCtx))
+		return rec
+	}
+
+	g.It("lists the consumers the notification would be delivered to", func() {
+		rec := match(`{"producer":{"namespace":"ns","id":"producer"},
+			"name":"n1","version":"1.0","attributes":{"zone":"b"}}`)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var result NotificationMatch
+		Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+		Expect(result).To(Equal(NotificationMatch{
+			Matched:     []string{"ns:consumer0", "ns:consumer2", "ns:consumer3"},
+			FilteredOut: []string{"ns:consumer1"},
+		}))
+
+		g.By("not delivering anything")
+		for _, conn := range conns {
+			Expect(conn.sent).To(BeEmpty())
+		}
+	})
+
+	g.It("matches like the delivery", func() {
+		query := NotificationMatchQuery{URN: URN{ID: "producer", Namespace: "ns"},
+			Name: "n1", Version: "1.0", Attributes: map[string]interface{}{"zone": "a"}}
+		Expect(matchNotification(query, eaaCtx).Matched).To(ConsistOf(
+			"ns:consumer0", "ns:consumer1", "ns:consumer2", "ns:consumer3"))
+
+		summary, err := deliverNotification(query.URN, &NotificationFromProducer{
+			Name: "n1", Version: "1.0", Payload: json.RawMessage(`{"zone":"a"}`)},
+			"", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Subscribers).To(Equal(4))
+
+		query.Name = "n2"
+		Expect(matchNotification(query, eaaCtx)).To(Equal(NotificationMatch{
+			Matched: []string{}, FilteredOut: []string{}}))
+	})
+
+	g.It("rejects a notification of an unregistered producer", func() {
+		rec := match(`{"producer":{"namespace":"ns","id":"unknown"},
+			"name":"n1","version":"1.0"}`)
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonServiceNotFound))
+
+		rec = match(`{"producer":{"namespace":"ns","id":"producer"},"name":"n1"}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	g.It("is served to admins only", func() {
+		rec := httptest.NewRecorder()
+		MatchNotification(rec, newTLSRequest(http.MethodPost, "/admin/notifications/match",
+			`{}`, "ns:consumer0", eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+	})
+})
+
+// clientTopicFailingMsgBroker is a GoChannelMsgBroker failing to publish
+// the subscription requests of the clients
+type clientTopicFailingMsgBroker struct {
+	*GoChannelMsgBroker
+}
+
+func (b clientTopicFailingMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
+	if strings.HasPrefix(topic, clientTopicPrefix) {
+		return errors.New("broker unavailable")
+	}
+	return b.GoChannelMsgBroker.publish(ctx, topic, msg)
+}
+
+var _ = g.Describe("Deregistration with subscriptions removal", func() {
+	var eaaCtx *Context
+
+	deregister := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		DeregisterApplication(rec, newTLSRequest(http.MethodDelete, "/services"+query, "",
+			"ns:producer", eaaCtx))
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.serviceInfo.renewed = make(map[string]time.Time)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic,
+			nil)).To(Succeed())
+		Expect(eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic,
+			nil)).To(Succeed())
+
+		urn := URN{ID: "producer", Namespace: "ns"}
+		Expect(addService("ns:producer", Service{URN: &urn}, eaaCtx)).To(Succeed())
+		notif := []NotificationDescriptor{{Name: "n1", Version: "1.0"}}
+		Expect(addSubscriptionToNamespace("ns:producer", "other", notif, eaaCtx)).
+			To(Succeed())
+		Expect(addSubscriptionToService("ns:producer", "other", "producer", notif,
+			eaaCtx)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("keeps the subscriptions by default", func() {
+		Expect(deregister("").Code).To(Equal(http.StatusNoContent))
+
+		Eventually(func() bool {
+			return isServicePresent("ns:producer", eaaCtx)
+		}).Should(BeFalse())
+		Consistently(func() int {
+			return countConsumerSubscriptions("ns:producer", eaaCtx)
+		}, 100*time.Millisecond).Should(Equal(2))
+	})
+
+	g.It("removes the service and the subscriptions", func() {
+		Expect(deregister("?removeSubscriptions=true").Code).To(Equal(http.StatusNoContent))
+
+		Eventually(func() bool {
+			return isServicePresent("ns:producer", eaaCtx)
+		}).Should(BeFalse())
+		Eventually(func() int {
+			return countConsumerSubscriptions("ns:producer", eaaCtx)
+		}).Should(BeZero())
+	})
+
+	g.It("rejects an invalid query", func() {
+		rec := deregister("?removeSubscriptions=maybe")
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonInvalidQuery))
+		Expect(isServicePresent("ns:producer", eaaCtx)).To(BeTrue())
+	})
+
+	g.It("reports a partial failure", func() {
+		eaaCtx.MsgBrokerCtx = clientTopicFailingMsgBroker{
+			eaaCtx.MsgBrokerCtx.(*GoChannelMsgBroker)}
+		rec := deregister("?removeSubscriptions=true")
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonPartialDeregistration))
+		Eventually(func() bool {
+			return isServicePresent("ns:producer", eaaCtx)
+		}).Should(BeFalse())
+		Expect(countConsumerSubscriptions("ns:producer", eaaCtx)).To(Equal(2))
+	})
+})
+
+// BenchmarkNotificationWorkerPool sends notifications to 500 consumers each
+// taking 100µs to write a notification, one after another and by a pool
+// of 32 workers
+func BenchmarkNotificationWorkerPool(b *testing.B) {
+	for _, workers := range []int{0, 32} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			var conns []notificationConn
+			for i := 0; i < 500; i++ {
+				conns = append(conns, &slowNotificationConn{delay: 100 * time.Microsecond})
+			}
+			eaaCtx := newFanOutContext(conns)
+			eaaCtx.cfg.NotificationWorkers = workers
+
+			notif := &NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: []byte(`{}`)}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := sendNotificationToAllSubscribers("ns:producer", notif,
+					"", eaaCtx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -5,13 +5,306 @@ package eaa
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 )
 
+// Limits of the notification descriptors of a subscription request
+const (
+	maxSubscriptionNotifications     = 256
+	maxNotificationNameLength        = 128
+	maxNotificationVersionLength     = 32
+	maxNotificationDescriptionLength = 1024
+	maxNotificationFilterAttributes  = 16
+	maxNotificationFilterKeyLength   = 128
+	maxNotificationFilterValueLength = 256
+)
+
+// validateSubscription checks a subscription of the consumer in the scope of
+// the namespace, which may be a pattern, or of the service. The result of
+// the subscription is returned if it's rejected.
+func validateSubscription(commonName string, scope string, urn URN,
+	notif []NotificationDescriptor, eaaCtx *Context) *SubscriptionResult {
+
+	result := &SubscriptionResult{URN: &urn, Code: http.StatusBadRequest}
+
+	if scope == subscriptionScopeNamespace {
+		if err := validateURNComponent("namespace", urn.Namespace); err != nil {
+			result.Error, result.Detail = reasonInvalidURN, err.Error()
+			return result
+		}
+		if _, err := path.Match(urn.Namespace, ""); err != nil {
+			result.Error = reasonInvalidNamespacePattern
+			result.Detail = fmt.Sprintf("bad namespace pattern %.64q", urn.Namespace)
+			return result
+		}
+	} else if err := validateServiceURNVars(urn); err != nil {
+		result.Error, result.Detail = reasonInvalidURN, err.Error()
+		return result
+	}
+
+	if err := validateSubscriptionNotifications(notif); err != nil {
+		result.Error, result.Detail = reasonInvalidNotification, err.Error()
+		return result
+	}
+
+	if err := checkNamespaceAccess(commonName, urn.Namespace, eaaCtx); err != nil {
+		result.Code = http.StatusForbidden
+		result.Error, result.Detail = reasonNamespaceAccessDenied, err.Error()
+		return result
+	}
+
+	// A subscription to a service which isn't registered would never fire
+	if scope == subscriptionScopeService {
+		eaaCtx.serviceInfo.RLock()
+		serviceFound := isServicePresent(urn.String(), eaaCtx)
+		eaaCtx.serviceInfo.RUnlock()
+		if !serviceFound {
+			result.Code, result.Error = http.StatusNotFound, reasonServiceNotFound
+			result.Detail = fmt.Sprintf("service '%s' is not registered", urn.String())
+			return result
+		}
+	}
+	return nil
+}
+
+// validateUnsubscription checks the URN of an unsubscription from
+// the notifications of the namespace or, if it has an ID, of the service.
+// The URN is a path of the unsubscribe requests, so neither can be empty
+// or contain a slash, the reason of the rejection is returned.
+func validateUnsubscription(urn URN) *SubscriptionResult {
+	var detail string
+	switch {
+	case urn.Namespace == "":
+		detail = "namespace is empty"
+	case strings.ContainsRune(urn.Namespace, '/'):
+		detail = "namespace contains invalid character '/'"
+	case strings.ContainsRune(urn.ID, '/'):
+		detail = "ID contains invalid character '/'"
+	default:
+		return nil
+	}
+	return &SubscriptionResult{URN: &urn, Code: http.StatusBadRequest,
+		Error: reasonInvalidURN, Detail: detail}
+}
+
+// validateSubscriptionNotifications checks all the notifications of
+// a subscription request, so that it is either applied as a whole or not at all.
+// The error names the offending notification.
+func validateSubscriptionNotifications(notif []NotificationDescriptor) error {
+	if len(notif) > maxSubscriptionNotifications {
+		return fmt.Errorf("more than %d notifications in a request",
+			maxSubscriptionNotifications)
+	}
+	for i, n := range notif {
+		if err := validateNotificationDescriptor(n); err != nil {
+			return fmt.Errorf("%s: %v", describeNotification(i, n), err)
+		}
+	}
+	return nil
+}
+
+// describeNotification identifies a notification of a request by its index,
+// name and version. They are quoted, so that the invalid characters are
+// escaped, and cut short, so that an oversized one isn't echoed.
+func describeNotification(i int, n NotificationDescriptor) string {
+	switch {
+	case n.Name == "":
+		return fmt.Sprintf("notification %d", i)
+	case n.Version == "":
+		return fmt.Sprintf("notification %d (%.64q)", i, n.Name)
+	default:
+		return fmt.Sprintf("notification %d (%.64q %.32q)", i, n.Name, n.Version)
+	}
+}
+
+// validateNotificationDescriptor checks if the fields of a notification are
+// within the limits and its version consists of letters and digits separated
+// by '.', '-', '_' or '+', e.g. "1.0.0" or "v2"
+func validateNotificationDescriptor(n NotificationDescriptor) error {
+	switch {
+	case n.Name == "":
+		return errors.New("missing name")
+	case len(n.Name) > maxNotificationNameLength:
+		return fmt.Errorf("name exceeds %d bytes", maxNotificationNameLength)
+	case n.Version == "":
+		return errors.New("missing version")
+	case len(n.Version) > maxNotificationVersionLength:
+		return fmt.Errorf("version exceeds %d bytes", maxNotificationVersionLength)
+	case !isNotificationVersion(n.Version):
+		return errors.New("invalid version format")
+	case len(n.Description) > maxNotificationDescriptionLength:
+		return fmt.Errorf("description exceeds %d bytes", maxNotificationDescriptionLength)
+	case len(n.Filter) > maxNotificationFilterAttributes:
+		return fmt.Errorf("filter has more than %d attributes",
+			maxNotificationFilterAttributes)
+	}
+	for i, r := range n.Name {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("name contains invalid character %s at %d",
+				strconv.QuoteRune(r), i)
+		}
+	}
+	if err := validateNameMatch(n); err != nil {
+		return err
+	}
+	if err := validateNotificationQoS(n.QoS); err != nil {
+		return err
+	}
+	if err := validateAggregationWindow(n.AggregationWindow); err != nil {
+		return err
+	}
+	for key, value := range n.Filter {
+		if key == "" {
+			return errors.New("empty filter attribute")
+		}
+		if len(key) > maxNotificationFilterKeyLength {
+			return fmt.Errorf("filter attribute exceeds %d bytes",
+				maxNotificationFilterKeyLength)
+		}
+		if len(value) > maxNotificationFilterValueLength {
+			return fmt.Errorf("filter value of %.64q exceeds %d bytes", key,
+				maxNotificationFilterValueLength)
+		}
+	}
+	return validateNotificationTransform(n.Transform)
+}
+
+// isNotificationVersion checks the format of a notification version
+func isNotificationVersion(version string) bool {
+	separated := true
+	for _, r := range version {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			separated = false
+		case r == '.' || r == '-' || r == '_' || r == '+':
+			if separated {
+				return false
+			}
+			separated = true
+		default:
+			return false
+		}
+	}
+	return !separated
+}
+
+// defaultMaxSubscriptionsPerConsumer is the subscription limit applied if
+// MaxSubscriptionsPerConsumer isn't configured
+const defaultMaxSubscriptionsPerConsumer = 10000
+
+// subscriptionLimitError is returned when a subscription would take
+// a consumer over MaxSubscriptionsPerConsumer
+type subscriptionLimitError struct {
+	commonName string
+	limit      int
+}
+
+func (e subscriptionLimitError) Error() string {
+	return fmt.Sprintf("%s would exceed the limit of %d subscriptions",
+		e.commonName, e.limit)
+}
+
+// countSubscriptions returns the number of namespace and service
+// subscriptions of a consumer, the subscription map has to be locked
+// by the caller
+func countSubscriptions(commonName string, eaaCtx *Context) int {
+	count := 0
+	for _, conSub := range eaaCtx.subscriptionInfo.m {
+		for _, subID := range conSub.namespaceSubscriptions {
+			if subID == commonName {
+				count++
+			}
+		}
+		for _, subIDs := range conSub.serviceSubscriptions {
+			for _, subID := range subIDs {
+				if subID == commonName {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// isSubscribed checks if a consumer is subscribed to a notification in
+// a namespace, or in a service if serviceID isn't empty. The subscription
+// map has to be locked by the caller.
+func isSubscribed(commonName string, key UniqueNotif, serviceID string,
+	eaaCtx *Context) bool {
+
+	if _, ok := eaaCtx.subscriptionInfo.m[key]; !ok {
+		return false
+	}
+	if serviceID == "" {
+		return getNamespaceSubscriptionIndex(key, commonName, eaaCtx) != -1
+	}
+	return getServiceSubscriptionIndex(key, serviceID, commonName, eaaCtx) != -1
+}
+
+// checkSubscriptionLimitLocked returns subscriptionLimitError if
+// subscribing a consumer to the notifications would exceed the limit.
+// Resubscribing to a notification doesn't count. The subscription map has
+// to be locked by the caller.
+func checkSubscriptionLimitLocked(commonName string, namespace string, serviceID string,
+	notif []NotificationDescriptor, eaaCtx *Context) error {
+
+	limit := eaaCtx.config().MaxSubscriptionsPerConsumer
+	if limit <= 0 {
+		limit = defaultMaxSubscriptionsPerConsumer
+	}
+
+	added := make(map[UniqueNotif]bool)
+	for _, n := range notif {
+		key := UniqueNotif{
+			namespace:    namespace,
+			notifName:    subscriptionNotifName(n),
+			notifVersion: n.Version,
+		}
+		if !isSubscribed(commonName, key, serviceID, eaaCtx) {
+			added[key] = true
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	if countSubscriptions(commonName, eaaCtx)+len(added) > limit {
+		return subscriptionLimitError{commonName: commonName, limit: limit}
+	}
+	return nil
+}
+
+// checkSubscriptionLimit returns subscriptionLimitError if subscribing
+// a consumer to the notifications would exceed the limit
+func checkSubscriptionLimit(commonName string, namespace string, serviceID string,
+	notif []NotificationDescriptor, eaaCtx *Context) error {
+
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	return checkSubscriptionLimitLocked(commonName, namespace, serviceID, notif, eaaCtx)
+}
+
 // addSubscriptionToNamespace subscribes a consumer to a notification
 // in a namespace
 func addSubscriptionToNamespace(commonName string, namespace string,
 	notif []NotificationDescriptor, eaaCtx *Context) error {
 
+	if err := validateSubscriptionNotifications(notif); err != nil {
+		return err
+	}
+	if err := checkNamespaceAccess(commonName, namespace, eaaCtx); err != nil {
+		return err
+	}
+
+	// The limit is checked under the same lock as the subscriptions are
+	// stored and indexed, so that concurrent subscriptions can't exceed it
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -19,23 +312,86 @@ func addSubscriptionToNamespace(commonName string, namespace string,
 		return errors.New("Eaa context not initialized. ")
 	}
 
+	if err := checkSubscriptionLimitLocked(commonName, namespace, "", notif,
+		eaaCtx); err != nil {
+		return err
+	}
+
+	if err := eaaCtx.subscriptions().addSubscriptions(commonName, namespace, "",
+		notif); err != nil {
+		return storeError(err)
+	}
+
 	for _, n := range notif {
-		key := UniqueNotif{
-			namespace:    namespace,
-			notifName:    n.Name,
-			notifVersion: n.Version,
+		indexNamespaceSubscription(commonName, namespace, n, eaaCtx)
+	}
+
+	return nil
+}
+
+// indexNamespaceSubscription adds a namespace subscription of a consumer
+// to the subscription map, which has to be locked by the caller
+func indexNamespaceSubscription(commonName string, namespace string,
+	n NotificationDescriptor, eaaCtx *Context) {
+
+	key := UniqueNotif{
+		namespace:    namespace,
+		notifName:    subscriptionNotifName(n),
+		notifVersion: n.Version,
+	}
+
+	initNamespaceNotification(key, n, eaaCtx)
+	eaaCtx.subscriptionInfo.m[key].setFilter("", commonName, n.Filter)
+	eaaCtx.subscriptionInfo.m[key].setTransform("", commonName, n.Transform)
+	eaaCtx.subscriptionInfo.m[key].setQoS("", commonName, n.QoS)
+	eaaCtx.subscriptionInfo.m[key].setAggregationWindow("", commonName,
+		aggregationWindow(n))
+	eaaCtx.subscriptionInfo.m[key].setCreated("", commonName, time.Now())
+
+	if index := getNamespaceSubscriptionIndex(key,
+		commonName, eaaCtx); index == -1 {
+		eaaCtx.subscriptionInfo.m[key].namespaceSubscriptions = append(
+			eaaCtx.subscriptionInfo.m[key].namespaceSubscriptions, commonName)
+	}
+}
+
+// getMatchingNamespaces returns namespaces of registered services that match
+// the namespace pattern
+func getMatchingNamespaces(pattern string, eaaCtx *Context) []string {
+	eaaCtx.serviceInfo.RLock()
+	defer eaaCtx.serviceInfo.RUnlock()
+
+	found := make(map[string]bool)
+	var namespaces []string
+
+	for _, serv := range eaaCtx.serviceInfo.m {
+		if serv.URN == nil || found[serv.URN.Namespace] {
+			continue
+		}
+		if namespaceMatches(pattern, serv.URN.Namespace) {
+			found[serv.URN.Namespace] = true
+			namespaces = append(namespaces, serv.URN.Namespace)
 		}
+	}
 
-		initNamespaceNotification(key, n, eaaCtx)
+	return namespaces
+}
 
-		if index := getNamespaceSubscriptionIndex(key,
-			commonName, eaaCtx); index == -1 {
-			eaaCtx.subscriptionInfo.m[key].namespaceSubscriptions = append(
-				eaaCtx.subscriptionInfo.m[key].namespaceSubscriptions, commonName)
+// isNamespaceWildcardSubscribed checks if any consumer is subscribed to
+// notifications with a namespace pattern matching the namespace
+func isNamespaceWildcardSubscribed(namespace string, eaaCtx *Context) bool {
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	for key, conSub := range eaaCtx.subscriptionInfo.m {
+		if len(conSub.namespaceSubscriptions) != 0 &&
+			isNamespacePattern(key.namespace) &&
+			namespaceMatches(key.namespace, namespace) {
+			return true
 		}
 	}
 
-	return nil
+	return false
 }
 
 // removeSubscriptionToNamespace unsubscribes a consumer from a specified
@@ -43,6 +399,11 @@ func addSubscriptionToNamespace(commonName string, namespace string,
 func removeSubscriptionToNamespace(commonName string, namespace string,
 	notif []NotificationDescriptor, eaaCtx *Context) error {
 
+	if err := eaaCtx.subscriptions().removeSubscriptions(commonName, namespace, "",
+		notif); err != nil {
+		return storeError(err)
+	}
+
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -53,7 +414,7 @@ func removeSubscriptionToNamespace(commonName string, namespace string,
 	for _, n := range notif {
 		key := UniqueNotif{
 			namespace:    namespace,
-			notifName:    n.Name,
+			notifName:    subscriptionNotifName(n),
 			notifVersion: n.Version,
 		}
 
@@ -64,6 +425,7 @@ func removeSubscriptionToNamespace(commonName string, namespace string,
 
 			continue
 		}
+		eaaCtx.subscriptionInfo.m[key].removeSubscriber("", commonName)
 		if index := getNamespaceSubscriptionIndex(key,
 			commonName, eaaCtx); index != -1 {
 			eaaCtx.subscriptionInfo.m[key].namespaceSubscriptions = append(
@@ -76,9 +438,62 @@ func removeSubscriptionToNamespace(commonName string, namespace string,
 	return nil
 }
 
+// getUnsubscriptionResult splits the notifications of an unsubscription
+// request for the namespace or, if the URN has an ID, the service into
+// those the consumer is subscribed to and those it isn't. Every
+// notification is reported once.
+func getUnsubscriptionResult(commonName string, urn URN, notif []NotificationDescriptor,
+	eaaCtx *Context) UnsubscriptionResult {
+
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	result := UnsubscriptionResult{
+		URN:      &urn,
+		Removed:  []NotificationDescriptor{},
+		NotFound: []NotificationDescriptor{},
+	}
+	reported := make(map[UniqueNotif]bool)
+
+	for _, n := range notif {
+		key := UniqueNotif{
+			namespace:    urn.Namespace,
+			notifName:    subscriptionNotifName(n),
+			notifVersion: n.Version,
+		}
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		subscribed := false
+		if _, exists := eaaCtx.subscriptionInfo.m[key]; exists {
+			if urn.ID == "" {
+				subscribed = getNamespaceSubscriptionIndex(key, commonName, eaaCtx) != -1
+			} else {
+				subscribed = getServiceSubscriptionIndex(key, urn.ID, commonName,
+					eaaCtx) != -1
+			}
+		}
+
+		if subscribed {
+			result.Removed = append(result.Removed, n)
+		} else {
+			result.NotFound = append(result.NotFound, n)
+		}
+	}
+
+	return result
+}
+
 // removeAllSubscriptionsToNamespace removes all Client subscriptions to a given Namespace
 // notifications
 func removeAllSubscriptionsToNamespace(commonName string, namespace string, eaaCtx *Context) error {
+	if err := eaaCtx.subscriptions().removeScopeSubscriptions(commonName, namespace,
+		""); err != nil {
+		return storeError(err)
+	}
+
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -88,6 +503,7 @@ func removeAllSubscriptionsToNamespace(commonName string, namespace string, eaaC
 
 	for key, consumerSub := range eaaCtx.subscriptionInfo.m {
 		if key.namespace == namespace {
+			consumerSub.removeSubscriber("", commonName)
 			if index := getNamespaceSubscriptionIndex(key, commonName, eaaCtx); index != -1 {
 				consumerSub.namespaceSubscriptions = append(
 					consumerSub.namespaceSubscriptions[:index],
@@ -105,6 +521,15 @@ func addSubscriptionToService(commonName string, namespace string,
 	serviceID string, notif []NotificationDescriptor,
 	eaaCtx *Context) error {
 
+	if err := validateSubscriptionNotifications(notif); err != nil {
+		return err
+	}
+	if err := checkNamespaceAccess(commonName, namespace, eaaCtx); err != nil {
+		return err
+	}
+
+	// The limit is checked under the same lock as the subscriptions are
+	// stored and indexed, so that concurrent subscriptions can't exceed it
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -112,31 +537,55 @@ func addSubscriptionToService(commonName string, namespace string,
 		return errors.New("Eaa context not intialized. ")
 	}
 
+	if err := checkSubscriptionLimitLocked(commonName, namespace, serviceID, notif,
+		eaaCtx); err != nil {
+		return err
+	}
+
+	if err := eaaCtx.subscriptions().addSubscriptions(commonName, namespace, serviceID,
+		notif); err != nil {
+		return storeError(err)
+	}
+
 	for _, n := range notif {
-		key := UniqueNotif{
-			namespace:    namespace,
-			notifName:    n.Name,
-			notifVersion: n.Version,
-		}
+		indexServiceSubscription(commonName, namespace, serviceID, n, eaaCtx)
+	}
 
-		// If NamespaceNotif+service set not initialized, do so now
-		initServiceNotification(key, serviceID, n, eaaCtx)
+	return nil
+}
 
-		// If Consumer already subscribed, do nothing
-		index := getServiceSubscriptionIndex(key, serviceID, commonName, eaaCtx)
-		if index != -1 {
-			log.Infof("%s is already subscribed to %s - %s",
-				commonName, key, serviceID)
-			continue
-		}
+// indexServiceSubscription adds a service subscription of a consumer
+// to the subscription map, which has to be locked by the caller
+func indexServiceSubscription(commonName string, namespace string, serviceID string,
+	n NotificationDescriptor, eaaCtx *Context) {
 
-		// Add Consumer to Subscriber list
-		eaaCtx.subscriptionInfo.m[key].serviceSubscriptions[serviceID] =
-			append(eaaCtx.subscriptionInfo.m[key].serviceSubscriptions[serviceID],
-				commonName)
+	key := UniqueNotif{
+		namespace:    namespace,
+		notifName:    subscriptionNotifName(n),
+		notifVersion: n.Version,
 	}
 
-	return nil
+	// If NamespaceNotif+service set not initialized, do so now
+	initServiceNotification(key, serviceID, n, eaaCtx)
+	eaaCtx.subscriptionInfo.m[key].setFilter(serviceID, commonName, n.Filter)
+	eaaCtx.subscriptionInfo.m[key].setTransform(serviceID, commonName, n.Transform)
+	eaaCtx.subscriptionInfo.m[key].setQoS(serviceID, commonName, n.QoS)
+	eaaCtx.subscriptionInfo.m[key].setAggregationWindow(serviceID, commonName,
+		aggregationWindow(n))
+	eaaCtx.subscriptionInfo.m[key].setCreated(serviceID, commonName, time.Now())
+
+	// If Consumer already subscribed, do nothing
+	index := getServiceSubscriptionIndex(key, serviceID, commonName, eaaCtx)
+	if index != -1 {
+		log.Infof("%s is already subscribed to %s - %s",
+			commonName, key, serviceID)
+		return
+	}
+
+	// Add Consumer to Subscriber list
+	eaaCtx.subscriptionInfo.m[key].serviceSubscriptions[serviceID] =
+		append(eaaCtx.subscriptionInfo.m[key].serviceSubscriptions[serviceID],
+			commonName)
 }
 
 // removeSubscriptionToService unsubscribes a consumer from
@@ -144,6 +593,11 @@ func addSubscriptionToService(commonName string, namespace string,
 func removeSubscriptionToService(commonName string, namespace string, serviceID string,
 	notif []NotificationDescriptor, eaaCtx *Context) error {
 
+	if err := eaaCtx.subscriptions().removeSubscriptions(commonName, namespace, serviceID,
+		notif); err != nil {
+		return storeError(err)
+	}
+
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -154,7 +608,7 @@ func removeSubscriptionToService(commonName string, namespace string, serviceID
 	for _, n := range notif {
 		key := UniqueNotif{
 			namespace:    namespace,
-			notifName:    n.Name,
+			notifName:    subscriptionNotifName(n),
 			notifVersion: n.Version,
 		}
 
@@ -174,6 +628,7 @@ func removeSubscriptionToService(commonName string, namespace string, serviceID
 			continue
 		}
 
+		eaaCtx.subscriptionInfo.m[key].removeSubscriber(serviceID, commonName)
 		if index := getServiceSubscriptionIndex(key, serviceID,
 			commonName, eaaCtx); index != -1 {
 			eaaCtx.subscriptionInfo.m[key].serviceSubscriptions[serviceID] =
@@ -192,6 +647,11 @@ func removeSubscriptionToService(commonName string, namespace string, serviceID
 func removeAllSubscriptionsToService(commonName string, namespace string, serviceID string,
 	eaaCtx *Context) error {
 
+	if err := eaaCtx.subscriptions().removeScopeSubscriptions(commonName, namespace,
+		serviceID); err != nil {
+		return storeError(err)
+	}
+
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -204,6 +664,7 @@ func removeAllSubscriptionsToService(commonName string, namespace string, servic
 		_, serviceIDFound := consumerSub.serviceSubscriptions[serviceID]
 
 		if key.namespace == namespace && serviceIDFound {
+			consumerSub.removeSubscriber(serviceID, commonName)
 			if index := getServiceSubscriptionIndex(key, serviceID, commonName,
 				eaaCtx); index != -1 {
 				// Remove Client ID when it's present in SubscriberIDs
@@ -220,6 +681,10 @@ func removeAllSubscriptionsToService(commonName string, namespace string, servic
 // removeAllSubscriptions unsubscribes a consumer from
 // all notifications in all namespaces and services
 func removeAllSubscriptions(commonName string, eaaCtx *Context) error {
+	if err := eaaCtx.subscriptions().removeConsumer(commonName); err != nil {
+		return storeError(err)
+	}
+
 	eaaCtx.subscriptionInfo.Lock()
 	defer eaaCtx.subscriptionInfo.Unlock()
 
@@ -235,7 +700,9 @@ func removeAllSubscriptions(commonName string, eaaCtx *Context) error {
 		}
 
 		nsSubsInfo.namespaceSubscriptions.RemoveSubscriber(commonName)
+		nsSubsInfo.removeFilters(commonName)
 	}
+	eaaCtx.webhooks.remove(commonName)
 
 	return nil
 }
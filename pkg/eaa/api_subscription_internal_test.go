@@ -4,9 +4,17 @@
 package eaa
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 
 	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
@@ -26,9 +34,9 @@ var _ = g.Describe("api_subscription internal errors", func() {
 		eaaContext.serviceInfo.m = make(map[string]Service)
 		eaaContext.serviceInfo.m[serviceName] = Service{}
 
-		eaaContext.consumerConnections = consumerConns{m: make(map[string]ConsumerConnection)}
+		eaaContext.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
 
-		cc := ConsumerConnection{&websocket.Conn{}}
+		cc := []ConsumerConnection{{connection: &websocket.Conn{}}}
 		eaaContext.consumerConnections.m["aa"] = cc
 		eaaContext.consumerConnections.m["bb"] = cc
 		eaaContext.consumerConnections.m["cc"] = cc
@@ -120,4 +128,247 @@ var _ = g.Describe("api_subscription internal errors", func() {
 			})
 		})
 	})
+	g.Describe("addSubscriptionToNamespace", func() {
+		g.When("one of the notifications is invalid", func() {
+			g.It("should not subscribe to any of them", func() {
+				e := addSubscriptionToNamespace(cn, ns, []NotificationDescriptor{
+					{Name: "valid", Version: "1.0"},
+					{Name: "invalid"},
+				}, eaaContext)
+
+				Expect(e).To(MatchError(ContainSubstring("notification 1 (\"invalid\"): missing version")))
+				Expect(eaaContext.subscriptionInfo.m).To(BeEmpty())
+			})
+		})
+	})
+
+	g.Describe("addSubscriptionToService", func() {
+		g.When("one of the notifications is invalid", func() {
+			g.It("should not subscribe to any of them", func() {
+				e := addSubscriptionToService(cn, ns, serviceID, []NotificationDescriptor{
+					{Name: "valid", Version: "1.0"},
+					{Version: "1.0"},
+				}, eaaContext)
+
+				Expect(e).To(MatchError(ContainSubstring("notification 1: missing name")))
+				Expect(eaaContext.subscriptionInfo.m).To(BeEmpty())
+			})
+		})
+	})
+
+	g.Describe("subscription limit", func() {
+		notifications := func(names ...string) []NotificationDescriptor {
+			var notif []NotificationDescriptor
+			for _, name := range names {
+				notif = append(notif, NotificationDescriptor{Name: name, Version: "1.0"})
+			}
+			return notif
+		}
+
+		g.BeforeEach(func() {
+			eaaContext.cfg.MaxSubscriptionsPerConsumer = 3
+		})
+
+		g.It("counts namespace and service subscriptions combined", func() {
+			Expect(addSubscriptionToNamespace(cn, ns, notifications("n1", "n2"),
+				eaaContext)).To(Succeed())
+			Expect(addSubscriptionToService(cn, ns, serviceID, notifications("n1"),
+				eaaContext)).To(Succeed())
+			Expect(countSubscriptions(cn, eaaContext)).To(Equal(3))
+
+			e := addSubscriptionToService(cn, ns, serviceID, notifications("n2"), eaaContext)
+			Expect(e).To(MatchError(subscriptionLimitError{commonName: cn, limit: 3}))
+			e = addSubscriptionToNamespace(cn, "bb", notifications("n1"), eaaContext)
+			Expect(e).To(MatchError(subscriptionLimitError{commonName: cn, limit: 3}))
+			Expect(countSubscriptions(cn, eaaContext)).To(Equal(3))
+
+			g.By("limiting every consumer separately")
+			Expect(addSubscriptionToNamespace("aa:cc", ns, notifications("n1", "n2", "n3"),
+				eaaContext)).To(Succeed())
+		})
+
+		g.It("isn't exceeded by concurrent subscriptions", func() {
+			const subscribers = 16
+			errs := make(chan error, subscribers)
+			for i := 0; i < subscribers; i++ {
+				go func(name string) {
+					errs <- addSubscriptionToNamespace(cn, ns, notifications(name), eaaContext)
+				}(fmt.Sprintf("n%d", i))
+			}
+
+			succeeded := 0
+			for i := 0; i < subscribers; i++ {
+				if <-errs == nil {
+					succeeded++
+				}
+			}
+			Expect(succeeded).To(Equal(3))
+			Expect(countSubscriptions(cn, eaaContext)).To(Equal(3))
+		})
+
+		g.It("rejects a request taking the consumer over the limit as a whole", func() {
+			Expect(addSubscriptionToNamespace(cn, ns, notifications("n1", "n2"),
+				eaaContext)).To(Succeed())
+
+			e := addSubscriptionToNamespace(cn, ns, notifications("n3", "n4"), eaaContext)
+			Expect(e).To(BeAssignableToTypeOf(subscriptionLimitError{}))
+			Expect(countSubscriptions(cn, eaaContext)).To(Equal(2))
+		})
+
+		g.It("doesn't count resubscriptions", func() {
+			Expect(addSubscriptionToNamespace(cn, ns, notifications("n1", "n2", "n3"),
+				eaaContext)).To(Succeed())
+
+			Expect(addSubscriptionToNamespace(cn, ns, notifications("n3", "n1"),
+				eaaContext)).To(Succeed())
+			Expect(countSubscriptions(cn, eaaContext)).To(Equal(3))
+
+			Expect(removeSubscriptionToNamespace(cn, ns, notifications("n1"),
+				eaaContext)).To(Succeed())
+			Expect(addSubscriptionToService(cn, ns, serviceID, notifications("n1"),
+				eaaContext)).To(Succeed())
+		})
+
+		g.It("applies the default limit if none is configured", func() {
+			eaaContext.cfg.MaxSubscriptionsPerConsumer = 0
+			var names []string
+			for i := 0; i < defaultMaxSubscriptionsPerConsumer; i++ {
+				names = append(names, fmt.Sprintf("n%d", i))
+			}
+
+			// A request has at most maxSubscriptionNotifications notifications
+			for len(names) > 0 {
+				count := maxSubscriptionNotifications
+				if count > len(names) {
+					count = len(names)
+				}
+				Expect(addSubscriptionToNamespace(cn, ns, notifications(names[:count]...),
+					eaaContext)).To(Succeed())
+				names = names[count:]
+			}
+			Expect(addSubscriptionToNamespace(cn, ns, notifications("one-more"),
+				eaaContext)).To(HaveOccurred())
+		})
+
+		g.It("is reported by the subscription handlers", func() {
+			eaaContext.serviceInfo.m[ns+":"+serviceID] = Service{}
+			Expect(addSubscriptionToNamespace(cn, ns, notifications("n1", "n2", "n3"),
+				eaaContext)).To(Succeed())
+
+			rec := httptest.NewRecorder()
+			r := newTLSRequest(http.MethodPost, "/notifications/aa",
+				`[{"name":"n4","version":"1.0"}]`, cn, eaaContext)
+			SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": ns}))
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(rec.Body.String()).To(ContainSubstring(reasonSubscriptionLimit))
+
+			rec = httptest.NewRecorder()
+			r = newTLSRequest(http.MethodPost, "/notifications/aa/aa",
+				`[{"name":"n1","version":"1.0"}]`, cn, eaaContext)
+			SubscribeServiceNotifications(rec, mux.SetURLVars(r,
+				map[string]string{"urn.namespace": ns, "urn.id": serviceID}))
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(rec.Body.String()).To(ContainSubstring(reasonSubscriptionLimit))
+		})
+	})
+})
+
+var _ = g.Describe("Notification descriptor validation", func() {
+	descriptors := func(count int) []NotificationDescriptor {
+		notif := make([]NotificationDescriptor, count)
+		for i := range notif {
+			notif[i] = NotificationDescriptor{Name: fmt.Sprintf("n%d", i), Version: "1.0"}
+		}
+		return notif
+	}
+
+	table.DescribeTable("checks the notifications of a request",
+		func(n NotificationDescriptor, detail string) {
+			err := validateSubscriptionNotifications([]NotificationDescriptor{
+				{Name: "valid", Version: "1.0.0"}, n})
+			if detail == "" {
+				Expect(err).ToNot(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(detail))
+		},
+		table.Entry("valid", NotificationDescriptor{Name: "Event #1", Version: "v2.0.1-rc1",
+			Description: "an event", Filter: map[string]string{"zone": "1"}}, ""),
+		table.Entry("missing name", NotificationDescriptor{Version: "1.0"},
+			"notification 1: missing name"),
+		table.Entry("long name", NotificationDescriptor{
+			Name: strings.Repeat("n", maxNotificationNameLength+1), Version: "1.0"},
+			"notification 1 (\""+strings.Repeat("n", 64)+"\" \"1.0\"): name exceeds 128 bytes"),
+		table.Entry("unprintable name", NotificationDescriptor{Name: "n\x00", Version: "1.0"},
+			"notification 1 (\"n\\x00\" \"1.0\"): name contains invalid character '\\x00' at 1"),
+		table.Entry("missing version", NotificationDescriptor{Name: "n"},
+			"notification 1 (\"n\"): missing version"),
+		table.Entry("long version", NotificationDescriptor{Name: "n",
+			Version: strings.Repeat("1", maxNotificationVersionLength+1)},
+			"notification 1 (\"n\" \""+strings.Repeat("1", 32)+"\"): version exceeds 32 bytes"),
+		table.Entry("version with spaces", NotificationDescriptor{Name: "n", Version: "1 0"},
+			"notification 1 (\"n\" \"1 0\"): invalid version format"),
+		table.Entry("version ending with a separator", NotificationDescriptor{Name: "n",
+			Version: "1."}, "notification 1 (\"n\" \"1.\"): invalid version format"),
+		table.Entry("version with adjacent separators", NotificationDescriptor{Name: "n",
+			Version: "1..0"}, "notification 1 (\"n\" \"1..0\"): invalid version format"),
+		table.Entry("long description", NotificationDescriptor{Name: "n", Version: "1.0",
+			Description: strings.Repeat("d", maxNotificationDescriptionLength+1)},
+			"notification 1 (\"n\" \"1.0\"): description exceeds 1024 bytes"),
+		table.Entry("too many filter attributes", NotificationDescriptor{Name: "n",
+			Version: "1.0", Filter: func() map[string]string {
+				filter := make(map[string]string)
+				for i := 0; i <= maxNotificationFilterAttributes; i++ {
+					filter[fmt.Sprintf("a%d", i)] = "v"
+				}
+				return filter
+			}()}, "notification 1 (\"n\" \"1.0\"): filter has more than 16 attributes"),
+		table.Entry("empty filter attribute", NotificationDescriptor{Name: "n",
+			Version: "1.0", Filter: map[string]string{"": "v"}},
+			"notification 1 (\"n\" \"1.0\"): empty filter attribute"),
+		table.Entry("long filter attribute", NotificationDescriptor{Name: "n",
+			Version: "1.0", Filter: map[string]string{
+				strings.Repeat("k", maxNotificationFilterKeyLength+1): "v"}},
+			"notification 1 (\"n\" \"1.0\"): filter attribute exceeds 128 bytes"),
+		table.Entry("long filter value", NotificationDescriptor{Name: "n",
+			Version: "1.0", Filter: map[string]string{
+				"k": strings.Repeat("v", maxNotificationFilterValueLength+1)}},
+			`notification 1 ("n" "1.0"): filter value of "k" exceeds 256 bytes`),
+		table.Entry("name pattern", NotificationDescriptor{Name: "temperature.*",
+			Version: "1.0", NameMatch: nameMatchGlob}, ""),
+		table.Entry("unknown name match", NotificationDescriptor{Name: "n",
+			Version: "1.0", NameMatch: "regexp"},
+			`notification 1 ("n" "1.0"): unknown name match "regexp"`),
+		table.Entry("invalid name pattern", NotificationDescriptor{Name: "n[",
+			Version: "1.0", NameMatch: nameMatchGlob},
+			"notification 1 (\"n[\" \"1.0\"): invalid name pattern"),
+	)
+
+	g.It("limits the number of notifications of a request", func() {
+		Expect(validateSubscriptionNotifications(
+			descriptors(maxSubscriptionNotifications))).To(Succeed())
+		Expect(validateSubscriptionNotifications(
+			descriptors(maxSubscriptionNotifications + 1))).To(
+			MatchError("more than 256 notifications in a request"))
+	})
+
+	g.It("rejects a subscription request naming the offending notification", func() {
+		eaaCtx := newFanOutContext(nil)
+		body, err := json.Marshal(append(descriptors(2),
+			NotificationDescriptor{Name: "alarm", Version: "1.0 beta"}))
+		Expect(err).ToNot(HaveOccurred())
+
+		rec := httptest.NewRecorder()
+		r := newTLSRequest(http.MethodPost, "/subscriptions/ns", string(body),
+			"ns:consumer", eaaCtx)
+		SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+			map[string]string{"urn.namespace": "ns"}))
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonInvalidNotification))
+		Expect(resp.Detail).To(Equal("notification 2 (\"alarm\" \"1.0 beta\"): invalid version format"))
+	})
 })
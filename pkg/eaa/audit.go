@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/open-ness/edgenode/pkg/eaa/pb"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader carries the id correlating a request with its audit record
+const requestIDHeader = "X-Request-ID"
+
+const (
+	auditActionRegister    = "register"
+	auditActionDeregister  = "deregister"
+	auditActionSubscribe   = "subscribe"
+	auditActionUnsubscribe = "unsubscribe"
+	auditActionPublish     = "publish"
+	auditActionDisconnect  = "disconnect"
+	auditActionUpdate      = "update"
+	auditActionReload      = "reload"
+	auditActionBroadcast   = "broadcast"
+	auditActionExport      = "export"
+	auditActionImport      = "import"
+)
+
+// auditedRoutes maps names of the state-changing routes and of the export
+// of the subscriptions to their audit actions
+var auditedRoutes = map[string]string{
+	"BroadcastNotification":             auditActionBroadcast,
+	"DeregisterApplication":             auditActionDeregister,
+	"DisconnectClient":                  auditActionDisconnect,
+	"ExportSubscriptions":               auditActionExport,
+	"ImportSubscriptions":               auditActionImport,
+	"RegisterApplication":               auditActionRegister,
+	"ReloadConfig":                      auditActionReload,
+	"SubscribeNamespaceNotifications":   auditActionSubscribe,
+	"SubscribeServiceNotifications":     auditActionSubscribe,
+	"SubscribeServiceNotificationsBulk": auditActionSubscribe,
+	"UnsubscribeAllNotifications":       auditActionUnsubscribe,
+	"UnsubscribeNamespaceNotifications": auditActionUnsubscribe,
+	"UnsubscribeServiceNotifications":   auditActionUnsubscribe,
+	"UpdateApplication":                 auditActionUpdate,
+}
+
+// auditedGRPCMethods maps the state-changing gRPC methods to their
+// audit actions
+var auditedGRPCMethods = map[string]string{
+	"/pb.Eaa/Deregister":  auditActionDeregister,
+	"/pb.Eaa/Register":    auditActionRegister,
+	"/pb.Eaa/Subscribe":   auditActionSubscribe,
+	"/pb.Eaa/Unsubscribe": auditActionUnsubscribe,
+}
+
+// auditRecord describes a registration or subscription change
+type auditRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	RequestID  string    `json:"requestId"`
+	CommonName string    `json:"commonName"`
+	Action     string    `json:"action"`
+	// Target is the URN or namespace the action applies to, empty if
+	// it applies to all subscriptions or is given in the request body
+	Target string `json:"target,omitempty"`
+	// Status is the HTTP status code or the gRPC status code name
+	Status string `json:"status"`
+}
+
+// auditLogger writes audit records as JSON lines to a sink separate
+// from the debug log
+type auditLogger struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// newAuditLogger opens the audit log file for appending
+func newAuditLogger(path string) (*auditLogger, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open the audit log %s", path)
+	}
+	return &auditLogger{w: f}, nil
+}
+
+// record writes an audit record, it's a no-op if audit logging is disabled
+func (a *auditLogger) record(rec auditRecord) {
+	if a == nil {
+		return
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Errf("Failed to marshal audit record: %s", err.Error())
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	if _, err = a.w.Write(append(data, '\n')); err != nil {
+		log.Errf("Failed to write audit record: %s", err.Error())
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// requestID returns the id of the request, or generates a new one
+func requestID(id string) string {
+	if id == "" {
+		return uuid.New().String()
+	}
+	return id
+}
+
+// auditMiddleware returns the request id in the response header of every
+// request and writes an audit record of the state-changing ones
+func auditMiddleware(eaaCtx *Context) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := requestID(r.Header.Get(requestIDHeader))
+			w.Header().Set(requestIDHeader, id)
+
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			action, audited := auditedRoutes[route.GetName()]
+			if !audited {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			var commonName string
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				commonName = r.TLS.PeerCertificates[0].Subject.CommonName
+			}
+			eaaCtx.audit.record(auditRecord{
+				Timestamp:  time.Now().UTC(),
+				RequestID:  id,
+				CommonName: commonName,
+				Action:     action,
+				Target:     auditTarget(action, commonName, mux.Vars(r)),
+				Status:     strconv.Itoa(rec.status),
+			})
+		})
+	}
+}
+
+// auditTarget returns the URN or namespace of an HTTPS request
+func auditTarget(action, commonName string, vars map[string]string) string {
+	if action == auditActionRegister || action == auditActionDeregister {
+		return commonName
+	}
+	if action == auditActionDisconnect {
+		return vars["commonName"]
+	}
+	if id := vars["urn.id"]; id != "" {
+		return vars["urn.namespace"] + ":" + id
+	}
+	return vars["urn.namespace"]
+}
+
+// auditInterceptor returns the request id in the response header of every
+// unary gRPC call and writes an audit record of the state-changing ones
+func auditInterceptor(eaaCtx *Context) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(requestIDHeader); len(ids) > 0 {
+				id = ids[0]
+			}
+		}
+		id = requestID(id)
+		if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id)); err != nil {
+			log.Errf("Failed to set the gRPC request id header: %s", err.Error())
+		}
+
+		resp, err := handler(ctx, req)
+
+		action, audited := auditedGRPCMethods[info.FullMethod]
+		if !audited {
+			return resp, err
+		}
+
+		// An unauthenticated call is audited without a CommonName
+		commonName, _ := commonNameFromContext(ctx)
+		target := commonName
+		if sub, ok := req.(*pb.Subscription); ok {
+			target = ""
+			if urn := urnFromPB(sub.GetUrn()); urn != nil {
+				target = urn.Namespace
+				if urn.ID != "" {
+					target = urn.String()
+				}
+			}
+		}
+		eaaCtx.audit.record(auditRecord{
+			Timestamp:  time.Now().UTC(),
+			RequestID:  id,
+			CommonName: commonName,
+			Action:     action,
+			Target:     target,
+			Status:     status.Code(err).String(),
+		})
+
+		return resp, err
+	}
+}
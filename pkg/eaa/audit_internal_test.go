@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/open-ness/edgenode/pkg/eaa/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Audit logging", func() {
+	var (
+		eaaCtx *Context
+		sink   *bytes.Buffer
+	)
+
+	records := func() []auditRecord {
+		var recs []auditRecord
+		dec := json.NewDecoder(bytes.NewReader(sink.Bytes()))
+		for dec.More() {
+			var rec auditRecord
+			Expect(dec.Decode(&rec)).To(Succeed())
+			recs = append(recs, rec)
+		}
+		return recs
+	}
+
+	g.BeforeEach(func() {
+		sink = &bytes.Buffer{}
+		eaaCtx = &Context{audit: &auditLogger{w: sink}}
+		eaaCtx.serviceInfo.m = map[string]Service{
+			"ns:producer": {URN: &URN{Namespace: "ns", ID: "producer"}},
+		}
+	})
+
+	g.It("audits state-changing requests", func() {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest("POST", "/services", "{", "ns:producer", eaaCtx)
+		r.Header.Set(requestIDHeader, "req-1")
+		NewEaaRouter(eaaCtx).ServeHTTP(rec, r)
+
+		Expect(rec.Header().Get(requestIDHeader)).To(Equal("req-1"))
+		recs := records()
+		Expect(recs).To(HaveLen(1))
+		Expect(recs[0].RequestID).To(Equal("req-1"))
+		Expect(recs[0].CommonName).To(Equal("ns:producer"))
+		Expect(recs[0].Action).To(Equal(auditActionRegister))
+		Expect(recs[0].Target).To(Equal("ns:producer"))
+		Expect(recs[0].Status).To(Equal(strconv.Itoa(rec.Code)))
+		Expect(recs[0].Timestamp.IsZero()).To(BeFalse())
+	})
+
+	g.It("generates a request id and doesn't audit read-only requests", func() {
+		rec := httptest.NewRecorder()
+		NewEaaRouter(eaaCtx).ServeHTTP(rec, newTLSRequest("GET",
+			"/services/ns/producer", "", "ns:consumer", eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get(requestIDHeader)).ToNot(BeEmpty())
+		Expect(records()).To(BeEmpty())
+	})
+
+	g.It("audits state-changing gRPC calls", func() {
+		interceptor := auditInterceptor(eaaCtx)
+		_, err := interceptor(newPeerContext(context.Background(), "ns:consumer"),
+			&pb.Subscription{Urn: &pb.URN{Namespace: "ns", Id: "producer"}},
+			&grpc.UnaryServerInfo{FullMethod: "/pb.Eaa/Unsubscribe"},
+			func(context.Context, interface{}) (interface{}, error) {
+				return nil, status.Error(codes.Internal, reasonSubscriptionFailed)
+			})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+
+		recs := records()
+		Expect(recs).To(HaveLen(1))
+		Expect(recs[0].RequestID).ToNot(BeEmpty())
+		Expect(recs[0].CommonName).To(Equal("ns:consumer"))
+		Expect(recs[0].Action).To(Equal(auditActionUnsubscribe))
+		Expect(recs[0].Target).To(Equal("ns:producer"))
+		Expect(recs[0].Status).To(Equal(codes.Internal.String()))
+	})
+})
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultBroadcastRateLimit is the number of broadcasts per second an admin
+// can make if BroadcastRateLimit isn't configured
+const defaultBroadcastRateLimit = 1.0
+
+// broadcastRateLimit returns the number of broadcasts per second an admin
+// can make
+func broadcastRateLimit(eaaCtx *Context) float64 {
+	if limit := eaaCtx.config().BroadcastRateLimit; limit > 0 {
+		return limit
+	}
+	return defaultBroadcastRateLimit
+}
+
+// getConnectedConsumers returns the consumers connected to this EAA
+// instance, only the ones of the namespace unless it's empty
+func getConnectedConsumers(namespace string, eaaCtx *Context) []string {
+	eaaCtx.consumerConnections.RLock()
+	defer eaaCtx.consumerConnections.RUnlock()
+
+	var consumers []string
+	for commonName := range eaaCtx.consumerConnections.m {
+		if namespace != "" {
+			urn, err := CommonNameStringToURN(commonName)
+			if err != nil || urn.Namespace != namespace {
+				continue
+			}
+		}
+		consumers = append(consumers, commonName)
+	}
+	sort.Strings(consumers)
+	return consumers
+}
+
+// broadcastNotification sends a system broadcast of an admin to every
+// consumer connected to this EAA instance, or only to the ones of
+// the namespace unless it's empty. Subscriptions aren't matched and
+// the broadcast isn't replayed.
+func broadcastNotification(commonName string, namespace string,
+	notif *NotificationFromProducer, correlationID string,
+	eaaCtx *Context) (DeliverySummary, error) {
+
+	// The broadcast is sent on behalf of the admin if its CommonName is a URN
+	producer, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		producer = URN{}
+	}
+
+	msgPayload, err := json.Marshal(NotificationToConsumer{
+		Name:          notif.Name,
+		Version:       notif.Version,
+		Payload:       notif.Payload,
+		URN:           producer,
+		Sequence:      eaaCtx.replayBuffers.nextSequence(),
+		Priority:      notif.Priority,
+		CorrelationID: correlationID,
+		Broadcast:     true,
+	})
+	if err != nil {
+		return DeliverySummary{}, errors.Wrap(err, "Failed to marshal the broadcast JSON")
+	}
+
+	recipients := getConnectedConsumers(namespace, eaaCtx)
+	failed := sendNotificationToSubscribers(recipients, nil, msgPayload, nil, notif.Priority,
+		time.Time{}, correlationID, eaaCtx)
+
+	summary := DeliverySummary{Subscribers: len(recipients), Failed: len(failed)}
+	summary.Delivered = summary.Subscribers - summary.Failed
+	return summary, nil
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Broadcast notification", func() {
+	var (
+		eaaCtx *Context
+		sent   []chan []byte
+		other  chan []byte
+	)
+
+	g.BeforeEach(func() {
+		var conns []notificationConn
+		sent = nil
+		for i := 0; i < 2; i++ {
+			ch := make(chan []byte, 1)
+			conns = append(conns, &fakeNotificationConn{sent: ch})
+			sent = append(sent, ch)
+		}
+		eaaCtx = newFanOutContext(conns)
+		eaaCtx.cfg.AdminCommonNames = []string{"ns:admin"}
+
+		// A consumer of another namespace without subscriptions
+		other = make(chan []byte, 1)
+		eaaCtx.consumerConnections.m["other:consumer"] = []ConsumerConnection{{
+			connection: &fakeNotificationConn{sent: other}}}
+	})
+
+	broadcast := func(cn, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		BroadcastNotification(rec, newTLSRequest(http.MethodPost, "/admin/broadcast"+query,
+			`{"name":"maintenance","version":"1.0","payload":{"in":"5m"}}`, cn, eaaCtx))
+		return rec
+	}
+
+	received := func(ch chan []byte) NotificationToConsumer {
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-ch, &notif)).To(Succeed())
+		return notif
+	}
+
+	g.It("is sent to every connected consumer regardless of subscriptions", func() {
+		rec := broadcast("ns:admin", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var summary DeliverySummary
+		Expect(json.NewDecoder(rec.Body).Decode(&summary)).To(Succeed())
+		Expect(summary).To(Equal(DeliverySummary{Subscribers: 3, Delivered: 3}))
+
+		for _, ch := range append(sent, other) {
+			notif := received(ch)
+			Expect(notif.Broadcast).To(BeTrue())
+			Expect(notif.Name).To(Equal("maintenance"))
+			Expect(notif.URN).To(Equal(URN{ID: "admin", Namespace: "ns"}))
+			Expect(notif.Payload).To(MatchJSON(`{"in":"5m"}`))
+		}
+	})
+
+	g.It("is limited to the consumers of the namespace", func() {
+		rec := broadcast("ns:admin", "?namespace=other")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		Expect(received(other).Broadcast).To(BeTrue())
+		for _, ch := range sent {
+			Expect(ch).To(BeEmpty())
+		}
+	})
+
+	g.It("is rejected for a consumer", func() {
+		rec := broadcast("ns:consumer0", "")
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonAdminAccessDenied))
+		Expect(other).To(BeEmpty())
+	})
+
+	g.It("is rejected for an invalid namespace", func() {
+		rec := broadcast("ns:admin", "?namespace=a:b")
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(other).To(BeEmpty())
+	})
+
+	g.It("is rate limited", func() {
+		Expect(broadcast("ns:admin", "").Code).To(Equal(http.StatusOK))
+
+		rec := broadcast("ns:admin", "")
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonRateLimitExceeded))
+	})
+})
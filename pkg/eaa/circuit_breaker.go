@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// Defaults of the Message Broker circuit breaker applied if it's not
+// configured
+const (
+	defaultBrokerCircuitThreshold = 5
+	defaultBrokerCircuitCooldown  = 30 * time.Second
+)
+
+// circuitState is the state of the Message Broker circuit breaker, it's
+// exposed as the value of the breaker state metric
+type circuitState int
+
+const (
+	// circuitClosed lets the publishes through
+	circuitClosed circuitState = iota
+	// circuitOpen rejects the publishes until the cooldown elapses
+	circuitOpen
+	// circuitHalfOpen lets a single probe publish through, which closes
+	// the breaker if it succeeds and opens it again if it fails
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("circuitState(%d)", int(s))
+	}
+}
+
+// brokerCircuitOpenError is returned for a publish rejected by the open
+// circuit breaker without contacting the Message Broker
+type brokerCircuitOpenError struct {
+	retryAfter time.Duration
+}
+
+func (e *brokerCircuitOpenError) Error() string {
+	return fmt.Sprintf("Message Broker circuit breaker is open, retry in %v", e.retryAfter)
+}
+
+// isBrokerCircuitOpen checks if a publish was rejected by the open
+// circuit breaker
+func isBrokerCircuitOpen(err error) bool {
+	var openErr *brokerCircuitOpenError
+	return errors.As(err, &openErr)
+}
+
+// publishBreaker is the circuit breaker of the publishes to the Message
+// Broker. After the threshold of consecutive failed publishes it opens and
+// rejects the publishes for the cooldown, so that requests fail fast during
+// a broker outage instead of waiting for the publish timeout. Publishes
+// cancelled by the caller don't count. The zero value is a closed breaker.
+type publishBreaker struct {
+	sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// setState changes the state of the breaker, which has to be locked by
+// the caller
+func (b *publishBreaker) setState(state circuitState) {
+	if b.state != state {
+		log.Infof("Message Broker circuit breaker %s", state)
+	}
+	b.state = state
+	brokerCircuitState.Set(float64(state))
+}
+
+// allow checks if a publish may go through. Once the cooldown of the open
+// breaker elapses the caller is let through as the probe of the half-open
+// breaker, while the other publishes are rejected until its result is
+// recorded.
+func (b *publishBreaker) allow(cooldown time.Duration, now time.Time) error {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if elapsed := now.Sub(b.openedAt); elapsed < cooldown {
+			return &brokerCircuitOpenError{retryAfter: cooldown - elapsed}
+		}
+		b.setState(circuitHalfOpen)
+	case circuitHalfOpen:
+		return &brokerCircuitOpenError{retryAfter: time.Second}
+	}
+	return nil
+}
+
+// record updates the breaker with the result of a publish it allowed
+func (b *publishBreaker) record(err error, threshold int, now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.setState(circuitClosed)
+	case errors.Is(err, context.Canceled):
+		// The probe was abandoned, the next publish probes again
+		if b.state == circuitHalfOpen {
+			b.setState(circuitOpen)
+		}
+	default:
+		b.failures++
+		if b.state == circuitHalfOpen ||
+			(b.state == circuitClosed && b.failures >= threshold) {
+			log.Warningf("%d consecutive Message Broker publishes failed, last error: %v",
+				b.failures, err)
+			b.openedAt = now
+			b.setState(circuitOpen)
+		}
+	}
+}
+
+// brokerCircuitSettings returns the threshold and the cooldown of
+// the circuit breaker, a negative threshold disables it
+func brokerCircuitSettings(eaaCtx *Context) (int, time.Duration) {
+	cfg := eaaCtx.config()
+	threshold := cfg.BrokerCircuitThreshold
+	if threshold == 0 {
+		threshold = defaultBrokerCircuitThreshold
+	}
+	cooldown := cfg.BrokerCircuitCooldown.Duration
+	if cooldown <= 0 {
+		cooldown = defaultBrokerCircuitCooldown
+	}
+	return threshold, cooldown
+}
+
+// publishThroughBreaker publishes the message to the topic of the Message
+// Broker unless the circuit breaker rejects it
+func publishThroughBreaker(ctx context.Context, topic string, msg *message.Message,
+	eaaCtx *Context) error {
+
+	threshold, cooldown := brokerCircuitSettings(eaaCtx)
+	if threshold < 0 {
+		return eaaCtx.MsgBrokerCtx.publish(ctx, topic, msg)
+	}
+
+	if err := eaaCtx.publishBreaker.allow(cooldown, time.Now()); err != nil {
+		brokerCircuitRejectionsTotal.Inc()
+		return err
+	}
+	err := eaaCtx.MsgBrokerCtx.publish(ctx, topic, msg)
+	eaaCtx.publishBreaker.record(err, threshold, time.Now())
+	return err
+}
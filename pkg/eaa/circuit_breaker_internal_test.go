@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = g.Describe("Message Broker circuit breaker", func() {
+	var (
+		eaaCtx   *Context
+		attempts int32
+	)
+
+	register := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		RegisterApplication(rec, newTLSRequest("POST", "/services",
+			`{"endpoint_uri":"https://1.2.3.4"}`, "ns:producer", eaaCtx))
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		attempts = 0
+		eaaCtx = &Context{}
+		eaaCtx.cfg.BrokerCircuitThreshold = 2
+		eaaCtx.cfg.BrokerCircuitCooldown.Duration = 50 * time.Millisecond
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+	})
+
+	g.It("opens after consecutive failures and closes after a successful probe", func() {
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 2, &attempts}
+		rejected := testutil.ToFloat64(brokerCircuitRejectionsTotal)
+
+		Expect(register().Code).To(Equal(http.StatusInternalServerError))
+		Expect(register().Code).To(Equal(http.StatusInternalServerError))
+		Expect(testutil.ToFloat64(brokerCircuitState)).To(BeEquivalentTo(circuitOpen))
+
+		rec := register()
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonBrokerUnavailable))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+		Expect(testutil.ToFloat64(brokerCircuitRejectionsTotal)).To(Equal(rejected + 1))
+
+		time.Sleep(eaaCtx.cfg.BrokerCircuitCooldown.Duration)
+		Expect(register().Code).To(Equal(http.StatusOK))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+		Expect(testutil.ToFloat64(brokerCircuitState)).To(BeEquivalentTo(circuitClosed))
+		Expect(register().Code).To(Equal(http.StatusOK))
+	})
+
+	g.It("opens again if the probe fails", func() {
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 3, &attempts}
+
+		register()
+		register()
+		time.Sleep(eaaCtx.cfg.BrokerCircuitCooldown.Duration)
+		Expect(register().Code).To(Equal(http.StatusInternalServerError))
+		Expect(testutil.ToFloat64(brokerCircuitState)).To(BeEquivalentTo(circuitOpen))
+		Expect(register().Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+	})
+
+	g.It("doesn't retry a rejected publish", func() {
+		eaaCtx.cfg.BrokerPublishAttempts = 5
+		eaaCtx.cfg.BrokerPublishRetryDelay.Duration = time.Millisecond
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 5, &attempts}
+
+		Expect(register().Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+	})
+
+	g.It("stays closed if disabled", func() {
+		eaaCtx.cfg.BrokerCircuitThreshold = -1
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 3, &attempts}
+
+		for i := 0; i < 3; i++ {
+			Expect(register().Code).To(Equal(http.StatusInternalServerError))
+		}
+		Expect(register().Code).To(Equal(http.StatusOK))
+	})
+
+	g.It("lets a single probe through and ignores cancelled publishes", func() {
+		var b publishBreaker
+		now := time.Now()
+		failure := errors.New("broker unavailable")
+
+		Expect(b.allow(time.Second, now)).To(Succeed())
+		b.record(context.Canceled, 1, now)
+		Expect(b.allow(time.Second, now)).To(Succeed())
+		b.record(failure, 1, now)
+		Expect(isBrokerCircuitOpen(b.allow(time.Second, now))).To(BeTrue())
+
+		later := now.Add(time.Second)
+		Expect(b.allow(time.Second, later)).To(Succeed())
+		Expect(isBrokerCircuitOpen(b.allow(time.Second, later))).To(BeTrue())
+		b.record(context.Canceled, 1, later)
+		Expect(b.allow(time.Second, later)).To(Succeed())
+		b.record(nil, 1, later)
+		Expect(b.allow(time.Second, later)).To(Succeed())
+	})
+})
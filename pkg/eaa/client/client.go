@@ -0,0 +1,392 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+// Package client is a Go client of the EAA HTTPS API for producers and
+// consumers. It authenticates with a client certificate, whose CommonName
+// "namespace:id" is the URN of the application.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	logger "github.com/open-ness/common/log"
+	"github.com/open-ness/edgenode/pkg/eaa"
+	"github.com/pkg/errors"
+)
+
+var log = logger.DefaultLogger.WithField("eaa-client", nil)
+
+// DefaultReconnectInterval is how long Receive waits before reconnecting
+// if Config.ReconnectInterval is not set
+const DefaultReconnectInterval = 5 * time.Second
+
+// Config describes the EAA endpoint and the credentials of a Client
+type Config struct {
+	// Endpoint is the address of the EAA HTTPS API, e.g. "eaa.openness:443"
+	Endpoint string
+	// CertPath and KeyPath are the PEM files of the client certificate
+	CertPath string
+	KeyPath  string
+	// CAPath is the PEM file of the CA verifying the EAA certificate
+	CAPath string
+	// ReconnectInterval is how long Receive waits before reconnecting
+	// the notification websocket, 0 applies DefaultReconnectInterval
+	ReconnectInterval time.Duration
+}
+
+// Error is returned when EAA responds to a request with an error
+type Error struct {
+	StatusCode int
+	// Response is the error response of EAA, its Error is empty if
+	// the response had no body
+	Response eaa.ErrorResponse
+}
+
+func (e *Error) Error() string {
+	if e.Response.Error == "" {
+		return fmt.Sprintf("EAA responded with %d %s", e.StatusCode,
+			http.StatusText(e.StatusCode))
+	}
+	if e.Response.Detail == "" {
+		return fmt.Sprintf("EAA responded with %d: %s", e.StatusCode, e.Response.Error)
+	}
+	return fmt.Sprintf("EAA responded with %d: %s: %s", e.StatusCode, e.Response.Error,
+		e.Response.Detail)
+}
+
+// Client calls the EAA HTTPS API on behalf of an application
+type Client struct {
+	baseURL           url.URL
+	urn               eaa.URN
+	http              *http.Client
+	dialer            *websocket.Dialer
+	reconnectInterval time.Duration
+}
+
+// New creates a Client with the credentials of the config. The URN of
+// the application is derived from the CommonName of the client certificate.
+func New(cfg Config) (*Client, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load the client certificate")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse the client certificate")
+	}
+	urn, err := eaa.CommonNameStringToURN(leaf.Subject.CommonName)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Clean(cfg.CAPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load the CA certificate")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("Failed to append the CA certificate to the pool")
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	reconnectInterval := cfg.ReconnectInterval
+	if reconnectInterval <= 0 {
+		reconnectInterval = DefaultReconnectInterval
+	}
+
+	return &Client{
+		baseURL: url.URL{Scheme: "https", Host: cfg.Endpoint},
+		urn:     urn,
+		http: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		dialer: &websocket.Dialer{
+			TLSClientConfig:  tlsConfig,
+			HandshakeTimeout: 45 * time.Second,
+		},
+		reconnectInterval: reconnectInterval,
+	}, nil
+}
+
+// URN returns the URN of the application
+func (c *Client) URN() eaa.URN {
+	return c.urn
+}
+
+// do sends a request with the JSON of in as the body, if not nil, and
+// decodes the JSON response into out, if not nil
+func (c *Client) do(ctx context.Context, method string, path string,
+	in interface{}, out interface{}) error {
+
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return errors.Wrap(err, "Failed to encode the request")
+		}
+	}
+
+	u := c.baseURL
+	u.Path = path
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		// The error response is optional
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr.Response)
+		return apiErr
+	}
+	if out != nil {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Wrap(err, "Failed to decode the response")
+		}
+	}
+	return nil
+}
+
+// Register registers the application as a producer of the service. The URN
+// of the service is set to the URN of the application.
+func (c *Client) Register(ctx context.Context, serv eaa.Service) error {
+	urn := c.urn
+	serv.URN = &urn
+	return c.do(ctx, http.MethodPost, "/services", serv, nil)
+}
+
+// Renew renews the registration of the application's service
+func (c *Client) Renew(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/services/renew", nil, nil)
+}
+
+// UpdateEndpointHealth renews the registration of the application's service
+// and updates the health status of its endpoints
+func (c *Client) UpdateEndpointHealth(ctx context.Context,
+	endpoints []eaa.ServiceEndpoint) error {
+	return c.do(ctx, http.MethodPost, "/services/renew",
+		eaa.EndpointHealthUpdate{Endpoints: endpoints}, nil)
+}
+
+// Update changes the fields of the application's service set in the update
+// and returns the updated service
+func (c *Client) Update(ctx context.Context, update eaa.ServiceUpdate) (eaa.Service, error) {
+	var serv eaa.Service
+	err := c.do(ctx, http.MethodPatch, "/services", update, &serv)
+	return serv, err
+}
+
+// Deregister deregisters the application's service
+func (c *Client) Deregister(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/services", nil, nil)
+}
+
+// GetServices returns the registered services
+func (c *Client) GetServices(ctx context.Context) (eaa.ServiceList, error) {
+	var list eaa.ServiceList
+	err := c.do(ctx, http.MethodGet, "/services", nil, &list)
+	return list, err
+}
+
+// GetSubscribers returns the consumers subscribed to notifications of
+// the application's service
+func (c *Client) GetSubscribers(ctx context.Context) (eaa.ServiceSubscribers, error) {
+	var subscribers eaa.ServiceSubscribers
+	err := c.do(ctx, http.MethodGet, "/services/subscribers", nil, &subscribers)
+	return subscribers, err
+}
+
+// Push sends a notification to the subscribers of the application's
+// service and returns the delivery summary
+func (c *Client) Push(ctx context.Context,
+	notif eaa.NotificationFromProducer) (eaa.DeliverySummary, error) {
+
+	var summary eaa.DeliverySummary
+	err := c.do(ctx, http.MethodPost, "/notifications", notif, &summary)
+	return summary, err
+}
+
+// PushBulk sends notifications to the subscribers of the application's
+// service in one request and returns the result of each of them, in their
+// order. Notifications which failed are reported by their results, not by
+// the error.
+func (c *Client) PushBulk(ctx context.Context,
+	notifs []eaa.NotificationFromProducer) (eaa.NotificationResultList, error) {
+
+	var results eaa.NotificationResultList
+	err := c.do(ctx, http.MethodPost, "/notifications/bulk", notifs, &results)
+	return results, err
+}
+
+// subscriptionPath returns the path of the subscriptions to a namespace or,
+// if id isn't empty, to a service
+func subscriptionPath(namespace string, id string) string {
+	if id == "" {
+		return "/subscriptions/" + url.PathEscape(namespace)
+	}
+	return "/subscriptions/" + url.PathEscape(namespace) + "/" + url.PathEscape(id)
+}
+
+// Subscribe subscribes the application to notifications of a namespace,
+// which may be a glob pattern
+func (c *Client) Subscribe(ctx context.Context, namespace string,
+	notifs []eaa.NotificationDescriptor) error {
+	return c.do(ctx, http.MethodPost, subscriptionPath(namespace, ""), notifs, nil)
+}
+
+// SubscribeService subscribes the application to notifications of
+// a service
+func (c *Client) SubscribeService(ctx context.Context, urn eaa.URN,
+	notifs []eaa.NotificationDescriptor) error {
+	return c.do(ctx, http.MethodPost, subscriptionPath(urn.Namespace, urn.ID), notifs, nil)
+}
+
+// Unsubscribe unsubscribes the application from notifications of
+// a namespace and returns which of them it was subscribed to
+func (c *Client) Unsubscribe(ctx context.Context, namespace string,
+	notifs []eaa.NotificationDescriptor) (eaa.UnsubscriptionResult, error) {
+
+	var result eaa.UnsubscriptionResult
+	err := c.do(ctx, http.MethodDelete, subscriptionPath(namespace, ""), notifs, &result)
+	return result, err
+}
+
+// UnsubscribeService unsubscribes the application from notifications of
+// a service and returns which of them it was subscribed to
+func (c *Client) UnsubscribeService(ctx context.Context, urn eaa.URN,
+	notifs []eaa.NotificationDescriptor) (eaa.UnsubscriptionResult, error) {
+
+	var result eaa.UnsubscriptionResult
+	err := c.do(ctx, http.MethodDelete, subscriptionPath(urn.Namespace, urn.ID), notifs,
+		&result)
+	return result, err
+}
+
+// RenewSubscriptions renews the lease of the application's subscriptions
+func (c *Client) RenewSubscriptions(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/subscriptions/renew", nil, nil)
+}
+
+// UnsubscribeAll unsubscribes the application from all notifications
+func (c *Client) UnsubscribeAll(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/subscriptions", nil, nil)
+}
+
+// GetSubscriptionStats returns the delivery statistics of the application's
+// subscriptions
+func (c *Client) GetSubscriptionStats(ctx context.Context) (eaa.SubscriptionStatsList, error) {
+	var stats eaa.SubscriptionStatsList
+	err := c.do(ctx, http.MethodGet, "/subscriptions/stats", nil, &stats)
+	return stats, err
+}
+
+// GetSubscriptions returns the subscriptions of the application
+func (c *Client) GetSubscriptions(ctx context.Context) (eaa.SubscriptionList, error) {
+	var list eaa.SubscriptionList
+	err := c.do(ctx, http.MethodGet, "/subscriptions", nil, &list)
+	return list, err
+}
+
+// PreviewSubscriptions returns the subscriptions the application would have
+// after the change, without applying it
+func (c *Client) PreviewSubscriptions(ctx context.Context,
+	change eaa.SubscriptionChange) (eaa.SubscriptionList, error) {
+
+	var list eaa.SubscriptionList
+	err := c.do(ctx, http.MethodPost, "/subscriptions/preview", change, &list)
+	return list, err
+}
+
+// Receive connects to the notification websocket and calls handle for
+// every notification until the context is done. A lost connection is
+// reestablished after the reconnect interval, notifications sent meanwhile
+// are replayed if EAA retains them. It returns the error of the context.
+func (c *Client) Receive(ctx context.Context,
+	handle func(eaa.NotificationToConsumer)) error {
+
+	var lastSequence uint64
+	for {
+		err := c.receive(ctx, &lastSequence, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warningf("Notification websocket of %s lost, reconnecting in %v: %v",
+			c.urn.String(), c.reconnectInterval, err)
+
+		select {
+		case <-time.After(c.reconnectInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// receive reads notifications from a single websocket connection until it
+// fails or the context is done
+func (c *Client) receive(ctx context.Context, lastSequence *uint64,
+	handle func(eaa.NotificationToConsumer)) error {
+
+	u := c.baseURL
+	u.Scheme = "wss"
+	u.Path = "/notifications"
+	if *lastSequence != 0 {
+		u.RawQuery = url.Values{
+			"since": []string{strconv.FormatUint(*lastSequence, 10)}}.Encode()
+	}
+
+	// EAA identifies the consumer websocket by the Host header
+	header := http.Header{"Host": []string{c.urn.String()}}
+	conn, resp, err := c.dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return &Error{StatusCode: resp.StatusCode}
+		}
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+			_ = conn.Close()
+		}
+	}()
+
+	for {
+		var notif eaa.NotificationToConsumer
+		if err = conn.ReadJSON(&notif); err != nil {
+			return err
+		}
+		if notif.Sequence != 0 {
+			*lastSequence = notif.Sequence
+		}
+		handle(notif)
+	}
+}
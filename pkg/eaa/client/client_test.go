@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/open-ness/edgenode/pkg/eaa"
+	"github.com/open-ness/edgenode/pkg/eaa/client"
+)
+
+// issueCert creates a certificate signed by the CA, or a self-signed CA
+// certificate if ca is nil
+func issueCert(commonName string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, interface{}(key)
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	Expect(err).ToNot(HaveOccurred())
+	leaf, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writePEM writes the certificate and its key to PEM files in the directory
+func writePEM(dir string, name string, cert tls.Certificate) {
+	Expect(ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)).To(Succeed())
+
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600)).To(Succeed())
+}
+
+var _ = Describe("EAA client", func() {
+	var (
+		server   *httptest.Server
+		c        *client.Client
+		certsDir string
+		requests chan string
+		bodies   chan []byte
+		// notifications sent on every websocket connection
+		connections chan []eaa.NotificationToConsumer
+	)
+
+	ctx := context.Background()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		body, err := ioutil.ReadAll(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		requests <- r.Method + " " + r.URL.RequestURI() + " " + commonName
+		bodies <- body
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/notifications":
+			Expect(r.Host).To(Equal(commonName))
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			Expect(err).ToNot(HaveOccurred())
+			for _, notif := range <-connections {
+				Expect(conn.WriteJSON(notif)).To(Succeed())
+			}
+			conn.Close()
+		case r.Method == http.MethodGet && r.URL.Path == "/services":
+			Expect(json.NewEncoder(w).Encode(eaa.ServiceList{Services: []eaa.Service{
+				{URN: &eaa.URN{Namespace: "ns", ID: "producer"}}}})).To(Succeed())
+		case r.URL.Path == "/services/subscribers":
+			Expect(json.NewEncoder(w).Encode(eaa.ServiceSubscribers{
+				URN:         &eaa.URN{Namespace: "ns", ID: "app"},
+				Subscribers: []string{"ns:consumer"}})).To(Succeed())
+		case r.URL.Path == "/notifications/bulk":
+			w.WriteHeader(http.StatusMultiStatus)
+			Expect(json.NewEncoder(w).Encode(eaa.NotificationResultList{
+				Results: []eaa.NotificationResult{
+					{Code: http.StatusAccepted, Summary: &eaa.DeliverySummary{}},
+					{Code: http.StatusBadRequest, Error: "invalid_notification"},
+				}})).To(Succeed())
+		case r.URL.Path == "/notifications":
+			w.WriteHeader(http.StatusAccepted)
+			Expect(json.NewEncoder(w).Encode(eaa.DeliverySummary{Subscribers: 1,
+				Delivered: 1})).To(Succeed())
+		case r.Method == http.MethodDelete && r.URL.Path == "/subscriptions/ns":
+			Expect(json.NewEncoder(w).Encode(eaa.UnsubscriptionResult{
+				URN:      &eaa.URN{Namespace: "ns"},
+				Removed:  []eaa.NotificationDescriptor{{Name: "n1", Version: "1.0"}},
+				NotFound: []eaa.NotificationDescriptor{}})).To(Succeed())
+		case r.URL.Path == "/subscriptions/denied":
+			w.WriteHeader(http.StatusForbidden)
+			Expect(json.NewEncoder(w).Encode(eaa.ErrorResponse{
+				Error: "namespace_access_denied", Code: http.StatusForbidden})).To(Succeed())
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		certsDir, err = ioutil.TempDir("", "eaa-client")
+		Expect(err).ToNot(HaveOccurred())
+
+		ca := issueCert("root", nil)
+		writePEM(certsDir, "root", ca)
+		writePEM(certsDir, "client", issueCert("ns:app", &ca))
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.Leaf)
+		server = httptest.NewUnstartedServer(http.HandlerFunc(handler))
+		server.TLS = &tls.Config{
+			Certificates: []tls.Certificate{issueCert("eaa.openness", &ca)},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		}
+		server.StartTLS()
+
+		requests = make(chan string, 10)
+		bodies = make(chan []byte, 10)
+		connections = make(chan []eaa.NotificationToConsumer, 10)
+
+		c, err = client.New(client.Config{
+			Endpoint:          strings.TrimPrefix(server.URL, "https://"),
+			CertPath:          filepath.Join(certsDir, "client.pem"),
+			KeyPath:           filepath.Join(certsDir, "client-key.pem"),
+			CAPath:            filepath.Join(certsDir, "root.pem"),
+			ReconnectInterval: time.Millisecond,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(certsDir)
+	})
+
+	It("derives the URN from the client certificate", func() {
+		Expect(c.URN()).To(Equal(eaa.URN{Namespace: "ns", ID: "app"}))
+	})
+
+	It("registers the service of the application", func() {
+		Expect(c.Register(ctx, eaa.Service{EndpointURI: "https://1.2.3.4"})).To(Succeed())
+
+		var serv eaa.Service
+		Expect(<-requests).To(Equal("POST /services ns:app"))
+		Expect(json.Unmarshal(<-bodies, &serv)).To(Succeed())
+		Expect(serv).To(Equal(eaa.Service{URN: &eaa.URN{Namespace: "ns", ID: "app"},
+			EndpointURI: "https://1.2.3.4"}))
+
+		Expect(c.Deregister(ctx)).To(Succeed())
+		Expect(<-requests).To(Equal("DELETE /services ns:app"))
+	})
+
+	It("returns the services and the delivery summary", func() {
+		list, err := c.GetServices(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list.Services).To(HaveLen(1))
+
+		subscribers, err := c.GetSubscribers(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subscribers.Subscribers).To(Equal([]string{"ns:consumer"}))
+
+		summary, err := c.Push(ctx, eaa.NotificationFromProducer{Name: "n1", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(eaa.DeliverySummary{Subscribers: 1, Delivered: 1}))
+
+		results, err := c.PushBulk(ctx, []eaa.NotificationFromProducer{
+			{Name: "n1", Version: "1.0"}, {Name: "n1"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results.Results).To(HaveLen(2))
+		Expect(results.Results[1].Error).To(Equal("invalid_notification"))
+	})
+
+	It("manages subscriptions", func() {
+		notifs := []eaa.NotificationDescriptor{{Name: "n1", Version: "1.0"}}
+		Expect(c.Subscribe(ctx, "ns", notifs)).To(Succeed())
+		Expect(c.SubscribeService(ctx, eaa.URN{Namespace: "ns", ID: "p"}, notifs)).To(Succeed())
+		result, err := c.Unsubscribe(ctx, "ns", notifs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Removed).To(Equal(notifs))
+		Expect(c.UnsubscribeAll(ctx)).To(Succeed())
+
+		Expect(<-requests).To(Equal("POST /subscriptions/ns ns:app"))
+		Expect(<-requests).To(Equal("POST /subscriptions/ns/p ns:app"))
+		Expect(<-requests).To(Equal("DELETE /subscriptions/ns ns:app"))
+		Expect(<-requests).To(Equal("DELETE /subscriptions ns:app"))
+	})
+
+	It("returns the error response of EAA", func() {
+		err := c.Subscribe(ctx, "denied", nil)
+
+		Expect(err).To(BeAssignableToTypeOf(&client.Error{}))
+		Expect(err.(*client.Error).StatusCode).To(Equal(http.StatusForbidden))
+		Expect(err.(*client.Error).Response.Error).To(Equal("namespace_access_denied"))
+	})
+
+	It("receives notifications and reconnects", func() {
+		connections <- []eaa.NotificationToConsumer{{Name: "n1", Sequence: 1}}
+		connections <- []eaa.NotificationToConsumer{{Name: "n2", Sequence: 2}}
+
+		receiveCtx, cancel := context.WithCancel(ctx)
+		received := make(chan string, 2)
+		done := make(chan error)
+		go func() {
+			done <- c.Receive(receiveCtx, func(notif eaa.NotificationToConsumer) {
+				received <- notif.Name
+			})
+		}()
+
+		Eventually(received).Should(Receive(Equal("n1")))
+		Eventually(received).Should(Receive(Equal("n2")))
+		Expect(<-requests).To(Equal("GET /notifications ns:app"))
+		Expect(<-requests).To(Equal("GET /notifications?since=1 ns:app"))
+
+		cancel()
+		Eventually(done).Should(Receive(Equal(context.Canceled)))
+	})
+})
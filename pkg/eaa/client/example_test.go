@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/open-ness/edgenode/pkg/eaa"
+	"github.com/open-ness/edgenode/pkg/eaa/client"
+)
+
+func Example_producer() {
+	c, err := client.New(client.Config{
+		Endpoint: "eaa.openness:443",
+		CertPath: "certs/cert.pem",
+		KeyPath:  "certs/key.pem",
+		CAPath:   "certs/root.pem",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	ctx := context.Background()
+	err = c.Register(ctx, eaa.Service{
+		EndpointURI:   "https://10.16.0.10:8080",
+		Notifications: []eaa.NotificationDescriptor{{Name: "temperature", Version: "1.0"}},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	summary, err := c.Push(ctx, eaa.NotificationFromProducer{
+		Name:    "temperature",
+		Version: "1.0",
+		Payload: json.RawMessage(`{"celsius":21.5}`),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Delivered to %d of %d subscribers\n", summary.Delivered,
+		summary.Subscribers)
+}
+
+func Example_consumer() {
+	c, err := client.New(client.Config{
+		Endpoint: "eaa.openness:443",
+		CertPath: "certs/cert.pem",
+		KeyPath:  "certs/key.pem",
+		CAPath:   "certs/root.pem",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	ctx := context.Background()
+	err = c.Subscribe(ctx, "sensors",
+		[]eaa.NotificationDescriptor{{Name: "temperature", Version: "1.0"}})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// Receive returns only when the context is done
+	_ = c.Receive(ctx, func(notif eaa.NotificationToConsumer) {
+		fmt.Printf("%s from %s: %s\n", notif.Name, notif.URN.String(), notif.Payload)
+	})
+}
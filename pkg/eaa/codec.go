@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types of the encodings of the request and response bodies
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeMsgpack = "application/msgpack"
+)
+
+// codec encodes and decodes bodies in one of the supported media types.
+// MessagePack bodies hold the same document as the JSON ones: the values
+// are converted through their JSON encoding, so that the json tags,
+// omitted fields and payloads of notifications apply to both encodings.
+type codec struct {
+	// contentType is the Content-Type header of the encoded bodies
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+var (
+	jsonCodec = codec{
+		contentType: contentTypeJSON + "; charset=UTF-8",
+		marshal:     marshalJSON,
+		unmarshal:   json.Unmarshal,
+	}
+	msgpackCodec = codec{
+		contentType: contentTypeMsgpack,
+		marshal:     marshalMsgpack,
+		unmarshal:   unmarshalMsgpack,
+	}
+)
+
+// codecs are the codecs of the media types, application/x-msgpack is
+// the unregistered name of MessagePack still used by many clients
+var codecs = map[string]codec{
+	contentTypeJSON:         jsonCodec,
+	contentTypeMsgpack:      msgpackCodec,
+	"application/x-msgpack": msgpackCodec,
+}
+
+// unsupportedCodecs are the binary encodings of the documents EAA doesn't
+// decode, a request body in one of them is rejected rather than decoded
+// as JSON
+var unsupportedCodecs = map[string]bool{
+	"application/cbor":       true,
+	"application/protobuf":   true,
+	"application/x-protobuf": true,
+}
+
+// errUnsupportedMediaType is returned for a request body of a media type
+// EAA doesn't decode
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// isMsgpack checks if the codec encodes MessagePack
+func (c codec) isMsgpack() bool {
+	return c.contentType == contentTypeMsgpack
+}
+
+// encode writes the encoded value to w
+func (c codec) encode(w io.Writer, v interface{}) error {
+	data, err := c.marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// decode decodes the value from the request body limited by
+// limitRequestBody
+func (c codec) decode(w http.ResponseWriter, r *http.Request, eaaCtx *Context,
+	v interface{}) error {
+
+	if c.isMsgpack() {
+		data, err := ioutil.ReadAll(limitRequestBody(w, r, eaaCtx))
+		if err != nil {
+			return err
+		}
+		return c.unmarshal(data, v)
+	}
+	return json.NewDecoder(limitRequestBody(w, r, eaaCtx)).Decode(v)
+}
+
+// marshalJSON encodes the value like a json.Encoder, ended by a newline
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalMsgpack encodes the JSON document of the value as MessagePack
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToMsgpack(data)
+}
+
+// jsonToMsgpack converts a JSON document to MessagePack, integral numbers
+// are encoded as integers
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	err := dec.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err = convertJSONNumbers(doc); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err = enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// convertJSONNumbers replaces the json.Numbers of a decoded JSON document
+// by integers or floats
+func convertJSONNumbers(doc interface{}) (interface{}, error) {
+	switch v := doc.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		return v.Float64()
+	case map[string]interface{}:
+		for key, value := range v {
+			converted, err := convertJSONNumbers(value)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+	case []interface{}:
+		for i, value := range v {
+			converted, err := convertJSONNumbers(value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	}
+	return doc, nil
+}
+
+// unmarshalMsgpack decodes a MessagePack document into the value through
+// its JSON encoding
+func unmarshalMsgpack(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := msgpack.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("MessagePack document has no JSON equivalent: %w", err)
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+// requestCodec returns the codec of the request body by its Content-Type.
+// The body of any other media type, or of a request without a valid
+// Content-Type, is JSON, as clients sent JSON labelled with any
+// Content-Type before MessagePack was supported. Only the media types of
+// unsupportedCodecs are rejected.
+func requestCodec(r *http.Request) (codec, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return jsonCodec, nil
+	}
+	if c, ok := codecs[mediaType]; ok {
+		return c, nil
+	}
+	if unsupportedCodecs[mediaType] {
+		return codec{}, fmt.Errorf("%w %q, supported are %s and %s",
+			errUnsupportedMediaType, mediaType, contentTypeJSON, contentTypeMsgpack)
+	}
+	return jsonCodec, nil
+}
+
+// responseCodec returns the codec of the response preferred by the Accept
+// header. JSON is returned if the client accepts any media type, none of
+// the supported ones or sent no Accept header.
+func responseCodec(r *http.Request) codec {
+	best, bestQuality := jsonCodec, 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		c, ok := codecs[mediaType]
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = c, quality
+		}
+	}
+	return best
+}
+
+// writeRequestCodecError writes the error response to a request with a body
+// of an unsupported media type
+func writeRequestCodecError(w http.ResponseWriter, err error) {
+	writeErrorDetail(w, http.StatusUnsupportedMediaType, reasonUnsupportedMediaType,
+		err.Error())
+}
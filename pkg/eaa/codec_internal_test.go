@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var _ = g.Describe("Content type negotiation", func() {
+	service := Service{
+		URN:         &URN{ID: "producer", Namespace: "ns"},
+		Description: "producer",
+		EndpointURI: "https://1.2.3.4",
+		Notifications: []NotificationDescriptor{
+			{Name: "n1", Version: "1.0", Filter: map[string]string{"zone": "1"}}},
+		Info:      json.RawMessage(`{"cores":4,"ratio":0.5,"tags":["a","b"]}`),
+		Labels:    map[string]string{"tier": "edge"},
+		Endpoints: []ServiceEndpoint{{URI: "https://5.6.7.8", Health: EndpointHealthy}},
+		TTL:       30,
+	}
+	notification := NotificationToConsumer{
+		Name:      "n1",
+		Version:   "1.0",
+		Payload:   json.RawMessage(`{"nested":{"big":18446744073709551615},"value":-1}`),
+		URN:       URN{ID: "producer", Namespace: "ns"},
+		Sequence:  7,
+		Priority:  NotificationPriorityHigh,
+		Signature: &NotificationSignature{Algorithm: "Ed25519", Value: "c2ln"},
+	}
+
+	table.DescribeTable("round-trips",
+		func(c codec, v interface{}, decoded interface{}) {
+			data, err := c.marshal(v)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.unmarshal(data, decoded)).To(Succeed())
+			Expect(reflect.ValueOf(decoded).Elem().Interface()).To(Equal(v))
+		},
+		table.Entry("a service as JSON", jsonCodec, service, &Service{}),
+		table.Entry("a service as MessagePack", msgpackCodec, service, &Service{}),
+		table.Entry("a notification as JSON", jsonCodec, notification,
+			&NotificationToConsumer{}),
+		table.Entry("a notification as MessagePack", msgpackCodec, notification,
+			&NotificationToConsumer{}),
+	)
+
+	g.It("encodes MessagePack by the JSON field names", func() {
+		data, err := msgpackCodec.marshal(notification)
+		Expect(err).ToNot(HaveOccurred())
+
+		var doc map[string]interface{}
+		Expect(msgpack.Unmarshal(data, &doc)).To(Succeed())
+		Expect(doc).To(HaveKeyWithValue("sequence", BeEquivalentTo(7)))
+		Expect(doc).To(HaveKeyWithValue("producer",
+			map[string]interface{}{"id": "producer", "namespace": "ns"}))
+		Expect(doc["payload"]).To(HaveKeyWithValue("value", BeEquivalentTo(-1)))
+		Expect(doc).ToNot(HaveKey("correlationId"))
+	})
+
+	table.DescribeTable("negotiates the response codec by the Accept header",
+		func(accept string, expected codec) {
+			r := httptest.NewRequest(http.MethodGet, "/services", nil)
+			if accept != "" {
+				r.Header.Set("Accept", accept)
+			}
+			Expect(responseCodec(r).contentType).To(Equal(expected.contentType))
+		},
+		table.Entry("no header", "", jsonCodec),
+		table.Entry("any type", "*/*", jsonCodec),
+		table.Entry("an unsupported type", "text/html", jsonCodec),
+		table.Entry("MessagePack", "application/msgpack", msgpackCodec),
+		table.Entry("legacy MessagePack", "application/x-msgpack", msgpackCodec),
+		table.Entry("JSON preferred", "application/msgpack;q=0.5, application/json",
+			jsonCodec),
+		table.Entry("MessagePack preferred", "application/json;q=0.8, application/msgpack",
+			msgpackCodec),
+		table.Entry("MessagePack refused", "application/msgpack;q=0", jsonCodec),
+	)
+
+	table.DescribeTable("selects the request codec by the Content-Type header",
+		func(contentType string, expected codec) {
+			r := httptest.NewRequest(http.MethodPost, "/services", nil)
+			if contentType != "" {
+				r.Header.Set("Content-Type", contentType)
+			}
+			c, err := requestCodec(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.contentType).To(Equal(expected.contentType))
+		},
+		table.Entry("no header", "", jsonCodec),
+		table.Entry("JSON", "application/json; charset=UTF-8", jsonCodec),
+		table.Entry("a JSON suffix", "application/merge-patch+json", jsonCodec),
+		table.Entry("MessagePack", "application/msgpack", msgpackCodec),
+		table.Entry("legacy MessagePack", "application/x-msgpack", msgpackCodec),
+		table.Entry("plain text", "text/plain", jsonCodec),
+		table.Entry("a form", "application/x-www-form-urlencoded", jsonCodec),
+		table.Entry("a malformed header", "application/", jsonCodec),
+	)
+
+	g.It("rejects a request body of an unsupported codec", func() {
+		r := httptest.NewRequest(http.MethodPost, "/services", nil)
+		r.Header.Set("Content-Type", "application/cbor")
+		_, err := requestCodec(r)
+		Expect(errors.Is(err, errUnsupportedMediaType)).To(BeTrue())
+	})
+
+	g.Describe("handlers", func() {
+		var eaaCtx *Context
+
+		g.BeforeEach(func() {
+			eaaCtx = &Context{}
+			eaaCtx.serviceInfo.m = map[string]Service{service.URN.String(): service}
+		})
+
+		g.It("lists the services as MessagePack", func() {
+			r := newTLSRequest(http.MethodGet, "/services", "", "ns:consumer", eaaCtx)
+			r.Header.Set("Accept", "application/msgpack")
+			rec := httptest.NewRecorder()
+			GetServices(rec, r)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get("Content-Type")).To(Equal(contentTypeMsgpack))
+			var list ServiceList
+			Expect(msgpackCodec.unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+			Expect(list.Services).To(Equal([]Service{service}))
+		})
+
+		g.It("decodes a MessagePack registration", func() {
+			body, err := msgpack.Marshal(map[string]interface{}{
+				"endpoint_uri": "https://1.2.3.4"})
+			Expect(err).ToNot(HaveOccurred())
+			r := newTLSRequest(http.MethodPost, "/services?dryRun=true", string(body),
+				"ns:new", eaaCtx)
+			r.Header.Set("Content-Type", "application/msgpack")
+			r.Header.Set("Accept", "application/msgpack")
+			rec := httptest.NewRecorder()
+			RegisterApplication(rec, r)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var dryRun RegistrationDryRun
+			Expect(msgpackCodec.unmarshal(rec.Body.Bytes(), &dryRun)).To(Succeed())
+			Expect(dryRun).To(Equal(RegistrationDryRun{DryRun: true,
+				URN: &URN{ID: "new", Namespace: "ns"}, Action: serviceActionRegister}))
+		})
+
+		g.It("decodes a JSON registration of any other media type", func() {
+			r := newTLSRequest(http.MethodPost, "/services?dryRun=true",
+				`{"endpoint_uri":"https://1.2.3.4"}`, "ns:new", eaaCtx)
+			r.Header.Set("Content-Type", "text/plain")
+			rec := httptest.NewRecorder()
+			RegisterApplication(rec, r)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+		})
+
+		g.It("rejects a body of an unsupported codec", func() {
+			r := newTLSRequest(http.MethodPost, "/services", "endpoint", "ns:new", eaaCtx)
+			r.Header.Set("Content-Type", "application/cbor")
+			rec := httptest.NewRecorder()
+			RegisterApplication(rec, r)
+
+			Expect(rec.Code).To(Equal(http.StatusUnsupportedMediaType))
+			var resp ErrorResponse
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp.Error).To(Equal(reasonUnsupportedMediaType))
+		})
+	})
+
+	g.It("writes notification envelopes as binary MessagePack messages", func() {
+		fake := &fakeNotificationConn{sent: make(chan []byte, 1)}
+		conn := notificationMsgpackConn{fake}
+		data, err := json.Marshal(notification)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(conn.WriteMessage(websocket.TextMessage, data)).To(Succeed())
+		var decoded NotificationToConsumer
+		Expect(msgpackCodec.unmarshal(<-fake.sent, &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(notification))
+	})
+})
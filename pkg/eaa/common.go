@@ -4,24 +4,599 @@
 package eaa
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Reasons of failed requests returned in ErrorResponse
+const (
+	reasonInvalidRequestBody      = "invalid_request_body"
+	reasonInvalidURN              = "invalid_urn"
+	reasonURNMismatch             = "urn_mismatch"
+	reasonInvalidService          = "invalid_service"
+	reasonInvalidNamespacePattern = "invalid_namespace_pattern"
+	reasonMarshalingFailed        = "marshaling_failed"
+	reasonBrokerPublishFailed     = "broker_publish_failed"
+	reasonBrokerPublishTimeout    = "broker_publish_timeout"
+	reasonBrokerRetriesExhausted  = "broker_publish_retries_exhausted"
+	reasonBrokerUnavailable       = "broker_circuit_open"
+	reasonSubscriptionFailed      = "subscription_processing_failed"
+	reasonServiceNotFound         = "service_not_found"
+	reasonProducerNotRegistered   = "producer_not_registered"
+	reasonAdminAccessDenied       = "admin_access_denied"
+	reasonNamespaceAccessDenied   = "namespace_access_denied"
+	reasonRateLimitExceeded       = "rate_limit_exceeded"
+	reasonNodeRateLimitExceeded   = "node_rate_limit_exceeded"
+	reasonInvalidSequence         = "invalid_sequence"
+	reasonNotInitialized          = "eaa_not_initialized"
+	reasonInvalidNotification     = "invalid_notification"
+	reasonRequestBodyTooLarge     = "request_body_too_large"
+	reasonInvalidQuery            = "invalid_query_parameter"
+	reasonLeaseNotFound           = "subscription_lease_not_found"
+	reasonInvalidSchema           = "invalid_notification_schema"
+	reasonSchemaNotFound          = "notification_schema_not_found"
+	reasonInvalidPayload          = "invalid_notification_payload"
+	reasonUnsupportedSubprotocol  = "unsupported_websocket_subprotocol"
+	reasonUnsupportedMediaType    = "unsupported_media_type"
+	reasonShuttingDown            = "eaa_shutting_down"
+	reasonInvalidDelivery         = "invalid_delivery"
+	reasonDeliveryFailed          = "delivery_setup_failed"
+	reasonInvalidSignature        = "invalid_notification_signature"
+	reasonConfigReloadFailed      = "config_reload_failed"
+	reasonSubscriptionLimit       = "subscription_limit_exceeded"
+	reasonStreamingUnsupported    = "streaming_unsupported"
+	reasonPartialDeregistration   = "service_deregistered_subscriptions_kept"
+	reasonDuplicateURN            = "urn_registered_by_another_producer"
+	reasonRequestURLTooLong       = "request_url_too_long"
+	reasonConnectionLimit         = "connection_limit_exceeded"
+)
+
+// correlationIDHeader carries the ID correlating the log records of
+// a notification from its push to its delivery, producers may supply
+// their own
+const correlationIDHeader = "X-Correlation-ID"
+
+// correlationIDMetadataKey is the message metadata key of the correlation ID
+const correlationIDMetadataKey = "correlation_id"
+
+// maxCorrelationIDLength is the maximum length of a correlation ID
+// supplied by a producer
+const maxCorrelationIDLength = 128
+
+// newCorrelationID generates a random correlation ID
+func newCorrelationID() string {
+	return uuid.New().String()
+}
+
+// getCorrelationID returns the correlation ID of the request header or
+// a new one if there is none or it isn't printable ASCII of a sane length
+func getCorrelationID(r *http.Request) string {
+	id := r.Header.Get(correlationIDHeader)
+	if id == "" {
+		return newCorrelationID()
+	}
+
+	valid := len(id) <= maxCorrelationIDLength
+	for i := 0; valid && i < len(id); i++ {
+		valid = id[i] > ' ' && id[i] <= '~'
+	}
+	if !valid {
+		log.Warningf("Ignoring invalid correlation ID %q", id)
+		return newCorrelationID()
+	}
+	return id
+}
+
+// defaultMaxRequestBodySize is the request body size limit applied if
+// it's not set in the config
+const defaultMaxRequestBodySize = 256 << 10
+
+// limitRequestBody caps the request body to the configured size, reading
+// beyond the limit fails
+func limitRequestBody(w http.ResponseWriter, r *http.Request, eaaCtx *Context) io.Reader {
+	limit := eaaCtx.config().MaxRequestBodySize
+	if limit <= 0 {
+		limit = defaultMaxRequestBodySize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return r.Body
+}
+
+const (
+	// defaultMaxHeaderBytes is the request header size limit applied if
+	// it's not set in the config
+	defaultMaxHeaderBytes = 64 << 10
+	// defaultMaxURLLength is the request URL length limit applied if it's
+	// not set in the config
+	defaultMaxURLLength = 8 << 10
 )
 
-// CommonNameStringToURN parses a common name string to a URN struct
+// maxHeaderBytes returns the request header size limit of the EAA endpoint
+func maxHeaderBytes(cfg *Config) int {
+	if cfg.MaxHeaderBytes > 0 {
+		return cfg.MaxHeaderBytes
+	}
+	return defaultMaxHeaderBytes
+}
+
+// maxURLLength returns the request URL length limit of the EAA endpoint
+func maxURLLength(cfg *Config) int {
+	if cfg.MaxURLLength > 0 {
+		return cfg.MaxURLLength
+	}
+	return defaultMaxURLLength
+}
+
+// newURLLengthHandler wraps the handler rejecting the requests whose URL is
+// longer than the configured length with 414. Headers over MaxHeaderBytes
+// are rejected with 431 by the server itself.
+func newURLLengthHandler(next http.Handler, eaaCtx *Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.RequestURI) > maxURLLength(eaaCtx.config()) {
+			log.Warningf("Rejected a request with a URL of %d bytes from %s",
+				len(r.RequestURI), r.RemoteAddr)
+			writeError(w, http.StatusRequestURITooLong, reasonRequestURLTooLong)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isRequestBodyTooLarge checks if reading a request body failed because of
+// the limit set by limitRequestBody. http.MaxBytesReader reports it with
+// an error distinguishable only by its message.
+func isRequestBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
+// writeRequestBodyError writes the error response to a request with
+// a body which couldn't be decoded
+func writeRequestBodyError(w http.ResponseWriter, err error) {
+	if isRequestBodyTooLarge(err) {
+		writeError(w, http.StatusRequestEntityTooLarge, reasonRequestBodyTooLarge)
+		return
+	}
+	writeError(w, http.StatusBadRequest, reasonInvalidRequestBody)
+}
+
+// defaultBrokerPublishTimeout is the Message Broker publish timeout
+// applied if it's not set in the config
+const defaultBrokerPublishTimeout = 5 * time.Second
+
+// withPublishTimeout returns a context bounding publishing to the Message
+// Broker by the configured timeout
+func withPublishTimeout(parent context.Context,
+	eaaCtx *Context) (context.Context, context.CancelFunc) {
+
+	timeout := eaaCtx.config().BrokerPublishTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultBrokerPublishTimeout
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// isPublishTimeout checks if publishing to the Message Broker failed
+// because it didn't complete within the timeout
+func isPublishTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// writePublishError writes the error response to a request whose message
+// couldn't be published to the Message Broker. A timeout or the open circuit
+// breaker mean the broker is unavailable, exhausted retries and other
+// failures are reported with their reason.
+func writePublishError(w http.ResponseWriter, reason string, err error) {
+	if isPublishTimeout(err) {
+		writeError(w, http.StatusServiceUnavailable, reasonBrokerPublishTimeout)
+		return
+	}
+	var openErr *brokerCircuitOpenError
+	if errors.As(err, &openErr) {
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(math.Ceil(openErr.retryAfter.Seconds()))))
+		writeError(w, http.StatusServiceUnavailable, reasonBrokerUnavailable)
+		return
+	}
+	var retriesErr *publishRetriesError
+	if errors.As(err, &retriesErr) {
+		writeError(w, http.StatusInternalServerError, reasonBrokerRetriesExhausted)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, reason)
+}
+
+// writeError writes the status code and an ErrorResponse with a machine
+// readable reason of the failure
+func writeError(w http.ResponseWriter, code int, reason string) {
+	writeErrorDetail(w, code, reason, "")
+}
+
+// writeErrorDetail writes the status code and an ErrorResponse with a machine
+// readable reason and human readable details of the failure
+func writeErrorDetail(w http.ResponseWriter, code int, reason string, detail string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+
+	resp := ErrorResponse{Error: reason, Code: code, Detail: detail}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errf("Failed to encode error response: %s", err.Error())
+	}
+}
+
+// CommonNameStringToURN parses a common name string to a URN struct.
+// The expected CommonName grammar is:
+//
+//	commonName = namespace ":" id
+//	namespace  = 1*char
+//	id         = 1*char
+//	char       = any printable character except ":", "/" and white space
+//
+// CommonNames with additional components, e.g. "namespace:id:extra" or
+// "namespace:id/OU=unit", are rejected rather than truncated. White space
+// around the components is trimmed and the namespace is normalized by
+// normalizeNamespace, so "Sensors:p1" and "sensors:p1" map to the same URN.
 func CommonNameStringToURN(commonName string) (URN, error) {
-	splittedCN := strings.SplitN(commonName, ":", 2)
+	splittedCN := strings.Split(commonName, ":")
 
 	if len(splittedCN) != 2 {
-		return URN{}, errors.New("Cannot translate Common Name to URN")
+		return URN{}, errors.New("Cannot translate Common Name to URN: " +
+			"expected exactly one ':' separator")
+	}
+
+	for i, component := range splittedCN {
+		component = strings.TrimSpace(component)
+		splittedCN[i] = component
+		if component == "" {
+			return URN{}, errors.New("Cannot translate Common Name to URN: " +
+				"empty namespace or ID")
+		}
+		for _, r := range component {
+			if isInvalidURNRune(r) {
+				return URN{}, errors.New("Cannot translate Common Name to URN: " +
+					"invalid character " + strconv.QuoteRune(r))
+			}
+		}
 	}
 
 	return URN{
-		Namespace: splittedCN[0],
+		Namespace: normalizeNamespace(splittedCN[0]),
 		ID:        splittedCN[1],
 	}, nil
 }
 
+// normalizeNamespace returns the canonical form of a URN namespace: white
+// space around it is trimmed and it's lower-cased, so that namespaces
+// differing only in case are the same namespace. It's the only definition
+// of the rules, every namespace taken from a client is normalized by it
+// before being stored or compared.
+func normalizeNamespace(namespace string) string {
+	return strings.ToLower(strings.TrimSpace(namespace))
+}
+
+// String returns the canonical string of the URN, which is the CommonName
+// of its producer: the namespace is normalized by normalizeNamespace and
+// white space around the ID is trimmed. CommonNameStringToURN parses it
+// back to an equal URN, so it's the key of the URN in the registered
+// services and the Message Broker.
+func (u URN) String() string {
+	return normalizeNamespace(u.Namespace) + ":" + strings.TrimSpace(u.ID)
+}
+
+// Equals checks if two URNs identify the same producer, which is when their
+// canonical strings are equal
+func (u URN) Equals(other URN) bool {
+	return u.String() == other.String()
+}
+
+// Matches checks if the URN matches the pattern URN. An empty namespace or
+// ID of the pattern matches any, a namespace pattern, e.g. "sensors-*",
+// matches the namespaces it globs by namespaceMatches. The rest is compared
+// like by Equals.
+func (u URN) Matches(pattern URN) bool {
+	if id := strings.TrimSpace(pattern.ID); id != "" && id != strings.TrimSpace(u.ID) {
+		return false
+	}
+	namespace := normalizeNamespace(pattern.Namespace)
+	return namespace == "" || namespace == normalizeNamespace(u.Namespace) ||
+		(isNamespacePattern(namespace) &&
+			namespaceMatches(namespace, normalizeNamespace(u.Namespace)))
+}
+
+// urnFromVars returns the URN of the "urn.namespace" and "urn.id" request
+// path variables with the namespace normalized
+func urnFromVars(vars map[string]string) URN {
+	return URN{Namespace: normalizeNamespace(vars["urn.namespace"]), ID: vars["urn.id"]}
+}
+
+// serviceKey returns the key of the service of a producer in the registered
+// services, which is the string of the producer's normalized URN. A malformed
+// CommonName is its own key.
+func serviceKey(commonName string) string {
+	urn, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		return commonName
+	}
+	return urn.String()
+}
+
+// validateURNComponent checks a namespace or an ID taken from a request
+// path, which may not be empty nor contain a ':' separator
+func validateURNComponent(name string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is empty", name)
+	}
+	for _, r := range value {
+		if r == ':' || isInvalidURNRune(r) {
+			return fmt.Errorf("%s contains invalid character %s", name,
+				strconv.QuoteRune(r))
+		}
+	}
+	return nil
+}
+
+// isInvalidURNRune checks if a rune is not allowed in a URN component
+func isInvalidURNRune(r rune) bool {
+	return r == '/' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+}
+
+// totalCountHeader carries the number of items of a paginated list
+const totalCountHeader = "X-Total-Count"
+
+// parsePagination parses the "offset" and "limit" query parameters of
+// a list request. A missing parameter is 0, a limit of 0 means no limit.
+func parsePagination(query url.Values) (offset int, limit int, err error) {
+	if offset, err = parseNonNegativeInt(query, "offset"); err != nil {
+		return 0, 0, err
+	}
+	if limit, err = parseNonNegativeInt(query, "limit"); err != nil {
+		return 0, 0, err
+	}
+	return offset, limit, nil
+}
+
+// parseLabelSelector parses the "label" query parameters of the form
+// key=value into a selector. A service has to match all of them.
+func parseLabelSelector(query url.Values) (map[string]string, error) {
+	selector := make(map[string]string)
+	for _, label := range query["label"] {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("label %q must have the form key=value", label)
+		}
+		if value, ok := selector[parts[0]]; ok && value != parts[1] {
+			return nil, fmt.Errorf("label %q is selected with different values", parts[0])
+		}
+		selector[parts[0]] = parts[1]
+	}
+	return selector, nil
+}
+
+// parseNonNegativeInt parses an optional non-negative integer query parameter
+func parseNonNegativeInt(query url.Values, name string) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return value, nil
+}
+
+// parseBool parses an optional boolean query parameter
+func parseBool(query url.Values, name string) (bool, error) {
+	s := query.Get(name)
+	if s == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean", name)
+	}
+	return value, nil
+}
+
+// pageBounds returns the bounds of the page of a list of n items
+func pageBounds(n int, offset int, limit int) (start int, end int) {
+	if offset > n {
+		offset = n
+	}
+	end = n
+	if limit > 0 && limit < n-offset {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// sortServices orders services by their URN
+func sortServices(servs []Service) {
+	sort.Slice(servs, func(i, j int) bool {
+		a, b := servs[i].URN, servs[j].URN
+		if a == nil || b == nil {
+			return b != nil
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.ID < b.ID
+	})
+}
+
+// countNamespaceServices returns the namespaces of the services with
+// the number of services registered in each, sorted by namespace
+func countNamespaceServices(servs map[string]Service) []NamespaceSummary {
+	counts := make(map[string]int)
+	for _, serv := range servs {
+		if serv.URN == nil {
+			continue
+		}
+		counts[serv.URN.Namespace]++
+	}
+
+	namespaces := make([]NamespaceSummary, 0, len(counts))
+	for namespace, count := range counts {
+		namespaces = append(namespaces, NamespaceSummary{Namespace: namespace, Services: count})
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+	return namespaces
+}
+
+// serviceWriter writes a ServiceList one service at a time
+type serviceWriter interface {
+	write(serv Service) error
+	close() error
+}
+
+// serviceListWriter streams a ServiceList to a writer one service at a time,
+// the output is identical to encoding the whole ServiceList
+type serviceListWriter struct {
+	w       io.Writer
+	buf     bytes.Buffer
+	encoder *json.Encoder
+	count   int
+}
+
+// newServiceListWriter creates a serviceListWriter writing to w
+func newServiceListWriter(w io.Writer) *serviceListWriter {
+	sw := &serviceListWriter{w: w}
+	sw.encoder = json.NewEncoder(&sw.buf)
+	return sw
+}
+
+// write appends a service to the services array
+func (sw *serviceListWriter) write(serv Service) error {
+	sw.buf.Reset()
+	if sw.count == 0 {
+		sw.buf.WriteString(`{"services":[`)
+	} else {
+		sw.buf.WriteByte(',')
+	}
+	if err := sw.encoder.Encode(serv); err != nil {
+		return err
+	}
+	sw.count++
+	// Drop the newline the encoder ends every value with
+	_, err := sw.w.Write(sw.buf.Bytes()[:sw.buf.Len()-1])
+	return err
+}
+
+// close ends the services array, an empty one is omitted
+func (sw *serviceListWriter) close() error {
+	end := "]}\n"
+	if sw.count == 0 {
+		end = "{}\n"
+	}
+	_, err := io.WriteString(sw.w, end)
+	return err
+}
+
+// bufferedServiceListWriter collects the services and encodes the whole
+// ServiceList by the codec on close, for encodings which can't be streamed
+// like JSON, e.g. MessagePack whose arrays start with their length
+type bufferedServiceListWriter struct {
+	w     io.Writer
+	codec codec
+	list  ServiceList
+}
+
+// write appends a service to the services
+func (bw *bufferedServiceListWriter) write(serv Service) error {
+	bw.list.Services = append(bw.list.Services, serv)
+	return nil
+}
+
+// close encodes the ServiceList
+func (bw *bufferedServiceListWriter) close() error {
+	return bw.codec.encode(bw.w, bw.list)
+}
+
+// newServiceWriter returns the writer of a ServiceList encoded by the codec
+func newServiceWriter(w io.Writer, c codec) serviceWriter {
+	if c.isMsgpack() {
+		return &bufferedServiceListWriter{w: w, codec: c}
+	}
+	return newServiceListWriter(w)
+}
+
+// requesterName returns the CommonName of the client certificate of
+// the request or adminSocketRequester if there is none
+func requesterName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return adminSocketRequester
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+// isAdmin checks if the CommonName is on the admin allowlist
+func isAdmin(commonName string, eaaCtx *Context) bool {
+	for _, admin := range eaaCtx.config().AdminCommonNames {
+		if admin == commonName {
+			return true
+		}
+	}
+	return false
+}
+
+// getNotificationAttributes returns the top level attributes of
+// a notification payload, nil if the payload is not a JSON object
+func getNotificationAttributes(payload json.RawMessage) map[string]interface{} {
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(payload, &attrs); err != nil {
+		return nil
+	}
+	return attrs
+}
+
+// filterMatches checks if the attributes contain all the filter keys with
+// equal values. Non string values are compared using their text form.
+func filterMatches(attrs map[string]interface{}, filter map[string]string) bool {
+	for k, v := range filter {
+		attr, found := attrs[k]
+		if !found {
+			return false
+		}
+		if s, isString := attr.(string); isString {
+			if s != v {
+				return false
+			}
+		} else if fmt.Sprint(attr) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// isNamespacePattern checks if a namespace contains wildcard characters
+// and has to be matched using namespaceMatches
+func isNamespacePattern(namespace string) bool {
+	return strings.ContainsAny(namespace, "*?[")
+}
+
+// namespaceMatches checks if a namespace matches a glob pattern. The pattern
+// syntax is the same as in path.Match, a malformed pattern matches nothing
+func namespaceMatches(pattern string, namespace string) bool {
+	matched, err := path.Match(pattern, namespace)
+	return err == nil && matched
+}
+
 // getNamespaceSubscriptionIndex returns index of the subscriber id
 // in the namespace slice, returns -1 if not found
 func getNamespaceSubscriptionIndex(key UniqueNotif, id string,
@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("common helpers", func() {
+	g.Describe("writeError", func() {
+		g.It("should write the status code and a JSON error body", func() {
+			rec := httptest.NewRecorder()
+
+			writeError(rec, http.StatusInternalServerError, reasonBrokerPublishFailed)
+
+			Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rec.Header().Get("Content-Type")).To(
+				Equal("application/json; charset=UTF-8"))
+
+			var resp ErrorResponse
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp).To(Equal(ErrorResponse{
+				Error: reasonBrokerPublishFailed,
+				Code:  http.StatusInternalServerError,
+			}))
+		})
+	})
+	g.Describe("filterMatches", func() {
+		attrs := getNotificationAttributes(
+			[]byte(`{"zone":"cold-storage","floor":1,"alarm":false}`))
+
+		g.It("should match an empty filter", func() {
+			Expect(filterMatches(nil, nil)).To(BeTrue())
+		})
+
+		g.It("should compare attributes by their text form", func() {
+			Expect(filterMatches(attrs, map[string]string{
+				"zone": "cold-storage", "floor": "1", "alarm": "false",
+			})).To(BeTrue())
+		})
+
+		g.It("should not match different or missing attributes", func() {
+			Expect(filterMatches(attrs, map[string]string{"zone": "office"})).To(BeFalse())
+			Expect(filterMatches(attrs, map[string]string{"room": "1"})).To(BeFalse())
+		})
+	})
+	g.Describe("serviceListWriter", func() {
+		encode := func(servList ServiceList) string {
+			var buf bytes.Buffer
+			Expect(json.NewEncoder(&buf).Encode(servList)).To(Succeed())
+			return buf.String()
+		}
+		stream := func(servs []Service) string {
+			var buf bytes.Buffer
+			sw := newServiceListWriter(&buf)
+			for _, serv := range servs {
+				Expect(sw.write(serv)).To(Succeed())
+			}
+			Expect(sw.close()).To(Succeed())
+			return buf.String()
+		}
+
+		g.It("should write the same JSON as encoding a ServiceList", func() {
+			servs := []Service{
+				{URN: &URN{ID: "p1", Namespace: "ns"}, Description: "<a & b>",
+					Labels: map[string]string{"zone": "1"}},
+				{URN: &URN{ID: "p2", Namespace: "ns"}, EndpointURI: "https://p2",
+					Endpoints: []ServiceEndpoint{{URI: "https://p2b", Health: EndpointHealthy}}},
+			}
+
+			Expect(stream(servs)).To(Equal(encode(ServiceList{Services: servs})))
+			Expect(stream(servs[:1])).To(Equal(encode(ServiceList{Services: servs[:1]})))
+		})
+
+		g.It("should omit an empty services array", func() {
+			Expect(stream(nil)).To(Equal(encode(ServiceList{})))
+		})
+	})
+	table.DescribeTable("CommonNameStringToURN with a valid CommonName",
+		func(commonName string, expected URN) {
+			urn, err := CommonNameStringToURN(commonName)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(urn).To(Equal(expected))
+		},
+		table.Entry("simple", "namespace-1:producer-1",
+			URN{Namespace: "namespace-1", ID: "producer-1"}),
+		table.Entry("dots and underscores", "org.example:app_1.0",
+			URN{Namespace: "org.example", ID: "app_1.0"}),
+		table.Entry("single characters", "n:i", URN{Namespace: "n", ID: "i"}),
+		table.Entry("mixed case namespace", "Sensors:Probe-1",
+			URN{Namespace: "sensors", ID: "Probe-1"}),
+		table.Entry("white space around components", " sensors : p1 ",
+			URN{Namespace: "sensors", ID: "p1"}),
+	)
+
+	table.DescribeTable("CommonNameStringToURN with a malformed CommonName",
+		func(commonName string) {
+			_, err := CommonNameStringToURN(commonName)
+			Expect(err).Should(HaveOccurred())
+		},
+		table.Entry("empty", ""),
+		table.Entry("no separator", "namespace-producer-no-colon"),
+		table.Entry("only separator", ":"),
+		table.Entry("empty namespace", ":producer"),
+		table.Entry("empty ID", "namespace:"),
+		table.Entry("trailing component", "namespace:producer:extra"),
+		table.Entry("embedded slash in ID", "namespace:producer/OU=unit"),
+		table.Entry("embedded slash in namespace", "org/unit:producer"),
+		table.Entry("white space", "namespace:producer 1"),
+		table.Entry("white space namespace", " :producer"),
+		table.Entry("control character", "namespace:producer\x00"),
+	)
+
+	table.DescribeTable("URN round trip between a CommonName and its string",
+		func(commonName string, canonical string) {
+			urn, err := CommonNameStringToURN(commonName)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(urn.String()).To(Equal(canonical))
+
+			parsed, err := CommonNameStringToURN(urn.String())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parsed).To(Equal(urn))
+			Expect(parsed.Equals(urn)).To(BeTrue())
+			Expect(serviceKey(commonName)).To(Equal(canonical))
+		},
+		table.Entry("canonical", "sensors:p1", "sensors:p1"),
+		table.Entry("mixed case namespace", "Sensors:P1", "sensors:P1"),
+		table.Entry("white space around components", " Sensors : p1 ", "sensors:p1"),
+		table.Entry("dots and underscores", "org.example:app_1.0", "org.example:app_1.0"),
+	)
+
+	g.It("URN string is canonical for a URN not parsed from a CommonName", func() {
+		Expect(URN{Namespace: " Sensors ", ID: " p1 "}.String()).To(Equal("sensors:p1"))
+		Expect((&URN{Namespace: "sensors", ID: "p1"}).String()).To(Equal("sensors:p1"))
+	})
+
+	table.DescribeTable("URN.Equals",
+		func(a URN, b URN, equal bool) {
+			Expect(a.Equals(b)).To(Equal(equal))
+			Expect(b.Equals(a)).To(Equal(equal))
+		},
+		table.Entry("identical", URN{Namespace: "ns", ID: "p1"},
+			URN{Namespace: "ns", ID: "p1"}, true),
+		table.Entry("namespaces differing in case", URN{Namespace: "NS", ID: "p1"},
+			URN{Namespace: "ns", ID: "p1"}, true),
+		table.Entry("white space around components", URN{Namespace: " ns", ID: "p1 "},
+			URN{Namespace: "ns", ID: "p1"}, true),
+		table.Entry("IDs differing in case", URN{Namespace: "ns", ID: "P1"},
+			URN{Namespace: "ns", ID: "p1"}, false),
+		table.Entry("different namespaces", URN{Namespace: "ns1", ID: "p1"},
+			URN{Namespace: "ns2", ID: "p1"}, false),
+		table.Entry("different IDs", URN{Namespace: "ns", ID: "p1"},
+			URN{Namespace: "ns", ID: "p2"}, false),
+		table.Entry("empty ID", URN{Namespace: "ns"}, URN{Namespace: "ns", ID: "p1"}, false),
+	)
+
+	table.DescribeTable("URN.Matches",
+		func(urn URN, pattern URN, matches bool) {
+			Expect(urn.Matches(pattern)).To(Equal(matches))
+		},
+		table.Entry("equal URN", URN{Namespace: "ns", ID: "p1"},
+			URN{Namespace: "ns", ID: "p1"}, true),
+		table.Entry("namespace differing in case", URN{Namespace: "ns", ID: "p1"},
+			URN{Namespace: " NS ", ID: "p1"}, true),
+		table.Entry("empty ID", URN{Namespace: "ns", ID: "p1"}, URN{Namespace: "ns"}, true),
+		table.Entry("empty pattern", URN{Namespace: "ns", ID: "p1"}, URN{}, true),
+		table.Entry("namespace pattern", URN{Namespace: "sensors-east", ID: "p1"},
+			URN{Namespace: "sensors-*"}, true),
+		table.Entry("namespace pattern with an ID", URN{Namespace: "sensors-east", ID: "p1"},
+			URN{Namespace: "Sensors-*", ID: "p2"}, false),
+		table.Entry("namespace not matching the pattern", URN{Namespace: "cameras", ID: "p1"},
+			URN{Namespace: "sensors-*"}, false),
+		table.Entry("different ID", URN{Namespace: "ns", ID: "p1"},
+			URN{Namespace: "ns", ID: "p2"}, false),
+		table.Entry("different namespace", URN{Namespace: "ns1", ID: "p1"},
+			URN{Namespace: "ns2"}, false),
+		table.Entry("malformed pattern", URN{Namespace: "ns[", ID: "p1"},
+			URN{Namespace: "ns["}, true),
+	)
+})
+
+// BenchmarkGetServicesEncoding writes 10000 services as a ServiceList
+// encoded at once and streamed by a serviceListWriter
+func BenchmarkGetServicesEncoding(b *testing.B) {
+	const services = 10000
+
+	m := make(map[string]Service, services)
+	for i := 0; i < services; i++ {
+		urn := URN{ID: fmt.Sprintf("producer%d", i), Namespace: "ns"}
+		m[urn.String()] = Service{URN: &urn, Description: "benchmark service",
+			EndpointURI: "https://" + urn.ID, Labels: map[string]string{"zone": "1"}}
+	}
+
+	b.Run("list", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var servList ServiceList
+			for _, serv := range m {
+				servList.Services = append(servList.Services, serv)
+			}
+			if err := json.NewEncoder(ioutil.Discard).Encode(servList); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sw := newServiceListWriter(ioutil.Discard)
+			for _, serv := range m {
+				if err := sw.write(serv); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := sw.close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+var _ = g.Describe("Request header and URL limits", func() {
+	var (
+		eaaCtx *Context
+		server *httptest.Server
+	)
+
+	get := func(path string, header http.Header) *http.Response {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		Expect(err).ToNot(HaveOccurred())
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		return resp
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.cfg.MaxHeaderBytes = 1024
+		eaaCtx.cfg.MaxURLLength = 256
+		server = httptest.NewUnstartedServer(newURLLengthHandler(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), eaaCtx))
+		server.Config.MaxHeaderBytes = maxHeaderBytes(eaaCtx.config())
+		server.Start()
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	g.It("serves a URL within the limit", func() {
+		resp := get("/subscriptions/ns/"+strings.Repeat("x", 200), nil)
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	g.It("rejects an over-length URL by 414", func() {
+		resp := get("/subscriptions/ns/"+strings.Repeat("x", 300), nil)
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestURITooLong))
+		var errResp ErrorResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&errResp)).To(Succeed())
+		Expect(errResp.Error).To(Equal(reasonRequestURLTooLong))
+	})
+
+	g.It("rejects oversized headers by 431", func() {
+		resp := get("/subscriptions", http.Header{
+			"X-Flood": []string{strings.Repeat("x", 16<<10)}})
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+	})
+
+	g.It("requires the URL length limit below the header limit", func() {
+		Expect(validateConfig(&Config{MaxHeaderBytes: 4096})).ToNot(Succeed())
+		Expect(validateConfig(&Config{MaxHeaderBytes: 4096, MaxURLLength: 2048})).To(Succeed())
+		Expect(validateConfig(&Config{})).To(Succeed())
+	})
+})
@@ -17,12 +17,432 @@ type CertsInfo struct {
 	KafkaUserKeyPath  string `json:"KafkaUserKeyPath"`
 }
 
+// Message Broker backends available in MsgBrokerInfo
+const (
+	msgBrokerTypeKafka      = "kafka"
+	msgBrokerTypeGoChannels = "gochannels"
+)
+
+// MsgBrokerInfo describes the Message Broker backend used in configuration
+type MsgBrokerInfo struct {
+	// Type is either "kafka" (default) or "gochannels". GoChannels do not
+	// propagate messages to other EAA instances.
+	Type string `json:"Type"`
+}
+
+// MQTTInboundRoute pushes messages of an MQTT topic to EAA as notifications
+// of a producer
+type MQTTInboundRoute struct {
+	// Topic is an MQTT topic filter, it may contain "+" and "#" wildcards
+	Topic        string                 `json:"Topic"`
+	Producer     URN                    `json:"Producer"`
+	Notification NotificationDescriptor `json:"Notification"`
+}
+
+// MQTTOutboundRoute forwards payloads of EAA notifications to an MQTT topic
+type MQTTOutboundRoute struct {
+	// Producer of the notifications, an empty ID matches all producers
+	// of the namespace and a namespace pattern the producers of
+	// the namespaces it matches
+	Producer     URN                    `json:"Producer"`
+	Notification NotificationDescriptor `json:"Notification"`
+	Topic        string                 `json:"Topic"`
+}
+
+// MQTTBridgeInfo describes the bridge between EAA notifications and
+// an external MQTT broker
+type MQTTBridgeInfo struct {
+	// Broker is the MQTT broker URL, e.g. "ssl://mqtt.openness:8883",
+	// empty disables the bridge
+	Broker   string `json:"Broker"`
+	ClientID string `json:"ClientID"`
+	// Client certificate used for "ssl://" brokers
+	CAPath   string              `json:"CAPath"`
+	CertPath string              `json:"CertPath"`
+	KeyPath  string              `json:"KeyPath"`
+	QoS      byte                `json:"QoS"`
+	Inbound  []MQTTInboundRoute  `json:"Inbound"`
+	Outbound []MQTTOutboundRoute `json:"Outbound"`
+}
+
+// SubscriptionStoreInfo describes the store keeping consumer subscriptions
+type SubscriptionStoreInfo struct {
+	// Type is either "memory" (default) or "redis". Subscriptions kept in
+	// memory are lost on restart.
+	Type string `json:"Type"`
+	// Address, Password and DB of the Redis server
+	Address  string `json:"Address"`
+	Password string `json:"Password"`
+	DB       int    `json:"DB"`
+}
+
+// ServiceStoreInfo describes the store keeping the registered services
+type ServiceStoreInfo struct {
+	// Type is either "memory" (default) or "file". Services kept in memory
+	// are lost on restart.
+	Type string `json:"Type"`
+	// Path of the JSON file of the "file" store
+	Path string `json:"Path"`
+}
+
+// NamespacePolicy allows CommonNames matching a pattern to access
+// namespaces. Patterns have the syntax of path.Match.
+type NamespacePolicy struct {
+	// CommonName is a pattern of consumer and producer CommonNames,
+	// e.g. "tenant-a*:*"
+	CommonName string `json:"CommonName"`
+	// Namespaces are patterns of namespaces the CommonNames can subscribe
+	// to and push notifications to
+	Namespaces []string `json:"Namespaces"`
+}
+
+// PublishPolicy allows or denies a producer pushing notifications to
+// namespaces. Names are matched exactly, so that the check is a map lookup.
+type PublishPolicy struct {
+	// CommonName is the CommonName of the producer, "*" applies the policy
+	// to producers without a policy of their own
+	CommonName string `json:"CommonName"`
+	// Allow are the namespaces the producer can push to, empty allows every
+	// namespace not denied
+	Allow []string `json:"Allow"`
+	// Deny are the namespaces the producer can't push to, they take
+	// precedence over Allow
+	Deny []string `json:"Deny"`
+}
+
+// WebSocketCompressionInfo describes the permessage-deflate compression of
+// notifications sent to consumer websockets.
+//
+// JSON notifications compress well, at the cost of CPU time spent on every
+// notification written. Every connection compresses on its own, so the cost
+// grows with the number of subscribers, and it grows with the level too.
+//
+// BenchmarkWebSocketCompression sends a 1.5 KB notification of sensor
+// readings, on a single core writing and reading it takes:
+//
+//	uncompressed   4 µs   1514 bytes sent
+//	level 1       22 µs    287 bytes sent
+//	level 6       33 µs    285 bytes sent
+//	level 9       84 µs    282 bytes sent
+//
+// Level 1 saves nearly all the bytes the higher levels do, in a fraction of
+// their time.
+type WebSocketCompressionInfo struct {
+	// Enabled negotiates the compression with consumers supporting it,
+	// the others receive uncompressed notifications
+	Enabled bool `json:"Enabled"`
+	// Level is the flate compression level from 1 (best speed) to 9
+	// (best compression), 0 applies the default of 1
+	Level int `json:"Level"`
+}
+
+// ResponseCompressionInfo describes the gzip compression of the responses
+// of the GET endpoints, the notification streams are never compressed
+type ResponseCompressionInfo struct {
+	// Enabled compresses the responses to clients sending
+	// "Accept-Encoding: gzip"
+	Enabled bool `json:"Enabled"`
+	// MinSize is the size in bytes of the smallest response compressed,
+	// smaller ones aren't worth it, 0 applies the default of 1024
+	MinSize int `json:"MinSize"`
+}
+
+// TracingInfo describes the export of the OpenTelemetry spans of EAA
+type TracingInfo struct {
+	// Endpoint is the URL of the Zipkin v2 spans API of the collector,
+	// e.g. http://zipkin:9411/api/v2/spans. Jaeger and the OpenTelemetry
+	// Collector provide it too. Empty disables tracing.
+	Endpoint string `json:"Endpoint"`
+	// SampleRatio is the fraction of the traces started by EAA which are
+	// sampled, 0 applies the default of 1. The traces of requests carrying
+	// a trace context follow the sampling decision of the caller.
+	SampleRatio float64 `json:"SampleRatio"`
+}
+
+// CORSInfo describes the cross-origin access to the read-only GetServices
+// and GetSubscriptions endpoints by browsers
+type CORSInfo struct {
+	// AllowedOrigins are the origins, e.g. "https://dashboard.example.com",
+	// allowed to read the endpoints, empty allows same-origin requests only
+	AllowedOrigins []string `json:"AllowedOrigins"`
+	// AllowedMethods are the methods allowed in cross-origin requests,
+	// empty allows GET only
+	AllowedMethods []string `json:"AllowedMethods"`
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests in addition to the CORS-safelisted ones
+	AllowedHeaders []string `json:"AllowedHeaders"`
+}
+
+// DeadLetterInfo describes the sink of the notifications which couldn't be
+// delivered to any subscriber
+type DeadLetterInfo struct {
+	// Type of the sink: "topic" publishes the dead letters to the Message
+	// Broker topic Topic, "file" appends them as JSON lines to the file
+	// Path. Empty disables the dead-letter sink.
+	Type  string `json:"Type"`
+	Topic string `json:"Topic"`
+	Path  string `json:"Path"`
+	// NoSubscribers captures the notifications no subscriber connected to
+	// this EAA instance accepted too. It suits a single EAA instance,
+	// with more of them every instance without subscribers captures them.
+	NoSubscribers bool `json:"NoSubscribers"`
+}
+
+// WebhookInfo describes the delivery of notifications to consumers POSTing
+// them to webhooks instead of websockets. EAA authenticates to webhooks with
+// its certificate and verifies them against its root CA.
+type WebhookInfo struct {
+	// AllowedHosts are the hosts, e.g. "functions.openness:8443", webhook
+	// URLs may point to, a host without a port allows any port. Empty
+	// disables the webhook delivery.
+	AllowedHosts []string `json:"AllowedHosts"`
+	// Timeout bounds a single POST of a notification, 0 applies the default
+	// of 5s
+	Timeout util.Duration `json:"Timeout"`
+	// Retries is the number of further attempts to POST a notification
+	// which failed, 0 disables retries
+	Retries int `json:"Retries"`
+	// RetryInterval is the delay between the attempts, 0 applies the
+	// default of 1s
+	RetryInterval util.Duration `json:"RetryInterval"`
+	// QueueSize is the number of notifications queued for a webhook,
+	// the oldest one is dropped from a full queue. 0 applies the default
+	// of 100.
+	QueueSize int `json:"QueueSize"`
+}
+
+// RevocationInfo describes the revocation checking of client certificates
+type RevocationInfo struct {
+	// CRLURL is the URL of the CRL issued by the CA, empty disables
+	// CRL checking
+	CRLURL string `json:"CRLURL"`
+	// OCSPResponder is the URL of the OCSP responder, empty disables
+	// OCSP checking
+	OCSPResponder string `json:"OCSPResponder"`
+	// CacheInterval is how long a CRL or an OCSP response is reused,
+	// 0 fetches it on every handshake
+	CacheInterval util.Duration `json:"CacheInterval"`
+	// Strict rejects certificates whose revocation status can't be
+	// determined
+	Strict bool `json:"Strict"`
+}
+
 // Config describes EAA JSON config file
 type Config struct {
-	TLSEndpoint        string        `json:"TlsEndpoint"`
+	TLSEndpoint string `json:"TlsEndpoint"`
+	// OpenEndpoint serves /healthz and /readyz probes without client
+	// certificates, empty disables it
 	OpenEndpoint       string        `json:"OpenEndpoint"`
 	ValidationEndpoint string        `json:"ValidationEndpoint"`
 	HeartbeatInterval  util.Duration `json:"HeartbeatInterval"`
 	Certs              CertsInfo     `json:"Certs"`
 	KafkaBroker        string        `json:"KafkaBroker"`
+	MsgBroker          MsgBrokerInfo `json:"MsgBroker"`
+	// BrokerPublishTimeout bounds publishing a message of a request to
+	// the Message Broker, 0 applies the default of 5s
+	BrokerPublishTimeout util.Duration `json:"BrokerPublishTimeout"`
+	// BrokerPublishAttempts is the maximum number of attempts to publish
+	// a service registration or deregistration within the publish timeout,
+	// 0 or 1 disables retries
+	BrokerPublishAttempts int `json:"BrokerPublishAttempts"`
+	// BrokerPublishRetryDelay is the delay before the first retry, doubled
+	// with every further retry, 0 applies the default of 100ms
+	BrokerPublishRetryDelay util.Duration `json:"BrokerPublishRetryDelay"`
+	// BrokerCircuitThreshold is the number of consecutive failed publishes
+	// opening the Message Broker circuit breaker, 0 applies the default of 5
+	// and a negative value disables the breaker
+	BrokerCircuitThreshold int `json:"BrokerCircuitThreshold"`
+	// BrokerCircuitCooldown is how long the open circuit breaker rejects
+	// the publishes before probing the Message Broker, 0 applies the default
+	// of 30s
+	BrokerCircuitCooldown util.Duration `json:"BrokerCircuitCooldown"`
+	// ShutdownDrainTimeout bounds how long a shutdown waits for the requests
+	// in progress, the consumer send queues and the Message Broker handlers
+	// each, 0 applies the default of 10s
+	ShutdownDrainTimeout util.Duration `json:"ShutdownDrainTimeout"`
+	// SelfTestTimeout bounds the self-test of the certificates and
+	// the Message Broker run before EAA starts listening, 0 applies
+	// the default of 10s
+	SelfTestTimeout util.Duration `json:"SelfTestTimeout"`
+	// SubscriptionStore keeps consumer subscriptions across restarts
+	SubscriptionStore SubscriptionStoreInfo `json:"SubscriptionStore"`
+	// ServiceStore keeps the registered services across restarts
+	ServiceStore ServiceStoreInfo `json:"ServiceStore"`
+	// ServiceReaperInterval is how often expired services are looked up,
+	// 0 disables the service expiry
+	ServiceReaperInterval util.Duration `json:"ServiceReaperInterval"`
+	// DefaultServiceTTL is applied to services registered without a TTL,
+	// 0 means such services never expire
+	DefaultServiceTTL util.Duration `json:"DefaultServiceTTL"`
+	// ExclusiveRegistration rejects the registration of a URN whose live
+	// service was registered with another certificate by 409 Conflict,
+	// false lets the latest registration replace it
+	ExclusiveRegistration bool `json:"ExclusiveRegistration"`
+	// SubscriptionReaperInterval is how often expired subscription leases
+	// are looked up, 0 disables the subscription expiry
+	SubscriptionReaperInterval util.Duration `json:"SubscriptionReaperInterval"`
+	// DefaultSubscriptionLease is applied to subscriptions created without
+	// a lease, 0 means such subscriptions never expire
+	DefaultSubscriptionLease util.Duration `json:"DefaultSubscriptionLease"`
+	// MaxSubscriptionsPerConsumer caps the namespace and service
+	// subscriptions of a consumer combined, 0 applies the default of 10000
+	MaxSubscriptionsPerConsumer int `json:"MaxSubscriptionsPerConsumer"`
+	// NotificationRateLimit is the number of notifications per second
+	// a producer can push, 0 disables the limit
+	NotificationRateLimit float64 `json:"NotificationRateLimit"`
+	// NotificationBurst is the number of notifications a producer can push
+	// at once before NotificationRateLimit applies
+	NotificationBurst int `json:"NotificationBurst"`
+	// NodeNotificationRateLimit is the number of notifications per second
+	// all producers combined can push, 0 disables the limit
+	NodeNotificationRateLimit float64 `json:"NodeNotificationRateLimit"`
+	// NodeNotificationBurst is the number of notifications all producers
+	// combined can push at once before NodeNotificationRateLimit applies,
+	// 0 applies the rate rounded up
+	NodeNotificationBurst int `json:"NodeNotificationBurst"`
+	// BroadcastRateLimit is the number of system broadcasts per second
+	// an admin can make, 0 applies the default of 1
+	BroadcastRateLimit float64 `json:"BroadcastRateLimit"`
+	// NotificationReplayBufferSize is the number of last notifications
+	// retained per consumer for a replay, 0 disables the replay
+	NotificationReplayBufferSize int `json:"NotificationReplayBufferSize"`
+	// MaxRequestBodySize is the maximum size in bytes of a request body,
+	// 0 applies the default of 256 KiB
+	MaxRequestBodySize int64 `json:"MaxRequestBodySize"`
+	// MaxHeaderBytes is the maximum size in bytes of the request line and
+	// the headers of a request, a larger one is rejected with 431. 0 applies
+	// the default of 64 KiB.
+	MaxHeaderBytes int `json:"MaxHeaderBytes"`
+	// MaxURLLength is the maximum length in bytes of a request URL, a longer
+	// one is rejected with 414. It has to be below MaxHeaderBytes, which
+	// bounds the request line as well. 0 applies the default of 8 KiB.
+	MaxURLLength int `json:"MaxURLLength"`
+	// NotificationAckTimeout is how long an at-least-once notification
+	// waits for the ack of the consumer before it's redelivered, 0 applies
+	// the default of 5s
+	NotificationAckTimeout util.Duration `json:"NotificationAckTimeout"`
+	// NotificationMaxUnacked is the number of at-least-once notifications
+	// awaiting the ack of a consumer, the oldest is given up on once
+	// a new one doesn't fit. 0 applies the default of 100.
+	NotificationMaxUnacked int `json:"NotificationMaxUnacked"`
+	// NotificationAckRequired requires the consumers to acknowledge every
+	// notification written to their websocket, not only the at-least-once
+	// ones. The others await the ack without being redelivered.
+	NotificationAckRequired bool `json:"NotificationAckRequired"`
+	// NotificationAckBacklogLimit is the number of notifications awaiting
+	// the ack of a consumer at which NotificationAckBacklogPolicy is
+	// applied, 0 disables it
+	NotificationAckBacklogLimit int `json:"NotificationAckBacklogLimit"`
+	// NotificationAckBacklogPolicy is applied to a consumer reaching
+	// NotificationAckBacklogLimit, either "flag" (default) flagging it in
+	// the connected clients or "disconnect" closing its websocket
+	NotificationAckBacklogPolicy string `json:"NotificationAckBacklogPolicy"`
+	// NotificationAggregationMaxSize bounds the notifications buffered by
+	// the aggregation window of a subscription, a full buffer is delivered
+	// before the window ends. 0 applies the default of 100.
+	NotificationAggregationMaxSize int `json:"NotificationAggregationMaxSize"`
+	// NotificationDedupWindow is the period within which a notification
+	// identical to an already sent one is suppressed, 0 disables it
+	NotificationDedupWindow util.Duration `json:"NotificationDedupWindow"`
+	// NotificationTimestampField is the path of the payload field, dot
+	// separated, holding the timestamp of the producer, which is passed
+	// to the consumers in UTC alongside the receive time. Empty disables it.
+	NotificationTimestampField string `json:"NotificationTimestampField"`
+	// VersionMismatchNotices tells consumers subscribed to a notification
+	// only in versions other than the pushed one about the mismatch, by
+	// a version-mismatch notification of the eaa-discovery namespace
+	VersionMismatchNotices bool `json:"VersionMismatchNotices"`
+	// MetricsEndpoint is the address of the Prometheus metrics listener,
+	// empty disables it
+	MetricsEndpoint string `json:"MetricsEndpoint"`
+	// GRPCEndpoint is the address of the gRPC API listener served
+	// alongside TLSEndpoint, empty disables it
+	GRPCEndpoint string `json:"GRPCEndpoint"`
+	// AdminSocketPath is the Unix domain socket serving GetServices,
+	// GetConnectedClients and the metrics without client certificates to
+	// local operators, access is limited to the owner of EAA by the socket
+	// permissions. Empty disables it.
+	AdminSocketPath string `json:"AdminSocketPath"`
+	// AdminCommonNames are the CommonNames allowed to use admin endpoints
+	AdminCommonNames []string `json:"AdminCommonNames"`
+	// NamespacePolicies restrict the namespaces consumers can subscribe to
+	// and producers can push notifications to, a CommonName not matched by
+	// any policy can access no namespace. Empty allows every namespace.
+	NamespacePolicies []NamespacePolicy `json:"NamespacePolicies"`
+	// PublishPolicies further restrict the namespaces producers can push
+	// notifications to, e.g. shared namespaces only some producers own.
+	// A producer matched by no policy is restricted by NamespacePolicies
+	// only.
+	PublishPolicies []PublishPolicy `json:"PublishPolicies"`
+	// SignedNamespaces are the namespaces whose notifications producers have
+	// to sign, so that consumers can verify them. Notifications of other
+	// namespaces may be signed too.
+	SignedNamespaces []string `json:"SignedNamespaces"`
+	// NotificationSchemas are JSON Schemas pushed notification payloads
+	// are validated against, notifications without a schema aren't
+	// validated. Admins can register more schemas at runtime.
+	NotificationSchemas []NotificationSchema `json:"NotificationSchemas"`
+	// MQTTBridge is the optional bridge to an external MQTT broker
+	MQTTBridge MQTTBridgeInfo `json:"MQTTBridge"`
+	// AuditLogPath is the file audit records of registration and
+	// subscription changes are appended to, empty disables audit logging
+	AuditLogPath string `json:"AuditLogPath"`
+	// CORS allows browsers on other origins to read the registered services
+	// and subscriptions
+	CORS CORSInfo `json:"CORS"`
+	// ResponseCompression compresses the responses of the GET endpoints
+	ResponseCompression ResponseCompressionInfo `json:"ResponseCompression"`
+	// Tracing exports OpenTelemetry spans of the requests and
+	// the notification deliveries
+	Tracing TracingInfo `json:"Tracing"`
+	// Revocation enables CRL and OCSP checking of client certificates
+	Revocation RevocationInfo `json:"Revocation"`
+	// Webhook enables consumers to receive notifications by webhooks
+	Webhook WebhookInfo `json:"Webhook"`
+	// DeadLetter captures the notifications which couldn't be delivered
+	// to any subscriber
+	DeadLetter DeadLetterInfo `json:"DeadLetter"`
+	// MaxConnectionsPerConsumer caps the notification connections a consumer
+	// keeps open at once, websockets, event streams and gRPC streams
+	// combined. An excess connection is rejected with 429 and the reason
+	// connection_limit_exceeded. 0 applies the default of 16.
+	MaxConnectionsPerConsumer int `json:"MaxConnectionsPerConsumer"`
+	// WebSocketPingInterval is how often consumer websockets are pinged,
+	// 0 disables the keepalive
+	WebSocketPingInterval util.Duration `json:"WebSocketPingInterval"`
+	// WebSocketPongTimeout is how long a pong is awaited after a ping before
+	// the websocket is closed, 0 applies WebSocketPingInterval
+	WebSocketPongTimeout util.Duration `json:"WebSocketPongTimeout"`
+	// WebSocketIdleTimeout is how long a consumer websocket stays open
+	// without a notification written to it, a pong or a message of
+	// the consumer. It's closed with the idle_timeout reason then.
+	// 0 disables it.
+	WebSocketIdleTimeout util.Duration `json:"WebSocketIdleTimeout"`
+	// ClientCertificateExpiryGrace is how long a consumer websocket stays
+	// open after the client certificate it was opened with expires. It's
+	// closed then, so that the consumer reconnects with a renewed
+	// certificate. 0 closes it at the expiry, a negative value keeps it open.
+	ClientCertificateExpiryGrace util.Duration `json:"ClientCertificateExpiryGrace"`
+	// WebSocketCompression enables compression of consumer websockets
+	WebSocketCompression WebSocketCompressionInfo `json:"WebSocketCompression"`
+	// WebSocketWriteTimeout bounds writing a notification to a consumer
+	// websocket, 0 applies the default of 1s
+	WebSocketWriteTimeout util.Duration `json:"WebSocketWriteTimeout"`
+	// WebSocketSendQueueSize is the number of notifications queued for
+	// a consumer websocket and written by a goroutine of its own, so that
+	// a slow consumer doesn't delay the others. 0 disables the queue and
+	// notifications are written one consumer after another.
+	WebSocketSendQueueSize int `json:"WebSocketSendQueueSize"`
+	// WebSocketSendQueueOverflow is applied to a full send queue, either
+	// "drop-oldest" (default) dropping the oldest queued notification or
+	// "disconnect" closing the websocket
+	WebSocketSendQueueOverflow string `json:"WebSocketSendQueueOverflow"`
+	// NotificationWorkers is the number of goroutines writing a notification
+	// to its subscribers concurrently, so that the delivery takes about as
+	// long as the slowest writes instead of all of them. 0 or 1 writes to
+	// one subscriber after another.
+	NotificationWorkers int `json:"NotificationWorkers"`
+	// DeliveryReportTimeout is how long PushNotificationToSubscribers waits
+	// for the delivery summary, 0 applies the default of 3s
+	DeliveryReportTimeout util.Duration `json:"DeliveryReportTimeout"`
 }
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/open-ness/edgenode/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// restartConfigFields are the config fields applied at startup only,
+// e.g. the listeners, the Message Broker and the certificates. A reload
+// keeps their current values and reports their changes as requiring
+// a restart.
+var restartConfigFields = []string{
+	"TLSEndpoint",
+	"OpenEndpoint",
+	"ValidationEndpoint",
+	"HeartbeatInterval",
+	"Certs",
+	"KafkaBroker",
+	"MsgBroker",
+	"SubscriptionStore",
+	"ServiceStore",
+	"ServiceReaperInterval",
+	"SubscriptionReaperInterval",
+	"MetricsEndpoint",
+	"GRPCEndpoint",
+	"AdminSocketPath",
+	"NotificationSchemas",
+	"MQTTBridge",
+	"AuditLogPath",
+	"CORS",
+	"Revocation",
+	"Tracing",
+	"SelfTestTimeout",
+	"DeadLetter",
+	"MaxHeaderBytes",
+}
+
+// reloadedConfig is a config applied by a reload together with
+// the structures derived from it
+type reloadedConfig struct {
+	cfg             Config
+	publishPolicies publishPolicies
+}
+
+// config returns the config in effect, the one of the last reload or
+// the one the context was initialized with
+func (eaaCtx *Context) config() *Config {
+	if reloaded, ok := eaaCtx.reloaded.Load().(*reloadedConfig); ok {
+		return &reloaded.cfg
+	}
+	return &eaaCtx.cfg
+}
+
+// currentPublishPolicies returns the publish policies of the config
+// in effect
+func (eaaCtx *Context) currentPublishPolicies() publishPolicies {
+	if reloaded, ok := eaaCtx.reloaded.Load().(*reloadedConfig); ok {
+		return reloaded.publishPolicies
+	}
+	return eaaCtx.publishPolicies
+}
+
+// validateConfig checks the settings which can't be checked by decoding
+// the config
+func validateConfig(cfg *Config) error {
+	switch cfg.WebSocketSendQueueOverflow {
+	case "", sendQueueOverflowDropOldest, sendQueueOverflowDisconnect:
+	default:
+		return errors.Errorf("Unknown send queue overflow policy: %v",
+			cfg.WebSocketSendQueueOverflow)
+	}
+	switch cfg.NotificationAckBacklogPolicy {
+	case "", ackBacklogPolicyFlag, ackBacklogPolicyDisconnect:
+	default:
+		return errors.Errorf("Unknown ack backlog policy: %v",
+			cfg.NotificationAckBacklogPolicy)
+	}
+	if maxURLLength(cfg) >= maxHeaderBytes(cfg) {
+		return errors.Errorf("MaxURLLength %d isn't below MaxHeaderBytes %d",
+			maxURLLength(cfg), maxHeaderBytes(cfg))
+	}
+	if err := validateDeadLetter(cfg.DeadLetter); err != nil {
+		return err
+	}
+	return validateTracing(cfg.Tracing)
+}
+
+// configFieldName returns the name of the config field in the config file
+func configFieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// reloadConfig re-reads the config file and applies it to the context.
+// The new config is validated fully first, an invalid one is rejected and
+// the config in effect is kept. Connections and the Message Broker
+// subscriptions are untouched, the settings apply to the requests and
+// notifications handled from then on. The changed fields applied at
+// startup only are returned.
+func reloadConfig(eaaCtx *Context) ([]string, error) {
+	eaaCtx.reloadLock.Lock()
+	defer eaaCtx.reloadLock.Unlock()
+
+	if eaaCtx.cfgPath == "" {
+		return nil, errors.New("EAA was not started with a config file")
+	}
+
+	var cfg Config
+	if err := config.LoadJSONConfig(eaaCtx.cfgPath, &cfg); err != nil {
+		return nil, errors.Wrap(err, "Failed to load config")
+	}
+	if err := validateConfig(&cfg); err != nil {
+		return nil, err
+	}
+	policies, err := newPublishPolicies(cfg.PublishPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	current := reflect.ValueOf(eaaCtx.config()).Elem()
+	reloaded := reflect.ValueOf(&cfg).Elem()
+	var restartRequired []string
+	for _, name := range restartConfigFields {
+		field, _ := current.Type().FieldByName(name)
+		if !reflect.DeepEqual(current.FieldByName(name).Interface(),
+			reloaded.FieldByName(name).Interface()) {
+			restartRequired = append(restartRequired, configFieldName(field))
+		}
+		reloaded.FieldByName(name).Set(current.FieldByName(name))
+	}
+
+	eaaCtx.reloaded.Store(&reloadedConfig{cfg: cfg, publishPolicies: policies})
+	if len(restartRequired) > 0 {
+		log.Warningf("Config reloaded, changes of %s require a restart",
+			strings.Join(restartRequired, ", "))
+	} else {
+		log.Info("Config reloaded")
+	}
+	return restartRequired, nil
+}
+
+// reloadConfigOnSignal reloads the config on every SIGHUP until the parent
+// context is done
+func reloadConfigOnSignal(parentCtx context.Context, eaaCtx *Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-signals:
+			if _, err := reloadConfig(eaaCtx); err != nil {
+				log.Errf("Config reload failed, the config in effect is kept: %s",
+					err.Error())
+			}
+		case <-parentCtx.Done():
+			return
+		}
+	}
+}
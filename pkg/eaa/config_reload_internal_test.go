@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Config reload", func() {
+	var (
+		eaaCtx  *Context
+		tempdir string
+	)
+
+	writeConfig := func(cfg string) {
+		Expect(ioutil.WriteFile(filepath.Join(tempdir, "eaa.json"), []byte(cfg),
+			0600)).To(Succeed())
+	}
+
+	g.BeforeEach(func() {
+		var err error
+		tempdir, err = ioutil.TempDir("", "eaaReloadTest")
+		Expect(err).ToNot(HaveOccurred())
+
+		eaaCtx = &Context{cfgPath: filepath.Join(tempdir, "eaa.json")}
+		eaaCtx.cfg.TLSEndpoint = "0.0.0.0:443"
+		eaaCtx.cfg.NotificationRateLimit = 10
+		eaaCtx.cfg.AdminCommonNames = []string{"ns:admin"}
+	})
+
+	g.AfterEach(func() {
+		os.RemoveAll(tempdir)
+	})
+
+	g.It("applies the runtime settings", func() {
+		writeConfig(`{"TlsEndpoint":"0.0.0.0:443","NotificationRateLimit":5,
+			"AdminCommonNames":["ns:admin"],
+			"PublishPolicies":[{"CommonName":"ns:producer","Deny":["private"]}]}`)
+
+		restartRequired, err := reloadConfig(eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restartRequired).To(BeEmpty())
+		Expect(eaaCtx.config().NotificationRateLimit).To(Equal(5.0))
+		Expect(eaaCtx.currentPublishPolicies().check("ns:producer", "private")).
+			ToNot(Succeed())
+		Expect(eaaCtx.cfg.NotificationRateLimit).To(Equal(10.0))
+	})
+
+	g.It("reports the changes requiring a restart and keeps them", func() {
+		writeConfig(`{"TlsEndpoint":"0.0.0.0:8443","NotificationRateLimit":5,
+			"MsgBroker":{"Type":"gochannels"}}`)
+
+		restartRequired, err := reloadConfig(eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restartRequired).To(ConsistOf("TlsEndpoint", "MsgBroker"))
+		Expect(eaaCtx.config().TLSEndpoint).To(Equal("0.0.0.0:443"))
+		Expect(eaaCtx.config().MsgBroker.Type).To(BeEmpty())
+		Expect(eaaCtx.config().NotificationRateLimit).To(Equal(5.0))
+	})
+
+	table.DescribeTable("keeps the config in effect if the new one is invalid",
+		func(cfg string) {
+			writeConfig(cfg)
+
+			_, err := reloadConfig(eaaCtx)
+			Expect(err).To(HaveOccurred())
+			Expect(eaaCtx.config()).To(BeIdenticalTo(&eaaCtx.cfg))
+		},
+		table.Entry("malformed", `{"NotificationRateLimit":`),
+		table.Entry("unknown overflow policy", `{"WebSocketSendQueueOverflow":"block"}`),
+		table.Entry("duplicated publish policy",
+			`{"PublishPolicies":[{"CommonName":"ns:p"},{"CommonName":"ns:p"}]}`),
+	)
+
+	g.It("is served to admins", func() {
+		writeConfig(`{"TlsEndpoint":"0.0.0.0:8443","AdminCommonNames":["ns:admin"]}`)
+
+		rec := httptest.NewRecorder()
+		ReloadConfig(rec, newTLSRequest(http.MethodPost, "/admin/config/reload", "",
+			"ns:consumer", eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(eaaCtx.config()).To(BeIdenticalTo(&eaaCtx.cfg))
+
+		rec = httptest.NewRecorder()
+		ReloadConfig(rec, newTLSRequest(http.MethodPost, "/admin/config/reload", "",
+			"ns:admin", eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var result ConfigReload
+		Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+		Expect(result.RestartRequired).To(Equal([]string{"TlsEndpoint"}))
+
+		writeConfig(`{"WebSocketSendQueueOverflow":"block"}`)
+		rec = httptest.NewRecorder()
+		ReloadConfig(rec, newTLSRequest(http.MethodPost, "/admin/config/reload", "",
+			"ns:admin", eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonConfigReloadFailed))
+	})
+})
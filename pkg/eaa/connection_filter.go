@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// errInvalidConnectionFilter is returned if a consumer requests
+// a connection filter which can't match any notification
+var errInvalidConnectionFilter = errors.New("invalid connection filter")
+
+// connectionFilter scopes the notifications delivered over a consumer
+// connection to a subset of the consumer subscriptions, the stored
+// subscriptions are untouched. A notification is delivered if its
+// namespace is one of the namespaces and its name one of the names,
+// an empty list doesn't restrict. The zero value delivers every
+// notification.
+type connectionFilter struct {
+	namespaces []string
+	names      []string
+}
+
+// parseConnectionFilter returns the filter of the namespace and name query
+// parameters of a notifications request, each of them may be repeated
+func parseConnectionFilter(r *http.Request) (connectionFilter, error) {
+	query := r.URL.Query()
+	filter := connectionFilter{namespaces: query["namespace"], names: query["name"]}
+	for _, namespace := range filter.namespaces {
+		if err := validateURNComponent("namespace", namespace); err != nil {
+			return connectionFilter{}, fmt.Errorf("%w: %v", errInvalidConnectionFilter, err)
+		}
+	}
+	for _, name := range filter.names {
+		if name == "" {
+			return connectionFilter{}, fmt.Errorf("%w: name is empty",
+				errInvalidConnectionFilter)
+		}
+	}
+	return filter, nil
+}
+
+// accepts checks if the notification is delivered over the connection
+func (f connectionFilter) accepts(key UniqueNotif) bool {
+	return containsOrEmpty(f.namespaces, key.namespace) &&
+		containsOrEmpty(f.names, key.notifName)
+}
+
+// unfiltered checks if the filter delivers every notification
+func (f connectionFilter) unfiltered() bool {
+	return len(f.namespaces) == 0 && len(f.names) == 0
+}
+
+// containsOrEmpty checks if the list is empty or contains the value
+func containsOrEmpty(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionAccepts checks if any connection of the consumer accepts
+// the notification. A consumer without a connection accepts it, so that
+// its delivery is tried and accounted for as usual.
+func connectionAccepts(subID string, key UniqueNotif, eaaCtx *Context) bool {
+	eaaCtx.consumerConnections.RLock()
+	defer eaaCtx.consumerConnections.RUnlock()
+
+	consumerConns, found := eaaCtx.consumerConnections.m[subID]
+	if !found {
+		return true
+	}
+	for _, consumerConn := range consumerConns {
+		if consumerConn.filter.accepts(key) {
+			return true
+		}
+	}
+	return false
+}
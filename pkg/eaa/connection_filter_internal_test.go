@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Connection filter", func() {
+	table.DescribeTable("is parsed from the notifications request",
+		func(query string, expected connectionFilter, valid bool) {
+			filter, err := parseConnectionFilter(httptest.NewRequest(http.MethodGet,
+				"/notifications"+query, nil))
+			if !valid {
+				Expect(errors.Is(err, errInvalidConnectionFilter)).To(BeTrue())
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(filter).To(Equal(expected))
+		},
+		table.Entry("none", "", connectionFilter{}, true),
+		table.Entry("repeated", "?namespace=ns&namespace=other&name=alarm",
+			connectionFilter{namespaces: []string{"ns", "other"}, names: []string{"alarm"}}, true),
+		table.Entry("invalid namespace", "?namespace=a:b", connectionFilter{}, false),
+		table.Entry("empty name", "?name=", connectionFilter{}, false),
+	)
+
+	table.DescribeTable("accepts the notifications of its namespaces and names",
+		func(filter connectionFilter, accepted bool) {
+			Expect(filter.accepts(UniqueNotif{"ns", "alarm", "1.0"})).To(Equal(accepted))
+		},
+		table.Entry("empty", connectionFilter{}, true),
+		table.Entry("namespace", connectionFilter{namespaces: []string{"other", "ns"}}, true),
+		table.Entry("other namespace", connectionFilter{namespaces: []string{"other"}}, false),
+		table.Entry("name", connectionFilter{names: []string{"alarm"}}, true),
+		table.Entry("other name", connectionFilter{namespaces: []string{"ns"},
+			names: []string{"status"}}, false),
+	)
+
+	g.It("scopes the notifications delivered over the connection", func() {
+		filtered := make(chan []byte, 1)
+		unfiltered := make(chan []byte, 1)
+		eaaCtx := newFanOutContext([]notificationConn{
+			&fakeNotificationConn{sent: filtered},
+			&fakeNotificationConn{sent: unfiltered},
+		})
+		eaaCtx.cfg.NotificationReplayBufferSize = 10
+		filter := connectionFilter{names: []string{"alarm"}}
+		eaaCtx.consumerConnections.m["ns:consumer0"][0].filter = filter
+
+		summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(`{}`)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(DeliverySummary{Subscribers: 1, Delivered: 1}))
+		Expect(unfiltered).To(HaveLen(1))
+		Expect(filtered).To(BeEmpty())
+
+		// The subscriptions are untouched and the notification is retained
+		// for the connections accepting it
+		Expect(countConsumerSubscriptions("ns:consumer0", eaaCtx)).To(Equal(1))
+		Expect(eaaCtx.replayBuffers.since("ns:consumer0", 0, filter)).To(BeEmpty())
+		Expect(eaaCtx.replayBuffers.since("ns:consumer0", 0, connectionFilter{})).
+			To(HaveLen(1))
+	})
+
+	g.It("fans the notifications across the connections of a consumer", func() {
+		alarms := make(chan []byte, 2)
+		statuses := make(chan []byte, 2)
+		eaaCtx := newFanOutContext([]notificationConn{&fakeNotificationConn{sent: alarms}})
+		eaaCtx.consumerConnections.m["ns:consumer0"][0].filter =
+			connectionFilter{names: []string{"alarm"}}
+		eaaCtx.consumerConnections.add("ns:consumer0", ConsumerConnection{
+			connection: &fakeNotificationConn{sent: statuses},
+			filter:     connectionFilter{names: []string{"status"}}})
+		Expect(addSubscriptionToNamespace("ns:consumer0", "ns", []NotificationDescriptor{
+			{Name: "alarm", Version: "1.0"}, {Name: "status", Version: "1.0"}},
+			eaaCtx)).To(Succeed())
+
+		for _, name := range []string{"alarm", "status", "alarm"} {
+			summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+				&NotificationFromProducer{Name: name, Version: "1.0",
+					Payload: json.RawMessage(`{}`)}, "", eaaCtx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(summary).To(Equal(DeliverySummary{Subscribers: 1, Delivered: 1}))
+		}
+
+		Expect(alarms).To(HaveLen(2))
+		Expect(statuses).To(HaveLen(1))
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-statuses, &notif)).To(Succeed())
+		Expect(notif.Name).To(Equal("status"))
+	})
+
+	g.It("is validated by the event stream", func() {
+		eaaCtx := newFanOutContext(nil)
+		rec := httptest.NewRecorder()
+		GetNotificationsSSE(rec, newTLSRequest(http.MethodGet,
+			"/notifications/sse?namespace=a:b", "", "ns:consumer", eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonInvalidQuery))
+		Expect(eaaCtx.consumerConnections.m).To(BeEmpty())
+	})
+})
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// corsRoutes are the names of the read-only routes browsers on other
+// origins may call
+var corsRoutes = map[string]bool{
+	"GetServices":      true,
+	"GetSubscriptions": true,
+}
+
+// corsHandler answers CORS preflight requests and sets the CORS headers
+// of the responses of corsRoutes to requests from the allowed origins.
+// Other requests are passed to the router untouched.
+type corsHandler struct {
+	router *mux.Router
+	cfg    CORSInfo
+}
+
+// newCORSHandler wraps the router with the CORS handling of the config,
+// the router is returned as is if no origin is allowed
+func newCORSHandler(router *mux.Router, cfg CORSInfo) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return router
+	}
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = []string{http.MethodGet}
+	}
+	return &corsHandler{router: router, cfg: cfg}
+}
+
+// containsFold checks if the list contains the value ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCORSRoute checks if a request with the method matches one of corsRoutes
+func (h *corsHandler) isCORSRoute(r *http.Request, method string) bool {
+	if !containsFold(h.cfg.AllowedMethods, method) {
+		return false
+	}
+
+	matched := r.Clone(r.Context())
+	matched.Method = method
+	var match mux.RouteMatch
+	return h.router.Match(matched, &match) && match.Route != nil &&
+		corsRoutes[match.Route.GetName()]
+}
+
+// headersAllowed checks if all the request headers listed by a preflight
+// request are allowed
+func (h *corsHandler) headersAllowed(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !containsFold(h.cfg.AllowedHeaders, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		h.router.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	if !containsFold(h.cfg.AllowedOrigins, origin) {
+		h.router.ServeHTTP(w, r)
+		return
+	}
+
+	requestedMethod := r.Header.Get("Access-Control-Request-Method")
+	if r.Method == http.MethodOptions && requestedMethod != "" {
+		requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if !h.isCORSRoute(r, requestedMethod) || !h.headersAllowed(requestedHeaders) {
+			// The browser fails the preflight without the CORS headers
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Methods",
+			strings.Join(h.cfg.AllowedMethods, ", "))
+		if len(h.cfg.AllowedHeaders) != 0 {
+			w.Header().Set("Access-Control-Allow-Headers",
+				strings.Join(h.cfg.AllowedHeaders, ", "))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if h.isCORSRoute(r, r.Method) {
+		// Browsers authenticate with client certificates, which are
+		// credentials for CORS
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", totalCountHeader)
+	}
+	h.router.ServeHTTP(w, r)
+}
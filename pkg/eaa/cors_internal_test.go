@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("CORS", func() {
+	const origin = "https://dashboard.example.com"
+
+	var (
+		eaaCtx  *Context
+		handler http.Handler
+	)
+
+	serve := func(method string, path string, header http.Header) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest(method, path, "", "ns:consumer", eaaCtx)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		handler = newCORSHandler(NewEaaRouter(eaaCtx), CORSInfo{
+			AllowedOrigins: []string{origin},
+			AllowedHeaders: []string{"X-Request-ID"},
+		})
+	})
+
+	g.It("allows an origin to read the services", func() {
+		rec := serve("GET", "/services", http.Header{"Origin": {origin}})
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(Equal(origin))
+		Expect(rec.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		Expect(rec.Header().Get("Access-Control-Expose-Headers")).To(
+			Equal(totalCountHeader))
+	})
+
+	g.It("answers a preflight request", func() {
+		rec := serve("OPTIONS", "/subscriptions", http.Header{
+			"Origin":                         {origin},
+			"Access-Control-Request-Method":  {"GET"},
+			"Access-Control-Request-Headers": {"x-request-id"},
+		})
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(Equal(origin))
+		Expect(rec.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET"))
+		Expect(rec.Header().Get("Access-Control-Allow-Headers")).To(Equal("X-Request-ID"))
+	})
+
+	g.It("rejects preflight requests for other methods, routes and headers", func() {
+		for _, header := range []http.Header{
+			{"Access-Control-Request-Method": {"POST"}},
+			{"Access-Control-Request-Method": {"GET"},
+				"Access-Control-Request-Headers": {"X-Custom"}},
+		} {
+			header.Set("Origin", origin)
+			rec := serve("OPTIONS", "/services", header)
+
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		}
+
+		rec := serve("OPTIONS", "/admin/clients", http.Header{"Origin": {origin},
+			"Access-Control-Request-Method": {"GET"}})
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+	})
+
+	g.It("sets no CORS headers for other origins", func() {
+		rec := serve("GET", "/services", http.Header{"Origin": {"https://evil.example.com"}})
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	g.It("is disabled without allowed origins", func() {
+		router := NewEaaRouter(eaaCtx)
+		Expect(newCORSHandler(router, CORSInfo{})).To(BeIdenticalTo(router))
+	})
+})
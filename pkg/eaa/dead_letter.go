@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// Notifications this EAA instance couldn't deliver to any subscriber are
+// captured by the dead-letter sink with the reason, so that operators can
+// recover or diagnose them. A notification is undeliverable if it was
+// written to none of the subscribers accepting it, or, with
+// DeadLetter.NoSubscribers, if no subscriber connected to the instance
+// accepted it. Duplicate notifications aren't captured.
+
+// Dead-letter sink types
+const (
+	deadLetterTypeTopic = "topic"
+	deadLetterTypeFile  = "file"
+)
+
+// Reasons of dead letters
+const (
+	deadLetterReasonNoSubscribers  = "no_subscribers"
+	deadLetterReasonDeliveryFailed = "delivery_failed"
+)
+
+// deadLetterSink captures the undeliverable notifications, it's nil if
+// the dead-letter sink is disabled
+type deadLetterSink struct {
+	sync.Mutex
+	cfg DeadLetterInfo
+	// file the dead letters are appended to as JSON lines
+	w io.Writer
+}
+
+// validateDeadLetter checks the config of the dead-letter sink
+func validateDeadLetter(cfg DeadLetterInfo) error {
+	switch cfg.Type {
+	case "":
+	case deadLetterTypeTopic:
+		if cfg.Topic == "" {
+			return errors.New("Dead-letter sink of type topic without a Topic")
+		}
+	case deadLetterTypeFile:
+		if cfg.Path == "" {
+			return errors.New("Dead-letter sink of type file without a Path")
+		}
+	default:
+		return errors.Errorf("Unknown dead-letter sink type: %v", cfg.Type)
+	}
+	return nil
+}
+
+// newDeadLetterSink creates the dead-letter sink of the config, nil if it's
+// disabled
+func newDeadLetterSink(cfg DeadLetterInfo) (*deadLetterSink, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case deadLetterTypeFile:
+		f, err := os.OpenFile(filepath.Clean(cfg.Path),
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to open the dead-letter file %s", cfg.Path)
+		}
+		return &deadLetterSink{cfg: cfg, w: f}, nil
+	}
+	return &deadLetterSink{cfg: cfg}, nil
+}
+
+// undeliveredReason returns the reason the notification of the delivery
+// summary is a dead letter, empty if it isn't one
+func (s *deadLetterSink) undeliveredReason(summary DeliverySummary) string {
+	switch {
+	case s == nil:
+		return ""
+	case summary.Subscribers == 0:
+		if s.cfg.NoSubscribers {
+			return deadLetterReasonNoSubscribers
+		}
+	case summary.Delivered == 0 && summary.Aggregated == 0:
+		return deadLetterReasonDeliveryFailed
+	}
+	return ""
+}
+
+// capture writes the dead letter of the notification to the sink if
+// the delivery summary makes it undeliverable
+func (s *deadLetterSink) capture(prodURN URN, notif *NotificationFromProducer,
+	correlationID string, summary DeliverySummary, eaaCtx *Context) {
+
+	reason := s.undeliveredReason(summary)
+	if reason == "" {
+		return
+	}
+
+	data, err := json.Marshal(DeadLetter{
+		Timestamp:     time.Now().UTC(),
+		Reason:        reason,
+		URN:           prodURN,
+		CorrelationID: correlationID,
+		Subscribers:   summary.Subscribers,
+		Failed:        summary.Failed,
+		Notification:  *notif,
+	})
+	if err != nil {
+		log.Errf("Failed to marshal the dead letter of %s: %s", correlationID, err.Error())
+		return
+	}
+
+	if s.cfg.Type == deadLetterTypeFile {
+		err = s.writeFile(data)
+	} else {
+		err = s.publish(prodURN, data, correlationID, eaaCtx)
+	}
+	if err != nil {
+		log.Errf("Failed to capture the dead letter of %s: %s", correlationID, err.Error())
+		return
+	}
+	notificationsDeadLetteredTotal.WithLabelValues(reason).Inc()
+	log.Infof("Notification %s of %s captured as a dead letter: %s", correlationID,
+		prodURN.String(), reason)
+}
+
+// writeFile appends the dead letter to the file of the sink
+func (s *deadLetterSink) writeFile(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	_, err := s.w.Write(append(data, '\n'))
+	return err
+}
+
+// deadLetterMetadataKey marks a dead letter message, whose topic is set by
+// the config, so that the Kafka broker can key it
+const deadLetterMetadataKey = "dead_letter"
+
+// publish publishes the dead letter to the Message Broker topic of the sink.
+// The publish bypasses the circuit breaker, failing to capture dead letters
+// must not reject the publishes of notifications and registrations.
+func (s *deadLetterSink) publish(prodURN URN, data []byte, correlationID string,
+	eaaCtx *Context) error {
+	err := eaaCtx.MsgBrokerCtx.addPublisher(deadLetterPublisher, s.cfg.Topic, nil)
+	if _, ok := err.(objectAlreadyExistsError); err != nil && !ok {
+		return err
+	}
+
+	msg := message.NewMessage(prodURN.String(), data)
+	msg.Metadata.Set(correlationIDMetadataKey, correlationID)
+	msg.Metadata.Set(deadLetterMetadataKey, "true")
+	ctx, cancel := withPublishTimeout(context.Background(), eaaCtx)
+	defer cancel()
+	return publishInSpan(ctx, s.cfg.Topic, msg, func(ctx context.Context) error {
+		return eaaCtx.MsgBrokerCtx.publish(ctx, s.cfg.Topic, msg)
+	})
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// recordingMsgBroker is a Message Broker passing the published messages
+// to a channel
+type recordingMsgBroker struct {
+	*GoChannelMsgBroker
+	published chan *message.Message
+}
+
+func (b recordingMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
+	b.published <- msg
+	return nil
+}
+
+var _ = g.Describe("Dead-letter sink", func() {
+	var (
+		tempdir string
+		eaaCtx  *Context
+	)
+
+	push := func(conns []notificationConn, cfg DeadLetterInfo) DeliverySummary {
+		eaaCtx = newFanOutContext(conns)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		sink, err := newDeadLetterSink(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		eaaCtx.deadLetters = sink
+
+		summary, err := sendNotificationToAllSubscribers("ns:producer",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(`{"n":1}`)}, "corr-1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		return summary
+	}
+
+	deadLetters := func() []DeadLetter {
+		f, err := os.Open(filepath.Join(tempdir, "dead_letters.json"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		var letters []DeadLetter
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var letter DeadLetter
+			Expect(json.Unmarshal(scanner.Bytes(), &letter)).To(Succeed())
+			letters = append(letters, letter)
+		}
+		return letters
+	}
+
+	fileSink := func(noSubscribers bool) DeadLetterInfo {
+		return DeadLetterInfo{Type: deadLetterTypeFile,
+			Path: filepath.Join(tempdir, "dead_letters.json"), NoSubscribers: noSubscribers}
+	}
+
+	g.BeforeEach(func() {
+		var err error
+		tempdir, err = ioutil.TempDir("", "eaaDeadLetterTest")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	g.AfterEach(func() {
+		Expect(os.RemoveAll(tempdir)).To(Succeed())
+	})
+
+	g.It("captures a notification without subscribers to the file", func() {
+		Expect(push(nil, fileSink(true))).To(Equal(DeliverySummary{}))
+
+		Eventually(deadLetters).Should(HaveLen(1))
+		letter := deadLetters()[0]
+		Expect(letter.Reason).To(Equal(deadLetterReasonNoSubscribers))
+		Expect(letter.URN).To(Equal(URN{Namespace: "ns", ID: "producer"}))
+		Expect(letter.CorrelationID).To(Equal("corr-1"))
+		Expect(letter.Notification.Name).To(Equal("n1"))
+		Expect(string(letter.Notification.Payload)).To(Equal(`{"n":1}`))
+	})
+
+	g.It("ignores a notification without subscribers unless enabled", func() {
+		push(nil, fileSink(false))
+		Consistently(deadLetters, 100*time.Millisecond).Should(BeEmpty())
+	})
+
+	g.It("captures a notification written to none of the subscribers", func() {
+		Expect(push([]notificationConn{&failingNotificationConn{}}, fileSink(false))).To(
+			Equal(DeliverySummary{Subscribers: 1, Failed: 1}))
+
+		Eventually(deadLetters).Should(HaveLen(1))
+		letter := deadLetters()[0]
+		Expect(letter.Reason).To(Equal(deadLetterReasonDeliveryFailed))
+		Expect(letter.Subscribers).To(Equal(1))
+		Expect(letter.Failed).To(Equal(1))
+	})
+
+	g.It("ignores a notification delivered to a subscriber", func() {
+		push([]notificationConn{&failingNotificationConn{},
+			&fakeNotificationConn{sent: make(chan []byte, 1)}}, fileSink(true))
+		Consistently(deadLetters, 100*time.Millisecond).Should(BeEmpty())
+	})
+
+	g.It("publishes the dead letters to the topic", func() {
+		published := make(chan *message.Message, 1)
+		eaaCtx = newFanOutContext(nil)
+		eaaCtx.MsgBrokerCtx = recordingMsgBroker{NewGoChannelMsgBroker(eaaCtx), published}
+		eaaCtx.deadLetters, _ = newDeadLetterSink(DeadLetterInfo{Type: deadLetterTypeTopic,
+			Topic: "dead-letters", NoSubscribers: true})
+
+		_, err := sendNotificationToAllSubscribers("ns:producer",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(`{"n":1}`)}, "corr-1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+
+		var msg *message.Message
+		Eventually(published).Should(Receive(&msg))
+		Expect(msg.UUID).To(Equal("ns:producer"))
+		Expect(msg.Metadata.Get(correlationIDMetadataKey)).To(Equal("corr-1"))
+		var letter DeadLetter
+		Expect(json.Unmarshal(msg.Payload, &letter)).To(Succeed())
+		Expect(letter.Reason).To(Equal(deadLetterReasonNoSubscribers))
+
+		marshaled, err := kafka.NewWithPartitioningMarshaler(keyGenerator).Marshal(
+			"dead-letters", msg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(marshaled.Key).ToNot(BeNil())
+	})
+
+	g.It("publishes the dead letters past the circuit breaker", func() {
+		var attempts int32
+		eaaCtx = newFanOutContext(nil)
+		eaaCtx.cfg.BrokerCircuitThreshold = 1
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 1, &attempts}
+		sink, err := newDeadLetterSink(DeadLetterInfo{Type: deadLetterTypeTopic,
+			Topic: "dead-letters"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(sink.publish(URN{Namespace: "ns", ID: "producer"}, []byte(`{}`), "corr-1",
+			eaaCtx)).ToNot(Succeed())
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+
+		eaaCtx.publishBreaker.Lock()
+		defer eaaCtx.publishBreaker.Unlock()
+		Expect(eaaCtx.publishBreaker.state).To(Equal(circuitClosed))
+		Expect(eaaCtx.publishBreaker.failures).To(BeZero())
+	})
+
+	table.DescribeTable("validates the config",
+		func(cfg DeadLetterInfo, valid bool) {
+			if valid {
+				Expect(validateDeadLetter(cfg)).To(Succeed())
+			} else {
+				Expect(validateDeadLetter(cfg)).ToNot(Succeed())
+			}
+		},
+		table.Entry("disabled", DeadLetterInfo{}, true),
+		table.Entry("topic", DeadLetterInfo{Type: "topic", Topic: "dead-letters"}, true),
+		table.Entry("topic without a Topic", DeadLetterInfo{Type: "topic"}, false),
+		table.Entry("file", DeadLetterInfo{Type: "file", Path: "/tmp/dl.json"}, true),
+		table.Entry("file without a Path", DeadLetterInfo{Type: "file"}, false),
+		table.Entry("unknown type", DeadLetterInfo{Type: "queue"}, false),
+	)
+})
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxDedupEntries bounds the number of notification hashes remembered
+// for deduplication, the oldest ones are forgotten first
+const maxDedupEntries = 100000
+
+// notificationHash identifies the content of a notification
+type notificationHash [sha256.Size]byte
+
+type dedupEntry struct {
+	hash notificationHash
+	seen time.Time
+}
+
+// notificationDeduplicator remembers notifications sent within a time window.
+// The zero value is ready to use.
+type notificationDeduplicator struct {
+	sync.Mutex
+	seen map[notificationHash]time.Time
+	// entries in the order they were seen, the oldest first
+	entries []dedupEntry
+}
+
+// hashNotification returns the hash of a notification of a producer
+func hashNotification(prodURN URN, notif *NotificationFromProducer) notificationHash {
+	h := sha256.New()
+	for _, field := range []string{prodURN.String(), notif.Name, notif.Version} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	h.Write(notif.Payload)
+
+	var hash notificationHash
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// isDuplicate reports if the same notification was seen within the window
+// and remembers it otherwise. A window <= 0 disables the deduplication.
+func (d *notificationDeduplicator) isDuplicate(hash notificationHash,
+	window time.Duration, now time.Time) bool {
+
+	if window <= 0 {
+		return false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[notificationHash]time.Time)
+	}
+
+	// Forget entries which fell out of the window or exceed the limit
+	for len(d.entries) > 0 && (now.Sub(d.entries[0].seen) >= window ||
+		len(d.entries) >= maxDedupEntries) {
+
+		oldest := d.entries[0]
+		if d.seen[oldest.hash] == oldest.seen {
+			delete(d.seen, oldest.hash)
+		}
+		d.entries = d.entries[1:]
+	}
+
+	if _, found := d.seen[hash]; found {
+		return true
+	}
+
+	d.seen[hash] = now
+	d.entries = append(d.entries, dedupEntry{hash: hash, seen: now})
+	return false
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("notificationDeduplicator", func() {
+	var (
+		dedup notificationDeduplicator
+		now   time.Time
+		hash  notificationHash
+	)
+	producer := URN{ID: "producer", Namespace: "ns"}
+
+	g.BeforeEach(func() {
+		dedup = notificationDeduplicator{}
+		now = time.Now()
+		hash = hashNotification(producer, &NotificationFromProducer{
+			Name: "n1", Version: "1.0", Payload: json.RawMessage(`{"a":1}`)})
+	})
+
+	g.It("does not deduplicate when the window is disabled", func() {
+		Expect(dedup.isDuplicate(hash, 0, now)).To(BeFalse())
+		Expect(dedup.isDuplicate(hash, 0, now)).To(BeFalse())
+	})
+
+	g.It("suppresses an identical notification within the window", func() {
+		Expect(dedup.isDuplicate(hash, time.Second, now)).To(BeFalse())
+		Expect(dedup.isDuplicate(hash, time.Second, now.Add(time.Millisecond))).To(BeTrue())
+
+		g.By("forgetting it after the window")
+		Expect(dedup.isDuplicate(hash, time.Second, now.Add(time.Second))).To(BeFalse())
+		Expect(dedup.entries).To(HaveLen(1))
+	})
+
+	g.It("distinguishes notifications by producer, name, version and payload", func() {
+		notif := NotificationFromProducer{Name: "n1", Version: "1.0",
+			Payload: json.RawMessage(`{"a":1}`)}
+		other := notif
+		other.Payload = json.RawMessage(`{"a":2}`)
+
+		Expect(hashNotification(producer, &notif)).To(Equal(hash))
+		Expect(hashNotification(producer, &other)).NotTo(Equal(hash))
+		Expect(hashNotification(URN{ID: "other", Namespace: "ns"}, &notif)).
+			NotTo(Equal(hash))
+
+		other = notif
+		other.Version = "1.1"
+		Expect(hashNotification(producer, &other)).NotTo(Equal(hash))
+	})
+
+	g.It("is bounded", func() {
+		for i := 0; i < maxDedupEntries+10; i++ {
+			var h notificationHash
+			h[0], h[1], h[2] = byte(i), byte(i>>8), byte(i>>16)
+			dedup.isDuplicate(h, time.Hour, now)
+		}
+
+		Expect(dedup.entries).To(HaveLen(maxDedupEntries))
+		Expect(dedup.seen).To(HaveLen(maxDedupEntries))
+	})
+})
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultDeliveryReportTimeout is how long a producer waits for the delivery
+// summary of a notification if it's not set in the config
+const defaultDeliveryReportTimeout = 3 * time.Second
+
+// defaultWebSocketWriteTimeout bounds writing a notification to a consumer
+// websocket if it's not set in the config
+const defaultWebSocketWriteTimeout = time.Second
+
+// deliveryReports passes delivery summaries of notifications pushed to this
+// EAA instance from the message broker subscriber to the waiting producers
+type deliveryReports struct {
+	sync.Mutex
+	m map[string]chan DeliverySummary
+}
+
+// expect registers a new delivery and returns its id and the channel
+// its summary is reported to
+func (d *deliveryReports) expect() (string, <-chan DeliverySummary) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.m == nil {
+		d.m = make(map[string]chan DeliverySummary)
+	}
+	id := uuid.New().String()
+	ch := make(chan DeliverySummary, 1)
+	d.m[id] = ch
+	return id, ch
+}
+
+// cancel stops waiting for the summary of the delivery
+func (d *deliveryReports) cancel(id string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.m, id)
+}
+
+// report passes the summary to the producer waiting for it. Deliveries
+// of other EAA instances are ignored.
+func (d *deliveryReports) report(id string, summary DeliverySummary) {
+	if id == "" {
+		return
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if ch, found := d.m[id]; found {
+		ch <- summary
+		delete(d.m, id)
+	}
+}
+
+// wait returns the summary of the delivery, or a pending summary if it's
+// not reported within the timeout. A summary reported already is returned
+// even if the timeout is not positive.
+func (d *deliveryReports) wait(id string, ch <-chan DeliverySummary,
+	timeout time.Duration) DeliverySummary {
+
+	select {
+	case summary := <-ch:
+		return summary
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case summary := <-ch:
+		return summary
+	case <-timer.C:
+		d.cancel(id)
+		return DeliverySummary{Pending: true}
+	}
+}
+
+// deliveryReportTimeout returns how long a producer waits for the delivery
+// summary of a notification
+func deliveryReportTimeout(eaaCtx *Context) time.Duration {
+	if timeout := eaaCtx.config().DeliveryReportTimeout.Duration; timeout > 0 {
+		return timeout
+	}
+	return defaultDeliveryReportTimeout
+}
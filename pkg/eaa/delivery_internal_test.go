@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// failingNotificationConn is a consumer connection whose writes fail
+type failingNotificationConn struct {
+	fakeNotificationConn
+}
+
+func (c *failingNotificationConn) WriteMessage(int, []byte) error {
+	return errors.New("write timeout")
+}
+
+var _ = g.Describe("Delivery summary", func() {
+	const producer = "ns:producer"
+
+	var (
+		eaaCtx *Context
+		okConn *fakeNotificationConn
+	)
+
+	pushWithHeader := func(header http.Header) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := newTLSRequest("POST", "/notifications",
+			`{"name":"n1","version":"1.0","payload":{}}`, producer, eaaCtx)
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		PushNotificationToSubscribers(rec, req)
+		return rec
+	}
+
+	push := func() (int, DeliverySummary) {
+		rec := pushWithHeader(nil)
+
+		var summary DeliverySummary
+		Expect(json.NewDecoder(rec.Body).Decode(&summary)).To(Succeed())
+		return rec.Code, summary
+	}
+
+	g.BeforeEach(func() {
+		okConn = &fakeNotificationConn{sent: make(chan []byte, 1)}
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = map[string]Service{producer: {}}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:ok":     {{connection: okConn}},
+			"ns:failed": {{connection: &failingNotificationConn{}}},
+		}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addNotificationSubscriber("ns", nil, eaaCtx)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("reports successful and failed writes to the producer", func() {
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}] = &ConsumerSubscription{
+			namespaceSubscriptions: SubscriberIds{"ns:ok", "ns:failed"},
+			serviceSubscriptions:   make(map[string]SubscriberIds),
+		}
+
+		code, summary := push()
+		Expect(code).To(Equal(http.StatusAccepted))
+		Expect(summary).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 1, Failed: 1}))
+	})
+
+	g.It("counts the deliveries of every subscription", func() {
+		eaaCtx.cfg.AdminCommonNames = []string{"admin"}
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}] = &ConsumerSubscription{
+			namespaceSubscriptions: SubscriberIds{"ns:ok", "ns:failed"},
+			serviceSubscriptions:   make(map[string]SubscriberIds),
+		}
+		push()
+		<-okConn.sent
+
+		getStats := func(commonName string) []SubscriptionStats {
+			rec := httptest.NewRecorder()
+			GetSubscriptionStats(rec, newTLSRequest("GET", "/subscriptions/stats", "",
+				commonName, eaaCtx))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			var list SubscriptionStatsList
+			Expect(json.NewDecoder(rec.Body).Decode(&list)).To(Succeed())
+			return list.Stats
+		}
+
+		notif := NotificationDescriptor{Name: "n1", Version: "1.0"}
+		Expect(getStats("ns:ok")).To(Equal([]SubscriptionStats{{Consumer: "ns:ok",
+			Namespace: "ns", Notification: notif, Matched: 1, Delivered: 1}}))
+		Expect(getStats("admin")).To(Equal([]SubscriptionStats{
+			{Consumer: "ns:failed", Namespace: "ns", Notification: notif, Matched: 1,
+				Dropped: 1},
+			{Consumer: "ns:ok", Namespace: "ns", Notification: notif, Matched: 1,
+				Delivered: 1},
+		}))
+	})
+
+	g.It("reports no subscribers without waiting", func() {
+		eaaCtx.cfg.DeliveryReportTimeout.Duration = time.Hour
+
+		code, summary := push()
+		Expect(code).To(Equal(http.StatusAccepted))
+		Expect(summary).To(Equal(DeliverySummary{}))
+	})
+
+	g.It("carries the correlation ID of the producer to the consumer", func() {
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}] = &ConsumerSubscription{
+			namespaceSubscriptions: SubscriberIds{"ns:ok"},
+			serviceSubscriptions:   make(map[string]SubscriberIds),
+		}
+
+		rec := pushWithHeader(http.Header{correlationIDHeader: {"trace-42"}})
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		Expect(rec.Header().Get(correlationIDHeader)).To(Equal("trace-42"))
+
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-okConn.sent, &notif)).To(Succeed())
+		Expect(notif.CorrelationID).To(Equal("trace-42"))
+	})
+
+	g.It("generates a correlation ID if the producer supplies no valid one", func() {
+		for _, header := range []http.Header{nil, {correlationIDHeader: {"bad id"}}} {
+			rec := pushWithHeader(header)
+			Expect(rec.Code).To(Equal(http.StatusAccepted))
+			id := rec.Header().Get(correlationIDHeader)
+			Expect(id).ToNot(BeEmpty())
+			Expect(id).ToNot(Equal("bad id"))
+		}
+	})
+
+	g.It("rejects a notification of an unknown priority", func() {
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n1","version":"1.0","priority":"urgent"}`, producer, eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonInvalidNotification))
+	})
+
+	g.It("reports a pending delivery after the timeout", func() {
+		var reports deliveryReports
+		id, ch := reports.expect()
+
+		Expect(reports.wait(id, ch, time.Millisecond)).To(
+			Equal(DeliverySummary{Pending: true}))
+		Expect(reports.m).ToNot(HaveKey(id))
+		reports.report(id, DeliverySummary{Subscribers: 1})
+	})
+})
+
+var _ = g.Describe("Bulk push", func() {
+	const producer = "ns:producer"
+
+	var (
+		eaaCtx *Context
+		sent   chan []byte
+	)
+
+	pushBulk := func(body string) (*httptest.ResponseRecorder, NotificationResultList) {
+		rec := httptest.NewRecorder()
+		req := newTLSRequest("POST", "/notifications/bulk", body, producer, eaaCtx)
+		req.Header.Set(correlationIDHeader, "batch")
+		PushNotificationsBulk(rec, req)
+
+		var results NotificationResultList
+		if rec.Code == http.StatusAccepted || rec.Code == http.StatusMultiStatus {
+			Expect(json.NewDecoder(rec.Body).Decode(&results)).To(Succeed())
+		}
+		return rec, results
+	}
+
+	received := func() []string {
+		var payloads []string
+		for len(sent) > 0 {
+			var notif NotificationToConsumer
+			Expect(json.Unmarshal(<-sent, &notif)).To(Succeed())
+			payloads = append(payloads, string(notif.Payload))
+		}
+		return payloads
+	}
+
+	g.BeforeEach(func() {
+		sent = make(chan []byte, 10)
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = map[string]Service{producer: {}}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: &fakeNotificationConn{sent: sent}}},
+		}
+		eaaCtx.subscriptionInfo.m = map[UniqueNotif]*ConsumerSubscription{
+			{"ns", "n1", "1.0"}: {
+				namespaceSubscriptions: SubscriberIds{"ns:consumer"},
+				serviceSubscriptions:   make(map[string]SubscriberIds),
+			},
+		}
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addNotificationSubscriber("ns", nil, eaaCtx)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("delivers the notifications in order with a summary of each", func() {
+		rec, results := pushBulk(`[
+			{"name":"n1","version":"1.0","payload":{"i":0}},
+			{"name":"n1","version":"1.0","payload":{"i":1}},
+			{"name":"n1","version":"1.0","payload":{"i":2}}]`)
+
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		Expect(rec.Header().Get(correlationIDHeader)).To(Equal("batch"))
+		Expect(results.Results).To(HaveLen(3))
+		for i, result := range results.Results {
+			Expect(result.Code).To(Equal(http.StatusAccepted))
+			Expect(result.CorrelationID).To(Equal("batch-" + strconv.Itoa(i)))
+			Expect(result.Summary).To(Equal(&DeliverySummary{Subscribers: 1, Delivered: 1}))
+		}
+		Expect(received()).To(Equal([]string{`{"i":0}`, `{"i":1}`, `{"i":2}`}))
+	})
+
+	g.It("reports the failed notifications without affecting the others", func() {
+		rec, results := pushBulk(`[
+			{"name":"n1","version":"1.0","payload":{"i":0}},
+			{"name":"n1","version":"1.0","priority":"urgent"},
+			{"name":"n1","version":"1.0","payload":{"i":2}}]`)
+
+		Expect(rec.Code).To(Equal(http.StatusMultiStatus))
+		Expect(results.Results[0].Code).To(Equal(http.StatusAccepted))
+		Expect(results.Results[1].Code).To(Equal(http.StatusBadRequest))
+		Expect(results.Results[1].Error).To(Equal(reasonInvalidNotification))
+		Expect(results.Results[1].Summary).To(BeNil())
+		Expect(results.Results[2].Code).To(Equal(http.StatusAccepted))
+		Expect(received()).To(Equal([]string{`{"i":0}`, `{"i":2}`}))
+	})
+
+	g.It("rate limits every notification", func() {
+		eaaCtx.cfg.NotificationRateLimit = 0.5
+		eaaCtx.cfg.NotificationBurst = 2
+		rec, results := pushBulk(`[{"name":"n1","version":"1.0"},
+			{"name":"n1","version":"1.0"}, {"name":"n1","version":"1.0"}]`)
+
+		Expect(rec.Code).To(Equal(http.StatusMultiStatus))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("2"))
+		Expect(results.Results[2].Code).To(Equal(http.StatusTooManyRequests))
+		Expect(results.Results[2].Error).To(Equal(reasonRateLimitExceeded))
+	})
+
+	g.It("applies the body size limit to the whole batch", func() {
+		notif := `{"name":"n1","version":"1.0","payload":{"i":0}}`
+		eaaCtx.cfg.MaxRequestBodySize = int64(3 * len(notif))
+		rec, _ := pushBulk("[" + strings.Repeat(notif+",", 3) + notif + "]")
+
+		Expect(rec.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(received()).To(BeEmpty())
+	})
+
+	g.It("rejects too many notifications", func() {
+		notif := `{"name":"n1","version":"1.0"}`
+		rec, _ := pushBulk("[" + strings.Repeat(notif+",", maxBulkNotifications) + notif + "]")
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(received()).To(BeEmpty())
+	})
+
+	g.It("rejects an unregistered producer", func() {
+		delete(eaaCtx.serviceInfo.m, producer)
+		rec, _ := pushBulk(`[{"name":"n1","version":"1.0"}]`)
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonProducerNotRegistered))
+	})
+})
@@ -0,0 +1,454 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// A subscription of at-least-once QoS has every notification delivered for
+// it redelivered until the consumer acknowledges it by a NotificationAck
+// with its sequence number over the websocket, e.g. {"ack":17}. A write
+// failing, or an ack not arriving within NotificationAckTimeout, leads to
+// a redelivery with the same sequence number, also over a connection opened
+// later, so consumers have to expect duplicates. The notifications awaiting
+// an ack are bounded by NotificationMaxUnacked per consumer, the oldest is
+// given up on once a new one doesn't fit. Acks of unknown sequence numbers
+// are ignored. Consumers with a webhook get at-least-once notifications
+// delivered once, the webhook retries a failed delivery on its own, and so
+// do consumers connected only by event streams or gRPC streams, which can't
+// carry an ack.
+//
+// With NotificationAckRequired the consumers acknowledge every notification
+// written to their websocket the same way. The ones of at-most-once
+// subscriptions await the ack without being redelivered, the unacked ones
+// are given up on the same way. The number of notifications awaiting
+// the ack of every consumer, its acks and their average latency are listed
+// by the connected clients. A consumer whose unacked notifications reach
+// NotificationAckBacklogLimit is flagged, or disconnected with the
+// ack_backlog reason, once until it catches up.
+
+const (
+	// defaultNotificationAckTimeout is how long an at-least-once
+	// notification waits for the ack if it's not set in the config
+	defaultNotificationAckTimeout = 5 * time.Second
+	// defaultNotificationMaxUnacked bounds the notifications awaiting
+	// the ack of a consumer if it's not set in the config
+	defaultNotificationMaxUnacked = 100
+	// notificationAckCheckInterval is how often the notifications awaiting
+	// an ack are checked for a redelivery
+	notificationAckCheckInterval = time.Second
+	// maxNotificationAckSize bounds the message read as an ack, the rest
+	// of a longer message is discarded
+	maxNotificationAckSize = 256
+)
+
+// Policies applied to a consumer whose unacked notifications reach
+// NotificationAckBacklogLimit
+const (
+	ackBacklogPolicyFlag       = "flag"
+	ackBacklogPolicyDisconnect = "disconnect"
+)
+
+// validateNotificationQoS checks if the delivery guarantee of a subscription
+// is one of the known ones or empty
+func validateNotificationQoS(qos NotificationQoS) error {
+	switch qos {
+	case "", NotificationQoSAtMostOnce, NotificationQoSAtLeastOnce:
+		return nil
+	}
+	return fmt.Errorf("unknown qos %.32q", qos)
+}
+
+// unackedNotification is an at-least-once notification sent to a consumer
+// which didn't acknowledge it yet
+type unackedNotification struct {
+	replayEntry
+	priority NotificationPriority
+	// time the notification is redelivered unless acknowledged before
+	due time.Time
+	// time the notification was sent first, for the ack latency
+	sent time.Time
+	// trackOnly is set for a notification of an at-most-once subscription,
+	// which awaits the ack without being redelivered
+	trackOnly bool
+}
+
+// ackStats are the acks of a consumer
+type ackStats struct {
+	acked uint64
+	// total latency of the acks
+	latency time.Duration
+	// flagged is set once the unacked notifications of the consumer reach
+	// NotificationAckBacklogLimit, until it catches up
+	flagged bool
+}
+
+// unackedNotifications holds the notifications awaiting the ack of every
+// consumer, oldest first, and the acks of every consumer. The zero value is
+// ready to use.
+type unackedNotifications struct {
+	sync.Mutex
+	m     map[string][]unackedNotification
+	stats map[string]*ackStats
+}
+
+// add stores the notification sent to the consumer until it's acknowledged,
+// the oldest one is given up on and returned if more than max would be
+// stored
+func (u *unackedNotifications) add(subID string, n unackedNotification,
+	max int) (unackedNotification, bool) {
+
+	u.Lock()
+	defer u.Unlock()
+
+	if u.m == nil {
+		u.m = make(map[string][]unackedNotification)
+	}
+	pending := append(u.m[subID], n)
+	var (
+		dropped unackedNotification
+		full    bool
+	)
+	if len(pending) > max {
+		dropped, full = pending[0], true
+		pending = pending[1:]
+	}
+	u.m[subID] = pending
+	return dropped, full
+}
+
+// ack stops the redelivery of the notification of the sequence number to
+// the consumer and records the latency of the ack, false is returned if it
+// doesn't await an ack
+func (u *unackedNotifications) ack(subID string, seq uint64) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	pending := u.m[subID]
+	for i, n := range pending {
+		if n.seq == seq {
+			u.recordAck(subID, n.sent)
+			pending = append(pending[:i], pending[i+1:]...)
+			if len(pending) == 0 {
+				delete(u.m, subID)
+			} else {
+				u.m[subID] = pending
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// recordAck adds the ack of a notification sent at the time to the acks of
+// the consumer. Unacked notifications have to be locked by the caller.
+func (u *unackedNotifications) recordAck(subID string, sent time.Time) {
+	stats := u.statsOf(subID)
+	stats.acked++
+	if !sent.IsZero() {
+		latency := time.Since(sent)
+		stats.latency += latency
+		notificationAckLatency.Observe(latency.Seconds())
+	}
+}
+
+// statsOf returns the acks of the consumer, created if it has none yet.
+// Unacked notifications have to be locked by the caller.
+func (u *unackedNotifications) statsOf(subID string) *ackStats {
+	if u.stats == nil {
+		u.stats = make(map[string]*ackStats)
+	}
+	stats, found := u.stats[subID]
+	if !found {
+		stats = &ackStats{}
+		u.stats[subID] = stats
+	}
+	return stats
+}
+
+// due returns the notifications of every consumer due for a redelivery at
+// now and postpones their next redelivery by the timeout. The ones whose
+// deadline passed are given up on, the ones tracked only are never due.
+func (u *unackedNotifications) due(now time.Time,
+	timeout time.Duration) map[string][]unackedNotification {
+
+	u.Lock()
+	defer u.Unlock()
+
+	due := make(map[string][]unackedNotification)
+	for subID, pending := range u.m {
+		kept := pending[:0]
+		for _, n := range pending {
+			if isStale(n.deadline, now) {
+				notificationsDroppedStaleTotal.Inc()
+				continue
+			}
+			if !n.trackOnly && !now.Before(n.due) {
+				due[subID] = append(due[subID], n)
+				n.due = now.Add(timeout)
+			}
+			kept = append(kept, n)
+		}
+		if len(kept) == 0 {
+			delete(u.m, subID)
+		} else {
+			u.m[subID] = kept
+		}
+	}
+	return due
+}
+
+// count returns the number of notifications awaiting the ack of
+// the consumer
+func (u *unackedNotifications) count(subID string) int {
+	u.Lock()
+	defer u.Unlock()
+
+	return len(u.m[subID])
+}
+
+// remove drops the notifications awaiting the ack of the consumer and its
+// acks
+func (u *unackedNotifications) remove(subID string) {
+	u.Lock()
+	defer u.Unlock()
+
+	delete(u.m, subID)
+	delete(u.stats, subID)
+}
+
+// removeTracked drops the notifications awaiting the ack of the consumer
+// which aren't redelivered
+func (u *unackedNotifications) removeTracked(subID string) {
+	u.Lock()
+	defer u.Unlock()
+
+	pending := u.m[subID]
+	kept := pending[:0]
+	for _, n := range pending {
+		if !n.trackOnly {
+			kept = append(kept, n)
+		}
+	}
+	if len(kept) == 0 {
+		delete(u.m, subID)
+	} else {
+		u.m[subID] = kept
+	}
+}
+
+// setFlagged flags the consumer exceeding the ack backlog limit or clears
+// the flag, true is returned if the flag was changed
+func (u *unackedNotifications) setFlagged(subID string, flagged bool) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	if !flagged && u.stats[subID] == nil {
+		return false
+	}
+	stats := u.statsOf(subID)
+	if stats.flagged == flagged {
+		return false
+	}
+	stats.flagged = flagged
+	return true
+}
+
+// backlog describes the acks of the consumer, nil if it has neither
+// acknowledged a notification nor has one awaiting the ack
+func (u *unackedNotifications) backlog(subID string) *ConsumerAckBacklog {
+	u.Lock()
+	defer u.Unlock()
+
+	stats := u.stats[subID]
+	if stats == nil && len(u.m[subID]) == 0 {
+		return nil
+	}
+	backlog := &ConsumerAckBacklog{Unacked: len(u.m[subID])}
+	if stats != nil {
+		backlog.Acked = stats.acked
+		backlog.Exceeded = stats.flagged
+		if stats.acked > 0 {
+			backlog.AverageLatency = float64(stats.latency/time.Duration(stats.acked)) /
+				float64(time.Millisecond)
+		}
+	}
+	return backlog
+}
+
+// notificationAckTimeout returns how long an at-least-once notification
+// waits for the ack before it's redelivered
+func notificationAckTimeout(eaaCtx *Context) time.Duration {
+	if timeout := eaaCtx.config().NotificationAckTimeout.Duration; timeout > 0 {
+		return timeout
+	}
+	return defaultNotificationAckTimeout
+}
+
+// expectNotificationAck keeps the notification about to be sent to
+// the consumer until the consumer acknowledges it, for a redelivery unless
+// it's tracked only. Nothing is kept for a consumer which can't send acks.
+func expectNotificationAck(subID string, e replayEntry, priority NotificationPriority,
+	trackOnly bool, eaaCtx *Context) {
+
+	if _, ok := eaaCtx.webhooks.get(subID); ok || !consumerSendsAcks(subID, eaaCtx) {
+		return
+	}
+	max := eaaCtx.config().NotificationMaxUnacked
+	if max <= 0 {
+		max = defaultNotificationMaxUnacked
+	}
+
+	now := time.Now()
+	n := unackedNotification{replayEntry: e, priority: priority,
+		due: now.Add(notificationAckTimeout(eaaCtx)), sent: now, trackOnly: trackOnly}
+	if dropped, full := eaaCtx.unackedNotifs.add(subID, n, max); full && !dropped.trackOnly {
+		notificationsUnackedDroppedTotal.Inc()
+		log.Warningf("Gave up on notification %d to Subscriber ID: %s: %d notifications "+
+			"await the ack", dropped.seq, subID, max)
+	}
+	applyAckBacklogPolicy(subID, eaaCtx)
+}
+
+// consumerSendsAcks checks if the consumer has a connection carrying acks.
+// A consumer without any connection is expected to open one, its
+// notifications await the ack to be redelivered over it.
+func consumerSendsAcks(subID string, eaaCtx *Context) bool {
+	eaaCtx.consumerConnections.RLock()
+	defer eaaCtx.consumerConnections.RUnlock()
+
+	consumerConns, found := eaaCtx.consumerConnections.m[subID]
+	if !found {
+		return true
+	}
+	for _, consumerConn := range consumerConns {
+		if consumerConn.acks {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAckBacklogPolicy flags the consumer whose unacked notifications
+// reach NotificationAckBacklogLimit, or disconnects it if the policy says
+// so. The policy isn't applied again until the consumer catches up.
+func applyAckBacklogPolicy(subID string, eaaCtx *Context) {
+	cfg := eaaCtx.config()
+	limit := cfg.NotificationAckBacklogLimit
+	if limit <= 0 || eaaCtx.unackedNotifs.count(subID) < limit ||
+		!eaaCtx.unackedNotifs.setFlagged(subID, true) {
+		return
+	}
+
+	policy := cfg.NotificationAckBacklogPolicy
+	if policy == "" {
+		policy = ackBacklogPolicyFlag
+	}
+	ackBacklogExceededTotal.WithLabelValues(policy).Inc()
+	if policy != ackBacklogPolicyDisconnect {
+		log.Warningf("Subscriber ID: %s has %d notifications awaiting the ack", subID, limit)
+		return
+	}
+
+	log.Warningf("Disconnecting Subscriber ID: %s: %d notifications await the ack", subID,
+		limit)
+	// The notifications which aren't redelivered aren't awaited over
+	// a new connection
+	eaaCtx.unackedNotifs.removeTracked(subID)
+	clearAckBacklogFlag(subID, eaaCtx)
+	// The caller may hold the subscription info, the close frame is written
+	// without delaying the delivery
+	go closeConsumerConnection(subID, ackBacklogCloseReason, eaaCtx)
+}
+
+// clearAckBacklogFlag clears the flag of the consumer once its unacked
+// notifications are below NotificationAckBacklogLimit
+func clearAckBacklogFlag(subID string, eaaCtx *Context) {
+	limit := eaaCtx.config().NotificationAckBacklogLimit
+	if limit > 0 && eaaCtx.unackedNotifs.count(subID) >= limit {
+		return
+	}
+	if eaaCtx.unackedNotifs.setFlagged(subID, false) {
+		log.Infof("Subscriber ID: %s caught up with the acks", subID)
+	}
+}
+
+// redeliverUnackedNotifications writes the at-least-once notifications not
+// acknowledged in time to the consumers again, the ones the connection
+// filter of a consumer leaves out are skipped until it reconnects
+func redeliverUnackedNotifications(eaaCtx *Context, now time.Time) {
+	for subID, pending := range eaaCtx.unackedNotifs.due(now, notificationAckTimeout(eaaCtx)) {
+		for _, n := range pending {
+			if !connectionAccepts(subID, n.key, eaaCtx) {
+				continue
+			}
+			err := sendNotificationToSubscriber(subID, &n.key, n.payload, n.priority,
+				n.deadline, eaaCtx)
+			if err != nil {
+				log.Debugf("Couldn't redeliver notification %d to Subscriber ID: %s : %v",
+					n.seq, subID, err)
+				continue
+			}
+			notificationsRedeliveredTotal.Inc()
+		}
+	}
+}
+
+// runNotificationRedelivery redelivers the at-least-once notifications not
+// acknowledged in time until the parent context is done
+func runNotificationRedelivery(parentCtx context.Context, eaaCtx *Context) {
+	ticker := time.NewTicker(notificationAckCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			redeliverUnackedNotifications(eaaCtx, now)
+		case <-parentCtx.Done():
+			return
+		}
+	}
+}
+
+// handleConsumerMessage processes a message the consumer sent over its
+// websocket, which is an ack of a notification. Other messages are
+// discarded.
+func handleConsumerMessage(commonName string, messageType int, r io.Reader,
+	eaaCtx *Context) {
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxNotificationAckSize))
+	if err != nil {
+		log.Debugf("Failed to read a message of %s: %v", commonName, err)
+		return
+	}
+
+	var ack NotificationAck
+	switch messageType {
+	case websocket.TextMessage:
+		err = json.Unmarshal(data, &ack)
+	case websocket.BinaryMessage:
+		err = msgpackCodec.unmarshal(data, &ack)
+	default:
+		return
+	}
+	if err != nil || ack.Ack == 0 {
+		log.Debugf("Discarded a message of %s which isn't an ack", commonName)
+		return
+	}
+	if !eaaCtx.unackedNotifs.ack(commonName, ack.Ack) {
+		log.Debugf("Ack of %s for notification %d which doesn't await one", commonName,
+			ack.Ack)
+		return
+	}
+	clearAckBacklogFlag(commonName, eaaCtx)
+}
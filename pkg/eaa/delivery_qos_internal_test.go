@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recoveringNotificationConn is a consumer connection failing the first
+// writes, the later ones are sent
+type recoveringNotificationConn struct {
+	fakeNotificationConn
+	failures int
+}
+
+func (c *recoveringNotificationConn) WriteMessage(messageType int, data []byte) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("write failed")
+	}
+	return c.fakeNotificationConn.WriteMessage(messageType, data)
+}
+
+var _ = g.Describe("unackedNotifications", func() {
+	var (
+		unacked unackedNotifications
+		now     time.Time
+	)
+
+	notification := func(seq uint64) unackedNotification {
+		return unackedNotification{replayEntry: replayEntry{seq: seq}, due: now}
+	}
+
+	g.BeforeEach(func() {
+		unacked = unackedNotifications{}
+		now = time.Now()
+	})
+
+	g.It("gives up on the oldest notification once the consumer has too many", func() {
+		for seq := uint64(1); seq <= 3; seq++ {
+			_, full := unacked.add("ns:consumer", notification(seq), 3)
+			Expect(full).To(BeFalse())
+		}
+
+		dropped, full := unacked.add("ns:consumer", notification(4), 3)
+		Expect(full).To(BeTrue())
+		Expect(dropped.seq).To(BeEquivalentTo(1))
+		Expect(unacked.count("ns:consumer")).To(Equal(3))
+	})
+
+	g.It("stops awaiting an acknowledged notification", func() {
+		unacked.add("ns:consumer", notification(1), 3)
+		unacked.add("ns:consumer", notification(2), 3)
+
+		Expect(unacked.ack("ns:consumer", 1)).To(BeTrue())
+		Expect(unacked.ack("ns:consumer", 1)).To(BeFalse())
+		Expect(unacked.ack("ns:other", 2)).To(BeFalse())
+		Expect(unacked.count("ns:consumer")).To(Equal(1))
+	})
+
+	g.It("postpones the redelivery of the due notifications by the timeout", func() {
+		unacked.add("ns:consumer", notification(1), 3)
+
+		Expect(unacked.due(now.Add(-time.Millisecond), time.Second)).To(BeEmpty())
+		Expect(unacked.due(now, time.Second)).To(HaveKeyWithValue("ns:consumer",
+			HaveLen(1)))
+		Expect(unacked.due(now.Add(time.Millisecond), time.Second)).To(BeEmpty())
+		Expect(unacked.due(now.Add(time.Second), time.Second)).To(HaveLen(1))
+	})
+
+	g.It("gives up on the notifications whose deadline passed", func() {
+		n := notification(1)
+		n.deadline = now
+		unacked.add("ns:consumer", n, 3)
+
+		Expect(unacked.due(now.Add(time.Second), time.Second)).To(BeEmpty())
+		Expect(unacked.count("ns:consumer")).To(BeZero())
+	})
+})
+
+var _ = g.Describe("At-least-once delivery", func() {
+	var (
+		conn   *recoveringNotificationConn
+		eaaCtx *Context
+	)
+
+	push := func(payload string) DeliverySummary {
+		summary, err := sendNotificationToAllSubscribers("ns:producer",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(payload)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		return summary
+	}
+
+	g.BeforeEach(func() {
+		conn = &recoveringNotificationConn{
+			fakeNotificationConn: fakeNotificationConn{sent: make(chan []byte, 2)},
+			failures:             1,
+		}
+		eaaCtx = newFanOutContext([]notificationConn{conn})
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setQoS("",
+			"ns:consumer0", NotificationQoSAtLeastOnce)
+	})
+
+	g.It("redelivers a notification whose write failed until it's acknowledged", func() {
+		Expect(push(`{"n":1}`)).To(Equal(DeliverySummary{Subscribers: 1, Failed: 1}))
+		Expect(eaaCtx.unackedNotifs.count("ns:consumer0")).To(Equal(1))
+
+		g.By("waiting for the ack timeout")
+		redeliverUnackedNotifications(eaaCtx, time.Now())
+		Expect(conn.sent).To(BeEmpty())
+
+		redeliverUnackedNotifications(eaaCtx,
+			time.Now().Add(defaultNotificationAckTimeout))
+		Expect(conn.sent).To(HaveLen(1))
+		var redelivered NotificationToConsumer
+		Expect(json.Unmarshal(<-conn.sent, &redelivered)).To(Succeed())
+		Expect(string(redelivered.Payload)).To(Equal(`{"n":1}`))
+
+		g.By("acknowledging the notification")
+		ack := `{"ack":` + strconv.FormatUint(redelivered.Sequence, 10) + `}`
+		handleConsumerMessage("ns:consumer0", websocket.TextMessage, strings.NewReader(ack),
+			eaaCtx)
+		Expect(eaaCtx.unackedNotifs.count("ns:consumer0")).To(BeZero())
+		redeliverUnackedNotifications(eaaCtx,
+			time.Now().Add(2*defaultNotificationAckTimeout))
+		Expect(conn.sent).To(BeEmpty())
+	})
+
+	g.It("delivers the notifications of at-most-once subscriptions once", func() {
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setQoS("",
+			"ns:consumer0", NotificationQoSAtMostOnce)
+
+		Expect(push(`{"n":1}`)).To(Equal(DeliverySummary{Subscribers: 1, Failed: 1}))
+		Expect(eaaCtx.unackedNotifs.count("ns:consumer0")).To(BeZero())
+	})
+
+	g.It("discards consumer messages which aren't acks", func() {
+		Expect(push(`{"n":1}`).Failed).To(Equal(1))
+
+		for _, msg := range []string{`{"ack":0}`, `{"ack":"1"}`, `ack`} {
+			handleConsumerMessage("ns:consumer0", websocket.TextMessage,
+				strings.NewReader(msg), eaaCtx)
+		}
+		Expect(eaaCtx.unackedNotifs.count("ns:consumer0")).To(Equal(1))
+	})
+
+	g.It("rejects an unknown qos of a subscription", func() {
+		Expect(validateSubscriptionNotifications([]NotificationDescriptor{
+			{Name: "n1", Version: "1.0", QoS: "exactly-once"}})).ToNot(Succeed())
+		Expect(validateSubscriptionNotifications([]NotificationDescriptor{
+			{Name: "n1", Version: "1.0", QoS: NotificationQoSAtLeastOnce}})).To(Succeed())
+	})
+})
+
+var _ = g.Describe("Notification acks over the websocket", func() {
+	g.It("are read without the keepalive", func() {
+		eaaCtx := &Context{}
+		eaaCtx.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}}}}
+			_, _, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaCtx)))
+			Expect(err).ShouldNot(HaveOccurred())
+		}))
+		defer server.Close()
+		consumer := server.Listener.Addr().String()
+		eaaCtx.unackedNotifs.add(consumer,
+			unackedNotification{replayEntry: replayEntry{seq: 5}}, 1)
+
+		conn, _, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.WriteMessage(websocket.TextMessage, []byte(`{"ack":5}`))).To(Succeed())
+
+		Eventually(func() int {
+			return eaaCtx.unackedNotifs.count(consumer)
+		}).Should(BeZero())
+	})
+})
+
+var _ = g.Describe("Notification ack backlog", func() {
+	var (
+		sent   chan []byte
+		eaaCtx *Context
+	)
+
+	push := func(payload string) uint64 {
+		_, err := sendNotificationToAllSubscribers("ns:producer",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(payload)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-sent, &notif)).To(Succeed())
+		return notif.Sequence
+	}
+
+	ack := func(seq uint64) {
+		handleConsumerMessage("ns:consumer0", websocket.TextMessage,
+			strings.NewReader(`{"ack":`+strconv.FormatUint(seq, 10)+`}`), eaaCtx)
+	}
+
+	backlog := func() *ConsumerAckBacklog {
+		clients := getConnectedClients(eaaCtx)
+		Expect(clients).To(HaveLen(1))
+		return clients[0].AckBacklog
+	}
+
+	g.BeforeEach(func() {
+		sent = make(chan []byte, 4)
+		eaaCtx = newFanOutContext([]notificationConn{&fakeNotificationConn{sent: sent}})
+		eaaCtx.cfg.NotificationAckRequired = true
+	})
+
+	g.It("tracks the acks of at-most-once notifications without redelivering them", func() {
+		first := push(`{"n":1}`)
+		push(`{"n":2}`)
+		Expect(backlog()).To(Equal(&ConsumerAckBacklog{Unacked: 2}))
+
+		redeliverUnackedNotifications(eaaCtx,
+			time.Now().Add(2*defaultNotificationAckTimeout))
+		Expect(sent).To(BeEmpty())
+
+		ack(first)
+		Expect(backlog().Unacked).To(Equal(1))
+		Expect(backlog().Acked).To(BeEquivalentTo(1))
+		Expect(backlog().AverageLatency).To(BeNumerically(">", 0))
+	})
+
+	g.It("doesn't track the notifications of a consumer which can't send acks", func() {
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setQoS("",
+			"ns:consumer0", NotificationQoSAtLeastOnce)
+		eaaCtx.consumerConnections.m["ns:consumer0"][0].acks = false
+
+		push(`{"n":1}`)
+		Expect(backlog()).To(BeNil())
+		redeliverUnackedNotifications(eaaCtx,
+			time.Now().Add(2*defaultNotificationAckTimeout))
+		Expect(sent).To(BeEmpty())
+	})
+
+	g.It("tracks at-least-once notifications only unless required", func() {
+		eaaCtx.cfg.NotificationAckRequired = false
+		push(`{"n":1}`)
+		Expect(backlog()).To(BeNil())
+	})
+
+	g.It("flags the consumer reaching the limit until it catches up", func() {
+		eaaCtx.cfg.NotificationAckBacklogLimit = 2
+		first := push(`{"n":1}`)
+		Expect(backlog().Exceeded).To(BeFalse())
+		push(`{"n":2}`)
+		Expect(backlog().Exceeded).To(BeTrue())
+
+		ack(first)
+		Expect(backlog().Exceeded).To(BeFalse())
+		Expect(eaaCtx.consumerConnections.m).To(HaveKey("ns:consumer0"))
+	})
+
+	g.It("disconnects the consumer reaching the limit with the policy", func() {
+		eaaCtx.cfg.NotificationAckBacklogLimit = 1
+		eaaCtx.cfg.NotificationAckBacklogPolicy = ackBacklogPolicyDisconnect
+		push(`{"n":1}`)
+
+		Eventually(func() []ConnectedClient {
+			return getConnectedClients(eaaCtx)
+		}).Should(BeEmpty())
+		Expect(eaaCtx.unackedNotifs.count("ns:consumer0")).To(BeZero())
+	})
+
+	g.It("rejects an unknown ack backlog policy", func() {
+		Expect(validateConfig(&Config{NotificationAckBacklogPolicy: "drop"})).ToNot(Succeed())
+		Expect(validateConfig(&Config{
+			NotificationAckBacklogPolicy: ackBacklogPolicyDisconnect})).To(Succeed())
+	})
+})
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+)
+
+// Service discovery events are notifications EAA sends on behalf of
+// a reserved producer whenever a service registers or deregisters. Consumers
+// subscribe to them like to any other notification, e.g. with
+// POST /subscriptions/eaa-discovery and the body
+// [{"name":"service-discovery","version":"1.0"}]. The payload of the
+// notifications is a ServiceDiscoveryEvent.
+//
+// Services can't be registered in the discovery namespace, so producers
+// can't spoof the events.
+const (
+	discoveryNamespace           = "eaa-discovery"
+	discoveryProducerID          = "eaa"
+	discoveryNotificationName    = "service-discovery"
+	discoveryNotificationVersion = "1.0"
+)
+
+// sendDiscoveryEvent notifies the consumers connected to this EAA instance
+// about a service registration or deregistration. Every EAA instance
+// handles the service messages, so the event isn't published to
+// the Message Broker.
+func sendDiscoveryEvent(serviceURN URN, action string, eaaCtx *Context) {
+	payload, err := json.Marshal(ServiceDiscoveryEvent{URN: &serviceURN, Action: action})
+	if err != nil {
+		log.Errf("Failed to marshal the discovery event of %s: %s", serviceURN.String(),
+			err.Error())
+		return
+	}
+
+	notif := NotificationFromProducer{
+		Name:    discoveryNotificationName,
+		Version: discoveryNotificationVersion,
+		Payload: payload,
+	}
+	producer := URN{Namespace: discoveryNamespace, ID: discoveryProducerID}
+	if _, err = deliverNotification(producer, &notif, newCorrelationID(), eaaCtx); err != nil {
+		log.Errf("Failed to send the discovery event of %s: %s", serviceURN.String(),
+			err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Service discovery events", func() {
+	var (
+		eaaCtx *Context
+		conn   *fakeNotificationConn
+	)
+
+	producer := URN{Namespace: "ns", ID: "producer"}
+
+	handle := func(actions ...string) {
+		messages := make(chan *message.Message, len(actions))
+		for _, action := range actions {
+			data, err := json.Marshal(ServiceMessage{Action: action,
+				Svc: &Service{URN: &producer, EndpointURI: "https://1.2.3.4"}})
+			Expect(err).ToNot(HaveOccurred())
+			messages <- message.NewMessage(action, data)
+		}
+		close(messages)
+		handleServiceUpdates(messages, eaaCtx)
+	}
+
+	received := func() ServiceDiscoveryEvent {
+		var notif NotificationToConsumer
+		var event ServiceDiscoveryEvent
+		Expect(json.Unmarshal(<-conn.sent, &notif)).To(Succeed())
+		Expect(notif.URN).To(Equal(URN{Namespace: discoveryNamespace,
+			ID: discoveryProducerID}))
+		Expect(json.Unmarshal(notif.Payload, &event)).To(Succeed())
+		return event
+	}
+
+	g.BeforeEach(func() {
+		conn = &fakeNotificationConn{sent: make(chan []byte, 10)}
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo = services{m: make(map[string]Service),
+			renewed: make(map[string]time.Time)}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: conn}}}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		Expect(addSubscriptionToNamespace("ns:consumer", discoveryNamespace,
+			[]NotificationDescriptor{{Name: discoveryNotificationName,
+				Version: discoveryNotificationVersion}}, eaaCtx)).To(Succeed())
+	})
+
+	g.It("notifies subscribers about registrations and deregistrations", func() {
+		handle(serviceActionRegister, serviceActionRegister, serviceActionDeregister)
+
+		Expect(received()).To(Equal(ServiceDiscoveryEvent{URN: &producer,
+			Action: serviceActionRegister}))
+		Expect(received()).To(Equal(ServiceDiscoveryEvent{URN: &producer,
+			Action: serviceActionDeregister}))
+		Expect(conn.sent).To(BeEmpty())
+	})
+
+	g.It("reserves the discovery namespace", func() {
+		Expect(validateService(&Service{URN: &URN{Namespace: discoveryNamespace, ID: "p"},
+			EndpointURI: "https://1.2.3.4"})).ToNot(Succeed())
+	})
+})
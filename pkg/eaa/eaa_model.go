@@ -3,7 +3,10 @@
 
 package eaa
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // NotificationDescriptor describes a type used in EAA API
 type NotificationDescriptor struct {
@@ -13,9 +16,78 @@ type NotificationDescriptor struct {
 	Version string `json:"version,omitempty"`
 	// Human readable description of notification
 	Description string `json:"description,omitempty"`
+	// Optional attribute filter of a subscription. Only notifications with
+	// a payload containing all the attributes with equal values are delivered.
+	Filter map[string]string `json:"filter,omitempty"`
+	// Optional transform of a subscription reshaping the payloads of
+	// the notifications delivered for it
+	Transform *NotificationTransform `json:"transform,omitempty"`
+	// Optional matching of the name of a subscription: "prefix" matches
+	// the notifications whose name starts with Name, "glob" the ones whose
+	// name matches Name as a shell pattern, e.g. "temperature.*". Empty or
+	// "exact" matches the notification named Name only.
+	NameMatch string `json:"nameMatch,omitempty"`
+	// Optional delivery guarantee of a subscription, "at-most-once" or
+	// "at-least-once". Empty is at-most-once: a notification is written
+	// once. At-least-once notifications are redelivered until the consumer
+	// acknowledges them by a NotificationAck.
+	QoS NotificationQoS `json:"qos,omitempty"`
+	// Optional aggregation window of a subscription in milliseconds.
+	// The notifications accepted for it within the window are delivered
+	// at the end of the window as a single batch, a JSON array of them.
+	// 0 delivers every notification on its own.
+	AggregationWindow int `json:"aggregationWindow,omitempty"`
+}
+
+// NotificationTransform reshapes the payload of the notifications delivered
+// for a subscription, without affecting what other subscriptions receive.
+// Attributes are addressed by paths of names separated by '.', which reach
+// into nested objects, e.g. "location.lat". Select is applied first, then
+// Remove and Rename. Attributes missing from a payload are skipped and
+// payloads which aren't JSON objects are delivered unchanged.
+type NotificationTransform struct {
+	// Attributes kept in the payload, all of them if empty
+	Select []string `json:"select,omitempty"`
+	// Attributes stripped from the payload
+	Remove []string `json:"remove,omitempty"`
+	// New paths of the renamed attributes by their current paths
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+// NotificationQoS is the delivery guarantee of a subscription
+type NotificationQoS string
+
+// Delivery guarantees of subscriptions, a subscription without one is
+// at-most-once
+const (
+	NotificationQoSAtMostOnce  NotificationQoS = "at-most-once"
+	NotificationQoSAtLeastOnce NotificationQoS = "at-least-once"
+)
+
+// NotificationAck is sent by a consumer over its websocket to acknowledge
+// the notification of the sequence number, e.g. {"ack":17}. Consumers
+// negotiating MessagePack envelopes send it as a binary MessagePack message.
+type NotificationAck struct {
+	Ack uint64 `json:"ack"`
 }
 
-// NotificationFromProducer describes a type used in EAA API
+// NotificationPriority is the delivery priority of a notification
+type NotificationPriority string
+
+// Priorities of notifications, a notification without a priority is normal
+const (
+	NotificationPriorityLow    NotificationPriority = "low"
+	NotificationPriorityNormal NotificationPriority = "normal"
+	NotificationPriorityHigh   NotificationPriority = "high"
+)
+
+// NotificationFromProducer describes a type used in EAA API.
+//
+// The notifications of a producer are delivered to each consumer in the order
+// they were pushed, i.e. a notification is delivered after the ones whose
+// push returned before it was pushed. Notifications of a higher priority may
+// overtake queued ones of lower priorities. Dropped notifications, e.g.
+// the stale or duplicate ones, are skipped without affecting the order.
 type NotificationFromProducer struct {
 	// Name of notification
 	Name string `json:"name,omitempty"`
@@ -24,6 +96,45 @@ type NotificationFromProducer struct {
 	// The payload can be any JSON object with a name
 	// and version-specific schema.
 	Payload json.RawMessage `json:"payload,omitempty"`
+	// Priority of notification. Notifications queued for a consumer are
+	// delivered by priority, low priority ones are dropped first.
+	Priority NotificationPriority `json:"priority,omitempty"`
+	// Signature of the notification made by the producer, EAA relays it
+	// to the consumers unchanged
+	Signature *NotificationSignature `json:"signature,omitempty"`
+	// MaxAge of the notification in milliseconds since its push, a consumer
+	// it isn't written to by then doesn't get it. 0 delivers it regardless
+	// of its age.
+	MaxAge int `json:"maxAge,omitempty"`
+	// Deadline the notification has to be written to consumers by, EAA
+	// moves it to the end of the MaxAge if that's earlier
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// receivedAt is the time the EAA instance the notification was pushed
+	// to received it, carried by the NotificationMessage
+	receivedAt time.Time
+}
+
+// NotificationSignature is a signature of the NotificationSigningInput of
+// a notification. EAA doesn't verify it, consumers verify it with the key
+// of the producer they obtained on their own.
+type NotificationSignature struct {
+	// Algorithm of the signature, e.g. "Ed25519" or "ES256"
+	Algorithm string `json:"alg"`
+	// KeyID identifies the key of the producer, if it has more of them
+	KeyID string `json:"kid,omitempty"`
+	// Value is the base64 encoded signature
+	Value string `json:"value"`
+}
+
+// NotificationSchema is a JSON Schema the payloads of a notification pushed
+// by the producers of a namespace have to conform to
+type NotificationSchema struct {
+	Namespace string `json:"namespace"`
+	// Notification name and version, the description and filter are ignored
+	Notification NotificationDescriptor `json:"notification"`
+	// Schema is a JSON Schema document, it's ignored by a deregistration
+	Schema json.RawMessage `json:"schema,omitempty"`
 }
 
 // NotificationToConsumer describes a type used in EAA API
@@ -37,12 +148,184 @@ type NotificationToConsumer struct {
 	Payload json.RawMessage `json:"payload,omitempty"`
 	// URN of the producer
 	URN URN `json:"producer,omitempty"`
+	// Monotonic sequence number of the notification
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Priority of notification, empty if normal
+	Priority NotificationPriority `json:"priority,omitempty"`
+	// CorrelationID identifies the notification in the EAA logs from its
+	// push to its delivery
+	CorrelationID string `json:"correlationId,omitempty"`
+	// Signature of the notification made by the producer, if any
+	Signature *NotificationSignature `json:"signature,omitempty"`
+	// Broadcast marks a system broadcast of an admin, delivered to every
+	// connected consumer regardless of its subscriptions
+	Broadcast bool `json:"broadcast,omitempty"`
+	// ReceivedAt is the time EAA received the notification from
+	// the producer in UTC, later than the one of any notification pushed
+	// to the same EAA instance before
+	ReceivedAt *time.Time `json:"receivedAt,omitempty"`
+	// ProducerTimestamp is the timestamp of the producer from the payload
+	// field named by NotificationTimestampField in UTC, if it's configured
+	// and the field holds one
+	ProducerTimestamp *time.Time `json:"producerTimestamp,omitempty"`
+}
+
+// NotificationToConsumerV2 is the notification envelope of the eaa.v2
+// websocket subprotocol, keeping the metadata apart from the payload
+type NotificationToConsumerV2 struct {
+	Metadata NotificationMetadata `json:"metadata"`
+	// The payload can be any JSON object with a name
+	// and version-specific schema.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Signature of the notification made by the producer, if any
+	Signature *NotificationSignature `json:"signature,omitempty"`
+}
+
+// NotificationMetadata describes a notification of the eaa.v2 envelope
+type NotificationMetadata struct {
+	// Name of notification
+	Name string `json:"name"`
+	// Version of notification
+	Version string `json:"version"`
+	// URN of the producer
+	Producer URN `json:"producer"`
+	// Monotonic sequence number of the notification
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Priority of notification, empty if normal
+	Priority NotificationPriority `json:"priority,omitempty"`
+	// CorrelationID identifies the notification in the EAA logs
+	CorrelationID string `json:"correlationId,omitempty"`
+	// Broadcast marks a system broadcast of an admin
+	Broadcast bool `json:"broadcast,omitempty"`
+	// ReceivedAt is the time EAA received the notification in UTC
+	ReceivedAt *time.Time `json:"receivedAt,omitempty"`
+	// ProducerTimestamp is the timestamp of the producer in UTC
+	ProducerTimestamp *time.Time `json:"producerTimestamp,omitempty"`
 }
 
 // NotificationMessage is a message sent/received by a message broker
 type NotificationMessage struct {
 	Notification *NotificationFromProducer
 	URN          *URN
+	// DeliveryID identifies the delivery summary awaited by the producer,
+	// empty if no summary is awaited
+	DeliveryID string
+	// ReceivedAt is the time the EAA instance the notification was pushed
+	// to received it, zero if the instance doesn't stamp notifications
+	ReceivedAt time.Time
+}
+
+// DeliverySummary describes the delivery of a notification to the consumers
+// connected to the EAA instance the producer pushed it to
+type DeliverySummary struct {
+	// Number of subscribers accepting the notification
+	Subscribers int `json:"subscribers"`
+	// Number of subscribers the notification was written to
+	Delivered int `json:"delivered"`
+	// Number of subscribers the notification couldn't be written to
+	Failed int `json:"failed"`
+	// Number of subscribers the notification was buffered for by
+	// the aggregation window of their subscription
+	Aggregated int `json:"aggregated,omitempty"`
+	// Pending is set if the delivery didn't finish in time
+	Pending bool `json:"pending,omitempty"`
+}
+
+// DeadLetter is a notification EAA couldn't deliver to any subscriber,
+// captured by the dead-letter sink
+type DeadLetter struct {
+	// Time the notification was captured
+	Timestamp time.Time `json:"timestamp"`
+	// Reason the notification is undeliverable, "no_subscribers" or
+	// "delivery_failed"
+	Reason        string `json:"reason"`
+	URN           URN    `json:"urn"`
+	CorrelationID string `json:"correlationId,omitempty"`
+	// Number of subscribers accepting the notification
+	Subscribers int `json:"subscribers"`
+	// Number of subscribers the notification couldn't be written to
+	Failed       int                      `json:"failed"`
+	Notification NotificationFromProducer `json:"notification"`
+}
+
+// ConnectedClient describes a consumer with an active WebSocket connection
+type ConnectedClient struct {
+	CommonName string `json:"common_name"`
+	// Number of notifications the consumer is subscribed to
+	Subscriptions int `json:"subscriptions"`
+	// Age of the oldest connection in seconds
+	ConnectionAge int64 `json:"connection_age"`
+	// Number of the connections of the consumer
+	Connections int `json:"connections"`
+	// Acks of the consumer, nil if it never had a notification awaiting
+	// the ack
+	AckBacklog *ConsumerAckBacklog `json:"ack_backlog,omitempty"`
+}
+
+// ConsumerAckBacklog describes the notifications awaiting the ack of
+// a consumer and the ones it acknowledged
+type ConsumerAckBacklog struct {
+	// Number of notifications awaiting the ack
+	Unacked int `json:"unacked"`
+	// Number of notifications acknowledged
+	Acked uint64 `json:"acked"`
+	// Average latency of the acks in milliseconds
+	AverageLatency float64 `json:"average_latency_ms"`
+	// Exceeded is set once the unacked notifications reach
+	// NotificationAckBacklogLimit, until the consumer catches up
+	Exceeded bool `json:"exceeded,omitempty"`
+}
+
+// DisconnectionResult is the response to a consumer disconnected by an admin
+type DisconnectionResult struct {
+	CommonName string `json:"common_name"`
+	// Number of websocket connections closed
+	Closed int `json:"closed"`
+	// SubscriptionsRemoved is set if the consumer was unsubscribed from
+	// all notifications
+	SubscriptionsRemoved bool `json:"subscriptions_removed,omitempty"`
+}
+
+// NotificationMatchQuery is a hypothetical notification matched against
+// the subscriptions without being delivered
+type NotificationMatchQuery struct {
+	// URN of the producer
+	URN URN `json:"producer"`
+	// Name of notification
+	Name string `json:"name"`
+	// Version of notification
+	Version string `json:"version"`
+	// Top level attributes of the payload matched by the attribute filters
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// NotificationMatch lists the consumers of this EAA instance a notification
+// would be delivered to
+type NotificationMatch struct {
+	// Consumers whose subscriptions accept the notification
+	Matched []string `json:"matched"`
+	// Consumers subscribed to the notification whose attribute filters
+	// reject it
+	FilteredOut []string `json:"filtered_out"`
+}
+
+// ConfigReload is the response to a reload of the EAA config
+type ConfigReload struct {
+	// RestartRequired are the changed config fields applied at startup only,
+	// they keep their values until EAA is restarted
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// NamespaceSummary is a namespace with services registered in it
+type NamespaceSummary struct {
+	Namespace string `json:"namespace"`
+	// Number of services registered in the namespace
+	Services int `json:"services"`
+}
+
+// NamespaceList JSON struct
+type NamespaceList struct {
+	Namespaces []NamespaceSummary `json:"namespaces"`
 }
 
 // ServiceList JSON struct
@@ -58,20 +341,127 @@ type Service struct {
 	Status        string                   `json:"status,omitempty"`
 	Notifications []NotificationDescriptor `json:"notifications,omitempty"`
 	Info          json.RawMessage          `json:"info,omitempty"`
+	// Labels are key/value pairs consumers can select services by
+	Labels map[string]string `json:"labels,omitempty"`
+	// Endpoints are further endpoints of the service with their health
+	// status. EndpointURI may be left empty if they are set.
+	Endpoints []ServiceEndpoint `json:"endpoints,omitempty"`
+	// Time to live in seconds. The service is deregistered if it is not
+	// renewed within this period. 0 means the EAA default TTL is used.
+	TTL uint32 `json:"ttl,omitempty"`
+}
+
+// EndpointHealth is the health status of a service endpoint
+type EndpointHealth string
+
+// EndpointHealth values, an endpoint registered without a health status
+// is healthy
+const (
+	EndpointHealthy   EndpointHealth = "healthy"
+	EndpointUnhealthy EndpointHealth = "unhealthy"
+)
+
+// ServiceEndpoint is an endpoint of a service and its health status
+type ServiceEndpoint struct {
+	URI    string         `json:"uri"`
+	Health EndpointHealth `json:"health"`
+}
+
+// EndpointHealthUpdate is the optional body of a renewal changing
+// the health status of the endpoints of the registered service
+type EndpointHealthUpdate struct {
+	Endpoints []ServiceEndpoint `json:"endpoints"`
+}
+
+// ServiceUpdate changes fields of the registered service of a producer,
+// the fields left out are unchanged
+type ServiceUpdate struct {
+	Description *string `json:"description,omitempty"`
+	EndpointURI *string `json:"endpoint_uri,omitempty"`
+	// Endpoints replace the endpoints of the service, an empty list
+	// removes them
+	Endpoints *[]ServiceEndpoint `json:"endpoints,omitempty"`
+	// Labels are merged into the labels of the service, a null value
+	// removes the label
+	Labels map[string]*string `json:"labels,omitempty"`
+	// Info replaces the info of the service
+	Info json.RawMessage `json:"info,omitempty"`
+}
+
+// ServiceSubscribers lists the consumers subscribed to notifications of
+// a service
+type ServiceSubscribers struct {
+	URN *URN `json:"urn"`
+	// Subscribers are the CommonNames of the consumers subscribed to any
+	// notification of the service
+	Subscribers []string `json:"subscribers"`
 }
 
 // ServiceMessage is a message sent/received by a message broker
 type ServiceMessage struct {
 	Svc    *Service `json:"service"`
 	Action string   `json:"action"`
+	// Update is merged into the registered service by an update action,
+	// whose Svc has the URN only. An update without it replaces the service.
+	Update *ServiceUpdate `json:"update,omitempty"`
+	// SelfTestID identifies the startup self-test of a self-test action,
+	// whose Svc is nil
+	SelfTestID string `json:"selfTestId,omitempty"`
+	// Owner is the fingerprint of the certificate the action was requested
+	// with, the owner of the service for a deregistration of an expired one
+	Owner string `json:"owner,omitempty"`
 }
 
 // ServiceMessage 'Action' values
 const (
 	serviceActionRegister   = "register"
+	serviceActionUpdate     = "update"
 	serviceActionDeregister = "deregister"
+	serviceActionSelfTest   = "self-test"
 )
 
+// RegistrationDryRun is the response to a registration validated with
+// the dryRun query parameter, which leaves the registered services unchanged
+type RegistrationDryRun struct {
+	// DryRun is always true, so the response isn't mistaken for
+	// a registration
+	DryRun bool `json:"dryRun"`
+	URN    *URN `json:"urn"`
+	// Action is "register" or "update", or empty if the service is already
+	// registered with identical content
+	Action string `json:"action,omitempty"`
+}
+
+// ServiceDiscoveryEvent is the payload of the notifications sent to
+// consumers subscribed to the discovery namespace when a service registers
+// or deregisters
+type ServiceDiscoveryEvent struct {
+	URN *URN `json:"urn"`
+	// Action is either "register" or "deregister"
+	Action string `json:"action"`
+}
+
+// ServiceSnapshot is the payload of the notification sent as the first
+// frame to a consumer connecting with a service snapshot requested
+type ServiceSnapshot struct {
+	// Services producing any of the notifications the consumer is
+	// subscribed to, sorted by URN
+	Services []Service `json:"services"`
+}
+
+// VersionMismatchNotice is the payload of the notifications telling
+// a consumer that a producer pushed a notification in a version other than
+// the ones the consumer is subscribed to
+type VersionMismatchNotice struct {
+	Producer URN `json:"producer"`
+	// Name and Version of the pushed notification
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// SubscribedVersions are the versions of the notification the consumer
+	// is subscribed to
+	SubscribedVersions []string `json:"subscribedVersions"`
+}
+
 // SubscriptionList JSON struct
 type SubscriptionList struct {
 	Subscriptions []Subscription `json:"subscriptions,omitempty"`
@@ -88,6 +478,26 @@ type Subscription struct {
 	// The list of all notification types registered by all producers in
 	// this namespace.
 	Notifications []NotificationDescriptor `json:"notifications,omitempty"`
+
+	// Status of the notifications, in the order of Notifications. It's
+	// set only in the subscriptions returned by a verbose GetSubscriptions.
+	Status []SubscriptionStatus `json:"status,omitempty"`
+}
+
+// SubscriptionStatus describes the state of a subscription to
+// a notification
+type SubscriptionStatus struct {
+	// CreatedAt is the time the subscription was created, or the EAA
+	// instance learned about it on startup
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is the time the lease of the consumer subscriptions ends
+	// unless renewed, unset if they don't expire
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Matching is set if a registered service produces the notification
+	Matching bool `json:"matching"`
+	// Number of the notifications written to the consumer websocket
+	// by this EAA instance, counted per namespace and not per service
+	Delivered uint64 `json:"delivered"`
 }
 
 // SubscriptionMessage is a message sent/received by a message broker
@@ -96,12 +506,20 @@ type SubscriptionMessage struct {
 	Subscription     *Subscription
 	Action           string
 	Scope            string
+	// Lease of the subscriptions in seconds set by a subscribe action,
+	// 0 applies DefaultSubscriptionLease
+	Lease int `json:",omitempty"`
 }
 
 // SubscriptionMessage 'Action' values
 const (
 	subscriptionActionSubscribe   = "subscribe"
 	subscriptionActionUnsubscribe = "unsubscribe"
+	// renews the leases of all the subscriptions of the consumer
+	subscriptionActionRenew = "renew"
+	// removes the subscriptions of the consumer to the namespace or
+	// the service whose lease expired
+	subscriptionActionExpire = "expire"
 )
 
 // SubscriptionMessage 'Scope' values
@@ -111,6 +529,145 @@ const (
 	subscriptionScopeAll       = "all"
 )
 
+// SubscriptionMatch is a subscription of a consumer annotated with
+// the registered producers matching it
+type SubscriptionMatch struct {
+	Subscription
+	// URNs of the registered producers of any of the notifications
+	Producers []URN `json:"producers"`
+}
+
+// SubscriptionMatchList JSON struct
+type SubscriptionMatchList struct {
+	Subscriptions []SubscriptionMatch `json:"subscriptions"`
+}
+
+// SubscriptionStats are the delivery counters of a notification a consumer
+// is subscribed to. The counters are monotonic since the EAA start and
+// aren't reset when the consumer unsubscribes.
+type SubscriptionStats struct {
+	Consumer     string                 `json:"consumer"`
+	Namespace    string                 `json:"namespace"`
+	Notification NotificationDescriptor `json:"notification"`
+	// Number of notifications the consumer is subscribed to
+	Matched uint64 `json:"matched"`
+	// Number of matched notifications rejected by the attribute filters
+	Filtered uint64 `json:"filtered"`
+	// Number of notifications written to the consumer websocket
+	Delivered uint64 `json:"delivered"`
+	// Number of notifications whose write failed or was rejected by
+	// the send queue
+	Dropped uint64 `json:"dropped"`
+}
+
+// SubscriptionStatsList JSON struct
+type SubscriptionStatsList struct {
+	Stats []SubscriptionStats `json:"stats"`
+}
+
+// SubscriptionResult describes the outcome of a single subscription
+// of a bulk subscription request
+type SubscriptionResult struct {
+	URN *URN `json:"urn,omitempty"`
+	// HTTP status code the subscription would get if requested alone
+	Code int `json:"code"`
+	// Machine readable reason of a failure
+	Error string `json:"error,omitempty"`
+	// Human readable details of a failure
+	Detail string `json:"detail,omitempty"`
+}
+
+// ConsumerSubscriptions holds the subscriptions of a consumer
+type ConsumerSubscriptions struct {
+	CommonName    string         `json:"commonName"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// SubscriptionExport holds the subscriptions of all consumers, as exported
+// for a migration to another EAA. It's the body of an import as well.
+type SubscriptionExport struct {
+	Consumers []ConsumerSubscriptions `json:"consumers"`
+}
+
+// SubscriptionImportFailure describes a subscription of a consumer which
+// couldn't be imported
+type SubscriptionImportFailure struct {
+	CommonName string `json:"commonName"`
+	SubscriptionResult
+}
+
+// SubscriptionImportResult describes the outcome of a subscription import.
+// Every notification of a subscription is counted separately.
+type SubscriptionImportResult struct {
+	// Number of notifications the consumers were subscribed to
+	Added int `json:"added"`
+	// Number of notifications the consumers were already subscribed to
+	Skipped int `json:"skipped"`
+	// Subscriptions which weren't imported
+	Failed []SubscriptionImportFailure `json:"failed"`
+}
+
+// UnsubscriptionResult describes which notifications of an unsubscription
+// request were removed and which the consumer wasn't subscribed to
+type UnsubscriptionResult struct {
+	URN      *URN                     `json:"urn"`
+	Removed  []NotificationDescriptor `json:"removed"`
+	NotFound []NotificationDescriptor `json:"notFound"`
+}
+
+// SubscriptionResultList JSON struct
+type SubscriptionResultList struct {
+	Results []SubscriptionResult `json:"results"`
+}
+
+// SubscriptionChange is a change of the subscriptions of a consumer
+// previewed without applying it
+type SubscriptionChange struct {
+	// Subscriptions added, a URN without an ID subscribes to the namespace
+	Add []Subscription `json:"add,omitempty"`
+	// Subscriptions removed, a URN without an ID unsubscribes from
+	// the namespace
+	Remove []Subscription `json:"remove,omitempty"`
+}
+
+// NotificationResult describes the outcome of a single notification of
+// a bulk push request
+type NotificationResult struct {
+	// CorrelationID identifies the notification in the EAA logs
+	CorrelationID string `json:"correlationId"`
+	// HTTP status code the notification would get if pushed alone
+	Code int `json:"code"`
+	// Delivery summary of a pushed notification
+	Summary *DeliverySummary `json:"summary,omitempty"`
+	// Machine readable reason of a failure
+	Error string `json:"error,omitempty"`
+	// Human readable details of a failure
+	Detail string `json:"detail,omitempty"`
+}
+
+// NotificationResultList is returned by a bulk push request with
+// the results in the order of the pushed notifications
+type NotificationResultList struct {
+	Results []NotificationResult `json:"results"`
+}
+
+// ReadinessStatus is returned by the readiness probe
+type ReadinessStatus struct {
+	Ready bool `json:"ready"`
+	// Result of every sub-check, "ok" or the reason of the failure
+	Checks map[string]string `json:"checks"`
+}
+
+// ErrorResponse is returned in the body of a failed request
+type ErrorResponse struct {
+	// Machine readable reason of the failure
+	Error string `json:"error"`
+	// HTTP status code of the response
+	Code int `json:"code"`
+	// Human readable details of the failure
+	Detail string `json:"detail,omitempty"`
+}
+
 // URN describes a type used in EAA API
 type URN struct {
 
@@ -122,8 +679,3 @@ type URN struct {
 	// a trailing separator.
 	Namespace string `json:"namespace,omitempty"`
 }
-
-// Provides string representation of URN
-func (u *URN) String() string {
-	return u.Namespace + ":" + u.ID
-}
@@ -3,7 +3,10 @@
 
 package eaa
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // SubscriberIds stores subscriber ids as a slice of strings
 type SubscriberIds []string
@@ -16,6 +19,24 @@ type ConsumerSubscription struct {
 	// map of producer id to slice of subscriber ids
 	serviceSubscriptions map[string]SubscriberIds
 	notification         NotificationDescriptor
+
+	// attribute filters of the subscriptions which have one
+	filters map[subscriberKey]map[string]string
+	// payload transforms of the subscriptions which have one
+	transforms map[subscriberKey]*NotificationTransform
+	// delivery guarantees of the subscriptions which aren't at-most-once
+	qos map[subscriberKey]NotificationQoS
+	// aggregation windows of the subscriptions which have one
+	windows map[subscriberKey]time.Duration
+	// times the subscriptions were created on this EAA instance
+	created map[subscriberKey]time.Time
+}
+
+// subscriberKey identifies a subscription of a consumer within
+// a ConsumerSubscription. serviceID is empty for a namespace subscription.
+type subscriberKey struct {
+	serviceID string
+	subID     string
 }
 
 // UniqueNotif stores information about unique notification. It is used as
@@ -46,11 +67,167 @@ func (sI *SubscriberIds) RemoveSubscriber(commonName string) bool {
 	return isChanged
 }
 
+// setFilter sets the attribute filter of a consumer subscription,
+// an empty filter removes it
+func (cs *ConsumerSubscription) setFilter(serviceID string, subID string,
+	filter map[string]string) {
+	key := subscriberKey{serviceID: serviceID, subID: subID}
+
+	if len(filter) == 0 {
+		delete(cs.filters, key)
+		return
+	}
+	if cs.filters == nil {
+		cs.filters = make(map[subscriberKey]map[string]string)
+	}
+	cs.filters[key] = filter
+}
+
+// getFilter returns the attribute filter of a consumer subscription
+func (cs *ConsumerSubscription) getFilter(serviceID string,
+	subID string) map[string]string {
+	return cs.filters[subscriberKey{serviceID: serviceID, subID: subID}]
+}
+
+// setTransform sets the payload transform of a consumer subscription,
+// nil removes it
+func (cs *ConsumerSubscription) setTransform(serviceID string, subID string,
+	transform *NotificationTransform) {
+	key := subscriberKey{serviceID: serviceID, subID: subID}
+
+	if transform == nil {
+		delete(cs.transforms, key)
+		return
+	}
+	if cs.transforms == nil {
+		cs.transforms = make(map[subscriberKey]*NotificationTransform)
+	}
+	cs.transforms[key] = transform
+}
+
+// getTransform returns the payload transform of a consumer subscription
+func (cs *ConsumerSubscription) getTransform(serviceID string,
+	subID string) *NotificationTransform {
+	return cs.transforms[subscriberKey{serviceID: serviceID, subID: subID}]
+}
+
+// setQoS sets the delivery guarantee of a consumer subscription, empty or
+// at-most-once removes it
+func (cs *ConsumerSubscription) setQoS(serviceID string, subID string,
+	qos NotificationQoS) {
+	key := subscriberKey{serviceID: serviceID, subID: subID}
+
+	if qos == "" || qos == NotificationQoSAtMostOnce {
+		delete(cs.qos, key)
+		return
+	}
+	if cs.qos == nil {
+		cs.qos = make(map[subscriberKey]NotificationQoS)
+	}
+	cs.qos[key] = qos
+}
+
+// getQoS returns the delivery guarantee of a consumer subscription, empty
+// if it's at-most-once
+func (cs *ConsumerSubscription) getQoS(serviceID string,
+	subID string) NotificationQoS {
+	return cs.qos[subscriberKey{serviceID: serviceID, subID: subID}]
+}
+
+// setAggregationWindow sets the aggregation window of a consumer
+// subscription, 0 removes it
+func (cs *ConsumerSubscription) setAggregationWindow(serviceID string, subID string,
+	window time.Duration) {
+	key := subscriberKey{serviceID: serviceID, subID: subID}
+
+	if window <= 0 {
+		delete(cs.windows, key)
+		return
+	}
+	if cs.windows == nil {
+		cs.windows = make(map[subscriberKey]time.Duration)
+	}
+	cs.windows[key] = window
+}
+
+// getAggregationWindow returns the aggregation window of a consumer
+// subscription, 0 if it has none
+func (cs *ConsumerSubscription) getAggregationWindow(serviceID string,
+	subID string) time.Duration {
+	return cs.windows[subscriberKey{serviceID: serviceID, subID: subID}]
+}
+
+// removeFilters removes all attribute filters, transforms, delivery
+// guarantees, aggregation windows and creation times of a consumer
+func (cs *ConsumerSubscription) removeFilters(subID string) {
+	for key := range cs.filters {
+		if key.subID == subID {
+			delete(cs.filters, key)
+		}
+	}
+	for key := range cs.transforms {
+		if key.subID == subID {
+			delete(cs.transforms, key)
+		}
+	}
+	for key := range cs.qos {
+		if key.subID == subID {
+			delete(cs.qos, key)
+		}
+	}
+	for key := range cs.windows {
+		if key.subID == subID {
+			delete(cs.windows, key)
+		}
+	}
+	for key := range cs.created {
+		if key.subID == subID {
+			delete(cs.created, key)
+		}
+	}
+}
+
+// setCreated records the creation time of a consumer subscription,
+// unless it's already recorded
+func (cs *ConsumerSubscription) setCreated(serviceID string, subID string,
+	created time.Time) {
+	key := subscriberKey{serviceID: serviceID, subID: subID}
+
+	if cs.created == nil {
+		cs.created = make(map[subscriberKey]time.Time)
+	}
+	if _, ok := cs.created[key]; !ok {
+		cs.created[key] = created
+	}
+}
+
+// getCreated returns the creation time of a consumer subscription
+func (cs *ConsumerSubscription) getCreated(serviceID string, subID string) time.Time {
+	return cs.created[subscriberKey{serviceID: serviceID, subID: subID}]
+}
+
+// removeSubscriber removes the attribute filter, the transform, the delivery
+// guarantee, the aggregation window and the creation time of a consumer
+// subscription
+func (cs *ConsumerSubscription) removeSubscriber(serviceID string, subID string) {
+	cs.setFilter(serviceID, subID, nil)
+	cs.setTransform(serviceID, subID, nil)
+	cs.setQoS(serviceID, subID, "")
+	cs.setAggregationWindow(serviceID, subID, 0)
+	delete(cs.created, subscriberKey{serviceID: serviceID, subID: subID})
+}
+
 // initNamespaceNotification initializes structs for given
 // NamespaceNotif struct to allow for subscription
 func initNamespaceNotification(key UniqueNotif, notif NotificationDescriptor,
 	eaaCtx *Context) {
 	if _, ok := eaaCtx.subscriptionInfo.m[key]; !ok {
+		// Attribute filters, transforms, delivery guarantees and
+		// aggregation windows are kept per subscriber
+		notif.Filter = nil
+		notif.Transform = nil
+		notif.QoS = ""
+		notif.AggregationWindow = 0
 		conSub := &ConsumerSubscription{
 			namespaceSubscriptions: SubscriberIds{},
 			serviceSubscriptions:   map[string]SubscriberIds{},
@@ -76,14 +253,20 @@ func initServiceNotification(key UniqueNotif, serviceID string,
 // addNamespaceSubscriptionToList adds a namespace subscription
 // to a list of subscriptions
 func (sL *SubscriptionList) addNamespaceSubscriptionToList(
-	nameNotif UniqueNotif, eaaCtx *Context) {
+	nameNotif UniqueNotif, commonName string, eaaCtx *Context) {
 	found := false
+	notif := eaaCtx.subscriptionInfo.m[nameNotif].notification
+	notif.Filter = eaaCtx.subscriptionInfo.m[nameNotif].getFilter("", commonName)
+	notif.Transform = eaaCtx.subscriptionInfo.m[nameNotif].getTransform("", commonName)
+	notif.QoS = eaaCtx.subscriptionInfo.m[nameNotif].getQoS("", commonName)
+	notif.AggregationWindow = int(eaaCtx.subscriptionInfo.m[nameNotif].
+		getAggregationWindow("", commonName) / time.Millisecond)
 
 	for i, s := range sL.Subscriptions {
 		if s.URN.ID == "" && s.URN.Namespace == nameNotif.namespace {
 			sL.Subscriptions[i].Notifications = append(
 				sL.Subscriptions[i].Notifications,
-				eaaCtx.subscriptionInfo.m[nameNotif].notification)
+				notif)
 			found = true
 			break
 		}
@@ -96,7 +279,7 @@ func (sL *SubscriptionList) addNamespaceSubscriptionToList(
 					Namespace: nameNotif.namespace,
 				},
 				Notifications: []NotificationDescriptor{
-					eaaCtx.subscriptionInfo.m[nameNotif].notification,
+					notif,
 				},
 			})
 	}
@@ -105,15 +288,21 @@ func (sL *SubscriptionList) addNamespaceSubscriptionToList(
 // addServiceSubscriptionToList adds a service subscription
 // to a list of subscriptions
 func (sL *SubscriptionList) addServiceSubscriptionToList(
-	nameNotif UniqueNotif, srvID string, eaaCtx *Context) {
+	nameNotif UniqueNotif, srvID string, commonName string, eaaCtx *Context) {
 	found := false
+	notif := eaaCtx.subscriptionInfo.m[nameNotif].notification
+	notif.Filter = eaaCtx.subscriptionInfo.m[nameNotif].getFilter(srvID, commonName)
+	notif.Transform = eaaCtx.subscriptionInfo.m[nameNotif].getTransform(srvID, commonName)
+	notif.QoS = eaaCtx.subscriptionInfo.m[nameNotif].getQoS(srvID, commonName)
+	notif.AggregationWindow = int(eaaCtx.subscriptionInfo.m[nameNotif].
+		getAggregationWindow(srvID, commonName) / time.Millisecond)
 
 	for i, s := range sL.Subscriptions {
 		if s.URN.Namespace == nameNotif.namespace &&
 			s.URN.ID == srvID {
 			sL.Subscriptions[i].Notifications = append(
 				sL.Subscriptions[i].Notifications,
-				eaaCtx.subscriptionInfo.m[nameNotif].notification)
+				notif)
 			found = true
 			break
 		}
@@ -126,7 +315,7 @@ func (sL *SubscriptionList) addServiceSubscriptionToList(
 					Namespace: nameNotif.namespace,
 				},
 				Notifications: []NotificationDescriptor{
-					eaaCtx.subscriptionInfo.m[nameNotif].notification,
+					notif,
 				},
 			})
 	}
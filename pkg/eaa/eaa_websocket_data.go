@@ -4,13 +4,34 @@
 package eaa
 
 import (
-	"github.com/gorilla/websocket"
+	"time"
 )
 
+// notificationConn is a connection notifications are delivered through,
+// either a *websocket.Conn or a gRPC Notifications stream
+type notificationConn interface {
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	Close() error
+}
+
 // ConsumerConnection stores websocket connection of a consumer
 type ConsumerConnection struct {
 
 	// The details of the websocket connection between the agent and the
 	// consumer app.
-	connection *websocket.Conn
+	connection notificationConn
+
+	// The time when the websocket connection was established.
+	connectedAt time.Time
+
+	// The filter scoping the notifications delivered over the connection.
+	filter connectionFilter
+
+	// The expiry of the client certificate the connection was opened with.
+	certificateExpiry time.Time
+
+	// Whether the consumer acknowledges notifications over the connection,
+	// only websockets carry acks.
+	acks bool
 }
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaatest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// errBrokerClosed is returned by a Broker used after Close
+var errBrokerClosed = errors.New("broker is closed")
+
+// Broker is an in-memory Message Broker implementing eaa.PubSub.
+// Publish blocks until every channel subscribed to the topic acks its copy
+// of the message, so the effects of a request handled by EAA are visible
+// as soon as the request returns. Subscribers of tests must ack messages
+// too. Brokers are safe for concurrent use.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[string][]chan *message.Message
+	published   map[string][]*message.Message
+	closed      bool
+	// done is closed by Close, it stops the publishes in progress
+	done chan struct{}
+	// publishes in progress, the channels are closed once they return
+	publishes sync.WaitGroup
+}
+
+// NewBroker creates an empty Broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[string][]chan *message.Message),
+		published:   make(map[string][]*message.Message),
+		done:        make(chan struct{}),
+	}
+}
+
+// Publish delivers a copy of the message to every channel subscribed to
+// the topic and waits until they ack it. A message nacked by a subscriber
+// fails the publish.
+func (b *Broker) Publish(ctx context.Context, topic string, msg *message.Message) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errBrokerClosed
+	}
+	b.published[topic] = append(b.published[topic], msg.Copy())
+	subscribers := append([]chan *message.Message(nil), b.subscribers[topic]...)
+	b.publishes.Add(1)
+	b.mu.Unlock()
+	defer b.publishes.Done()
+
+	for _, ch := range subscribers {
+		delivered := msg.Copy()
+		delivered.SetContext(ctx)
+
+		select {
+		case ch <- delivered:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return errBrokerClosed
+		}
+
+		select {
+		case <-delivered.Acked():
+		case <-delivered.Nacked():
+			return errors.Errorf("message %s nacked by a subscriber of topic %s",
+				msg.UUID, topic)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return errBrokerClosed
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the messages published to the topic
+// from now on. The channel is closed by Close.
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, errBrokerClosed
+	}
+	ch := make(chan *message.Message)
+	b.subscribers[topic] = append(b.subscribers[topic], ch)
+	return ch, nil
+}
+
+// Ping fails once the Broker is closed
+func (b *Broker) Ping() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return errBrokerClosed
+	}
+	return nil
+}
+
+// Close stops the publishes in progress and closes the subscribed channels.
+// Closing a closed Broker is a no-op.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+
+	b.publishes.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, channels := range b.subscribers {
+		for _, ch := range channels {
+			close(ch)
+		}
+	}
+	b.subscribers = nil
+	return nil
+}
+
+// Published returns the messages published to the topic, in the order they
+// were published
+func (b *Broker) Published(topic string) []*message.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]*message.Message(nil), b.published[topic]...)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+// Package eaatest provides utilities for testing applications and handlers
+// built on EAA without a Kafka Message Broker or certificates: an in-memory
+// Broker, EAA contexts using it and requests of TLS clients of a given
+// CommonName.
+package eaatest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/open-ness/edgenode/pkg/eaa"
+	"github.com/pkg/errors"
+)
+
+// NewContext creates an EAA context of the config using a new in-memory
+// Broker and registers the services, as their producers would. The URNs of
+// the services have to be set. The context is closed by Close of the context.
+func NewContext(cfg eaa.Config, services ...eaa.Service) (*eaa.Context, *Broker, error) {
+	broker := NewBroker()
+	eaaCtx, err := eaa.NewContext(cfg, broker)
+	if err != nil {
+		_ = broker.Close()
+		return nil, nil, err
+	}
+
+	for _, serv := range services {
+		if err = RegisterService(eaaCtx, serv); err != nil {
+			_ = eaaCtx.Close()
+			return nil, nil, err
+		}
+	}
+	return eaaCtx, broker, nil
+}
+
+// RegisterService registers a service the way its producer would, by a POST
+// to /services with the URN of the service as the CommonName
+func RegisterService(eaaCtx *eaa.Context, serv eaa.Service) error {
+	if serv.URN == nil {
+		return errors.New("service URN is missing")
+	}
+	body, err := json.Marshal(serv)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal the service")
+	}
+
+	rec := Serve(eaaCtx, NewRequest(http.MethodPost, "/services", bytes.NewReader(body),
+		serv.URN.String()))
+	if rec.Code != http.StatusOK {
+		return errors.Errorf("registration of %s failed with %d: %s", serv.URN.String(),
+			rec.Code, rec.Body.String())
+	}
+	return nil
+}
+
+// NewRequest returns a request to EAA sent over TLS by a client whose
+// certificate has the CommonName, e.g. "namespace:id" of an application.
+// The certificate isn't verified by EAA handlers.
+func NewRequest(method, target string, body io.Reader, commonName string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: commonName}},
+		},
+	}
+	return r
+}
+
+// Serve handles the request by the EAA router of the context and returns
+// the recorded response
+func Serve(eaaCtx *eaa.Context, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	eaa.NewEaaRouter(eaaCtx).ServeHTTP(rec, r)
+	return rec
+}
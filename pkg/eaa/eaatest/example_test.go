@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaatest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/open-ness/edgenode/pkg/eaa"
+	"github.com/open-ness/edgenode/pkg/eaa/eaatest"
+)
+
+func Example() {
+	eaaCtx, _, err := eaatest.NewContext(eaa.Config{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer eaaCtx.Close()
+
+	// A producer registers its service
+	rec := eaatest.Serve(eaaCtx, eaatest.NewRequest(http.MethodPost, "/services",
+		strings.NewReader(`{"description":"Temperature sensor",
+			"endpoint_uri":"https://10.16.0.10:8080",
+			"notifications":[{"name":"temperature","version":"1.0"}]}`),
+		"sensors:thermometer"))
+	fmt.Println(rec.Code)
+
+	// and a consumer discovers it
+	rec = eaatest.Serve(eaaCtx, eaatest.NewRequest(http.MethodGet, "/services", nil,
+		"dashboards:display"))
+	var list eaa.ServiceList
+	if err = json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, serv := range list.Services {
+		fmt.Println(serv.URN.String(), serv.Description)
+	}
+
+	// Output:
+	// 200
+	// sensors:thermometer Temperature sensor
+}
+
+func ExampleNewContext() {
+	eaaCtx, broker, err := eaatest.NewContext(eaa.Config{}, eaa.Service{
+		URN:         &eaa.URN{Namespace: "sensors", ID: "thermometer"},
+		EndpointURI: "https://10.16.0.10:8080",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer eaaCtx.Close()
+
+	rec := eaatest.Serve(eaaCtx, eaatest.NewRequest(http.MethodGet, "/services", nil,
+		"dashboards:display"))
+	var list eaa.ServiceList
+	if err = json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, serv := range list.Services {
+		fmt.Println(serv.URN.String(), serv.EndpointURI)
+	}
+	fmt.Println(len(broker.Published("services")), "message published")
+
+	// Output:
+	// sensors:thermometer https://10.16.0.10:8080
+	// 1 message published
+}
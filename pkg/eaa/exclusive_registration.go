@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A registered service is owned by the certificate the producer registered
+// it with, identified by its SHA-256 fingerprint. With ExclusiveRegistration
+// a registration of the same URN with another certificate is rejected while
+// the service is live, i.e. registered and not expired, and the owner keeps
+// its registration. The owner re-registers, renews, updates and deregisters
+// its service as usual, the same requests with another certificate are
+// rejected by 409 Conflict too. Every service message carries the fingerprint
+// of the certificate it was requested with, so that each EAA instance checks
+// it as well. A producer whose certificate was replaced waits for the service
+// to expire. Services loaded from the service store have no owner until they
+// are registered again.
+
+// errRegistrationConflict is returned for a registration of a live service
+// owned by another certificate
+var errRegistrationConflict = errors.New("URN is registered with another certificate")
+
+// certificateFingerprint returns the SHA-256 fingerprint of a certificate
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkRegistrationOwner returns errRegistrationConflict if exclusive
+// registration is enabled and the live service of the CommonName is owned
+// by a certificate other than owner. Service info has to be locked by
+// the caller.
+func checkRegistrationOwner(commonName string, owner string, eaaCtx *Context) error {
+	if !eaaCtx.config().ExclusiveRegistration || owner == "" {
+		return nil
+	}
+
+	registeredOwner := eaaCtx.serviceInfo.owners[commonName]
+	serv, found := eaaCtx.serviceInfo.m[commonName]
+	if !found || registeredOwner == "" || registeredOwner == owner {
+		return nil
+	}
+	// An expired service not reaped yet is free to be registered
+	ttl := serviceTTL(serv, eaaCtx)
+	if ttl > 0 && time.Since(eaaCtx.serviceInfo.renewed[commonName]) > ttl {
+		return nil
+	}
+	return errors.Wrapf(errRegistrationConflict, "Service %s", commonName)
+}
+
+// setRegistrationOwner records the certificate the service of the CommonName
+// was registered with, an empty owner leaves it unchanged
+func setRegistrationOwner(commonName string, owner string, eaaCtx *Context) {
+	if owner == "" {
+		return
+	}
+
+	eaaCtx.serviceInfo.Lock()
+	defer eaaCtx.serviceInfo.Unlock()
+
+	if eaaCtx.serviceInfo.owners == nil {
+		eaaCtx.serviceInfo.owners = make(map[string]string)
+	}
+	eaaCtx.serviceInfo.owners[commonName] = owner
+}
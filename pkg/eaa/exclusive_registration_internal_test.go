@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Exclusive registration", func() {
+	var (
+		eaaCtx        *Context
+		otherEndpoint = "https://2.2.2.2"
+	)
+
+	register := func(endpoint string, cert string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest("POST", "/services", `{"endpoint_uri":"`+endpoint+`"}`,
+			"ns:producer", eaaCtx)
+		r.TLS.PeerCertificates[0].Raw = []byte(cert)
+		RegisterApplication(rec, r)
+		return rec
+	}
+
+	endpoint := func() string {
+		eaaCtx.serviceInfo.RLock()
+		defer eaaCtx.serviceInfo.RUnlock()
+		return eaaCtx.serviceInfo.m["ns:producer"].EndpointURI
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.cfg.ExclusiveRegistration = true
+		eaaCtx.serviceInfo = services{m: make(map[string]Service),
+			renewed: make(map[string]time.Time)}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addServicesPubSub(eaaCtx)).To(Succeed())
+
+		Expect(register("https://1.1.1.1", "cert-a").Code).To(Equal(http.StatusOK))
+		Eventually(endpoint).Should(Equal("https://1.1.1.1"))
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("rejects a producer with another certificate by 409", func() {
+		rec := register("https://2.2.2.2", "cert-b")
+
+		Expect(rec.Code).To(Equal(http.StatusConflict))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonDuplicateURN))
+		Consistently(endpoint, 100*time.Millisecond).Should(Equal("https://1.1.1.1"))
+	})
+
+	table.DescribeTable("rejects the requests of another certificate by 409",
+		func(handler http.HandlerFunc, method string, body string) {
+			rec := httptest.NewRecorder()
+			r := newTLSRequest(method, "/services", body, "ns:producer", eaaCtx)
+			r.TLS.PeerCertificates[0].Raw = []byte("cert-b")
+			handler(rec, r)
+
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+			var resp ErrorResponse
+			Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+			Expect(resp.Error).To(Equal(reasonDuplicateURN))
+			Consistently(endpoint, 100*time.Millisecond).Should(Equal("https://1.1.1.1"))
+		},
+		table.Entry("renewal", RenewApplication, "POST", ""),
+		table.Entry("update", UpdateApplication, "PATCH",
+			`{"endpoint_uri":"https://2.2.2.2"}`),
+		table.Entry("deregistration", DeregisterApplication, "DELETE", ""),
+	)
+
+	g.It("lets the owner update its registration", func() {
+		Expect(register("https://3.3.3.3", "cert-a").Code).To(Equal(http.StatusOK))
+		Eventually(endpoint).Should(Equal("https://3.3.3.3"))
+	})
+
+	g.It("keeps the owner's registration against a registration of another instance", func() {
+		serv := Service{URN: &URN{Namespace: "ns", ID: "producer"},
+			EndpointURI: "https://2.2.2.2"}
+		Expect(publishServiceMessage(context.Background(), "ns:producer",
+			ServiceMessage{Svc: &serv, Action: serviceActionUpdate, Owner: "other"},
+			eaaCtx)).To(Succeed())
+
+		Consistently(endpoint, 100*time.Millisecond).Should(Equal("https://1.1.1.1"))
+	})
+
+	table.DescribeTable("keeps the owner's registration against another instance",
+		func(svcMsg ServiceMessage) {
+			Expect(publishServiceMessage(context.Background(), "ns:producer", svcMsg,
+				eaaCtx)).To(Succeed())
+
+			Consistently(endpoint, 100*time.Millisecond).Should(Equal("https://1.1.1.1"))
+		},
+		table.Entry("merging an update", ServiceMessage{
+			Svc:    &Service{URN: &URN{Namespace: "ns", ID: "producer"}},
+			Action: serviceActionUpdate, Owner: "other",
+			Update: &ServiceUpdate{EndpointURI: &otherEndpoint}}),
+		table.Entry("deregistering", ServiceMessage{
+			Svc:    &Service{URN: &URN{Namespace: "ns", ID: "producer"}},
+			Action: serviceActionDeregister, Owner: "other"}),
+	)
+
+	g.It("lets another certificate register an expired service", func() {
+		eaaCtx.cfg.DefaultServiceTTL.Duration = time.Second
+		eaaCtx.serviceInfo.Lock()
+		eaaCtx.serviceInfo.renewed["ns:producer"] = time.Now().Add(-time.Minute)
+		eaaCtx.serviceInfo.Unlock()
+
+		Expect(register("https://2.2.2.2", "cert-b").Code).To(Equal(http.StatusOK))
+		Eventually(endpoint).Should(Equal("https://2.2.2.2"))
+	})
+
+	g.It("lets the latest registration replace the service if disabled", func() {
+		eaaCtx.cfg.ExclusiveRegistration = false
+
+		Expect(register("https://2.2.2.2", "cert-b").Code).To(Equal(http.StatusOK))
+		Eventually(endpoint).Should(Equal("https://2.2.2.2"))
+	})
+})
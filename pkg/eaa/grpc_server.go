@@ -0,0 +1,484 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/gorilla/websocket"
+	"github.com/open-ness/edgenode/pkg/eaa/pb"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the EAA gRPC API. It shares the Context with
+// the HTTPS API, so both of them operate on the same services and
+// subscriptions.
+type grpcServer struct {
+	eaaCtx *Context
+}
+
+// grpcNotificationConn delivers notifications written to a consumer
+// connection to a gRPC Notifications stream
+type grpcNotificationConn struct {
+	stream pb.Eaa_NotificationsServer
+	// a gRPC stream doesn't allow concurrent sending
+	sendLock  sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newGRPCNotificationConn(stream pb.Eaa_NotificationsServer) *grpcNotificationConn {
+	return &grpcNotificationConn{stream: stream, done: make(chan struct{})}
+}
+
+// WriteMessage sends a JSON encoded NotificationToConsumer to the stream.
+// A close message ends the stream.
+func (c *grpcNotificationConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return c.Close()
+	}
+
+	var notif NotificationToConsumer
+	if err := json.Unmarshal(data, &notif); err != nil {
+		return errors.Wrap(err, "Failed to decode the notification")
+	}
+
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	return c.stream.Send(notificationToPB(notif))
+}
+
+// WriteControl ends the stream on a close message, other control messages
+// have no gRPC counterpart
+func (c *grpcNotificationConn) WriteControl(messageType int, data []byte,
+	deadline time.Time) error {
+
+	if messageType == websocket.CloseMessage {
+		return c.Close()
+	}
+	return nil
+}
+
+// Close ends the stream
+func (c *grpcNotificationConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// commonNameFromContext returns the CommonName of the TLS client
+// certificate of a gRPC peer
+func commonNameFromContext(ctx context.Context) (string, error) {
+	cert, err := peerCertificateFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// peerCertificateFromContext returns the client certificate of the peer of
+// a gRPC call
+func peerCertificateFromContext(ctx context.Context) (*x509.Certificate, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no peer information")
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no client certificate")
+	}
+
+	return tlsInfo.State.PeerCertificates[0], nil
+}
+
+// publishErrorStatus returns the status of a request whose message couldn't
+// be published to the Message Broker
+func publishErrorStatus(reason string, err error) error {
+	if isPublishTimeout(err) {
+		return status.Error(codes.Unavailable, reasonBrokerPublishTimeout)
+	}
+	if isBrokerCircuitOpen(err) {
+		return status.Error(codes.Unavailable, reasonBrokerUnavailable)
+	}
+	return status.Error(codes.Internal, reason)
+}
+
+// Register implements gRPC API
+func (s *grpcServer) Register(ctx context.Context, in *pb.Service) (*empty.Empty, error) {
+	cert, err := peerCertificateFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	commonName := cert.Subject.CommonName
+
+	serv := serviceFromPB(in)
+	if len(serv.Info) != 0 && !json.Valid(serv.Info) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: info is not valid JSON",
+			reasonInvalidService)
+	}
+
+	URN, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		log.Errf("Error during URN generation: %s", err.Error())
+		return nil, status.Error(codes.InvalidArgument, reasonInvalidURN)
+	}
+	if !urnMatches(serv.URN, URN) {
+		log.Errf("Register: URN %v does not match the URN of %s", *serv.URN, commonName)
+		return nil, status.Error(codes.InvalidArgument, reasonURNMismatch)
+	}
+	serv.URN = &URN
+
+	if err = validateService(&serv); err != nil {
+		log.Errf("Register: %s", err.Error())
+		return nil, status.Errorf(codes.InvalidArgument, "%s: %s", reasonInvalidService,
+			err.Error())
+	}
+
+	owner := certificateFingerprint(cert)
+	s.eaaCtx.serviceInfo.RLock()
+	err = checkRegistrationOwner(URN.String(), owner, s.eaaCtx)
+	s.eaaCtx.serviceInfo.RUnlock()
+	if err != nil {
+		log.Errf("Register: %s", err.Error())
+		return nil, status.Error(codes.AlreadyExists, reasonDuplicateURN)
+	}
+
+	action, err := registrationAction(URN.String(), serv, s.eaaCtx)
+	if err != nil {
+		log.Errf("Register: %s", err.Error())
+		return nil, status.Error(codes.Internal, reasonMarshalingFailed)
+	}
+	// An identical registration has nothing to update, the producer renews
+	// the service to refresh its TTL
+	if action == "" {
+		return &empty.Empty{}, nil
+	}
+
+	publishCtx, cancel := withPublishTimeout(ctx, s.eaaCtx)
+	defer cancel()
+	err = publishServiceMessage(publishCtx, commonName,
+		ServiceMessage{Svc: &serv, Action: action, Owner: owner}, s.eaaCtx)
+	if err != nil {
+		log.Errf("Register: %s", err.Error())
+		return nil, publishErrorStatus(reasonBrokerPublishFailed, err)
+	}
+
+	if action == serviceActionRegister {
+		registrationsTotal.Inc()
+	}
+	log.Debugf("Successfully processed gRPC Register from %s", commonName)
+	return &empty.Empty{}, nil
+}
+
+// Deregister implements gRPC API
+func (s *grpcServer) Deregister(ctx context.Context, in *empty.Empty) (*empty.Empty, error) {
+	cert, err := peerCertificateFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	commonName := cert.Subject.CommonName
+
+	URN, err := CommonNameStringToURN(commonName)
+	if err != nil {
+		log.Errf("Error during converting Common Name to URN: %s", err.Error())
+		return nil, status.Error(codes.InvalidArgument, reasonInvalidURN)
+	}
+
+	owner := certificateFingerprint(cert)
+	s.eaaCtx.serviceInfo.RLock()
+	serviceFound := isServicePresent(URN.String(), s.eaaCtx)
+	err = checkRegistrationOwner(URN.String(), owner, s.eaaCtx)
+	s.eaaCtx.serviceInfo.RUnlock()
+	if err != nil {
+		log.Errf("Deregister: %s", err.Error())
+		return nil, status.Error(codes.AlreadyExists, reasonDuplicateURN)
+	}
+
+	// The deregistration is published anyway, like in the HTTPS API
+	publishCtx, cancel := withPublishTimeout(ctx, s.eaaCtx)
+	defer cancel()
+	err = publishServiceMessage(publishCtx, commonName, ServiceMessage{
+		Svc: &Service{URN: &URN}, Action: serviceActionDeregister, Owner: owner}, s.eaaCtx)
+	if err != nil {
+		log.Errf("Deregister: %s", err.Error())
+		return nil, publishErrorStatus(reasonBrokerPublishFailed, err)
+	}
+
+	if !serviceFound {
+		return nil, status.Error(codes.NotFound, reasonServiceNotFound)
+	}
+
+	deregistrationsTotal.Inc()
+	log.Debugf("Successfully processed gRPC Deregister from %s", commonName)
+	return &empty.Empty{}, nil
+}
+
+// Subscribe implements gRPC API
+func (s *grpcServer) Subscribe(ctx context.Context, in *pb.Subscription) (*empty.Empty, error) {
+	return s.processSubscription(ctx, subscriptionActionSubscribe, in)
+}
+
+// Unsubscribe implements gRPC API
+func (s *grpcServer) Unsubscribe(ctx context.Context, in *pb.Subscription) (*empty.Empty, error) {
+	return s.processSubscription(ctx, subscriptionActionUnsubscribe, in)
+}
+
+// processSubscription subscribes or unsubscribes a consumer to notifications
+// of a namespace or, if the URN has an ID, of a single service
+func (s *grpcServer) processSubscription(ctx context.Context, action string,
+	in *pb.Subscription) (*empty.Empty, error) {
+
+	commonName, err := commonNameFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	urn := urnFromPB(in.GetUrn())
+	if urn == nil || urn.Namespace == "" {
+		return nil, status.Error(codes.InvalidArgument, reasonInvalidURN)
+	}
+
+	scope := subscriptionScopeNamespace
+	if urn.ID != "" {
+		scope = subscriptionScopeService
+		if isNamespacePattern(urn.Namespace) {
+			return nil, status.Error(codes.InvalidArgument, reasonInvalidNamespacePattern)
+		}
+	}
+
+	subs := descriptorsFromPB(in.GetNotifications())
+	if action == subscriptionActionSubscribe {
+		if err = validateSubscriptionNotifications(subs); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: %s",
+				reasonInvalidNotification, err.Error())
+		}
+		if err = checkNamespaceAccess(commonName, urn.Namespace, s.eaaCtx); err != nil {
+			return nil, status.Errorf(codes.PermissionDenied, "%s: %s",
+				reasonNamespaceAccessDenied, err.Error())
+		}
+		if err = checkSubscriptionLimit(commonName, urn.Namespace, urn.ID, subs,
+			s.eaaCtx); err != nil {
+			return nil, status.Errorf(codes.ResourceExhausted, "%s: %s",
+				reasonSubscriptionLimit, err.Error())
+		}
+		if scope == subscriptionScopeService {
+			s.eaaCtx.serviceInfo.RLock()
+			serviceFound := isServicePresent(urn.String(), s.eaaCtx)
+			s.eaaCtx.serviceInfo.RUnlock()
+			if !serviceFound {
+				return nil, status.Error(codes.NotFound, reasonServiceNotFound)
+			}
+		}
+	}
+
+	publishCtx, cancel := withPublishTimeout(ctx, s.eaaCtx)
+	defer cancel()
+	err = processSubscriptionRequest(publishCtx, action, scope, commonName, urn, subs, 0,
+		nil, s.eaaCtx)
+	if err != nil {
+		log.Errf("Error during gRPC Subscription Request processing: %s", err.Error())
+		return nil, publishErrorStatus(reasonSubscriptionFailed, err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// GetServices implements gRPC API
+func (s *grpcServer) GetServices(ctx context.Context, in *empty.Empty) (*pb.ServiceList, error) {
+	if _, err := commonNameFromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.eaaCtx.serviceInfo.RLock()
+	defer s.eaaCtx.serviceInfo.RUnlock()
+
+	if s.eaaCtx.serviceInfo.m == nil {
+		return nil, status.Error(codes.Unavailable, reasonNotInitialized)
+	}
+
+	servList := &pb.ServiceList{}
+	for _, serv := range s.eaaCtx.serviceInfo.m {
+		servList.Services = append(servList.Services, serviceToPB(serv))
+	}
+
+	return servList, nil
+}
+
+// Notifications implements gRPC API. The stream is a connection of
+// the consumer, like its WebSocket ones, until the consumer cancels it.
+// It has no filter, so it replaces the previous unfiltered connection.
+func (s *grpcServer) Notifications(in *empty.Empty,
+	stream pb.Eaa_NotificationsServer) error {
+
+	commonName, err := commonNameFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	conn := newGRPCNotificationConn(stream)
+
+	s.eaaCtx.consumerConnections.Lock()
+	closePreviousConsumerConnection(commonName, s.eaaCtx)
+	if err = checkConnectionLimit(commonName, s.eaaCtx); err != nil {
+		s.eaaCtx.consumerConnections.Unlock()
+		log.Errf("Notifications: %s", err.Error())
+		return status.Error(codes.ResourceExhausted, reasonConnectionLimit)
+	}
+	s.eaaCtx.consumerConnections.add(commonName, ConsumerConnection{
+		connection: conn, connectedAt: time.Now()})
+	s.eaaCtx.consumerConnections.Unlock()
+
+	// Subscribe to the Client topic to receive all of its subscriptions
+	topic := getClientTopicName(commonName)
+	err = s.eaaCtx.MsgBrokerCtx.addSubscriber(clientSubscriber, topic, nil)
+	if err != nil {
+		if _, ok := err.(objectAlreadyExistsError); !ok {
+			log.Errf("Error when adding a Subscriber of type: '%v', topic: '%v'",
+				clientSubscriber, topic)
+			err = status.Error(codes.Internal, reasonSubscriptionFailed)
+		} else {
+			err = nil
+		}
+	}
+
+	if err == nil {
+		log.Debugf("Successfully processed gRPC Notifications from %s", commonName)
+		select {
+		case <-conn.done:
+		case <-stream.Context().Done():
+		}
+	}
+
+	// Forget the connection unless it was removed meanwhile
+	s.eaaCtx.consumerConnections.Lock()
+	s.eaaCtx.consumerConnections.remove(commonName, conn)
+	s.eaaCtx.consumerConnections.Unlock()
+
+	return err
+}
+
+// runGRPCServer serves the EAA gRPC API on an endpoint requiring client
+// certificates signed by the same CA as the HTTPS API
+func runGRPCServer(parentCtx context.Context, endpoint string, certPool *x509.CertPool,
+	eaaCtx *Context) {
+
+	cert, err := tls.LoadX509KeyPair(eaaCtx.config().Certs.ServerCertPath,
+		eaaCtx.config().Certs.ServerKeyPath)
+	if err != nil {
+		log.Errf("gRPC server: failed to load the server key pair: %#v", err)
+		return
+	}
+
+	lis, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		log.Errf("gRPC server: net.Listen error: %+v", err)
+		return
+	}
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		ClientAuth:            tls.RequireAndVerifyClientCert,
+		ClientCAs:             certPool,
+		Certificates:          []tls.Certificate{cert},
+		MinVersion:            tls.VersionTLS12,
+		CipherSuites:          []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		VerifyPeerCertificate: eaaCtx.revocation.verifyPeerCertificate,
+	})), grpc.UnaryInterceptor(auditInterceptor(eaaCtx)))
+	pb.RegisterEaaServer(server, &grpcServer{eaaCtx: eaaCtx})
+
+	go func() {
+		<-parentCtx.Done()
+		server.Stop()
+	}()
+
+	log.Infof("Serving EAA gRPC API on: %s", endpoint)
+	if err = server.Serve(lis); err != nil {
+		log.Errf("gRPC server error: %#v", err)
+	}
+}
+
+func urnFromPB(urn *pb.URN) *URN {
+	if urn == nil {
+		return nil
+	}
+	return &URN{ID: urn.GetId(), Namespace: normalizeNamespace(urn.GetNamespace())}
+}
+
+func urnToPB(urn *URN) *pb.URN {
+	if urn == nil {
+		return nil
+	}
+	return &pb.URN{Id: urn.ID, Namespace: urn.Namespace}
+}
+
+func descriptorsFromPB(notifs []*pb.NotificationDescriptor) []NotificationDescriptor {
+	var descriptors []NotificationDescriptor
+	for _, notif := range notifs {
+		descriptors = append(descriptors, NotificationDescriptor{
+			Name:        notif.GetName(),
+			Version:     notif.GetVersion(),
+			Description: notif.GetDescription(),
+			Filter:      notif.GetFilter(),
+		})
+	}
+	return descriptors
+}
+
+func descriptorsToPB(notifs []NotificationDescriptor) []*pb.NotificationDescriptor {
+	var descriptors []*pb.NotificationDescriptor
+	for _, notif := range notifs {
+		descriptors = append(descriptors, &pb.NotificationDescriptor{
+			Name:        notif.Name,
+			Version:     notif.Version,
+			Description: notif.Description,
+			Filter:      notif.Filter,
+		})
+	}
+	return descriptors
+}
+
+func serviceFromPB(serv *pb.Service) Service {
+	return Service{
+		URN:           urnFromPB(serv.GetUrn()),
+		Description:   serv.GetDescription(),
+		EndpointURI:   serv.GetEndpointUri(),
+		Status:        serv.GetStatus(),
+		Notifications: descriptorsFromPB(serv.GetNotifications()),
+		Info:          serv.GetInfo(),
+		TTL:           serv.GetTtl(),
+	}
+}
+
+func serviceToPB(serv Service) *pb.Service {
+	return &pb.Service{
+		Urn:           urnToPB(serv.URN),
+		Description:   serv.Description,
+		EndpointUri:   serv.EndpointURI,
+		Status:        serv.Status,
+		Notifications: descriptorsToPB(serv.Notifications),
+		Info:          serv.Info,
+		Ttl:           serv.TTL,
+	}
+}
+
+func notificationToPB(notif NotificationToConsumer) *pb.Notification {
+	return &pb.Notification{
+		Name:     notif.Name,
+		Version:  notif.Version,
+		Payload:  notif.Payload,
+		Producer: urnToPB(&notif.URN),
+		Sequence: notif.Sequence,
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/open-ness/edgenode/pkg/eaa/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newPeerContext creates a context of a gRPC peer authenticated with
+// a client certificate with the given CommonName
+func newPeerContext(parent context.Context, commonName string) context.Context {
+	return peer.NewContext(parent, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: commonName}},
+			},
+		}},
+	})
+}
+
+// fakeNotificationsStream records notifications sent to a consumer
+type fakeNotificationsStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pb.Notification
+}
+
+func (s *fakeNotificationsStream) Send(n *pb.Notification) error {
+	s.sent <- n
+	return nil
+}
+
+func (s *fakeNotificationsStream) Context() context.Context {
+	return s.ctx
+}
+
+var _ = g.Describe("gRPC API", func() {
+	var (
+		eaaCtx *Context
+		server *grpcServer
+	)
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.serviceInfo.renewed = make(map[string]time.Time)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic,
+			nil)).To(Succeed())
+		Expect(eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic,
+			nil)).To(Succeed())
+
+		server = &grpcServer{eaaCtx: eaaCtx}
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("rejects peers without a client certificate", func() {
+		_, err := server.GetServices(context.Background(), &empty.Empty{})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+	})
+
+	g.It("registers and deregisters the calling producer", func() {
+		ctx := newPeerContext(context.Background(), "ns:producer")
+
+		_, err := server.Register(ctx, &pb.Service{
+			EndpointUri: "https://1.2.3.4",
+			Info:        []byte(`{"zone":"a"}`),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() []*pb.Service {
+			list, err := server.GetServices(ctx, &empty.Empty{})
+			Expect(err).ToNot(HaveOccurred())
+			return list.Services
+		}).Should(HaveLen(1))
+		list, _ := server.GetServices(ctx, &empty.Empty{})
+		Expect(list.Services[0].Urn).To(Equal(&pb.URN{Id: "producer", Namespace: "ns"}))
+		Expect(list.Services[0].Info).To(MatchJSON(`{"zone":"a"}`))
+
+		_, err = server.Deregister(ctx, &empty.Empty{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() []*pb.Service {
+			list, _ := server.GetServices(ctx, &empty.Empty{})
+			return list.Services
+		}).Should(BeEmpty())
+	})
+
+	g.It("rejects a registration with another producer's URN", func() {
+		_, err := server.Register(newPeerContext(context.Background(), "ns:producer"),
+			&pb.Service{Urn: &pb.URN{Id: "other", Namespace: "ns"},
+				EndpointUri: "https://1.2.3.4"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	g.It("rejects a subscription without namespace", func() {
+		_, err := server.Subscribe(newPeerContext(context.Background(), "ns:consumer"),
+			&pb.Subscription{Urn: &pb.URN{Id: "producer"}})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	g.It("streams notifications until the consumer cancels", func() {
+		ctx, cancel := context.WithCancel(
+			newPeerContext(context.Background(), "ns:consumer"))
+		stream := &fakeNotificationsStream{ctx: ctx, sent: make(chan *pb.Notification, 1)}
+
+		done := make(chan error)
+		go func() { done <- server.Notifications(&empty.Empty{}, stream) }()
+
+		Eventually(func() bool {
+			eaaCtx.consumerConnections.RLock()
+			defer eaaCtx.consumerConnections.RUnlock()
+			_, found := eaaCtx.consumerConnections.m["ns:consumer"]
+			return found
+		}).Should(BeTrue())
+
+		payload, err := json.Marshal(NotificationToConsumer{Name: "n1", Version: "1.0",
+			Payload: json.RawMessage(`{}`), URN: URN{ID: "producer", Namespace: "ns"},
+			Sequence: 7})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sendNotificationToSubscriber("ns:consumer", nil, payload, "", time.Time{},
+			eaaCtx)).To(Succeed())
+
+		var notif *pb.Notification
+		Eventually(stream.sent).Should(Receive(&notif))
+		Expect(notif.Name).To(Equal("n1"))
+		Expect(notif.Producer).To(Equal(&pb.URN{Id: "producer", Namespace: "ns"}))
+		Expect(notif.Sequence).To(Equal(uint64(7)))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(eaaCtx.consumerConnections.m).ToNot(HaveKey("ns:consumer"))
+	})
+})
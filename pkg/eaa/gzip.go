@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// defaultCompressionMinSize is the size of the smallest response compressed
+// if ResponseCompression.MinSize is not set
+const defaultCompressionMinSize = 1024
+
+// streamingRoutes are the GET routes streaming notifications, whose
+// responses are neither compressed nor traced
+var streamingRoutes = map[string]bool{
+	"GetNotifications":    true,
+	"GetNotificationsSSE": true,
+}
+
+// acceptsGzip checks if the Accept-Encoding header of the request lists gzip
+// without a zero quality value
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			params := strings.Split(coding, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), "gzip") {
+				continue
+			}
+			accepted := true
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+					accepted = err == nil && q > 0
+				}
+			}
+			return accepted
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers a response until it reaches the minimum size,
+// then writes it compressed. A smaller response is written by finish as it
+// is.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() < w.minSize || w.Header().Get("Content-Encoding") != "" {
+		return len(data), nil
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf.Reset()
+	return len(data), nil
+}
+
+// finish completes the compressed response or writes the buffered one
+func (w *gzipResponseWriter) finish() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	if w.status == 0 {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// gzipMiddleware compresses the responses of the GET routes, except
+// the streaming ones, to clients accepting gzip. Responses smaller than
+// ResponseCompression.MinSize are written uncompressed.
+func gzipMiddleware(eaaCtx *Context) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := eaaCtx.config().ResponseCompression
+			route := mux.CurrentRoute(r)
+			if !cfg.Enabled || r.Method != http.MethodGet || route == nil ||
+				streamingRoutes[route.GetName()] || websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			minSize := cfg.MinSize
+			if minSize <= 0 {
+				minSize = defaultCompressionMinSize
+			}
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize}
+			next.ServeHTTP(gw, r)
+			if err := gw.finish(); err != nil {
+				log.Errf("Failed to write the response of %s: %v", r.URL.Path, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Response compression", func() {
+	var eaaCtx *Context
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest(http.MethodGet, path, "", "ns:consumer", eaaCtx)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		NewEaaRouter(eaaCtx).ServeHTTP(rec, r)
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = newFanOutContext(nil)
+		eaaCtx.cfg.ResponseCompression.Enabled = true
+		for i := 0; i < 50; i++ {
+			urn := URN{ID: fmt.Sprintf("producer%d", i), Namespace: "ns"}
+			eaaCtx.serviceInfo.m[urn.String()] = Service{URN: &urn,
+				EndpointURI: "https://" + urn.ID + ".example.com"}
+		}
+	})
+
+	g.It("compresses a large response to a client accepting gzip", func() {
+		rec := get("/services", "gzip, deflate")
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Encoding")).To(Equal("gzip"))
+		Expect(rec.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+		Expect(rec.Header().Get(totalCountHeader)).To(Equal("51"))
+		size := rec.Body.Len()
+
+		body, err := gzip.NewReader(rec.Body)
+		Expect(err).ToNot(HaveOccurred())
+		var servList ServiceList
+		Expect(json.NewDecoder(body).Decode(&servList)).To(Succeed())
+		Expect(servList.Services).To(HaveLen(51))
+
+		plain := get("/services", "")
+		Expect(plain.Header().Get("Content-Encoding")).To(BeEmpty())
+		Expect(size).To(BeNumerically("<", plain.Body.Len()/2))
+	})
+
+	g.It("writes a response smaller than the minimum size uncompressed", func() {
+		eaaCtx.cfg.ResponseCompression.MinSize = 1 << 20
+		rec := get("/services", "gzip")
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Encoding")).To(BeEmpty())
+		Expect(rec.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+		var servList ServiceList
+		Expect(json.NewDecoder(rec.Body).Decode(&servList)).To(Succeed())
+		Expect(servList.Services).To(HaveLen(51))
+	})
+
+	g.It("keeps the status of an uncompressed error", func() {
+		rec := get("/services/ns/unknown", "gzip")
+
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+		Expect(rec.Header().Get("Content-Encoding")).To(BeEmpty())
+	})
+
+	g.It("leaves the notification streams alone", func() {
+		rec := get("/notifications", "gzip")
+		Expect(rec.Header().Get("Content-Encoding")).To(BeEmpty())
+		Expect(rec.Header().Get("Vary")).To(BeEmpty())
+	})
+
+	g.It("is disabled by the config", func() {
+		eaaCtx.cfg.ResponseCompression.Enabled = false
+		rec := get("/services", "gzip")
+
+		Expect(rec.Header().Get("Content-Encoding")).To(BeEmpty())
+		Expect(rec.Header().Get("Vary")).To(BeEmpty())
+	})
+
+	table.DescribeTable("honors the Accept-Encoding header",
+		func(acceptEncoding string, accepted bool) {
+			r := httptest.NewRequest(http.MethodGet, "/services", nil)
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+			Expect(acceptsGzip(r)).To(Equal(accepted))
+		},
+		table.Entry("gzip", "gzip", true),
+		table.Entry("listed", "br, GZIP;q=0.5", true),
+		table.Entry("refused", "gzip;q=0, deflate", false),
+		table.Entry("other coding", "deflate", false),
+		table.Entry("none", "", false),
+	)
+})
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Readiness sub-check names
+const (
+	checkMsgBroker          = "msg_broker"
+	checkServicesSubscriber = "services_subscriber"
+	checkOK                 = "ok"
+)
+
+// checkReadiness pings the Message Broker and checks if the services
+// subscriber is running
+func checkReadiness(eaaCtx *Context) ReadinessStatus {
+	status := ReadinessStatus{Ready: true, Checks: map[string]string{
+		checkMsgBroker:          checkOK,
+		checkServicesSubscriber: checkOK,
+	}}
+
+	if eaaCtx.MsgBrokerCtx == nil {
+		status.Ready = false
+		status.Checks[checkMsgBroker] = "not initialized"
+	} else if err := eaaCtx.MsgBrokerCtx.ping(); err != nil {
+		status.Ready = false
+		status.Checks[checkMsgBroker] = err.Error()
+	}
+
+	if atomic.LoadInt32(&eaaCtx.servicesSubscriberRunning) == 0 {
+		status.Ready = false
+		status.Checks[checkServicesSubscriber] = "not running"
+	}
+
+	return status
+}
+
+// healthzHandler reports liveness, it succeeds as long as EAA is serving
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": checkOK}); err != nil {
+		log.Errf("Liveness check: %s", err.Error())
+	}
+}
+
+// newReadyzHandler creates a handler reporting readiness of EAA
+func newReadyzHandler(eaaCtx *Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := checkReadiness(eaaCtx)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		if status.Ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Errf("Readiness check: %s", err.Error())
+		}
+	}
+}
+
+// runHealthServer serves the liveness and readiness probes on a plain HTTP
+// endpoint, that does not require client certificates, until the parent
+// context is done
+func runHealthServer(parentCtx context.Context, endpoint string, eaaCtx *Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", newReadyzHandler(eaaCtx))
+	server := &http.Server{Addr: endpoint, Handler: mux}
+
+	go func() {
+		<-parentCtx.Done()
+		if err := server.Close(); err != nil {
+			log.Errf("Could not close health server: %#v", err)
+		}
+	}()
+
+	log.Infof("Serving EAA health probes on: %s", endpoint)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Errf("Health server error: %#v", err)
+	}
+}
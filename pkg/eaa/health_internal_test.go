@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// unreachableMsgBroker is a GoChannelMsgBroker failing the ping
+type unreachableMsgBroker struct {
+	*GoChannelMsgBroker
+}
+
+func (unreachableMsgBroker) ping() error {
+	return errors.New("connection refused")
+}
+
+var _ = g.Describe("health probes", func() {
+	var eaaCtx *Context
+
+	readyz := func() (int, ReadinessStatus) {
+		rec := httptest.NewRecorder()
+		newReadyzHandler(eaaCtx)(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+		var status ReadinessStatus
+		Expect(json.NewDecoder(rec.Body).Decode(&status)).To(Succeed())
+		return rec.Code, status
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("reports liveness", func() {
+		rec := httptest.NewRecorder()
+		healthzHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+
+	g.It("is ready once the services subscriber runs", func() {
+		code, status := readyz()
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Checks[checkServicesSubscriber]).To(Equal("not running"))
+
+		Expect(eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic, nil)).
+			To(Succeed())
+
+		Eventually(func() int {
+			code, _ := readyz()
+			return code
+		}).Should(Equal(http.StatusOK))
+	})
+
+	g.It("is not ready when the Message Broker is unreachable", func() {
+		eaaCtx.MsgBrokerCtx = unreachableMsgBroker{NewGoChannelMsgBroker(eaaCtx)}
+		eaaCtx.servicesSubscriberRunning = 1
+
+		code, status := readyz()
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Ready).To(BeFalse())
+		Expect(status.Checks).To(Equal(map[string]string{
+			checkMsgBroker:          "connection refused",
+			checkServicesSubscriber: checkOK,
+		}))
+	})
+})
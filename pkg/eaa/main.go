@@ -13,6 +13,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	logger "github.com/open-ness/common/log"
@@ -24,11 +26,18 @@ import (
 type services struct {
 	sync.RWMutex
 	m map[string]Service
+	// time of the last registration or renewal of a service
+	renewed map[string]time.Time
+	// fingerprints of the certificates the services were registered with
+	owners map[string]string
 }
 
+// consumerConns holds the notification connections of the consumers by
+// their CommonName, a consumer may have several connections with filters
+// of their own and a single one without a filter
 type consumerConns struct {
 	sync.RWMutex
-	m map[string]ConsumerConnection
+	m map[string][]ConsumerConnection
 }
 
 // Context holds all EAA structures
@@ -39,6 +48,44 @@ type Context struct {
 	certsEaaCa          Certs
 	cfg                 Config
 	MsgBrokerCtx        msgBroker
+	notifLimiter        notificationLimiter
+	broadcastLimiter    notificationLimiter
+	nodeLimiter         notificationLimiter
+	notifDedup          notificationDeduplicator
+	versionMismatches   notificationDeduplicator
+	receiveClock        receiveClock
+	replayBuffers       replayBuffers
+	unackedNotifs       unackedNotifications
+	aggregations        notificationAggregations
+	mqttBridge          *mqttBridge
+	audit               *auditLogger
+	deadLetters         *deadLetterSink
+	revocation          *revocationChecker
+	deliveryReports     deliveryReports
+	selfTests           selfTestReports
+	subscriptionStore   subscriptionStore
+	serviceStore        serviceStore
+	subscriptionLeases  subscriptionLeases
+	notifSchemas        notificationSchemas
+	subscriptionStats   subscriptionStats
+	publishPolicies     publishPolicies
+	webhooks            webhooks
+	serviceUpdates      serviceUpdateLocks
+	publishBreaker      publishBreaker
+	// cfgPath is the config file the config is reloaded from
+	cfgPath string
+	// reloaded holds the *reloadedConfig of the last reload, reloadLock
+	// serializes the reloads
+	reloaded   atomic.Value
+	reloadLock sync.Mutex
+	// set to 1 while the services topic messages are being handled
+	servicesSubscriberRunning int32
+	// set to 1 once a shutdown started
+	shuttingDown int32
+	// handlers of the Message Broker subscribers
+	messageHandlers sync.WaitGroup
+	// creates the default subscriptionStore of a context without one
+	subscriptionStoreInit sync.Once
 }
 
 // Certs stores certs and keys for root ca and eaa
@@ -93,8 +140,9 @@ func newKafkaTLSConfig(clientCertFile, clientKeyFile, caCertFile string) (*tls.C
 
 // InitEaaContext initializes the Eaa Context
 func InitEaaContext(cfgPath string, eaaCtx *Context) error {
-	eaaCtx.serviceInfo = services{m: make(map[string]Service)}
-	eaaCtx.consumerConnections = consumerConns{m: make(map[string]ConsumerConnection)}
+	eaaCtx.serviceInfo = services{m: make(map[string]Service),
+		renewed: make(map[string]time.Time)}
+	eaaCtx.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
 	eaaCtx.subscriptionInfo = NotificationSubscriptions{
 		m: make(map[UniqueNotif]*ConsumerSubscription)}
 
@@ -105,12 +153,100 @@ func InitEaaContext(cfgPath string, eaaCtx *Context) error {
 		log.Errf("Failed to load config: %#v", err)
 		return err
 	}
+	eaaCtx.cfgPath = cfgPath
 
 	if eaaCtx.certsEaaCa.eaa, err = InitEaaCert(eaaCtx.cfg.Certs); err != nil {
 		log.Errf("EAA cert creation error: %#v", err)
 		return err
 	}
 
+	return initContextFromConfig(eaaCtx)
+}
+
+// NewContext creates a Context of the config using the Message Broker, so that
+// the EAA handlers can be run without the Message Broker and the certificates
+// of the config. The handlers are reached with the router of NewEaaRouter
+// and the Message Broker is closed with Close.
+func NewContext(cfg Config, pubSub PubSub) (*Context, error) {
+	eaaCtx := &Context{cfg: cfg}
+	eaaCtx.serviceInfo = services{m: make(map[string]Service),
+		renewed: make(map[string]time.Time)}
+	eaaCtx.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+	eaaCtx.subscriptionInfo = NotificationSubscriptions{
+		m: make(map[UniqueNotif]*ConsumerSubscription)}
+
+	if err := initContextFromConfig(eaaCtx); err != nil {
+		return nil, err
+	}
+
+	eaaCtx.MsgBrokerCtx = newPubSubMsgBroker(pubSub, eaaCtx)
+	if err := addServicesPubSub(eaaCtx); err != nil {
+		return nil, err
+	}
+
+	return eaaCtx, nil
+}
+
+// addServicesPubSub adds the Publisher and Subscriber for Services topic to
+// the Message Broker of the Context
+func addServicesPubSub(eaaCtx *Context) error {
+	err := eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Couldn't add publisher of type %s and ID %s",
+			servicesPublisher.String(), servicesTopic)
+	}
+	err = eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Couldn't add subscriber of type %s and ID %s",
+			servicesSubscriber.String(), servicesTopic)
+	}
+	return nil
+}
+
+// Close closes the Message Broker of a Context created by NewContext and
+// waits until its messages are handled
+func (eaaCtx *Context) Close() error {
+	err := eaaCtx.MsgBrokerCtx.removeAll()
+	if !waitForMessageHandlers(shutdownDrainTimeout(eaaCtx), eaaCtx) {
+		log.Warningf("Message Broker handlers not finished in %v",
+			shutdownDrainTimeout(eaaCtx))
+	}
+	return err
+}
+
+// initContextFromConfig validates the config of the Context and initializes
+// the structures depending on it
+func initContextFromConfig(eaaCtx *Context) error {
+	var err error
+
+	if err = validateConfig(&eaaCtx.cfg); err != nil {
+		log.Errf("Config error: %#v", err)
+		return err
+	}
+
+	if err = loadNotificationSchemas(eaaCtx); err != nil {
+		log.Errf("Config error: %#v", err)
+		return err
+	}
+
+	if eaaCtx.publishPolicies, err = newPublishPolicies(
+		eaaCtx.cfg.PublishPolicies); err != nil {
+		log.Errf("Config error: %#v", err)
+		return err
+	}
+
+	if eaaCtx.cfg.AuditLogPath != "" {
+		if eaaCtx.audit, err = newAuditLogger(eaaCtx.cfg.AuditLogPath); err != nil {
+			log.Errf("Audit log error: %#v", err)
+			return err
+		}
+	}
+
+	if eaaCtx.deadLetters, err = newDeadLetterSink(eaaCtx.cfg.DeadLetter); err != nil {
+		log.Errf("Dead-letter sink error: %#v", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -119,41 +255,41 @@ func InitEaaContext(cfgPath string, eaaCtx *Context) error {
 func RunServer(parentCtx context.Context, eaaCtx *Context) error {
 	var err error
 
-	certPool, err := CreateAndSetCACertPool(eaaCtx.cfg.Certs.CaRootPath)
+	certPool, err := CreateAndSetCACertPool(eaaCtx.config().Certs.CaRootPath)
 	if err != nil {
 		log.Errf("Cert Pool error: %#v", err)
 	}
 
+	eaaCtx.revocation = newRevocationChecker(eaaCtx.config().Revocation)
+
 	router := NewEaaRouter(eaaCtx)
+	handler := newURLLengthHandler(newCORSHandler(router, eaaCtx.config().CORS), eaaCtx)
 	server := &http.Server{
-		Addr: eaaCtx.cfg.TLSEndpoint,
+		Addr: eaaCtx.config().TLSEndpoint,
 		TLSConfig: &tls.Config{
-			ClientAuth:   tls.RequireAndVerifyClientCert,
-			ClientCAs:    certPool,
-			MinVersion:   tls.VersionTLS12,
-			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			ClientAuth:            tls.RequireAndVerifyClientCert,
+			ClientCAs:             certPool,
+			MinVersion:            tls.VersionTLS12,
+			CipherSuites:          []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			VerifyPeerCertificate: eaaCtx.revocation.verifyPeerCertificate,
 		},
-		Handler: router,
+		Handler:        handler,
+		MaxHeaderBytes: maxHeaderBytes(eaaCtx.config()),
 	}
 
 	stopServerCh := make(chan bool, 2)
 	var lis net.Listener
 
-	// Add Publisher and Subscriber for Services topic
-	err = eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic, nil)
-	if err != nil {
-		err = errors.Wrapf(err, "Couldn't add publisher of type %s and ID %s",
-			servicesPublisher.String(), servicesTopic)
+	if err = addServicesPubSub(eaaCtx); err != nil {
 		goto cleanup
 	}
-	err = eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic, nil)
-	if err != nil {
-		err = errors.Wrapf(err, "Couldn't add subscriber of type %s and ID %s",
-			servicesSubscriber.String(), servicesTopic)
+
+	if err = runSelfTest(parentCtx, eaaCtx); err != nil {
+		log.Errf("Self-test failed: %v", err)
 		goto cleanup
 	}
 
-	lis, err = net.Listen("tcp", eaaCtx.cfg.TLSEndpoint)
+	lis, err = net.Listen("tcp", eaaCtx.config().TLSEndpoint)
 	if err != nil {
 
 		log.Errf("net.Listen error: %+v", err)
@@ -168,22 +304,50 @@ func RunServer(parentCtx context.Context, eaaCtx *Context) error {
 	go func(stopServerCh chan bool) {
 		<-parentCtx.Done()
 		log.Info("Executing graceful stop")
-		if servErr := server.Close(); servErr != nil {
-			log.Errf("Could not close EAA server: %#v", servErr)
-		}
+		shutdownServer(server, eaaCtx)
 		log.Info("EAA server stopped")
 		stopServerCh <- true
 	}(stopServerCh)
 
 	defer log.Info("Stopped EAA serving")
 
-	log.Infof("Serving EAA on: %s", eaaCtx.cfg.TLSEndpoint)
-	util.Heartbeat(parentCtx, eaaCtx.cfg.HeartbeatInterval, func() {
+	if eaaCtx.config().MQTTBridge.Broker != "" {
+		client, mqttErr := newMQTTClient(eaaCtx.config().MQTTBridge)
+		if mqttErr != nil {
+			log.Errf("MQTT bridge disabled: %s", mqttErr.Error())
+		} else {
+			eaaCtx.mqttBridge = &mqttBridge{client: client,
+				cfg: eaaCtx.config().MQTTBridge, eaaCtx: eaaCtx}
+			go runMQTTBridge(parentCtx, eaaCtx.mqttBridge)
+		}
+	}
+	if eaaCtx.config().OpenEndpoint != "" {
+		go runHealthServer(parentCtx, eaaCtx.config().OpenEndpoint, eaaCtx)
+	}
+	if eaaCtx.config().MetricsEndpoint != "" {
+		go runMetricsServer(parentCtx, eaaCtx.config().MetricsEndpoint)
+	}
+	if eaaCtx.config().AdminSocketPath != "" {
+		go runAdminSocketServer(parentCtx, eaaCtx.config().AdminSocketPath, eaaCtx)
+	}
+	if eaaCtx.config().GRPCEndpoint != "" {
+		go runGRPCServer(parentCtx, eaaCtx.config().GRPCEndpoint, certPool, eaaCtx)
+	}
+
+	log.Infof("Serving EAA on: %s", eaaCtx.config().TLSEndpoint)
+	util.Heartbeat(parentCtx, eaaCtx.config().HeartbeatInterval, func() {
 		// TODO: implementation of modules checking
 		log.Info("Heartbeat")
 	})
-	if err = server.ServeTLS(lis, eaaCtx.cfg.Certs.ServerCertPath,
-		eaaCtx.cfg.Certs.ServerKeyPath); err != http.ErrServerClosed {
+	util.Heartbeat(parentCtx, eaaCtx.config().ServiceReaperInterval, func() {
+		reapExpiredServices(eaaCtx)
+	})
+	util.Heartbeat(parentCtx, eaaCtx.config().SubscriptionReaperInterval, func() {
+		reapExpiredSubscriptions(eaaCtx)
+	})
+	go runNotificationRedelivery(parentCtx, eaaCtx)
+	if err = server.ServeTLS(lis, eaaCtx.config().Certs.ServerCertPath,
+		eaaCtx.config().Certs.ServerKeyPath); err != http.ErrServerClosed {
 		log.Errf("server.Serve error: %#v", err)
 		goto cleanup
 	} else {
@@ -200,10 +364,35 @@ cleanup:
 			err = errors.Wrap(err, cleanupErr.Error())
 		}
 	}
+	if !waitForMessageHandlers(shutdownDrainTimeout(eaaCtx), eaaCtx) {
+		log.Warningf("Message Broker handlers not finished in %v",
+			shutdownDrainTimeout(eaaCtx))
+	}
 
 	return err
 }
 
+// newMsgBroker creates a Message Broker of the type set in the EAA config
+func newMsgBroker(eaaCtx *Context) (msgBroker, error) {
+	switch eaaCtx.config().MsgBroker.Type {
+	case "", msgBrokerTypeKafka:
+		kafkaTLSConfig, err := newKafkaTLSConfig(eaaCtx.config().Certs.KafkaUserCertPath,
+			eaaCtx.config().Certs.KafkaUserKeyPath, eaaCtx.config().Certs.KafkaCAPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to create a Kafka TLS config")
+		}
+
+		// Each EAA instance should be in a different Consumer Group to get all Service Updates
+		instanceID := uuid.New()
+		return NewKafkaMsgBroker(eaaCtx, "EAA_"+instanceID.String(), kafkaTLSConfig)
+	case msgBrokerTypeGoChannels:
+		return NewGoChannelMsgBroker(eaaCtx), nil
+	default:
+		return nil, errors.Errorf("Unknown Message Broker type: %v",
+			eaaCtx.config().MsgBroker.Type)
+	}
+}
+
 // Run start EAA
 func Run(parentCtx context.Context, cfgPath string) error {
 	var eaaCtx Context
@@ -214,21 +403,47 @@ func Run(parentCtx context.Context, cfgPath string) error {
 		return err
 	}
 
-	kafkaTLSConfig, err := newKafkaTLSConfig(eaaCtx.cfg.Certs.KafkaUserCertPath,
-		eaaCtx.cfg.Certs.KafkaUserKeyPath, eaaCtx.cfg.Certs.KafkaCAPath)
+	msgBrokerCtx, err := newMsgBroker(&eaaCtx)
 	if err != nil {
-		log.Errf("Failed to create a Kafka Message Broker: %#v", err)
+		log.Errf("Failed to create a Message Broker: %#v", err)
 		return err
 	}
+	eaaCtx.MsgBrokerCtx = msgBrokerCtx
 
-	// Each EAA instance should be in a different Consumer Group to get all Service Updates
-	instanceID := uuid.New()
-	msgBrokerCtx, err := NewKafkaMsgBroker(&eaaCtx, "EAA_"+instanceID.String(), kafkaTLSConfig)
+	eaaCtx.subscriptionStore, err = newSubscriptionStore(eaaCtx.config().SubscriptionStore)
 	if err != nil {
-		log.Errf("Failed to create a Kafka Message Broker: %#v", err)
+		log.Errf("Failed to create a subscription store: %#v", err)
 		return err
 	}
-	eaaCtx.MsgBrokerCtx = msgBrokerCtx
+	defer func() {
+		if storeErr := eaaCtx.subscriptionStore.close(); storeErr != nil {
+			log.Errf("Failed to close the subscription store: %#v", storeErr)
+		}
+	}()
+	if err = restoreSubscriptions(&eaaCtx); err != nil {
+		log.Errf("Failed to restore subscriptions: %#v", err)
+		return err
+	}
+
+	eaaCtx.serviceStore, err = newServiceStore(eaaCtx.config().ServiceStore)
+	if err != nil {
+		log.Errf("Failed to create a service store: %#v", err)
+		return err
+	}
+	defer func() {
+		if storeErr := eaaCtx.serviceStore.close(); storeErr != nil {
+			log.Errf("Failed to close the service store: %#v", storeErr)
+		}
+	}()
+	if err = restoreServices(&eaaCtx); err != nil {
+		log.Errf("Failed to restore services: %#v", err)
+		return err
+	}
+
+	stopTracing := startTracing(eaaCtx.config().Tracing)
+	defer stopTracing()
+
+	go reloadConfigOnSignal(parentCtx, &eaaCtx)
 
 	return RunServer(parentCtx, &eaaCtx)
 }
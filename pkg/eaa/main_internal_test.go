@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("newMsgBroker", func() {
+	var eaaCtx *Context
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+	})
+
+	g.It("Creates a GoChannel broker when configured", func() {
+		eaaCtx.cfg.MsgBroker.Type = msgBrokerTypeGoChannels
+
+		broker, err := newMsgBroker(eaaCtx)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(broker).Should(BeAssignableToTypeOf(&GoChannelMsgBroker{}))
+	})
+
+	g.It("Fails for an unknown broker type", func() {
+		eaaCtx.cfg.MsgBroker.Type = "carrier-pigeon"
+
+		broker, err := newMsgBroker(eaaCtx)
+		Expect(err).Should(HaveOccurred())
+		Expect(broker).Should(BeNil())
+	})
+
+	g.It("Fails for Kafka when TLS certificates are missing", func() {
+		eaaCtx.cfg.MsgBroker.Type = msgBrokerTypeKafka
+
+		_, err := newMsgBroker(eaaCtx)
+		Expect(err).Should(HaveOccurred())
+	})
+})
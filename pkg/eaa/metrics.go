@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// metricsRegistry holds all EAA metrics exposed on the metrics endpoint
+	metricsRegistry = prometheus.NewRegistry()
+
+	registrationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "registrations_total",
+		Help:      "Number of processed service registrations.",
+	})
+	deregistrationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "deregistrations_total",
+		Help:      "Number of processed service deregistrations.",
+	})
+	notificationsPublishedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_published_total",
+		Help:      "Number of notifications published by producers.",
+	}, []string{"namespace"})
+	notificationsDeliveredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_delivered_total",
+		Help:      "Number of notifications delivered to consumers.",
+	}, []string{"namespace"})
+	notificationsDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_dropped_total",
+		Help:      "Number of notifications dropped from full consumer send queues.",
+	})
+	notificationsDroppedStaleTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_dropped_stale_total",
+		Help:      "Number of notifications dropped because their deadline passed before delivery.",
+	})
+	notificationsRedeliveredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_redelivered_total",
+		Help:      "Number of at-least-once notifications redelivered for a missing ack.",
+	})
+	notificationsUnackedDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_unacked_dropped_total",
+		Help:      "Number of at-least-once notifications given up on as too many awaited the ack.",
+	})
+	notificationAckLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "eaa",
+		Name:      "notification_ack_latency_seconds",
+		Help:      "Time from sending a notification to a consumer until it's acknowledged.",
+	})
+	ackBacklogExceededTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "consumer_ack_backlog_exceeded_total",
+		Help:      "Number of times a consumer's unacked notifications reached the limit.",
+	}, []string{"policy"})
+	notificationsDeadLetteredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notifications_dead_lettered_total",
+		Help:      "Number of undeliverable notifications captured by the dead-letter sink.",
+	}, []string{"reason"})
+	notificationBatchesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "notification_batches_total",
+		Help:      "Number of batches of aggregated notifications delivered.",
+	})
+	webhookDeliveriesFailedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "webhook_deliveries_failed_total",
+		Help:      "Number of notifications not delivered to consumer webhooks after the retries.",
+	})
+	websocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "eaa",
+		Name:      "websocket_connections",
+		Help:      "Number of consumer WebSocket connections.",
+	})
+	nodeNotificationUtilization = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "eaa",
+		Name:      "node_notification_limit_utilization",
+		Help:      "Share of the node-wide notification burst in use as of the last push, from 0 to 1.",
+	})
+	nodeNotificationRejectionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "node_notification_limit_rejections_total",
+		Help:      "Number of notifications rejected by the node-wide notification limit.",
+	})
+	brokerCircuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "eaa",
+		Name:      "broker_circuit_breaker_state",
+		Help:      "State of the Message Broker circuit breaker: 0 closed, 1 open, 2 half-open.",
+	})
+	brokerCircuitRejectionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eaa",
+		Name:      "broker_circuit_breaker_rejections_total",
+		Help:      "Number of publishes rejected by the open Message Broker circuit breaker.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		registrationsTotal,
+		deregistrationsTotal,
+		notificationsPublishedTotal,
+		notificationsDeliveredTotal,
+		notificationsDroppedTotal,
+		notificationsDroppedStaleTotal,
+		notificationsRedeliveredTotal,
+		notificationsUnackedDroppedTotal,
+		notificationAckLatency,
+		ackBacklogExceededTotal,
+		notificationBatchesTotal,
+		notificationsDeadLetteredTotal,
+		webhookDeliveriesFailedTotal,
+		websocketConnections,
+		nodeNotificationUtilization,
+		nodeNotificationRejectionsTotal,
+		brokerCircuitState,
+		brokerCircuitRejectionsTotal,
+	)
+}
+
+// runMetricsServer serves the metrics on a plain HTTP endpoint separate from
+// the mutual TLS EAA endpoint until the parent context is done
+func runMetricsServer(parentCtx context.Context, endpoint string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry,
+		promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: endpoint, Handler: mux}
+
+	go func() {
+		<-parentCtx.Done()
+		if err := server.Close(); err != nil {
+			log.Errf("Could not close metrics server: %#v", err)
+		}
+	}()
+
+	log.Infof("Serving EAA metrics on: %s", endpoint)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Errf("Metrics server error: %#v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// scrapeMetric gathers the metrics registry and returns the value of the
+// counter or gauge with the given name and namespace label. An empty
+// namespace matches an unlabeled metric.
+func scrapeMetric(name string, namespace string) float64 {
+	families, err := metricsRegistry.Gather()
+	Expect(err).ShouldNot(HaveOccurred())
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			matches := namespace == ""
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "namespace" && label.GetValue() == namespace {
+					matches = true
+				}
+			}
+			if !matches {
+				continue
+			}
+			if m.GetGauge() != nil {
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+var _ = g.Describe("metrics", func() {
+	const producer = "metrics-ns:producer"
+
+	var eaaCtx *Context
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo = services{m: make(map[string]Service),
+			renewed: make(map[string]time.Time)}
+		eaaCtx.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		eaaCtx.subscriptionInfo = NotificationSubscriptions{
+			m: make(map[UniqueNotif]*ConsumerSubscription)}
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic, nil)).
+			To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("registers all EAA metrics", func() {
+		Expect(testutil.CollectAndCount(registrationsTotal)).To(Equal(1))
+		Expect(testutil.CollectAndCount(deregistrationsTotal)).To(Equal(1))
+		Expect(testutil.CollectAndCount(websocketConnections)).To(Equal(1))
+	})
+
+	g.It("counts registrations and deregistrations", func() {
+		registrations := scrapeMetric("eaa_registrations_total", "")
+		deregistrations := scrapeMetric("eaa_deregistrations_total", "")
+
+		RegisterApplication(httptest.NewRecorder(), newTLSRequest("POST", "/services",
+			`{"endpoint_uri":"https://1.2.3.4"}`, producer, eaaCtx))
+		Expect(scrapeMetric("eaa_registrations_total", "")).To(Equal(registrations + 1))
+
+		eaaCtx.serviceInfo.m[producer] = Service{}
+		DeregisterApplication(httptest.NewRecorder(), newTLSRequest("DELETE", "/services",
+			"", producer, eaaCtx))
+		Expect(scrapeMetric("eaa_deregistrations_total", "")).To(Equal(deregistrations + 1))
+	})
+
+	g.It("counts notifications published and delivered per namespace", func() {
+		published := scrapeMetric("eaa_notifications_published_total", "metrics-ns")
+		delivered := scrapeMetric("eaa_notifications_delivered_total", "metrics-ns")
+		eaaCtx.serviceInfo.m[producer] = Service{}
+
+		g.By("connecting a consumer websocket")
+		var consumer string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			consumer = r.Host
+			tlsReq := newTLSRequest("GET", "/notifications", "", consumer, eaaCtx)
+			r.TLS = tlsReq.TLS
+			_, _, err := createWsConn(w, r.WithContext(tlsReq.Context()))
+			Expect(err).ShouldNot(HaveOccurred())
+		}))
+		defer server.Close()
+
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+		Expect(scrapeMetric("eaa_websocket_connections", "")).To(Equal(1.0))
+
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"metrics-ns", "name", "1.0"}] =
+			&ConsumerSubscription{namespaceSubscriptions: SubscriberIds{consumer}}
+		// Nothing is subscribed to the notifications topic to report the delivery
+		eaaCtx.cfg.DeliveryReportTimeout.Duration = time.Millisecond
+
+		g.By("pushing a notification")
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"name","version":"1.0"}`, producer, eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		Expect(scrapeMetric("eaa_notifications_published_total", "metrics-ns")).To(
+			Equal(published + 1))
+
+		g.By("delivering the notification")
+		summary, err := sendNotificationToAllSubscribers(producer,
+			&NotificationFromProducer{Name: "name", Version: "1.0"}, "", eaaCtx)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(summary).To(Equal(DeliverySummary{Subscribers: 1, Delivered: 1}))
+		_, _, err = conn.ReadMessage()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(scrapeMetric("eaa_notifications_delivered_total", "metrics-ns")).To(
+			Equal(delivered + 1))
+	})
+})
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+)
+
+// mqttTimeout bounds waiting for the MQTT broker to acknowledge an operation
+const mqttTimeout = 5 * time.Second
+
+// mqttClient is the part of mqtt.Client used by the bridge
+type mqttClient interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+	Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token
+	Disconnect(quiesce uint)
+}
+
+// mqttBridge pushes messages of external MQTT topics to EAA as notifications
+// and forwards EAA notifications to MQTT topics. Each EAA instance with the
+// bridge enabled forwards the notifications it receives.
+type mqttBridge struct {
+	client mqttClient
+	cfg    MQTTBridgeInfo
+	eaaCtx *Context
+}
+
+// newMQTTClient connects to the MQTT broker of the bridge config
+func newMQTTClient(cfg MQTTBridgeInfo) (mqtt.Client, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetAutoReconnect(true).
+		SetConnectTimeout(mqttTimeout)
+
+	if cfg.CertPath != "" {
+		tlsConfig, err := newKafkaTLSConfig(cfg.CertPath, cfg.KeyPath, cfg.CAPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to create an MQTT TLS config")
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		return nil, errors.Errorf("Timeout connecting to MQTT broker %s", cfg.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to MQTT broker %s", cfg.Broker)
+	}
+
+	return client, nil
+}
+
+// waitMQTTToken waits for an MQTT operation to complete
+func waitMQTTToken(token mqtt.Token) error {
+	if !token.WaitTimeout(mqttTimeout) {
+		return errors.New("Timeout waiting for the MQTT broker")
+	}
+	return token.Error()
+}
+
+// start registers the producers of inbound routes, subscribes to their
+// MQTT topics and to the EAA namespaces of outbound routes
+func (b *mqttBridge) start() error {
+	for _, route := range b.cfg.Inbound {
+		route := route
+		if err := b.registerProducer(route); err != nil {
+			return err
+		}
+
+		err := waitMQTTToken(b.client.Subscribe(route.Topic, b.cfg.QoS,
+			func(_ mqtt.Client, msg mqtt.Message) {
+				b.handleInbound(route, msg.Payload())
+			}))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to subscribe to MQTT topic %s", route.Topic)
+		}
+	}
+
+	for _, route := range b.cfg.Outbound {
+		if err := addNotificationSubscriber(route.Producer.Namespace, nil,
+			b.eaaCtx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerProducer registers the producer of an inbound route with
+// the notification it pushes, or refreshes its registration
+func (b *mqttBridge) registerProducer(route MQTTInboundRoute) error {
+	notif := route.Notification
+	notif.Filter = nil
+	notif.Transform = nil
+	notif.NameMatch = ""
+	notif.QoS = ""
+	notif.AggregationWindow = 0
+
+	serv := Service{
+		URN:           &URN{ID: route.Producer.ID, Namespace: route.Producer.Namespace},
+		Description:   "MQTT topic " + route.Topic,
+		EndpointURI:   b.cfg.Broker,
+		Notifications: []NotificationDescriptor{notif},
+	}
+	if err := validateService(&serv); err != nil {
+		return errors.Wrapf(err, "Invalid producer of MQTT topic %s", route.Topic)
+	}
+
+	ctx, cancel := withPublishTimeout(context.Background(), b.eaaCtx)
+	defer cancel()
+	return publishServiceMessage(ctx, serv.URN.String(),
+		ServiceMessage{Svc: &serv, Action: serviceActionRegister}, b.eaaCtx)
+}
+
+// handleInbound pushes a message of an MQTT topic to EAA. Payloads which
+// aren't JSON are pushed as JSON strings.
+func (b *mqttBridge) handleInbound(route MQTTInboundRoute, payload []byte) {
+	if !json.Valid(payload) {
+		var err error
+		if payload, err = json.Marshal(string(payload)); err != nil {
+			log.Errf("MQTT bridge: failed to encode payload of %s: %s", route.Topic,
+				err.Error())
+			return
+		}
+	}
+
+	// MQTT messages can't be signed
+	if isSignedNamespace(route.Producer.Namespace, b.eaaCtx) {
+		log.Errf("MQTT bridge: notifications of %s have to be signed, message of %s dropped",
+			route.Producer.Namespace, route.Topic)
+		return
+	}
+
+	notif := NotificationFromProducer{
+		Name:    route.Notification.Name,
+		Version: route.Notification.Version,
+		Payload: payload,
+	}
+	ctx, cancel := withPublishTimeout(context.Background(), b.eaaCtx)
+	defer cancel()
+	if err := publishNotification(ctx, route.Producer, &notif, "", newCorrelationID(),
+		b.eaaCtx); err != nil {
+		log.Errf("MQTT bridge: failed to push notification of %s: %s", route.Topic,
+			err.Error())
+	}
+}
+
+// forward publishes the payload of an EAA notification to the MQTT topics
+// of the matching outbound routes
+func (b *mqttBridge) forward(producer URN, notif *NotificationFromProducer) {
+	if b == nil {
+		return
+	}
+
+	// Don't echo notifications pushed by the bridge itself
+	for _, route := range b.cfg.Inbound {
+		if route.Producer.Equals(producer) {
+			return
+		}
+	}
+
+	for _, route := range b.cfg.Outbound {
+		if !producer.Matches(route.Producer) ||
+			route.Notification.Name != notif.Name ||
+			route.Notification.Version != notif.Version {
+			continue
+		}
+
+		token := b.client.Publish(route.Topic, b.cfg.QoS, false, []byte(notif.Payload))
+		go func(topic string) {
+			if err := waitMQTTToken(token); err != nil {
+				log.Errf("MQTT bridge: failed to publish to %s: %s", topic, err.Error())
+			}
+		}(route.Topic)
+	}
+}
+
+// runMQTTBridge renews the registrations of inbound producers every
+// HeartbeatInterval until the context is done, they aren't renewed if
+// the interval is 0
+func runMQTTBridge(parentCtx context.Context, bridge *mqttBridge) {
+	if err := bridge.start(); err != nil {
+		log.Errf("MQTT bridge: %s", err.Error())
+	}
+
+	// A nil channel never fires
+	var tick <-chan time.Time
+	if interval := bridge.eaaCtx.config().HeartbeatInterval.Duration; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			for _, route := range bridge.cfg.Inbound {
+				if err := bridge.registerProducer(route); err != nil {
+					log.Errf("MQTT bridge: %s", err.Error())
+				}
+			}
+		case <-parentCtx.Done():
+			bridge.client.Disconnect(uint(mqttTimeout / time.Millisecond))
+			return
+		}
+	}
+}
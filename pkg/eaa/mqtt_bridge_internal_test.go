@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeMQTTToken is an MQTT token of a completed operation
+type fakeMQTTToken struct{}
+
+func (fakeMQTTToken) Wait() bool                     { return true }
+func (fakeMQTTToken) WaitTimeout(time.Duration) bool { return true }
+func (fakeMQTTToken) Error() error                   { return nil }
+
+// fakeMQTTMessage is a publication to fakeMQTTClient
+type fakeMQTTMessage struct {
+	topic   string
+	payload []byte
+}
+
+// fakeMQTTClient records publications and subscriptions of the bridge
+type fakeMQTTClient struct {
+	sync.Mutex
+	published []fakeMQTTMessage
+	handlers  map[string]mqtt.MessageHandler
+}
+
+func (c *fakeMQTTClient) Publish(topic string, _ byte, _ bool,
+	payload interface{}) mqtt.Token {
+	c.Lock()
+	defer c.Unlock()
+	c.published = append(c.published, fakeMQTTMessage{topic, payload.([]byte)})
+	return fakeMQTTToken{}
+}
+
+func (c *fakeMQTTClient) Subscribe(topic string, _ byte,
+	callback mqtt.MessageHandler) mqtt.Token {
+	c.Lock()
+	defer c.Unlock()
+	c.handlers[topic] = callback
+	return fakeMQTTToken{}
+}
+
+func (c *fakeMQTTClient) Disconnect(uint) {}
+
+func (c *fakeMQTTClient) getPublished() []fakeMQTTMessage {
+	c.Lock()
+	defer c.Unlock()
+	return append([]fakeMQTTMessage(nil), c.published...)
+}
+
+// fakeMQTTInbound is a message received from an MQTT topic
+type fakeMQTTInbound struct {
+	mqtt.Message
+	payload []byte
+}
+
+func (m fakeMQTTInbound) Payload() []byte { return m.payload }
+
+// fakeNotificationConn records messages sent to a consumer
+type fakeNotificationConn struct {
+	sent chan []byte
+}
+
+func (c *fakeNotificationConn) WriteMessage(_ int, data []byte) error {
+	c.sent <- data
+	return nil
+}
+
+func (c *fakeNotificationConn) WriteControl(int, []byte, time.Time) error {
+	return nil
+}
+
+func (c *fakeNotificationConn) Close() error { return nil }
+
+var _ = g.Describe("MQTT bridge", func() {
+	var (
+		eaaCtx *Context
+		client *fakeMQTTClient
+		bridge *mqttBridge
+	)
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.serviceInfo.renewed = make(map[string]time.Time)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(eaaCtx.MsgBrokerCtx.addPublisher(servicesPublisher, servicesTopic,
+			nil)).To(Succeed())
+		Expect(eaaCtx.MsgBrokerCtx.addSubscriber(servicesSubscriber, servicesTopic,
+			nil)).To(Succeed())
+
+		client = &fakeMQTTClient{handlers: make(map[string]mqtt.MessageHandler)}
+		bridge = &mqttBridge{
+			client: client,
+			eaaCtx: eaaCtx,
+			cfg: MQTTBridgeInfo{
+				Broker: "tcp://mqtt:1883",
+				Inbound: []MQTTInboundRoute{{
+					Topic:        "sensors/+/temp",
+					Producer:     URN{ID: "sensors", Namespace: "mqtt"},
+					Notification: NotificationDescriptor{Name: "temp", Version: "1.0"},
+				}},
+				Outbound: []MQTTOutboundRoute{{
+					Producer:     URN{Namespace: "ns"},
+					Notification: NotificationDescriptor{Name: "alarm", Version: "1.0"},
+					Topic:        "eaa/alarms",
+				}},
+			},
+		}
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("pushes messages of inbound topics as notifications", func() {
+		Expect(bridge.start()).To(Succeed())
+		Expect(client.handlers).To(HaveKey("sensors/+/temp"))
+
+		Eventually(func() bool {
+			eaaCtx.serviceInfo.RLock()
+			defer eaaCtx.serviceInfo.RUnlock()
+			_, found := eaaCtx.serviceInfo.m["mqtt:sensors"]
+			return found
+		}).Should(BeTrue())
+
+		conn := &fakeNotificationConn{sent: make(chan []byte, 1)}
+		eaaCtx.consumerConnections.Lock()
+		eaaCtx.consumerConnections.m["mqtt:consumer"] = []ConsumerConnection{{
+			connection: conn}}
+		eaaCtx.consumerConnections.Unlock()
+		// The services topic handler reads the subscriptions meanwhile
+		eaaCtx.subscriptionInfo.Lock()
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"mqtt", "temp", "1.0"}] =
+			&ConsumerSubscription{
+				namespaceSubscriptions: SubscriberIds{"mqtt:consumer"},
+				serviceSubscriptions:   make(map[string]SubscriberIds),
+			}
+		eaaCtx.subscriptionInfo.Unlock()
+		Expect(addNotificationSubscriber("mqtt", nil, eaaCtx)).To(Succeed())
+
+		client.handlers["sensors/+/temp"](nil, fakeMQTTInbound{payload: []byte("21.5 C")})
+
+		var data []byte
+		Eventually(conn.sent).Should(Receive(&data))
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(data, &notif)).To(Succeed())
+		Expect(notif.Name).To(Equal("temp"))
+		Expect(notif.URN).To(Equal(URN{ID: "sensors", Namespace: "mqtt"}))
+		Expect(notif.Payload).To(MatchJSON(`"21.5 C"`))
+	})
+
+	g.It("forwards matching notifications to outbound topics", func() {
+		bridge.forward(URN{ID: "p1", Namespace: "ns"}, &NotificationFromProducer{
+			Name: "alarm", Version: "1.0", Payload: json.RawMessage(`{"level":3}`)})
+		bridge.forward(URN{ID: "p1", Namespace: "ns"}, &NotificationFromProducer{
+			Name: "alarm", Version: "2.0", Payload: json.RawMessage(`{}`)})
+		bridge.forward(URN{ID: "p1", Namespace: "other"}, &NotificationFromProducer{
+			Name: "alarm", Version: "1.0", Payload: json.RawMessage(`{}`)})
+
+		published := client.getPublished()
+		Expect(published).To(HaveLen(1))
+		Expect(published[0].topic).To(Equal("eaa/alarms"))
+		Expect(published[0].payload).To(MatchJSON(`{"level":3}`))
+	})
+
+	g.It("doesn't echo notifications of inbound producers", func() {
+		bridge.cfg.Outbound[0].Producer = URN{Namespace: "mqtt"}
+		bridge.cfg.Outbound[0].Notification.Name = "temp"
+
+		bridge.forward(URN{ID: "sensors", Namespace: "mqtt"}, &NotificationFromProducer{
+			Name: "temp", Version: "1.0", Payload: json.RawMessage(`1`)})
+		Expect(client.getPublished()).To(BeEmpty())
+	})
+
+	g.It("runs without a HeartbeatInterval", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer g.GinkgoRecover()
+			defer close(done)
+			runMQTTBridge(ctx, bridge)
+		}()
+
+		Eventually(func() int {
+			client.Lock()
+			defer client.Unlock()
+			return len(client.handlers)
+		}).Should(Equal(1))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	g.It("is a no-op when disabled", func() {
+		var disabled *mqttBridge
+		Expect(func() {
+			disabled.forward(URN{ID: "p1", Namespace: "ns"}, &NotificationFromProducer{})
+		}).ToNot(Panic())
+	})
+})
@@ -4,9 +4,14 @@
 package eaa
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 )
@@ -37,10 +42,13 @@ const (
 	servicesPublisher publisherType = iota
 	// Services Publisher is used to post Client Notification (de)registrations
 	clientPublisher
+	// Dead Letter Publisher is used to post undeliverable Notifications
+	deadLetterPublisher
 )
 
 func (p publisherType) String() string {
-	return [...]string{"Notification Publisher", "Services Publisher", "Client Publisher"}[p]
+	return [...]string{"Notification Publisher", "Services Publisher", "Client Publisher",
+		"Dead Letter Publisher"}[p]
 }
 
 // Subscriber type enum
@@ -68,9 +76,111 @@ type objectAlreadyExistsError struct {
 // msgBroker specifies the Message Broker interface.
 type msgBroker interface {
 	addPublisher(t publisherType, topic string, r *http.Request) error
-	publish(topic string, msg *message.Message) error
+	// publish returns the context error if the context is done before
+	// the message is published
+	publish(ctx context.Context, topic string, msg *message.Message) error
 	addSubscriber(t subscriberType, topic string, r *http.Request) error
 	removeAll() error
+	// ping checks if the Message Broker is reachable
+	ping() error
+}
+
+// publishWithContext runs publish and returns the context error if
+// the context is done first. Watermill publishers can't be cancelled,
+// so the abandoned publish goes on in the background.
+func publishWithContext(ctx context.Context, publish func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- publish()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// defaultBrokerPublishRetryDelay is the delay before the first retry of
+// a failed publish if BrokerPublishRetryDelay is not set
+const defaultBrokerPublishRetryDelay = 100 * time.Millisecond
+
+// maxBrokerPublishRetryDelay caps the exponential backoff of publish retries
+const maxBrokerPublishRetryDelay = 5 * time.Second
+
+// publishRetriesError is returned when all attempts to publish a message
+// to the Message Broker failed
+type publishRetriesError struct {
+	attempts int
+	err      error
+}
+
+func (e *publishRetriesError) Error() string {
+	return fmt.Sprintf("all %d publish attempts failed, last error: %v", e.attempts, e.err)
+}
+
+func (e *publishRetriesError) Unwrap() error {
+	return e.err
+}
+
+// publishRetryDelay returns the backoff before the retry following
+// the attempt, doubled with every attempt and jittered by up to a half
+func publishRetryDelay(attempt int, eaaCtx *Context) time.Duration {
+	delay := eaaCtx.config().BrokerPublishRetryDelay.Duration
+	if delay <= 0 {
+		delay = defaultBrokerPublishRetryDelay
+	}
+	for i := 1; i < attempt && delay < maxBrokerPublishRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxBrokerPublishRetryDelay {
+		delay = maxBrokerPublishRetryDelay
+	}
+	// #nosec G404 - the jitter only spreads retries of EAA instances
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// publishWithRetry publishes the message and retries a failed publish with
+// exponential backoff up to BrokerPublishAttempts times. It gives up with
+// the context error as soon as the context is done and doesn't retry
+// a publish rejected by the open circuit breaker.
+func publishWithRetry(ctx context.Context, topic string, msg *message.Message,
+	eaaCtx *Context) error {
+
+	attempts := eaaCtx.config().BrokerPublishAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := publishMessage(ctx, topic, msg, eaaCtx)
+		if err == nil || ctx.Err() != nil || isBrokerCircuitOpen(err) {
+			return err
+		}
+		if attempt == attempts {
+			if attempts == 1 {
+				return err
+			}
+			return &publishRetriesError{attempts: attempts, err: err}
+		}
+
+		delay := publishRetryDelay(attempt, eaaCtx)
+		log.Warningf("Publish attempt %d of %d to %s failed, retrying in %v: %v",
+			attempt, attempts, topic, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
 }
 
 // --------
@@ -101,9 +211,24 @@ func handleNotificationUpdates(messages <-chan *message.Message, eaaCtx *Context
 			continue
 		}
 
-		err = sendNotificationToAllSubscribers(notifMsg.URN.String(), notifMsg.Notification, eaaCtx)
+		// Messages of EAA instances not propagating the ID get a new one
+		correlationID := msg.Metadata.Get(correlationIDMetadataKey)
+		if correlationID == "" {
+			correlationID = newCorrelationID()
+		}
+		log.Debugf("Received notification %s from %s", correlationID,
+			notifMsg.URN.String())
+
+		notifMsg.Notification.receivedAt = notifMsg.ReceivedAt
+		ctx, span := startDeliverySpan(msg, *notifMsg.URN, correlationID)
+		summary, err := sendNotificationToAllSubscribers(notifMsg.URN.String(),
+			notifMsg.Notification, correlationID, eaaCtx)
+		endDeliverySpan(ctx, span, summary, err)
+		eaaCtx.deliveryReports.report(notifMsg.DeliveryID, summary)
 		if err != nil {
 			log.Errf("Error in Publish Notification: %s", err.Error())
+		} else {
+			eaaCtx.mqttBridge.forward(*notifMsg.URN, notifMsg.Notification)
 		}
 
 		msg.Ack()
@@ -114,6 +239,8 @@ func handleNotificationUpdates(messages <-chan *message.Message, eaaCtx *Context
 // All messages from servicesSubscriber topic should be handled by this callback.
 func handleServiceUpdates(messages <-chan *message.Message, eaaCtx *Context) {
 	log.Info("handleServiceUpdates() starts")
+	atomic.StoreInt32(&eaaCtx.servicesSubscriberRunning, 1)
+	defer atomic.StoreInt32(&eaaCtx.servicesSubscriberRunning, 0)
 	for msg := range messages {
 		log.Debugf("received service message: %s, payload: %s", msg.UUID, string(msg.Payload))
 
@@ -125,6 +252,11 @@ func handleServiceUpdates(messages <-chan *message.Message, eaaCtx *Context) {
 			continue
 		}
 
+		if svcMsg.Action == serviceActionSelfTest {
+			eaaCtx.selfTests.report(svcMsg.SelfTestID)
+			msg.Ack()
+			continue
+		}
 		if svcMsg.Svc == nil {
 			log.Err("Error: ServiceMessage.Svc is nil")
 			msg.Ack()
@@ -139,12 +271,68 @@ func handleServiceUpdates(messages <-chan *message.Message, eaaCtx *Context) {
 
 		switch svcMsg.Action {
 		case serviceActionRegister:
+			// Renewals are registrations of already registered services
+			eaaCtx.serviceInfo.RLock()
+			renewal := isServicePresent(commonName, eaaCtx)
+			err = checkRegistrationOwner(commonName, svcMsg.Owner, eaaCtx)
+			eaaCtx.serviceInfo.RUnlock()
+			if err != nil {
+				log.Warningf("Register Application rejected: %s", err.Error())
+				break
+			}
+
 			if err = addService(commonName, *svcMsg.Svc, eaaCtx); err != nil {
 				log.Errf("Register Application error: %s", err.Error())
+				break
+			}
+			setRegistrationOwner(commonName, svcMsg.Owner, eaaCtx)
+			if !renewal {
+				sendDiscoveryEvent(*svcMsg.Svc.URN, serviceActionRegister, eaaCtx)
+			}
+			if isNamespaceWildcardSubscribed(svcMsg.Svc.URN.Namespace, eaaCtx) {
+				// Consumers subscribed with a namespace pattern should also get
+				// notifications from namespaces registered after the subscription
+				err = addNotificationSubscriber(svcMsg.Svc.URN.Namespace, nil, eaaCtx)
+				if err != nil {
+					log.Errf("Wildcard Namespace Subscription error: %s", err.Error())
+				}
+			}
+		case serviceActionUpdate:
+			// The URN, and thus the namespace, of an updated service is
+			// unchanged, so only the stored service has to be merged
+			// or replaced
+			eaaCtx.serviceInfo.RLock()
+			err = checkRegistrationOwner(commonName, svcMsg.Owner, eaaCtx)
+			eaaCtx.serviceInfo.RUnlock()
+			if err != nil {
+				log.Warningf("Update Application rejected: %s", err.Error())
+				break
+			}
+			if svcMsg.Update != nil {
+				err = updateService(commonName, *svcMsg.Update, eaaCtx)
+				if err != nil {
+					log.Errf("Update Application error: %s", err.Error())
+				}
+				break
+			}
+			if err = addService(commonName, *svcMsg.Svc, eaaCtx); err != nil {
+				log.Errf("Update Application error: %s", err.Error())
+				break
 			}
+			setRegistrationOwner(commonName, svcMsg.Owner, eaaCtx)
 		case serviceActionDeregister:
+			eaaCtx.serviceInfo.RLock()
+			err = checkRegistrationOwner(commonName, svcMsg.Owner, eaaCtx)
+			eaaCtx.serviceInfo.RUnlock()
+			if err != nil {
+				log.Warningf("Deregister Application rejected: %s", err.Error())
+				break
+			}
 			if err = removeService(commonName, eaaCtx); err != nil {
 				log.Errf("Deregister Application error: %s", err.Error())
+			} else {
+				sendDiscoveryEvent(*svcMsg.Svc.URN, serviceActionDeregister, eaaCtx)
+				closeOrphanedConsumerConnections(*svcMsg.Svc.URN, eaaCtx)
 			}
 		default:
 			log.Errf("Unknown Service Action: %v", svcMsg.Action)
@@ -200,6 +388,10 @@ func handleClientUpdates(messages <-chan *message.Message, eaaCtx *Context) {
 		case subscriptionActionUnsubscribe:
 			unsubscribeClient(&subscriptionMsg, clientCommonName, namespace, serviceID, subs,
 				eaaCtx)
+		case subscriptionActionRenew:
+			eaaCtx.subscriptionLeases.renew(clientCommonName, time.Now())
+		case subscriptionActionExpire:
+			expireClient(&subscriptionMsg, clientCommonName, namespace, serviceID, eaaCtx)
 		default:
 			log.Errf("Unknown SubscriptionMessage Action: %v", subscriptionMsg.Action)
 		}
@@ -212,6 +404,13 @@ func handleClientUpdates(messages <-chan *message.Message, eaaCtx *Context) {
 func subscribeClient(subscriptionMsg *SubscriptionMessage, clientCommonName string,
 	namespace string, serviceID string, subs []NotificationDescriptor, eaaCtx *Context) {
 
+	// Validate before removing the previous subscriptions, so that an invalid
+	// request leaves them untouched
+	if err := validateSubscriptionNotifications(subs); err != nil {
+		log.Errf("Invalid subscription of %s: %s", clientCommonName, err.Error())
+		return
+	}
+
 	switch subscriptionMsg.Scope {
 	case subscriptionScopeNamespace:
 		// Remove all previous subscriptions to the Namespace notifs
@@ -238,7 +437,34 @@ func subscribeClient(subscriptionMsg *SubscriptionMessage, clientCommonName stri
 		}
 	default:
 		log.Errf("Unknown SubscriptionMessage Scope: %v", subscriptionMsg.Scope)
+		return
+	}
+
+	// The lease covers the subscriptions replaced above only
+	eaaCtx.subscriptionLeases.set(leaseKey{clientCommonName, namespace, serviceID},
+		subscriptionLeaseDuration(subscriptionMsg.Lease, eaaCtx), time.Now())
+}
+
+// expireClient removes the subscriptions of the consumer to the namespace
+// or the service whose lease expired
+func expireClient(subscriptionMsg *SubscriptionMessage, clientCommonName string,
+	namespace string, serviceID string, eaaCtx *Context) {
+
+	var err error
+	switch subscriptionMsg.Scope {
+	case subscriptionScopeNamespace:
+		err = removeAllSubscriptionsToNamespace(clientCommonName, namespace, eaaCtx)
+	case subscriptionScopeService:
+		err = removeAllSubscriptionsToService(clientCommonName, namespace, serviceID, eaaCtx)
+	default:
+		log.Errf("Unknown SubscriptionMessage Scope: %v", subscriptionMsg.Scope)
+		return
+	}
+	if err != nil {
+		log.Errf("Failed to remove the expired subscriptions of %s: %s", clientCommonName,
+			err.Error())
 	}
+	eaaCtx.subscriptionLeases.remove(leaseKey{clientCommonName, namespace, serviceID})
 }
 
 func unsubscribeClient(subscriptionMsg *SubscriptionMessage, clientCommonName string,
@@ -261,6 +487,9 @@ func unsubscribeClient(subscriptionMsg *SubscriptionMessage, clientCommonName st
 		if err != nil {
 			log.Errf("removeAllSubscriptions() error: %s", err.Error())
 		}
+		eaaCtx.replayBuffers.remove(clientCommonName)
+		eaaCtx.unackedNotifs.remove(clientCommonName)
+		eaaCtx.subscriptionLeases.removeConsumer(clientCommonName)
 	default:
 		log.Errf("Unknown SubscriptionMessage Scope: %v", subscriptionMsg.Scope)
 	}
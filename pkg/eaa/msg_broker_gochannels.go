@@ -18,6 +18,15 @@ import (
 type goChannel struct {
 	ch          *gochannel.GoChannel
 	isPublisher bool
+	// queue of the messages to publish in order, notification topics only
+	queue chan queuedPublish
+}
+
+// queuedPublish is a message queued for publishing with the channel
+// receiving the result of its publishing
+type queuedPublish struct {
+	msg    *message.Message
+	result chan<- error
 }
 
 type goChannels struct {
@@ -65,26 +74,64 @@ func (b *GoChannelMsgBroker) addPublisher(t publisherType, topic string, r *http
 }
 
 // Publish a msg using a Publisher to a given topic.
-func (b *GoChannelMsgBroker) publish(topic string, msg *message.Message) error {
+func (b *GoChannelMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
+	result, err := b.publishOrQueue(ctx, topic, msg)
+	if err != nil || result == nil {
+		return err
+	}
+
+	// The queued message is awaited without the lock, as the Subscriber may
+	// publish while handling the previous messages
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Error when Publishing a message on topic: %v",
+			topic)
+	}
+	return nil
+}
+
+// publishOrQueue publishes a msg to a given topic, or queues it if the topic
+// publishes in order and returns the channel receiving the result
+func (b *GoChannelMsgBroker) publishOrQueue(ctx context.Context, topic string,
+	msg *message.Message) (<-chan error, error) {
 	b.pubSubs.RLock()
 	defer b.pubSubs.RUnlock()
 
 	if goChann, found := b.pubSubs.m[topic]; found {
 		if !goChann.isPublisher {
-			return fmt.Errorf("No Publisher for topic: %v, map: %#v", topic, b.pubSubs.m)
+			return nil, fmt.Errorf("No Publisher for topic: %v, map: %#v", topic, b.pubSubs.m)
 		}
 		if goChann.ch == nil {
 			log.Debugf("Publish skipped: no Subscriber for topic: %v", topic)
-			return nil
+			return nil, nil
+		}
+		msg.SetContext(ctx)
+		if goChann.queue != nil {
+			result := make(chan error, 1)
+			select {
+			case goChann.queue <- queuedPublish{msg: msg, result: result}:
+				return result, nil
+			case <-ctx.Done():
+				return nil, errors.Wrapf(ctx.Err(),
+					"Error when Publishing a message on topic: %v", topic)
+			}
 		}
-		if err := goChann.ch.Publish(topic, msg); err != nil {
-			return errors.Wrapf(err, "Error when Publishing a message on topic: %v",
+		err := publishWithContext(ctx, func() error {
+			return goChann.ch.Publish(topic, msg)
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error when Publishing a message on topic: %v",
 				topic)
 		}
-		return nil
+		return nil, nil
 	}
 
-	return fmt.Errorf("No PubSub for topic: %v, map: %#v", topic, b.pubSubs.m)
+	return nil, fmt.Errorf("No PubSub for topic: %v, map: %#v", topic, b.pubSubs.m)
 }
 
 // Add a Subscriber of type t with for a given topic.
@@ -104,11 +151,21 @@ func (b *GoChannelMsgBroker) addSubscriber(t subscriberType, topic string, r *ht
 		b.pubSubs.m[topic] = goChannel{}
 	}
 
-	// Create a new GoChannel
-	ch := gochannel.NewGoChannel(b.defaultConfig, watermill.NewStdLogger(false, false))
-
+	// Create a new GoChannel. A GoChannel delivers every message by its own
+	// goroutine, so the messages of a notification topic are queued and
+	// published one at a time, each once the previous one was acked, to keep
+	// the notifications of a producer in order.
 	goChann := b.pubSubs.m[topic]
-	goChann.ch = ch
+	if t == notificationSubscriber {
+		cfg := b.defaultConfig
+		cfg.BlockPublishUntilSubscriberAck = true
+		goChann.ch = gochannel.NewGoChannel(cfg, watermill.NewStdLogger(false, false))
+		goChann.queue = make(chan queuedPublish, cfg.OutputChannelBuffer)
+		go publishInOrder(topic, goChann.ch, goChann.queue)
+	} else {
+		goChann.ch = gochannel.NewGoChannel(b.defaultConfig,
+			watermill.NewStdLogger(false, false))
+	}
 	b.pubSubs.m[topic] = goChann
 
 	msgChannel, err := b.pubSubs.m[topic].ch.Subscribe(context.Background(), topic)
@@ -118,11 +175,11 @@ func (b *GoChannelMsgBroker) addSubscriber(t subscriberType, topic string, r *ht
 
 	switch t {
 	case notificationSubscriber:
-		go handleNotificationUpdates(msgChannel, b.eaaCtx)
+		runMessageHandler(handleNotificationUpdates, msgChannel, b.eaaCtx)
 	case servicesSubscriber:
-		go handleServiceUpdates(msgChannel, b.eaaCtx)
+		runMessageHandler(handleServiceUpdates, msgChannel, b.eaaCtx)
 	case clientSubscriber:
-		go handleClientUpdates(msgChannel, b.eaaCtx)
+		runMessageHandler(handleClientUpdates, msgChannel, b.eaaCtx)
 	default:
 		return fmt.Errorf("Unknown Subscriber type: %v", t)
 	}
@@ -130,6 +187,19 @@ func (b *GoChannelMsgBroker) addSubscriber(t subscriberType, topic string, r *ht
 	return nil
 }
 
+// publishInOrder publishes the queued messages of a topic one at a time
+// until the queue is closed and sends the result of each to its publisher
+func publishInOrder(topic string, ch *gochannel.GoChannel, queue <-chan queuedPublish) {
+	for queued := range queue {
+		queued.result <- ch.Publish(topic, queued.msg)
+	}
+}
+
+// GoChannels are in-process and always reachable
+func (b *GoChannelMsgBroker) ping() error {
+	return nil
+}
+
 // Close and remove all GoChannels
 func (b *GoChannelMsgBroker) removeAll() error {
 	b.pubSubs.Lock()
@@ -142,6 +212,9 @@ func (b *GoChannelMsgBroker) removeAll() error {
 				return errors.Wrapf(err, "Failed to remove all GoChannels (topic '%v')", topic)
 			}
 		}
+		if goChann.queue != nil {
+			close(goChann.queue)
+		}
 	}
 
 	// Clear the map
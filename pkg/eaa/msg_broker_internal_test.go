@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// slowMsgBroker is a GoChannelMsgBroker whose publishing blocks until
+// released
+type slowMsgBroker struct {
+	*GoChannelMsgBroker
+	release chan struct{}
+}
+
+func (b slowMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
+	return publishWithContext(ctx, func() error {
+		<-b.release
+		return nil
+	})
+}
+
+var _ = g.Describe("Message Broker publish timeout", func() {
+	var (
+		eaaCtx *Context
+		broker slowMsgBroker
+	)
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.cfg.BrokerPublishTimeout.Duration = 10 * time.Millisecond
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		broker = slowMsgBroker{NewGoChannelMsgBroker(eaaCtx), make(chan struct{})}
+		eaaCtx.MsgBrokerCtx = broker
+	})
+
+	g.AfterEach(func() {
+		close(broker.release)
+	})
+
+	g.It("returns 503 if the broker doesn't publish in time", func() {
+		rec := httptest.NewRecorder()
+		RegisterApplication(rec, newTLSRequest("POST", "/services",
+			`{"endpoint_uri":"https://1.2.3.4"}`, "ns:producer", eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	g.It("returns when the context is done", func() {
+		ctx, cancel := withPublishTimeout(context.Background(), eaaCtx)
+		defer cancel()
+
+		start := time.Now()
+		err := broker.publish(ctx, servicesTopic, message.NewMessage("id", nil))
+		Expect(isPublishTimeout(err)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
+
+// flakyMsgBroker is a GoChannelMsgBroker whose publishing fails a number
+// of times before it succeeds
+type flakyMsgBroker struct {
+	*GoChannelMsgBroker
+	failures int32
+	attempts *int32
+}
+
+func (b flakyMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
+	if atomic.AddInt32(b.attempts, 1) <= b.failures {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+var _ = g.Describe("Message Broker publish retries", func() {
+	var (
+		eaaCtx   *Context
+		attempts int32
+	)
+
+	register := func(failures int32) *httptest.ResponseRecorder {
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), failures,
+			&attempts}
+
+		rec := httptest.NewRecorder()
+		RegisterApplication(rec, newTLSRequest("POST", "/services",
+			`{"endpoint_uri":"https://1.2.3.4"}`, "ns:producer", eaaCtx))
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		attempts = 0
+		eaaCtx = &Context{}
+		eaaCtx.cfg.BrokerPublishAttempts = 3
+		eaaCtx.cfg.BrokerPublishRetryDelay.Duration = time.Millisecond
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+	})
+
+	g.It("succeeds if the broker recovers before the last attempt", func() {
+		rec := register(2)
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+	})
+
+	g.It("returns 500 once all attempts failed", func() {
+		rec := register(3)
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonBrokerRetriesExhausted))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+	})
+
+	g.It("stops retrying when the publish timeout expires", func() {
+		eaaCtx.cfg.BrokerPublishAttempts = 100
+		eaaCtx.cfg.BrokerPublishRetryDelay.Duration = time.Hour
+		eaaCtx.cfg.BrokerPublishTimeout.Duration = 10 * time.Millisecond
+
+		rec := register(100)
+
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+	})
+
+	g.It("doubles the backoff up to the maximum", func() {
+		eaaCtx.cfg.BrokerPublishRetryDelay.Duration = time.Second
+
+		Expect(publishRetryDelay(1, eaaCtx)).To(And(
+			BeNumerically(">=", 500*time.Millisecond), BeNumerically("<=", time.Second)))
+		Expect(publishRetryDelay(3, eaaCtx)).To(And(
+			BeNumerically(">=", 2*time.Second), BeNumerically("<=", 4*time.Second)))
+		Expect(publishRetryDelay(30, eaaCtx)).To(
+			BeNumerically("<=", maxBrokerPublishRetryDelay))
+	})
+})
+
+var _ = g.Describe("Notification delivery order", func() {
+	g.It("keeps the notifications of every producer in order", func() {
+		const perProducer = 200
+		conn := &fakeNotificationConn{sent: make(chan []byte, 2*perProducer)}
+		eaaCtx := newFanOutContext([]notificationConn{conn})
+		eaaCtx.serviceInfo.m["ns:producer2"] = Service{}
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		defer eaaCtx.MsgBrokerCtx.removeAll()
+		Expect(addNotificationSubscriber("ns", nil, eaaCtx)).To(Succeed())
+
+		// The producers push their notifications interleaved
+		done := make(chan error, 2)
+		for _, id := range []string{"producer", "producer2"} {
+			go func(urn URN) {
+				for i := 0; i < perProducer; i++ {
+					notif := &NotificationFromProducer{Name: "n1", Version: "1.0",
+						Payload: json.RawMessage(fmt.Sprintf(`{"n":%d}`, i))}
+					if err := publishNotification(context.Background(), urn, notif,
+						"", "", eaaCtx); err != nil {
+						done <- err
+						return
+					}
+				}
+				done <- nil
+			}(URN{ID: id, Namespace: "ns"})
+		}
+		Expect(<-done).To(Succeed())
+		Expect(<-done).To(Succeed())
+
+		next := map[string]int{}
+		for i := 0; i < 2*perProducer; i++ {
+			var data []byte
+			Eventually(conn.sent).Should(Receive(&data))
+			var notif NotificationToConsumer
+			Expect(json.Unmarshal(data, &notif)).To(Succeed())
+			var payload struct{ N int }
+			Expect(json.Unmarshal(notif.Payload, &payload)).To(Succeed())
+
+			Expect(payload.N).To(Equal(next[notif.URN.ID]),
+				"notification of %s out of order", notif.URN.ID)
+			next[notif.URN.ID]++
+		}
+		Expect(next).To(Equal(map[string]int{"producer": perProducer,
+			"producer2": perProducer}))
+	})
+})
+
+var _ = g.Describe("Notification publishing in order", func() {
+	g.It("returns the errors of publishing the queued notifications", func() {
+		eaaCtx := newFanOutContext(nil)
+		broker := NewGoChannelMsgBroker(eaaCtx)
+		eaaCtx.MsgBrokerCtx = broker
+		defer broker.removeAll()
+		topic := getNotificationTopicName("ns")
+		Expect(addNotificationSubscriber("ns", nil, eaaCtx)).To(Succeed())
+		Expect(broker.addPublisher(notificationPublisher, topic, nil)).To(Succeed())
+
+		broker.pubSubs.RLock()
+		Expect(broker.pubSubs.m[topic].ch.Close()).To(Succeed())
+		broker.pubSubs.RUnlock()
+
+		err := broker.publish(context.Background(), topic, message.NewMessage("1", nil))
+		Expect(err).To(HaveOccurred())
+	})
+})
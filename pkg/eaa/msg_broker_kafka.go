@@ -4,13 +4,16 @@
 package eaa
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/ThreeDotsLabs/watermill"
@@ -105,12 +108,62 @@ func NewKafkaMsgBroker(eaaCtx *Context, consumerGroup string,
 
 // PUBLISHERS
 
+// notificationKeySeparator separates the producer URN from the unique part
+// of a notification key, URNs can't contain it
+const notificationKeySeparator = '/'
+
+// notificationPartitioner partitions the messages by the hash of their keys,
+// of only the producer URN part of the keys of notifications, so that
+// the notifications of a producer stay in a partition, and thus in order,
+// while each has a unique key and a compacted topic keeps them all
+type notificationPartitioner struct {
+	sarama.Partitioner
+}
+
+// newNotificationPartitioner is the sarama.PartitionerConstructor of
+// notificationPartitioner
+func newNotificationPartitioner(topic string) sarama.Partitioner {
+	return notificationPartitioner{sarama.NewHashPartitioner(topic)}
+}
+
+// Partition chooses the partition of the message
+func (p notificationPartitioner) Partition(msg *sarama.ProducerMessage,
+	numPartitions int32) (int32, error) {
+
+	if !strings.HasPrefix(msg.Topic, notificationsTopicPrefix) || msg.Key == nil {
+		return p.Partitioner.Partition(msg, numPartitions)
+	}
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	if i := bytes.IndexByte(key, notificationKeySeparator); i >= 0 {
+		key = key[:i]
+	}
+	return p.Partitioner.Partition(&sarama.ProducerMessage{Topic: msg.Topic,
+		Key: sarama.ByteEncoder(key)}, numPartitions)
+}
+
 // Generate a message primary key depending on a topic type
 func keyGenerator(topic string, msg *message.Message) (string, error) {
 
-	if strings.HasPrefix(topic, notificationsTopicPrefix) {
-		// Each notification should get a different primary key to avoid log compaction
+	// Dead letters are published to the topic of the config and need no
+	// order, each gets a different key
+	if msg.Metadata.Get(deadLetterMetadataKey) != "" {
 		return uuid.New().String(), nil
+	}
+
+	if strings.HasPrefix(topic, notificationsTopicPrefix) {
+		// The keys of the notifications of a producer start with its URN,
+		// which notificationPartitioner hashes, so that they're kept in
+		// a partition and thus in order. Notifications without a producer
+		// aren't delivered, they get a different key each.
+		var notifMsg NotificationMessage
+		if err := json.Unmarshal(msg.Payload, &notifMsg); err != nil || notifMsg.URN == nil {
+			return uuid.New().String(), nil
+		}
+		return notifMsg.URN.String() + string(notificationKeySeparator) +
+			uuid.New().String(), nil
 
 	} else if strings.HasPrefix(topic, servicesTopic) {
 		var svcMsg ServiceMessage
@@ -119,6 +172,14 @@ func keyGenerator(topic string, msg *message.Message) (string, error) {
 			return "", errors.Wrap(err, "Couldn't unmarshal a message to generate its key!")
 		}
 
+		// Self-test messages have no service, they're keyed by their ID
+		if svcMsg.Svc == nil {
+			if svcMsg.Action == serviceActionSelfTest {
+				return serviceActionSelfTest + ":" + svcMsg.SelfTestID, nil
+			}
+			return "", fmt.Errorf("Service shouldn't be nil (topic: %v)", topic)
+		}
+
 		if svcMsg.Svc.URN == nil {
 			return "", fmt.Errorf("URN shouldn't be nil (topic: %v)", topic)
 		}
@@ -132,9 +193,8 @@ func keyGenerator(topic string, msg *message.Message) (string, error) {
 			return "", errors.Wrap(err, "Couldn't unmarshal a message to generate its key!")
 		}
 
-		// Unsubscribe All message has no URN
-		if subscriptionMsg.Action == subscriptionActionUnsubscribe &&
-			subscriptionMsg.Scope == subscriptionScopeAll {
+		// Unsubscribe All and Renew messages have no URN
+		if subscriptionMsg.Scope == subscriptionScopeAll {
 			return "", nil
 		}
 
@@ -153,10 +213,11 @@ func (b *KafkaMsgBroker) createDefaultPublisher() (*kafka.Publisher, error) {
 	config := KafkaBroker.DefaultSaramaSyncPublisherConfig()
 	config.Net.TLS.Enable = true
 	config.Net.TLS.Config = b.tlsConfig
+	config.Producer.Partitioner = newNotificationPartitioner
 
 	publisher, err := KafkaBroker.NewPublisher(
 		kafka.PublisherConfig{
-			Brokers:               []string{b.eaaCtx.cfg.KafkaBroker},
+			Brokers:               []string{b.eaaCtx.config().KafkaBroker},
 			Marshaler:             KafkaBroker.NewWithPartitioningMarshaler(keyGenerator),
 			OverwriteSaramaConfig: config,
 		},
@@ -198,13 +259,17 @@ func (b *KafkaMsgBroker) addPublisher(t publisherType, topic string, r *http.Req
 }
 
 // Publish a msg using a Publisher to a given topic.
-func (b *KafkaMsgBroker) publish(topic string, msg *message.Message) error {
+func (b *KafkaMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
 	// kafka.Publisher::Publish() method is thread-safe - we can use Reader lock
 	b.pubs.RLock()
 	defer b.pubs.RUnlock()
 
 	if publisher, found := b.pubs.m[topic]; found {
-		err := publisher.Publish(topic, msg)
+		msg.SetContext(ctx)
+		err := publishWithContext(ctx, func() error {
+			return publisher.Publish(topic, msg)
+		})
 		if err != nil {
 			err = errors.Wrapf(err, "Error when Publishing a message to the topic: %v",
 				topic)
@@ -221,7 +286,7 @@ func (b *KafkaMsgBroker) publish(topic string, msg *message.Message) error {
 func (b *KafkaMsgBroker) createSubscriber(config *sarama.Config) (*kafka.Subscriber, error) {
 	subscriber, err := KafkaBroker.NewSubscriber(
 		kafka.SubscriberConfig{
-			Brokers:               []string{b.eaaCtx.cfg.KafkaBroker},
+			Brokers:               []string{b.eaaCtx.config().KafkaBroker},
 			Unmarshaler:           kafka.DefaultMarshaler{},
 			OverwriteSaramaConfig: config,
 			ConsumerGroup:         b.consumerGroup,
@@ -251,7 +316,7 @@ func (b *KafkaMsgBroker) createNotificationSubscriber(topic string) (*kafka.Subs
 		return nil, errors.Wrap(err, "Notifications Subscriptions Registration failure!")
 	}
 
-	go handleNotificationUpdates(messages, b.eaaCtx)
+	runMessageHandler(handleNotificationUpdates, messages, b.eaaCtx)
 
 	return subscriber, nil
 }
@@ -274,7 +339,7 @@ func (b *KafkaMsgBroker) createServicesSubscriber() (*kafka.Subscriber, error) {
 		return nil, errors.Wrap(err, "Services Subscriptions Registration failure!")
 	}
 
-	go handleServiceUpdates(messages, b.eaaCtx)
+	runMessageHandler(handleServiceUpdates, messages, b.eaaCtx)
 
 	return subscriber, nil
 }
@@ -297,7 +362,7 @@ func (b *KafkaMsgBroker) createClientSubscriber(topic string) (*kafka.Subscriber
 		return nil, errors.Wrap(err, "Client Subscriptions Registration failure!")
 	}
 
-	go handleClientUpdates(messages, b.eaaCtx)
+	runMessageHandler(handleClientUpdates, messages, b.eaaCtx)
 
 	return subscriber, nil
 }
@@ -340,6 +405,19 @@ func (b *KafkaMsgBroker) addSubscriber(t subscriberType, topic string, r *http.R
 	return nil
 }
 
+// kafkaPingTimeout limits the time of a Kafka Broker connectivity check
+const kafkaPingTimeout = 3 * time.Second
+
+// Check if the Kafka Broker accepts TLS connections
+func (b *KafkaMsgBroker) ping() error {
+	dialer := &net.Dialer{Timeout: kafkaPingTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", b.eaaCtx.config().KafkaBroker, b.tlsConfig)
+	if err != nil {
+		return errors.Wrapf(err, "Kafka Broker %v is unreachable", b.eaaCtx.config().KafkaBroker)
+	}
+	return conn.Close()
+}
+
 // Close and remove all Publishers and Subscribers
 func (b *KafkaMsgBroker) removeAll() error {
 	b.pubs.Lock()
@@ -80,6 +80,28 @@ var _ = g.Describe("keyGenerator", func() {
 		})
 	})
 
+	g.Context("with notifications topic and a notification", func() {
+		topic := notificationsTopicPrefix + "ns"
+
+		g.It("should return a unique key starting with the URN of the producer", func() {
+			m := NotificationMessage{
+				Notification: &NotificationFromProducer{Name: "n1", Version: "1.0"},
+				URN:          &URN{ID: "producer", Namespace: "ns"},
+			}
+			message := message.Message{}
+			message.Payload, _ = json.Marshal(m)
+
+			key, err := keyGenerator(topic, &message)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(HavePrefix("ns:producer/"))
+
+			other, err := keyGenerator(topic, &message)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other).To(HavePrefix("ns:producer/"))
+			Expect(other).NotTo(Equal(key))
+		})
+	})
+
 	g.Context("with services topic", func() {
 		topic := servicesTopic
 
@@ -124,6 +146,32 @@ var _ = g.Describe("keyGenerator", func() {
 			})
 		})
 
+		g.Context("and nil service", func() {
+			g.It("should fail with empty key and an error", func() {
+				message := message.Message{}
+				message.Payload, _ = json.Marshal(ServiceMessage{
+					Action: serviceActionRegister})
+
+				key, err := keyGenerator(topic, &message)
+
+				Expect(err).To(HaveOccurred())
+				Expect(key).To(BeEmpty())
+			})
+		})
+
+		g.Context("and a self-test message", func() {
+			g.It("should return the self-test ID", func() {
+				message := message.Message{}
+				message.Payload, _ = json.Marshal(ServiceMessage{
+					Action: serviceActionSelfTest, SelfTestID: "id-1"})
+
+				key, err := keyGenerator(topic, &message)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).To(Equal("self-test:id-1"))
+			})
+		})
+
 		g.Context("and a good message", func() {
 			g.It("should not fail with an error", func() {
 				m := ServiceMessage{
@@ -258,6 +306,35 @@ func patchMethod(t, r interface{}, patches *[]*Patch) {
 	*patches = append(*patches, p)
 }
 
+var _ = g.Describe("notificationPartitioner", func() {
+	const partitions = 16
+
+	partition := func(topic, key string) int32 {
+		p := newNotificationPartitioner(topic)
+		partition, err := p.Partition(&sarama.ProducerMessage{Topic: topic,
+			Key: sarama.StringEncoder(key)}, partitions)
+		Expect(err).NotTo(HaveOccurred())
+		return partition
+	}
+
+	g.It("should partition the notifications by the URN of the producer", func() {
+		topic := notificationsTopicPrefix + "ns"
+		expected := partition(topic, "ns:producer")
+
+		Expect(partition(topic, "ns:producer/a")).To(Equal(expected))
+		Expect(partition(topic, "ns:producer/b")).To(Equal(expected))
+	})
+
+	g.It("should hash the whole key of other messages", func() {
+		p := sarama.NewHashPartitioner(servicesTopic)
+		expected, err := p.Partition(&sarama.ProducerMessage{Topic: servicesTopic,
+			Key: sarama.StringEncoder("ns:producer/a")}, partitions)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(partition(servicesTopic, "ns:producer/a")).To(Equal(expected))
+	})
+})
+
 var _ = g.Describe("Kafka Message Broker", func() {
 
 	var (
@@ -393,7 +470,7 @@ var _ = g.Describe("Kafka Message Broker", func() {
 			m := message.Message{}
 
 			mockKafkaPublisher.EXPECT().Publish(topic, &m).Return(nil)
-			e := kafkaBroker.publish(topic, &m)
+			e := kafkaBroker.publish(context.Background(), topic, &m)
 
 			Expect(e).NotTo(HaveOccurred())
 		})
@@ -402,7 +479,7 @@ var _ = g.Describe("Kafka Message Broker", func() {
 
 			m := message.Message{}
 
-			e := kafkaBroker.publish("unknown topic", &m)
+			e := kafkaBroker.publish(context.Background(), "unknown topic", &m)
 
 			Expect(e).To(HaveOccurred())
 		})
@@ -412,7 +489,7 @@ var _ = g.Describe("Kafka Message Broker", func() {
 			m := message.Message{}
 
 			mockKafkaPublisher.EXPECT().Publish(topic, &m).Return(errors.New("test error"))
-			e := kafkaBroker.publish(topic, &m)
+			e := kafkaBroker.publish(context.Background(), topic, &m)
 
 			Expect(e).To(HaveOccurred())
 		})
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// PubSub is a Message Broker implemented outside of this package, such as
+// the in-memory broker of package eaatest. Every message published to
+// a topic is delivered to each channel subscribed to the topic, in the order
+// the messages were published, and the channels are closed by Close.
+type PubSub interface {
+	Publish(ctx context.Context, topic string, msg *message.Message) error
+	Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error)
+	// Ping checks if the Message Broker is reachable
+	Ping() error
+	Close() error
+}
+
+// pubSubMsgBroker is a msgBroker backed by a PubSub
+type pubSubMsgBroker struct {
+	eaaCtx *Context
+	pubSub PubSub
+
+	sync.Mutex
+	publishers  map[string]bool
+	subscribers map[string]bool
+}
+
+func newPubSubMsgBroker(pubSub PubSub, eaaCtx *Context) *pubSubMsgBroker {
+	return &pubSubMsgBroker{
+		eaaCtx:      eaaCtx,
+		pubSub:      pubSub,
+		publishers:  make(map[string]bool),
+		subscribers: make(map[string]bool),
+	}
+}
+
+// Add a Publisher for a given topic, objectAlreadyExistsError is returned
+// if the topic already has one
+func (b *pubSubMsgBroker) addPublisher(t publisherType, topic string, r *http.Request) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.publishers[topic] {
+		return objectAlreadyExistsError{
+			fmt.Errorf("Publisher for a topic '%v' already exists", topic)}
+	}
+	b.publishers[topic] = true
+	return nil
+}
+
+// Publish a msg to a given topic which has a Publisher
+func (b *pubSubMsgBroker) publish(ctx context.Context, topic string,
+	msg *message.Message) error {
+	b.Lock()
+	found := b.publishers[topic]
+	b.Unlock()
+
+	if !found {
+		return fmt.Errorf("No Publisher for topic: %v", topic)
+	}
+	msg.SetContext(ctx)
+	if err := b.pubSub.Publish(ctx, topic, msg); err != nil {
+		return errors.Wrapf(err, "Error when Publishing a message on topic: %v", topic)
+	}
+	return nil
+}
+
+// Add a Subscriber of type t for a given topic, objectAlreadyExistsError is
+// returned if the topic already has one
+func (b *pubSubMsgBroker) addSubscriber(t subscriberType, topic string, r *http.Request) error {
+	var handler func(<-chan *message.Message, *Context)
+	switch t {
+	case notificationSubscriber:
+		handler = handleNotificationUpdates
+	case servicesSubscriber:
+		handler = handleServiceUpdates
+	case clientSubscriber:
+		handler = handleClientUpdates
+	default:
+		return fmt.Errorf("Unknown Subscriber type: %v", t)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.subscribers[topic] {
+		return objectAlreadyExistsError{
+			fmt.Errorf("Subscriber with topic '%v' already exists", topic)}
+	}
+	msgChannel, err := b.pubSub.Subscribe(context.Background(), topic)
+	if err != nil {
+		return errors.Wrapf(err, "Error when Subscribing to the topic: %v", topic)
+	}
+	b.subscribers[topic] = true
+
+	runMessageHandler(handler, msgChannel, b.eaaCtx)
+	return nil
+}
+
+func (b *pubSubMsgBroker) ping() error {
+	return b.pubSub.Ping()
+}
+
+// Close the PubSub, which ends the handlers of the Subscribers
+func (b *pubSubMsgBroker) removeAll() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.publishers = make(map[string]bool)
+	b.subscribers = make(map[string]bool)
+	return errors.Wrap(b.pubSub.Close(), "Failed to close the PubSub")
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// namespaceAccessError is returned when the namespace policies don't allow
+// a CommonName to access a namespace
+type namespaceAccessError struct {
+	commonName string
+	namespace  string
+}
+
+func (e namespaceAccessError) Error() string {
+	return fmt.Sprintf("%s is not allowed to access namespace '%s'",
+		e.commonName, e.namespace)
+}
+
+// isNamespaceAllowed checks if the namespace policies allow the CommonName
+// to access the namespace. Without any policy every namespace is allowed.
+//
+// The namespace may be a pattern of a wildcard subscription, it's allowed
+// if it's matched by an allowed pattern as a literal string, e.g. "tenant-a*"
+// allows "tenant-a*" and "tenant-a-x*" but not "tenant-*". Notifications
+// delivered to wildcard subscriptions are checked again using the namespace
+// of the producer.
+func isNamespaceAllowed(commonName string, namespace string, eaaCtx *Context) bool {
+	if len(eaaCtx.config().NamespacePolicies) == 0 {
+		return true
+	}
+
+	for _, policy := range eaaCtx.config().NamespacePolicies {
+		if !namespaceMatches(policy.CommonName, commonName) {
+			continue
+		}
+		for _, allowed := range policy.Namespaces {
+			if namespaceMatches(normalizeNamespace(allowed), namespace) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkNamespaceAccess returns namespaceAccessError if the namespace
+// policies don't allow the CommonName to access the namespace
+func checkNamespaceAccess(commonName string, namespace string, eaaCtx *Context) error {
+	if !isNamespaceAllowed(commonName, namespace, eaaCtx) {
+		return namespaceAccessError{commonName: commonName, namespace: namespace}
+	}
+	return nil
+}
+
+// getAllowedSubscribers returns the consumers allowed to receive
+// notifications of the namespace
+func getAllowedSubscribers(subIDs []string, namespace string, eaaCtx *Context) []string {
+	if len(eaaCtx.config().NamespacePolicies) == 0 {
+		return subIDs
+	}
+
+	var allowed []string
+	for _, subID := range subIDs {
+		if isNamespaceAllowed(subID, namespace, eaaCtx) {
+			allowed = append(allowed, subID)
+		}
+	}
+	return allowed
+}
+
+// publishPolicyAnyProducer is the CommonName of the publish policy applied
+// to producers without a policy of their own
+const publishPolicyAnyProducer = "*"
+
+// publishPolicy is a PublishPolicy with the namespaces as sets
+type publishPolicy struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+// publishPolicies are the publish policies by CommonName, nil allows every
+// producer to push to every namespace
+type publishPolicies map[string]publishPolicy
+
+// newPublishPolicies builds the namespace sets of the configured policies,
+// so that checking a push takes two map lookups
+func newPublishPolicies(policies []PublishPolicy) (publishPolicies, error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	compiled := make(publishPolicies, len(policies))
+	for _, policy := range policies {
+		if policy.CommonName == "" {
+			return nil, errors.New("Publish policy without CommonName")
+		}
+		if _, ok := compiled[policy.CommonName]; ok {
+			return nil, errors.Errorf("Duplicated publish policy of %s",
+				policy.CommonName)
+		}
+		p := publishPolicy{
+			allow: make(map[string]bool, len(policy.Allow)),
+			deny:  make(map[string]bool, len(policy.Deny)),
+		}
+		for _, namespace := range policy.Allow {
+			p.allow[normalizeNamespace(namespace)] = true
+		}
+		for _, namespace := range policy.Deny {
+			p.deny[normalizeNamespace(namespace)] = true
+		}
+		compiled[policy.CommonName] = p
+	}
+	return compiled, nil
+}
+
+// check returns namespaceAccessError if the publish policy of the producer
+// doesn't allow it to push notifications to the namespace
+func (p publishPolicies) check(commonName string, namespace string) error {
+	policy, ok := p[commonName]
+	if !ok {
+		if policy, ok = p[publishPolicyAnyProducer]; !ok {
+			return nil
+		}
+	}
+
+	if policy.deny[namespace] || (len(policy.allow) > 0 && !policy.allow[namespace]) {
+		return namespaceAccessError{commonName: commonName, namespace: namespace}
+	}
+	return nil
+}
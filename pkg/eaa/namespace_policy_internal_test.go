@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Namespace policies", func() {
+	var eaaCtx *Context
+
+	n1 := []NotificationDescriptor{{Name: "n1", Version: "1.0"}}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.cfg.NamespacePolicies = []NamespacePolicy{
+			{CommonName: "tenant-a*:*", Namespaces: []string{"tenant-a*"}},
+			{CommonName: "monitor:*", Namespaces: []string{"*"}},
+		}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+	})
+
+	g.It("allows only namespaces of matching policies", func() {
+		Expect(isNamespaceAllowed("tenant-a1:c", "tenant-a2", eaaCtx)).To(BeTrue())
+		Expect(isNamespaceAllowed("tenant-a1:c", "tenant-a-x*", eaaCtx)).To(BeTrue())
+		Expect(isNamespaceAllowed("tenant-a1:c", "tenant-b", eaaCtx)).To(BeFalse())
+		Expect(isNamespaceAllowed("tenant-a1:c", "tenant-*", eaaCtx)).To(BeFalse())
+		Expect(isNamespaceAllowed("monitor:c", "tenant-b", eaaCtx)).To(BeTrue())
+		Expect(isNamespaceAllowed("other:c", "other", eaaCtx)).To(BeFalse())
+
+		eaaCtx.cfg.NamespacePolicies = nil
+		Expect(isNamespaceAllowed("other:c", "tenant-b", eaaCtx)).To(BeTrue())
+	})
+
+	g.It("rejects subscriptions to denied namespaces", func() {
+		Expect(addSubscriptionToNamespace("tenant-a:c", "tenant-b", n1, eaaCtx)).To(
+			BeAssignableToTypeOf(namespaceAccessError{}))
+		Expect(addSubscriptionToService("tenant-a:c", "tenant-b", "p", n1, eaaCtx)).To(
+			BeAssignableToTypeOf(namespaceAccessError{}))
+		Expect(eaaCtx.subscriptionInfo.m).To(BeEmpty())
+
+		rec := httptest.NewRecorder()
+		r := newTLSRequest("POST", "/notifications/tenant-b", `[{"name":"n1","version":"1.0"}]`,
+			"tenant-a:c", eaaCtx)
+		SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+			map[string]string{"urn.namespace": "tenant-b"}))
+
+		var resp ErrorResponse
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonNamespaceAccessDenied))
+	})
+
+	g.It("rejects notifications pushed by producers outside the policies", func() {
+		eaaCtx.serviceInfo.m["other:p"] = Service{}
+
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n1","version":"1.0","payload":{}}`, "other:p", eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+	})
+
+	g.It("doesn't deliver to wildcard subscribers of denied namespaces", func() {
+		eaaCtx.cfg.NamespacePolicies = nil
+		Expect(addSubscriptionToNamespace("tenant-a:c", "tenant-*", n1, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToNamespace("monitor:c", "tenant-*", n1, eaaCtx)).To(Succeed())
+
+		eaaCtx.cfg.NamespacePolicies = []NamespacePolicy{
+			{CommonName: "tenant-a:*", Namespaces: []string{"tenant-*"}},
+			{CommonName: "monitor:*", Namespaces: []string{"*"}},
+		}
+		key := UniqueNotif{namespace: "tenant-b", notifName: "n1", notifVersion: "1.0"}
+		Expect(getNotificationSubscribers(key, "p", eaaCtx)).To(
+			ConsistOf("tenant-a:c", "monitor:c"))
+
+		eaaCtx.cfg.NamespacePolicies[0].Namespaces = []string{"tenant-a*"}
+		Expect(getNotificationSubscribers(key, "p", eaaCtx)).To(ConsistOf("monitor:c"))
+	})
+})
+
+var _ = g.Describe("Publish policies", func() {
+	var policies publishPolicies
+
+	g.BeforeEach(func() {
+		var err error
+		policies, err = newPublishPolicies([]PublishPolicy{
+			{CommonName: "shared:owner", Allow: []string{"shared"}},
+			{CommonName: "ns:producer", Deny: []string{"ns"}},
+			{CommonName: "*", Deny: []string{"shared"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	g.It("allows namespaces by the policy of the producer", func() {
+		Expect(policies.check("shared:owner", "shared")).To(Succeed())
+		Expect(policies.check("shared:owner", "other")).To(
+			BeAssignableToTypeOf(namespaceAccessError{}))
+		Expect(policies.check("ns:producer", "ns")).ToNot(Succeed())
+		Expect(policies.check("ns:producer", "shared")).To(Succeed())
+		Expect(policies.check("shared:intruder", "shared")).ToNot(Succeed())
+		Expect(policies.check("other:producer", "other")).To(Succeed())
+
+		Expect(publishPolicies(nil).check("shared:intruder", "shared")).To(Succeed())
+	})
+
+	g.It("rejects invalid policies", func() {
+		_, err := newPublishPolicies([]PublishPolicy{{Allow: []string{"ns"}}})
+		Expect(err).To(HaveOccurred())
+		_, err = newPublishPolicies([]PublishPolicy{{CommonName: "ns:p"},
+			{CommonName: "ns:p"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	g.It("audits denied pushes", func() {
+		var audit bytes.Buffer
+		eaaCtx := &Context{publishPolicies: policies, audit: &auditLogger{w: &audit}}
+		eaaCtx.serviceInfo.m = map[string]Service{"shared:intruder": {}}
+
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n1","version":"1.0","payload":{}}`, "shared:intruder", eaaCtx))
+
+		var resp ErrorResponse
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonNamespaceAccessDenied))
+
+		var record auditRecord
+		Expect(json.Unmarshal(audit.Bytes(), &record)).To(Succeed())
+		Expect(record.CommonName).To(Equal("shared:intruder"))
+		Expect(record.Action).To(Equal(auditActionPublish))
+		Expect(record.Target).To(Equal("shared"))
+		Expect(record.Status).To(Equal("403"))
+	})
+})
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A subscription with an aggregation window has the notifications accepted
+// for it buffered instead of written one by one. The first notification
+// buffered starts the window and the buffer is delivered at its end as
+// a single batch, a JSON array of the notifications in the order they were
+// pushed. A buffer reaching NotificationAggregationMaxSize is delivered at
+// once and the next notification starts a new window. Notifications whose
+// deadline passes while buffered are left out of the batch. At-least-once
+// notifications of a batch are acknowledged one by one and redelivered on
+// their own.
+
+const (
+	// maxAggregationWindow bounds the aggregation window of a subscription
+	maxAggregationWindow = time.Minute
+	// defaultNotificationAggregationMaxSize bounds the notifications
+	// buffered by an aggregation window if it's not set in the config
+	defaultNotificationAggregationMaxSize = 100
+)
+
+// validateAggregationWindow checks the aggregation window of a subscription
+// in milliseconds
+func validateAggregationWindow(window int) error {
+	if window < 0 || time.Duration(window)*time.Millisecond > maxAggregationWindow {
+		return fmt.Errorf("aggregationWindow must be between 0 and %d ms",
+			maxAggregationWindow/time.Millisecond)
+	}
+	return nil
+}
+
+// aggregationWindow returns the aggregation window of a subscription
+func aggregationWindow(n NotificationDescriptor) time.Duration {
+	return time.Duration(n.AggregationWindow) * time.Millisecond
+}
+
+// aggregationKey identifies the subscription of a consumer whose
+// notifications are aggregated
+type aggregationKey struct {
+	subscription *ConsumerSubscription
+	subscriberKey
+}
+
+// aggregatedNotification is a notification buffered by an aggregation window
+type aggregatedNotification struct {
+	key      UniqueNotif
+	payload  []byte
+	deadline time.Time
+}
+
+// aggregationBuffer holds the notifications of an aggregation window until
+// its timer delivers them
+type aggregationBuffer struct {
+	notifications []aggregatedNotification
+	timer         *time.Timer
+}
+
+// notificationAggregations holds the buffers of the aggregation windows
+// started by the subscriptions. The zero value is ready to use.
+type notificationAggregations struct {
+	sync.Mutex
+	m map[aggregationKey]*aggregationBuffer
+}
+
+// add buffers the notification of the subscription. The first notification
+// of a window schedules flush of the buffer at the end of the window.
+// A buffer reaching max notifications is returned instead, for the caller
+// to deliver it.
+func (a *notificationAggregations) add(key aggregationKey, n aggregatedNotification,
+	window time.Duration, max int,
+	flush func([]aggregatedNotification)) []aggregatedNotification {
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.m == nil {
+		a.m = make(map[aggregationKey]*aggregationBuffer)
+	}
+	buf, found := a.m[key]
+	if !found {
+		buf = &aggregationBuffer{}
+		buf.timer = time.AfterFunc(window, func() {
+			if batch := a.take(key, buf); len(batch) > 0 {
+				flush(batch)
+			}
+		})
+		a.m[key] = buf
+	}
+	buf.notifications = append(buf.notifications, n)
+	if len(buf.notifications) < max {
+		return nil
+	}
+	buf.timer.Stop()
+	delete(a.m, key)
+	return buf.notifications
+}
+
+// take removes the buffer of the subscription and returns its notifications,
+// unless the buffer was already delivered for being full
+func (a *notificationAggregations) take(key aggregationKey,
+	buf *aggregationBuffer) []aggregatedNotification {
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.m[key] != buf {
+		return nil
+	}
+	delete(a.m, key)
+	return buf.notifications
+}
+
+// aggregateNotification buffers the notification for the subscription of
+// the consumer with an aggregation window, a full buffer is delivered
+func aggregateNotification(key aggregationKey, n aggregatedNotification,
+	window time.Duration, eaaCtx *Context) {
+
+	max := eaaCtx.config().NotificationAggregationMaxSize
+	if max <= 0 {
+		max = defaultNotificationAggregationMaxSize
+	}
+	flush := func(batch []aggregatedNotification) {
+		sendNotificationBatch(key.subID, batch, eaaCtx)
+	}
+	if batch := eaaCtx.aggregations.add(key, n, window, max, flush); batch != nil {
+		flush(batch)
+	}
+}
+
+// sendNotificationBatch writes the aggregated notifications which aren't
+// stale to the consumer as a single batch
+func sendNotificationBatch(subID string, batch []aggregatedNotification,
+	eaaCtx *Context) {
+
+	now := time.Now()
+	kept := batch[:0]
+	for _, n := range batch {
+		if isStale(n.deadline, now) {
+			notificationsDroppedStaleTotal.Inc()
+			continue
+		}
+		kept = append(kept, n)
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	payloads := make([][]byte, 0, len(kept))
+	for _, n := range kept {
+		payloads = append(payloads, n.payload)
+	}
+	data := append(append([]byte{'['}, bytes.Join(payloads, []byte{','})...), ']')
+
+	// The notifications of a batch are the ones of a single subscription,
+	// the connection filters are matched by the first of them
+	err := sendNotificationToSubscriber(subID, &kept[0].key, data, "", time.Time{}, eaaCtx)
+	for _, n := range kept {
+		counters := eaaCtx.subscriptionStats.counters(subID, n.key)
+		if err != nil {
+			atomic.AddUint64(&counters.dropped, 1)
+		} else {
+			atomic.AddUint64(&counters.delivered, 1)
+			notificationsDeliveredTotal.WithLabelValues(n.key.namespace).Inc()
+		}
+	}
+	if err != nil {
+		log.Warningf("Couldn't send a batch of %d notifications to Subscriber ID: %s : %v",
+			len(kept), subID, err)
+		return
+	}
+	notificationBatchesTotal.Inc()
+	log.Debugf("Batch of %d notifications sent to Subscriber ID: %s", len(kept), subID)
+}
+
+// isNotificationBatch checks if the message written to a consumer is a batch
+// of aggregated notifications
+func isNotificationBatch(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '['
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Notification aggregation", func() {
+	var (
+		sent   chan []byte
+		eaaCtx *Context
+	)
+
+	push := func(payload string) DeliverySummary {
+		summary, err := sendNotificationToAllSubscribers("ns:producer",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(payload)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		return summary
+	}
+
+	payloadsOf := func(data []byte) []string {
+		var batch []NotificationToConsumer
+		Expect(json.Unmarshal(data, &batch)).To(Succeed())
+		var payloads []string
+		for _, notif := range batch {
+			payloads = append(payloads, string(notif.Payload))
+		}
+		return payloads
+	}
+
+	g.BeforeEach(func() {
+		sent = make(chan []byte, 4)
+		eaaCtx = newFanOutContext([]notificationConn{
+			&fakeNotificationConn{sent: sent},
+			&fakeNotificationConn{sent: make(chan []byte, 4)},
+		})
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setAggregationWindow("",
+			"ns:consumer0", 50*time.Millisecond)
+	})
+
+	g.It("coalesces the notifications of the window into one batch", func() {
+		for _, payload := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+			Expect(push(payload)).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 1,
+				Aggregated: 1}))
+		}
+		Expect(sent).To(BeEmpty())
+
+		var batch []byte
+		Eventually(sent).Should(Receive(&batch))
+		Expect(payloadsOf(batch)).To(Equal([]string{`{"n":1}`, `{"n":2}`, `{"n":3}`}))
+		Consistently(sent, 100*time.Millisecond).ShouldNot(Receive())
+
+		g.By("starting a new window with the next notification")
+		push(`{"n":4}`)
+		Eventually(sent).Should(Receive(&batch))
+		Expect(payloadsOf(batch)).To(Equal([]string{`{"n":4}`}))
+	})
+
+	g.It("delivers a full buffer before the window ends", func() {
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setAggregationWindow("",
+			"ns:consumer0", time.Minute)
+		eaaCtx.cfg.NotificationAggregationMaxSize = 2
+
+		push(`{"n":1}`)
+		Expect(sent).To(BeEmpty())
+		push(`{"n":2}`)
+		Expect(sent).To(HaveLen(1))
+		Expect(payloadsOf(<-sent)).To(Equal([]string{`{"n":1}`, `{"n":2}`}))
+	})
+
+	g.It("leaves the stale notifications out of the batch", func() {
+		deadline := time.Now().Add(10 * time.Millisecond)
+		_, err := sendNotificationToAllSubscribers("ns:producer",
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(`{"n":1}`), Deadline: &deadline}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		push(`{"n":2}`)
+
+		var batch []byte
+		Eventually(sent).Should(Receive(&batch))
+		Expect(payloadsOf(batch)).To(Equal([]string{`{"n":2}`}))
+	})
+
+	g.It("converts every notification of a batch to the v2 envelope", func() {
+		eaaCtx.consumerConnections.m["ns:consumer0"] = []ConsumerConnection{{
+			connection: notificationV2Conn{&fakeNotificationConn{sent: sent}}}}
+		push(`{"n":1}`)
+		push(`{"n":2}`)
+
+		var data []byte
+		Eventually(sent).Should(Receive(&data))
+		var batch []NotificationToConsumerV2
+		Expect(json.Unmarshal(data, &batch)).To(Succeed())
+		Expect(batch).To(HaveLen(2))
+		Expect(batch[0].Metadata.Name).To(Equal("n1"))
+		Expect(string(batch[1].Payload)).To(Equal(`{"n":2}`))
+	})
+
+	g.It("rejects an aggregation window out of range", func() {
+		Expect(validateSubscriptionNotifications([]NotificationDescriptor{
+			{Name: "n1", Version: "1.0", AggregationWindow: -1}})).ToNot(Succeed())
+		Expect(validateSubscriptionNotifications([]NotificationDescriptor{
+			{Name: "n1", Version: "1.0", AggregationWindow: 60001}})).ToNot(Succeed())
+		Expect(validateSubscriptionNotifications([]NotificationDescriptor{
+			{Name: "n1", Version: "1.0", AggregationWindow: 500}})).To(Succeed())
+	})
+
+	g.It("detects the batches written to a consumer", func() {
+		Expect(isNotificationBatch([]byte(" [{}]"))).To(BeTrue())
+		Expect(isNotificationBatch([]byte(`{"name":"n1"}`))).To(BeFalse())
+	})
+})
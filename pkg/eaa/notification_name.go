@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Matchings of the name of a subscription to the names of the notifications
+const (
+	nameMatchExact  = "exact"
+	nameMatchPrefix = "prefix"
+	nameMatchGlob   = "glob"
+)
+
+// namePatternSeparator separates the matching from the name in the key of
+// a name pattern subscription. It can't be a part of a notification name,
+// which consists of printable characters only, so the pattern keys don't
+// collide with the exact ones.
+const namePatternSeparator = "\x00"
+
+// validateNameMatch checks the name matching of a notification and,
+// for a glob, the pattern syntax
+func validateNameMatch(n NotificationDescriptor) error {
+	switch n.NameMatch {
+	case "", nameMatchExact, nameMatchPrefix:
+		return nil
+	case nameMatchGlob:
+		if _, err := path.Match(n.Name, ""); err != nil {
+			return errors.New("invalid name pattern")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown name match %.16q", n.NameMatch)
+	}
+}
+
+// subscriptionNotifName returns the name a subscription to the notification
+// is indexed by. Exact names are kept as they are, name patterns are
+// prefixed with their matching.
+func subscriptionNotifName(n NotificationDescriptor) string {
+	switch n.NameMatch {
+	case nameMatchPrefix, nameMatchGlob:
+		return namePatternSeparator + n.NameMatch + namePatternSeparator + n.Name
+	default:
+		return n.Name
+	}
+}
+
+// isNotificationNamePattern checks if the subscription name is a name
+// pattern
+func isNotificationNamePattern(subscribed string) bool {
+	return strings.HasPrefix(subscribed, namePatternSeparator)
+}
+
+// notificationNameMatches checks if the name of a subscription, as it is
+// indexed, matches the name of a pushed notification
+func notificationNameMatches(subscribed, pushed string) bool {
+	if !isNotificationNamePattern(subscribed) {
+		return subscribed == pushed
+	}
+
+	parts := strings.SplitN(subscribed[len(namePatternSeparator):], namePatternSeparator, 2)
+	if len(parts) != 2 {
+		return false
+	}
+	switch parts[0] {
+	case nameMatchPrefix:
+		return strings.HasPrefix(pushed, parts[1])
+	case nameMatchGlob:
+		matched, err := path.Match(parts[1], pushed)
+		return err == nil && matched
+	default:
+		return false
+	}
+}
+
+// descriptorNameMatches checks if the notification of a subscription
+// matches the notification name
+func descriptorNameMatches(n NotificationDescriptor, name string) bool {
+	return notificationNameMatches(subscriptionNotifName(n), name)
+}
+
+// getNamePatternSubscribers returns the consumers subscribed to
+// the notification of the service with a name pattern matching its name,
+// in its namespace or a namespace pattern matching it. Subscription info
+// has to be locked by the caller.
+func getNamePatternSubscribers(key UniqueNotif, serviceID string, eaaCtx *Context) []string {
+	var subscriberList []string
+
+	for subKey, conSub := range eaaCtx.subscriptionInfo.m {
+		if !isNotificationNamePattern(subKey.notifName) ||
+			!notificationNameMatches(subKey.notifName, key.notifName) ||
+			!notificationVersionsCompatible(subKey.notifVersion, key.notifVersion) {
+			continue
+		}
+		switch {
+		case subKey.namespace == key.namespace:
+			subscriberList = getUniqueSubsList(subscriberList,
+				getUniqueSubsList(conSub.namespaceSubscriptions,
+					conSub.serviceSubscriptions[serviceID]))
+		case isNamespacePattern(subKey.namespace) &&
+			namespaceMatches(subKey.namespace, key.namespace):
+			subscriberList = getUniqueSubsList(subscriberList,
+				getAllowedSubscribers(conSub.namespaceSubscriptions, key.namespace, eaaCtx))
+		}
+	}
+
+	return subscriberList
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Notification name matching", func() {
+	table.DescribeTable("matches the names of the pushed notifications",
+		func(n NotificationDescriptor, pushed string, matches bool) {
+			Expect(descriptorNameMatches(n, pushed)).To(Equal(matches))
+		},
+		table.Entry("exact name", NotificationDescriptor{Name: "temperature"},
+			"temperature", true),
+		table.Entry("other name", NotificationDescriptor{Name: "temperature"},
+			"temperature.room", false),
+		table.Entry("exact name with a glob", NotificationDescriptor{Name: "temperature.*",
+			NameMatch: nameMatchExact}, "temperature.room", false),
+		table.Entry("prefix", NotificationDescriptor{Name: "temperature.",
+			NameMatch: nameMatchPrefix}, "temperature.room.celsius", true),
+		table.Entry("other prefix", NotificationDescriptor{Name: "temperature.",
+			NameMatch: nameMatchPrefix}, "humidity.room", false),
+		table.Entry("glob", NotificationDescriptor{Name: "temperature.*",
+			NameMatch: nameMatchGlob}, "temperature.room", true),
+		table.Entry("glob within a name", NotificationDescriptor{Name: "temperature.*.celsius",
+			NameMatch: nameMatchGlob}, "temperature.room.celsius", true),
+		table.Entry("glob of another name", NotificationDescriptor{Name: "temperature.*",
+			NameMatch: nameMatchGlob}, "humidity.room", false),
+	)
+
+	g.It("doesn't mix up exact names and patterns", func() {
+		Expect(subscriptionNotifName(NotificationDescriptor{Name: "n*"})).To(Equal("n*"))
+		Expect(subscriptionNotifName(NotificationDescriptor{Name: "n*",
+			NameMatch: nameMatchGlob})).ToNot(Equal("n*"))
+		Expect(subscriptionNotifName(NotificationDescriptor{Name: "n*",
+			NameMatch: nameMatchGlob})).ToNot(Equal(subscriptionNotifName(
+			NotificationDescriptor{Name: "n*", NameMatch: nameMatchPrefix})))
+	})
+
+	var (
+		eaaCtx  *Context
+		exact   chan []byte
+		prefix  chan []byte
+		pattern chan []byte
+	)
+
+	push := func(name string) DeliverySummary {
+		summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: name, Version: "1.0",
+				Payload: json.RawMessage(`{"value":1,"unit":"C"}`)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		return summary
+	}
+
+	g.BeforeEach(func() {
+		exact = make(chan []byte, 2)
+		prefix = make(chan []byte, 2)
+		pattern = make(chan []byte, 2)
+		eaaCtx = newFanOutContext([]notificationConn{
+			&fakeNotificationConn{sent: exact},
+			&fakeNotificationConn{sent: prefix},
+			&fakeNotificationConn{sent: pattern},
+		})
+		delete(eaaCtx.subscriptionInfo.m, UniqueNotif{"ns", "n1", "1.0"})
+
+		Expect(addSubscriptionToNamespace("ns:consumer0", "ns", []NotificationDescriptor{
+			{Name: "temperature.room", Version: "1.0"}}, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToNamespace("ns:consumer1", "ns", []NotificationDescriptor{
+			{Name: "temperature.", Version: "1.0", NameMatch: nameMatchPrefix}},
+			eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToService("ns:consumer2", "ns", "producer",
+			[]NotificationDescriptor{{Name: "*.celsius", Version: "1.0",
+				NameMatch: nameMatchGlob}}, eaaCtx)).To(Succeed())
+	})
+
+	g.It("delivers a notification to the subscribers of a matching prefix", func() {
+		Expect(push("temperature.room")).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 2}))
+		Eventually(exact).Should(Receive())
+		Eventually(prefix).Should(Receive())
+		Consistently(pattern).ShouldNot(Receive())
+	})
+
+	g.It("delivers a notification to the subscribers of a matching glob", func() {
+		Expect(push("temperature.celsius")).To(Equal(DeliverySummary{Subscribers: 2,
+			Delivered: 2}))
+		Eventually(prefix).Should(Receive())
+		Eventually(pattern).Should(Receive())
+		Consistently(exact).ShouldNot(Receive())
+	})
+
+	g.It("leaves a pattern subscription to other versions out", func() {
+		summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "temperature.room", Version: "2.0",
+				Payload: json.RawMessage(`{}`)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(DeliverySummary{}))
+	})
+
+	g.It("prefers the exact subscription of a consumer", func() {
+		Expect(addSubscriptionToNamespace("ns:consumer0", "ns", []NotificationDescriptor{
+			{Name: "temperature.", Version: "1.0", NameMatch: nameMatchPrefix,
+				Transform: &NotificationTransform{Remove: []string{"value"}}},
+			{Name: "temperature.room", Version: "1.0",
+				Transform: &NotificationTransform{Remove: []string{"unit"}}}},
+			eaaCtx)).To(Succeed())
+
+		Expect(push("temperature.room")).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 2}))
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-exact, &notif)).To(Succeed())
+		Expect(notif.Payload).To(MatchJSON(`{"value":1}`))
+		Expect(exact).ToNot(Receive())
+
+		push("temperature.outside")
+		Expect(json.Unmarshal(<-exact, &notif)).To(Succeed())
+		Expect(notif.Payload).To(MatchJSON(`{"unit":"C"}`))
+	})
+
+	g.It("lists and removes a pattern subscription apart from an exact one", func() {
+		Expect(addSubscriptionToNamespace("ns:consumer1", "ns", []NotificationDescriptor{
+			{Name: "temperature.", Version: "1.0"}}, eaaCtx)).To(Succeed())
+
+		subs, err := getConsumerSubscriptions("ns:consumer1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs.Subscriptions).To(HaveLen(1))
+		Expect(subs.Subscriptions[0].Notifications).To(ConsistOf(
+			NotificationDescriptor{Name: "temperature.", Version: "1.0"},
+			NotificationDescriptor{Name: "temperature.", Version: "1.0",
+				NameMatch: nameMatchPrefix}))
+
+		Expect(removeSubscriptionToNamespace("ns:consumer1", "ns", []NotificationDescriptor{
+			{Name: "temperature.", Version: "1.0", NameMatch: nameMatchPrefix}},
+			eaaCtx)).To(Succeed())
+		subs, err = getConsumerSubscriptions("ns:consumer1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs.Subscriptions[0].Notifications).To(Equal([]NotificationDescriptor{
+			{Name: "temperature.", Version: "1.0"}}))
+		Expect(push("temperature.room").Subscribers).To(Equal(1))
+	})
+})
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// notificationSchemas holds the compiled JSON Schemas of notification
+// payloads. Notifications without a schema are not validated.
+type notificationSchemas struct {
+	sync.RWMutex
+	m map[UniqueNotif]*gojsonschema.Schema
+}
+
+// notificationSchemaKey returns the key of the notification of the schema
+func notificationSchemaKey(schema NotificationSchema) UniqueNotif {
+	return UniqueNotif{
+		namespace:    schema.Namespace,
+		notifName:    schema.Notification.Name,
+		notifVersion: schema.Notification.Version,
+	}
+}
+
+// validateNotificationSchemaKey checks if the schema identifies a namespace
+// and a notification
+func validateNotificationSchemaKey(schema NotificationSchema) error {
+	if err := validateURNComponent("namespace", schema.Namespace); err != nil {
+		return err
+	}
+	if schema.Notification.Name == "" || schema.Notification.Version == "" {
+		return errors.New("notification name and version are required")
+	}
+	return nil
+}
+
+// set compiles the schema and replaces the schema of its notification
+func (s *notificationSchemas) set(schema NotificationSchema) error {
+	if err := validateNotificationSchemaKey(schema); err != nil {
+		return err
+	}
+	if len(schema.Schema) == 0 {
+		return errors.New("schema is required")
+	}
+
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema.Schema))
+	if err != nil {
+		return errors.Wrap(err, "Failed to compile the schema")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.m == nil {
+		s.m = make(map[UniqueNotif]*gojsonschema.Schema)
+	}
+	s.m[notificationSchemaKey(schema)] = compiled
+	return nil
+}
+
+// remove removes the schema of the notification, false is returned if
+// there is none
+func (s *notificationSchemas) remove(key UniqueNotif) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.m[key]; !ok {
+		return false
+	}
+	delete(s.m, key)
+	return true
+}
+
+// validate checks if the payload conforms to the schema of the notification,
+// a notification without a schema is always valid
+func (s *notificationSchemas) validate(key UniqueNotif, payload json.RawMessage) error {
+	s.RLock()
+	schema := s.m[key]
+	s.RUnlock()
+
+	if schema == nil {
+		return nil
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return errors.Wrap(err, "Failed to validate the payload")
+	}
+	if !result.Valid() {
+		var violations []string
+		for _, violation := range result.Errors() {
+			violations = append(violations, violation.String())
+		}
+		return errors.New(strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// loadNotificationSchemas compiles the schemas of the EAA config
+func loadNotificationSchemas(eaaCtx *Context) error {
+	for i, schema := range eaaCtx.cfg.NotificationSchemas {
+		if err := eaaCtx.notifSchemas.set(schema); err != nil {
+			return errors.Wrapf(err, "notification schema %d", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Notification schemas", func() {
+	const schema = `{"type":"object","required":["temperature"],
+		"properties":{"temperature":{"type":"number"}}}`
+
+	var eaaCtx *Context
+
+	key := UniqueNotif{"ns", "n1", "1.0"}
+
+	request := func(handler http.HandlerFunc, method string, body string,
+		commonName string) *httptest.ResponseRecorder {
+
+		rec := httptest.NewRecorder()
+		handler(rec, newTLSRequest(method, "/admin/schemas", body, commonName, eaaCtx))
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.cfg.AdminCommonNames = []string{"admin"}
+		eaaCtx.serviceInfo.m = map[string]Service{"ns:producer": {}}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("validates payloads of notifications with a schema only", func() {
+		Expect(eaaCtx.notifSchemas.set(NotificationSchema{Namespace: "ns",
+			Notification: NotificationDescriptor{Name: "n1", Version: "1.0"},
+			Schema:       json.RawMessage(schema)})).To(Succeed())
+
+		Expect(eaaCtx.notifSchemas.validate(key, json.RawMessage(
+			`{"temperature":21.5}`))).To(Succeed())
+		Expect(eaaCtx.notifSchemas.validate(key, json.RawMessage(
+			`{"temperature":"warm"}`))).ToNot(Succeed())
+		Expect(eaaCtx.notifSchemas.validate(UniqueNotif{"ns", "n1", "2.0"},
+			json.RawMessage(`{"temperature":"warm"}`))).To(Succeed())
+	})
+
+	g.It("rejects a non-conforming push with 400", func() {
+		Expect(request(RegisterNotificationSchema, "POST", `{"namespace":"ns",
+			"notification":{"name":"n1","version":"1.0"},"schema":`+schema+`}`,
+			"admin").Code).To(Equal(http.StatusNoContent))
+
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n1","version":"1.0","payload":{}}`, "ns:producer", eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonInvalidPayload))
+		Expect(resp.Detail).To(ContainSubstring("temperature"))
+
+		rec = httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n1","version":"1.0","payload":{"temperature":3}}`,
+			"ns:producer", eaaCtx))
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+	})
+
+	g.It("rejects an invalid schema", func() {
+		rec := request(RegisterNotificationSchema, "POST", `{"namespace":"ns",
+			"notification":{"name":"n1","version":"1.0"},"schema":{"type":"nope"}}`,
+			"admin")
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonInvalidSchema))
+	})
+
+	g.It("deregisters a schema", func() {
+		body := `{"namespace":"ns","notification":{"name":"n1","version":"1.0"},
+			"schema":` + schema + `}`
+		Expect(request(RegisterNotificationSchema, "POST", body,
+			"admin").Code).To(Equal(http.StatusNoContent))
+
+		Expect(request(DeregisterNotificationSchema, "DELETE", body,
+			"ns:producer").Code).To(Equal(http.StatusForbidden))
+		Expect(request(DeregisterNotificationSchema, "DELETE", body,
+			"admin").Code).To(Equal(http.StatusNoContent))
+		Expect(request(DeregisterNotificationSchema, "DELETE", body,
+			"admin").Code).To(Equal(http.StatusNotFound))
+		Expect(eaaCtx.notifSchemas.validate(key, json.RawMessage(`{}`))).To(Succeed())
+	})
+
+	g.It("fails on an invalid schema in the config", func() {
+		eaaCtx.cfg.NotificationSchemas = []NotificationSchema{{Namespace: "ns",
+			Notification: NotificationDescriptor{Name: "n1"},
+			Schema:       json.RawMessage(schema)}}
+
+		Expect(loadNotificationSchemas(eaaCtx)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// notificationSigningContext is the first line of the signing input, so that
+// a signature of a notification can't be taken for a signature of anything
+// else
+const notificationSigningContext = "eaa-notification-v1"
+
+// NotificationSigningInput returns the bytes a producer signs and a consumer
+// verifies the signature of a notification against. They are the lines
+//
+//	eaa-notification-v1
+//	<producer namespace>:<producer ID>
+//	<notification name>
+//	<notification version>
+//	<payload>
+//
+// separated by "\n", the payload isn't followed by a newline. The namespace
+// is in lower case, as EAA normalizes it. The payload is canonicalized the way
+// encoding/json encodes a json.RawMessage: insignificant whitespace is removed
+// and "<", ">", "&", U+2028 and U+2029 in strings are escaped as \u003c,
+// \u003e, \u0026, \u2028 and \u2029. A missing payload is "null". The order
+// of object keys is kept as the producer sent it, EAA doesn't reorder them,
+// so the payload a consumer receives canonicalizes to the one the producer
+// signed.
+func NotificationSigningInput(producer URN, name string, version string,
+	payload json.RawMessage) ([]byte, error) {
+
+	canonical, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to canonicalize the payload")
+	}
+
+	var input bytes.Buffer
+	for _, line := range []string{notificationSigningContext, producer.String(), name,
+		version} {
+		input.WriteString(line)
+		input.WriteByte('\n')
+	}
+	input.Write(canonical)
+	return input.Bytes(), nil
+}
+
+// isSignedNamespace checks if producers have to sign the notifications of
+// the namespace
+func isSignedNamespace(namespace string, eaaCtx *Context) bool {
+	for _, signed := range eaaCtx.config().SignedNamespaces {
+		if normalizeNamespace(signed) == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// validateNotificationSignature checks a notification of the namespace is
+// signed if the namespace requires it and the signature is well-formed.
+// The signature itself isn't verified, EAA has no keys of the producers.
+func validateNotificationSignature(sig *NotificationSignature, namespace string,
+	eaaCtx *Context) error {
+
+	if sig == nil {
+		if isSignedNamespace(namespace, eaaCtx) {
+			return errors.Errorf("notifications of namespace %s have to be signed",
+				namespace)
+		}
+		return nil
+	}
+
+	if sig.Algorithm == "" {
+		return errors.New("signature algorithm is missing")
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return errors.Wrap(err, "signature is not base64 encoded")
+	}
+	if len(value) == 0 {
+		return errors.New("signature is empty")
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Signed notifications", func() {
+	producer := URN{ID: "producer", Namespace: "ns"}
+
+	g.It("canonicalizes the payload", func() {
+		input, err := NotificationSigningInput(producer, "n1", "1.0",
+			json.RawMessage("{ \"a\" : \"<b>\",\n \"c\": [1, 2] }"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(input)).To(Equal("eaa-notification-v1\nns:producer\nn1\n1.0\n" +
+			`{"a":"\u003cb\u003e","c":[1,2]}`))
+
+		input, err = NotificationSigningInput(producer, "n1", "1.0", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(input)).To(HaveSuffix("\nnull"))
+	})
+
+	g.It("relays the signature a consumer verifies", func() {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+
+		payload := json.RawMessage(`{"temperature": 21.5, "unit": "<C>"}`)
+		input, err := NotificationSigningInput(producer, "n1", "1.0", payload)
+		Expect(err).ToNot(HaveOccurred())
+		sig := &NotificationSignature{Algorithm: "Ed25519",
+			Value: base64.StdEncoding.EncodeToString(ed25519.Sign(private, input))}
+
+		conn := &fakeNotificationConn{sent: make(chan []byte, 1)}
+		eaaCtx := newFanOutContext([]notificationConn{conn})
+		_, err = deliverNotification(producer, &NotificationFromProducer{Name: "n1",
+			Version: "1.0", Payload: payload, Signature: sig}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-conn.sent, &notif)).To(Succeed())
+		Expect(notif.Signature).To(Equal(sig))
+
+		received, err := NotificationSigningInput(notif.URN, notif.Name, notif.Version,
+			notif.Payload)
+		Expect(err).ToNot(HaveOccurred())
+		value, err := base64.StdEncoding.DecodeString(notif.Signature.Value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ed25519.Verify(public, received, value)).To(BeTrue())
+	})
+
+	g.It("requires signatures in signed namespaces only", func() {
+		eaaCtx := &Context{}
+		eaaCtx.cfg.SignedNamespaces = []string{"Signed"}
+		sig := &NotificationSignature{Algorithm: "Ed25519",
+			Value: base64.StdEncoding.EncodeToString([]byte("sig"))}
+
+		Expect(validateNotificationSignature(nil, "signed", eaaCtx)).ToNot(Succeed())
+		Expect(validateNotificationSignature(sig, "signed", eaaCtx)).To(Succeed())
+		Expect(validateNotificationSignature(nil, "ns", eaaCtx)).To(Succeed())
+		Expect(validateNotificationSignature(&NotificationSignature{Value: sig.Value},
+			"ns", eaaCtx)).ToNot(Succeed())
+		Expect(validateNotificationSignature(&NotificationSignature{Algorithm: "Ed25519",
+			Value: "not base64!"}, "ns", eaaCtx)).ToNot(Succeed())
+	})
+
+	g.It("rejects unsigned notifications pushed to a signed namespace", func() {
+		eaaCtx := &Context{}
+		eaaCtx.cfg.SignedNamespaces = []string{"ns"}
+
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest(http.MethodPost, "/notifications",
+			`{"name":"n1","version":"1.0","payload":{}}`, "ns:producer", eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonInvalidSignature))
+	})
+})
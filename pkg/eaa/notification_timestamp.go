@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Notifications are stamped with the time EAA received them from
+// the producer, so that consumers can order and age them regardless of
+// the clocks of the producers. The timestamp of a producer is taken from
+// the payload field named by NotificationTimestampField and is normalized
+// to UTC, the payload itself isn't changed.
+
+// receiveClock stamps the notifications pushed to this EAA instance with
+// their receive time. A stamp is always later than the previous one, even
+// if the wall clock goes back or two notifications arrive at once.
+type receiveClock struct {
+	sync.Mutex
+	last time.Time
+}
+
+// stamp returns the receive time of a notification received now
+func (c *receiveClock) stamp(now time.Time) time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	now = now.UTC().Round(0)
+	if !now.After(c.last) {
+		now = c.last.Add(time.Nanosecond)
+	}
+	c.last = now
+	return now
+}
+
+// producerTimestamp returns the timestamp of the producer in the payload
+// field at the path, in UTC. RFC 3339 strings and numbers of seconds since
+// the Unix epoch are accepted, nil is returned for a missing field or
+// a value of another format.
+func producerTimestamp(attrs map[string]interface{}, path string) *time.Time {
+	if path == "" || attrs == nil {
+		return nil
+	}
+	value, found := lookupTransformPath(attrs, path)
+	if !found {
+		return nil
+	}
+
+	var timestamp time.Time
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			log.Debugf("Producer timestamp %q isn't RFC 3339: %v", v, err)
+			return nil
+		}
+		timestamp = parsed
+	case float64:
+		sec, frac := math.Modf(v)
+		timestamp = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+	default:
+		return nil
+	}
+	timestamp = timestamp.UTC()
+	return &timestamp
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Notification timestamps", func() {
+	g.It("stamps notifications with a monotonic receive time in UTC", func() {
+		var clock receiveClock
+		now := time.Now()
+
+		first := clock.stamp(now)
+		Expect(first.Location()).To(Equal(time.UTC))
+		Expect(clock.stamp(now)).To(BeTemporally(">", first))
+		Expect(clock.stamp(now.Add(-time.Hour))).To(BeTemporally(">", first))
+	})
+
+	table.DescribeTable("normalizes the producer timestamp to UTC",
+		func(payload, path string, expected *time.Time) {
+			var attrs map[string]interface{}
+			Expect(json.Unmarshal([]byte(payload), &attrs)).To(Succeed())
+			Expect(producerTimestamp(attrs, path)).To(Equal(expected))
+		},
+		table.Entry("an RFC 3339 string", `{"ts":"2020-06-01T12:00:00.5+02:00"}`, "ts",
+			timestampOf(time.Date(2020, 6, 1, 10, 0, 0, 5e8, time.UTC))),
+		table.Entry("seconds since the epoch", `{"meta":{"ts":1591005600.5}}`, "meta.ts",
+			timestampOf(time.Date(2020, 6, 1, 10, 0, 0, 5e8, time.UTC))),
+		table.Entry("a missing field", `{"value":1}`, "ts", nil),
+		table.Entry("an invalid string", `{"ts":"yesterday"}`, "ts", nil),
+		table.Entry("another type", `{"ts":true}`, "ts", nil),
+		table.Entry("no field configured", `{"ts":1591005600}`, "", nil),
+	)
+
+	g.It("passes both timestamps to the consumers without changing the payload", func() {
+		fake := &fakeNotificationConn{sent: make(chan []byte, 2)}
+		eaaCtx := newFanOutContext([]notificationConn{fake})
+		eaaCtx.cfg.NotificationTimestampField = "ts"
+
+		payloads := []string{`{"ts":"2020-06-01T12:00:00+02:00"}`, `{"ts":1591005600}`}
+		for _, payload := range payloads {
+			_, err := sendNotificationToAllSubscribers("ns:producer",
+				&NotificationFromProducer{Name: "n1", Version: "1.0",
+					Payload:    json.RawMessage(payload),
+					receivedAt: eaaCtx.receiveClock.stamp(time.Now())}, "", eaaCtx)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		var first, second NotificationToConsumer
+		Expect(json.Unmarshal(<-fake.sent, &first)).To(Succeed())
+		Expect(json.Unmarshal(<-fake.sent, &second)).To(Succeed())
+		Expect(string(first.Payload)).To(Equal(payloads[0]))
+		Expect(string(second.Payload)).To(Equal(payloads[1]))
+		Expect(*second.ReceivedAt).To(BeTemporally(">", *first.ReceivedAt))
+		Expect(first.ProducerTimestamp.Equal(time.Date(2020, 6, 1, 10, 0, 0, 0,
+			time.UTC))).To(BeTrue())
+		Expect(second.ProducerTimestamp.Equal(*first.ProducerTimestamp)).To(BeTrue())
+	})
+})
+
+// timestampOf returns a pointer to the time
+func timestampOf(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Limits of a notification transform. Transforms are declarative, so
+// they can't run arbitrary code, and the limits bound the work done for
+// each delivered notification.
+const (
+	maxTransformRules      = 32
+	maxTransformPathDepth  = 8
+	maxTransformPathLength = 256
+	// maxTransformPayloadSize bounds the size of a payload to reshape
+	maxTransformPayloadSize = 64 << 10
+)
+
+var (
+	// errTransformTooLarge is returned for a payload exceeding
+	// maxTransformPayloadSize, or a transform exceeding maxTransformRules
+	errTransformTooLarge = errors.New("notification transform exceeds its limits")
+	// errTransformNotObject is returned for a payload which isn't an object
+	// when the transform removes attributes, as they can't be removed
+	errTransformNotObject = errors.New("notification payload isn't an object")
+)
+
+// validateNotificationTransform checks the rules of a subscription transform
+func validateNotificationTransform(t *NotificationTransform) error {
+	if t == nil {
+		return nil
+	}
+	if len(t.Select)+len(t.Remove)+len(t.Rename) > maxTransformRules {
+		return fmt.Errorf("transform has more than %d rules", maxTransformRules)
+	}
+	for _, path := range t.Select {
+		if err := validateTransformPath(path); err != nil {
+			return fmt.Errorf("transform select: %v", err)
+		}
+	}
+	for _, path := range t.Remove {
+		if err := validateTransformPath(path); err != nil {
+			return fmt.Errorf("transform remove: %v", err)
+		}
+	}
+	targets := make(map[string]bool)
+	for from, to := range t.Rename {
+		if err := validateTransformPath(from); err != nil {
+			return fmt.Errorf("transform rename: %v", err)
+		}
+		if err := validateTransformPath(to); err != nil {
+			return fmt.Errorf("transform rename: %v", err)
+		}
+		if targets[to] {
+			return fmt.Errorf("transform renames several attributes to %.64q", to)
+		}
+		targets[to] = true
+	}
+	return nil
+}
+
+// validateTransformPath checks an attribute path of a transform
+func validateTransformPath(path string) error {
+	if len(path) > maxTransformPathLength {
+		return fmt.Errorf("path exceeds %d bytes", maxTransformPathLength)
+	}
+	names := strings.Split(path, ".")
+	if len(names) > maxTransformPathDepth {
+		return fmt.Errorf("path %.64q is deeper than %d attributes", path,
+			maxTransformPathDepth)
+	}
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("path %.64q has an empty attribute", path)
+		}
+	}
+	return nil
+}
+
+// applyNotificationTransform returns the payload reshaped by the transform.
+// The payload is decoded anew, so the payloads delivered to other
+// subscribers are left intact.
+func applyNotificationTransform(payload json.RawMessage,
+	t *NotificationTransform) (json.RawMessage, error) {
+
+	if len(payload) > maxTransformPayloadSize ||
+		len(t.Select)+len(t.Remove)+len(t.Rename) > maxTransformRules {
+		return nil, errTransformTooLarge
+	}
+
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(payload, &attrs); err != nil || attrs == nil {
+		// Only the attributes of an object can be reshaped, the payload
+		// isn't delivered if it should have attributes removed
+		if len(t.Remove) > 0 {
+			return nil, errTransformNotObject
+		}
+		return payload, nil
+	}
+
+	if len(t.Select) > 0 {
+		selected := make(map[string]interface{})
+		for _, path := range t.Select {
+			if value, found := lookupTransformPath(attrs, path); found {
+				setTransformPath(selected, path, value)
+			}
+		}
+		attrs = selected
+	}
+
+	for _, path := range t.Remove {
+		removeTransformPath(attrs, path)
+	}
+
+	// All renamed attributes are taken out before any is put back, so that
+	// the result doesn't depend on the order of the renames
+	sources := make([]string, 0, len(t.Rename))
+	for from := range t.Rename {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+	values := make(map[string]interface{}, len(sources))
+	for _, from := range sources {
+		if value, found := lookupTransformPath(attrs, from); found {
+			values[from] = value
+			removeTransformPath(attrs, from)
+		}
+	}
+	for _, from := range sources {
+		if value, found := values[from]; found {
+			setTransformPath(attrs, t.Rename[from], value)
+		}
+	}
+
+	transformed, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode the transformed payload")
+	}
+	return transformed, nil
+}
+
+// transformNotification encodes the notification with its payload reshaped
+// by the transform of a subscription. The signature of the producer doesn't
+// cover the reshaped payload, so it's left out.
+func transformNotification(notif NotificationToConsumer,
+	t *NotificationTransform) ([]byte, error) {
+
+	payload, err := applyNotificationTransform(notif.Payload, t)
+	if err != nil {
+		return nil, err
+	}
+	notif.Payload = payload
+	notif.Signature = nil
+	msgPayload, err := json.Marshal(notif)
+	return msgPayload, errors.Wrap(err, "Failed to marshal the transformed notification")
+}
+
+// lookupTransformPath returns the value of the attribute at the path
+func lookupTransformPath(attrs map[string]interface{}, path string) (interface{}, bool) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		nested, isObject := attrs[name].(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		attrs = nested
+	}
+	value, found := attrs[names[len(names)-1]]
+	return value, found
+}
+
+// setTransformPath sets the attribute at the path, creating the missing
+// objects on the way. An attribute which isn't an object on the way is
+// replaced.
+func setTransformPath(attrs map[string]interface{}, path string, value interface{}) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		nested, isObject := attrs[name].(map[string]interface{})
+		if !isObject {
+			nested = make(map[string]interface{})
+			attrs[name] = nested
+		}
+		attrs = nested
+	}
+	attrs[names[len(names)-1]] = value
+}
+
+// removeTransformPath removes the attribute at the path
+func removeTransformPath(attrs map[string]interface{}, path string) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		nested, isObject := attrs[name].(map[string]interface{})
+		if !isObject {
+			return
+		}
+		attrs = nested
+	}
+	delete(attrs, names[len(names)-1])
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"strings"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Notification transform", func() {
+	table.DescribeTable("is validated",
+		func(transform *NotificationTransform, valid bool) {
+			err := validateNotificationTransform(transform)
+			if valid {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		table.Entry("none", nil, true),
+		table.Entry("valid", &NotificationTransform{Select: []string{"a", "b.c"},
+			Remove: []string{"b.c.secret"}, Rename: map[string]string{"a": "x.y"}}, true),
+		table.Entry("empty attribute", &NotificationTransform{Remove: []string{"a..b"}}, false),
+		table.Entry("empty path", &NotificationTransform{Select: []string{""}}, false),
+		table.Entry("too deep", &NotificationTransform{
+			Remove: []string{strings.Repeat("a.", maxTransformPathDepth) + "a"}}, false),
+		table.Entry("too long", &NotificationTransform{
+			Rename: map[string]string{"a": strings.Repeat("a", maxTransformPathLength+1)}},
+			false),
+		table.Entry("too many rules", &NotificationTransform{
+			Remove: make([]string, maxTransformRules+1)}, false),
+		table.Entry("same rename target", &NotificationTransform{
+			Rename: map[string]string{"a": "c", "b": "c"}}, false),
+	)
+
+	table.DescribeTable("reshapes the payload",
+		func(payload string, transform NotificationTransform, expected string) {
+			transformed, err := applyNotificationTransform(json.RawMessage(payload),
+				&transform)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transformed).To(MatchJSON(expected))
+		},
+		table.Entry("select",
+			`{"a":1,"b":{"c":2,"d":3},"e":4}`,
+			NotificationTransform{Select: []string{"a", "b.c", "missing"}},
+			`{"a":1,"b":{"c":2}}`),
+		table.Entry("remove",
+			`{"a":1,"b":{"c":2,"d":3}}`,
+			NotificationTransform{Remove: []string{"b.d", "a.x", "missing"}},
+			`{"a":1,"b":{"c":2}}`),
+		table.Entry("rename",
+			`{"a":1,"b":2,"c":{"d":3}}`,
+			NotificationTransform{Rename: map[string]string{"a": "b", "b": "a", "c.d": "e.f"}},
+			`{"a":2,"b":1,"c":{},"e":{"f":3}}`),
+		table.Entry("all rules",
+			`{"id":7,"user":{"name":"x","token":"secret"},"raw":"..."}`,
+			NotificationTransform{Select: []string{"id", "user"},
+				Remove: []string{"user.token"}, Rename: map[string]string{"user.name": "owner"}},
+			`{"id":7,"user":{},"owner":"x"}`),
+		table.Entry("not an object",
+			`[1,2]`,
+			NotificationTransform{Select: []string{"a"}},
+			`[1,2]`),
+	)
+
+	table.DescribeTable("isn't applied",
+		func(payload string, transform NotificationTransform, expected error) {
+			_, err := applyNotificationTransform(json.RawMessage(payload), &transform)
+			Expect(err).To(Equal(expected))
+		},
+		table.Entry("to a too large payload",
+			`{"a":"`+strings.Repeat("x", maxTransformPayloadSize)+`"}`,
+			NotificationTransform{Select: []string{"a"}},
+			errTransformTooLarge),
+		table.Entry("with too many rules",
+			`{"a":1}`,
+			NotificationTransform{Remove: make([]string, maxTransformRules+1)},
+			errTransformTooLarge),
+		table.Entry("removing from a payload which isn't an object",
+			`[{"secret":"s"}]`,
+			NotificationTransform{Remove: []string{"secret"}},
+			errTransformNotObject),
+	)
+
+	g.It("is applied only to the notifications of its subscription", func() {
+		transformed := make(chan []byte, 1)
+		unchanged := make(chan []byte, 1)
+		eaaCtx := newFanOutContext([]notificationConn{
+			&fakeNotificationConn{sent: transformed},
+			&fakeNotificationConn{sent: unchanged},
+		})
+		eaaCtx.cfg.NotificationReplayBufferSize = 10
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].setTransform("",
+			"ns:consumer0", &NotificationTransform{Remove: []string{"secret"}})
+
+		payload := json.RawMessage(`{"value":1,"secret":"s"}`)
+		summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0", Payload: payload,
+				Signature: &NotificationSignature{Algorithm: "Ed25519", Value: "c2ln"}},
+			"", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 2}))
+
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-transformed, &notif)).To(Succeed())
+		Expect(notif.Payload).To(MatchJSON(`{"value":1}`))
+		Expect(notif.Signature).To(BeNil())
+		Expect(eaaCtx.replayBuffers.since("ns:consumer0", 0, connectionFilter{})[0]).
+			ToNot(ContainSubstring("secret"))
+
+		Expect(json.Unmarshal(<-unchanged, &notif)).To(Succeed())
+		Expect(notif.Payload).To(MatchJSON(payload))
+		Expect(notif.Signature).ToNot(BeNil())
+	})
+
+	g.It("is kept with the subscription", func() {
+		eaaCtx := newFanOutContext(nil)
+		transform := &NotificationTransform{Rename: map[string]string{"a": "b"}}
+		Expect(addSubscriptionToNamespace("ns:consumer", "ns",
+			[]NotificationDescriptor{{Name: "n2", Version: "1.0", Transform: transform}},
+			eaaCtx)).To(Succeed())
+
+		list, err := getConsumerSubscriptions("ns:consumer", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list.Subscriptions).To(HaveLen(1))
+		Expect(list.Subscriptions[0].Notifications[0].Transform).To(Equal(transform))
+
+		Expect(addSubscriptionToNamespace("ns:consumer", "ns",
+			[]NotificationDescriptor{{Name: "n3", Version: "1.0",
+				Transform: &NotificationTransform{Remove: []string{"."}}}},
+			eaaCtx)).ToNot(Succeed())
+	})
+})
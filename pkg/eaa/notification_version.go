@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Version mismatch notices are notifications EAA sends on behalf of
+// the reserved discovery producer to a consumer subscribed to a notification
+// only in versions incompatible with the one a producer pushed, if
+// VersionMismatchNotices is enabled. The payload of the notices is
+// a VersionMismatchNotice. A consumer is told about the same mismatch at
+// most once per versionMismatchNoticeInterval.
+const (
+	versionMismatchNotificationName    = "version-mismatch"
+	versionMismatchNotificationVersion = "1.0"
+	versionMismatchNoticeInterval      = time.Minute
+)
+
+// notificationVersionsCompatible checks if a notification pushed in
+// a version can be delivered to a subscription to the given version.
+// The versions have to match exactly: they are opaque labels, e.g. "1.0",
+// "v2" or "2020-10", so no ordering or range of compatible versions can be
+// derived from them, and a producer changing the schema of a payload has to
+// change its version. The subscriptions are indexed by the version, so
+// the exact namespace and service subscriptions are matched by the lookup.
+func notificationVersionsCompatible(subscribed, pushed string) bool {
+	return subscribed == pushed
+}
+
+// versionMismatchedSubscribers returns the consumers subscribed to
+// the notification of the service only in versions incompatible with
+// the pushed one, with the versions they are subscribed to. The subscribers
+// of a compatible version are left out. Subscription info has to be locked
+// by the caller.
+func versionMismatchedSubscribers(key UniqueNotif, serviceID string, subscribers []string,
+	eaaCtx *Context) map[string][]string {
+
+	compatible := make(map[string]bool, len(subscribers))
+	for _, subID := range subscribers {
+		compatible[subID] = true
+	}
+
+	versions := make(map[string]map[string]bool)
+	for subKey, conSub := range eaaCtx.subscriptionInfo.m {
+		if !notificationNameMatches(subKey.notifName, key.notifName) ||
+			notificationVersionsCompatible(subKey.notifVersion, key.notifVersion) {
+			continue
+		}
+		var subList []string
+		switch {
+		case subKey.namespace == key.namespace:
+			subList = getUniqueSubsList(conSub.namespaceSubscriptions,
+				conSub.serviceSubscriptions[serviceID])
+		case isNamespacePattern(subKey.namespace) &&
+			namespaceMatches(subKey.namespace, key.namespace):
+			subList = getAllowedSubscribers(conSub.namespaceSubscriptions, key.namespace,
+				eaaCtx)
+		}
+		for _, subID := range subList {
+			if compatible[subID] {
+				continue
+			}
+			if versions[subID] == nil {
+				versions[subID] = make(map[string]bool)
+			}
+			versions[subID][subKey.notifVersion] = true
+		}
+	}
+
+	mismatched := make(map[string][]string, len(versions))
+	for subID, subVersions := range versions {
+		for version := range subVersions {
+			mismatched[subID] = append(mismatched[subID], version)
+		}
+		sort.Strings(mismatched[subID])
+	}
+	return mismatched
+}
+
+// versionMismatchHash identifies the mismatch notice of a consumer about
+// the notification of the producer, to throttle it
+func versionMismatchHash(subID string, prodURN URN,
+	notif *NotificationFromProducer) notificationHash {
+
+	return hashNotification(prodURN, &NotificationFromProducer{
+		Name:    notif.Name,
+		Version: notif.Version,
+		Payload: []byte(subID),
+	})
+}
+
+// sendVersionMismatchNotices tells the consumers subscribed to
+// the notification only in incompatible versions that the producer pushed
+// it in another version
+func sendVersionMismatchNotices(prodURN URN, notif *NotificationFromProducer,
+	mismatched map[string][]string, correlationID string, eaaCtx *Context) {
+
+	noticeKey := UniqueNotif{
+		namespace:    discoveryNamespace,
+		notifName:    versionMismatchNotificationName,
+		notifVersion: versionMismatchNotificationVersion,
+	}
+	now := time.Now()
+	var recipients []string
+	payloads := make(map[string][]byte, len(mismatched))
+	for subID, versions := range mismatched {
+		if !connectionAccepts(subID, noticeKey, eaaCtx) ||
+			eaaCtx.versionMismatches.isDuplicate(versionMismatchHash(subID, prodURN, notif),
+				versionMismatchNoticeInterval, now) {
+			continue
+		}
+
+		notice, err := json.Marshal(VersionMismatchNotice{
+			Producer:           prodURN,
+			Name:               notif.Name,
+			Version:            notif.Version,
+			SubscribedVersions: versions,
+		})
+		if err != nil {
+			log.Errf("Failed to marshal the version mismatch notice for %s: %v", subID, err)
+			continue
+		}
+		msgPayload, err := json.Marshal(NotificationToConsumer{
+			Name:          versionMismatchNotificationName,
+			Version:       versionMismatchNotificationVersion,
+			Payload:       notice,
+			URN:           URN{Namespace: discoveryNamespace, ID: discoveryProducerID},
+			CorrelationID: correlationID,
+		})
+		if err != nil {
+			log.Errf("Failed to marshal the version mismatch notice for %s: %v", subID, err)
+			continue
+		}
+		recipients = append(recipients, subID)
+		payloads[subID] = msgPayload
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	log.Infof("Notification %s:%s of %s mismatches the subscribed versions of %d consumers",
+		notif.Name, notif.Version, prodURN.String(), len(recipients))
+	sendNotificationToSubscribers(recipients, &noticeKey, nil, payloads, "", time.Time{},
+		correlationID, eaaCtx)
+}
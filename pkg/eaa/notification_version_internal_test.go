@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Notification version compatibility", func() {
+	table.DescribeTable("requires an exact match",
+		func(subscribed, pushed string, compatible bool) {
+			Expect(notificationVersionsCompatible(subscribed, pushed)).To(Equal(compatible))
+		},
+		table.Entry("same version", "1.0", "1.0", true),
+		table.Entry("same label", "v2", "v2", true),
+		table.Entry("minor version", "1.0", "1.1", false),
+		table.Entry("older version", "2.0", "1.0", false),
+		table.Entry("same number", "1.0", "1.0.0", false),
+		table.Entry("other label", "v2", "2.0", false),
+	)
+
+	var (
+		eaaCtx     *Context
+		compatible chan []byte
+		mismatched chan []byte
+		both       chan []byte
+	)
+
+	push := func() DeliverySummary {
+		summary, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(`{"value":1}`)}, "c1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		return summary
+	}
+
+	g.BeforeEach(func() {
+		compatible = make(chan []byte, 2)
+		both = make(chan []byte, 2)
+		mismatched = make(chan []byte, 2)
+		eaaCtx = newFanOutContext([]notificationConn{
+			&fakeNotificationConn{sent: compatible},
+			&fakeNotificationConn{sent: both},
+		})
+		eaaCtx.consumerConnections.m["ns:consumer2"] = []ConsumerConnection{{
+			connection: &fakeNotificationConn{sent: mismatched}}}
+		for _, subID := range []string{"ns:consumer1", "ns:consumer2"} {
+			Expect(addSubscriptionToNamespace(subID, "ns",
+				[]NotificationDescriptor{{Name: "n1", Version: "2.0"}}, eaaCtx)).To(Succeed())
+		}
+		Expect(addSubscriptionToNamespace("ns:consumer2", "n*",
+			[]NotificationDescriptor{{Name: "n1", Version: "3.0"}}, eaaCtx)).To(Succeed())
+	})
+
+	g.It("delivers a notification to the subscribers of its version only", func() {
+		Expect(push()).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 2}))
+
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-compatible, &notif)).To(Succeed())
+		Expect(notif.Version).To(Equal("1.0"))
+		Expect(json.Unmarshal(<-both, &notif)).To(Succeed())
+		Expect(notif.Version).To(Equal("1.0"))
+		Consistently(mismatched).ShouldNot(Receive())
+	})
+
+	g.It("tells the subscribers of other versions about the mismatch", func() {
+		eaaCtx.cfg.VersionMismatchNotices = true
+		Expect(push()).To(Equal(DeliverySummary{Subscribers: 2, Delivered: 2}))
+
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(<-mismatched, &notif)).To(Succeed())
+		Expect(notif.Name).To(Equal(versionMismatchNotificationName))
+		Expect(notif.URN).To(Equal(URN{Namespace: discoveryNamespace, ID: discoveryProducerID}))
+		Expect(notif.CorrelationID).To(Equal("c1"))
+		var notice VersionMismatchNotice
+		Expect(json.Unmarshal(notif.Payload, &notice)).To(Succeed())
+		Expect(notice).To(Equal(VersionMismatchNotice{
+			Producer:           URN{ID: "producer", Namespace: "ns"},
+			Name:               "n1",
+			Version:            "1.0",
+			SubscribedVersions: []string{"2.0", "3.0"},
+		}))
+
+		Expect(json.Unmarshal(<-both, &notif)).To(Succeed())
+		Expect(notif.Name).To(Equal("n1"))
+		Expect(both).ToNot(Receive())
+
+		// The same mismatch is told once per interval
+		push()
+		Consistently(mismatched).ShouldNot(Receive())
+	})
+
+	g.It("tells about the mismatch when no subscription matches", func() {
+		eaaCtx.cfg.VersionMismatchNotices = true
+		delete(eaaCtx.subscriptionInfo.m, UniqueNotif{"ns", "n1", "1.0"})
+
+		Expect(push()).To(Equal(DeliverySummary{}))
+		Eventually(mismatched).Should(Receive())
+		Eventually(both).Should(Receive())
+		Expect(compatible).ToNot(Receive())
+	})
+})
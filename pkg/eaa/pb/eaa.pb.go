@@ -0,0 +1,742 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: eaa.proto
+
+package pb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	empty "github.com/golang/protobuf/ptypes/empty"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type URN struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Namespace            string   `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *URN) Reset()         { *m = URN{} }
+func (m *URN) String() string { return proto.CompactTextString(m) }
+func (*URN) ProtoMessage()    {}
+func (*URN) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c55543a9c5978491, []int{0}
+}
+
+func (m *URN) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_URN.Unmarshal(m, b)
+}
+func (m *URN) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_URN.Marshal(b, m, deterministic)
+}
+func (m *URN) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_URN.Merge(m, src)
+}
+func (m *URN) XXX_Size() int {
+	return xxx_messageInfo_URN.Size(m)
+}
+func (m *URN) XXX_DiscardUnknown() {
+	xxx_messageInfo_URN.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_URN proto.InternalMessageInfo
+
+func (m *URN) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *URN) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+type NotificationDescriptor struct {
+	Name        string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Version     string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Description string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	// Only notifications with a payload containing all the attributes
+	// with equal values are delivered
+	Filter               map[string]string `protobuf:"bytes,4,rep,name=filter,proto3" json:"filter,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *NotificationDescriptor) Reset()         { *m = NotificationDescriptor{} }
+func (m *NotificationDescriptor) String() string { return proto.CompactTextString(m) }
+func (*NotificationDescriptor) ProtoMessage()    {}
+func (*NotificationDescriptor) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c55543a9c5978491, []int{1}
+}
+
+func (m *NotificationDescriptor) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NotificationDescriptor.Unmarshal(m, b)
+}
+func (m *NotificationDescriptor) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NotificationDescriptor.Marshal(b, m, deterministic)
+}
+func (m *NotificationDescriptor) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NotificationDescriptor.Merge(m, src)
+}
+func (m *NotificationDescriptor) XXX_Size() int {
+	return xxx_messageInfo_NotificationDescriptor.Size(m)
+}
+func (m *NotificationDescriptor) XXX_DiscardUnknown() {
+	xxx_messageInfo_NotificationDescriptor.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NotificationDescriptor proto.InternalMessageInfo
+
+func (m *NotificationDescriptor) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *NotificationDescriptor) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *NotificationDescriptor) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *NotificationDescriptor) GetFilter() map[string]string {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+type Service struct {
+	Urn           *URN                      `protobuf:"bytes,1,opt,name=urn,proto3" json:"urn,omitempty"`
+	Description   string                    `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	EndpointUri   string                    `protobuf:"bytes,3,opt,name=endpoint_uri,json=endpointUri,proto3" json:"endpoint_uri,omitempty"`
+	Status        string                    `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	Notifications []*NotificationDescriptor `protobuf:"bytes,5,rep,name=notifications,proto3" json:"notifications,omitempty"`
+	// JSON encoded information about the service
+	Info []byte `protobuf:"bytes,6,opt,name=info,proto3" json:"info,omitempty"`
+	// Time to live in seconds, 0 means the EAA default TTL is used
+	Ttl                  uint32   `protobuf:"varint,7,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Service) Reset()         { *m = Service{} }
+func (m *Service) String() string { return proto.CompactTextString(m) }
+func (*Service) ProtoMessage()    {}
+func (*Service) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c55543a9c5978491, []int{2}
+}
+
+func (m *Service) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Service.Unmarshal(m, b)
+}
+func (m *Service) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Service.Marshal(b, m, deterministic)
+}
+func (m *Service) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Service.Merge(m, src)
+}
+func (m *Service) XXX_Size() int {
+	return xxx_messageInfo_Service.Size(m)
+}
+func (m *Service) XXX_DiscardUnknown() {
+	xxx_messageInfo_Service.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Service proto.InternalMessageInfo
+
+func (m *Service) GetUrn() *URN {
+	if m != nil {
+		return m.Urn
+	}
+	return nil
+}
+
+func (m *Service) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *Service) GetEndpointUri() string {
+	if m != nil {
+		return m.EndpointUri
+	}
+	return ""
+}
+
+func (m *Service) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *Service) GetNotifications() []*NotificationDescriptor {
+	if m != nil {
+		return m.Notifications
+	}
+	return nil
+}
+
+func (m *Service) GetInfo() []byte {
+	if m != nil {
+		return m.Info
+	}
+	return nil
+}
+
+func (m *Service) GetTtl() uint32 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+type ServiceList struct {
+	Services             []*Service `protobuf:"bytes,1,rep,name=services,proto3" json:"services,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *ServiceList) Reset()         { *m = ServiceList{} }
+func (m *ServiceList) String() string { return proto.CompactTextString(m) }
+func (*ServiceList) ProtoMessage()    {}
+func (*ServiceList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c55543a9c5978491, []int{3}
+}
+
+func (m *ServiceList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ServiceList.Unmarshal(m, b)
+}
+func (m *ServiceList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ServiceList.Marshal(b, m, deterministic)
+}
+func (m *ServiceList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ServiceList.Merge(m, src)
+}
+func (m *ServiceList) XXX_Size() int {
+	return xxx_messageInfo_ServiceList.Size(m)
+}
+func (m *ServiceList) XXX_DiscardUnknown() {
+	xxx_messageInfo_ServiceList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ServiceList proto.InternalMessageInfo
+
+func (m *ServiceList) GetServices() []*Service {
+	if m != nil {
+		return m.Services
+	}
+	return nil
+}
+
+type Subscription struct {
+	Urn                  *URN                      `protobuf:"bytes,1,opt,name=urn,proto3" json:"urn,omitempty"`
+	Notifications        []*NotificationDescriptor `protobuf:"bytes,2,rep,name=notifications,proto3" json:"notifications,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
+	XXX_unrecognized     []byte                    `json:"-"`
+	XXX_sizecache        int32                     `json:"-"`
+}
+
+func (m *Subscription) Reset()         { *m = Subscription{} }
+func (m *Subscription) String() string { return proto.CompactTextString(m) }
+func (*Subscription) ProtoMessage()    {}
+func (*Subscription) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c55543a9c5978491, []int{4}
+}
+
+func (m *Subscription) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Subscription.Unmarshal(m, b)
+}
+func (m *Subscription) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Subscription.Marshal(b, m, deterministic)
+}
+func (m *Subscription) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Subscription.Merge(m, src)
+}
+func (m *Subscription) XXX_Size() int {
+	return xxx_messageInfo_Subscription.Size(m)
+}
+func (m *Subscription) XXX_DiscardUnknown() {
+	xxx_messageInfo_Subscription.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Subscription proto.InternalMessageInfo
+
+func (m *Subscription) GetUrn() *URN {
+	if m != nil {
+		return m.Urn
+	}
+	return nil
+}
+
+func (m *Subscription) GetNotifications() []*NotificationDescriptor {
+	if m != nil {
+		return m.Notifications
+	}
+	return nil
+}
+
+type Notification struct {
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	// JSON encoded payload
+	Payload  []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Producer *URN   `protobuf:"bytes,4,opt,name=producer,proto3" json:"producer,omitempty"`
+	// Monotonic sequence number of the notification
+	Sequence             uint64   `protobuf:"varint,5,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Notification) Reset()         { *m = Notification{} }
+func (m *Notification) String() string { return proto.CompactTextString(m) }
+func (*Notification) ProtoMessage()    {}
+func (*Notification) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c55543a9c5978491, []int{5}
+}
+
+func (m *Notification) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Notification.Unmarshal(m, b)
+}
+func (m *Notification) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Notification.Marshal(b, m, deterministic)
+}
+func (m *Notification) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Notification.Merge(m, src)
+}
+func (m *Notification) XXX_Size() int {
+	return xxx_messageInfo_Notification.Size(m)
+}
+func (m *Notification) XXX_DiscardUnknown() {
+	xxx_messageInfo_Notification.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Notification proto.InternalMessageInfo
+
+func (m *Notification) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Notification) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *Notification) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Notification) GetProducer() *URN {
+	if m != nil {
+		return m.Producer
+	}
+	return nil
+}
+
+func (m *Notification) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*URN)(nil), "pb.URN")
+	proto.RegisterType((*NotificationDescriptor)(nil), "pb.NotificationDescriptor")
+	proto.RegisterMapType((map[string]string)(nil), "pb.NotificationDescriptor.FilterEntry")
+	proto.RegisterType((*Service)(nil), "pb.Service")
+	proto.RegisterType((*ServiceList)(nil), "pb.ServiceList")
+	proto.RegisterType((*Subscription)(nil), "pb.Subscription")
+	proto.RegisterType((*Notification)(nil), "pb.Notification")
+}
+
+func init() { proto.RegisterFile("eaa.proto", fileDescriptor_c55543a9c5978491) }
+
+var fileDescriptor_c55543a9c5978491 = []byte{
+	// 537 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x53, 0x5d, 0x6f, 0xd3, 0x3c,
+	0x14, 0x5e, 0x92, 0x7e, 0x9e, 0xb4, 0xef, 0x5b, 0x59, 0xa8, 0x0a, 0x85, 0x8b, 0x10, 0x24, 0xe8,
+	0x55, 0x06, 0x9d, 0x04, 0x1b, 0x12, 0x13, 0x17, 0x2b, 0xdc, 0xa0, 0x5e, 0x78, 0xea, 0x35, 0x72,
+	0x12, 0xb7, 0xb2, 0xd6, 0xd9, 0xc1, 0x76, 0x2a, 0xf5, 0x97, 0xf0, 0x03, 0x11, 0x17, 0xfc, 0x0b,
+	0x64, 0x37, 0xe9, 0xd2, 0x8d, 0x56, 0x1a, 0x77, 0xe7, 0xeb, 0xf1, 0x39, 0xcf, 0x73, 0x8e, 0xa1,
+	0x4b, 0x09, 0x89, 0x73, 0x29, 0xb4, 0x40, 0x6e, 0x9e, 0x8c, 0x9e, 0x2d, 0x85, 0x58, 0xae, 0xe8,
+	0xa9, 0x8d, 0x24, 0xc5, 0xe2, 0x94, 0xde, 0xe6, 0x7a, 0xb3, 0x2d, 0x88, 0xce, 0xc0, 0x9b, 0xe3,
+	0x19, 0xfa, 0x0f, 0x5c, 0x96, 0x05, 0x4e, 0xe8, 0x8c, 0xbb, 0xd8, 0x65, 0x19, 0x7a, 0x0e, 0x5d,
+	0x4e, 0x6e, 0xa9, 0xca, 0x49, 0x4a, 0x03, 0xd7, 0x86, 0xef, 0x02, 0xd1, 0x4f, 0x07, 0x86, 0x33,
+	0xa1, 0xd9, 0x82, 0xa5, 0x44, 0x33, 0xc1, 0xaf, 0xa8, 0x4a, 0x25, 0xcb, 0xb5, 0x90, 0x08, 0x41,
+	0xc3, 0xd4, 0x95, 0x4f, 0x59, 0x1b, 0x05, 0xd0, 0x5e, 0x53, 0xa9, 0x98, 0xe0, 0xe5, 0x53, 0x95,
+	0x8b, 0x42, 0xf0, 0xb3, 0x12, 0x6b, 0xb2, 0x9e, 0xcd, 0xd6, 0x43, 0xe8, 0x12, 0x5a, 0x0b, 0xb6,
+	0xd2, 0x54, 0x06, 0x8d, 0xd0, 0x1b, 0xfb, 0x93, 0x57, 0x71, 0x9e, 0xc4, 0x7f, 0xef, 0x1d, 0x7f,
+	0xb6, 0x85, 0x53, 0xae, 0xe5, 0x06, 0x97, 0xa8, 0xd1, 0x05, 0xf8, 0xb5, 0x30, 0x1a, 0x80, 0x77,
+	0x43, 0x37, 0xe5, 0x74, 0xc6, 0x44, 0x4f, 0xa0, 0xb9, 0x26, 0xab, 0xa2, 0x62, 0xb9, 0x75, 0x3e,
+	0xb8, 0xe7, 0x4e, 0xf4, 0xdb, 0x81, 0xf6, 0x35, 0x95, 0x6b, 0x96, 0x52, 0xf4, 0x14, 0xbc, 0x42,
+	0x72, 0x8b, 0xf3, 0x27, 0x6d, 0x33, 0xc3, 0x1c, 0xcf, 0xb0, 0x89, 0xdd, 0xe7, 0xe0, 0x3e, 0xe4,
+	0xf0, 0x02, 0x7a, 0x94, 0x67, 0xb9, 0x60, 0x5c, 0x7f, 0x2b, 0x24, 0xab, 0x68, 0x56, 0xb1, 0xb9,
+	0x64, 0x68, 0x08, 0x2d, 0xa5, 0x89, 0x2e, 0x54, 0xd0, 0xb0, 0xc9, 0xd2, 0x43, 0x9f, 0xa0, 0xcf,
+	0x6b, 0x64, 0x55, 0xd0, 0xb4, 0x2a, 0x8c, 0x0e, 0xab, 0x80, 0xf7, 0x01, 0x66, 0x21, 0x8c, 0x2f,
+	0x44, 0xd0, 0x0a, 0x9d, 0x71, 0x0f, 0x5b, 0xdb, 0xa8, 0xa0, 0xf5, 0x2a, 0x68, 0x87, 0xce, 0xb8,
+	0x8f, 0x8d, 0x19, 0xbd, 0x03, 0xbf, 0xa4, 0xfa, 0x95, 0x29, 0x8d, 0x5e, 0x43, 0x47, 0x6d, 0x5d,
+	0x15, 0x38, 0xb6, 0xa3, 0x6f, 0x3a, 0x96, 0x25, 0x78, 0x97, 0x8c, 0x6e, 0xa0, 0x77, 0x5d, 0x24,
+	0x77, 0x54, 0x8f, 0xe8, 0xf4, 0x80, 0x8a, 0xfb, 0x48, 0x2a, 0xd1, 0x0f, 0x07, 0x7a, 0xf5, 0xca,
+	0x47, 0x1e, 0x5b, 0x00, 0xed, 0x9c, 0x6c, 0x56, 0x82, 0x64, 0x76, 0x03, 0x3d, 0x5c, 0xb9, 0xe8,
+	0x25, 0x74, 0x72, 0x29, 0xb2, 0x22, 0xb5, 0x67, 0xb6, 0x37, 0xfa, 0x2e, 0x81, 0x46, 0x46, 0x93,
+	0xef, 0x05, 0xe5, 0x29, 0x0d, 0x9a, 0xa1, 0x33, 0x6e, 0xe0, 0x9d, 0x3f, 0xf9, 0xe5, 0x82, 0x37,
+	0x25, 0x04, 0xbd, 0x85, 0x0e, 0xa6, 0x4b, 0xa6, 0x34, 0x95, 0xa8, 0xae, 0xd8, 0x68, 0x18, 0x6f,
+	0x3f, 0x61, 0x5c, 0x7d, 0xc2, 0x78, 0x6a, 0x3e, 0x61, 0x74, 0x82, 0x2e, 0x01, 0xae, 0xa8, 0xac,
+	0x40, 0x07, 0xea, 0x8e, 0xe0, 0xdf, 0x43, 0xb7, 0xdc, 0x40, 0x42, 0xd1, 0xc0, 0xf6, 0xac, 0x2d,
+	0xe4, 0x08, 0xf0, 0x02, 0xfc, 0x39, 0x57, 0xff, 0x04, 0x3d, 0x07, 0xff, 0x0b, 0xd5, 0x25, 0x37,
+	0x75, 0x70, 0xe8, 0xff, 0x6b, 0x0a, 0x98, 0xb3, 0x8a, 0x4e, 0xd0, 0x47, 0xe8, 0xcf, 0xf6, 0xce,
+	0xf3, 0x10, 0x76, 0x70, 0xff, 0x2c, 0xa2, 0x93, 0x37, 0x4e, 0xd2, 0xb2, 0x55, 0x67, 0x7f, 0x06,
+	0x00, 0xdd, 0x08, 0x62, 0x7f, 0xe2, 0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// EaaClient is the client API for Eaa service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type EaaClient interface {
+	// Register registers the calling producer
+	Register(ctx context.Context, in *Service, opts ...grpc.CallOption) (*empty.Empty, error)
+	// Deregister deregisters the calling producer
+	Deregister(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*empty.Empty, error)
+	// Subscribe subscribes the calling consumer to notifications of
+	// a namespace or, if the URN has an ID, of a single producer
+	Subscribe(ctx context.Context, in *Subscription, opts ...grpc.CallOption) (*empty.Empty, error)
+	// Unsubscribe unsubscribes the calling consumer from notifications of
+	// a namespace or, if the URN has an ID, of a single producer
+	Unsubscribe(ctx context.Context, in *Subscription, opts ...grpc.CallOption) (*empty.Empty, error)
+	// GetServices returns all registered producers
+	GetServices(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ServiceList, error)
+	// Notifications streams the notifications the calling consumer is
+	// subscribed to. It replaces the WebSocket of the HTTPS API.
+	Notifications(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (Eaa_NotificationsClient, error)
+}
+
+type eaaClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEaaClient(cc grpc.ClientConnInterface) EaaClient {
+	return &eaaClient{cc}
+}
+
+func (c *eaaClient) Register(ctx context.Context, in *Service, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/pb.Eaa/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eaaClient) Deregister(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/pb.Eaa/Deregister", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eaaClient) Subscribe(ctx context.Context, in *Subscription, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/pb.Eaa/Subscribe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eaaClient) Unsubscribe(ctx context.Context, in *Subscription, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/pb.Eaa/Unsubscribe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eaaClient) GetServices(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ServiceList, error) {
+	out := new(ServiceList)
+	err := c.cc.Invoke(ctx, "/pb.Eaa/GetServices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eaaClient) Notifications(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (Eaa_NotificationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Eaa_serviceDesc.Streams[0], "/pb.Eaa/Notifications", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eaaNotificationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Eaa_NotificationsClient interface {
+	Recv() (*Notification, error)
+	grpc.ClientStream
+}
+
+type eaaNotificationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *eaaNotificationsClient) Recv() (*Notification, error) {
+	m := new(Notification)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EaaServer is the server API for Eaa service.
+type EaaServer interface {
+	// Register registers the calling producer
+	Register(context.Context, *Service) (*empty.Empty, error)
+	// Deregister deregisters the calling producer
+	Deregister(context.Context, *empty.Empty) (*empty.Empty, error)
+	// Subscribe subscribes the calling consumer to notifications of
+	// a namespace or, if the URN has an ID, of a single producer
+	Subscribe(context.Context, *Subscription) (*empty.Empty, error)
+	// Unsubscribe unsubscribes the calling consumer from notifications of
+	// a namespace or, if the URN has an ID, of a single producer
+	Unsubscribe(context.Context, *Subscription) (*empty.Empty, error)
+	// GetServices returns all registered producers
+	GetServices(context.Context, *empty.Empty) (*ServiceList, error)
+	// Notifications streams the notifications the calling consumer is
+	// subscribed to. It replaces the WebSocket of the HTTPS API.
+	Notifications(*empty.Empty, Eaa_NotificationsServer) error
+}
+
+// UnimplementedEaaServer can be embedded to have forward compatible implementations.
+type UnimplementedEaaServer struct {
+}
+
+func (*UnimplementedEaaServer) Register(ctx context.Context, req *Service) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (*UnimplementedEaaServer) Deregister(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Deregister not implemented")
+}
+func (*UnimplementedEaaServer) Subscribe(ctx context.Context, req *Subscription) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedEaaServer) Unsubscribe(ctx context.Context, req *Subscription) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unsubscribe not implemented")
+}
+func (*UnimplementedEaaServer) GetServices(ctx context.Context, req *empty.Empty) (*ServiceList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServices not implemented")
+}
+func (*UnimplementedEaaServer) Notifications(req *empty.Empty, srv Eaa_NotificationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Notifications not implemented")
+}
+
+func RegisterEaaServer(s *grpc.Server, srv EaaServer) {
+	s.RegisterService(&_Eaa_serviceDesc, srv)
+}
+
+func _Eaa_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Service)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EaaServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Eaa/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EaaServer).Register(ctx, req.(*Service))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eaa_Deregister_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(empty.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EaaServer).Deregister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Eaa/Deregister",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EaaServer).Deregister(ctx, req.(*empty.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eaa_Subscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Subscription)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EaaServer).Subscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Eaa/Subscribe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EaaServer).Subscribe(ctx, req.(*Subscription))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eaa_Unsubscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Subscription)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EaaServer).Unsubscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Eaa/Unsubscribe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EaaServer).Unsubscribe(ctx, req.(*Subscription))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eaa_GetServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(empty.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EaaServer).GetServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Eaa/GetServices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EaaServer).GetServices(ctx, req.(*empty.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eaa_Notifications_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(empty.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EaaServer).Notifications(m, &eaaNotificationsServer{stream})
+}
+
+type Eaa_NotificationsServer interface {
+	Send(*Notification) error
+	grpc.ServerStream
+}
+
+type eaaNotificationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *eaaNotificationsServer) Send(m *Notification) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Eaa_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.Eaa",
+	HandlerType: (*EaaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Eaa_Register_Handler,
+		},
+		{
+			MethodName: "Deregister",
+			Handler:    _Eaa_Deregister_Handler,
+		},
+		{
+			MethodName: "Subscribe",
+			Handler:    _Eaa_Subscribe_Handler,
+		},
+		{
+			MethodName: "Unsubscribe",
+			Handler:    _Eaa_Unsubscribe_Handler,
+		},
+		{
+			MethodName: "GetServices",
+			Handler:    _Eaa_GetServices_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Notifications",
+			Handler:       _Eaa_Notifications_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "eaa.proto",
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds the rate limiting state of a single producer
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// notificationLimiter is a token bucket rate limiter keyed by the producer
+// CommonName. The zero value is ready to use.
+type notificationLimiter struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// allow takes a token from the bucket of the producer. If the bucket is empty
+// it returns false and the time after which a token will be available.
+// rate is expressed in tokens per second, a rate <= 0 disables the limit.
+func (l *notificationLimiter) allow(commonName string, rate float64,
+	burst int, now time.Time) (bool, time.Duration) {
+
+	if rate <= 0 {
+		return true, 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+
+	bucket, found := l.buckets[commonName]
+	if !found {
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[commonName] = bucket
+	}
+
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(burst), bucket.tokens+elapsed*rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens < 1 {
+		wait := (1 - bucket.tokens) / rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// utilization returns the share of the burst taken from the bucket of
+// the producer, as of its last allow
+func (l *notificationLimiter) utilization(commonName string, burst int) float64 {
+	l.Lock()
+	defer l.Unlock()
+
+	bucket, found := l.buckets[commonName]
+	if !found || burst < 1 {
+		return 0
+	}
+	return math.Max(0, 1-bucket.tokens/float64(burst))
+}
+
+// remove drops the bucket of the producer
+func (l *notificationLimiter) remove(commonName string) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.buckets, commonName)
+}
+
+// nodeLimiterKey is the key of the single bucket of the node-wide
+// notification limiter shared by all producers
+const nodeLimiterKey = ""
+
+// allowNodeNotification takes a token from the node-wide bucket. It's
+// consulted after the limit of the producer, so that a producer over its
+// own limit doesn't use up the capacity of the others.
+func allowNodeNotification(eaaCtx *Context, now time.Time) (bool, time.Duration) {
+	rate := eaaCtx.config().NodeNotificationRateLimit
+	if rate <= 0 {
+		return true, 0
+	}
+	burst := eaaCtx.config().NodeNotificationBurst
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+
+	allowed, retryAfter := eaaCtx.nodeLimiter.allow(nodeLimiterKey, rate, burst, now)
+	nodeNotificationUtilization.Set(eaaCtx.nodeLimiter.utilization(nodeLimiterKey, burst))
+	if !allowed {
+		nodeNotificationRejectionsTotal.Inc()
+	}
+	return allowed, retryAfter
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = g.Describe("notificationLimiter", func() {
+	var (
+		limiter notificationLimiter
+		now     time.Time
+	)
+
+	g.BeforeEach(func() {
+		limiter = notificationLimiter{}
+		now = time.Now()
+	})
+
+	g.It("does not limit when the rate is disabled", func() {
+		for i := 0; i < 100; i++ {
+			allowed, _ := limiter.allow("ns:producer", 0, 0, now)
+			Expect(allowed).To(BeTrue())
+		}
+	})
+
+	g.It("allows a burst and then limits the producer", func() {
+		for i := 0; i < 3; i++ {
+			allowed, _ := limiter.allow("ns:producer", 2, 3, now)
+			Expect(allowed).To(BeTrue())
+		}
+
+		allowed, retryAfter := limiter.allow("ns:producer", 2, 3, now)
+		Expect(allowed).To(BeFalse())
+		Expect(retryAfter).To(Equal(500 * time.Millisecond))
+
+		g.By("refilling the bucket over time")
+		allowed, _ = limiter.allow("ns:producer", 2, 3, now.Add(retryAfter))
+		Expect(allowed).To(BeTrue())
+	})
+
+	g.It("keeps separate buckets per producer", func() {
+		allowed, _ := limiter.allow("ns:producer-1", 1, 1, now)
+		Expect(allowed).To(BeTrue())
+		allowed, _ = limiter.allow("ns:producer-2", 1, 1, now)
+		Expect(allowed).To(BeTrue())
+		allowed, _ = limiter.allow("ns:producer-1", 1, 1, now)
+		Expect(allowed).To(BeFalse())
+	})
+
+	g.It("reports the share of the burst in use", func() {
+		Expect(limiter.utilization("ns:producer", 4)).To(BeZero())
+		limiter.allow("ns:producer", 1, 4, now)
+		Expect(limiter.utilization("ns:producer", 4)).To(Equal(0.25))
+	})
+
+	g.It("drops the bucket of a removed producer", func() {
+		limiter.allow("ns:producer", 1, 1, now)
+		limiter.remove("ns:producer")
+
+		Expect(limiter.buckets).NotTo(HaveKey("ns:producer"))
+	})
+})
+
+var _ = g.Describe("PushNotificationToSubscribers rate limiting", func() {
+	g.It("returns 429 with Retry-After when the limit is exceeded", func() {
+		eaaCtx := &Context{}
+		eaaCtx.cfg.NotificationRateLimit = 1
+		eaaCtx.cfg.NotificationBurst = 1
+		eaaCtx.serviceInfo.m = map[string]Service{"ns:producer": {}}
+		eaaCtx.notifLimiter.allow("ns:producer", 1, 1, time.Now())
+
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n","version":"1"}`, "ns:producer", eaaCtx))
+
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+	})
+})
+
+var _ = g.Describe("PushNotificationToSubscribers node rate limiting", func() {
+	var eaaCtx *Context
+
+	push := func(commonName string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		PushNotificationToSubscribers(rec, newTLSRequest("POST", "/notifications",
+			`{"name":"n","version":"1"}`, commonName, eaaCtx))
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.cfg.NodeNotificationRateLimit = 0.5
+		eaaCtx.cfg.NodeNotificationBurst = 2
+		eaaCtx.serviceInfo.m = map[string]Service{"ns:producer1": {}, "ns:producer2": {}}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("returns 503 with Retry-After when the producers exceed it together", func() {
+		rejected := testutil.ToFloat64(nodeNotificationRejectionsTotal)
+
+		Expect(push("ns:producer1").Code).To(Equal(http.StatusAccepted))
+		Expect(testutil.ToFloat64(nodeNotificationUtilization)).To(BeNumerically("~", 0.5, 0.01))
+		Expect(push("ns:producer2").Code).To(Equal(http.StatusAccepted))
+
+		rec := push("ns:producer1")
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("2"))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reasonNodeRateLimitExceeded))
+		Expect(testutil.ToFloat64(nodeNotificationRejectionsTotal)).To(Equal(rejected + 1))
+	})
+
+	g.It("applies after the limit of the producer", func() {
+		eaaCtx.cfg.NotificationRateLimit = 0.5
+		eaaCtx.cfg.NotificationBurst = 1
+
+		Expect(push("ns:producer1").Code).To(Equal(http.StatusAccepted))
+		Expect(push("ns:producer1").Code).To(Equal(http.StatusTooManyRequests))
+		Expect(push("ns:producer2").Code).To(Equal(http.StatusAccepted))
+	})
+})
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"sync"
+	"time"
+)
+
+// maxReplayBufferSize bounds the configured replay buffer size
+const maxReplayBufferSize = 10000
+
+// replayEntry is a notification payload retained for a replay
+type replayEntry struct {
+	seq     uint64
+	key     UniqueNotif
+	payload []byte
+	// deadline of the notification, zero if it has none
+	deadline time.Time
+}
+
+// notificationRing is a bounded ring of the last notifications sent
+// to a consumer
+type notificationRing struct {
+	entries []replayEntry
+	next    int
+	full    bool
+}
+
+func newNotificationRing(size int) *notificationRing {
+	return &notificationRing{entries: make([]replayEntry, size)}
+}
+
+// add stores the entry overwriting the oldest one if the ring is full
+func (r *notificationRing) add(e replayEntry) {
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns the entries with a sequence number greater than seq,
+// oldest first
+func (r *notificationRing) since(seq uint64) []replayEntry {
+	var ordered []replayEntry
+	if r.full {
+		ordered = append(ordered, r.entries[r.next:]...)
+	}
+	ordered = append(ordered, r.entries[:r.next]...)
+
+	var result []replayEntry
+	for _, e := range ordered {
+		if e.seq > seq {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// replayBuffers holds the notification sequence counter and the replay
+// rings of all consumers. The zero value is ready to use.
+type replayBuffers struct {
+	sync.Mutex
+	lastSeq uint64
+	m       map[string]*notificationRing
+}
+
+// nextSequence returns a new monotonic notification sequence number
+func (b *replayBuffers) nextSequence() uint64 {
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastSeq++
+	return b.lastSeq
+}
+
+// record retains the notification in the ring of the consumer,
+// a size <= 0 disables retaining
+func (b *replayBuffers) record(subID string, size int, e replayEntry) {
+	if size <= 0 {
+		return
+	}
+	if size > maxReplayBufferSize {
+		size = maxReplayBufferSize
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.m == nil {
+		b.m = make(map[string]*notificationRing)
+	}
+	ring, found := b.m[subID]
+	if !found {
+		ring = newNotificationRing(size)
+		b.m[subID] = ring
+	}
+	ring.add(e)
+}
+
+// since returns the retained notification payloads of the consumer with
+// a sequence number greater than seq accepted by the filter, stale ones
+// are left out
+func (b *replayBuffers) since(subID string, seq uint64, filter connectionFilter) [][]byte {
+	b.Lock()
+	defer b.Unlock()
+
+	ring, found := b.m[subID]
+	if !found {
+		return nil
+	}
+
+	now := time.Now()
+	var payloads [][]byte
+	for _, e := range ring.since(seq) {
+		if !filter.accepts(e.key) {
+			continue
+		}
+		if isStale(e.deadline, now) {
+			notificationsDroppedStaleTotal.Inc()
+			continue
+		}
+		payloads = append(payloads, e.payload)
+	}
+	return payloads
+}
+
+// remove drops the ring of the consumer
+func (b *replayBuffers) remove(subID string) {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.m, subID)
+}
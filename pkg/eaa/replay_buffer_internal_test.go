@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("replayBuffers", func() {
+	var buffers replayBuffers
+
+	record := func(subID string, size int, seqs ...uint64) {
+		for _, seq := range seqs {
+			buffers.record(subID, size, replayEntry{seq: seq, payload: []byte{byte(seq)}})
+		}
+	}
+
+	g.BeforeEach(func() {
+		buffers = replayBuffers{}
+	})
+
+	g.It("assigns monotonic sequence numbers", func() {
+		Expect(buffers.nextSequence()).To(Equal(uint64(1)))
+		Expect(buffers.nextSequence()).To(Equal(uint64(2)))
+	})
+
+	g.It("does not retain notifications when disabled", func() {
+		record("ns:consumer", 0, 1, 2)
+
+		Expect(buffers.since("ns:consumer", 0, connectionFilter{})).To(BeEmpty())
+	})
+
+	g.It("replays notifications after the sequence number", func() {
+		record("ns:consumer", 5, 1, 2, 3)
+
+		Expect(buffers.since("ns:consumer", 1, connectionFilter{})).To(Equal([][]byte{{2}, {3}}))
+	})
+
+	g.It("retains only the last notifications in order", func() {
+		record("ns:consumer", 3, 1, 2, 3, 4, 5)
+
+		Expect(buffers.since("ns:consumer", 0, connectionFilter{})).To(Equal([][]byte{{3}, {4}, {5}}))
+	})
+
+	g.It("keeps separate buffers per consumer", func() {
+		record("ns:consumer-1", 3, 1)
+		record("ns:consumer-2", 3, 2)
+
+		Expect(buffers.since("ns:consumer-1", 0, connectionFilter{})).To(Equal([][]byte{{1}}))
+		buffers.remove("ns:consumer-1")
+		Expect(buffers.since("ns:consumer-1", 0, connectionFilter{})).To(BeEmpty())
+		Expect(buffers.since("ns:consumer-2", 0, connectionFilter{})).To(Equal([][]byte{{2}}))
+	})
+})
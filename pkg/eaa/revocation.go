@@ -0,0 +1,296 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationTimeout bounds fetching a CRL or an OCSP response
+const revocationTimeout = 5 * time.Second
+
+// maxRevocationResponseSize bounds the size of a fetched CRL or OCSP response
+const maxRevocationResponseSize = 10 << 20
+
+// ocspCacheEntry is a cached OCSP status of a certificate
+type ocspCacheEntry struct {
+	status  int
+	expires time.Time
+}
+
+// revocationFetch is a CRL or OCSP fetch in progress, the handshakes
+// needing the same response wait for it instead of fetching it again
+type revocationFetch struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// revocationChecker rejects revoked client certificates during the TLS
+// handshake, before any handler runs. The mutex guards the caches only,
+// the responses are fetched without holding it.
+type revocationChecker struct {
+	sync.Mutex
+	cfg    RevocationInfo
+	client *http.Client
+	// revoked serial numbers of the last fetched CRL
+	crl        map[string]bool
+	crlExpires time.Time
+	ocsp       map[string]ocspCacheEntry
+	// fetches in progress keyed by crlFetchKey or the OCSP serial number
+	fetches map[string]*revocationFetch
+}
+
+// crlFetchKey is the fetches key of the CRL
+const crlFetchKey = "crl"
+
+// newRevocationChecker returns nil if neither CRL nor OCSP checking
+// is configured
+func newRevocationChecker(cfg RevocationInfo) *revocationChecker {
+	if cfg.CRLURL == "" && cfg.OCSPResponder == "" {
+		return nil
+	}
+	return &revocationChecker{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: revocationTimeout},
+		ocsp:    make(map[string]ocspCacheEntry),
+		fetches: make(map[string]*revocationFetch),
+	}
+}
+
+// verifyPeerCertificate is a tls.Config VerifyPeerCertificate callback.
+// It's called after the chain of the client certificate is verified.
+func (c *revocationChecker) verifyPeerCertificate(_ [][]byte,
+	verifiedChains [][]*x509.Certificate) error {
+
+	if c == nil {
+		return nil
+	}
+
+	revoked, err := c.isRevoked(verifiedChains, time.Now())
+	if err != nil {
+		if c.cfg.Strict {
+			return errors.Wrap(err, "Revocation status of the client certificate is unknown")
+		}
+		log.Warningf("Revocation status of the client certificate is unknown: %s",
+			err.Error())
+		return nil
+	}
+	if revoked {
+		return errors.Errorf("Client certificate %s is revoked",
+			verifiedChains[0][0].Subject.CommonName)
+	}
+	return nil
+}
+
+// isRevoked checks the leaf certificate of the verified chain against the CRL
+// and the OCSP responder. The status is unknown only if none of them
+// could be checked.
+func (c *revocationChecker) isRevoked(verifiedChains [][]*x509.Certificate,
+	now time.Time) (bool, error) {
+
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) < 2 {
+		return false, errors.New("No issuer of the client certificate")
+	}
+	leaf, issuer := verifiedChains[0][0], verifiedChains[0][1]
+
+	var lastErr error
+	determined := false
+	if c.cfg.CRLURL != "" {
+		revoked, err := c.checkCRL(leaf, issuer, now)
+		if err != nil {
+			lastErr = err
+		} else if revoked {
+			return true, nil
+		} else {
+			determined = true
+		}
+	}
+	if c.cfg.OCSPResponder != "" {
+		revoked, err := c.checkOCSP(leaf, issuer, now)
+		if err != nil {
+			lastErr = err
+		} else if revoked {
+			return true, nil
+		} else {
+			determined = true
+		}
+	}
+
+	if !determined {
+		return false, lastErr
+	}
+	return false, nil
+}
+
+// fetch gets the response body of a CRL or OCSP request
+func (c *revocationChecker) fetch(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	return ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxRevocationResponseSize))
+}
+
+// fetchOnce runs the fetch unless one with the same key is in progress,
+// in which case its result is waited for and returned
+func (c *revocationChecker) fetchOnce(key string,
+	fetch func() (interface{}, error)) (interface{}, error) {
+
+	c.Lock()
+	if f, ok := c.fetches[key]; ok {
+		c.Unlock()
+		<-f.done
+		return f.val, f.err
+	}
+	f := &revocationFetch{done: make(chan struct{})}
+	c.fetches[key] = f
+	c.Unlock()
+
+	f.val, f.err = fetch()
+
+	c.Lock()
+	delete(c.fetches, key)
+	c.Unlock()
+	close(f.done)
+	return f.val, f.err
+}
+
+// checkCRL looks the certificate up in the CRL, which is refetched when
+// the cached one expires
+func (c *revocationChecker) checkCRL(leaf, issuer *x509.Certificate,
+	now time.Time) (bool, error) {
+
+	serial := leaf.SerialNumber.String()
+	c.Lock()
+	if c.crl != nil && now.Before(c.crlExpires) {
+		revoked := c.crl[serial]
+		c.Unlock()
+		return revoked, nil
+	}
+	c.Unlock()
+
+	crl, err := c.fetchOnce(crlFetchKey, func() (interface{}, error) {
+		return c.refreshCRL(issuer, now)
+	})
+	if err != nil {
+		return false, err
+	}
+	return crl.(map[string]bool)[serial], nil
+}
+
+// refreshCRL fetches the CRL, verifies it's signed by the issuer and caches
+// its revoked serial numbers
+func (c *revocationChecker) refreshCRL(issuer *x509.Certificate,
+	now time.Time) (map[string]bool, error) {
+
+	req, err := http.NewRequest(http.MethodGet, c.cfg.CRLURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid CRL URL")
+	}
+	data, err := c.fetch(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch the CRL")
+	}
+
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse the CRL")
+	}
+	if err = issuer.CheckCRLSignature(crl); err != nil {
+		return nil, errors.Wrap(err, "Invalid CRL signature")
+	}
+	if crl.HasExpired(now) {
+		return nil, errors.New("The CRL has expired")
+	}
+
+	revoked := make(map[string]bool)
+	for _, cert := range crl.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.String()] = true
+	}
+	expires := now.Add(c.cfg.CacheInterval.Duration)
+	if next := crl.TBSCertList.NextUpdate; !next.IsZero() && next.Before(expires) {
+		expires = next
+	}
+
+	c.Lock()
+	c.crl, c.crlExpires = revoked, expires
+	c.Unlock()
+
+	return revoked, nil
+}
+
+// checkOCSP asks the OCSP responder about the certificate, the response
+// is cached until CacheInterval passes
+func (c *revocationChecker) checkOCSP(leaf, issuer *x509.Certificate,
+	now time.Time) (bool, error) {
+
+	serial := leaf.SerialNumber.String()
+	c.Lock()
+	entry, ok := c.ocsp[serial]
+	c.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.status == ocsp.Revoked, nil
+	}
+
+	status, err := c.fetchOnce(serial, func() (interface{}, error) {
+		return c.queryOCSP(leaf, issuer, now)
+	})
+	if err != nil {
+		return false, err
+	}
+	return status.(int) == ocsp.Revoked, nil
+}
+
+// queryOCSP fetches the OCSP status of the certificate and caches it
+func (c *revocationChecker) queryOCSP(leaf, issuer *x509.Certificate,
+	now time.Time) (int, error) {
+
+	ocspReq, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to create an OCSP request")
+	}
+	req, err := http.NewRequest(http.MethodPost, c.cfg.OCSPResponder,
+		bytes.NewReader(ocspReq))
+	if err != nil {
+		return 0, errors.Wrap(err, "Invalid OCSP responder URL")
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	data, err := c.fetch(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to query the OCSP responder")
+	}
+
+	resp, err := ocsp.ParseResponseForCert(data, leaf, issuer)
+	if err != nil {
+		return 0, errors.Wrap(err, "Invalid OCSP response")
+	}
+	if resp.Status == ocsp.Unknown {
+		return 0, errors.New("The OCSP responder doesn't know the certificate")
+	}
+
+	entry := ocspCacheEntry{status: resp.Status,
+		expires: now.Add(c.cfg.CacheInterval.Duration)}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(entry.expires) {
+		entry.expires = resp.NextUpdate
+	}
+	c.Lock()
+	c.ocsp[leaf.SerialNumber.String()] = entry
+	c.Unlock()
+
+	return resp.Status, nil
+}
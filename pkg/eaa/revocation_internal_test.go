@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-ness/edgenode/pkg/util"
+	"golang.org/x/crypto/ocsp"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newTestCert creates a certificate signed by the parent, or a self-signed
+// CA certificate if the parent is nil
+func newTestCert(serial int64, commonName string, parent *x509.Certificate,
+	parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return cert, key
+}
+
+var _ = g.Describe("Client certificate revocation", func() {
+	var (
+		ca       *x509.Certificate
+		caKey    crypto.Signer
+		good     *x509.Certificate
+		revoked  *x509.Certificate
+		server   *httptest.Server
+		requests int
+
+		// the /slowocsp responses wait for release
+		slowRequests int32
+		release      chan struct{}
+	)
+
+	chain := func(leaf *x509.Certificate) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{leaf, ca}}
+	}
+
+	g.BeforeEach(func() {
+		ca, caKey = newTestCert(1, "ca", nil, nil)
+		good, _ = newTestCert(2, "ns:good", ca, caKey)
+		revoked, _ = newTestCert(3, "ns:revoked", ca, caKey)
+		requests = 0
+		slowRequests = 0
+		release = make(chan struct{})
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/crl", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			crl, err := ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{
+				{SerialNumber: revoked.SerialNumber, RevocationTime: time.Now()},
+			}, time.Now(), time.Now().Add(time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+			_, _ = w.Write(crl)
+		})
+		respondOCSP := func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			req, err := ocsp.ParseRequest(body)
+			Expect(err).ToNot(HaveOccurred())
+
+			tmpl := ocsp.Response{Status: ocsp.Good, SerialNumber: req.SerialNumber,
+				ThisUpdate: time.Now()}
+			if req.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
+				tmpl.Status = ocsp.Revoked
+				tmpl.RevokedAt = time.Now()
+			}
+			resp, err := ocsp.CreateResponse(ca, ca, tmpl, caKey)
+			Expect(err).ToNot(HaveOccurred())
+			_, _ = w.Write(resp)
+		}
+		mux.HandleFunc("/ocsp", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			respondOCSP(w, r)
+		})
+		mux.HandleFunc("/slowocsp", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&slowRequests, 1)
+			select {
+			case <-release:
+				respondOCSP(w, r)
+			case <-r.Context().Done():
+			}
+		})
+		mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	g.It("is disabled without a CRL URL and an OCSP responder", func() {
+		checker := newRevocationChecker(RevocationInfo{Strict: true})
+		Expect(checker).To(BeNil())
+		Expect(checker.verifyPeerCertificate(nil, chain(revoked))).To(Succeed())
+	})
+
+	g.It("rejects certificates revoked in the CRL", func() {
+		checker := newRevocationChecker(RevocationInfo{CRLURL: server.URL + "/crl",
+			CacheInterval: util.Duration{Duration: time.Minute}})
+
+		Expect(checker.verifyPeerCertificate(nil, chain(good))).To(Succeed())
+		Expect(checker.verifyPeerCertificate(nil, chain(revoked))).ToNot(Succeed())
+		Expect(requests).To(Equal(1))
+	})
+
+	g.It("rejects certificates revoked by the OCSP responder", func() {
+		checker := newRevocationChecker(RevocationInfo{OCSPResponder: server.URL + "/ocsp",
+			CacheInterval: util.Duration{Duration: time.Minute}})
+
+		Expect(checker.verifyPeerCertificate(nil, chain(good))).To(Succeed())
+		Expect(checker.verifyPeerCertificate(nil, chain(good))).To(Succeed())
+		Expect(checker.verifyPeerCertificate(nil, chain(revoked))).ToNot(Succeed())
+		Expect(requests).To(Equal(2))
+	})
+
+	g.It("checks cached certificates while a response is fetched", func() {
+		checker := newRevocationChecker(RevocationInfo{
+			OCSPResponder: server.URL + "/slowocsp",
+			CacheInterval: util.Duration{Duration: time.Minute}})
+		checker.ocsp[revoked.SerialNumber.String()] = ocspCacheEntry{status: ocsp.Revoked,
+			expires: time.Now().Add(time.Minute)}
+
+		results := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer g.GinkgoRecover()
+				results <- checker.verifyPeerCertificate(nil, chain(good))
+			}()
+		}
+		Eventually(func() int32 { return atomic.LoadInt32(&slowRequests) }).Should(
+			Equal(int32(1)))
+
+		Expect(checker.verifyPeerCertificate(nil, chain(revoked))).ToNot(Succeed())
+		Consistently(results, "50ms").ShouldNot(Receive())
+
+		close(release)
+		for i := 0; i < 2; i++ {
+			Eventually(results).Should(Receive(BeNil()))
+		}
+		Expect(atomic.LoadInt32(&slowRequests)).To(Equal(int32(1)))
+	})
+
+	g.It("fails closed in strict mode if the status is unknown", func() {
+		info := RevocationInfo{CRLURL: server.URL + "/unavailable",
+			OCSPResponder: server.URL + "/unavailable"}
+		Expect(newRevocationChecker(info).verifyPeerCertificate(nil,
+			chain(good))).To(Succeed())
+
+		info.Strict = true
+		Expect(newRevocationChecker(info).verifyPeerCertificate(nil,
+			chain(good))).ToNot(Succeed())
+	})
+
+	g.It("accepts a status determined by one of the sources in strict mode", func() {
+		checker := newRevocationChecker(RevocationInfo{CRLURL: server.URL + "/unavailable",
+			OCSPResponder: server.URL + "/ocsp", Strict: true})
+
+		Expect(checker.verifyPeerCertificate(nil, chain(good))).To(Succeed())
+		Expect(checker.verifyPeerCertificate(nil, chain(revoked))).ToNot(Succeed())
+	})
+})
@@ -43,10 +43,20 @@ func NewEaaRouter(eaaCtx *Context) *mux.Router {
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	})
+	router.Use(tracingMiddleware())
+	router.Use(auditMiddleware(eaaCtx))
+	router.Use(gzipMiddleware(eaaCtx))
 	return router
 }
 
 var eaaRoutes = Routes{
+	Route{
+		"BroadcastNotification",
+		strings.ToUpper("Post"),
+		"/admin/broadcast",
+		BroadcastNotification,
+	},
+
 	Route{
 		"DeregisterApplication",
 		strings.ToUpper("Delete"),
@@ -54,6 +64,41 @@ var eaaRoutes = Routes{
 		DeregisterApplication,
 	},
 
+	Route{
+		"DeregisterNotificationSchema",
+		strings.ToUpper("Delete"),
+		"/admin/schemas",
+		DeregisterNotificationSchema,
+	},
+
+	Route{
+		"DisconnectClient",
+		strings.ToUpper("Delete"),
+		"/admin/clients/{commonName}",
+		DisconnectClient,
+	},
+
+	Route{
+		"ExportSubscriptions",
+		strings.ToUpper("Get"),
+		"/admin/subscriptions/export",
+		ExportSubscriptions,
+	},
+
+	Route{
+		"GetConnectedClients",
+		strings.ToUpper("Get"),
+		"/admin/clients",
+		GetConnectedClients,
+	},
+
+	Route{
+		"GetNamespaces",
+		strings.ToUpper("Get"),
+		"/namespaces",
+		GetNamespaces,
+	},
+
 	Route{
 		"GetNotifications",
 		strings.ToUpper("Get"),
@@ -61,6 +106,20 @@ var eaaRoutes = Routes{
 		GetNotifications,
 	},
 
+	Route{
+		"GetNotificationsSSE",
+		strings.ToUpper("Get"),
+		"/notifications/sse",
+		GetNotificationsSSE,
+	},
+
+	Route{
+		"GetService",
+		strings.ToUpper("Get"),
+		"/services/{urn.namespace}/{urn.id}",
+		GetService,
+	},
+
 	Route{
 		"GetServices",
 		strings.ToUpper("Get"),
@@ -68,6 +127,27 @@ var eaaRoutes = Routes{
 		GetServices,
 	},
 
+	Route{
+		"GetSubscribers",
+		strings.ToUpper("Get"),
+		"/services/subscribers",
+		GetSubscribers,
+	},
+
+	Route{
+		"GetSubscriptionMatches",
+		strings.ToUpper("Get"),
+		"/subscriptions/matches",
+		GetSubscriptionMatches,
+	},
+
+	Route{
+		"GetSubscriptionStats",
+		strings.ToUpper("Get"),
+		"/subscriptions/stats",
+		GetSubscriptionStats,
+	},
+
 	Route{
 		"GetSubscriptions",
 		strings.ToUpper("Get"),
@@ -75,6 +155,27 @@ var eaaRoutes = Routes{
 		GetSubscriptions,
 	},
 
+	Route{
+		"ImportSubscriptions",
+		strings.ToUpper("Post"),
+		"/admin/subscriptions/import",
+		ImportSubscriptions,
+	},
+
+	Route{
+		"MatchNotification",
+		strings.ToUpper("Post"),
+		"/admin/notifications/match",
+		MatchNotification,
+	},
+
+	Route{
+		"PreviewSubscriptions",
+		strings.ToUpper("Post"),
+		"/subscriptions/preview",
+		PreviewSubscriptions,
+	},
+
 	Route{
 		"PushNotificationToSubscribers",
 		strings.ToUpper("Post"),
@@ -82,6 +183,13 @@ var eaaRoutes = Routes{
 		PushNotificationToSubscribers,
 	},
 
+	Route{
+		"PushNotificationsBulk",
+		strings.ToUpper("Post"),
+		"/notifications/bulk",
+		PushNotificationsBulk,
+	},
+
 	Route{
 		"RegisterApplication",
 		strings.ToUpper("Post"),
@@ -89,6 +197,34 @@ var eaaRoutes = Routes{
 		RegisterApplication,
 	},
 
+	Route{
+		"RegisterNotificationSchema",
+		strings.ToUpper("Post"),
+		"/admin/schemas",
+		RegisterNotificationSchema,
+	},
+
+	Route{
+		"ReloadConfig",
+		strings.ToUpper("Post"),
+		"/admin/config/reload",
+		ReloadConfig,
+	},
+
+	Route{
+		"RenewApplication",
+		strings.ToUpper("Post"),
+		"/services/renew",
+		RenewApplication,
+	},
+
+	Route{
+		"RenewSubscriptions",
+		strings.ToUpper("Post"),
+		"/subscriptions/renew",
+		RenewSubscriptions,
+	},
+
 	Route{
 		"SubscribeNamespaceNotifications",
 		strings.ToUpper("Post"),
@@ -103,6 +239,13 @@ var eaaRoutes = Routes{
 		SubscribeServiceNotifications,
 	},
 
+	Route{
+		"SubscribeServiceNotificationsBulk",
+		strings.ToUpper("Post"),
+		"/subscriptions",
+		SubscribeServiceNotificationsBulk,
+	},
+
 	Route{
 		"UnsubscribeAllNotifications",
 		strings.ToUpper("Delete"),
@@ -123,4 +266,11 @@ var eaaRoutes = Routes{
 		"/subscriptions/{urn.namespace}/{urn.id}",
 		UnsubscribeServiceNotifications,
 	},
+
+	Route{
+		"UpdateApplication",
+		strings.ToUpper("Patch"),
+		"/services",
+		UpdateApplication,
+	},
 }
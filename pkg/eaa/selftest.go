@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// EAA runs a self-test before it starts listening, so that a broken
+// certificate or an unreachable Message Broker fails the startup with
+// a clear error instead of failing the requests later. The self-test loads
+// the server certificate, its key and the CA, and makes a round trip of
+// a message over the services topic of the Message Broker. Other EAA
+// instances ignore the self-test messages they receive.
+
+// defaultSelfTestTimeout bounds the startup self-test if it's not set in
+// the config
+const defaultSelfTestTimeout = 10 * time.Second
+
+// selfTestRetryInterval is how often the self-test message is published
+// again until it's received, a subscriber which just joined may miss
+// the first one
+const selfTestRetryInterval = time.Second
+
+// selfTestCommonName identifies the self-test messages
+const selfTestCommonName = "eaa-self-test"
+
+// selfTestReports passes the self-test messages received from the Message
+// Broker to the waiting self-test
+type selfTestReports struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}
+
+// expect registers a new self-test and returns its id and the channel
+// closed once its message is received
+func (s *selfTestReports) expect() (string, <-chan struct{}) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.m == nil {
+		s.m = make(map[string]chan struct{})
+	}
+	id := uuid.New().String()
+	ch := make(chan struct{})
+	s.m[id] = ch
+	return id, ch
+}
+
+// cancel stops waiting for the message of the self-test
+func (s *selfTestReports) cancel(id string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.m, id)
+}
+
+// report passes the received message to the waiting self-test. Messages of
+// other EAA instances and repeated ones are ignored.
+func (s *selfTestReports) report(id string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if ch, found := s.m[id]; found {
+		close(ch)
+		delete(s.m, id)
+	}
+}
+
+// selfTestTimeout returns how long the startup self-test may take
+func selfTestTimeout(eaaCtx *Context) time.Duration {
+	if timeout := eaaCtx.config().SelfTestTimeout.Duration; timeout > 0 {
+		return timeout
+	}
+	return defaultSelfTestTimeout
+}
+
+// runSelfTest checks the certificates of EAA and the Message Broker, whose
+// services publisher and subscriber have to be added by the caller
+func runSelfTest(parentCtx context.Context, eaaCtx *Context) error {
+	if err := selfTestCertificates(eaaCtx.config().Certs); err != nil {
+		return errors.Wrap(err, "Self-test of the certificates failed")
+	}
+	if err := selfTestMsgBroker(parentCtx, eaaCtx); err != nil {
+		return errors.Wrap(err, "Self-test of the Message Broker failed")
+	}
+	log.Info("Self-test passed")
+	return nil
+}
+
+// selfTestCertificates loads the server certificate, its key and the CA
+func selfTestCertificates(certs CertsInfo) error {
+	if _, err := tls.LoadX509KeyPair(certs.ServerCertPath, certs.ServerKeyPath); err != nil {
+		return errors.Wrapf(err, "Failed to load the server certificate %s and key %s",
+			certs.ServerCertPath, certs.ServerKeyPath)
+	}
+	if _, err := CreateAndSetCACertPool(certs.CaRootPath); err != nil {
+		return errors.Wrapf(err, "Failed to load the CA %s", certs.CaRootPath)
+	}
+	return nil
+}
+
+// selfTestMsgBroker pings the Message Broker and waits for a message published
+// to the services topic to be received
+func selfTestMsgBroker(parentCtx context.Context, eaaCtx *Context) error {
+	if err := eaaCtx.MsgBrokerCtx.ping(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, selfTestTimeout(eaaCtx))
+	defer cancel()
+
+	id, received := eaaCtx.selfTests.expect()
+	defer eaaCtx.selfTests.cancel(id)
+
+	svcMsg := ServiceMessage{Action: serviceActionSelfTest, SelfTestID: id}
+	ticker := time.NewTicker(selfTestRetryInterval)
+	defer ticker.Stop()
+	for {
+		if err := publishServiceMessage(ctx, selfTestCommonName, svcMsg,
+			eaaCtx); err != nil {
+			return err
+		}
+		select {
+		case <-received:
+			return nil
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "The self-test message wasn't received")
+		}
+	}
+}
+
+// Check runs the startup self-test of the EAA config and exits, without
+// serving EAA
+func Check(parentCtx context.Context, cfgPath string) error {
+	var eaaCtx Context
+
+	if err := InitEaaContext(cfgPath, &eaaCtx); err != nil {
+		log.Errf("Failed to initialize EAA Context: %#v", err)
+		return err
+	}
+
+	msgBrokerCtx, err := newMsgBroker(&eaaCtx)
+	if err != nil {
+		log.Errf("Failed to create a Message Broker: %#v", err)
+		return err
+	}
+	eaaCtx.MsgBrokerCtx = msgBrokerCtx
+
+	if err = addServicesPubSub(&eaaCtx); err == nil {
+		err = runSelfTest(parentCtx, &eaaCtx)
+	}
+	if removeErr := eaaCtx.MsgBrokerCtx.removeAll(); err == nil {
+		err = removeErr
+	}
+	if err != nil {
+		log.Errf("Self-test failed: %v", err)
+	}
+	return err
+}
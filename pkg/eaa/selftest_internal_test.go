@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Startup self-test", func() {
+	var (
+		eaaCtx   *Context
+		attempts int32
+	)
+
+	g.BeforeEach(func() {
+		attempts = 0
+		eaaCtx = &Context{}
+		eaaCtx.cfg.Certs = CertsInfo{
+			CaRootPath:     "testdata/certs/rootCA.pem",
+			ServerCertPath: "testdata/certs/server.pem",
+			ServerKeyPath:  "testdata/certs/server.key",
+		}
+		eaaCtx.cfg.SelfTestTimeout.Duration = 100 * time.Millisecond
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("passes with valid certificates and a working Message Broker", func() {
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addServicesPubSub(eaaCtx)).To(Succeed())
+
+		Expect(runSelfTest(context.Background(), eaaCtx)).To(Succeed())
+	})
+
+	g.It("fails if a certificate can't be loaded", func() {
+		eaaCtx.cfg.Certs.ServerKeyPath = "testdata/certs/missing.key"
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addServicesPubSub(eaaCtx)).To(Succeed())
+
+		err := runSelfTest(context.Background(), eaaCtx)
+		Expect(err).To(MatchError(ContainSubstring("Self-test of the certificates failed")))
+		Expect(err).To(MatchError(ContainSubstring("missing.key")))
+	})
+
+	g.It("fails if the Message Broker can't publish", func() {
+		eaaCtx.cfg.BrokerCircuitThreshold = -1
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 100, &attempts}
+		Expect(addServicesPubSub(eaaCtx)).To(Succeed())
+
+		err := runSelfTest(context.Background(), eaaCtx)
+		Expect(err).To(MatchError(ContainSubstring("Self-test of the Message Broker failed")))
+		Expect(err).To(MatchError(ContainSubstring("broker unavailable")))
+	})
+
+	g.It("fails if the Message Broker doesn't deliver the self-test message", func() {
+		eaaCtx.MsgBrokerCtx = flakyMsgBroker{NewGoChannelMsgBroker(eaaCtx), 0, &attempts}
+		Expect(addServicesPubSub(eaaCtx)).To(Succeed())
+
+		start := time.Now()
+		err := runSelfTest(context.Background(), eaaCtx)
+		Expect(err).To(MatchError(ContainSubstring("The self-test message wasn't received")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
+
+var _ = g.Describe("selfTestReports", func() {
+	g.It("ignores the messages of other self-tests", func() {
+		var reports selfTestReports
+		id, received := reports.expect()
+
+		reports.report("other")
+		Consistently(received, 10*time.Millisecond).ShouldNot(BeClosed())
+
+		reports.report(id)
+		Expect(received).To(BeClosed())
+		reports.report(id)
+	})
+})
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// A consumer connecting by GET /notifications?snapshot=true receives
+// the services producing any of its subscribed notifications as the first
+// frame of the websocket, before any other notification. The frame is
+// a notification of the reserved discovery producer named service-snapshot
+// whose payload is a ServiceSnapshot, the frames after it are the live
+// notifications. A service registering while the consumer connects may be
+// both in the snapshot and announced by a later discovery event, but no
+// registration falls between the two.
+const (
+	snapshotNotificationName    = "service-snapshot"
+	snapshotNotificationVersion = "1.0"
+)
+
+// snapshotConn is a consumer connection holding back the notifications
+// delivered to it until the service snapshot is written, so that
+// the snapshot is the first frame even though the connection is registered
+// before the snapshot is taken
+type snapshotConn struct {
+	notificationConn
+
+	lock     sync.Mutex
+	released bool
+	pending  []pendingMessage
+}
+
+// pendingMessage is a message held back by a snapshotConn
+type pendingMessage struct {
+	messageType int
+	data        []byte
+}
+
+// WriteMessage writes the message or holds it back until the snapshot
+// is written
+func (c *snapshotConn) WriteMessage(messageType int, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.released {
+		c.pending = append(c.pending, pendingMessage{messageType, data})
+		return nil
+	}
+	return c.notificationConn.WriteMessage(messageType, data)
+}
+
+// SetWriteDeadline sets the write deadline of a websocket, it's a no-op
+// for other connections
+func (c *snapshotConn) SetWriteDeadline(t time.Time) error {
+	if conn, ok := c.notificationConn.(interface {
+		SetWriteDeadline(t time.Time) error
+	}); ok {
+		return conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// release writes the snapshot followed by the messages held back, the ones
+// written later go through directly
+func (c *snapshotConn) release(snapshot []byte, writeTimeout time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.released = true
+	pending := c.pending
+	c.pending = nil
+
+	if err := c.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	if err := c.notificationConn.WriteMessage(websocket.TextMessage, snapshot); err != nil {
+		return err
+	}
+	for _, msg := range pending {
+		if err := c.notificationConn.WriteMessage(msg.messageType, msg.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSubscribedServices returns the registered services producing any of
+// the notifications the consumer is subscribed to, sorted by URN
+func getSubscribedServices(commonName string, eaaCtx *Context) ([]Service, error) {
+	subs, err := getConsumerSubscriptions(commonName, eaaCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	eaaCtx.serviceInfo.RLock()
+	defer eaaCtx.serviceInfo.RUnlock()
+
+	servs := []Service{}
+	for _, serv := range eaaCtx.serviceInfo.m {
+		for _, sub := range subs.Subscriptions {
+			if serviceMatchesSubscription(serv, sub) {
+				servs = append(servs, serv)
+				break
+			}
+		}
+	}
+	sort.Slice(servs, func(i, j int) bool {
+		return servs[i].URN.String() < servs[j].URN.String()
+	})
+	return servs, nil
+}
+
+// newServiceSnapshot returns the notification carrying the snapshot of
+// the services subscribed by the consumer
+func newServiceSnapshot(commonName string, eaaCtx *Context) ([]byte, error) {
+	servs, err := getSubscribedServices(commonName, eaaCtx)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(ServiceSnapshot{Services: servs})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(NotificationToConsumer{
+		Name:    snapshotNotificationName,
+		Version: snapshotNotificationVersion,
+		Payload: payload,
+		URN:     URN{Namespace: discoveryNamespace, ID: discoveryProducerID},
+	})
+}
+
+// sendServiceSnapshot writes the snapshot of the services subscribed by
+// the consumer to its new connection and releases the notifications held
+// back meanwhile. A connection the snapshot can't be written to is closed,
+// the registered connection is the one stored in the consumer connections.
+func sendServiceSnapshot(commonName string, conn *snapshotConn,
+	registered notificationConn, eaaCtx *Context) {
+
+	writeTimeout := eaaCtx.config().WebSocketWriteTimeout.Duration
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWebSocketWriteTimeout
+	}
+
+	snapshot, err := newServiceSnapshot(commonName, eaaCtx)
+	if err == nil {
+		err = conn.release(snapshot, writeTimeout)
+	}
+	if err != nil {
+		log.Errf("Failed to send the service snapshot to %s: %v", commonName, err)
+		removeConsumerConnection(commonName, registered, err, snapshotFailedCloseReason,
+			eaaCtx)
+	}
+}
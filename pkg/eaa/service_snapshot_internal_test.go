@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Service snapshot", func() {
+	var (
+		eaaCtx     *Context
+		server     *httptest.Server
+		commonName string
+	)
+
+	producer := Service{URN: &URN{ID: "producer", Namespace: "ns"},
+		Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}}}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.serviceInfo.m = map[string]Service{
+			"ns:producer": producer,
+			"ns:other": {URN: &URN{ID: "other", Namespace: "ns"},
+				Notifications: []NotificationDescriptor{{Name: "n2", Version: "1.0"}}},
+			"other:producer": {URN: &URN{ID: "producer", Namespace: "other"},
+				Notifications: []NotificationDescriptor{{Name: "n1", Version: "1.0"}}},
+		}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}}}}
+			if _, code, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaCtx))); err != nil {
+				w.WriteHeader(code)
+			}
+		}))
+		commonName = strings.TrimPrefix(server.URL, "http://")
+		Expect(addSubscriptionToNamespace(commonName, "ns", []NotificationDescriptor{
+			{Name: "n1", Version: "1.0"}}, eaaCtx)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+	})
+
+	dial := func(query string) (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(server.URL, "http")+query, nil)
+	}
+
+	read := func(conn *websocket.Conn) NotificationToConsumer {
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+		_, data, err := conn.ReadMessage()
+		Expect(err).ShouldNot(HaveOccurred())
+		var notif NotificationToConsumer
+		Expect(json.Unmarshal(data, &notif)).To(Succeed())
+		return notif
+	}
+
+	g.It("is the first frame before the live notifications", func() {
+		conn, _, err := dial("?snapshot=true")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		live, err := json.Marshal(NotificationToConsumer{Name: "n1", Version: "1.0",
+			URN: *producer.URN})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sendNotificationToSubscriber(commonName, nil, live, "", time.Time{},
+			eaaCtx)).To(Succeed())
+
+		snapshot := read(conn)
+		Expect(snapshot.Name).To(Equal(snapshotNotificationName))
+		Expect(snapshot.URN).To(Equal(URN{Namespace: discoveryNamespace,
+			ID: discoveryProducerID}))
+		var payload ServiceSnapshot
+		Expect(json.Unmarshal(snapshot.Payload, &payload)).To(Succeed())
+		Expect(payload.Services).To(Equal([]Service{producer}))
+
+		Expect(read(conn).Name).To(Equal("n1"))
+	})
+
+	g.It("isn't sent unless requested", func() {
+		conn, _, err := dial("")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		Expect(conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+		_, _, err = conn.ReadMessage()
+		Expect(err).Should(HaveOccurred())
+	})
+
+	g.It("rejects an invalid snapshot parameter", func() {
+		_, resp, err := dial("?snapshot=maybe")
+		Expect(err).Should(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	g.It("holds back the messages until released", func() {
+		fake := &fakeNotificationConn{sent: make(chan []byte, 3)}
+		conn := &snapshotConn{notificationConn: fake}
+
+		Expect(conn.WriteMessage(websocket.TextMessage, []byte("live1"))).To(Succeed())
+		Consistently(fake.sent).ShouldNot(Receive())
+
+		Expect(conn.release([]byte("snapshot"), time.Second)).To(Succeed())
+		Expect(conn.WriteMessage(websocket.TextMessage, []byte("live2"))).To(Succeed())
+		Expect(<-fake.sent).To(Equal([]byte("snapshot")))
+		Expect(<-fake.sent).To(Equal([]byte("live1")))
+		Expect(<-fake.sent).To(Equal([]byte("live2")))
+	})
+})
@@ -0,0 +1,315 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Service store backends available in ServiceStoreInfo
+const (
+	serviceStoreTypeMemory = "memory"
+	serviceStoreTypeFile   = "file"
+)
+
+// storedService is a registered service and the time of its last
+// registration or renewal
+type storedService struct {
+	CommonName string    `json:"commonName"`
+	Service    Service   `json:"service"`
+	Renewed    time.Time `json:"renewed"`
+}
+
+// serviceStore keeps the registered services across EAA restarts.
+//
+// Services are looked up in the service map of the Context, a store mirrors
+// each change of the map and the map is rebuilt from it on startup by
+// restoreServices. The changes are passed to the store with the map locked,
+// so that they're kept in order, and persisted by flush once the map is
+// unlocked, so that a slow store doesn't block the lookups.
+//
+// To add a backend, implement this interface and create it in
+// newServiceStore for a new ServiceStoreInfo.Type.
+type serviceStore interface {
+	// putService adds or replaces a registered service
+	putService(service storedService) error
+	// removeService removes a registered service
+	removeService(commonName string) error
+	// flush persists the services put and removed so far
+	flush() error
+	// load returns all stored services
+	load() ([]storedService, error)
+	// close releases the resources of the store
+	close() error
+}
+
+// memoryServiceStore is the default store. It keeps nothing, so services
+// live only in the service map and are lost on restart.
+type memoryServiceStore struct{}
+
+func (memoryServiceStore) putService(storedService) error {
+	return nil
+}
+
+func (memoryServiceStore) removeService(string) error {
+	return nil
+}
+
+func (memoryServiceStore) flush() error {
+	return nil
+}
+
+func (memoryServiceStore) load() ([]storedService, error) {
+	return nil, nil
+}
+
+func (memoryServiceStore) close() error {
+	return nil
+}
+
+// fileServiceStore keeps the services in a JSON file. The whole file is
+// rewritten on a flush after changes and replaced atomically, so that
+// a crash leaves either the previous or the new content.
+type fileServiceStore struct {
+	sync.Mutex
+	path     string
+	services map[string]storedService
+	// changed is set by the changes not written yet
+	changed bool
+	// writing serializes the writes of the file
+	writing sync.Mutex
+}
+
+func newFileServiceStore(cfg ServiceStoreInfo) (*fileServiceStore, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("Path of the file service store is not set")
+	}
+
+	store := &fileServiceStore{path: cfg.Path,
+		services: make(map[string]storedService)}
+	list, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, serv := range list {
+		store.services[serv.CommonName] = serv
+	}
+	return store, nil
+}
+
+// read returns the services of the file, none if it doesn't exist yet
+func (s *fileServiceStore) read() ([]storedService, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the service store")
+	}
+
+	var list []storedService
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode the service store %s", s.path)
+	}
+	return list, nil
+}
+
+// write replaces the file with the data. The data is synced to disk before
+// the file is replaced and the directory after, so that the replacement
+// survives a power loss too.
+func (s *fileServiceStore) write(data []byte) error {
+	dir := filepath.Dir(s.path)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create the service store file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "Failed to write the service store file")
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "Failed to sync the service store file")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "Failed to write the service store file")
+	}
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "Failed to replace the service store file")
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "Failed to sync the service store directory")
+	}
+	defer d.Close()
+	return errors.Wrap(d.Sync(), "Failed to sync the service store directory")
+}
+
+func (s *fileServiceStore) putService(service storedService) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.services[service.CommonName] = service
+	s.changed = true
+	return nil
+}
+
+func (s *fileServiceStore) removeService(commonName string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, found := s.services[commonName]; !found {
+		return nil
+	}
+	delete(s.services, commonName)
+	s.changed = true
+	return nil
+}
+
+// flush writes the services if they changed since the last write. The
+// services are taken once the previous write is done, so that the last
+// write has the services after all the changes.
+func (s *fileServiceStore) flush() error {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+
+	s.Lock()
+	if !s.changed {
+		s.Unlock()
+		return nil
+	}
+	list := make([]storedService, 0, len(s.services))
+	for _, serv := range s.services {
+		list = append(list, serv)
+	}
+	s.changed = false
+	s.Unlock()
+
+	data, err := json.Marshal(list)
+	if err == nil {
+		err = s.write(data)
+	}
+	if err != nil {
+		// The changes are written by the next flush
+		s.Lock()
+		s.changed = true
+		s.Unlock()
+	}
+	return errors.Wrap(err, "Failed to write the services")
+}
+
+func (s *fileServiceStore) load() ([]storedService, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	list := make([]storedService, 0, len(s.services))
+	for _, serv := range s.services {
+		list = append(list, serv)
+	}
+	return list, nil
+}
+
+func (s *fileServiceStore) close() error {
+	return nil
+}
+
+// newServiceStore creates a service store of the type set in the EAA config
+func newServiceStore(cfg ServiceStoreInfo) (serviceStore, error) {
+	switch cfg.Type {
+	case "", serviceStoreTypeMemory:
+		return memoryServiceStore{}, nil
+	case serviceStoreTypeFile:
+		return newFileServiceStore(cfg)
+	default:
+		return nil, errors.Errorf("Unknown service store type: %v", cfg.Type)
+	}
+}
+
+// servicesStore returns the service store of the context
+func (eaaCtx *Context) servicesStore() serviceStore {
+	if eaaCtx.serviceStore == nil {
+		return memoryServiceStore{}
+	}
+	return eaaCtx.serviceStore
+}
+
+// storeService mirrors a registered service to the store, which has to be
+// flushed by flushServices once the service map is unlocked. The service map
+// is changed already, so a failure is logged only.
+func storeService(commonName string, eaaCtx *Context) {
+	service := storedService{
+		CommonName: commonName,
+		Service:    eaaCtx.serviceInfo.m[commonName],
+		Renewed:    eaaCtx.serviceInfo.renewed[commonName],
+	}
+	if err := eaaCtx.servicesStore().putService(service); err != nil {
+		log.Errf("Failed to store the service '%v': %s", commonName, err.Error())
+	}
+}
+
+// flushServices persists the services stored and removed while the service
+// map was locked. The service map is changed already, so a failure is logged
+// only.
+func flushServices(eaaCtx *Context) {
+	if err := eaaCtx.servicesStore().flush(); err != nil {
+		log.Errf("Failed to store the services: %s", err.Error())
+	}
+}
+
+// restoreServices rebuilds the service map from the store. Services which
+// expired meanwhile are removed instead. It's run after the subscriptions
+// are restored, so that the namespaces of the restored services are
+// subscribed for the consumers subscribed with a namespace pattern.
+func restoreServices(eaaCtx *Context) error {
+	storedServices, err := eaaCtx.servicesStore().load()
+	if err != nil {
+		return errors.Wrap(err, "Failed to load services")
+	}
+
+	now := time.Now()
+	var (
+		restored   int
+		namespaces = make(map[string]bool)
+	)
+	eaaCtx.serviceInfo.Lock()
+	for _, stored := range storedServices {
+		if ttl := serviceTTL(stored.Service, eaaCtx); ttl > 0 && now.Sub(stored.Renewed) > ttl {
+			log.Infof("Stored service '%v' expired, removing it", stored.CommonName)
+			if err = eaaCtx.servicesStore().removeService(stored.CommonName); err != nil {
+				log.Errf("Failed to remove the service '%v' from the store: %s",
+					stored.CommonName, err.Error())
+			}
+			continue
+		}
+		eaaCtx.serviceInfo.m[stored.CommonName] = stored.Service
+		eaaCtx.serviceInfo.renewed[stored.CommonName] = stored.Renewed
+		if stored.Service.URN != nil {
+			namespaces[stored.Service.URN.Namespace] = true
+		}
+		restored++
+	}
+	eaaCtx.serviceInfo.Unlock()
+	flushServices(eaaCtx)
+
+	for namespace := range namespaces {
+		if isNamespaceWildcardSubscribed(namespace, eaaCtx) {
+			if err = addNotificationSubscriber(namespace, nil, eaaCtx); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Infof("Restored %d services", restored)
+	return nil
+}
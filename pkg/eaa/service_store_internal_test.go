@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Service store", func() {
+	var (
+		tempdir string
+		cfg     ServiceStoreInfo
+	)
+
+	// newStoreContext returns a context of a started EAA instance using
+	// the file service store
+	newStoreContext := func() *Context {
+		eaaCtx := &Context{}
+		eaaCtx.serviceInfo = services{m: make(map[string]Service),
+			renewed: make(map[string]time.Time)}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.cfg.DefaultServiceTTL.Duration = time.Minute
+
+		store, err := newServiceStore(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		eaaCtx.serviceStore = store
+		Expect(restoreServices(eaaCtx)).To(Succeed())
+		return eaaCtx
+	}
+
+	register := func(commonName string, eaaCtx *Context) {
+		urn, err := CommonNameStringToURN(commonName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addService(commonName, Service{URN: &urn, EndpointURI: "https://" + urn.ID},
+			eaaCtx)).To(Succeed())
+	}
+
+	g.BeforeEach(func() {
+		var err error
+		tempdir, err = ioutil.TempDir("", "eaaServiceStoreTest")
+		Expect(err).ToNot(HaveOccurred())
+		cfg = ServiceStoreInfo{Type: serviceStoreTypeFile,
+			Path: filepath.Join(tempdir, "services.json")}
+	})
+
+	g.AfterEach(func() {
+		os.RemoveAll(tempdir)
+	})
+
+	g.It("restores the registered services after a restart", func() {
+		eaaCtx := newStoreContext()
+		register("ns:a", eaaCtx)
+		register("ns:b", eaaCtx)
+		register("ns:c", eaaCtx)
+		description := "updated"
+		Expect(updateService("ns:b", ServiceUpdate{Description: &description},
+			eaaCtx)).To(Succeed())
+		Expect(removeService("ns:c", eaaCtx)).To(Succeed())
+
+		restarted := newStoreContext()
+		rec := httptest.NewRecorder()
+		GetServices(rec, newTLSRequest(http.MethodGet, "/services", "", "ns:consumer",
+			restarted))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var servList ServiceList
+		Expect(json.NewDecoder(rec.Body).Decode(&servList)).To(Succeed())
+		Expect(servList.Services).To(ConsistOf(eaaCtx.serviceInfo.m["ns:a"],
+			eaaCtx.serviceInfo.m["ns:b"]))
+		Expect(restarted.serviceInfo.renewed["ns:a"]).To(
+			BeTemporally("==", eaaCtx.serviceInfo.renewed["ns:a"]))
+	})
+
+	g.It("drops the services expired during the restart", func() {
+		eaaCtx := newStoreContext()
+		register("ns:a", eaaCtx)
+		register("ns:b", eaaCtx)
+		eaaCtx.serviceInfo.renewed["ns:b"] = time.Now().Add(-time.Hour)
+		storeService("ns:b", eaaCtx)
+		flushServices(eaaCtx)
+
+		restarted := newStoreContext()
+		Expect(restarted.serviceInfo.m).To(HaveLen(1))
+		Expect(restarted.serviceInfo.m).To(HaveKey("ns:a"))
+
+		stored, err := restarted.servicesStore().load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored).To(HaveLen(1))
+	})
+
+	g.It("writes the file on a flush only", func() {
+		store, err := newFileServiceStore(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.putService(storedService{CommonName: "ns:a"})).To(Succeed())
+		Expect(cfg.Path).ToNot(BeAnExistingFile())
+
+		Expect(store.flush()).To(Succeed())
+		Expect(cfg.Path).To(BeAnExistingFile())
+		list, err := store.read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+	})
+
+	g.It("keeps nothing in memory store", func() {
+		cfg = ServiceStoreInfo{}
+		register("ns:a", newStoreContext())
+
+		Expect(newStoreContext().serviceInfo.m).To(BeEmpty())
+	})
+
+	g.It("rejects an invalid config", func() {
+		_, err := newServiceStore(ServiceStoreInfo{Type: "etcd"})
+		Expect(err).To(HaveOccurred())
+		_, err = newServiceStore(ServiceStoreInfo{Type: serviceStoreTypeFile})
+		Expect(err).To(HaveOccurred())
+
+		Expect(ioutil.WriteFile(cfg.Path, []byte("{"), 0600)).To(Succeed())
+		_, err = newServiceStore(cfg)
+		Expect(err).To(HaveOccurred())
+	})
+})
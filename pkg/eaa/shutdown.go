@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// defaultShutdownDrainTimeout bounds every stage of a shutdown if
+// ShutdownDrainTimeout is not set
+const defaultShutdownDrainTimeout = 10 * time.Second
+
+// shutdownDrainTimeout returns the configured drain timeout or the default
+func shutdownDrainTimeout(eaaCtx *Context) time.Duration {
+	if timeout := eaaCtx.config().ShutdownDrainTimeout.Duration; timeout > 0 {
+		return timeout
+	}
+	return defaultShutdownDrainTimeout
+}
+
+// isShuttingDown checks if EAA stopped accepting registrations and
+// notifications because it is shutting down
+func isShuttingDown(eaaCtx *Context) bool {
+	return atomic.LoadInt32(&eaaCtx.shuttingDown) == 1
+}
+
+// shutdownServer stops accepting registrations and notifications, waits
+// for the requests in progress and drains the consumer connections and
+// webhooks, each within the drain timeout
+func shutdownServer(server *http.Server, eaaCtx *Context) {
+	atomic.StoreInt32(&eaaCtx.shuttingDown, 1)
+	timeout := shutdownDrainTimeout(eaaCtx)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warningf("Requests in progress not finished in %v: %v", timeout, err)
+		if err = server.Close(); err != nil {
+			log.Errf("Could not close EAA server: %#v", err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	drainConsumerConnections(deadline, eaaCtx)
+	drainWebhooks(deadline, eaaCtx)
+}
+
+// drainConsumerConnections removes the consumer connections, writes their
+// queued notifications until the deadline and closes them with a close frame
+func drainConsumerConnections(deadline time.Time, eaaCtx *Context) {
+	eaaCtx.consumerConnections.Lock()
+	conns := eaaCtx.consumerConnections.m
+	eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+	websocketConnections.Set(0)
+	eaaCtx.consumerConnections.Unlock()
+
+	var wg sync.WaitGroup
+	for commonName, consumerConns := range conns {
+		for _, consumerConn := range consumerConns {
+			if consumerConn.connection == nil {
+				continue
+			}
+			wg.Add(1)
+			go func(commonName string, conn notificationConn) {
+				defer wg.Done()
+
+				if queued, ok := conn.(*queuedConn); ok && !queued.drain(deadline) {
+					log.Warningf("Notifications queued for %s not drained, %d dropped",
+						commonName, queued.queuedLen())
+				}
+				closeWithReason(commonName, conn, shutdownCloseReason)
+			}(commonName, consumerConn.connection)
+		}
+	}
+	wg.Wait()
+}
+
+// runMessageHandler runs the handler of the messages of a Message Broker
+// subscriber, so that a shutdown can wait for it to finish
+func runMessageHandler(handler func(<-chan *message.Message, *Context),
+	messages <-chan *message.Message, eaaCtx *Context) {
+
+	eaaCtx.messageHandlers.Add(1)
+	go func() {
+		defer eaaCtx.messageHandlers.Done()
+		handler(messages, eaaCtx)
+	}()
+}
+
+// waitForMessageHandlers waits until the handlers of the removed Message
+// Broker subscribers finish, false is returned if they don't in time
+func waitForMessageHandlers(timeout time.Duration, eaaCtx *Context) bool {
+	done := make(chan struct{})
+	go func() {
+		eaaCtx.messageHandlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
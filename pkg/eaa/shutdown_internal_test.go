@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gorilla/websocket"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// closingNotificationConn records the close frame and the closing of
+// a consumer connection
+type closingNotificationConn struct {
+	fakeNotificationConn
+	closeFrame chan []byte
+	closed     int32
+}
+
+func (c *closingNotificationConn) WriteControl(_ int, data []byte, _ time.Time) error {
+	c.closeFrame <- data
+	return nil
+}
+
+func (c *closingNotificationConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+var _ = g.Describe("Graceful shutdown", func() {
+	var (
+		eaaCtx *Context
+		conn   *closingNotificationConn
+	)
+
+	g.BeforeEach(func() {
+		conn = &closingNotificationConn{
+			fakeNotificationConn: fakeNotificationConn{sent: make(chan []byte, 3)},
+			closeFrame:           make(chan []byte, 1),
+		}
+		eaaCtx = newFanOutContext([]notificationConn{
+			newQueuedConn(conn, 10, sendQueueOverflowDropOldest, time.Second)})
+	})
+
+	g.It("drains queued notifications before closing the connections", func() {
+		queued := eaaCtx.consumerConnections.m["ns:consumer0"][0].connection
+		for _, msg := range []string{"a", "b", "c"} {
+			Expect(queued.WriteMessage(websocket.TextMessage, []byte(msg))).To(Succeed())
+		}
+
+		drainConsumerConnections(time.Now().Add(time.Second), eaaCtx)
+
+		Expect(eaaCtx.consumerConnections.m).To(BeEmpty())
+		Expect(conn.sent).To(HaveLen(3))
+		Expect(<-conn.sent).To(Equal([]byte("a")))
+		Expect(<-conn.sent).To(Equal([]byte("b")))
+		Expect(<-conn.sent).To(Equal([]byte("c")))
+		Expect(<-conn.closeFrame).To(Equal(shutdownCloseReason.message()))
+		Expect(atomic.LoadInt32(&conn.closed)).To(Equal(int32(1)))
+	})
+
+	g.It("rejects registrations and notifications while shutting down", func() {
+		atomic.StoreInt32(&eaaCtx.shuttingDown, 1)
+
+		w := httptest.NewRecorder()
+		RegisterApplication(w, newTLSRequest(http.MethodPost, "/services",
+			`{"urn":{"id":"producer","namespace":"ns"}}`, "ns:producer", eaaCtx))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Body.String()).To(ContainSubstring(reasonShuttingDown))
+
+		w = httptest.NewRecorder()
+		PushNotificationToSubscribers(w, newTLSRequest(http.MethodPost, "/notifications",
+			`{"name":"n1","version":"1.0","payload":{}}`, "ns:producer", eaaCtx))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(conn.sent).To(BeEmpty())
+	})
+
+	g.It("waits for the Message Broker handlers to finish", func() {
+		messages := make(chan *message.Message)
+		runMessageHandler(func(messages <-chan *message.Message, _ *Context) {
+			for range messages {
+			}
+		}, messages, eaaCtx)
+
+		Expect(waitForMessageHandlers(50*time.Millisecond, eaaCtx)).To(BeFalse())
+		close(messages)
+		Expect(waitForMessageHandlers(time.Second, eaaCtx)).To(BeTrue())
+	})
+})
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// lastEventIDHeader carries the ID of the last event an event stream
+// consumer received, which it resumes the stream from
+const lastEventIDHeader = "Last-Event-ID"
+
+// errEventStreamClosed is returned when writing to a closed event stream
+var errEventStreamClosed = errors.New("event stream is closed")
+
+// sseConn is a consumer connection streaming the notifications as
+// Server-Sent Events. The ID of an event is the sequence number of
+// the notification, every event is flushed as soon as it's written.
+type sseConn struct {
+	sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+	closed  bool
+	// done is closed by Close to end the stream
+	done chan struct{}
+}
+
+func newSSEConn(w io.Writer, flusher http.Flusher) *sseConn {
+	return &sseConn{w: w, flusher: flusher, done: make(chan struct{})}
+}
+
+// WriteMessage writes a notification as an event, other websocket messages
+// are discarded
+func (c *sseConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return nil
+	}
+
+	var notif struct {
+		Sequence uint64 `json:"sequence"`
+	}
+	var event bytes.Buffer
+	if err := json.Unmarshal(data, &notif); err == nil && notif.Sequence != 0 {
+		fmt.Fprintf(&event, "id: %d\n", notif.Sequence)
+	}
+	// Notifications are compact JSON, so they fit a single data line
+	fmt.Fprintf(&event, "data: %s\n\n", data)
+	return c.write(event.Bytes())
+}
+
+// WriteControl discards the websocket control messages, the stream ends
+// by Close
+func (c *sseConn) WriteControl(int, []byte, time.Time) error {
+	return nil
+}
+
+// keepAlive writes a comment, which keeps proxies from closing an idle
+// stream and detects a consumer gone
+func (c *sseConn) keepAlive() error {
+	return c.write([]byte(": keep-alive\n\n"))
+}
+
+func (c *sseConn) write(data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return errEventStreamClosed
+	}
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+// Close ends the event stream, nothing is written to it afterwards
+func (c *sseConn) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+// parseLastEventID returns the sequence number of the last notification
+// an event stream consumer received, false if it starts a new stream
+func parseLastEventID(r *http.Request) (uint64, bool, error) {
+	id := r.Header.Get(lastEventIDHeader)
+	if id == "" {
+		return 0, false, nil
+	}
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid %s", lastEventIDHeader)
+	}
+	return seq, true, nil
+}
+
+// registerSSEConn registers the event stream as a consumer connection
+// with the filter and returns the registered connection, unless
+// the consumer has MaxConnectionsPerConsumer connections open already.
+// An unfiltered stream replaces the previous unfiltered connection, as
+// a websocket does.
+func registerSSEConn(commonName string, conn *sseConn, filter connectionFilter,
+	eaaCtx *Context) (notificationConn, error) {
+
+	eaaCtx.consumerConnections.Lock()
+	defer eaaCtx.consumerConnections.Unlock()
+
+	if filter.unfiltered() {
+		closePreviousConsumerConnection(commonName, eaaCtx)
+	}
+	if err := checkConnectionLimit(commonName, eaaCtx); err != nil {
+		return nil, err
+	}
+
+	connection := queueConsumerConn(commonName, conn, eaaCtx)
+	eaaCtx.consumerConnections.add(commonName, ConsumerConnection{
+		connection: connection, connectedAt: time.Now(), filter: filter})
+	return connection, nil
+}
+
+// streamEvents keeps the event stream open until it's closed or
+// the consumer is gone, writing a keep-alive comment every
+// WebSocketPingInterval
+func streamEvents(commonName string, r *http.Request, conn *sseConn,
+	registered notificationConn, eaaCtx *Context) {
+
+	// Nothing is written to the stream once the handler returns
+	defer conn.Close()
+
+	var keepAlive <-chan time.Time
+	if interval := eaaCtx.config().WebSocketPingInterval.Duration; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-keepAlive:
+			if err := conn.keepAlive(); err != nil {
+				removeConsumerConnection(commonName, registered, err,
+					connectionClosedCloseReason, eaaCtx)
+				return
+			}
+		case <-r.Context().Done():
+			removeConsumerConnection(commonName, registered, r.Context().Err(),
+				connectionClosedCloseReason, eaaCtx)
+			return
+		case <-conn.done:
+			return
+		}
+	}
+}
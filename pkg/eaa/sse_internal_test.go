@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Server-Sent Events", func() {
+	var (
+		eaaCtx *Context
+		server *httptest.Server
+	)
+
+	g.BeforeEach(func() {
+		eaaCtx = newFanOutContext(nil)
+		eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}].namespaceSubscriptions =
+			SubscriberIds{"ns:consumer"}
+		eaaCtx.cfg.NotificationReplayBufferSize = 10
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			r.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{
+					{Subject: pkix.Name{CommonName: "ns:consumer"}},
+				},
+			}
+			GetNotificationsSSE(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaCtx)))
+		}))
+	})
+
+	g.AfterEach(func() {
+		server.Close()
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	connect := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/notifications/sse", nil)
+		Expect(err).ToNot(HaveOccurred())
+		if lastEventID != "" {
+			req.Header.Set(lastEventIDHeader, lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	isConnected := func() bool {
+		eaaCtx.consumerConnections.RLock()
+		defer eaaCtx.consumerConnections.RUnlock()
+		_, found := eaaCtx.consumerConnections.m["ns:consumer"]
+		return found
+	}
+
+	push := func(payload string) {
+		_, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: json.RawMessage(payload)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	// readEvent returns the ID and the notification of the next event
+	readEvent := func(events *bufio.Reader) (string, NotificationToConsumer) {
+		var (
+			id    string
+			notif NotificationToConsumer
+		)
+		for {
+			line, err := events.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return id, notif
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")),
+					&notif)).To(Succeed())
+			}
+		}
+	}
+
+	g.It("streams the notifications and resumes the stream", func() {
+		resp, events := connect("")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+		Eventually(isConnected).Should(BeTrue())
+
+		push(`{"n":1}`)
+		id, notif := readEvent(events)
+		Expect(notif.Payload).To(MatchJSON(`{"n":1}`))
+		Expect(id).ToNot(BeEmpty())
+
+		resp.Body.Close()
+		Eventually(isConnected).Should(BeFalse())
+		push(`{"n":2}`)
+
+		resp, events = connect(id)
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		_, notif = readEvent(events)
+		Expect(notif.Payload).To(MatchJSON(`{"n":2}`))
+	})
+
+	g.It("ends the stream closed by EAA", func() {
+		resp, events := connect("")
+		defer resp.Body.Close()
+		Eventually(isConnected).Should(BeTrue())
+
+		closeConsumerConnection("ns:consumer", disconnectedCloseReason, eaaCtx)
+		_, err := events.ReadString('\n')
+		Expect(err).To(HaveOccurred())
+	})
+
+	g.It("rejects an invalid Last-Event-ID", func() {
+		resp, _ := connect("seven")
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(isConnected()).To(BeFalse())
+	})
+})
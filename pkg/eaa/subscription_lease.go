@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// subscriptionLease holds the expiry state of the subscriptions of
+// a consumer to a namespace or to a service
+type subscriptionLease struct {
+	duration time.Duration
+	renewed  time.Time
+}
+
+// leaseKey identifies the subscriptions a lease covers, the ones of
+// the consumer to the namespace, or to the service if serviceID is set
+type leaseKey struct {
+	commonName string
+	namespace  string
+	serviceID  string
+}
+
+// subscriptionLeases tracks the leases of consumer subscriptions. A lease
+// covers the subscriptions of a consumer to a namespace or to a service,
+// the last subscription request to them sets its duration. Subscriptions
+// without a lease are kept until the consumer unsubscribes. A renewal
+// extends all the leases of a consumer. The zero value is ready to use.
+type subscriptionLeases struct {
+	sync.Mutex
+	m map[leaseKey]subscriptionLease
+}
+
+// set starts a lease of the subscriptions, a duration <= 0 removes
+// the lease
+func (l *subscriptionLeases) set(key leaseKey, duration time.Duration, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+
+	if duration <= 0 {
+		delete(l.m, key)
+		return
+	}
+	if l.m == nil {
+		l.m = make(map[leaseKey]subscriptionLease)
+	}
+	l.m[key] = subscriptionLease{duration: duration, renewed: now}
+}
+
+// renew extends the leases of the consumer subscriptions. It returns false
+// if the consumer has no lease.
+func (l *subscriptionLeases) renew(commonName string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	found := false
+	for key, lease := range l.m {
+		if key.commonName == commonName {
+			lease.renewed = now
+			l.m[key] = lease
+			found = true
+		}
+	}
+	return found
+}
+
+// expiry returns the time the lease of the subscriptions ends unless
+// renewed, false is returned if they have no lease
+func (l *subscriptionLeases) expiry(key leaseKey) (time.Time, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	lease, found := l.m[key]
+	if !found {
+		return time.Time{}, false
+	}
+	return lease.renewed.Add(lease.duration), true
+}
+
+// remove drops the lease of the subscriptions
+func (l *subscriptionLeases) remove(key leaseKey) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.m, key)
+}
+
+// removeConsumer drops all the leases of the consumer
+func (l *subscriptionLeases) removeConsumer(commonName string) {
+	l.Lock()
+	defer l.Unlock()
+
+	for key := range l.m {
+		if key.commonName == commonName {
+			delete(l.m, key)
+		}
+	}
+}
+
+// overdue returns the leases which were not renewed within the fraction
+// of their duration
+func (l *subscriptionLeases) overdue(now time.Time, fraction float64) []leaseKey {
+	l.Lock()
+	defer l.Unlock()
+
+	var keys []leaseKey
+	for key, lease := range l.m {
+		if now.Sub(lease.renewed) > time.Duration(float64(lease.duration)*fraction) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// subscriptionLeaseDuration returns the lease requested in seconds,
+// 0 applies DefaultSubscriptionLease
+func subscriptionLeaseDuration(lease int, eaaCtx *Context) time.Duration {
+	if lease > 0 {
+		return time.Duration(lease) * time.Second
+	}
+	return eaaCtx.config().DefaultSubscriptionLease.Duration
+}
+
+// isConsumerConnected checks if the consumer has a notification websocket
+// on this EAA instance
+func isConsumerConnected(commonName string, eaaCtx *Context) bool {
+	eaaCtx.consumerConnections.RLock()
+	defer eaaCtx.consumerConnections.RUnlock()
+
+	for _, conn := range eaaCtx.consumerConnections.m[commonName] {
+		if conn.connection != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// publishSubscriptionLease publishes a lease message to the Client topic
+// of the consumer: a renewal of all its leases, or the removal of
+// the subscriptions of an expired lease
+func publishSubscriptionLease(ctx context.Context, key leaseKey, action string,
+	eaaCtx *Context) error {
+	subscriptionMsg := SubscriptionMessage{ClientCommonName: key.commonName,
+		Action: action, Scope: subscriptionScopeAll}
+	if action == subscriptionActionExpire {
+		subscriptionMsg.Scope = subscriptionScopeNamespace
+		if key.serviceID != "" {
+			subscriptionMsg.Scope = subscriptionScopeService
+		}
+		subscriptionMsg.Subscription = &Subscription{
+			URN: &URN{Namespace: key.namespace, ID: key.serviceID}}
+	}
+
+	data, err := json.Marshal(subscriptionMsg)
+	if err != nil {
+		return errors.Wrap(err, "Error during SubscriptionMessage structure marshaling")
+	}
+
+	clientTopic := getClientTopicName(key.commonName)
+	err = eaaCtx.MsgBrokerCtx.addPublisher(clientPublisher, clientTopic, nil)
+	if _, ok := err.(objectAlreadyExistsError); err != nil && !ok {
+		return errors.Wrapf(err, "Error when adding a Publisher of type: '%v', id: '%v'",
+			clientPublisher, clientTopic)
+	}
+	return publishMessage(ctx, clientTopic, message.NewMessage(key.commonName, data), eaaCtx)
+}
+
+// reapExpiredSubscriptions removes the subscriptions whose lease was not
+// renewed in time. The leases of a consumer connected to this EAA instance
+// are renewed on its behalf once half of one elapses, so that the other
+// instances keep its subscriptions too.
+func reapExpiredSubscriptions(eaaCtx *Context) {
+	now := time.Now()
+	expired := make(map[leaseKey]bool)
+	for _, key := range eaaCtx.subscriptionLeases.overdue(now, 1) {
+		expired[key] = true
+	}
+
+	renewed := make(map[string]bool)
+	for _, key := range eaaCtx.subscriptionLeases.overdue(now, 0.5) {
+		action := subscriptionActionExpire
+		if isConsumerConnected(key.commonName, eaaCtx) {
+			// A renewal extends all the leases of the consumer
+			if renewed[key.commonName] {
+				continue
+			}
+			renewed[key.commonName] = true
+			action, key = subscriptionActionRenew, leaseKey{commonName: key.commonName}
+		} else if !expired[key] {
+			continue
+		}
+
+		ctx, cancel := withPublishTimeout(context.Background(), eaaCtx)
+		err := publishSubscriptionLease(ctx, key, action, eaaCtx)
+		cancel()
+		if err != nil {
+			log.Errf("Failed to %s the subscriptions of '%v': %s", action, key.commonName,
+				err.Error())
+			continue
+		}
+
+		if action == subscriptionActionExpire {
+			log.Infof("Subscriptions of '%v' to %v expired, removal requested",
+				key.commonName, URN{Namespace: key.namespace, ID: key.serviceID}.String())
+		}
+	}
+}
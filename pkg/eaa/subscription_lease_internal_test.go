@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/mux"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Subscription leases", func() {
+	var eaaCtx *Context
+
+	subscribeTo := func(namespace, query string) int {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest("POST", "/subscriptions/"+namespace+query,
+			`[{"name":"n1","version":"1.0"}]`, "ns:consumer", eaaCtx)
+		SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+			map[string]string{"urn.namespace": namespace}))
+		return rec.Code
+	}
+
+	subscribe := func(query string) int {
+		return subscribeTo("ns", query)
+	}
+
+	renew := func() int {
+		rec := httptest.NewRecorder()
+		RenewSubscriptions(rec, newTLSRequest("POST", "/subscriptions/renew", "",
+			"ns:consumer", eaaCtx))
+		return rec.Code
+	}
+
+	subscriptionCount := func() int {
+		return countConsumerSubscriptions("ns:consumer", eaaCtx)
+	}
+
+	// expireLease backdates the renewal of the consumer leases
+	expireLease := func(by time.Duration) {
+		eaaCtx.subscriptionLeases.Lock()
+		defer eaaCtx.subscriptionLeases.Unlock()
+
+		for key, lease := range eaaCtx.subscriptionLeases.m {
+			lease.renewed = lease.renewed.Add(-by)
+			eaaCtx.subscriptionLeases.m[key] = lease
+		}
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("keeps subscriptions without a lease", func() {
+		Expect(subscribe("")).To(Equal(http.StatusCreated))
+		Eventually(subscriptionCount).Should(Equal(1))
+
+		reapExpiredSubscriptions(eaaCtx)
+		Consistently(subscriptionCount, "50ms").Should(Equal(1))
+		Expect(renew()).To(Equal(http.StatusNotFound))
+	})
+
+	g.It("removes subscriptions whose lease expired", func() {
+		Expect(subscribe("?lease=60")).To(Equal(http.StatusCreated))
+		Eventually(subscriptionCount).Should(Equal(1))
+
+		reapExpiredSubscriptions(eaaCtx)
+		Consistently(subscriptionCount, "50ms").Should(Equal(1))
+
+		expireLease(time.Minute + time.Second)
+		reapExpiredSubscriptions(eaaCtx)
+		Eventually(subscriptionCount).Should(BeZero())
+	})
+
+	g.It("expires the leased subscriptions only", func() {
+		Expect(subscribeTo("ns", "?lease=60")).To(Equal(http.StatusCreated))
+		Expect(subscribeTo("other", "")).To(Equal(http.StatusCreated))
+		Eventually(subscriptionCount).Should(Equal(2))
+		_, leased := eaaCtx.subscriptionLeases.expiry(leaseKey{"ns:consumer", "ns", ""})
+		Expect(leased).To(BeTrue())
+
+		expireLease(time.Minute + time.Second)
+		reapExpiredSubscriptions(eaaCtx)
+		Eventually(subscriptionCount).Should(Equal(1))
+		Consistently(subscriptionCount, "50ms").Should(Equal(1))
+
+		subs, err := getConsumerSubscriptions("ns:consumer", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs.Subscriptions).To(HaveLen(1))
+		Expect(subs.Subscriptions[0].URN).To(Equal(&URN{Namespace: "other"}))
+		Expect(renew()).To(Equal(http.StatusNotFound))
+	})
+
+	g.It("applies the default lease and extends it on renewal", func() {
+		eaaCtx.cfg.DefaultSubscriptionLease.Duration = time.Minute
+		Expect(subscribe("")).To(Equal(http.StatusCreated))
+		Eventually(subscriptionCount).Should(Equal(1))
+
+		expireLease(time.Minute + time.Second)
+		Expect(renew()).To(Equal(http.StatusNoContent))
+		reapExpiredSubscriptions(eaaCtx)
+		Consistently(subscriptionCount, "50ms").Should(Equal(1))
+	})
+
+	g.It("renews the lease of a connected consumer", func() {
+		Expect(subscribe("?lease=60")).To(Equal(http.StatusCreated))
+		Eventually(subscriptionCount).Should(Equal(1))
+		eaaCtx.consumerConnections.m["ns:consumer"] = []ConsumerConnection{{
+			connection: &fakeNotificationConn{}}}
+
+		expireLease(time.Minute + time.Second)
+		reapExpiredSubscriptions(eaaCtx)
+		Eventually(func() []leaseKey {
+			return eaaCtx.subscriptionLeases.overdue(time.Now(), 0.5)
+		}).Should(BeEmpty())
+		Expect(subscriptionCount()).To(Equal(1))
+	})
+
+	g.It("rejects an invalid lease", func() {
+		Expect(subscribe("?lease=-1")).To(Equal(http.StatusBadRequest))
+	})
+})
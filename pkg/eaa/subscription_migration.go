@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+	"path"
+	"sort"
+)
+
+// Subscriptions are exported from the subscription map, so the export
+// works with every subscription store backend, and imported like
+// the consumers would subscribe again, so that all EAA instances and
+// the store of the target get them. Leases aren't exported, imported
+// subscriptions get the default lease.
+
+// importedNotification identifies a notification of an imported
+// subscription of a consumer
+type importedNotification struct {
+	subscriberKey
+	notif UniqueNotif
+}
+
+// getSubscribedConsumers returns the sorted common names of the consumers
+// with at least one subscription
+func getSubscribedConsumers(eaaCtx *Context) []string {
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	found := make(map[string]bool)
+	for _, conSub := range eaaCtx.subscriptionInfo.m {
+		for _, subID := range conSub.namespaceSubscriptions {
+			found[subID] = true
+		}
+		for _, subIDs := range conSub.serviceSubscriptions {
+			for _, subID := range subIDs {
+				found[subID] = true
+			}
+		}
+	}
+
+	consumers := make([]string, 0, len(found))
+	for subID := range found {
+		consumers = append(consumers, subID)
+	}
+	sort.Strings(consumers)
+	return consumers
+}
+
+// sortSubscriptions sorts the subscriptions by their URNs and
+// the notifications of each by their names and versions
+func sortSubscriptions(subs []Subscription) {
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].URN.Namespace != subs[j].URN.Namespace {
+			return subs[i].URN.Namespace < subs[j].URN.Namespace
+		}
+		return subs[i].URN.ID < subs[j].URN.ID
+	})
+	for _, sub := range subs {
+		notif := sub.Notifications
+		sort.Slice(notif, func(i, j int) bool {
+			if notif[i].Name != notif[j].Name {
+				return notif[i].Name < notif[j].Name
+			}
+			if notif[i].Version != notif[j].Version {
+				return notif[i].Version < notif[j].Version
+			}
+			return notif[i].NameMatch < notif[j].NameMatch
+		})
+	}
+}
+
+// exportSubscriptions returns the subscriptions of all consumers
+func exportSubscriptions(eaaCtx *Context) (*SubscriptionExport, error) {
+	export := &SubscriptionExport{Consumers: []ConsumerSubscriptions{}}
+	for _, commonName := range getSubscribedConsumers(eaaCtx) {
+		subs, err := getConsumerSubscriptions(commonName, eaaCtx)
+		if err != nil {
+			return nil, err
+		}
+		// The consumer may have unsubscribed in the meantime
+		if len(subs.Subscriptions) == 0 {
+			continue
+		}
+		sortSubscriptions(subs.Subscriptions)
+		export.Consumers = append(export.Consumers, ConsumerSubscriptions{
+			CommonName:    commonName,
+			Subscriptions: subs.Subscriptions,
+		})
+	}
+	return export, nil
+}
+
+// validateImportedSubscription checks a subscription of a consumer to
+// be imported, a failure is returned with the status code and the reason
+func validateImportedSubscription(commonName string, sub Subscription,
+	eaaCtx *Context) (int, string, error) {
+
+	if _, err := CommonNameStringToURN(commonName); err != nil {
+		return http.StatusBadRequest, reasonInvalidURN, err
+	}
+	if sub.URN.ID == "" {
+		if err := validateURNComponent("namespace", sub.URN.Namespace); err != nil {
+			return http.StatusBadRequest, reasonInvalidURN, err
+		}
+		if _, err := path.Match(sub.URN.Namespace, ""); err != nil {
+			return http.StatusBadRequest, reasonInvalidNamespacePattern, err
+		}
+	} else if err := validateServiceURNVars(*sub.URN); err != nil {
+		return http.StatusBadRequest, reasonInvalidURN, err
+	}
+	if err := validateSubscriptionNotifications(sub.Notifications); err != nil {
+		return http.StatusBadRequest, reasonInvalidNotification, err
+	}
+	if err := checkNamespaceAccess(commonName, sub.URN.Namespace, eaaCtx); err != nil {
+		return http.StatusForbidden, reasonNamespaceAccessDenied, err
+	}
+	return 0, "", nil
+}
+
+// newImportedNotifications splits the notifications of an imported
+// subscription into the ones the consumer isn't subscribed to yet and
+// the number of the others. Notifications seen earlier in the import are
+// skipped as well.
+func newImportedNotifications(commonName string, urn URN, notif []NotificationDescriptor,
+	seen map[importedNotification]bool, eaaCtx *Context) ([]NotificationDescriptor, int) {
+
+	eaaCtx.subscriptionInfo.RLock()
+	defer eaaCtx.subscriptionInfo.RUnlock()
+
+	var added []NotificationDescriptor
+	skipped := 0
+	for _, n := range notif {
+		key := UniqueNotif{
+			namespace:    urn.Namespace,
+			notifName:    subscriptionNotifName(n),
+			notifVersion: n.Version,
+		}
+		seenKey := importedNotification{
+			subscriberKey: subscriberKey{serviceID: urn.ID, subID: commonName},
+			notif:         key,
+		}
+		if seen[seenKey] || isSubscribed(commonName, key, urn.ID, eaaCtx) {
+			skipped++
+			continue
+		}
+		seen[seenKey] = true
+		added = append(added, n)
+	}
+	return added, skipped
+}
+
+// importSubscription subscribes the consumer to the notifications of
+// an imported subscription it isn't subscribed to yet
+func importSubscription(commonName string, sub Subscription,
+	seen map[importedNotification]bool, r *http.Request, eaaCtx *Context,
+	result *SubscriptionImportResult) {
+
+	failure := SubscriptionImportFailure{CommonName: commonName,
+		SubscriptionResult: SubscriptionResult{URN: sub.URN}}
+	if sub.URN == nil {
+		failure.Code = http.StatusBadRequest
+		failure.Error = reasonInvalidURN
+		failure.Detail = "subscription requires a namespace"
+		result.Failed = append(result.Failed, failure)
+		return
+	}
+	urn := URN{Namespace: normalizeNamespace(sub.URN.Namespace), ID: sub.URN.ID}
+	sub.URN = &urn
+	failure.URN = &urn
+
+	if code, reason, err := validateImportedSubscription(commonName, sub,
+		eaaCtx); err != nil {
+		failure.Code, failure.Error, failure.Detail = code, reason, err.Error()
+		result.Failed = append(result.Failed, failure)
+		return
+	}
+
+	added, skipped := newImportedNotifications(commonName, urn, sub.Notifications, seen,
+		eaaCtx)
+	result.Skipped += skipped
+	if len(added) == 0 {
+		return
+	}
+
+	if err := checkSubscriptionLimit(commonName, urn.Namespace, urn.ID, added,
+		eaaCtx); err != nil {
+		failure.Code = http.StatusForbidden
+		failure.Error = reasonSubscriptionLimit
+		failure.Detail = err.Error()
+		result.Failed = append(result.Failed, failure)
+		return
+	}
+
+	scope := subscriptionScopeNamespace
+	if urn.ID != "" {
+		scope = subscriptionScopeService
+	}
+	ctx, cancel := withPublishTimeout(r.Context(), eaaCtx)
+	defer cancel()
+	if err := processSubscriptionRequest(ctx, subscriptionActionSubscribe, scope,
+		commonName, &urn, added, 0, r, eaaCtx); err != nil {
+		log.Errf("Import Subscriptions: subscription of %s to %s failed: %s", commonName,
+			urn.String(), err.Error())
+		switch {
+		case isPublishTimeout(err):
+			failure.Code, failure.Error = http.StatusServiceUnavailable, reasonBrokerPublishTimeout
+		case isBrokerCircuitOpen(err):
+			failure.Code, failure.Error = http.StatusServiceUnavailable, reasonBrokerUnavailable
+		default:
+			failure.Code, failure.Error = http.StatusInternalServerError, reasonSubscriptionFailed
+		}
+		failure.Detail = err.Error()
+		result.Failed = append(result.Failed, failure)
+		return
+	}
+	result.Added += len(added)
+}
+
+// importSubscriptions subscribes the consumers to the exported
+// subscriptions. Subscriptions which already exist are skipped, so
+// an import can be repeated.
+func importSubscriptions(export SubscriptionExport, r *http.Request,
+	eaaCtx *Context) SubscriptionImportResult {
+
+	result := SubscriptionImportResult{Failed: []SubscriptionImportFailure{}}
+	seen := make(map[importedNotification]bool)
+	for _, consumer := range export.Consumers {
+		for _, sub := range consumer.Subscriptions {
+			importSubscription(consumer.CommonName, sub, seen, r, eaaCtx, &result)
+		}
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Subscription migration", func() {
+	const admin = "ns:admin"
+
+	var (
+		source *Context
+		target *Context
+		sink   *bytes.Buffer
+	)
+
+	newMigrationContext := func() *Context {
+		eaaCtx := &Context{audit: &auditLogger{w: sink}}
+		eaaCtx.cfg.AdminCommonNames = []string{admin}
+		eaaCtx.serviceInfo.m = make(map[string]Service)
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		return eaaCtx
+	}
+
+	serve := func(method, target, body, commonName string,
+		eaaCtx *Context) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		NewEaaRouter(eaaCtx).ServeHTTP(rec, newTLSRequest(method, target, body,
+			commonName, eaaCtx))
+		return rec
+	}
+
+	export := func() []byte {
+		rec := serve(http.MethodGet, "/admin/subscriptions/export", "", admin, source)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		return rec.Body.Bytes()
+	}
+
+	importSubs := func(body []byte) (int, SubscriptionImportResult) {
+		rec := serve(http.MethodPost, "/admin/subscriptions/import", string(body), admin,
+			target)
+		var result SubscriptionImportResult
+		Expect(json.NewDecoder(rec.Body).Decode(&result)).To(Succeed())
+		return rec.Code, result
+	}
+
+	g.BeforeEach(func() {
+		sink = &bytes.Buffer{}
+		source = newMigrationContext()
+		target = newMigrationContext()
+
+		Expect(addSubscriptionToNamespace("ns:consumer1", "ns", []NotificationDescriptor{
+			{Name: "n2", Version: "1.0", Filter: map[string]string{"zone": "1"}},
+			{Name: "n1", Version: "1.0"}}, source)).To(Succeed())
+		Expect(addSubscriptionToService("ns:consumer1", "ns", "producer",
+			[]NotificationDescriptor{{Name: "t.", Version: "1.0", NameMatch: nameMatchPrefix}},
+			source)).To(Succeed())
+		Expect(addSubscriptionToNamespace("ns:consumer0", "n*", []NotificationDescriptor{
+			{Name: "n1", Version: "2.0"}}, source)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(source.MsgBrokerCtx.removeAll()).To(Succeed())
+		Expect(target.MsgBrokerCtx.removeAll()).To(Succeed())
+	})
+
+	g.It("exports the subscriptions of all consumers", func() {
+		Expect(json.RawMessage(export())).To(MatchJSON(`{"consumers":[
+			{"commonName":"ns:consumer0","subscriptions":[
+				{"urn":{"namespace":"n*"},
+					"notifications":[{"name":"n1","version":"2.0"}]}]},
+			{"commonName":"ns:consumer1","subscriptions":[
+				{"urn":{"namespace":"ns"},"notifications":[
+					{"name":"n1","version":"1.0"},
+					{"name":"n2","version":"1.0","filter":{"zone":"1"}}]},
+				{"urn":{"id":"producer","namespace":"ns"},"notifications":[
+					{"name":"t.","version":"1.0","nameMatch":"prefix"}]}]}]}`))
+	})
+
+	g.It("imports the exported subscriptions once", func() {
+		exported := export()
+
+		code, result := importSubs(exported)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(result).To(Equal(SubscriptionImportResult{Added: 4,
+			Failed: []SubscriptionImportFailure{}}))
+		Eventually(func() []byte {
+			exp, err := exportSubscriptions(target)
+			Expect(err).ToNot(HaveOccurred())
+			data, _ := json.Marshal(exp)
+			return data
+		}).Should(MatchJSON(exported))
+
+		code, result = importSubs(exported)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(result).To(Equal(SubscriptionImportResult{Skipped: 4,
+			Failed: []SubscriptionImportFailure{}}))
+	})
+
+	g.It("skips duplicates and reports invalid subscriptions", func() {
+		code, result := importSubs([]byte(`{"consumers":[
+			{"commonName":"ns:consumer2","subscriptions":[
+				{"urn":{"namespace":"NS"},"notifications":[{"name":"n1","version":"1.0"}]},
+				{"urn":{"namespace":"ns"},"notifications":[{"name":"n1","version":"1.0"}]},
+				{"urn":{"namespace":"ns"},"notifications":[{"name":"n1","version":"x y"}]},
+				{"notifications":[{"name":"n1","version":"1.0"}]}]},
+			{"commonName":"consumer3","subscriptions":[
+				{"urn":{"namespace":"ns"},"notifications":[{"name":"n1","version":"1.0"}]}]}]}`))
+
+		Expect(code).To(Equal(http.StatusMultiStatus))
+		Expect(result.Added).To(Equal(1))
+		Expect(result.Skipped).To(Equal(1))
+		Expect(result.Failed).To(HaveLen(3))
+		Expect(result.Failed[0].CommonName).To(Equal("ns:consumer2"))
+		Expect(result.Failed[0].Error).To(Equal(reasonInvalidNotification))
+		Expect(result.Failed[1].Error).To(Equal(reasonInvalidURN))
+		Expect(result.Failed[2].CommonName).To(Equal("consumer3"))
+		Expect(result.Failed[2].Error).To(Equal(reasonInvalidURN))
+	})
+
+	g.It("is restricted to admins and audited", func() {
+		Expect(serve(http.MethodGet, "/admin/subscriptions/export", "", "ns:consumer1",
+			source).Code).To(Equal(http.StatusForbidden))
+		Expect(serve(http.MethodPost, "/admin/subscriptions/import", "{}", "ns:consumer1",
+			target).Code).To(Equal(http.StatusForbidden))
+		importSubs(export())
+
+		var actions []string
+		dec := json.NewDecoder(bytes.NewReader(sink.Bytes()))
+		for dec.More() {
+			var rec auditRecord
+			Expect(dec.Decode(&rec)).To(Succeed())
+			actions = append(actions, rec.Action+" "+rec.CommonName+" "+rec.Status)
+		}
+		Expect(actions).To(Equal([]string{
+			"export ns:consumer1 403",
+			"import ns:consumer1 403",
+			"export ns:admin 200",
+			"import ns:admin 200",
+		}))
+	})
+})
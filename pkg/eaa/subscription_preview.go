@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net/http"
+)
+
+// A preview applies a change of the subscriptions of a consumer to a clone
+// of them and returns the resulting subscriptions, the subscriptions of
+// the consumer are left as they are. The subscriptions removed by the change
+// are removed first, then the ones added are added, which replaces
+// the filter, transform and the other options of a notification the consumer
+// is subscribed to already. The subscriptions removed and added are validated
+// the way the unsubscribe and subscribe handlers validate them and a change
+// with a subscription they would reject is rejected as a whole, with
+// the status code and the reason of the subscription.
+
+// previewSubscriptions returns the subscriptions of the consumer after
+// the change, or the result of the first subscription of the change which
+// would be rejected
+func previewSubscriptions(commonName string, change SubscriptionChange,
+	eaaCtx *Context) (*SubscriptionList, *SubscriptionResult, error) {
+
+	preview, err := cloneConsumerSubscriptions(commonName, eaaCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, sub := range change.Remove {
+		if sub.URN == nil {
+			return nil, &SubscriptionResult{Code: http.StatusBadRequest,
+				Error: reasonInvalidURN, Detail: "unsubscription requires a namespace"}, nil
+		}
+		urn := URN{Namespace: normalizeNamespace(sub.URN.Namespace), ID: sub.URN.ID}
+		if rejected := validateUnsubscription(urn); rejected != nil {
+			return nil, rejected, nil
+		}
+		if urn.ID == "" {
+			err = removeSubscriptionToNamespace(commonName, urn.Namespace,
+				sub.Notifications, preview)
+		} else {
+			err = removeSubscriptionToService(commonName, urn.Namespace, urn.ID,
+				sub.Notifications, preview)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, sub := range change.Add {
+		if sub.URN == nil {
+			return nil, &SubscriptionResult{Code: http.StatusBadRequest,
+				Error: reasonInvalidURN, Detail: "subscription requires a namespace"}, nil
+		}
+		urn := URN{Namespace: normalizeNamespace(sub.URN.Namespace), ID: sub.URN.ID}
+		scope := subscriptionScopeNamespace
+		if urn.ID != "" {
+			scope = subscriptionScopeService
+		}
+		if rejected := validateSubscription(commonName, scope, urn, sub.Notifications,
+			eaaCtx); rejected != nil {
+			return nil, rejected, nil
+		}
+		if urn.ID == "" {
+			err = addSubscriptionToNamespace(commonName, urn.Namespace, sub.Notifications,
+				preview)
+		} else {
+			err = addSubscriptionToService(commonName, urn.Namespace, urn.ID,
+				sub.Notifications, preview)
+		}
+		if _, ok := err.(subscriptionLimitError); ok {
+			return nil, &SubscriptionResult{URN: &urn, Code: http.StatusForbidden,
+				Error: reasonSubscriptionLimit, Detail: err.Error()}, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	subs, err := getConsumerSubscriptions(commonName, preview)
+	if err != nil {
+		return nil, nil, err
+	}
+	sortSubscriptions(subs.Subscriptions)
+	return subs, nil, nil
+}
+
+// cloneConsumerSubscriptions returns a context with the config of the EAA
+// context whose subscription map holds a copy of the subscriptions of
+// the consumer only
+func cloneConsumerSubscriptions(commonName string, eaaCtx *Context) (*Context, error) {
+	subs, err := getConsumerSubscriptions(commonName, eaaCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := &Context{cfg: *eaaCtx.config()}
+	clone.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+	for _, sub := range subs.Subscriptions {
+		for _, n := range sub.Notifications {
+			if sub.URN.ID == "" {
+				indexNamespaceSubscription(commonName, sub.URN.Namespace, n, clone)
+			} else {
+				indexServiceSubscription(commonName, sub.URN.Namespace, sub.URN.ID, n,
+					clone)
+			}
+		}
+	}
+	return clone, nil
+}
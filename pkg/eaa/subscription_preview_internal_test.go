@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Subscription preview", func() {
+	var (
+		eaaCtx  *Context
+		current *SubscriptionList
+	)
+
+	preview := func(change string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		PreviewSubscriptions(rec, newTLSRequest("POST", "/subscriptions/preview", change,
+			"ns:consumer", eaaCtx))
+		return rec
+	}
+
+	expectRejected := func(rec *httptest.ResponseRecorder, code int, reason string) {
+		Expect(rec.Code).To(Equal(code))
+		var resp ErrorResponse
+		Expect(json.NewDecoder(rec.Body).Decode(&resp)).To(Succeed())
+		Expect(resp.Error).To(Equal(reason))
+	}
+
+	g.BeforeEach(func() {
+		eaaCtx = &Context{}
+		eaaCtx.serviceInfo = services{m: map[string]Service{
+			"ns:producer": {URN: &URN{Namespace: "ns", ID: "producer"}}},
+			renewed: make(map[string]time.Time)}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		Expect(addSubscriptionToNamespace("ns:consumer", "ns", []NotificationDescriptor{
+			{Name: "n1", Version: "1.0"}, {Name: "n2", Version: "1.0"}}, eaaCtx)).To(Succeed())
+
+		var err error
+		current, err = getConsumerSubscriptions("ns:consumer", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		sortSubscriptions(current.Subscriptions)
+	})
+
+	g.AfterEach(func() {
+		subs, err := getConsumerSubscriptions("ns:consumer", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		sortSubscriptions(subs.Subscriptions)
+		Expect(subs).To(Equal(current), "the preview changed the subscriptions")
+	})
+
+	g.It("returns the subscriptions after the change without applying it", func() {
+		rec := preview(`{
+			"remove":[{"urn":{"namespace":"ns"},"notifications":[{"name":"n2","version":"1.0"}]}],
+			"add":[{"urn":{"namespace":"ns","id":"producer"},
+			        "notifications":[{"name":"n3","version":"2.0","qos":"at-least-once"}]},
+			       {"urn":{"namespace":"ns"},
+			        "notifications":[{"name":"n1","version":"1.0","filter":{"a":"1"}}]}]}`)
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var subs SubscriptionList
+		Expect(json.NewDecoder(rec.Body).Decode(&subs)).To(Succeed())
+		Expect(subs.Subscriptions).To(Equal([]Subscription{
+			{URN: &URN{Namespace: "ns"}, Notifications: []NotificationDescriptor{
+				{Name: "n1", Version: "1.0", Filter: map[string]string{"a": "1"}}}},
+			{URN: &URN{Namespace: "ns", ID: "producer"}, Notifications: []NotificationDescriptor{
+				{Name: "n3", Version: "2.0", QoS: NotificationQoSAtLeastOnce}}},
+		}))
+	})
+
+	g.It("rejects an invalid notification by 400", func() {
+		expectRejected(preview(`{"add":[{"urn":{"namespace":"ns"},
+			"notifications":[{"name":"n3"}]}]}`),
+			http.StatusBadRequest, reasonInvalidNotification)
+	})
+
+	g.It("rejects a change without a URN by 400", func() {
+		expectRejected(preview(`{"remove":[{"notifications":[{"name":"n1","version":"1.0"}]}]}`),
+			http.StatusBadRequest, reasonInvalidURN)
+		expectRejected(preview(`{"add":[{"notifications":[{"name":"n1","version":"1.0"}]}]}`),
+			http.StatusBadRequest, reasonInvalidURN)
+	})
+
+	g.It("rejects an invalid removal by 400", func() {
+		expectRejected(preview(`{"remove":[{"urn":{"namespace":""},
+			"notifications":[{"name":"n1","version":"1.0"}]}]}`),
+			http.StatusBadRequest, reasonInvalidURN)
+		expectRejected(preview(`{"remove":[{"urn":{"namespace":"ns","id":"a/b"},
+			"notifications":[{"name":"n1","version":"1.0"}]}]}`),
+			http.StatusBadRequest, reasonInvalidURN)
+	})
+
+	g.It("rejects a subscription to an unregistered service by 404", func() {
+		expectRejected(preview(`{"add":[{"urn":{"namespace":"ns","id":"unknown"},
+			"notifications":[{"name":"n1","version":"1.0"}]}]}`),
+			http.StatusNotFound, reasonServiceNotFound)
+	})
+
+	g.It("applies the subscription limit to the previewed subscriptions", func() {
+		eaaCtx.cfg.MaxSubscriptionsPerConsumer = 2
+		add := `{"urn":{"namespace":"ns"},"notifications":[{"name":"n3","version":"1.0"}]}`
+
+		expectRejected(preview(`{"add":[`+add+`]}`), http.StatusForbidden,
+			reasonSubscriptionLimit)
+		Expect(preview(`{"remove":[{"urn":{"namespace":"ns"},
+			"notifications":[{"name":"n2","version":"1.0"}]}],
+			"add":[` + add + `]}`).Code).To(Equal(http.StatusOK))
+	})
+})
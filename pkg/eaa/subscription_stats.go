@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// subscriptionStatsKey identifies the counters of a consumer and
+// a notification
+type subscriptionStatsKey struct {
+	subID string
+	notif UniqueNotif
+}
+
+// subscriptionCounters are the delivery counters of a consumer and
+// a notification, updated atomically
+type subscriptionCounters struct {
+	matched   uint64
+	filtered  uint64
+	delivered uint64
+	dropped   uint64
+}
+
+// subscriptionStats holds the delivery counters of the consumer
+// subscriptions. The counters of a consumer and a notification are created
+// once and then only updated atomically, so that the fan-out doesn't
+// contend on a lock. They are monotonic for the lifetime of the EAA process
+// and not reset when subscriptions change. The zero value is ready to use.
+type subscriptionStats struct {
+	m sync.Map
+}
+
+// counters returns the counters of the consumer and the notification,
+// creating them on first use
+func (s *subscriptionStats) counters(subID string,
+	notif UniqueNotif) *subscriptionCounters {
+
+	key := subscriptionStatsKey{subID: subID, notif: notif}
+	if c, ok := s.m.Load(key); ok {
+		return c.(*subscriptionCounters)
+	}
+	c, _ := s.m.LoadOrStore(key, &subscriptionCounters{})
+	return c.(*subscriptionCounters)
+}
+
+// delivered returns the number of notifications delivered to the consumer
+// from the namespaces matched by the namespace or pattern
+func (s *subscriptionStats) delivered(subID string, namespace string,
+	notif NotificationDescriptor) uint64 {
+
+	var delivered uint64
+	s.m.Range(func(k, v interface{}) bool {
+		key := k.(subscriptionStatsKey)
+		if key.subID == subID && descriptorNameMatches(notif, key.notif.notifName) &&
+			key.notif.notifVersion == notif.Version &&
+			(key.notif.namespace == namespace ||
+				namespaceMatches(namespace, key.notif.namespace)) {
+			delivered += atomic.LoadUint64(&v.(*subscriptionCounters).delivered)
+		}
+		return true
+	})
+	return delivered
+}
+
+// list returns the counters of the consumer, or of all consumers if subID
+// is empty, sorted by consumer and notification
+func (s *subscriptionStats) list(subID string) []SubscriptionStats {
+	stats := []SubscriptionStats{}
+	s.m.Range(func(k, v interface{}) bool {
+		key := k.(subscriptionStatsKey)
+		if subID != "" && key.subID != subID {
+			return true
+		}
+		c := v.(*subscriptionCounters)
+		stats = append(stats, SubscriptionStats{
+			Consumer:  key.subID,
+			Namespace: key.notif.namespace,
+			Notification: NotificationDescriptor{
+				Name:    key.notif.notifName,
+				Version: key.notif.notifVersion,
+			},
+			Matched:   atomic.LoadUint64(&c.matched),
+			Filtered:  atomic.LoadUint64(&c.filtered),
+			Delivered: atomic.LoadUint64(&c.delivered),
+			Dropped:   atomic.LoadUint64(&c.dropped),
+		})
+		return true
+	})
+
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Consumer != b.Consumer {
+			return a.Consumer < b.Consumer
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Notification.Name != b.Notification.Name {
+			return a.Notification.Name < b.Notification.Name
+		}
+		return a.Notification.Version < b.Notification.Version
+	})
+	return stats
+}
@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Subscription store backends available in SubscriptionStoreInfo
+const (
+	subscriptionStoreTypeMemory = "memory"
+	subscriptionStoreTypeRedis  = "redis"
+)
+
+// storedSubscription is a subscription of a consumer to a notification of
+// a namespace, or of a service if ServiceID isn't empty
+type storedSubscription struct {
+	CommonName   string                 `json:"commonName"`
+	Namespace    string                 `json:"namespace"`
+	ServiceID    string                 `json:"serviceId,omitempty"`
+	Notification NotificationDescriptor `json:"notification"`
+}
+
+// subscriptionStore keeps consumer subscriptions across EAA restarts.
+//
+// Notifications are matched against the subscription map of the Context,
+// each change of the map is written to the store before the map is changed,
+// so that a change the store failed to keep isn't applied, and the map is
+// rebuilt from the store on startup by restoreSubscriptions. The store is
+// written without the subscription map locked, the changes of
+// the subscriptions of a consumer are applied one by one by the handler of
+// its Client topic. A subscription scope is a namespace (with an empty
+// serviceID) or a service within a namespace.
+//
+// To add a backend, implement this interface and create it in
+// newSubscriptionStore for a new SubscriptionStoreInfo.Type. A store can be
+// shared by EAA instances, so all the methods have to be idempotent.
+type subscriptionStore interface {
+	// addSubscriptions adds or replaces subscriptions of a consumer to
+	// the notifications of the scope
+	addSubscriptions(commonName, namespace, serviceID string,
+		notif []NotificationDescriptor) error
+	// removeSubscriptions removes subscriptions of a consumer to
+	// the notifications of the scope
+	removeSubscriptions(commonName, namespace, serviceID string,
+		notif []NotificationDescriptor) error
+	// removeScopeSubscriptions removes all subscriptions of a consumer
+	// to the scope
+	removeScopeSubscriptions(commonName, namespace, serviceID string) error
+	// removeConsumer removes all subscriptions of a consumer
+	removeConsumer(commonName string) error
+	// load returns all stored subscriptions
+	load() ([]storedSubscription, error)
+	// close releases the resources of the store
+	close() error
+}
+
+// memorySubscriptionKey identifies a subscription in memorySubscriptionStore
+type memorySubscriptionKey struct {
+	commonName string
+	namespace  string
+	serviceID  string
+	name       string
+	version    string
+}
+
+// memorySubscriptionStore is the default store. It keeps the subscriptions
+// in memory, so they are lost on restart.
+type memorySubscriptionStore struct {
+	sync.Mutex
+	m map[memorySubscriptionKey]storedSubscription
+}
+
+func newMemorySubscriptionStore() *memorySubscriptionStore {
+	return &memorySubscriptionStore{m: make(map[memorySubscriptionKey]storedSubscription)}
+}
+
+func (s *memorySubscriptionStore) addSubscriptions(commonName, namespace, serviceID string,
+	notif []NotificationDescriptor) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, n := range notif {
+		s.m[memorySubscriptionKey{commonName, namespace, serviceID,
+			subscriptionNotifName(n), n.Version}] = storedSubscription{
+			CommonName: commonName, Namespace: namespace, ServiceID: serviceID,
+			Notification: n}
+	}
+	return nil
+}
+
+func (s *memorySubscriptionStore) removeSubscriptions(commonName, namespace,
+	serviceID string, notif []NotificationDescriptor) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, n := range notif {
+		delete(s.m, memorySubscriptionKey{commonName, namespace, serviceID,
+			subscriptionNotifName(n), n.Version})
+	}
+	return nil
+}
+
+func (s *memorySubscriptionStore) removeScopeSubscriptions(commonName, namespace,
+	serviceID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for key := range s.m {
+		if key.commonName == commonName && key.namespace == namespace &&
+			key.serviceID == serviceID {
+			delete(s.m, key)
+		}
+	}
+	return nil
+}
+
+func (s *memorySubscriptionStore) removeConsumer(commonName string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for key := range s.m {
+		if key.commonName == commonName {
+			delete(s.m, key)
+		}
+	}
+	return nil
+}
+
+func (s *memorySubscriptionStore) load() ([]storedSubscription, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	subs := make([]storedSubscription, 0, len(s.m))
+	for _, sub := range s.m {
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (s *memorySubscriptionStore) close() error {
+	return nil
+}
+
+// newSubscriptionStore creates a subscription store of the type set in
+// the EAA config
+func newSubscriptionStore(cfg SubscriptionStoreInfo) (subscriptionStore, error) {
+	switch cfg.Type {
+	case "", subscriptionStoreTypeMemory:
+		return newMemorySubscriptionStore(), nil
+	case subscriptionStoreTypeRedis:
+		return newRedisSubscriptionStore(cfg)
+	default:
+		return nil, errors.Errorf("Unknown subscription store type: %v", cfg.Type)
+	}
+}
+
+// subscriptions returns the subscription store of the context, a context
+// created without one gets a memory store
+func (eaaCtx *Context) subscriptions() subscriptionStore {
+	eaaCtx.subscriptionStoreInit.Do(func() {
+		if eaaCtx.subscriptionStore == nil {
+			eaaCtx.subscriptionStore = newMemorySubscriptionStore()
+		}
+	})
+	return eaaCtx.subscriptionStore
+}
+
+// storeError annotates an error of a subscription store. The subscription
+// map is left unchanged when it's returned.
+func storeError(err error) error {
+	return errors.Wrap(err, "Failed to store the subscription change")
+}
+
+// restoreSubscriptions rebuilds the subscription map from the store and
+// subscribes to the topics of the restored consumers and namespaces
+func restoreSubscriptions(eaaCtx *Context) error {
+	subs, err := eaaCtx.subscriptions().load()
+	if err != nil {
+		return errors.Wrap(err, "Failed to load subscriptions")
+	}
+
+	eaaCtx.subscriptionInfo.Lock()
+	consumers := make(map[string]bool)
+	leases := make(map[leaseKey]bool)
+	namespaces := make(map[string]bool)
+	for _, sub := range subs {
+		if sub.ServiceID == "" {
+			indexNamespaceSubscription(sub.CommonName, sub.Namespace,
+				sub.Notification, eaaCtx)
+		} else {
+			indexServiceSubscription(sub.CommonName, sub.Namespace, sub.ServiceID,
+				sub.Notification, eaaCtx)
+		}
+		consumers[sub.CommonName] = true
+		leases[leaseKey{sub.CommonName, sub.Namespace, sub.ServiceID}] = true
+		// Namespace patterns are subscribed when matching producers register
+		if !isNamespacePattern(sub.Namespace) {
+			namespaces[sub.Namespace] = true
+		}
+	}
+	eaaCtx.subscriptionInfo.Unlock()
+
+	// Leases aren't stored, restored subscriptions get a new default one
+	for key := range leases {
+		eaaCtx.subscriptionLeases.set(key, eaaCtx.config().DefaultSubscriptionLease.Duration,
+			time.Now())
+	}
+
+	for commonName := range consumers {
+		err = eaaCtx.MsgBrokerCtx.addSubscriber(clientSubscriber,
+			getClientTopicName(commonName), nil)
+		if _, ok := err.(objectAlreadyExistsError); err != nil && !ok {
+			return errors.Wrapf(err, "Failed to subscribe to the topic of %s", commonName)
+		}
+	}
+	for namespace := range namespaces {
+		if err = addNotificationSubscriber(namespace, nil, eaaCtx); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Restored %d subscriptions of %d consumers", len(subs), len(consumers))
+	return nil
+}
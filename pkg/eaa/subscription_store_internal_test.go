@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"errors"
+	"sort"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// errStoreUnavailable is returned by failingSubscriptionStore
+var errStoreUnavailable = errors.New("store unavailable")
+
+// failingSubscriptionStore is a subscription store failing all the changes
+// and loads
+type failingSubscriptionStore struct{}
+
+func (failingSubscriptionStore) addSubscriptions(string, string, string,
+	[]NotificationDescriptor) error {
+	return errStoreUnavailable
+}
+
+func (failingSubscriptionStore) removeSubscriptions(string, string, string,
+	[]NotificationDescriptor) error {
+	return errStoreUnavailable
+}
+
+func (failingSubscriptionStore) removeScopeSubscriptions(string, string, string) error {
+	return errStoreUnavailable
+}
+
+func (failingSubscriptionStore) removeConsumer(string) error {
+	return errStoreUnavailable
+}
+
+func (failingSubscriptionStore) load() ([]storedSubscription, error) {
+	return nil, errStoreUnavailable
+}
+
+func (failingSubscriptionStore) close() error {
+	return nil
+}
+
+// storedSubscriptions returns "consumer namespace serviceID name" of
+// the subscriptions of the store
+func storedSubscriptions(store subscriptionStore) []string {
+	loaded, err := store.load()
+	Expect(err).ToNot(HaveOccurred())
+
+	var subs []string
+	for _, sub := range loaded {
+		subs = append(subs, sub.CommonName+" "+sub.Namespace+" "+sub.ServiceID+" "+
+			sub.Notification.Name)
+	}
+	sort.Strings(subs)
+	return subs
+}
+
+var _ = g.Describe("Subscription store", func() {
+	var (
+		eaaCtx *Context
+		store  subscriptionStore
+	)
+
+	n1 := []NotificationDescriptor{{Name: "n1", Version: "1.0"}}
+	n2 := []NotificationDescriptor{{Name: "n2", Version: "1.0",
+		Filter: map[string]string{"zone": "a"}}}
+
+	newContext := func() *Context {
+		ctx := &Context{subscriptionStore: store}
+		ctx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		ctx.serviceInfo.m = make(map[string]Service)
+		return ctx
+	}
+
+	g.BeforeEach(func() {
+		store = newMemorySubscriptionStore()
+		eaaCtx = newContext()
+	})
+
+	g.It("mirrors subscription changes", func() {
+		Expect(addSubscriptionToNamespace("c1", "ns", append(n1, n2...), eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToService("c1", "ns", "p1", n1, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToService("c2", "ns", "p1", n1, eaaCtx)).To(Succeed())
+		Expect(storedSubscriptions(store)).To(Equal([]string{
+			"c1 ns  n1", "c1 ns  n2", "c1 ns p1 n1", "c2 ns p1 n1"}))
+
+		Expect(removeSubscriptionToNamespace("c1", "ns", n2, eaaCtx)).To(Succeed())
+		Expect(storedSubscriptions(store)).To(Equal([]string{"c1 ns  n1", "c1 ns p1 n1", "c2 ns p1 n1"}))
+
+		Expect(removeAllSubscriptionsToNamespace("c1", "ns", eaaCtx)).To(Succeed())
+		Expect(storedSubscriptions(store)).To(Equal([]string{"c1 ns p1 n1", "c2 ns p1 n1"}))
+
+		Expect(removeAllSubscriptionsToService("c2", "ns", "p1", eaaCtx)).To(Succeed())
+		Expect(storedSubscriptions(store)).To(Equal([]string{"c1 ns p1 n1"}))
+
+		Expect(removeAllSubscriptions("c1", eaaCtx)).To(Succeed())
+		Expect(storedSubscriptions(store)).To(BeEmpty())
+	})
+
+	g.It("restores the subscriptions after a restart", func() {
+		Expect(addSubscriptionToNamespace("c1", "ns", n2, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToService("c2", "ns", "p1", n1, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToNamespace("c3", "n*", n1, eaaCtx)).To(Succeed())
+
+		restarted := newContext()
+		restarted.MsgBrokerCtx = NewGoChannelMsgBroker(restarted)
+		defer func() { Expect(restarted.MsgBrokerCtx.removeAll()).To(Succeed()) }()
+		Expect(restoreSubscriptions(restarted)).To(Succeed())
+
+		// Creation times are those of the restore
+		for key, conSub := range restarted.subscriptionInfo.m {
+			Expect(conSub.created).To(HaveLen(len(eaaCtx.subscriptionInfo.m[key].created)))
+			conSub.created = eaaCtx.subscriptionInfo.m[key].created
+		}
+		Expect(restarted.subscriptionInfo.m).To(Equal(eaaCtx.subscriptionInfo.m))
+		Expect(restarted.MsgBrokerCtx.addSubscriber(notificationSubscriber,
+			getNotificationTopicName("ns"), nil)).To(
+			BeAssignableToTypeOf(objectAlreadyExistsError{}))
+		Expect(restarted.MsgBrokerCtx.addSubscriber(clientSubscriber,
+			getClientTopicName("c3"), nil)).To(
+			BeAssignableToTypeOf(objectAlreadyExistsError{}))
+	})
+
+	g.It("returns errors of the store", func() {
+		eaaCtx.subscriptionStore = failingSubscriptionStore{}
+
+		Expect(addSubscriptionToNamespace("c1", "ns", n1, eaaCtx)).ToNot(Succeed())
+		Expect(restoreSubscriptions(eaaCtx)).ToNot(Succeed())
+	})
+
+	g.It("leaves the subscriptions unchanged if the store fails", func() {
+		Expect(addSubscriptionToNamespace("c1", "ns", n1, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToService("c1", "ns", "p1", n1, eaaCtx)).To(Succeed())
+		subs, err := getConsumerSubscriptions("c1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		sortSubscriptions(subs.Subscriptions)
+
+		eaaCtx.subscriptionStore = failingSubscriptionStore{}
+		Expect(addSubscriptionToNamespace("c1", "ns", n2, eaaCtx)).ToNot(Succeed())
+		Expect(addSubscriptionToService("c1", "ns", "p2", n1, eaaCtx)).ToNot(Succeed())
+		Expect(removeSubscriptionToNamespace("c1", "ns", n1, eaaCtx)).ToNot(Succeed())
+		Expect(removeSubscriptionToService("c1", "ns", "p1", n1, eaaCtx)).ToNot(Succeed())
+		Expect(removeAllSubscriptionsToNamespace("c1", "ns", eaaCtx)).ToNot(Succeed())
+		Expect(removeAllSubscriptionsToService("c1", "ns", "p1", eaaCtx)).ToNot(Succeed())
+		Expect(removeAllSubscriptions("c1", eaaCtx)).ToNot(Succeed())
+
+		unchanged, err := getConsumerSubscriptions("c1", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+		sortSubscriptions(unchanged.Subscriptions)
+		Expect(unchanged).To(Equal(subs))
+	})
+
+	g.It("keeps the subscriptions in the default memory store", func() {
+		eaaCtx = &Context{}
+		eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+		Expect(addSubscriptionToNamespace("c1", "ns", n1, eaaCtx)).To(Succeed())
+		Expect(addSubscriptionToService("c1", "ns", "p1", n2, eaaCtx)).To(Succeed())
+
+		Expect(storedSubscriptions(eaaCtx.subscriptions())).To(Equal([]string{
+			"c1 ns  n1", "c1 ns p1 n2"}))
+	})
+})
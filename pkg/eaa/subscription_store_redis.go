@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// redisConsumersKey is the Redis set of consumers with stored subscriptions
+const redisConsumersKey = "eaa:consumers"
+
+// redisSubscriptionsKeyPrefix prefixes the Redis hash of subscriptions of
+// a consumer. Its fields identify subscriptions and values are
+// storedSubscription JSONs.
+const redisSubscriptionsKeyPrefix = "eaa:subscriptions:"
+
+// redisSubscriptionStore keeps subscriptions in Redis, so they survive
+// a restart and can be shared by EAA instances
+type redisSubscriptionStore struct {
+	client *redis.Client
+}
+
+// newRedisSubscriptionStore connects to the Redis server of the config
+func newRedisSubscriptionStore(cfg SubscriptionStoreInfo) (*redisSubscriptionStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping().Err(); err != nil {
+		_ = client.Close()
+		return nil, errors.Wrapf(err, "Failed to connect to Redis %s", cfg.Address)
+	}
+	return &redisSubscriptionStore{client: client}, nil
+}
+
+// redisSubscriptionField identifies a subscription within the hash of
+// the consumer
+func redisSubscriptionField(namespace, serviceID, name, version string) string {
+	// Marshaling an array of strings can't fail
+	field, _ := json.Marshal([]string{namespace, serviceID, name, version})
+	return string(field)
+}
+
+func (s *redisSubscriptionStore) addSubscriptions(commonName, namespace, serviceID string,
+	notif []NotificationDescriptor) error {
+
+	fields := make(map[string]interface{}, len(notif))
+	for _, n := range notif {
+		value, err := json.Marshal(storedSubscription{CommonName: commonName,
+			Namespace: namespace, ServiceID: serviceID, Notification: n})
+		if err != nil {
+			return errors.Wrap(err, "Failed to marshal the subscription")
+		}
+		field := redisSubscriptionField(namespace, serviceID, subscriptionNotifName(n),
+			n.Version)
+		fields[field] = value
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(redisSubscriptionsKeyPrefix+commonName, fields)
+		pipe.SAdd(redisConsumersKey, commonName)
+		return nil
+	})
+	return err
+}
+
+func (s *redisSubscriptionStore) removeSubscriptions(commonName, namespace, serviceID string,
+	notif []NotificationDescriptor) error {
+
+	if len(notif) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(notif))
+	for _, n := range notif {
+		fields = append(fields, redisSubscriptionField(namespace, serviceID,
+			subscriptionNotifName(n), n.Version))
+	}
+	return s.client.HDel(redisSubscriptionsKeyPrefix+commonName, fields...).Err()
+}
+
+func (s *redisSubscriptionStore) removeScopeSubscriptions(commonName, namespace,
+	serviceID string) error {
+
+	values, err := s.client.HGetAll(redisSubscriptionsKeyPrefix + commonName).Result()
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	for field, value := range values {
+		var sub storedSubscription
+		if err = json.Unmarshal([]byte(value), &sub); err != nil {
+			return errors.Wrapf(err, "Invalid subscription of %s", commonName)
+		}
+		if sub.Namespace == namespace && sub.ServiceID == serviceID {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return s.client.HDel(redisSubscriptionsKeyPrefix+commonName, fields...).Err()
+}
+
+func (s *redisSubscriptionStore) removeConsumer(commonName string) error {
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(redisSubscriptionsKeyPrefix + commonName)
+		pipe.SRem(redisConsumersKey, commonName)
+		return nil
+	})
+	return err
+}
+
+func (s *redisSubscriptionStore) load() ([]storedSubscription, error) {
+	consumers, err := s.client.SMembers(redisConsumersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []storedSubscription
+	for _, commonName := range consumers {
+		values, err := s.client.HGetAll(redisSubscriptionsKeyPrefix + commonName).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			var sub storedSubscription
+			if err = json.Unmarshal([]byte(value), &sub); err != nil {
+				return nil, errors.Wrapf(err, "Invalid subscription of %s", commonName)
+			}
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (s *redisSubscriptionStore) close() error {
+	return s.client.Close()
+}
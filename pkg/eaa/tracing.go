@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagators"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// EAA traces the API requests, the Message Broker publishes and
+// the notification deliveries with OpenTelemetry. The trace context of
+// a request is taken from its traceparent header and carried to the EAA
+// instances delivering a notification in the metadata of the Message Broker
+// message. Without Tracing.Endpoint the global tracer is a no-op one.
+const (
+	tracerName         = "github.com/open-ness/edgenode/pkg/eaa"
+	tracingServiceName = "eaa"
+)
+
+// Attributes of the EAA spans
+const (
+	commonNameAttribute    = label.Key("eaa.common_name")
+	namespaceAttribute     = label.Key("eaa.namespace")
+	correlationIDAttribute = label.Key("eaa.correlation_id")
+	subscribersAttribute   = label.Key("eaa.subscribers")
+	deliveredAttribute     = label.Key("eaa.delivered")
+	failedAttribute        = label.Key("eaa.failed")
+)
+
+// tracer returns the tracer of EAA spans
+func tracer() trace.Tracer {
+	return global.Tracer(tracerName)
+}
+
+// validateTracing checks the tracing settings
+func validateTracing(cfg TracingInfo) error {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return errors.Errorf("Tracing sample ratio %v is not within [0, 1]", cfg.SampleRatio)
+	}
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "Invalid tracing endpoint")
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return errors.Errorf("Tracing endpoint %s is not an HTTP URL", cfg.Endpoint)
+	}
+	return nil
+}
+
+// startTracing installs the global tracer exporting the spans to
+// the collector, the returned function flushes the spans left and stops
+// the export. Tracing is left disabled if no endpoint is set.
+func startTracing(cfg TracingInfo) func() {
+	if cfg.Endpoint == "" {
+		return func() {}
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	processor := sdktrace.NewBatchSpanProcessor(newZipkinExporter(cfg.Endpoint))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithConfig(sdktrace.Config{
+			DefaultSampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)),
+		}),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String(tracingServiceName))),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	global.SetTracerProvider(provider)
+	global.SetTextMapPropagator(otel.NewCompositeTextMapPropagator(
+		propagators.TraceContext{}, propagators.Baggage{}))
+	log.Infof("Exporting traces to %s", cfg.Endpoint)
+
+	return func() {
+		provider.UnregisterSpanProcessor(processor)
+	}
+}
+
+// commonNameAttributes returns the span attributes of the client of
+// the request, the namespace of a route is preferred to the one of
+// the client
+func commonNameAttributes(r *http.Request) []label.KeyValue {
+	var attrs []label.KeyValue
+	namespace := mux.Vars(r)["urn.namespace"]
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		attrs = append(attrs, commonNameAttribute.String(commonName))
+		if urn, err := CommonNameStringToURN(commonName); err == nil && namespace == "" {
+			namespace = urn.Namespace
+		}
+	}
+	if namespace != "" {
+		attrs = append(attrs, namespaceAttribute.String(namespace))
+	}
+	return attrs
+}
+
+// tracingMiddleware wraps the handling of every request except
+// the notification streams in a server span named after the route
+func tracingMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil || streamingRoutes[route.GetName()] ||
+				websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			template, _ := route.GetPathTemplate()
+			ctx := global.TextMapPropagator().Extract(r.Context(), r.Header)
+			ctx, span := tracer().Start(ctx, route.GetName(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(
+					tracingServiceName, template, r)...),
+				trace.WithAttributes(commonNameAttributes(r)...))
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rec.status)...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(rec.status))
+		})
+	}
+}
+
+// publishMessage publishes the message to the topic of the Message Broker
+// in a producer span, whose context is added to the message metadata.
+// The publish goes through the Message Broker circuit breaker.
+func publishMessage(ctx context.Context, topic string, msg *message.Message,
+	eaaCtx *Context) error {
+
+	return publishInSpan(ctx, topic, msg, func(ctx context.Context) error {
+		return publishThroughBreaker(ctx, topic, msg, eaaCtx)
+	})
+}
+
+// publishInSpan runs the publish of the message to the topic in a producer
+// span, whose context is added to the message metadata
+func publishInSpan(ctx context.Context, topic string, msg *message.Message,
+	publish func(ctx context.Context) error) error {
+
+	ctx, span := tracer().Start(ctx, "publish "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingDestinationKey.String(topic)))
+	defer span.End()
+	global.TextMapPropagator().Inject(ctx, msg.Metadata)
+
+	err := publish(ctx)
+	if err != nil {
+		span.RecordError(ctx, err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// startDeliverySpan starts the consumer span of the delivery of
+// a notification received from the Message Broker, continuing the trace of
+// its push
+func startDeliverySpan(msg *message.Message, producer URN,
+	correlationID string) (context.Context, trace.Span) {
+
+	ctx := global.TextMapPropagator().Extract(context.Background(), msg.Metadata)
+	return tracer().Start(ctx, "deliver notification",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			commonNameAttribute.String(producer.String()),
+			namespaceAttribute.String(producer.Namespace),
+			correlationIDAttribute.String(correlationID)))
+}
+
+// endDeliverySpan records the result of a delivery and ends its span
+func endDeliverySpan(ctx context.Context, span trace.Span, summary DeliverySummary,
+	err error) {
+
+	span.SetAttributes(
+		subscribersAttribute.Int(summary.Subscribers),
+		deliveredAttribute.Int(summary.Delivered),
+		failedAttribute.Int(summary.Failed))
+	if err != nil {
+		span.RecordError(ctx, err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if summary.Failed > 0 {
+		span.SetStatus(codes.Error, "notification not delivered to all subscribers")
+	}
+	span.End()
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagators"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+var _ = g.Describe("Tracing", func() {
+	const (
+		producer    = "ns:producer"
+		traceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	)
+
+	var (
+		eaaCtx   *Context
+		recorder *tracetest.StandardSpanRecorder
+		sent     chan []byte
+	)
+
+	completedSpan := func(name string) *tracetest.Span {
+		for _, span := range recorder.Completed() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		return nil
+	}
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := newTLSRequest(method, target, body, producer, eaaCtx)
+		r.Header.Set("traceparent", traceparent)
+		NewEaaRouter(eaaCtx).ServeHTTP(rec, r)
+		return rec
+	}
+
+	g.BeforeEach(func() {
+		recorder = &tracetest.StandardSpanRecorder{}
+		global.SetTracerProvider(tracetest.NewTracerProvider(tracetest.WithSpanRecorder(recorder)))
+		global.SetTextMapPropagator(propagators.TraceContext{})
+
+		sent = make(chan []byte, 1)
+		eaaCtx = newFanOutContext([]notificationConn{&fakeNotificationConn{sent: sent}})
+		eaaCtx.serviceInfo.m = map[string]Service{producer: {}}
+		eaaCtx.MsgBrokerCtx = NewGoChannelMsgBroker(eaaCtx)
+		Expect(addNotificationSubscriber("ns", nil, eaaCtx)).To(Succeed())
+	})
+
+	g.AfterEach(func() {
+		Expect(eaaCtx.MsgBrokerCtx.removeAll()).To(Succeed())
+		global.SetTracerProvider(trace.NoopTracerProvider())
+		global.SetTextMapPropagator(otel.NewCompositeTextMapPropagator())
+	})
+
+	g.It("traces a request in the trace of its caller", func() {
+		rec := serve(http.MethodGet, "/services/ns2/unknown", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+		span := completedSpan("GetService")
+		Expect(span).ToNot(BeNil())
+		Expect(span.SpanKind()).To(Equal(trace.SpanKindServer))
+		Expect(span.SpanContext().TraceID.String()).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+		Expect(span.ParentSpanID().String()).To(Equal("b7ad6b7169203331"))
+		Expect(span.StatusCode()).To(Equal(codes.Error))
+		attrs := span.Attributes()
+		Expect(attrs[commonNameAttribute].AsString()).To(Equal(producer))
+		Expect(attrs[namespaceAttribute].AsString()).To(Equal("ns2"))
+		Expect(attrs[semconv.HTTPStatusCodeKey].AsInt64()).To(BeEquivalentTo(http.StatusNotFound))
+		Expect(attrs[semconv.HTTPRouteKey].AsString()).To(Equal("/services/{urn.namespace}/{urn.id}"))
+	})
+
+	g.It("continues the trace of a push in the publish and the delivery", func() {
+		rec := serve(http.MethodPost, "/notifications", `{"name":"n1","version":"1.0","payload":{}}`)
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		<-sent
+
+		push := completedSpan("PushNotificationToSubscribers")
+		Expect(push).ToNot(BeNil())
+		Expect(push.StatusCode()).To(Equal(codes.Unset))
+		Expect(push.Attributes()[namespaceAttribute].AsString()).To(Equal("ns"))
+
+		publish := completedSpan("publish " + getNotificationTopicName("ns"))
+		Expect(publish).ToNot(BeNil())
+		Expect(publish.SpanKind()).To(Equal(trace.SpanKindProducer))
+		Expect(publish.ParentSpanID()).To(Equal(push.SpanContext().SpanID))
+
+		var delivery *tracetest.Span
+		Eventually(func() *tracetest.Span {
+			delivery = completedSpan("deliver notification")
+			return delivery
+		}).ShouldNot(BeNil())
+		Expect(delivery.SpanKind()).To(Equal(trace.SpanKindConsumer))
+		Expect(delivery.SpanContext().TraceID).To(Equal(push.SpanContext().TraceID))
+		Expect(delivery.ParentSpanID()).To(Equal(publish.SpanContext().SpanID))
+		attrs := delivery.Attributes()
+		Expect(attrs[commonNameAttribute].AsString()).To(Equal(producer))
+		Expect(attrs[deliveredAttribute].AsInt64()).To(BeEquivalentTo(1))
+	})
+
+	g.It("marks a failed publish", func() {
+		eaaCtx.MsgBrokerCtx = clientTopicFailingMsgBroker{
+			eaaCtx.MsgBrokerCtx.(*GoChannelMsgBroker)}
+		rec := serve(http.MethodPost, "/subscriptions/ns", `[{"name":"n2","version":"1.0"}]`)
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+
+		publish := completedSpan("publish " + getClientTopicName(producer))
+		Expect(publish).ToNot(BeNil())
+		Expect(publish.StatusCode()).To(Equal(codes.Error))
+		Expect(completedSpan("SubscribeNamespaceNotifications").StatusCode()).To(Equal(codes.Error))
+	})
+
+	g.It("leaves the notification streams untraced", func() {
+		serve(http.MethodGet, "/notifications", "")
+		Expect(recorder.Completed()).To(BeEmpty())
+	})
+})
+
+var _ = g.Describe("Zipkin exporter", func() {
+	g.It("posts the spans in the Zipkin v2 format", func() {
+		received := make(chan []byte, 1)
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- body
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer collector.Close()
+
+		traceID, _ := trace.IDFromHex("0af7651916cd43dd8448eb211c80319c")
+		spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+		parentID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+		start := time.Unix(1600000000, 0)
+		Expect(newZipkinExporter(collector.URL).ExportSpans(context.Background(),
+			[]*export.SpanData{{
+				SpanContext:   trace.SpanContext{TraceID: traceID, SpanID: spanID},
+				ParentSpanID:  parentID,
+				SpanKind:      trace.SpanKindServer,
+				Name:          "PushNotificationToSubscribers",
+				StartTime:     start,
+				EndTime:       start.Add(1500 * time.Microsecond),
+				Attributes:    []label.KeyValue{commonNameAttribute.String("ns:producer")},
+				StatusCode:    codes.Error,
+				StatusMessage: "HTTP status code: 503",
+			}})).To(Succeed())
+
+		Expect(json.RawMessage(<-received)).To(MatchJSON(`[{
+			"traceId": "0af7651916cd43dd8448eb211c80319c",
+			"id": "00f067aa0ba902b7",
+			"parentId": "b7ad6b7169203331",
+			"name": "PushNotificationToSubscribers",
+			"kind": "SERVER",
+			"timestamp": 1600000000000000,
+			"duration": 1500,
+			"localEndpoint": {"serviceName": "eaa"},
+			"tags": {"eaa.common_name": "ns:producer", "error": "HTTP status code: 503"}
+		}]`))
+	})
+
+	g.It("fails on a rejected export", func() {
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer collector.Close()
+
+		Expect(newZipkinExporter(collector.URL).ExportSpans(context.Background(),
+			[]*export.SpanData{{Name: "span"}})).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// Delivery modes of the notifications of a consumer, set by the delivery
+// query parameter of the subscribe requests
+const (
+	deliveryModeWebSocket = "websocket"
+	deliveryModeWebhook   = "webhook"
+)
+
+// Defaults of the webhook delivery if they're not set in the config
+const (
+	defaultWebhookTimeout       = 5 * time.Second
+	defaultWebhookRetryInterval = time.Second
+	defaultWebhookQueueSize     = 100
+)
+
+// webhookConn is a consumer connection POSTing notifications to the webhook
+// of the consumer. A notification still failing after the retries is dropped,
+// it doesn't close the connection.
+type webhookConn struct {
+	url           string
+	client        *http.Client
+	retries       int
+	retryInterval time.Duration
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+// post sends a notification to the webhook once
+func (c *webhookConn) post(data []byte) error {
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body, so that the connection is reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("webhook responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WriteMessage POSTs a notification to the webhook and retries it if it
+// fails, other messages are ignored
+func (c *webhookConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.post(data)
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.retries {
+			webhookDeliveriesFailedTotal.Inc()
+			log.Warningf("Notification not delivered to webhook %s after %d attempts: %v",
+				c.url, attempt+1, err)
+			return nil
+		}
+
+		select {
+		case <-time.After(c.retryInterval):
+		case <-c.done:
+			return errSendQueueClosed
+		}
+	}
+}
+
+// WriteControl is a no-op, webhooks have no control messages
+func (c *webhookConn) WriteControl(int, []byte, time.Time) error {
+	return nil
+}
+
+// Close stops retrying the notification being delivered
+func (c *webhookConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// webhookSubscriber is the webhook of a consumer and the queue of
+// the notifications POSTed to it
+type webhookSubscriber struct {
+	url  string
+	conn *queuedConn
+}
+
+// webhooks is a synchronized map of the consumers receiving their
+// notifications by webhooks. Webhooks are registered on the EAA instance
+// receiving the subscribe request, just like websockets are.
+type webhooks struct {
+	sync.RWMutex
+	m map[string]webhookSubscriber
+	// client POSTs the notifications with the EAA certificate, it's created
+	// on the first webhook registration
+	client *http.Client
+}
+
+// validateWebhookURL checks a webhook URL is an https URL of a host allowed
+// by the config, so that consumers can't make EAA send requests anywhere
+func validateWebhookURL(rawURL string, allowedHosts []string) error {
+	if len(allowedHosts) == 0 {
+		return errors.New("webhook delivery is disabled")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "invalid webhook URL")
+	}
+	if u.Scheme != "https" {
+		return errors.Errorf("webhook URL scheme must be https, got %q", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New("webhook URL must not contain user info")
+	}
+
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		// An allowed host without a port allows any port
+		if _, _, err = net.SplitHostPort(allowed); err == nil {
+			if host == allowed {
+				return nil
+			}
+		} else if hostname == allowed {
+			return nil
+		}
+	}
+	return errors.Errorf("webhook host %q is not allowed", u.Host)
+}
+
+// parseDelivery returns the delivery mode and the webhook URL of a subscribe
+// request, an empty mode keeps the current one of the consumer
+func parseDelivery(query url.Values, eaaCtx *Context) (string, string, error) {
+	mode := query.Get("delivery")
+	webhookURL := query.Get("webhookURL")
+
+	switch mode {
+	case "", deliveryModeWebSocket:
+		if webhookURL != "" {
+			return "", "", errors.New("webhookURL requires the webhook delivery")
+		}
+	case deliveryModeWebhook:
+		if webhookURL == "" {
+			return "", "", errors.New("webhook delivery requires a webhookURL")
+		}
+		if err := validateWebhookURL(webhookURL,
+			eaaCtx.config().Webhook.AllowedHosts); err != nil {
+			return "", "", err
+		}
+	default:
+		return "", "", errors.Errorf("unknown delivery mode %q", mode)
+	}
+	return mode, webhookURL, nil
+}
+
+// newWebhookClient creates the client POSTing notifications to webhooks.
+// It authenticates with the EAA certificate and verifies the webhooks
+// against the EAA root CA.
+func newWebhookClient(eaaCtx *Context) (*http.Client, error) {
+	cert, err := tls.LoadX509KeyPair(eaaCtx.config().Certs.ServerCertPath,
+		eaaCtx.config().Certs.ServerKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load the EAA certificate")
+	}
+	certPool, err := CreateAndSetCACertPool(eaaCtx.config().Certs.CaRootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := eaaCtx.config().Webhook.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				RootCAs:      certPool,
+				MinVersion:   tls.VersionTLS12,
+			},
+		},
+		// A redirect could lead to a host which isn't allowed
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+// setDelivery applies the delivery mode of a subscribe request to
+// the consumer. The webhook delivery starts a queue of notifications POSTed
+// to the webhook, the websocket delivery stops it.
+func setDelivery(commonName string, mode string, webhookURL string,
+	eaaCtx *Context) error {
+
+	switch mode {
+	case deliveryModeWebSocket:
+		eaaCtx.webhooks.remove(commonName)
+		return nil
+	case deliveryModeWebhook:
+	default:
+		return nil
+	}
+
+	eaaCtx.webhooks.Lock()
+	defer eaaCtx.webhooks.Unlock()
+
+	if sub, ok := eaaCtx.webhooks.m[commonName]; ok {
+		if sub.url == webhookURL {
+			return nil
+		}
+		_ = sub.conn.Close()
+	}
+	if eaaCtx.webhooks.client == nil {
+		client, err := newWebhookClient(eaaCtx)
+		if err != nil {
+			return err
+		}
+		eaaCtx.webhooks.client = client
+	}
+	if eaaCtx.webhooks.m == nil {
+		eaaCtx.webhooks.m = make(map[string]webhookSubscriber)
+	}
+
+	cfg := eaaCtx.config().Webhook
+	retryInterval := cfg.RetryInterval.Duration
+	if retryInterval <= 0 {
+		retryInterval = defaultWebhookRetryInterval
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultWebhookQueueSize
+	}
+	conn := &webhookConn{
+		url:           webhookURL,
+		client:        eaaCtx.webhooks.client,
+		retries:       cfg.Retries,
+		retryInterval: retryInterval,
+		done:          make(chan struct{}),
+	}
+	eaaCtx.webhooks.m[commonName] = webhookSubscriber{url: webhookURL,
+		conn: newQueuedConn(conn, queueSize, sendQueueOverflowDropOldest,
+			defaultWebhookTimeout)}
+	log.Infof("Notifications of %s are delivered to webhook %s", commonName, webhookURL)
+
+	return nil
+}
+
+// get returns the queue of the webhook of a consumer, false is returned if
+// the consumer has no webhook
+func (wh *webhooks) get(commonName string) (*queuedConn, bool) {
+	wh.RLock()
+	defer wh.RUnlock()
+
+	sub, ok := wh.m[commonName]
+	return sub.conn, ok
+}
+
+// remove stops the webhook delivery to a consumer, the queued notifications
+// are discarded
+func (wh *webhooks) remove(commonName string) {
+	wh.Lock()
+	defer wh.Unlock()
+
+	if sub, ok := wh.m[commonName]; ok {
+		_ = sub.conn.Close()
+		delete(wh.m, commonName)
+		log.Infof("Webhook delivery to %s stopped", commonName)
+	}
+}
+
+// drainWebhooks removes the webhooks, POSTs their queued notifications until
+// the deadline and closes them
+func drainWebhooks(deadline time.Time, eaaCtx *Context) {
+	eaaCtx.webhooks.Lock()
+	subs := eaaCtx.webhooks.m
+	eaaCtx.webhooks.m = nil
+	eaaCtx.webhooks.Unlock()
+
+	var wg sync.WaitGroup
+	for commonName, sub := range subs {
+		wg.Add(1)
+		go func(commonName string, conn *queuedConn) {
+			defer wg.Done()
+
+			if !conn.drain(deadline) {
+				log.Warningf("Notifications queued for the webhook of %s not drained, "+
+					"%d dropped", commonName, conn.queuedLen())
+			}
+			_ = conn.Close()
+		}(commonName, sub.conn)
+	}
+	wg.Wait()
+}
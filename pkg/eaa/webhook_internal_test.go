@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Webhook delivery", func() {
+	table.DescribeTable("validateWebhookURL",
+		func(rawURL string, allowed bool) {
+			err := validateWebhookURL(rawURL,
+				[]string{"functions.openness", "hooks.openness:8443"})
+			if allowed {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		table.Entry("allowed host on any port", "https://functions.openness:9000/n", true),
+		table.Entry("allowed host and port", "https://Hooks.openness:8443/n", true),
+		table.Entry("allowed host on another port", "https://hooks.openness/n", false),
+		table.Entry("host not allowed", "https://169.254.169.254/latest", false),
+		table.Entry("plain http", "http://functions.openness/n", false),
+		table.Entry("user info", "https://user@functions.openness/n", false),
+	)
+
+	g.It("is disabled without allowed hosts", func() {
+		Expect(validateWebhookURL("https://functions.openness/n", nil)).To(
+			MatchError("webhook delivery is disabled"))
+	})
+
+	var (
+		eaaCtx   *Context
+		wsConn   *fakeNotificationConn
+		server   *httptest.Server
+		received chan NotificationToConsumer
+		failures int32
+	)
+
+	g.BeforeEach(func() {
+		received = make(chan NotificationToConsumer, 10)
+		atomic.StoreInt32(&failures, 0)
+		server = httptest.NewTLSServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&failures, -1) >= 0 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				var notif NotificationToConsumer
+				_ = json.NewDecoder(r.Body).Decode(&notif)
+				received <- notif
+			}))
+
+		wsConn = &fakeNotificationConn{sent: make(chan []byte, 10)}
+		eaaCtx = newFanOutContext([]notificationConn{wsConn})
+		eaaCtx.webhooks.client = server.Client()
+		eaaCtx.cfg.Webhook.AllowedHosts = []string{"127.0.0.1"}
+		eaaCtx.cfg.Webhook.RetryInterval.Duration = 10 * time.Millisecond
+	})
+
+	g.AfterEach(func() {
+		eaaCtx.webhooks.remove("ns:consumer0")
+		server.Close()
+	})
+
+	deliver := func() {
+		_, err := deliverNotification(URN{ID: "producer", Namespace: "ns"},
+			&NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: []byte(`{"a":1}`)}, "", eaaCtx)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	g.It("POSTs notifications to the webhook instead of the websocket", func() {
+		Expect(setDelivery("ns:consumer0", deliveryModeWebhook, server.URL+"/n",
+			eaaCtx)).To(Succeed())
+
+		deliver()
+
+		var notif NotificationToConsumer
+		Eventually(received).Should(Receive(&notif))
+		Expect(notif.Name).To(Equal("n1"))
+		Expect(notif.URN).To(Equal(URN{ID: "producer", Namespace: "ns"}))
+		Expect(wsConn.sent).To(BeEmpty())
+
+		Expect(setDelivery("ns:consumer0", deliveryModeWebSocket, "",
+			eaaCtx)).To(Succeed())
+		deliver()
+		Expect(wsConn.sent).To(HaveLen(1))
+		Consistently(received, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	g.It("retries a failed POST", func() {
+		atomic.StoreInt32(&failures, 2)
+		eaaCtx.cfg.Webhook.Retries = 2
+		Expect(setDelivery("ns:consumer0", deliveryModeWebhook, server.URL,
+			eaaCtx)).To(Succeed())
+
+		deliver()
+
+		Eventually(received).Should(Receive())
+	})
+
+	g.It("drops a notification after the retries", func() {
+		atomic.StoreInt32(&failures, 2)
+		eaaCtx.cfg.Webhook.Retries = 1
+		Expect(setDelivery("ns:consumer0", deliveryModeWebhook, server.URL,
+			eaaCtx)).To(Succeed())
+
+		deliver()
+		Eventually(func() int32 { return atomic.LoadInt32(&failures) }).Should(
+			Equal(int32(0)))
+		deliver()
+
+		Eventually(received).Should(Receive())
+		Expect(received).To(BeEmpty())
+	})
+
+	g.It("stops when the consumer unsubscribes from everything", func() {
+		Expect(setDelivery("ns:consumer0", deliveryModeWebhook, server.URL,
+			eaaCtx)).To(Succeed())
+
+		Expect(removeAllSubscriptions("ns:consumer0", eaaCtx)).To(Succeed())
+
+		_, ok := eaaCtx.webhooks.get("ns:consumer0")
+		Expect(ok).To(BeFalse())
+	})
+
+	g.It("rejects a subscription with a webhook of a host not allowed", func() {
+		query := url.Values{"delivery": {deliveryModeWebhook},
+			"webhookURL": {"https://169.254.169.254/latest"}}
+		rec := httptest.NewRecorder()
+		r := newTLSRequest(http.MethodPost, "/subscriptions/ns?"+query.Encode(),
+			`[{"name":"n1","version":"1.0"}]`, "ns:consumer0", eaaCtx)
+
+		SubscribeNamespaceNotifications(rec, mux.SetURLVars(r,
+			map[string]string{"urn.namespace": "ns"}))
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring(reasonInvalidDelivery))
+		_, ok := eaaCtx.webhooks.get("ns:consumer0")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsCloseReason is the close code and the reason sent in the close frame
+// of a consumer connection closed by EAA. The reason is a fixed string
+// clients can match on, the code tells whether to reconnect:
+//
+//	Code  Reason                Cause                                 Client
+//	1000  connection_closed     consumer closed or lost the           reconnect
+//	                            connection
+//	1001  server_shutdown       EAA shuts down                        reconnect with backoff
+//	4000  connection_replaced   consumer opened a new connection      don't reconnect
+//	                            without a filter
+//	4001  auth_expired          client certificate expired, after     renew it, then reconnect
+//	                            ClientCertificateExpiryGrace
+//	4002  idle_timeout          no pong within WebSocketPongTimeout,  reconnect
+//	                            or no activity within
+//	                            WebSocketIdleTimeout
+//	4003  backpressure_drop     consumer didn't keep up with          reconnect, replay the
+//	                            the notifications                     missed notifications
+//	4004  subscription_removed  no subscribed service is registered   don't reconnect until
+//	                            anymore                               resubscribed
+//	4005  disconnected          disconnected by an admin              don't reconnect
+//	4006  subscription_failed   subscriptions couldn't be received    reconnect with backoff
+//	                            from the Message Broker
+//	4007  snapshot_failed       the service snapshot requested        reconnect with backoff
+//	                            couldn't be sent
+//	4008  ack_backlog           NotificationAckBacklogLimit           reconnect, ack
+//	                            notifications await the ack with      the notifications
+//	                            the disconnect policy
+type wsCloseReason struct {
+	code int
+	text string
+}
+
+var (
+	connectionClosedCloseReason    = wsCloseReason{websocket.CloseNormalClosure, "connection_closed"}
+	shutdownCloseReason            = wsCloseReason{websocket.CloseGoingAway, "server_shutdown"}
+	connectionReplacedCloseReason  = wsCloseReason{4000, "connection_replaced"}
+	authExpiredCloseReason         = wsCloseReason{4001, "auth_expired"}
+	idleTimeoutCloseReason         = wsCloseReason{4002, "idle_timeout"}
+	backpressureCloseReason        = wsCloseReason{4003, "backpressure_drop"}
+	serviceDeregisteredCloseReason = wsCloseReason{4004, "subscription_removed"}
+	disconnectedCloseReason        = wsCloseReason{4005, "disconnected"}
+	subscriberFailedCloseReason    = wsCloseReason{4006, "subscription_failed"}
+	snapshotFailedCloseReason      = wsCloseReason{4007, "snapshot_failed"}
+	ackBacklogCloseReason          = wsCloseReason{4008, "ack_backlog"}
+)
+
+// closeFrameTimeout bounds writing a close frame to a consumer
+const closeFrameTimeout = time.Second
+
+// message returns the payload of the close frame
+func (r wsCloseReason) message() []byte {
+	return websocket.FormatCloseMessage(r.code, r.text)
+}
+
+// readCloseReason returns the close reason of a connection whose read
+// failed, a consumer missing the pongs timed out
+func readCloseReason(err error) wsCloseReason {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return idleTimeoutCloseReason
+	}
+	return connectionClosedCloseReason
+}
+
+// closeWithReason sends the close frame with the reason to the consumer
+// connection and closes it. A failed close frame is logged only, the
+// connection may be broken already.
+func closeWithReason(commonName string, conn notificationConn, reason wsCloseReason) {
+	err := conn.WriteControl(websocket.CloseMessage, reason.message(),
+		time.Now().Add(closeFrameTimeout))
+	if err != nil {
+		log.Infof("Failed to send close message to %s: %v", commonName, err)
+	}
+	if err = conn.Close(); err != nil {
+		log.Infof("Failed to close the connection of %s: %v", commonName, err)
+	}
+}
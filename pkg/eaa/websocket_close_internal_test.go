@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+
+	g "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// timeoutError is a net.Error of a read deadline passed
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ = g.Describe("WebSocket close reasons", func() {
+	table.DescribeTable("are derived from a failed read",
+		func(err error, expected wsCloseReason) {
+			Expect(readCloseReason(err)).To(Equal(expected))
+		},
+		table.Entry("pong timeout", timeoutError{}, idleTimeoutCloseReason),
+		table.Entry("connection lost", io.ErrUnexpectedEOF, connectionClosedCloseReason),
+		table.Entry("other error", errors.New("closed"), connectionClosedCloseReason),
+	)
+
+	g.It("are sent to the unfiltered connection replaced by a new one", func() {
+		eaaCtx := &Context{}
+		conn := &closingNotificationConn{closeFrame: make(chan []byte, 1)}
+		filtered := &closingNotificationConn{closeFrame: make(chan []byte, 1)}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: conn},
+				{connection: filtered, filter: connectionFilter{names: []string{"n1"}}}}}
+
+		closePreviousConsumerConnection("ns:consumer", eaaCtx)
+
+		Expect(<-conn.closeFrame).To(Equal(connectionReplacedCloseReason.message()))
+		Expect(atomic.LoadInt32(&conn.closed)).To(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&filtered.closed)).To(BeZero())
+		Expect(eaaCtx.consumerConnections.m["ns:consumer"]).To(HaveLen(1))
+	})
+
+	g.It("are sent to every connection of a disconnected consumer", func() {
+		eaaCtx := &Context{}
+		conns := []*closingNotificationConn{
+			{closeFrame: make(chan []byte, 1)}, {closeFrame: make(chan []byte, 1)}}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: conns[0]}, {connection: conns[1]}}}
+
+		Expect(closeConsumerConnection("ns:consumer", disconnectedCloseReason,
+			eaaCtx)).To(Equal(2))
+
+		for _, conn := range conns {
+			Expect(<-conn.closeFrame).To(Equal(disconnectedCloseReason.message()))
+			Expect(atomic.LoadInt32(&conn.closed)).To(Equal(int32(1)))
+		}
+		Expect(eaaCtx.consumerConnections.m).To(BeEmpty())
+	})
+
+	g.It("are sent to a connection removed after a failed read", func() {
+		eaaCtx := &Context{}
+		conn := &closingNotificationConn{closeFrame: make(chan []byte, 1)}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: conn}}}
+
+		removeConsumerConnection("ns:consumer", conn, timeoutError{},
+			readCloseReason(timeoutError{}), eaaCtx)
+
+		Expect(<-conn.closeFrame).To(Equal(idleTimeoutCloseReason.message()))
+		Expect(eaaCtx.consumerConnections.m).To(BeEmpty())
+	})
+})
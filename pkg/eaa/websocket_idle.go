@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// connActivity is the time of the last activity on a consumer websocket,
+// which is a notification written to it, a pong or a message of
+// the consumer. The zero value is ready to use.
+type connActivity struct {
+	last int64
+}
+
+// touch records an activity at now
+func (a *connActivity) touch(now time.Time) {
+	if a != nil {
+		atomic.StoreInt64(&a.last, now.UnixNano())
+	}
+}
+
+// lastActive returns the time of the last activity
+func (a *connActivity) lastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&a.last))
+}
+
+// idleTrackingConn is a consumer connection recording the notifications
+// written to it as its activity
+type idleTrackingConn struct {
+	notificationConn
+	activity *connActivity
+}
+
+// WriteMessage writes the message and records the activity if it's written
+func (c idleTrackingConn) WriteMessage(messageType int, data []byte) error {
+	if err := c.notificationConn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	c.activity.touch(time.Now())
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of a websocket, it's a no-op
+// for other connections
+func (c idleTrackingConn) SetWriteDeadline(t time.Time) error {
+	if conn, ok := c.notificationConn.(interface {
+		SetWriteDeadline(t time.Time) error
+	}); ok {
+		return conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// closeWhenIdle schedules closing the consumer websocket with
+// idleTimeoutCloseReason once it has no activity for the timeout. The
+// registered connection is the one stored in the consumer connections.
+func closeWhenIdle(commonName string, registered notificationConn, activity *connActivity,
+	timeout time.Duration, eaaCtx *Context) {
+
+	var check func()
+	check = func() {
+		if next := closeIdleConsumerConnection(commonName, registered, activity, timeout,
+			eaaCtx); next > 0 {
+			time.AfterFunc(next, check)
+		}
+	}
+	time.AfterFunc(timeout, check)
+}
+
+// closeIdleConsumerConnection closes the consumer websocket if it has no
+// activity for the timeout, otherwise it returns when to check it again.
+// A closed connection isn't checked anymore.
+func closeIdleConsumerConnection(commonName string, registered notificationConn,
+	activity *connActivity, timeout time.Duration, eaaCtx *Context) time.Duration {
+
+	eaaCtx.consumerConnections.RLock()
+	found := false
+	for _, consumerConn := range eaaCtx.consumerConnections.m[commonName] {
+		if consumerConn.connection == registered {
+			found = true
+			break
+		}
+	}
+	eaaCtx.consumerConnections.RUnlock()
+	if !found {
+		return 0
+	}
+
+	idle := time.Since(activity.lastActive())
+	if idle < timeout {
+		return timeout - idle
+	}
+	removeConsumerConnection(commonName, registered,
+		fmt.Errorf("no activity for %v", idle.Round(time.Millisecond)),
+		idleTimeoutCloseReason, eaaCtx)
+	return 0
+}
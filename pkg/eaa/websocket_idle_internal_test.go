@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("Idle consumer websockets", func() {
+	g.It("closes a silent connection after the idle timeout", func() {
+		eaaCtx := &Context{}
+		eaaCtx.consumerConnections = consumerConns{m: make(map[string][]ConsumerConnection)}
+		eaaCtx.cfg.WebSocketIdleTimeout.Duration = 100 * time.Millisecond
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: r.Host}}}}
+			_, _, err := createWsConn(w, r.WithContext(context.WithValue(r.Context(),
+				contextKey("appliance-ctx"), eaaCtx)))
+			Expect(err).ShouldNot(HaveOccurred())
+		}))
+		defer server.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		_, _, err = conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		Expect(errors.As(err, &closeErr)).To(BeTrue())
+		Expect(closeErr.Code).To(Equal(idleTimeoutCloseReason.code))
+		Expect(closeErr.Text).To(Equal(idleTimeoutCloseReason.text))
+		eaaCtx.consumerConnections.RLock()
+		defer eaaCtx.consumerConnections.RUnlock()
+		Expect(eaaCtx.consumerConnections.m).To(BeEmpty())
+	})
+
+	g.It("keeps a connection notifications are written to", func() {
+		const timeout = time.Minute
+		eaaCtx := &Context{}
+		activity := &connActivity{}
+		conn := idleTrackingConn{&fakeNotificationConn{sent: make(chan []byte, 1)}, activity}
+		eaaCtx.consumerConnections.m = map[string][]ConsumerConnection{
+			"ns:consumer": {{connection: conn}}}
+
+		g.By("writing a notification")
+		activity.touch(time.Now().Add(-2 * timeout))
+		Expect(conn.WriteMessage(websocket.TextMessage, []byte(`{}`))).To(Succeed())
+		Expect(closeIdleConsumerConnection("ns:consumer", conn, activity, timeout,
+			eaaCtx)).To(BeNumerically(">", timeout-time.Second))
+		Expect(eaaCtx.consumerConnections.m).To(HaveKey("ns:consumer"))
+
+		g.By("staying silent for the timeout")
+		activity.touch(time.Now().Add(-timeout))
+		Expect(closeIdleConsumerConnection("ns:consumer", conn, activity, timeout,
+			eaaCtx)).To(BeZero())
+		Expect(eaaCtx.consumerConnections.m).To(BeEmpty())
+	})
+})
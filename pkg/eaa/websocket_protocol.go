@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Websocket subprotocols of the notification envelope versions. A consumer
+// requesting no subprotocol gets the NotificationToConsumer envelope of v1.
+const (
+	NotificationsProtocolV1 = "eaa.v1"
+	NotificationsProtocolV2 = "eaa.v2"
+)
+
+// notificationsProtocols are the supported subprotocols in the order of
+// preference
+var notificationsProtocols = []string{NotificationsProtocolV2, NotificationsProtocolV1}
+
+// errUnsupportedSubprotocol is returned if a consumer requests only
+// subprotocols EAA doesn't support
+var errUnsupportedSubprotocol = errors.New("unsupported websocket subprotocol")
+
+// negotiateNotificationsProtocol returns the most preferred subprotocol
+// requested by the consumer, empty if it requested none
+func negotiateNotificationsProtocol(r *http.Request) (string, error) {
+	requested := websocket.Subprotocols(r)
+	if len(requested) == 0 {
+		return "", nil
+	}
+	for _, supported := range notificationsProtocols {
+		for _, protocol := range requested {
+			if protocol == supported {
+				return protocol, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w %v, supported are %v", errUnsupportedSubprotocol, requested,
+		notificationsProtocols)
+}
+
+// notificationV2Conn is a consumer connection converting notifications to
+// the envelope of the v2 subprotocol
+type notificationV2Conn struct {
+	notificationConn
+}
+
+// WriteMessage converts a notification, or each notification of a batch, to
+// the v2 envelope, other messages are written as they are
+func (c notificationV2Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return c.notificationConn.WriteMessage(messageType, data)
+	}
+
+	var (
+		encoded []byte
+		err     error
+	)
+	if isNotificationBatch(data) {
+		var batch []NotificationToConsumer
+		if err = json.Unmarshal(data, &batch); err != nil {
+			return fmt.Errorf("failed to decode the notifications: %w", err)
+		}
+		envelopes := make([]NotificationToConsumerV2, 0, len(batch))
+		for _, notif := range batch {
+			envelopes = append(envelopes, notificationEnvelopeV2(notif))
+		}
+		encoded, err = json.Marshal(envelopes)
+	} else {
+		var notif NotificationToConsumer
+		if err = json.Unmarshal(data, &notif); err != nil {
+			return fmt.Errorf("failed to decode the notification: %w", err)
+		}
+		encoded, err = json.Marshal(notificationEnvelopeV2(notif))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode the notification: %w", err)
+	}
+	return c.notificationConn.WriteMessage(messageType, encoded)
+}
+
+// notificationEnvelopeV2 converts a notification to the v2 envelope
+func notificationEnvelopeV2(notif NotificationToConsumer) NotificationToConsumerV2 {
+	return NotificationToConsumerV2{
+		Metadata: NotificationMetadata{
+			Name:              notif.Name,
+			Version:           notif.Version,
+			Producer:          notif.URN,
+			Sequence:          notif.Sequence,
+			Priority:          notif.Priority,
+			CorrelationID:     notif.CorrelationID,
+			Broadcast:         notif.Broadcast,
+			ReceivedAt:        notif.ReceivedAt,
+			ProducerTimestamp: notif.ProducerTimestamp,
+		},
+		Payload:   notif.Payload,
+		Signature: notif.Signature,
+	}
+}
+
+// SetWriteDeadline sets the write deadline of a websocket, it's a no-op
+// for other connections
+func (c notificationV2Conn) SetWriteDeadline(t time.Time) error {
+	if conn, ok := c.notificationConn.(interface {
+		SetWriteDeadline(t time.Time) error
+	}); ok {
+		return conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// notificationMsgpackConn is a consumer connection encoding the notification
+// envelopes as MessagePack, they are written as binary messages
+type notificationMsgpackConn struct {
+	notificationConn
+}
+
+// WriteMessage encodes a notification as MessagePack, other messages are
+// written as they are
+func (c notificationMsgpackConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return c.notificationConn.WriteMessage(messageType, data)
+	}
+
+	data, err := jsonToMsgpack(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode the notification: %w", err)
+	}
+	return c.notificationConn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// SetWriteDeadline sets the write deadline of a websocket, it's a no-op
+// for other connections
+func (c notificationMsgpackConn) SetWriteDeadline(t time.Time) error {
+	if conn, ok := c.notificationConn.(interface {
+		SetWriteDeadline(t time.Time) error
+	}); ok {
+		return conn.SetWriteDeadline(t)
+	}
+	return nil
+}
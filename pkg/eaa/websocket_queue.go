@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// Policies applied to a full consumer send queue
+const (
+	sendQueueOverflowDropOldest = "drop-oldest"
+	sendQueueOverflowDisconnect = "disconnect"
+)
+
+// errSendQueueClosed is returned when writing to a closed queued connection
+var errSendQueueClosed = errors.New("send queue is closed")
+
+// errNotificationDropped is returned for a notification dropped instead of
+// being written, as its deadline passed or the send queue is full of
+// messages of a higher priority
+var errNotificationDropped = errors.New("notification dropped")
+
+// numNotificationPriorities is the number of send queues of a connection
+const numNotificationPriorities = 3
+
+// priorityQueueIndex returns the index of the send queue of the priority,
+// the higher the priority the lower the index
+func priorityQueueIndex(priority NotificationPriority) int {
+	switch priority {
+	case NotificationPriorityHigh:
+		return 0
+	case NotificationPriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// priorityConn is a consumer connection delivering messages by priority
+// until their deadline, a zero deadline never passes
+type priorityConn interface {
+	writePriorityMessage(data []byte, priority NotificationPriority,
+		deadline time.Time) error
+}
+
+// isStale checks if the deadline of a notification passed by now
+func isStale(deadline time.Time, now time.Time) bool {
+	return !deadline.IsZero() && now.After(deadline)
+}
+
+// queuedMessage is a message waiting in a send queue
+type queuedMessage struct {
+	data     []byte
+	deadline time.Time
+}
+
+// queuedConn is a consumer connection whose messages are queued and written
+// by a dedicated goroutine, so that a slow consumer doesn't delay
+// the delivery to the others. Messages of a higher priority are written
+// before the queued ones of lower priorities, messages of the same priority
+// are written in order. Messages whose deadline passes while they're queued
+// are dropped. Control messages are written directly.
+type queuedConn struct {
+	conn         notificationConn
+	size         int
+	overflow     string
+	writeTimeout time.Duration
+	// queueLock guards the send queues of the priorities and their length
+	queueLock sync.Mutex
+	queues    [numNotificationPriorities][]queuedMessage
+	queued    int
+	// writing is set while a dequeued message is being written
+	writing bool
+	// ready wakes up the writer when a message is queued
+	ready     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	// closed is called once the queue closed the connection after a failed
+	// write or an overflow, nil if the owner doesn't need to know
+	closed func(cause error)
+}
+
+// newQueuedConn starts the writer of a connection with a send queue of
+// the given size and overflow policy
+func newQueuedConn(conn notificationConn, size int, overflow string,
+	writeTimeout time.Duration) *queuedConn {
+
+	c := &queuedConn{
+		conn:         conn,
+		size:         size,
+		overflow:     overflow,
+		writeTimeout: writeTimeout,
+		ready:        make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	go c.write()
+	return c
+}
+
+// next dequeues the oldest message of the highest priority, stale messages
+// are dropped on the way. False is returned if no message is queued.
+func (c *queuedConn) next() ([]byte, bool) {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+
+	now := time.Now()
+	for i := range c.queues {
+		for len(c.queues[i]) > 0 {
+			msg := c.queues[i][0]
+			c.queues[i][0] = queuedMessage{}
+			c.queues[i] = c.queues[i][1:]
+			c.queued--
+			if isStale(msg.deadline, now) {
+				notificationsDroppedStaleTotal.Inc()
+				continue
+			}
+			c.writing = true
+			return msg.data, true
+		}
+	}
+	return nil, false
+}
+
+// written marks the message dequeued last as written
+func (c *queuedConn) written() {
+	c.queueLock.Lock()
+	c.writing = false
+	c.queueLock.Unlock()
+}
+
+// drain waits until the queued messages are written, false is returned if
+// the deadline passes or the connection is closed first
+func (c *queuedConn) drain(deadline time.Time) bool {
+	for {
+		c.queueLock.Lock()
+		drained := c.queued == 0 && !c.writing
+		c.queueLock.Unlock()
+		if drained {
+			return true
+		}
+
+		select {
+		case <-c.done:
+			return false
+		default:
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// queuedLen returns the number of queued messages
+func (c *queuedConn) queuedLen() int {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+
+	return c.queued
+}
+
+// write writes the queued messages until the connection is closed or
+// a write fails
+func (c *queuedConn) write() {
+	deadlineConn, hasDeadline := c.conn.(interface {
+		SetWriteDeadline(t time.Time) error
+	})
+
+	for {
+		data, ok := c.next()
+		if !ok {
+			select {
+			case <-c.ready:
+				continue
+			case <-c.done:
+				return
+			}
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		if hasDeadline {
+			if err := deadlineConn.SetWriteDeadline(
+				time.Now().Add(c.writeTimeout)); err != nil {
+				log.Warningf("Failed to set the websocket write deadline: %v", err)
+			}
+		}
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Warningf("Closing websocket after a failed write: %v", err)
+			c.fail(err)
+			return
+		}
+		c.written()
+	}
+}
+
+// WriteMessage queues a text message of normal priority. A close message
+// is written immediately.
+func (c *queuedConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return c.conn.WriteControl(messageType, data, time.Now().Add(c.writeTimeout))
+	}
+	return c.writePriorityMessage(data, NotificationPriorityNormal, time.Time{})
+}
+
+// writePriorityMessage queues a text message of the priority. A full queue
+// drops the oldest message of the lowest priority queued, or the new message
+// if its priority is lower still, unless the overflow policy disconnects.
+// A message whose deadline passed already isn't queued. errNotificationDropped
+// is returned for a message which isn't queued.
+func (c *queuedConn) writePriorityMessage(data []byte,
+	priority NotificationPriority, deadline time.Time) error {
+
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+
+	select {
+	case <-c.done:
+		return errSendQueueClosed
+	default:
+	}
+	if isStale(deadline, time.Now()) {
+		notificationsDroppedStaleTotal.Inc()
+		return errors.Wrap(errNotificationDropped, "deadline passed")
+	}
+
+	index := priorityQueueIndex(priority)
+	if c.queued >= c.size {
+		if c.overflow == sendQueueOverflowDisconnect {
+			err := errors.New("send queue overflow, websocket closed")
+			c.fail(err)
+			return err
+		}
+
+		lowest := len(c.queues) - 1
+		for len(c.queues[lowest]) == 0 && lowest > 0 {
+			lowest--
+		}
+		notificationsDroppedTotal.Inc()
+		if index > lowest || len(c.queues[lowest]) == 0 {
+			return errors.Wrap(errNotificationDropped, "send queue is full")
+		}
+		c.queues[lowest][0] = queuedMessage{}
+		c.queues[lowest] = c.queues[lowest][1:]
+		c.queued--
+	}
+
+	c.queues[index] = append(c.queues[index],
+		queuedMessage{data: data, deadline: deadline})
+	c.queued++
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// WriteControl writes a control message, it may be called concurrently
+// with the writer
+func (c *queuedConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return c.conn.WriteControl(messageType, data, deadline)
+}
+
+// closeWithReason sends the close frame with the reason unless the connection
+// is closed already, then closes it
+func (c *queuedConn) closeWithReason(reason wsCloseReason) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	if err := c.conn.WriteControl(websocket.CloseMessage, reason.message(),
+		time.Now().Add(closeFrameTimeout)); err != nil {
+		log.Infof("Failed to send close message: %v", err)
+	}
+	_ = c.Close()
+}
+
+// fail closes the connection with the backpressure close reason and lets
+// the owner know
+func (c *queuedConn) fail(cause error) {
+	c.closeWithReason(backpressureCloseReason)
+	if c.closed != nil {
+		// An overflow is hit by a sender which may hold the lock of
+		// the consumer connections
+		go c.closed(cause)
+	}
+}
+
+// Close stops the writer and closes the connection. Queued messages are
+// discarded.
+func (c *queuedConn) Close() error {
+	err := errSendQueueClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return err
+}
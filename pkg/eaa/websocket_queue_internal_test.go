@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	g "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// slowNotificationConn is a consumer connection taking a while to write
+type slowNotificationConn struct {
+	fakeNotificationConn
+	delay time.Duration
+}
+
+func (c *slowNotificationConn) WriteMessage(int, []byte) error {
+	time.Sleep(c.delay)
+	return nil
+}
+
+var _ = g.Describe("Consumer send queue", func() {
+	var conn *fakeNotificationConn
+
+	// newBlockedQueue returns a full queue of two messages whose writer
+	// is blocked writing the first one
+	newBlockedQueue := func(overflow string) *queuedConn {
+		queued := newQueuedConn(conn, 2, overflow, time.Second)
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("a"))).To(Succeed())
+		Eventually(queued.queuedLen).Should(BeZero())
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("b"))).To(Succeed())
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("c"))).To(Succeed())
+		return queued
+	}
+
+	g.BeforeEach(func() {
+		conn = &fakeNotificationConn{sent: make(chan []byte)}
+	})
+
+	g.It("drops the oldest queued message on overflow", func() {
+		queued := newBlockedQueue(sendQueueOverflowDropOldest)
+		defer queued.Close()
+
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("d"))).To(Succeed())
+		Expect(<-conn.sent).To(Equal([]byte("a")))
+		Expect(<-conn.sent).To(Equal([]byte("c")))
+		Expect(<-conn.sent).To(Equal([]byte("d")))
+	})
+
+	g.It("writes queued messages by priority", func() {
+		queued := newBlockedQueue(sendQueueOverflowDropOldest)
+		defer queued.Close()
+
+		Expect(queued.writePriorityMessage([]byte("h"), NotificationPriorityHigh,
+			time.Time{})).To(Succeed())
+		Expect(<-conn.sent).To(Equal([]byte("a")))
+		Expect(<-conn.sent).To(Equal([]byte("h")))
+		Expect(<-conn.sent).To(Equal([]byte("c")))
+	})
+
+	g.It("drops low priority messages first on overflow", func() {
+		queued := newQueuedConn(conn, 2, sendQueueOverflowDropOldest, time.Second)
+		defer queued.Close()
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("a"))).To(Succeed())
+		Eventually(queued.queuedLen).Should(BeZero())
+
+		for _, msg := range []struct {
+			data     string
+			priority NotificationPriority
+			dropped  bool
+		}{
+			{"l1", NotificationPriorityLow, false},
+			{"n1", NotificationPriorityNormal, false},
+			{"h1", NotificationPriorityHigh, false},
+			{"l2", NotificationPriorityLow, true},
+		} {
+			err := queued.writePriorityMessage([]byte(msg.data), msg.priority, time.Time{})
+			if msg.dropped {
+				Expect(errors.Is(err, errNotificationDropped)).To(BeTrue())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}
+
+		Expect(<-conn.sent).To(Equal([]byte("a")))
+		Expect(<-conn.sent).To(Equal([]byte("h1")))
+		Expect(<-conn.sent).To(Equal([]byte("n1")))
+		Consistently(conn.sent).ShouldNot(Receive())
+	})
+
+	g.It("drops messages whose deadline passes before they're written", func() {
+		dropped := testutil.ToFloat64(notificationsDroppedStaleTotal)
+		queued := newQueuedConn(conn, 10, sendQueueOverflowDropOldest, time.Second)
+		defer queued.Close()
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("a"))).To(Succeed())
+		Eventually(queued.queuedLen).Should(BeZero())
+
+		now := time.Now()
+		Expect(errors.Is(queued.writePriorityMessage([]byte("late"), NotificationPriorityHigh,
+			now.Add(-time.Second)), errNotificationDropped)).To(BeTrue())
+		Expect(queued.queuedLen()).To(BeZero())
+		Expect(queued.writePriorityMessage([]byte("stale"), NotificationPriorityHigh,
+			now.Add(20*time.Millisecond))).To(Succeed())
+		Expect(queued.writePriorityMessage([]byte("fresh"), NotificationPriorityNormal,
+			now.Add(time.Hour))).To(Succeed())
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("timeless"))).To(Succeed())
+		time.Sleep(50 * time.Millisecond)
+
+		Expect(<-conn.sent).To(Equal([]byte("a")))
+		Expect(<-conn.sent).To(Equal([]byte("fresh")))
+		Expect(<-conn.sent).To(Equal([]byte("timeless")))
+		Expect(testutil.ToFloat64(notificationsDroppedStaleTotal)).To(Equal(dropped + 2))
+	})
+
+	g.It("closes the connection on overflow", func() {
+		queued := newBlockedQueue(sendQueueOverflowDisconnect)
+
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("d"))).ToNot(Succeed())
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("e"))).To(
+			Equal(errSendQueueClosed))
+	})
+
+	g.It("sends the backpressure close reason on overflow", func() {
+		closing := &closingNotificationConn{
+			fakeNotificationConn: fakeNotificationConn{sent: make(chan []byte)},
+			closeFrame:           make(chan []byte, 1),
+		}
+		queued := newQueuedConn(closing, 1, sendQueueOverflowDisconnect, time.Second)
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("a"))).To(Succeed())
+		Eventually(queued.queuedLen).Should(BeZero())
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("b"))).To(Succeed())
+
+		Expect(queued.WriteMessage(websocket.TextMessage, []byte("c"))).ToNot(Succeed())
+		Expect(<-closing.closeFrame).To(Equal(backpressureCloseReason.message()))
+		Expect(atomic.LoadInt32(&closing.closed)).To(Equal(int32(1)))
+		Expect(<-closing.sent).To(Equal([]byte("a")))
+	})
+
+	g.It("removes the consumer connections it closes without a keepalive", func() {
+		eaaCtx := &Context{}
+		eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+		eaaCtx.cfg.WebSocketSendQueueSize = 1
+		eaaCtx.cfg.WebSocketSendQueueOverflow = sendQueueOverflowDisconnect
+
+		failing := queueConsumerConn("ns:consumer", &failingNotificationConn{}, eaaCtx)
+		overflowing := queueConsumerConn("ns:consumer", conn, eaaCtx)
+		other := &fakeNotificationConn{}
+		for _, c := range []notificationConn{failing, overflowing, other} {
+			eaaCtx.consumerConnections.add("ns:consumer", ConsumerConnection{connection: c})
+		}
+
+		Expect(failing.WriteMessage(websocket.TextMessage, []byte("a"))).To(Succeed())
+		Expect(overflowing.WriteMessage(websocket.TextMessage, []byte("a"))).To(Succeed())
+		Eventually(overflowing.(*queuedConn).queuedLen).Should(BeZero())
+		Expect(overflowing.WriteMessage(websocket.TextMessage, []byte("b"))).To(Succeed())
+		Expect(overflowing.WriteMessage(websocket.TextMessage, []byte("c"))).ToNot(Succeed())
+
+		Eventually(func() []ConsumerConnection {
+			eaaCtx.consumerConnections.RLock()
+			defer eaaCtx.consumerConnections.RUnlock()
+			return eaaCtx.consumerConnections.m["ns:consumer"]
+		}).Should(Equal([]ConsumerConnection{{connection: other}}))
+		Expect(<-conn.sent).To(Equal([]byte("a")))
+	})
+})
+
+// BenchmarkNotificationFanOut sends notifications to 100 consumers one of
+// which takes 5ms to write a notification. Written directly, every
+// notification waits for the slow consumer, queued it doesn't.
+func BenchmarkNotificationFanOut(b *testing.B) {
+	const (
+		producer  = "ns:producer"
+		consumers = 100
+	)
+
+	for _, queueSize := range []int{0, 1024} {
+		b.Run("queue="+strconv.Itoa(queueSize), func(b *testing.B) {
+			eaaCtx := &Context{}
+			eaaCtx.serviceInfo.m = map[string]Service{producer: {}}
+			eaaCtx.subscriptionInfo.m = make(map[UniqueNotif]*ConsumerSubscription)
+			eaaCtx.consumerConnections.m = make(map[string][]ConsumerConnection)
+
+			var subscribers SubscriberIds
+			for i := 0; i < consumers; i++ {
+				id := fmt.Sprintf("ns:consumer%d", i)
+				var conn notificationConn = &slowNotificationConn{}
+				if i == 0 {
+					conn = &slowNotificationConn{delay: 5 * time.Millisecond}
+				}
+				if queueSize > 0 {
+					queued := newQueuedConn(conn, queueSize, sendQueueOverflowDropOldest,
+						time.Second)
+					defer queued.Close()
+					conn = queued
+				}
+				eaaCtx.consumerConnections.m[id] = []ConsumerConnection{{connection: conn}}
+				subscribers = append(subscribers, id)
+			}
+			eaaCtx.subscriptionInfo.m[UniqueNotif{"ns", "n1", "1.0"}] = &ConsumerSubscription{
+				namespaceSubscriptions: subscribers,
+				serviceSubscriptions:   make(map[string]SubscriberIds),
+			}
+
+			notif := &NotificationFromProducer{Name: "n1", Version: "1.0",
+				Payload: []byte(`{}`)}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := sendNotificationToAllSubscribers(producer, notif,
+					"", eaaCtx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2020 Intel Corporation
+
+package eaa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+)
+
+// zipkinExportTimeout bounds posting a batch of spans to the collector
+const zipkinExportTimeout = 10 * time.Second
+
+// zipkinSpan is a span of the Zipkin v2 JSON API, which Zipkin, Jaeger and
+// the OpenTelemetry Collector accept
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// zipkinSpanKinds are the Zipkin kinds of the span kinds, internal spans
+// have none
+var zipkinSpanKinds = map[trace.SpanKind]string{
+	trace.SpanKindServer:   "SERVER",
+	trace.SpanKindClient:   "CLIENT",
+	trace.SpanKindProducer: "PRODUCER",
+	trace.SpanKindConsumer: "CONSUMER",
+}
+
+// zipkinExporter posts the spans to the Zipkin v2 spans endpoint of
+// a collector
+type zipkinExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newZipkinExporter(endpoint string) *zipkinExporter {
+	return &zipkinExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: zipkinExportTimeout},
+	}
+}
+
+// toZipkinSpan converts a span to the Zipkin model
+func toZipkinSpan(data *export.SpanData) zipkinSpan {
+	span := zipkinSpan{
+		TraceID:       data.SpanContext.TraceID.String(),
+		ID:            data.SpanContext.SpanID.String(),
+		Name:          data.Name,
+		Kind:          zipkinSpanKinds[data.SpanKind],
+		Timestamp:     data.StartTime.UnixNano() / int64(time.Microsecond),
+		Duration:      int64(data.EndTime.Sub(data.StartTime) / time.Microsecond),
+		LocalEndpoint: zipkinEndpoint{ServiceName: tracingServiceName},
+		Tags:          make(map[string]string, len(data.Attributes)+1),
+	}
+	if data.ParentSpanID.IsValid() {
+		span.ParentID = data.ParentSpanID.String()
+	}
+	// Zipkin drops spans shorter than a microsecond
+	if span.Duration < 1 {
+		span.Duration = 1
+	}
+	for _, attr := range data.Attributes {
+		span.Tags[string(attr.Key)] = attr.Value.Emit()
+	}
+	if data.StatusCode == codes.Error {
+		span.Tags["error"] = data.StatusMessage
+		if data.StatusMessage == "" {
+			span.Tags["error"] = "true"
+		}
+	}
+	return span
+}
+
+// ExportSpans posts a batch of spans to the collector
+func (e *zipkinExporter) ExportSpans(ctx context.Context, spans []*export.SpanData) error {
+	zipkinSpans := make([]zipkinSpan, 0, len(spans))
+	for _, data := range spans {
+		zipkinSpans = append(zipkinSpans, toZipkinSpan(data))
+	}
+	body, err := json.Marshal(zipkinSpans)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal spans")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint,
+		bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create the span export request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to export spans")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("Span export rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown stops the export, spans aren't buffered by the exporter
+func (e *zipkinExporter) Shutdown(context.Context) error {
+	return nil
+}